@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// Self-service account deletion. Deleting deactivates the account at once,
+// so sessions end and logins are refused, and schedules its erasure after
+// a grace period. Reactivating the account within it, with a code like any
+// deactivated account, cancels the deletion. Erasure is anonymizeUser's:
+// personal data goes, ledger rows stay with their wallet IDs.
+
+const jobAccountErase = "account.erase" // {"userId","reason"}
+
+// DELETE /v1/users/me  {"stepUpToken":"...","reason":"..."}
+// Refused while the wallet holds funds or money is in flight; the user
+// withdraws first rather than finding out when the grace period ends.
+func (app *App) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		StepUpToken string `json:"stepUpToken"`
+		Reason      string `json:"reason" validate:"max=500"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.StepUpToken) == "" {
+		apierror.Write(w, apierror.New(http.StatusForbidden, "step_up_required"))
+		return
+	}
+	ctx := r.Context()
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkErasable(ctx, tx, uid); err != nil {
+		code := dataRequestErrorCode(err)
+		if code == "db_error" {
+			log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("deletion check failed")
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, code))
+			return
+		}
+		apierror.Write(w, apierror.New(http.StatusConflict, code))
+		return
+	}
+	if ok, err := spendStepUpToken(ctx, tx, uid, body.StepUpToken); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	} else if !ok {
+		apierror.Write(w, apierror.New(http.StatusForbidden, "step_up_required"))
+		return
+	}
+
+	eraseAt := time.Now().Add(app.Settings.Days(ctx, settings.DeletionGraceDays))
+	reason := strings.TrimSpace(body.Reason)
+	_, err = tx.Exec(ctx, `
+		UPDATE users SET deactivated_at = COALESCE(deactivated_at, now()), deletion_scheduled_at = $2
+		WHERE id = $1
+	`, uid, eraseAt)
+	if err == nil {
+		_, err = revokeAllSessions(ctx, tx, uid)
+	}
+	if err == nil {
+		// a cancelled deletion's job finds nothing to do, so each request
+		// gets its own
+		err = jobs.Enqueue(ctx, tx, jobAccountErase, map[string]any{"userId": uid, "reason": reason},
+			jobs.Options{RunAt: eraseAt})
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("schedule account deletion failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	app.invalidateUser(ctx, uid)
+	data := map[string]any{"eraseAt": eraseAt}
+	if reason != "" {
+		data["reason"] = reason
+	}
+	app.recordSecurityEvent(r, uid, secDeleteRequested, data)
+
+	writeJSON(w, http.StatusAccepted, map[string]any{"data": map[string]any{"eraseAt": eraseAt}})
+}
+
+// accountEraseJob erases an account whose deletion has come due, through a
+// data request so it leaves the same record as an admin-run erasure. One
+// that can't be erased (money came in during the grace period) is
+// dead-lettered for someone to settle by hand.
+func (app *App) accountEraseJob(ctx context.Context, job *jobs.Job) error {
+	var p struct {
+		UserID string `json:"userId"`
+		Reason string `json:"reason"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+	var wait int64 // seconds until it is due
+	err := app.DB.QueryRow(ctx, `
+		SELECT GREATEST(CEIL(EXTRACT(EPOCH FROM deletion_scheduled_at - now())), 0)::bigint FROM users
+		WHERE id = $1 AND deletion_scheduled_at IS NOT NULL AND anonymized_at IS NULL
+	`, p.UserID).Scan(&wait)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // cancelled or already erased
+	}
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		// asked for again after a cancel, or the clocks disagree
+		return jobs.RetryAfter(time.Duration(wait)*time.Second, errors.New("account deletion not yet due"))
+	}
+
+	d, err := app.runDataRequest(ctx, p.UserID, "deletion", "self", p.UserID, p.Reason, "")
+	if err != nil {
+		if dataRequestErrorCode(err) != "db_error" {
+			return jobs.Permanent(fmt.Errorf("account erasure refused (data request %s): %w", d.ID, err))
+		}
+		return err
+	}
+	log.Ctx(ctx).Info().Str("user_id", p.UserID).Str("data_request_id", d.ID).Msg("account erased")
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+// Merging duplicate accounts, done by an admin once the owner has proven
+// they hold both. The source account's balance moves to the target by an
+// account_merge ledger transfer, and its payout destinations, linked
+// identities and (if the target has none) phone number move with it. Its
+// sessions don't: a device signed in to the source, perhaps by whoever
+// compromised it, is signed out rather than handed the target, and its
+// owner signs in to the target afresh. The source is then closed and points
+// at the target; its history stays where it was.
+
+// POST /v1/admin/users/{id}/merge  {"sourceUserId":"...","reason":"..."}
+// {id} is the account that remains.
+func (app *App) AdminMergeUser(w http.ResponseWriter, r *http.Request) {
+	actor, _ := getUserID(r)
+	target := strings.ToLower(strings.TrimSpace(chi.URLParam(r, "id")))
+	var body struct {
+		SourceUserID string `json:"sourceUserId" validate:"required,uuid"`
+		Reason       string `json:"reason" validate:"required,max=500"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	source := strings.ToLower(body.SourceUserID)
+	if source == target {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "merge_same_user"))
+		return
+	}
+	ctx := r.Context()
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	type party struct {
+		role            string
+		closed          bool
+		phone           *string
+		phoneVerifiedAt *time.Time
+	}
+	parties := map[string]party{}
+	rows, err := tx.Query(ctx, `
+		SELECT id::text, role, anonymized_at IS NOT NULL OR merged_into IS NOT NULL, phone, phone_verified_at
+		FROM users WHERE id::text = ANY($1)
+		ORDER BY id
+		FOR UPDATE
+	`, []string{source, target})
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	for rows.Next() {
+		var id string
+		var p party
+		if err := rows.Scan(&id, &p.role, &p.closed, &p.phone, &p.phoneVerifiedAt); err != nil {
+			rows.Close()
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		parties[id] = p
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	src, ok1 := parties[source]
+	dst, ok2 := parties[target]
+	if !ok1 || !ok2 {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if src.role != "user" || dst.role != "user" || src.closed || dst.closed {
+		apierror.Write(w, apierror.New(http.StatusConflict, "merge_not_allowed"))
+		return
+	}
+
+	// money or promises in flight would land on, or be owed by, a closed account
+	var inFlight int64
+	if err := tx.QueryRow(ctx, `
+		SELECT
+		  (SELECT COUNT(*) FROM payouts WHERE user_id=$1 AND status IN ('pending','processing','approved')) +
+		  (SELECT COUNT(*) FROM held_gifts WHERE (sender_id=$1 OR recipient_id=$1) AND status='held') +
+		  (SELECT COUNT(*) FROM vouchers WHERE issuer_user_id=$1 AND status='active') +
+		  (SELECT COUNT(*) FROM direct_debits WHERE user_id=$1 AND status IN ('pending','processing')) +
+		  (SELECT COUNT(*) FROM scheduled_gifts WHERE sender_id=$1 AND status='scheduled')
+	`, source).Scan(&inFlight); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if inFlight > 0 {
+		apierror.Write(w, apierror.New(http.StatusConflict, "merge_in_progress"))
+		return
+	}
+
+	var srcWid, dstWid string
+	if err := tx.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id=$1`, source).Scan(&srcWid); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "wallet_not_found"))
+		return
+	}
+	if err := tx.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id=$1`, target).Scan(&dstWid); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "wallet_not_found"))
+		return
+	}
+	if err := app.lockWallets(ctx, tx, srcWid, dstWid); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "lock_wallets_error"))
+		return
+	}
+	balance, err := balanceOf(ctx, tx, srcWid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	var txID *string
+	if balance > 0 {
+		var id string
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+			VALUES ($1,'account_merge',$2,'NGN', jsonb_build_object('sourceUserId', $3::text, 'targetUserId', $4::text))
+			RETURNING id
+		`, "merge:"+source, balance, source, target).Scan(&id); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_tx_error"))
+			return
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+			VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+		`, id, srcWid, balance, dstWid); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_ledger_error"))
+			return
+		}
+		txID = &id
+	}
+
+	moved := map[string]int64{}
+	sessions, err := revokeAllSessions(ctx, tx, source)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	steps := []struct{ name, sql string }{
+		// the target's own copy of a destination wins
+		{"duplicateDestinations", `
+			UPDATE payout_destinations s SET deleted_at=now()
+			WHERE s.user_id=$1 AND s.deleted_at IS NULL AND EXISTS (
+			  SELECT 1 FROM payout_destinations t
+			  WHERE t.user_id=$2 AND t.deleted_at IS NULL AND t.bank_code=s.bank_code AND t.account_number=s.account_number)`},
+		{"destinations", `UPDATE payout_destinations SET user_id=$2 WHERE user_id=$1 AND deleted_at IS NULL`},
+		{"identities", `UPDATE user_identities SET user_id=$2 WHERE user_id=$1`},
+		// beneficiaries the target already has, or that are the target, stay behind
+		{"beneficiaries", `
+			UPDATE beneficiaries s SET user_id=$2
+			WHERE s.user_id=$1 AND s.recipient_id IS DISTINCT FROM $2 AND NOT EXISTS (
+			  SELECT 1 FROM beneficiaries t
+			  WHERE t.user_id=$2 AND (t.recipient_id=s.recipient_id OR t.destination_id=s.destination_id))`},
+		{"savedAsBeneficiary", `
+			UPDATE beneficiaries s SET recipient_id=$2
+			WHERE s.recipient_id=$1 AND s.user_id<>$2 AND NOT EXISTS (
+			  SELECT 1 FROM beneficiaries t WHERE t.user_id=s.user_id AND t.recipient_id=$2)`},
+	}
+	for _, s := range steps {
+		tag, err := tx.Exec(ctx, s.sql, source, target)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("step", s.name).Msg("merge step failed")
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		moved[s.name] = tag.RowsAffected()
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE users SET
+		  merged_into=$2, merged_at=now(), phone=NULL, phone_verified_at=NULL,
+		  status='banned', status_reason=$4, status_expires_at=NULL,
+		  status_changed_by=$3, status_changed_at=now()
+		WHERE id=$1
+	`, source, target, actor, "merged into "+target); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	phoneMoved := src.phone != nil && dst.phone == nil
+	if phoneMoved {
+		if _, err := tx.Exec(ctx, `UPDATE users SET phone=$2, phone_verified_at=$3 WHERE id=$1`,
+			target, *src.phone, src.phoneVerifiedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	app.invalidateUser(ctx, source, target)
+	if txID != nil {
+		app.sendBalance(ctx, target)
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "user.merge",
+		TargetType: "user",
+		TargetID:   target,
+		Before:     map[string]any{"sourceUserId": source, "sourceBalance": balance},
+		After: map[string]any{
+			"sourceUserId": source, "reason": strings.TrimSpace(body.Reason), "txId": txID,
+			"moved": moved, "phoneMoved": phoneMoved, "sessionsRevoked": sessions,
+		},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"targetUserId": target,
+		"sourceUserId": source,
+		"amount":       balance,
+		"txId":         txID,
+		"moved":        moved,
+		"phoneMoved":   phoneMoved,
+	}})
+}
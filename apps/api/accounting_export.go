@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// Accounting exports turn the ledger into journal entries finance can
+// import into QuickBooks (IIF) or Xero (manual journal CSV). There is one
+// journal per UTC day and transaction kind. User wallets post to the
+// mapped wallets account; the side of the system or migration wallet posts
+// to the account mapped for the kind. Movements between user wallets, such as gifts, net
+// to nothing and are left out. Kinds without a mapping post to an
+// "Unmapped: <kind>" account, so they stand out on import rather than
+// vanish.
+
+const (
+	jobAccountingExport = "accounting.export" // {"exportId"}
+
+	maxAccountingExportDays = 92
+)
+
+type accountingExportDTO struct {
+	ID           string     `json:"id"`
+	Format       string     `json:"format"`
+	From         string     `json:"from"`
+	To           string     `json:"to"`
+	Status       string     `json:"status"` // pending | ready | failed
+	JournalCount *int       `json:"journalCount,omitempty"`
+	Error        *string    `json:"error,omitempty"`
+	RequestedBy  *string    `json:"requestedBy,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+}
+
+const accountingExportCols = `id, format, period_from, period_to, status, journal_count, error, requested_by, created_at, completed_at`
+
+func scanAccountingExport(row pgx.Row) (accountingExportDTO, error) {
+	var e accountingExportDTO
+	var from, to time.Time
+	err := row.Scan(&e.ID, &e.Format, &from, &to, &e.Status, &e.JournalCount, &e.Error, &e.RequestedBy, &e.CreatedAt, &e.CompletedAt)
+	e.From, e.To = from.Format("2006-01-02"), to.Format("2006-01-02")
+	return e, err
+}
+
+// journal is one balanced entry: lines are kobo per account, debits
+// positive.
+type journal struct {
+	Date  time.Time
+	Kind  string
+	Lines map[string]int64
+}
+
+func (j journal) ref() string {
+	return "OKIES-" + j.Date.Format("20060102") + "-" + strings.ToUpper(j.Kind)
+}
+
+func (j journal) memo() string {
+	return "Okies " + strings.ReplaceAll(j.Kind, "_", " ") + " " + j.Date.Format("2006-01-02")
+}
+
+// accounts returns the journal's accounts in a stable order.
+func (j journal) accounts() []string {
+	out := make([]string, 0, len(j.Lines))
+	for acct := range j.Lines {
+		out = append(out, acct)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// buildJournals sums the ledger for [from, end) into daily journals.
+func (app *App) buildJournals(ctx context.Context, from, end time.Time, m settings.AccountMap) ([]journal, error) {
+	platform, err := app.platformWallets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := app.DB.Query(ctx, `
+		SELECT date_trunc('day', t.created_at AT TIME ZONE 'UTC'), t.kind, le.wallet_id = ANY($1), le.direction, SUM(le.amount)
+		FROM ledger_entries le JOIN transactions t ON t.id = le.tx_id
+		WHERE t.created_at >= $2 AND t.created_at < $3
+		GROUP BY 1, 2, 3, 4
+		ORDER BY 1, 2
+	`, platform, from, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []journal
+	for rows.Next() {
+		var day time.Time
+		var kind, direction string
+		var system bool
+		var amount int64
+		if err := rows.Scan(&day, &kind, &system, &direction, &amount); err != nil {
+			return nil, err
+		}
+		if len(out) == 0 || !out[len(out)-1].Date.Equal(day) || out[len(out)-1].Kind != kind {
+			out = append(out, journal{Date: day, Kind: kind, Lines: map[string]int64{}})
+		}
+		acct := m.Wallets
+		if system {
+			acct = m.Kinds[kind]
+			if acct == "" {
+				acct = "Unmapped: " + kind
+			}
+		}
+		if direction == "credit" {
+			amount = -amount
+		}
+		out[len(out)-1].Lines[acct] += amount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	kept := out[:0]
+	for _, j := range out {
+		for acct, amt := range j.Lines {
+			if amt == 0 {
+				delete(j.Lines, acct)
+			}
+		}
+		if len(j.Lines) > 0 {
+			kept = append(kept, j)
+		}
+	}
+	return kept, nil
+}
+
+// koboAmount renders kobo as a decimal naira amount, e.g. -1234.50.
+func koboAmount(kobo int64) string {
+	sign := ""
+	if kobo < 0 {
+		sign, kobo = "-", -kobo
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, kobo/100, kobo%100)
+}
+
+// writeIIF renders journals as QuickBooks Desktop general journal
+// transactions. IIF amounts are debits when positive.
+func writeIIF(journals []journal) []byte {
+	var b bytes.Buffer
+	b.WriteString("!TRNS\tTRNSID\tTRNSTYPE\tDATE\tACCNT\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!SPL\tSPLID\tTRNSTYPE\tDATE\tACCNT\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!ENDTRNS\n")
+	clean := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+	for _, j := range journals {
+		for i, acct := range j.accounts() {
+			head := "SPL"
+			if i == 0 {
+				head = "TRNS"
+			}
+			fmt.Fprintf(&b, "%s\t\tGENERAL JOURNAL\t%s\t%s\t%s\t%s\t%s\n", head,
+				j.Date.Format("01/02/2006"), clean.Replace(acct), koboAmount(j.Lines[acct]), j.ref(), j.memo())
+		}
+		b.WriteString("ENDTRNS\n")
+	}
+	return b.Bytes()
+}
+
+// writeXeroCSV renders journals in Xero's manual journal import layout.
+// Lines sharing a narration and date form one journal; amounts are debits
+// when positive.
+func writeXeroCSV(journals []journal, taxRate string) []byte {
+	var b bytes.Buffer
+	cw := csv.NewWriter(&b)
+	_ = cw.Write([]string{"*Narration", "*Date", "Description", "*AccountCode", "*TaxRate", "*Amount",
+		"TrackingName1", "TrackingOption1", "TrackingName2", "TrackingOption2"})
+	for _, j := range journals {
+		for _, acct := range j.accounts() {
+			_ = cw.Write([]string{j.ref(), j.Date.Format("02/01/2006"), j.memo(), acct, taxRate,
+				koboAmount(j.Lines[acct]), "", "", "", ""})
+		}
+	}
+	cw.Flush()
+	return b.Bytes()
+}
+
+// accountingExportJob builds the export file. The export is marked failed
+// when the last attempt fails, so admins stop polling.
+func (app *App) accountingExportJob(ctx context.Context, job *jobs.Job) (err error) {
+	var p struct {
+		ExportID string `json:"exportId"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+	defer func() {
+		if err != nil && job.Attempt >= job.MaxAttempts {
+			_, _ = app.DB.Exec(ctx, `
+				UPDATE accounting_exports SET status='failed', error=$2, completed_at=now()
+				WHERE id=$1 AND status='pending'
+			`, p.ExportID, err.Error())
+		}
+	}()
+
+	var format, status string
+	var from, to time.Time
+	var rawMap []byte
+	err = app.DB.QueryRow(ctx, `
+		SELECT format, period_from, period_to, status, account_map FROM accounting_exports WHERE id=$1
+	`, p.ExportID).Scan(&format, &from, &to, &status, &rawMap)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if status != "pending" {
+		return nil
+	}
+	m, err := settings.ParseAccountMap(string(rawMap))
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	journals, err := app.buildJournals(ctx, from, to.AddDate(0, 0, 1), m)
+	if err != nil {
+		return err
+	}
+	var content []byte
+	switch format {
+	case "quickbooks_iif":
+		content = writeIIF(journals)
+	case "xero_csv":
+		content = writeXeroCSV(journals, m.TaxRate)
+	default:
+		return jobs.Permanent(fmt.Errorf("unknown export format %q", format))
+	}
+	_, err = app.DB.Exec(ctx, `
+		UPDATE accounting_exports SET status='ready', content=$2, journal_count=$3, completed_at=now()
+		WHERE id=$1 AND status='pending'
+	`, p.ExportID, string(content), len(journals))
+	return err
+}
+
+// ---------- Handlers (Admin) ----------
+
+// POST /v1/admin/accounting/exports  {"format":"quickbooks_iif|xero_csv","from":"2025-01-01","to":"2025-01-31"}
+// Days are UTC and inclusive. The export uses the account map setting as it
+// is now; poll GET .../{id} until it is ready, then download it.
+func (app *App) AdminCreateAccountingExport(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Format string `json:"format" validate:"required,oneof=quickbooks_iif xero_csv"`
+		From   string `json:"from" validate:"required,datetime=2006-01-02"`
+		To     string `json:"to" validate:"required,datetime=2006-01-02"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	from, _ := time.Parse("2006-01-02", body.From)
+	to, _ := time.Parse("2006-01-02", body.To)
+	switch {
+	case to.Before(from), to.After(startOfDay(time.Now(), time.UTC)):
+		apierror.Write(w, apierror.InvalidField("to"))
+		return
+	case to.After(from.AddDate(0, 0, maxAccountingExportDays)):
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "export_period_too_long"))
+		return
+	}
+	m, _ := json.Marshal(app.Settings.AccountMap(r.Context(), settings.AccountingAccountMap))
+
+	actor, _ := getUserID(r)
+	ctx := r.Context()
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+	e, err := scanAccountingExport(tx.QueryRow(ctx, `
+		INSERT INTO accounting_exports (format, period_from, period_to, account_map, requested_by)
+		VALUES ($1,$2,$3,$4::jsonb,$5)
+		RETURNING `+accountingExportCols,
+		body.Format, body.From, body.To, string(m), actor))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("create accounting export failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := jobs.Enqueue(ctx, tx, jobAccountingExport, map[string]string{"exportId": e.ID}, jobs.Options{}); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "accounting_export.create",
+		TargetType: "accounting_export",
+		TargetID:   e.ID,
+		After:      e,
+	})
+	writeJSON(w, http.StatusAccepted, map[string]any{"data": e})
+}
+
+// GET /v1/admin/accounting/exports
+func (app *App) AdminListAccountingExports(w http.ResponseWriter, r *http.Request) {
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT `+accountingExportCols+` FROM accounting_exports ORDER BY created_at DESC LIMIT 100
+	`)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []accountingExportDTO{}
+	for rows.Next() {
+		e, err := scanAccountingExport(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, e)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// GET /v1/admin/accounting/exports/{id}
+func (app *App) AdminGetAccountingExport(w http.ResponseWriter, r *http.Request) {
+	e, err := scanAccountingExport(app.DB.QueryRow(r.Context(), `
+		SELECT `+accountingExportCols+` FROM accounting_exports WHERE id=$1
+	`, strings.TrimSpace(chi.URLParam(r, "id"))))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": e})
+}
+
+// GET /v1/admin/accounting/exports/{id}/download
+func (app *App) AdminDownloadAccountingExport(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var format string
+	var from, to time.Time
+	var content *string
+	err := app.DB.QueryRow(r.Context(), `
+		SELECT format, period_from, period_to, content FROM accounting_exports WHERE id=$1
+	`, id).Scan(&format, &from, &to, &content)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if content == nil {
+		apierror.Write(w, apierror.New(http.StatusConflict, "export_not_ready"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "accounting_export.download",
+		TargetType: "accounting_export",
+		TargetID:   id,
+	})
+	name := "okies-journals-" + from.Format("20060102") + "-" + to.Format("20060102")
+	if format == "quickbooks_iif" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		name += ".iif"
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		name += ".csv"
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(*content))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+)
+
+// An account's activity trail: security events (sign-ins, failed password
+// attempts, changes to how the account is reached) and money movements in
+// one list, so users can review what happened without asking support.
+
+// Security event kinds.
+const (
+	secLogin            = "login" // data.method: password, otp, google, apple or reactivate
+	secLoginFailed      = "login_failed"
+	secLogout           = "logout"
+	secLogoutAll        = "logout_all" // data.sessions: how many were revoked
+	secSessionRevoked   = "session_revoked"
+	secResetRequested   = "password_reset_requested"
+	secPasswordReset    = "password_reset" // data.sessions: how many were signed out
+	secStepUp           = "step_up"        // data.method: password or code
+	secStepUpFailed     = "step_up_failed"
+	secPhoneVerified    = "phone_verified"
+	secPhoneRemoved     = "phone_removed"
+	secIdentityLinked   = "identity_linked"
+	secIdentityUnlinked = "identity_unlinked"
+	secUsernameChanged  = "username_changed"
+	secPasswordChanged  = "password_changed"
+	secDeactivated      = "deactivated"
+	secDeleteRequested  = "deletion_requested"
+	secReactivated      = "reactivated" // data.channel: email or phone
+)
+
+// recordSecurityEvent notes kind on userID's trail with the request's IP
+// and user agent. Failures are logged, never returned: the action it
+// describes has already happened.
+func (app *App) recordSecurityEvent(r *http.Request, userID, kind string, data map[string]any) {
+	if data == nil {
+		data = map[string]any{}
+	}
+	b, _ := json.Marshal(data)
+	if _, err := app.DB.Exec(r.Context(), `
+		INSERT INTO security_events (user_id, kind, ip, user_agent, data)
+		VALUES ($1,$2,NULLIF($3,''),NULLIF($4,''),$5::jsonb)
+	`, userID, kind, clientIP(r), r.UserAgent(), string(b)); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", userID).Str("kind", kind).Msg("record security event failed")
+	}
+}
+
+type activityDTO struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"` // security or money
+	Kind        string          `json:"kind"`
+	AmountDelta *int64          `json:"amountDelta,omitempty"` // money only; +credit / -debit, kobo
+	Currency    *string         `json:"currency,omitempty"`
+	IP          *string         `json:"ip,omitempty"`
+	UserAgent   *string         `json:"userAgent,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	CreatedAt   string          `json:"createdAt"` // RFC 3339 in the user's time zone
+
+	at time.Time
+}
+
+// GET /v1/users/me/activity?type=&kind=&from=&to=&limit=&cursor=
+// type is security or money; kind accepts a comma-separated list.
+func (app *App) ListMyActivity(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	q := r.URL.Query()
+
+	var typ *string
+	if v := strings.TrimSpace(q.Get("type")); v != "" {
+		if v != "security" && v != "money" {
+			apierror.Write(w, apierror.InvalidField("type"))
+			return
+		}
+		typ = &v
+	}
+	var kinds []string
+	if v := strings.TrimSpace(q.Get("kind")); v != "" {
+		kinds = strings.Split(v, ",")
+	}
+	var bounds [2]*time.Time
+	for i, name := range []string{"from", "to"} {
+		if v := strings.TrimSpace(q.Get(name)); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				apierror.Write(w, apierror.InvalidField(name))
+				return
+			}
+			bounds[i] = &t
+		}
+	}
+
+	pg, ok := app.parsePage(w, r, "users.activity", pagination.Standard)
+	if !ok {
+		return
+	}
+	afterAt, afterID := pg.AfterArgs()
+
+	walletID, err := app.walletIDForUser(r.Context(), uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "wallet_not_found"))
+		return
+	}
+
+	rows, err := app.Reads.Read().Query(r.Context(), `
+		SELECT id, type, kind, amount, currency, ip, user_agent, data, created_at
+		FROM (
+		  SELECT e.id, 'security' AS type, e.kind, NULL::bigint AS amount, NULL::text AS currency,
+		         e.ip, e.user_agent, e.data, e.created_at
+		  FROM security_events e
+		  WHERE e.user_id = $1
+		  UNION ALL
+		  SELECT t.id, 'money', t.kind,
+		         SUM(CASE WHEN le.direction='credit' THEN le.amount ELSE -le.amount END)::bigint,
+		         t.currency, NULL, NULL, NULL, t.created_at
+		  FROM transactions t
+		  JOIN ledger_entries le ON le.tx_id = t.id
+		  WHERE le.wallet_id = $2
+		  GROUP BY t.id
+		) a
+		WHERE ($3::text IS NULL OR type = $3)
+		  AND ($4::text[] IS NULL OR kind = ANY($4))
+		  AND ($5::timestamptz IS NULL OR created_at >= $5)
+		  AND ($6::timestamptz IS NULL OR created_at < $6)
+		  AND ($7::timestamptz IS NULL OR (created_at, id) < ($7, $8::uuid))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $9
+	`, uid, walletID, typ, kinds, bounds[0], bounds[1], afterAt, afterID, pg.Limit+1)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("list activity failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	loc := app.userLocation(r.Context(), uid)
+	out := []activityDTO{}
+	for rows.Next() {
+		var d activityDTO
+		var data []byte
+		if err := rows.Scan(&d.ID, &d.Type, &d.Kind, &d.AmountDelta, &d.Currency, &d.IP, &d.UserAgent, &data, &d.at); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		if len(data) > 0 && string(data) != "{}" {
+			d.Data = data
+		}
+		d.CreatedAt = d.at.In(loc).Format(time.RFC3339)
+		out = append(out, d)
+	}
+	if rows.Err() != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "rows_error"))
+		return
+	}
+	out, paging := pagination.Trim(pg, out, func(d activityDTO) pagination.Key { return pagination.Key{Time: d.at, ID: d.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+)
+
+// ---------- Types ----------
+
+type proposeAdjustmentReq struct {
+	UserID    string `json:"userId" validate:"required,uuid"`
+	Direction string `json:"direction" validate:"required,oneof=credit debit"` // from the user's point of view
+	Amount    int64  `json:"amount" validate:"kobo"`
+	Reason    string `json:"reason" validate:"required,max=500"`
+}
+
+type adjustmentDTO struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"userId"`
+	Direction  string     `json:"direction"`
+	Amount     int64      `json:"amount"`
+	Currency   string     `json:"currency"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	ProposedBy string     `json:"proposedBy"`
+	ReviewedBy *string    `json:"reviewedBy,omitempty"`
+	ReviewNote *string    `json:"reviewNote,omitempty"`
+	ReviewedAt *time.Time `json:"reviewedAt,omitempty"`
+	TxID       *string    `json:"txId,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// ---------- Handlers (Admin) ----------
+
+// POST /v1/admin/adjustments
+func (app *App) AdminProposeAdjustment(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+
+	var body proposeAdjustmentReq
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if body.Reason == "" {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "reason_required"))
+		return
+	}
+
+	if _, err := app.walletIDForUser(r.Context(), body.UserID); err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "target_wallet_not_found"))
+		return
+	}
+
+	var d adjustmentDTO
+	if err := app.DB.QueryRow(r.Context(), `
+		INSERT INTO ledger_adjustments (user_id, direction, amount, reason, proposed_by)
+		VALUES ($1,$2,$3,$4,$5)
+		RETURNING id, user_id, direction, amount, currency, reason, status, proposed_by, created_at
+	`, body.UserID, body.Direction, body.Amount, body.Reason, uid).
+		Scan(&d.ID, &d.UserID, &d.Direction, &d.Amount, &d.Currency, &d.Reason, &d.Status, &d.ProposedBy, &d.CreatedAt); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("admin_id", uid).Msg("insert adjustment failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "adjustment.propose",
+		TargetType: "user",
+		TargetID:   body.UserID,
+		After:      d,
+	})
+
+	writeJSON(w, http.StatusCreated, map[string]any{"data": d})
+}
+
+// GET /v1/admin/adjustments?status=proposed&limit=&cursor=
+func (app *App) AdminListAdjustments(w http.ResponseWriter, r *http.Request) {
+	pg, ok := app.parsePage(w, r, "admin.adjustments", pagination.Admin)
+	if !ok {
+		return
+	}
+	afterAt, afterID := pg.AfterArgs()
+	status := strings.TrimSpace(r.URL.Query().Get("status"))
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT id, user_id, direction, amount, currency, reason, status, proposed_by,
+		       reviewed_by, review_note, reviewed_at, tx_id, created_at
+		FROM ledger_adjustments
+		WHERE ($1 = '' OR status = $1)
+		  AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3::uuid))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, status, afterAt, afterID, pg.Limit+1)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	out := []adjustmentDTO{}
+	for rows.Next() {
+		var d adjustmentDTO
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Direction, &d.Amount, &d.Currency, &d.Reason, &d.Status, &d.ProposedBy,
+			&d.ReviewedBy, &d.ReviewNote, &d.ReviewedAt, &d.TxID, &d.CreatedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, d)
+	}
+	out, paging := pagination.Trim(pg, out, func(d adjustmentDTO) pagination.Key { return pagination.Key{Time: d.CreatedAt, ID: d.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
+
+// POST /v1/admin/adjustments/{id}/approve
+// Posts the correction to the ledger. The approver must not be the proposer.
+func (app *App) AdminApproveAdjustment(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	if id == "" {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "missing_id"))
+		return
+	}
+	var body struct {
+		Note string `json:"note,omitempty"`
+	}
+	if !decodeOptionalBody(w, r, &body) {
+		return
+	}
+
+	ctx := r.Context()
+	_, systemWid, err := app.systemUserAndWallet(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "system_wallet_missing"))
+		return
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userID, direction, status, proposedBy string
+		amount                                int64
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT user_id, direction, amount, status, proposed_by
+		FROM ledger_adjustments WHERE id=$1 FOR UPDATE
+	`, id).Scan(&userID, &direction, &amount, &status, &proposedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "adjustment_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if status != "proposed" {
+		apierror.Write(w, apierror.New(http.StatusConflict, "adjustment_already_reviewed"))
+		return
+	}
+	if proposedBy == uid {
+		apierror.Write(w, apierror.New(http.StatusForbidden, "maker_cannot_approve"))
+		return
+	}
+
+	var userWid string
+	if err := tx.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id=$1`, userID).Scan(&userWid); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "wallet_not_found"))
+		return
+	}
+
+	if err := app.lockWallets(ctx, tx, systemWid, userWid); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "lock_wallets_error"))
+		return
+	}
+
+	from, to := systemWid, userWid
+	if direction == "debit" {
+		from, to = userWid, systemWid
+		balance, err := balanceOf(ctx, tx, userWid)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		if balance < amount {
+			apierror.Write(w, apierror.New(http.StatusBadRequest, "insufficient_funds"))
+			return
+		}
+	}
+
+	var txID string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+		VALUES ($1,'adjustment',$2,'NGN', jsonb_build_object('adjustmentId', $3::text))
+		RETURNING id
+	`, "adjustment:"+id, amount, id).Scan(&txID); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_tx_error"))
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+		VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+	`, txID, from, amount, to); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_ledger_error"))
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE ledger_adjustments
+		SET status='approved', reviewed_by=$2, review_note=NULLIF($3,''), reviewed_at=now(), tx_id=$4
+		WHERE id=$1
+	`, id, uid, strings.TrimSpace(body.Note), txID); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "update_adjustment_error"))
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "adjustment.approve",
+		TargetType: "user",
+		TargetID:   userID,
+		Before:     map[string]any{"adjustmentId": id, "status": status},
+		After:      map[string]any{"adjustmentId": id, "status": "approved", "txId": txID, "direction": direction, "amount": amount},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"adjustmentId": id, "status": "approved", "txId": txID}})
+}
+
+// POST /v1/admin/adjustments/{id}/reject
+func (app *App) AdminRejectAdjustment(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	if id == "" {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "missing_id"))
+		return
+	}
+	var body struct {
+		Note string `json:"note,omitempty"`
+	}
+	if !decodeOptionalBody(w, r, &body) {
+		return
+	}
+
+	var userID string
+	err := app.DB.QueryRow(r.Context(), `
+		UPDATE ledger_adjustments
+		SET status='rejected', reviewed_by=$2, review_note=NULLIF($3,''), reviewed_at=now()
+		WHERE id=$1 AND status='proposed' AND proposed_by <> $2
+		RETURNING user_id
+	`, id, uid, strings.TrimSpace(body.Note)).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusConflict, "adjustment_not_reviewable"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "adjustment.reject",
+		TargetType: "user",
+		TargetID:   userID,
+		Before:     map[string]any{"adjustmentId": id, "status": "proposed"},
+		After:      map[string]any{"adjustmentId": id, "status": "rejected", "note": body.Note},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"adjustmentId": id, "status": "rejected"}})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// Insider-threat controls for sensitive admin actions: a per-admin, per-action
+// rate limit in Redis, and alerts when those actions happen off-hours.
+
+var lagos = time.FixedZone("WAT", 60*60) // Nigeria has no DST
+
+// inOffHours reports whether hour falls in [start, end), wrapping past midnight.
+func inOffHours(hour, start, end int) bool {
+	switch {
+	case start == end:
+		return false
+	case start < end:
+		return hour >= start && hour < end
+	default:
+		return hour >= start || hour < end
+	}
+}
+
+// AdminActionGuard limits how often one admin may perform action and raises
+// alerts on bursts and off-hours use. Without Redis only off-hours alerting
+// applies, and it isn't deduplicated.
+func (app *App) AdminActionGuard(action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			uid, _ := getUserID(r)
+			role, _ := getUserRole(r)
+			now := time.Now().In(lagos)
+
+			start := app.Settings.Int(ctx, settings.AdminOffHoursStart)
+			end := app.Settings.Int(ctx, settings.AdminOffHoursEnd)
+			if inOffHours(now.Hour(), start, end) {
+				first := true
+				if app.Redis != nil {
+					key := fmt.Sprintf("aa:offhours:%s:%s:%s", action, uid, now.Format("2006010215"))
+					first, _ = app.Redis.SetNX(ctx, key, 1, time.Hour).Result()
+				}
+				if first {
+					app.raiseAlert(ctx, alert{
+						Name:    "admin_off_hours",
+						Message: "sensitive admin action outside business hours",
+						Fields:  map[string]any{"admin_id": uid, "role": role, "action": action, "local_time": now.Format(time.Kitchen)},
+					})
+					app.audit(r, auditEntry{
+						Action:     "admin.anomaly",
+						TargetType: "user",
+						TargetID:   uid,
+						After:      map[string]any{"kind": "off_hours", "action": action, "localTime": now.Format(time.RFC3339)},
+					})
+				}
+			}
+
+			if app.Redis == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limit := int64(app.Settings.Int(ctx, settings.AdminActionsPerMinute))
+			key := "aa:" + action + ":" + uid
+			pipe := app.Redis.TxPipeline()
+			incr := pipe.Incr(ctx, key)
+			pipe.ExpireNX(ctx, key, time.Minute)
+			if _, err := pipe.Exec(ctx); err != nil {
+				apierror.Write(w, apierror.New(http.StatusInternalServerError, "rate_limit_error"))
+				return
+			}
+			if n := incr.Val(); n > limit {
+				// alert once per window, on the first request over the limit
+				if n == limit+1 {
+					app.raiseAlert(ctx, alert{
+						Name:     "admin_action_burst",
+						Severity: "critical",
+						Message:  "admin exceeded sensitive action rate limit",
+						Fields:   map[string]any{"admin_id": uid, "role": role, "action": action, "limit_per_minute": limit},
+					})
+					app.audit(r, auditEntry{
+						Action:     "admin.anomaly",
+						TargetType: "user",
+						TargetID:   uid,
+						After:      map[string]any{"kind": "rate_limited", "action": action, "limitPerMinute": limit},
+					})
+				}
+				apierror.Write(w, apierror.New(http.StatusTooManyRequests, "admin_rate_limited"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -3,5 +3,27 @@ package main
 
 // Intentionally left blank.
 // Admin endpoints are now defined in:
-//   - apps/api/admin_topup.go          (AdminTopup)
-//   - apps/api/withdrawal_handlers.go  (AdminApproveWithdrawal, AdminRejectWithdrawal)
+//   - apps/api/admin_topup.go       (AdminTopup)
+//   - apps/api/admin_topup_bulk.go  (AdminBulkTopup)
+//   - apps/api/payout_handlers.go   (AdminApproveWithdrawal, AdminRejectWithdrawal)
+//   - apps/api/voucher_handlers.go  (AdminCreateVoucher, AdminVoucherLiability, AdminSweepVouchers)
+//   - apps/api/audit_handlers.go    (AdminListAuditLogs)
+//   - apps/api/admin_users.go       (AdminGetUser, AdminSetUserRole, AdminImpersonateUser)
+//   - apps/api/adjustment_handlers.go (AdminProposeAdjustment, AdminApproveAdjustment, ...)
+//   - apps/api/admin_metrics.go     (AdminMetrics)
+//   - apps/api/float.go             (AdminFloat)
+//   - apps/api/admin_reports.go     (AdminDailyReport)
+//   - apps/api/regulatory_reports.go (AdminListRegulatoryReports, AdminGenerateRegulatoryReport, AdminGetRegulatoryReport)
+//   - apps/api/fraud_handlers.go    (fraud cases, fraud rules, AdminUnfreezeUser)
+//   - apps/api/blacklist_handlers.go (AdminListBlacklist, AdminCreateBlacklistEntry, AdminDeleteBlacklistEntry)
+//   - apps/api/support_handlers.go  (support tickets)
+//   - apps/api/user_status.go       (AdminSetUserStatus)
+//   - apps/api/admin_transactions.go (AdminSearchTransactions)
+//   - apps/api/data_request_handlers.go (AdminCreateDataRequest, AdminListDataRequests, ...)
+//   - apps/api/settings_handlers.go (AdminListSettings, AdminUpdateSetting, AdminResetSetting)
+//   - apps/api/retention.go         (AdminListRetention, AdminRunRetention)
+//   - apps/api/jobs.go              (AdminListJobs, AdminRetryJob)
+//   - apps/api/sms.go               (AdminSMSCosts)
+//   - apps/api/breakers.go          (AdminListBreakers, AdminResetBreaker)
+//   - apps/api/chaos.go             (AdminGetChaos, AdminSetChaos, AdminClearChaos)
+//   - apps/api/admin_pii.go         (AdminGetWebhookEvent, AdminGetWebhookEventFull, AdminGetPayoutProviderResponseFull)
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+type metricsDTO struct {
+	From             time.Time `json:"from"`
+	To               time.Time `json:"to"`
+	Signups          int64     `json:"signups"`
+	ActiveUsers      int64     `json:"activeUsers"`
+	GiftCount        int64     `json:"giftCount"`
+	GiftVolume       int64     `json:"giftVolume"`
+	DepositCount     int64     `json:"depositCount"`
+	DepositVolume    int64     `json:"depositVolume"`
+	WithdrawalCount  int64     `json:"withdrawalCount"`
+	WithdrawalVolume int64     `json:"withdrawalVolume"`
+	FeeRevenue       int64     `json:"feeRevenue"`
+	Currency         string    `json:"currency"`
+}
+
+type metricsPoint struct {
+	Day        string `json:"day"`
+	Signups    int64  `json:"signups"`
+	GiftVolume int64  `json:"giftVolume"`
+	Deposits   int64  `json:"depositVolume"`
+	Withdrawn  int64  `json:"withdrawalVolume"`
+}
+
+var metricsPeriods = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
+
+// parsePeriod resolves ?period= (24h|7d|30d|90d) or explicit ?from=&to= (RFC3339)
+// into a half-open [from, to) window. Defaults to the last 7 days.
+func parsePeriod(r *http.Request) (time.Time, time.Time, bool) {
+	q := r.URL.Query()
+	to := time.Now().UTC()
+	if v := strings.TrimSpace(q.Get("to")); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+	if v := strings.TrimSpace(q.Get("from")); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || !t.Before(to) {
+			return time.Time{}, time.Time{}, false
+		}
+		return t, to, true
+	}
+	period := q.Get("period")
+	if period == "" {
+		period = "7d"
+	}
+	d, ok := metricsPeriods[period]
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return to.Add(-d), to, true
+}
+
+// GET /v1/admin/metrics?period=7d | ?from=&to=
+func (app *App) AdminMetrics(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parsePeriod(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_period"))
+		return
+	}
+	ctx := r.Context()
+	m := metricsDTO{From: from, To: to, Currency: "NGN"}
+
+	if err := app.Reads.Read().QueryRow(ctx, `
+		SELECT
+		  (SELECT COUNT(*) FROM users WHERE role='user' AND created_at >= $1 AND created_at < $2),
+		  (SELECT COUNT(DISTINCT uid) FROM (
+		      SELECT user_id AS uid FROM refresh_tokens WHERE created_at >= $1 AND created_at < $2
+		      UNION
+		      SELECT wl.user_id FROM ledger_entries le JOIN wallets wl ON wl.id = le.wallet_id
+		      WHERE le.created_at >= $1 AND le.created_at < $2
+		  ) a)
+	`, from, to).Scan(&m.Signups, &m.ActiveUsers); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("metrics user counts failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	// single pass over the transactions window (idx_tx_created_at)
+	if err := app.Reads.Read().QueryRow(ctx, `
+		SELECT
+		  COUNT(*) FILTER (WHERE kind='gift'),
+		  COALESCE(SUM(amount) FILTER (WHERE kind='gift'),0),
+		  COUNT(*) FILTER (WHERE kind IN ('topup','direct_debit')),
+		  COALESCE(SUM(amount) FILTER (WHERE kind IN ('topup','direct_debit')),0),
+		  COUNT(*) FILTER (WHERE kind='withdrawal_reserve'),
+		  COALESCE(SUM(amount) FILTER (WHERE kind='withdrawal_reserve'),0),
+		  COALESCE(SUM((metadata->>'fee')::bigint) FILTER (WHERE metadata ? 'fee'),0)
+		FROM transactions
+		WHERE created_at >= $1 AND created_at < $2
+	`, from, to).Scan(&m.GiftCount, &m.GiftVolume, &m.DepositCount, &m.DepositVolume,
+		&m.WithdrawalCount, &m.WithdrawalVolume, &m.FeeRevenue); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("metrics volumes failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	rows, err := app.Reads.Read().Query(ctx, `
+		WITH days AS (
+		  SELECT generate_series(date_trunc('day', $1::timestamptz), $2::timestamptz, interval '1 day') AS day
+		)
+		SELECT to_char(d.day AT TIME ZONE 'UTC', 'YYYY-MM-DD'),
+		       (SELECT COUNT(*) FROM users u WHERE u.role='user' AND u.created_at >= d.day AND u.created_at < d.day + interval '1 day'),
+		       COALESCE(SUM(t.amount) FILTER (WHERE t.kind='gift'),0),
+		       COALESCE(SUM(t.amount) FILTER (WHERE t.kind IN ('topup','direct_debit')),0),
+		       COALESCE(SUM(t.amount) FILTER (WHERE t.kind='withdrawal_reserve'),0)
+		FROM days d
+		LEFT JOIN transactions t ON t.created_at >= d.day AND t.created_at < d.day + interval '1 day'
+		GROUP BY d.day
+		ORDER BY d.day
+	`, from, to)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("metrics series failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	series := []metricsPoint{}
+	for rows.Next() {
+		var p metricsPoint
+		if err := rows.Scan(&p.Day, &p.Signups, &p.GiftVolume, &p.Deposits, &p.Withdrawn); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		series = append(series, p)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": m, "series": series})
+}
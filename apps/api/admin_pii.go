@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+// Stored provider payloads. The columns admins normally see are redacted
+// (pkg/redact); the full copies are only served here, to roles holding
+// pii:read, with a stated reason that goes into the audit log.
+
+type webhookEventDTO struct {
+	ID              string          `json:"id"`
+	Provider        string          `json:"provider"`
+	Event           string          `json:"event"`
+	Reference       *string         `json:"reference,omitempty"`
+	Payload         json.RawMessage `json:"payload"`
+	PayloadPurgedAt *time.Time      `json:"payloadPurgedAt,omitempty"`
+	ReceivedAt      time.Time       `json:"receivedAt"`
+	ProcessedAt     *time.Time      `json:"processedAt,omitempty"`
+}
+
+func (app *App) webhookEvent(w http.ResponseWriter, r *http.Request, column string) (webhookEventDTO, bool) {
+	var e webhookEventDTO
+	var payload []byte
+	err := app.DB.QueryRow(r.Context(), `
+		SELECT id, provider, event, reference, `+column+`, payload_purged_at, received_at, processed_at
+		FROM webhook_events WHERE id=$1
+	`, chi.URLParam(r, "id")).Scan(&e.ID, &e.Provider, &e.Event, &e.Reference, &payload, &e.PayloadPurgedAt, &e.ReceivedAt, &e.ProcessedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "webhook_event_not_found"))
+		return e, false
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("get webhook event failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return e, false
+	}
+	e.Payload = payload
+	return e, true
+}
+
+// GET /v1/admin/webhook-events/{id}
+func (app *App) AdminGetWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	if e, ok := app.webhookEvent(w, r, "payload"); ok {
+		writeJSON(w, http.StatusOK, map[string]any{"data": e})
+	}
+}
+
+// piiReason reads the mandatory ?reason= for a full-payload read.
+func piiReason(w http.ResponseWriter, r *http.Request) (string, bool) {
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "reason_required"))
+		return "", false
+	}
+	return reason, true
+}
+
+// GET /v1/admin/webhook-events/{id}/full?reason=...
+func (app *App) AdminGetWebhookEventFull(w http.ResponseWriter, r *http.Request) {
+	reason, ok := piiReason(w, r)
+	if !ok {
+		return
+	}
+	e, ok := app.webhookEvent(w, r, "payload_full")
+	if !ok {
+		return
+	}
+	app.audit(r, auditEntry{
+		Action:     "pii.read",
+		TargetType: "webhook_event",
+		TargetID:   e.ID,
+		After:      map[string]any{"reason": reason},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": e})
+}
+
+// GET /v1/admin/payouts/{id}/provider-response/full?reason=...
+func (app *App) AdminGetPayoutProviderResponseFull(w http.ResponseWriter, r *http.Request) {
+	reason, ok := piiReason(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	var resp []byte
+	err := app.DB.QueryRow(r.Context(), `SELECT provider_response_full FROM payouts WHERE id=$1`, id).Scan(&resp)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "payout_not_found"))
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("payout_id", id).Msg("get provider response failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.audit(r, auditEntry{
+		Action:     "pii.read",
+		TargetType: "payout",
+		TargetID:   id,
+		After:      map[string]any{"reason": reason},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"payoutId":         id,
+		"providerResponse": json.RawMessage(resp),
+	}})
+}
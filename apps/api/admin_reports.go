@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+type kindTotal struct {
+	Kind   string `json:"kind"`
+	Count  int64  `json:"count"`
+	Amount int64  `json:"amount"`
+}
+
+type dailyReport struct {
+	Date               string      `json:"date"`
+	Currency           string      `json:"currency"`
+	Totals             []kindTotal `json:"totals"`
+	OpeningFloat       int64       `json:"openingFloat"`
+	ClosingFloat       int64       `json:"closingFloat"`
+	FeesCollected      int64       `json:"feesCollected"`
+	UserLiabilities    int64       `json:"userLiabilities"`    // sum of user wallet balances at close
+	PendingWithdrawals int64       `json:"pendingWithdrawals"` // reserved, not yet paid out, at close
+	OutstandingVoucher int64       `json:"outstandingVouchers"`
+}
+
+// buildDailyReport computes the finance summary for the UTC day starting at day.
+// A payout counts as pending at close unless it had settled by then: a
+// settled payout's status is final, so its updated_at is when it settled.
+func (app *App) buildDailyReport(ctx context.Context, day time.Time) (dailyReport, error) {
+	start := day
+	end := day.Add(24 * time.Hour)
+	rep := dailyReport{Date: day.Format("2006-01-02"), Currency: "NGN", Totals: []kindTotal{}}
+
+	platform, err := app.platformWallets(ctx)
+	if err != nil {
+		return rep, err
+	}
+	_, system, err := app.systemWallets(ctx)
+	if err != nil {
+		return rep, err
+	}
+
+	rows, err := app.Reads.Read().Query(ctx, `
+		SELECT kind, COUNT(*), COALESCE(SUM(amount),0)
+		FROM transactions
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY kind
+		ORDER BY kind
+	`, start, end)
+	if err != nil {
+		return rep, err
+	}
+	for rows.Next() {
+		var k kindTotal
+		if err := rows.Scan(&k.Kind, &k.Count, &k.Amount); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		rep.Totals = append(rep.Totals, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+
+	if err := app.Reads.Read().QueryRow(ctx, `
+		SELECT
+		  COALESCE(SUM(CASE WHEN direction='credit' THEN amount ELSE -amount END) FILTER (WHERE created_at < $2),0),
+		  COALESCE(SUM(CASE WHEN direction='credit' THEN amount ELSE -amount END) FILTER (WHERE created_at < $3),0)
+		FROM ledger_entries
+		WHERE wallet_id = ANY($1)
+	`, system, start, end).Scan(&rep.OpeningFloat, &rep.ClosingFloat); err != nil {
+		return rep, err
+	}
+
+	if err := app.Reads.Read().QueryRow(ctx, `
+		SELECT
+		  COALESCE((SELECT SUM((metadata->>'fee')::bigint) FROM transactions
+		            WHERE metadata ? 'fee' AND created_at >= $2 AND created_at < $3),0),
+		  COALESCE((SELECT SUM(CASE WHEN direction='credit' THEN amount ELSE -amount END) FROM ledger_entries
+		            WHERE wallet_id <> ALL($1) AND created_at < $3),0),
+		  COALESCE((SELECT SUM(amount) FROM payouts
+		            WHERE created_at < $3 AND (status IN ('pending','approved','processing') OR updated_at >= $3)),0),
+		  COALESCE((SELECT SUM(remaining) FROM vouchers
+		            WHERE status='active' AND created_at < $3),0)
+	`, platform, start, end).Scan(&rep.FeesCollected, &rep.UserLiabilities, &rep.PendingWithdrawals, &rep.OutstandingVoucher); err != nil {
+		return rep, err
+	}
+	return rep, nil
+}
+
+// GET /v1/admin/reports/daily?date=YYYY-MM-DD[&format=csv]
+func (app *App) AdminDailyReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1) // yesterday
+	if v := strings.TrimSpace(q.Get("date")); v != "" {
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_date"))
+			return
+		}
+		day = d
+	}
+
+	rep, err := app.buildDailyReport(r.Context(), day)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("date", day.Format("2006-01-02")).Msg("daily report failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	if q.Get("format") != "csv" {
+		writeJSON(w, http.StatusOK, map[string]any{"data": rep})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="okies-daily-`+rep.Date+`.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	i := func(n int64) string { return strconv.FormatInt(n, 10) }
+	_ = cw.Write([]string{"section", "metric", "count", "amount_kobo"})
+	for _, t := range rep.Totals {
+		_ = cw.Write([]string{"transactions", t.Kind, i(t.Count), i(t.Amount)})
+	}
+	_ = cw.Write([]string{"float", "opening", "", i(rep.OpeningFloat)})
+	_ = cw.Write([]string{"float", "closing", "", i(rep.ClosingFloat)})
+	_ = cw.Write([]string{"revenue", "fees", "", i(rep.FeesCollected)})
+	_ = cw.Write([]string{"liabilities", "user_balances", "", i(rep.UserLiabilities)})
+	_ = cw.Write([]string{"liabilities", "pending_withdrawals", "", i(rep.PendingWithdrawals)})
+	_ = cw.Write([]string{"liabilities", "outstanding_vouchers", "", i(rep.OutstandingVoucher)})
+	cw.Flush()
+}
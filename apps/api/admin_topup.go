@@ -1,46 +1,42 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"net/http"
-	"sort"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
 )
 
 type adminTopupReq struct {
-	UserID string `json:"userId"`
-	Amount int64  `json:"amount"`
-	Reason string `json:"reason,omitempty"`
+	UserID string `json:"userId" validate:"required,uuid"`
+	Amount int64  `json:"amount" validate:"kobo"`
+	Reason string `json:"reason,omitempty" validate:"max=500"`
 }
 
 func (app *App) AdminTopup(w http.ResponseWriter, r *http.Request) {
 	_, ok := getUserID(r)
 	if !ok {
-		httpError(w, http.StatusUnauthorized, "not_authenticated")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
 		return
 	}
 
 	var body adminTopupReq
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.UserID) == "" || body.Amount <= 0 {
-		httpError(w, http.StatusBadRequest, "invalid_request")
+	if !decodeBody(w, r, &body) {
 		return
 	}
 
-	var systemUserID, systemWalletID, userWalletID string
-	if err := app.DB.QueryRow(r.Context(), `SELECT id FROM users WHERE email='system@okies.local'`).Scan(&systemUserID); err != nil {
-		httpError(w, http.StatusInternalServerError, "system_user_missing")
-		return
-	}
-	if err := app.DB.QueryRow(r.Context(), `SELECT id FROM wallets WHERE user_id=$1`, body.UserID).Scan(&userWalletID); err != nil {
-		httpError(w, http.StatusBadRequest, "target_wallet_not_found")
+	userWalletID, err := app.walletIDForUser(r.Context(), body.UserID)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "target_wallet_not_found"))
 		return
 	}
-	if err := app.DB.QueryRow(r.Context(), `SELECT id FROM wallets WHERE user_id=$1`, systemUserID).Scan(&systemWalletID); err != nil {
-		httpError(w, http.StatusInternalServerError, "system_wallet_missing")
+	_, systemWalletID, err := app.systemUserAndWallet(r.Context())
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "system_wallet_missing"))
 		return
 	}
 
@@ -51,15 +47,13 @@ func (app *App) AdminTopup(w http.ResponseWriter, r *http.Request) {
 
 	tx, err := app.DB.Begin(r.Context())
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "tx_begin_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
 		return
 	}
 	defer tx.Rollback(r.Context())
 
-	wids := []string{systemWalletID, userWalletID}
-	sort.Strings(wids)
-	if _, err := tx.Exec(r.Context(), `SELECT id FROM wallets WHERE id = ANY($1) FOR UPDATE`, wids); err != nil {
-		httpError(w, http.StatusInternalServerError, "lock_wallets_error")
+	if err := app.lockWallets(r.Context(), tx, systemWalletID, userWalletID); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "lock_wallets_error"))
 		return
 	}
 
@@ -70,7 +64,7 @@ func (app *App) AdminTopup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		httpError(w, http.StatusInternalServerError, "db_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
 
@@ -80,7 +74,7 @@ func (app *App) AdminTopup(w http.ResponseWriter, r *http.Request) {
 		VALUES ($1,'topup',$2,'NGN','{}'::jsonb)
 		RETURNING id
 	`, idem, body.Amount).Scan(&txID); err != nil {
-		httpError(w, http.StatusInternalServerError, "insert_tx_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_tx_error"))
 		return
 	}
 
@@ -88,14 +82,26 @@ func (app *App) AdminTopup(w http.ResponseWriter, r *http.Request) {
 		INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
 		VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
 	`, txID, systemWalletID, body.Amount, userWalletID); err != nil {
-		httpError(w, http.StatusInternalServerError, "insert_ledger_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_ledger_error"))
 		return
 	}
 
 	if err := tx.Commit(r.Context()); err != nil {
-		httpError(w, http.StatusInternalServerError, "tx_commit_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
 		return
 	}
 
+	app.audit(r, auditEntry{
+		Action:     "topup.create",
+		TargetType: "user",
+		TargetID:   body.UserID,
+		After:      map[string]any{"txId": txID, "amount": body.Amount, "reason": body.Reason, "idempotencyKey": idem},
+	})
+
+	app.Events.Publish(r.Context(), evDepositSettled, depositSettled{
+		TxID: txID, UserID: body.UserID, Amount: body.Amount, Source: "admin_topup",
+		IP: clientIP(r), UserAgent: r.UserAgent(),
+	})
+
 	writeJSON(w, http.StatusCreated, map[string]any{"data": map[string]any{"topupId": txID, "status": "succeeded"}})
 }
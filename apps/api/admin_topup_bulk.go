@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// Bulk top-ups credit many users from one CSV upload (promo credit drops).
+// Every row is validated before any money moves; rows then post in batches,
+// each row under its own idempotency key derived from the batch key and row
+// number, so re-uploading the same file with the same Idempotency-Key is safe.
+
+const bulkTopupBatchSize = 100
+
+type bulkTopupRow struct {
+	Row    int    `json:"row"` // 1-based data row, header excluded
+	User   string `json:"user"`
+	Amount int64  `json:"amount"`
+	Reason string `json:"reason"`
+	UserID string `json:"userId,omitempty"`
+	Status string `json:"status"` // invalid | succeeded | duplicate | failed
+	TxID   string `json:"txId,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	walletID string
+}
+
+// parseBulkTopupCSV reads (user, amount, reason) rows. A header row is
+// skipped when its amount column isn't numeric.
+func parseBulkTopupCSV(rd io.Reader, maxRows int) ([]*bulkTopupRow, error) {
+	cr := csv.NewReader(rd)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var rows []*bulkTopupRow
+	for line := 0; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 0 && len(rec) >= 2 {
+			if _, err := strconv.ParseInt(strings.TrimSpace(rec[1]), 10, 64); err != nil {
+				continue
+			}
+		}
+		row := &bulkTopupRow{Row: len(rows) + 1, Status: "pending"}
+		rows = append(rows, row)
+		if len(rows) > maxRows {
+			return nil, errBulkTooLarge
+		}
+		if len(rec) < 2 {
+			row.Status, row.Error = "invalid", "missing_columns"
+			continue
+		}
+		row.User = strings.TrimSpace(rec[0])
+		if len(rec) > 2 {
+			row.Reason = strings.TrimSpace(rec[2])
+		}
+		amt, err := strconv.ParseInt(strings.TrimSpace(rec[1]), 10, 64)
+		switch {
+		case row.User == "":
+			row.Status, row.Error = "invalid", "missing_user"
+		case err != nil || amt <= 0:
+			row.Status, row.Error = "invalid", "invalid_amount"
+		}
+		row.Amount = amt
+	}
+	return rows, nil
+}
+
+var errBulkTooLarge = errors.New("too many rows")
+
+// resolveBulkTopupUsers maps each row's identifier (user id, email or
+// username) to a user and wallet, marking unknown users invalid.
+func (app *App) resolveBulkTopupUsers(ctx context.Context, rows []*bulkTopupRow) error {
+	idents := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.Status == "pending" {
+			idents = append(idents, strings.ToLower(row.User))
+		}
+	}
+	type match struct{ userID, walletID string }
+	found := map[string]match{}
+	dbRows, err := app.DB.Query(ctx, `
+		SELECT lower(k.ident), u.id, w.id
+		FROM unnest($1::text[]) AS k(ident)
+		JOIN users u ON u.id::text = k.ident OR lower(u.email) = k.ident OR lower(u.username) = k.ident
+		JOIN wallets w ON w.user_id = u.id
+		WHERE u.email NOT IN ('system@okies.local', 'migration@okies.local')
+	`, idents)
+	if err != nil {
+		return err
+	}
+	defer dbRows.Close()
+	for dbRows.Next() {
+		var ident string
+		var m match
+		if err := dbRows.Scan(&ident, &m.userID, &m.walletID); err != nil {
+			return err
+		}
+		found[ident] = m
+	}
+	if err := dbRows.Err(); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if row.Status != "pending" {
+			continue
+		}
+		m, ok := found[strings.ToLower(row.User)]
+		if !ok {
+			row.Status, row.Error = "invalid", "user_not_found"
+			continue
+		}
+		row.UserID, row.walletID = m.userID, m.walletID
+	}
+	return nil
+}
+
+// postBulkTopupBatch posts one batch in a single DB transaction. Rows whose
+// idempotency key already exists are reported as duplicates.
+func (app *App) postBulkTopupBatch(ctx context.Context, batchKey, systemWid string, rows []*bulkTopupRow) error {
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	wids := []string{systemWid}
+	for _, row := range rows {
+		wids = append(wids, row.walletID)
+	}
+	if err := app.lockWallets(ctx, tx, wids...); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		idem := "bulk_topup:" + batchKey + ":" + strconv.Itoa(row.Row)
+		var txID string
+		var inserted bool
+		if err := tx.QueryRow(ctx, `
+			WITH ins AS (
+				INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+				VALUES ($1,'topup',$2,'NGN', jsonb_build_object('bulkBatch', $3::text, 'reason', $4::text))
+				ON CONFLICT (idempotency_key) DO NOTHING
+				RETURNING id
+			)
+			SELECT id, true FROM ins
+			UNION ALL
+			SELECT id, false FROM transactions WHERE idempotency_key=$1
+			LIMIT 1
+		`, idem, row.Amount, batchKey, row.Reason).Scan(&txID, &inserted); err != nil {
+			return err
+		}
+		row.TxID = txID
+		if !inserted {
+			row.Status = "duplicate"
+			continue
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+			VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+		`, txID, systemWid, row.Amount, row.walletID); err != nil {
+			return err
+		}
+		row.Status = "succeeded"
+	}
+	return tx.Commit(ctx)
+}
+
+// POST /v1/admin/topups/bulk[?format=csv]
+// Body: CSV (text/csv) or multipart form field "file". Columns: user, amount (kobo), reason.
+func (app *App) AdminBulkTopup(w http.ResponseWriter, r *http.Request) {
+	maxRows := app.Settings.Int(r.Context(), settings.BulkTopupMaxRows)
+
+	src, ok := csvUpload(w, r)
+	if !ok {
+		return
+	}
+	defer src.Close()
+
+	rows, err := parseBulkTopupCSV(src, maxRows)
+	if errors.Is(err, errBulkTooLarge) {
+		apierror.Write(w, apierror.New(http.StatusRequestEntityTooLarge, "too_many_rows"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_csv"))
+		return
+	}
+	if len(rows) == 0 {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "empty_csv"))
+		return
+	}
+
+	batchKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if batchKey == "" {
+		batchKey = uuid.NewString()
+	}
+
+	if err := app.resolveBulkTopupUsers(r.Context(), rows); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("bulk topup user lookup failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	// All-or-nothing validation: nothing posts while any row is invalid
+	invalid := 0
+	for _, row := range rows {
+		if row.Status == "invalid" {
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		writeBulkTopupReport(w, r, http.StatusUnprocessableEntity, batchKey, rows)
+		return
+	}
+
+	_, systemWid, err := app.systemUserAndWallet(r.Context())
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "system_wallet_missing"))
+		return
+	}
+
+	var total int64
+	for start := 0; start < len(rows); start += bulkTopupBatchSize {
+		end := min(start+bulkTopupBatchSize, len(rows))
+		batch := rows[start:end]
+		if err := app.postBulkTopupBatch(r.Context(), batchKey, systemWid, batch); err != nil {
+			log.Ctx(r.Context()).Error().Err(err).Str("batch", batchKey).Int("from_row", batch[0].Row).Msg("bulk topup batch failed")
+			for _, row := range batch {
+				row.Status, row.Error, row.TxID = "failed", "batch_failed", ""
+			}
+			continue
+		}
+		for _, row := range batch {
+			if row.Status != "succeeded" {
+				continue
+			}
+			total += row.Amount
+			app.Events.Publish(r.Context(), evDepositSettled, depositSettled{
+				TxID: row.TxID, UserID: row.UserID, Amount: row.Amount, Source: "bulk_topup",
+				IP: clientIP(r), UserAgent: r.UserAgent(),
+			})
+		}
+	}
+
+	counts := map[string]int{}
+	for _, row := range rows {
+		counts[row.Status]++
+	}
+	app.audit(r, auditEntry{
+		Action:     "topup.bulk",
+		TargetType: "topup_batch",
+		TargetID:   batchKey,
+		After:      map[string]any{"rows": len(rows), "amount": total, "counts": counts},
+	})
+
+	writeBulkTopupReport(w, r, http.StatusOK, batchKey, rows)
+}
+
+// csvUpload returns an uploaded CSV: the body itself (text/csv), or the
+// multipart form field "file". On failure it has written the error.
+func csvUpload(w http.ResponseWriter, r *http.Request) (io.ReadCloser, bool) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return http.MaxBytesReader(w, r.Body, 5<<20), true
+	}
+	if err := r.ParseMultipartForm(5 << 20); err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_upload"))
+		return nil, false
+	}
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "missing_file"))
+		return nil, false
+	}
+	return f, true
+}
+
+func writeBulkTopupReport(w http.ResponseWriter, r *http.Request, status int, batchKey string, rows []*bulkTopupRow) {
+	if r.URL.Query().Get("format") != "csv" {
+		counts := map[string]int{}
+		for _, row := range rows {
+			counts[row.Status]++
+		}
+		writeJSON(w, status, map[string]any{"data": map[string]any{
+			"batchKey": batchKey,
+			"total":    len(rows),
+			"counts":   counts,
+			"rows":     rows,
+		}})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="okies-bulk-topup-`+batchKey+`.csv"`)
+	w.WriteHeader(status)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"row", "user", "amount_kobo", "reason", "user_id", "status", "tx_id", "error"})
+	for _, row := range rows {
+		_ = cw.Write([]string{
+			strconv.Itoa(row.Row), row.User, strconv.FormatInt(row.Amount, 10), row.Reason,
+			row.UserID, row.Status, row.TxID, row.Error,
+		})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+)
+
+type adminLegDTO struct {
+	WalletID  string  `json:"walletId"`
+	UserID    string  `json:"userId"`
+	Username  *string `json:"username,omitempty"`
+	Direction string  `json:"direction"`
+	Amount    int64   `json:"amount"`
+}
+
+type adminTxDTO struct {
+	ID             string          `json:"id"`
+	Kind           string          `json:"kind"`
+	Amount         int64           `json:"amount"`
+	Currency       string          `json:"currency"`
+	IdempotencyKey string          `json:"idempotencyKey"`
+	Metadata       json.RawMessage `json:"metadata"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	Legs           []adminLegDTO   `json:"legs"`
+}
+
+// GET /v1/admin/transactions?kind=&minAmount=&maxAmount=&userId=&reference=&idempotencyKey=&from=&to=&limit=&cursor=
+// kind accepts a comma-separated list. reference matches payout references
+// (and the refund legs derived from them) as well as metadata.reference.
+func (app *App) AdminSearchTransactions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if v := strings.TrimSpace(q.Get("kind")); v != "" {
+		add("t.kind = ANY($%d)", strings.Split(v, ","))
+	}
+	for _, p := range []struct{ name, cond string }{{"minAmount", "t.amount >= $%d"}, {"maxAmount", "t.amount <= $%d"}} {
+		if v := strings.TrimSpace(q.Get(p.name)); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				apierror.Write(w, apierror.InvalidField(p.name))
+				return
+			}
+			add(p.cond, n)
+		}
+	}
+	if v := strings.TrimSpace(q.Get("userId")); v != "" {
+		add(`EXISTS (SELECT 1 FROM ledger_entries le JOIN wallets wl ON wl.id = le.wallet_id
+		             WHERE le.tx_id = t.id AND wl.user_id = $%d)`, v)
+	}
+	if v := strings.TrimSpace(q.Get("reference")); v != "" {
+		args = append(args, v)
+		n := len(args)
+		where = append(where, fmt.Sprintf(
+			"(t.idempotency_key = $%[1]d OR t.idempotency_key LIKE $%[1]d || ':%%' OR t.metadata->>'reference' = $%[1]d)", n))
+	}
+	if v := strings.TrimSpace(q.Get("idempotencyKey")); v != "" {
+		add("t.idempotency_key = $%d", v)
+	}
+	for _, p := range []struct{ name, cond string }{{"from", "t.created_at >= $%d"}, {"to", "t.created_at < $%d"}} {
+		if v := strings.TrimSpace(q.Get(p.name)); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				apierror.Write(w, apierror.InvalidField(p.name))
+				return
+			}
+			add(p.cond, t)
+		}
+	}
+
+	pg, ok := app.parsePage(w, r, "admin.transactions", pagination.Admin)
+	if !ok {
+		return
+	}
+	if pg.After != nil {
+		args = append(args, pg.After.Time, pg.After.ID)
+		where = append(where, fmt.Sprintf("(t.created_at, t.id) < ($%d, $%d::uuid)", len(args)-1, len(args)))
+	}
+
+	sql := `
+		SELECT t.id, t.kind, t.amount, t.currency, t.idempotency_key, t.metadata, t.created_at
+		FROM transactions t`
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, pg.Limit+1)
+	sql += fmt.Sprintf(" ORDER BY t.created_at DESC, t.id DESC LIMIT $%d", len(args))
+
+	rows, err := app.Reads.Read().Query(r.Context(), sql, args...)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("search transactions failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	out := []*adminTxDTO{}
+	for rows.Next() {
+		d := &adminTxDTO{Legs: []adminLegDTO{}}
+		var meta []byte
+		if err := rows.Scan(&d.ID, &d.Kind, &d.Amount, &d.Currency, &d.IdempotencyKey, &meta, &d.CreatedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		d.Metadata = meta
+		out = append(out, d)
+	}
+	if rows.Err() != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "rows_error"))
+		return
+	}
+	out, paging := pagination.Trim(pg, out, func(d *adminTxDTO) pagination.Key { return pagination.Key{Time: d.CreatedAt, ID: d.ID} })
+	byID := map[string]*adminTxDTO{}
+	ids := make([]string, len(out))
+	for i, d := range out {
+		byID[d.ID] = d
+		ids[i] = d.ID
+	}
+
+	if len(ids) > 0 {
+		legs, err := app.Reads.Read().Query(r.Context(), `
+			SELECT le.tx_id, le.wallet_id, wl.user_id, u.username, le.direction, le.amount
+			FROM ledger_entries le
+			JOIN wallets wl ON wl.id = le.wallet_id
+			JOIN users u ON u.id = wl.user_id
+			WHERE le.tx_id = ANY($1)
+			ORDER BY le.direction DESC
+		`, ids)
+		if err != nil {
+			log.Ctx(r.Context()).Error().Err(err).Msg("load transaction legs failed")
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		defer legs.Close()
+		for legs.Next() {
+			var txID string
+			var l adminLegDTO
+			if err := legs.Scan(&txID, &l.WalletID, &l.UserID, &l.Username, &l.Direction, &l.Amount); err != nil {
+				apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+				return
+			}
+			byID[txID].Legs = append(byID[txID].Legs, l)
+		}
+		if legs.Err() != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "rows_error"))
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
+)
+
+type adminUserDTO struct {
+	UserDTO
+	Role    string `json:"role"`
+	Balance int64  `json:"balance"` // kobo
+}
+
+type adminUserListDTO struct {
+	UserDTO
+	Role          string     `json:"role"`
+	Status        string     `json:"status"`
+	FrozenAt      *time.Time `json:"frozenAt,omitempty"`
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
+	AnonymizedAt  *time.Time `json:"anonymizedAt,omitempty"`
+}
+
+// GET /v1/admin/users?query=&role=&status=&frozen=&deactivated=&from=&to=&sort=&limit=&cursor=
+// query matches the start of an email address or username, or a phone
+// number in full. role and status accept comma-separated lists. sort is
+// -createdAt (newest first, the default) or createdAt.
+func (app *App) AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if v := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(q.Get("query")), "@")); v != "" {
+		if p, ok := validate.Phone(v); ok {
+			add("u.phone = $%d", p)
+		} else {
+			args = append(args, likeEscaper.Replace(v)+"%")
+			n := len(args)
+			where = append(where, fmt.Sprintf(`(u.email LIKE $%[1]d ESCAPE '\' OR lower(u.username) LIKE $%[1]d ESCAPE '\')`, n))
+		}
+	}
+	if v := strings.TrimSpace(q.Get("role")); v != "" {
+		roles := strings.Split(v, ",")
+		for _, role := range roles {
+			if !a.IsValidRole(role) {
+				apierror.Write(w, apierror.InvalidField("role"))
+				return
+			}
+		}
+		add("u.role = ANY($%d)", roles)
+	}
+	if v := strings.TrimSpace(q.Get("status")); v != "" {
+		statuses := strings.Split(v, ",")
+		for _, s := range statuses {
+			if s != "active" && s != "suspended" && s != "banned" {
+				apierror.Write(w, apierror.InvalidField("status"))
+				return
+			}
+		}
+		add("u.status = ANY($%d)", statuses)
+	}
+	for _, p := range []struct{ name, col string }{{"frozen", "u.frozen_at"}, {"deactivated", "u.deactivated_at"}} {
+		if v := strings.TrimSpace(q.Get(p.name)); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				apierror.Write(w, apierror.InvalidField(p.name))
+				return
+			}
+			if b {
+				where = append(where, p.col+" IS NOT NULL")
+			} else {
+				where = append(where, p.col+" IS NULL")
+			}
+		}
+	}
+	for _, p := range []struct{ name, cond string }{{"from", "u.created_at >= $%d"}, {"to", "u.created_at < $%d"}} {
+		if v := strings.TrimSpace(q.Get(p.name)); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				apierror.Write(w, apierror.InvalidField(p.name))
+				return
+			}
+			add(p.cond, t)
+		}
+	}
+	cmp, order := "<", "DESC"
+	switch q.Get("sort") {
+	case "", "-createdAt":
+	case "createdAt":
+		cmp, order = ">", "ASC"
+	default:
+		apierror.Write(w, apierror.InvalidField("sort"))
+		return
+	}
+
+	// a cursor is only good for the direction it was made in
+	pg, ok := app.parsePage(w, r, "admin.users:"+order, pagination.Admin)
+	if !ok {
+		return
+	}
+	if pg.After != nil {
+		args = append(args, pg.After.Time, pg.After.ID)
+		where = append(where, fmt.Sprintf("(u.created_at, u.id) %s ($%d, $%d::uuid)", cmp, len(args)-1, len(args)))
+	}
+
+	sql := `
+		SELECT u.id, u.email, u.username, u.display_name, u.avatar_url, u.phone, u.created_at,
+		       u.role, u.status, u.frozen_at, u.deactivated_at, u.anonymized_at
+		FROM users u`
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, pg.Limit+1)
+	sql += fmt.Sprintf(" ORDER BY u.created_at %[1]s, u.id %[1]s LIMIT $%[2]d", order, len(args))
+
+	rows, err := app.Reads.Read().Query(r.Context(), sql, args...)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("list users failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	out := []adminUserListDTO{}
+	for rows.Next() {
+		var u adminUserListDTO
+		if err := rows.Scan(&u.ID, &u.Email, &u.Username, &u.DisplayName, &u.AvatarURL, &u.Phone, &u.CreatedAt,
+			&u.Role, &u.Status, &u.FrozenAt, &u.DeactivatedAt, &u.AnonymizedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, u)
+	}
+	if rows.Err() != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "rows_error"))
+		return
+	}
+	out, paging := pagination.Trim(pg, out, func(u adminUserListDTO) pagination.Key { return pagination.Key{Time: u.CreatedAt, ID: u.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
+
+// GET /v1/admin/users/{id}
+func (app *App) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	if id == "" {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "missing_id"))
+		return
+	}
+
+	var u adminUserDTO
+	err := app.DB.QueryRow(r.Context(), `
+		SELECT u.id, u.email, u.username, u.display_name, u.avatar_url, u.created_at, u.role,
+		       (SELECT COALESCE(SUM(`+balanceSQL("wl.id")+`),0)::bigint FROM wallets wl WHERE wl.user_id = u.id)
+		FROM users u
+		WHERE u.id=$1
+	`, id).Scan(&u.ID, &u.Email, &u.Username, &u.DisplayName, &u.AvatarURL, &u.CreatedAt, &u.Role, &u.Balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", id).Msg("admin get user failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": u})
+}
+
+// PUT /v1/admin/users/{id}/role
+func (app *App) AdminSetUserRole(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	if id == "" {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "missing_id"))
+		return
+	}
+	var body struct {
+		Role string `json:"role" validate:"required"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if !a.IsValidRole(body.Role) {
+		apierror.Write(w, apierror.InvalidField("role"))
+		return
+	}
+	if uid, _ := getUserID(r); uid == id {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "cannot_change_own_role"))
+		return
+	}
+
+	var before string
+	err := app.DB.QueryRow(r.Context(), `
+		WITH prev AS (SELECT role FROM users WHERE id=$1 FOR UPDATE)
+		UPDATE users SET role=$2 FROM prev WHERE users.id=$1
+		RETURNING prev.role
+	`, id, body.Role).Scan(&before)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", id).Msg("update role failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(r.Context(), id)
+
+	app.audit(r, auditEntry{
+		Action:     "user.role_change",
+		TargetType: "user",
+		TargetID:   id,
+		Before:     map[string]any{"role": before},
+		After:      map[string]any{"role": body.Role},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"userId": id, "role": body.Role}})
+}
+
+// POST /v1/admin/users/{id}/impersonate  {"reason":"..."}
+// Issues a short-lived read-only access token for the user so support can see
+// exactly what they see. No refresh token is issued.
+func (app *App) AdminImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	if id == "" {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "missing_id"))
+		return
+	}
+	var body struct {
+		Reason string `json:"reason" validate:"required,max=500"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	actor, _ := getUserID(r)
+	actorRole, _ := getUserRole(r)
+	if actor == id {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "cannot_impersonate_self"))
+		return
+	}
+
+	var role string
+	err := app.DB.QueryRow(r.Context(), `SELECT role FROM users WHERE id=$1`, id).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if a.IsAdminRole(role) {
+		apierror.Write(w, apierror.New(http.StatusForbidden, "cannot_impersonate_admin"))
+		return
+	}
+
+	ttl := app.Settings.Minutes(r.Context(), settings.ImpersonationTTLMinutes)
+	token, err := a.GenerateImpersonation(app.JWT, id, a.Actor{Subject: actor, Role: actorRole}, ttl)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "user.impersonate",
+		TargetType: "user",
+		TargetID:   id,
+		After:      map[string]any{"reason": strings.TrimSpace(body.Reason), "ttlSeconds": int(ttl.Seconds())},
+	})
+
+	writeJSON(w, http.StatusCreated, map[string]any{"data": map[string]any{
+		"accessToken":  token,
+		"readOnly":     true,
+		"impersonated": id,
+		"impersonator": actor,
+		"expiresAt":    time.Now().Add(ttl),
+	}})
+}
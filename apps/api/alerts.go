@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/alerting"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+	"github.com/sudo-init-do/okies-backend/pkg/signing"
+)
+
+// alert is an operational event someone should look at. Alerts are always
+// logged with an "alert" field and also sent (best-effort) to the channels
+// the alerts.routing setting names for them: ALERT_WEBHOOK_URL as JSON,
+// Slack, or Telegram.
+type alert = alerting.Alert
+
+// newAlertChannels builds a sender per configured alert channel. The JSON
+// webhook is signed with keys.
+func newAlertChannels(cfg *config.Config, keys func() []signing.Key) alerting.Channels {
+	client := httpclient.New("alerts", httpclient.Options{Timeout: 5 * time.Second})
+	c := alerting.Channels{}
+	if cfg.AlertWebhookURL != "" {
+		c[alerting.ChannelWebhook] = &alerting.Webhook{URL: cfg.AlertWebhookURL, Client: client, Keys: keys}
+	}
+	if cfg.Alerts.SlackWebhookURL != "" {
+		c[alerting.ChannelSlack] = &alerting.Slack{WebhookURL: cfg.Alerts.SlackWebhookURL, Client: client}
+	}
+	if cfg.Alerts.TelegramToken != "" {
+		c[alerting.ChannelTelegram] = &alerting.Telegram{
+			BaseURL: cfg.Alerts.TelegramBaseURL,
+			Token:   cfg.Alerts.TelegramToken,
+			ChatID:  cfg.Alerts.TelegramChatID,
+			Client:  client,
+		}
+	}
+	return c
+}
+
+func (app *App) raiseAlert(ctx context.Context, a alert) {
+	if a.Severity == "" {
+		a.Severity = "warning"
+	}
+	a.At = time.Now().UTC()
+
+	ev := log.Ctx(ctx).Warn()
+	if a.Severity == "critical" {
+		ev = log.Ctx(ctx).Error()
+	}
+	ev.Str("alert", a.Name).Fields(a.Fields).Msg(a.Message)
+
+	if len(app.Alerts) == 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		channels := app.Settings.AlertRoutes(ctx, settings.AlertRouting).For(a.Name)
+		if err := app.Alerts.Send(ctx, channels, a); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("alert", a.Name).Msg("alert delivery failed")
+		}
+	}()
+}
+
+// alertBadWebhookSignature raises webhook_signature_failed at most once per
+// provider every ten minutes: a run of forged or misconfigured callbacks is
+// one incident. Without Redis every failure alerts.
+func (app *App) alertBadWebhookSignature(r *http.Request, provider string) {
+	ctx := r.Context()
+	if app.Redis != nil {
+		first, _ := app.Redis.SetNX(ctx, "alert:webhook_signature:"+provider, 1, 10*time.Minute).Result()
+		if !first {
+			return
+		}
+	}
+	app.raiseAlert(ctx, alert{
+		Name:     "webhook_signature_failed",
+		Severity: "critical",
+		Message:  "provider webhook failed signature verification",
+		Fields:   map[string]any{"provider": provider, "ip": clientIP(r), "path": r.URL.Path},
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
+)
+
+// GET /v1/app-config?platform=ios|android&version=2.4.0
+// Server-driven configuration for the mobile apps, from the app.config
+// setting: release information, feature flags, fees, limits and copy. With
+// version, update says whether that build must ("required") or may
+// ("available") be updated. Public, so the app can read it before sign-in,
+// and cached briefly; see Cacheable.
+func (app *App) GetAppConfig(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	platform := strings.ToLower(strings.TrimSpace(q.Get("platform")))
+	ctx := r.Context()
+
+	cfg := app.Settings.AppConfig(ctx, settings.MobileAppConfig)
+	p, ok := cfg.Platform(platform)
+	if !ok {
+		apierror.Write(w, apierror.InvalidField("platform"))
+		return
+	}
+
+	out := map[string]any{
+		"platform":   platform,
+		"minVersion": p.MinVersion,
+	}
+	if p.LatestVersion != "" {
+		out["latestVersion"] = p.LatestVersion
+	}
+	if p.StoreURL != "" {
+		out["storeUrl"] = p.StoreURL
+	}
+	if v := strings.TrimSpace(q.Get("version")); v != "" {
+		update := "none"
+		switch {
+		case settings.CompareVersions(v, p.MinVersion) < 0:
+			update = "required"
+		case p.LatestVersion != "" && settings.CompareVersions(v, p.LatestVersion) < 0:
+			update = "available"
+		}
+		out["update"] = update
+	}
+
+	// flags backed by other settings or by configuration follow them; the
+	// setting can switch direct debit off but not on without a provider
+	features := p.Features
+	features["referralRewards"] = app.Settings.Bool(ctx, settings.ReferralRewardsEnabled)
+	if on, set := features["directDebit"]; !set || on {
+		features["directDebit"] = app.OpenBanking != nil
+	}
+	out["features"] = features
+
+	fees := cfg.Fees
+	if fees == nil {
+		fees = map[string]settings.Fee{}
+	}
+	out["fees"] = fees
+	out["limits"] = map[string]any{
+		"maxAmount":           validate.MaxKobo,
+		"giftsPerMinute":      app.Settings.RateLimit(ctx, settings.RateLimitGifts).Limit,
+		"giftScheduleMaxDays": int(maxGiftSchedule.Hours() / 24),
+		"voucherMaxDays":      app.Settings.Int(ctx, settings.VoucherMaxDays),
+		"referralRewardKobo":  app.Settings.Int64(ctx, settings.ReferralRewardKobo),
+	}
+	out["copy"] = p.Copy
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+)
+
+// ---------- Types ----------
+
+// auditEntry describes one admin mutation. Before/After are marshalled to
+// JSONB as-is; pass nil when there is no meaningful prior/next state.
+type auditEntry struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     any
+	After      any
+}
+
+type auditLogDTO struct {
+	ID          string          `json:"id"`
+	ActorUserID string          `json:"actorUserId"`
+	ActorRole   string          `json:"actorRole"`
+	Action      string          `json:"action"`
+	TargetType  string          `json:"targetType"`
+	TargetID    *string         `json:"targetId,omitempty"`
+	Before      json.RawMessage `json:"before,omitempty"`
+	After       json.RawMessage `json:"after,omitempty"`
+	RequestID   *string         `json:"requestId,omitempty"`
+	IP          *string         `json:"ip,omitempty"`
+	UserAgent   *string         `json:"userAgent,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+// ---------- Helpers ----------
+
+// audit records an admin mutation performed by the authenticated caller.
+// Under impersonation the admin, not the impersonated user, is the actor.
+// Failures are logged, never surfaced: the mutation has already happened.
+func (app *App) audit(r *http.Request, e auditEntry) {
+	uid, _ := getUserID(r)
+	role, _ := getUserRole(r)
+	if act, ok := getActor(r); ok {
+		uid, role = act.Subject, act.Role
+	}
+
+	var before, after []byte
+	if e.Before != nil {
+		before, _ = json.Marshal(e.Before)
+	}
+	if e.After != nil {
+		after, _ = json.Marshal(e.After)
+	}
+	var target *string
+	if e.TargetID != "" {
+		target = &e.TargetID
+	}
+
+	if _, err := app.DB.Exec(r.Context(), `
+		INSERT INTO audit_logs (actor_user_id, actor_role, action, target_type, target_id,
+		                        before_value, after_value, request_id, ip, user_agent)
+		VALUES ($1,$2,$3,$4,$5,$6::jsonb,$7::jsonb,$8,$9,$10)
+	`, uid, role, e.Action, e.TargetType, target, nullJSON(before), nullJSON(after),
+		reqIDFromCtx(r.Context()), clientIP(r), r.UserAgent()); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).
+			Str("actor_id", uid).
+			Str("action", e.Action).
+			Str("target_id", e.TargetID).
+			Msg("write audit log failed")
+	}
+}
+
+func nullJSON(b []byte) *string {
+	if len(b) == 0 {
+		return nil
+	}
+	s := string(b)
+	return &s
+}
+
+// ---------- Handlers (Admin) ----------
+
+// GET /v1/admin/audit-logs?actorId=&action=&targetType=&targetId=&requestId=&from=&to=&limit=&cursor=
+func (app *App) AdminListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if v := strings.TrimSpace(q.Get("actorId")); v != "" {
+		add("actor_user_id = $%d", v)
+	}
+	if v := strings.TrimSpace(q.Get("action")); v != "" {
+		if strings.HasSuffix(v, "*") {
+			add("action LIKE $%d", strings.TrimSuffix(v, "*")+"%")
+		} else {
+			add("action = $%d", v)
+		}
+	}
+	if v := strings.TrimSpace(q.Get("targetType")); v != "" {
+		add("target_type = $%d", v)
+	}
+	if v := strings.TrimSpace(q.Get("targetId")); v != "" {
+		add("target_id = $%d", v)
+	}
+	if v := strings.TrimSpace(q.Get("requestId")); v != "" {
+		add("request_id = $%d", v)
+	}
+	for _, p := range []struct{ name, cond string }{{"from", "created_at >= $%d"}, {"to", "created_at < $%d"}} {
+		if v := strings.TrimSpace(q.Get(p.name)); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				apierror.Write(w, apierror.InvalidField(p.name))
+				return
+			}
+			add(p.cond, t)
+		}
+	}
+
+	pg, ok := app.parsePage(w, r, "admin.audit_logs", pagination.Admin)
+	if !ok {
+		return
+	}
+	if pg.After != nil {
+		args = append(args, pg.After.Time, pg.After.ID)
+		where = append(where, fmt.Sprintf("(created_at, id) < ($%d, $%d::uuid)", len(args)-1, len(args)))
+	}
+
+	sql := `
+		SELECT id, actor_user_id, actor_role, action, target_type, target_id,
+		       before_value, after_value, request_id, ip, user_agent, created_at
+		FROM audit_logs`
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, pg.Limit+1)
+	sql += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := app.Reads.Read().Query(r.Context(), sql, args...)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("query audit logs failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	out := []auditLogDTO{}
+	for rows.Next() {
+		var d auditLogDTO
+		var before, after []byte
+		if err := rows.Scan(&d.ID, &d.ActorUserID, &d.ActorRole, &d.Action, &d.TargetType, &d.TargetID,
+			&before, &after, &d.RequestID, &d.IP, &d.UserAgent, &d.CreatedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		d.Before, d.After = before, after
+		out = append(out, d)
+	}
+	if rows.Err() != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "rows_error"))
+		return
+	}
+
+	out, paging := pagination.Trim(pg, out, func(d auditLogDTO) pagination.Key { return pagination.Key{Time: d.CreatedAt, ID: d.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
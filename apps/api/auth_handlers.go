@@ -5,28 +5,29 @@ import (
 	"errors"
 	"net"
 	"net/http"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
 
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
 	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/moderation"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
 )
 
 type signupReq struct {
-	Email       string  `json:"email"`
-	Password    string  `json:"password"`
-	Username    *string `json:"username,omitempty"`
-	DisplayName *string `json:"displayName,omitempty"`
+	Email        string  `json:"email" validate:"required,email,max=254"`
+	Password     string  `json:"password" validate:"required,min=8,max=128"`
+	Username     *string `json:"username,omitempty" validate:"omitempty,username"`
+	DisplayName  *string `json:"displayName,omitempty" validate:"omitempty,max=60"`
+	ReferralCode string  `json:"referralCode,omitempty" validate:"omitempty,max=32"`
 }
 type loginReq struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 type authResp struct {
 	Tokens a.TokenPair `json:"tokens"`
@@ -35,53 +36,118 @@ type authResp struct {
 
 func (app *App) Signup(w http.ResponseWriter, r *http.Request) {
 	var body signupReq
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		httpError(w, http.StatusBadRequest, "invalid_json")
+	if !decodeBody(w, r, &body) {
 		return
 	}
 	body.Email = strings.ToLower(strings.TrimSpace(body.Email))
-	if body.Email == "" || body.Password == "" {
-		httpError(w, http.StatusBadRequest, "email_and_password_required")
-		return
-	}
 
 	var exists bool
 	if err := app.DB.QueryRow(r.Context(), `SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)`, body.Email).Scan(&exists); err != nil {
-		log.Error().Err(err).Msg("db EXISTS(users) failed")
-		httpError(w, http.StatusInternalServerError, "db_error")
+		log.Ctx(r.Context()).Error().Err(err).Msg("db EXISTS(users) failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
 	if exists {
-		httpError(w, http.StatusConflict, "email_in_use")
+		apierror.Write(w, apierror.New(http.StatusConflict, "email_in_use"))
+		return
+	}
+	if body.Username != nil {
+		if reservedUsername(*body.Username) {
+			apierror.Write(w, apierror.New(http.StatusUnprocessableEntity, "username_reserved"))
+			return
+		}
+		taken, err := app.usernameTaken(r.Context(), *body.Username, "")
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		if taken {
+			apierror.Write(w, apierror.New(http.StatusConflict, "username_in_use"))
+			return
+		}
+	}
+	var usernameVerdict, displayNameVerdict moderation.Verdict
+	if body.Username != nil {
+		var e *apierror.Error
+		if usernameVerdict, e = app.screenName(r.Context(), "username", *body.Username); e != nil {
+			apierror.Write(w, e)
+			return
+		}
+	}
+	if body.DisplayName != nil {
+		if name := strings.TrimSpace(*body.DisplayName); name != "" {
+			var e *apierror.Error
+			if displayNameVerdict, e = app.screenName(r.Context(), "display_name", name); e != nil {
+				apierror.Write(w, e)
+				return
+			}
+		}
+	}
+
+	var referrerID string
+	if code := normalizeReferralCode(body.ReferralCode); code != "" {
+		err := app.DB.QueryRow(r.Context(), `SELECT id FROM users WHERE referral_code=$1`, code).Scan(&referrerID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_referral_code"))
+			return
+		}
+		if err != nil {
+			log.Ctx(r.Context()).Error().Err(err).Msg("lookup referral code failed")
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+	}
+
+	referralCode, err := newReferralCode()
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("referral code generation failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "referral_code_error"))
 		return
 	}
 
 	hash, err := a.HashPassword(body.Password)
 	if err != nil {
-		log.Error().Err(err).Msg("argon2 hash error")
-		httpError(w, http.StatusInternalServerError, "hash_error")
+		log.Ctx(r.Context()).Error().Err(err).Msg("argon2 hash error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "hash_error"))
 		return
 	}
 
 	var id string
 	err = app.DB.QueryRow(r.Context(), `
-		INSERT INTO users (email, password_hash, role, username, display_name)
-		VALUES ($1,$2,'user',$3,$4)
+		INSERT INTO users (email, password_hash, role, username, display_name, referral_code)
+		VALUES ($1,$2,'user',$3,$4,$5)
 		RETURNING id
-	`, body.Email, hash, body.Username, body.DisplayName).Scan(&id)
+	`, body.Email, hash, body.Username, body.DisplayName, referralCode).Scan(&id)
+	if usernameConflict(err) {
+		apierror.Write(w, apierror.New(http.StatusConflict, "username_in_use"))
+		return
+	}
 	if err != nil {
-		log.Error().Err(err).Msg("insert user failed")
-		httpError(w, http.StatusInternalServerError, "insert_user_error")
+		log.Ctx(r.Context()).Error().Err(err).Msg("insert user failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_user_error"))
 		return
 	}
 	if _, err := app.DB.Exec(r.Context(), `INSERT INTO wallets (user_id, balance) VALUES ($1, 0) ON CONFLICT DO NOTHING`, id); err != nil {
-		log.Error().Err(err).Str("user_id", id).Msg("insert wallet failed")
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", id).Msg("insert wallet failed")
+	}
+	if body.Username != nil {
+		app.queueNameReview(r.Context(), id, "username", *body.Username, usernameVerdict)
+	}
+	if body.DisplayName != nil {
+		app.queueNameReview(r.Context(), id, "display_name", *body.DisplayName, displayNameVerdict)
+	}
+	if referrerID != "" {
+		if err := app.attachReferral(r.Context(), referrerID, id, clientIP(r)); err != nil {
+			log.Ctx(r.Context()).Error().Err(err).Str("user_id", id).Str("referrer_id", referrerID).Msg("attach referral failed")
+		}
 	}
 
+	app.Events.Publish(r.Context(), evUserSignedUp, userSignedUp{UserID: id, ReferrerID: referrerID})
+
 	resp, err := app.issueTokens(r, id, "user")
 	if err != nil {
-		log.Error().Err(err).Str("user_id", id).Msg("issueTokens failed (signup)")
-		httpError(w, http.StatusInternalServerError, "token_issue_error")
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", id).Msg("issueTokens failed (signup)")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_issue_error"))
 		return
 	}
 
@@ -90,8 +156,7 @@ func (app *App) Signup(w http.ResponseWriter, r *http.Request) {
 
 func (app *App) Login(w http.ResponseWriter, r *http.Request) {
 	var body loginReq
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		httpError(w, http.StatusBadRequest, "invalid_json")
+	if !decodeBody(w, r, &body) {
 		return
 	}
 	email := strings.ToLower(strings.TrimSpace(body.Email))
@@ -101,74 +166,82 @@ func (app *App) Login(w http.ResponseWriter, r *http.Request) {
 		`SELECT id, password_hash, role FROM users WHERE email=$1`, email).
 		Scan(&id, &hash, &role)
 	if errors.Is(err, pgx.ErrNoRows) {
-		httpError(w, http.StatusUnauthorized, "invalid_credentials")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "invalid_credentials"))
 		return
 	}
 	if err != nil {
-		log.Error().Err(err).Str("email", email).Msg("select user on login failed")
-		httpError(w, http.StatusInternalServerError, "db_error")
+		log.Ctx(r.Context()).Error().Err(err).Str("email", email).Msg("select user on login failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
 
 	ok, err := a.CheckPassword(body.Password, hash)
 	if err != nil || !ok {
-		httpError(w, http.StatusUnauthorized, "invalid_credentials")
+		app.recordSecurityEvent(r, id, secLoginFailed, nil)
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "invalid_credentials"))
+		return
+	}
+	if accountStatusError(w, app.checkAccountActive(r.Context(), id)) {
 		return
 	}
 
 	tokens, err := app.issueTokens(r, id, role)
 	if err != nil {
-		log.Error().Err(err).Str("user_id", id).Msg("issueTokens failed (login)")
-		httpError(w, http.StatusInternalServerError, "token_issue_error")
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", id).Msg("issueTokens failed (login)")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_issue_error"))
 		return
 	}
+	app.recordSecurityEvent(r, id, secLogin, map[string]any{"method": "password"})
 	writeJSON(w, http.StatusOK, authResp{Tokens: tokens, User: app.loadUser(r, id)})
 }
 
 func (app *App) Refresh(w http.ResponseWriter, r *http.Request) {
-	var body struct{ RefreshToken string `json:"refreshToken"` }
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
-		httpError(w, http.StatusBadRequest, "invalid_json")
+	var body struct {
+		RefreshToken string `json:"refreshToken" validate:"required"`
+	}
+	if !decodeBody(w, r, &body) {
 		return
 	}
 
-	token, err := jwt.ParseWithClaims(body.RefreshToken, &jwt.RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return app.JWTSecret, nil
-	}, jwt.WithValidMethods([]string{"HS256"}))
-	if err != nil || !token.Valid {
-		httpError(w, http.StatusUnauthorized, "invalid_refresh")
+	claims, err := a.ParseRefresh(app.JWT, body.RefreshToken)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "invalid_refresh"))
 		return
 	}
-	claims := token.Claims.(*jwt.RegisteredClaims)
 	userID, jti := claims.Subject, claims.ID
 
 	var role string
 	var revoked *time.Time
 	var expires time.Time
+	var sess session
 	err = app.DB.QueryRow(r.Context(), `
-		SELECT u.role, rt.revoked_at, rt.expires_at
+		SELECT u.role, rt.revoked_at, rt.expires_at, rt.session_id::text, COALESCE(rt.started_at, rt.created_at)
 		FROM refresh_tokens rt
 		JOIN users u ON u.id = rt.user_id
 		WHERE rt.user_id = $1 AND rt.jti = $2
-	`, userID, jti).Scan(&role, &revoked, &expires)
+	`, userID, jti).Scan(&role, &revoked, &expires, &sess.ID, &sess.StartedAt)
 	if errors.Is(err, pgx.ErrNoRows) || (revoked != nil) || time.Now().After(expires) {
-		httpError(w, http.StatusUnauthorized, "refresh_not_valid")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "refresh_not_valid"))
 		return
 	}
 	if err != nil {
-		log.Error().Err(err).Msg("select refresh_token failed")
-		httpError(w, http.StatusInternalServerError, "db_error")
+		log.Ctx(r.Context()).Error().Err(err).Msg("select refresh_token failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	if accountStatusError(w, app.checkAccountActive(r.Context(), userID)) {
 		return
 	}
 
 	if _, err := app.DB.Exec(r.Context(), `UPDATE refresh_tokens SET revoked_at = now() WHERE jti = $1`, jti); err != nil {
-		log.Error().Err(err).Str("jti", jti).Msg("revoke old refresh failed")
+		log.Ctx(r.Context()).Error().Err(err).Str("jti", jti).Msg("revoke old refresh failed")
 	}
 
-	tokens, err := app.issueTokens(r, userID, role)
+	tokens, err := app.issueSessionTokens(r, userID, role, &sess)
 	if err != nil {
-		log.Error().Err(err).Str("user_id", userID).Msg("issueTokens failed (refresh)")
-		httpError(w, http.StatusInternalServerError, "token_issue_error")
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", userID).Msg("issueTokens failed (refresh)")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_issue_error"))
 		return
 	}
 
@@ -178,7 +251,7 @@ func (app *App) Refresh(w http.ResponseWriter, r *http.Request) {
 func (app *App) Me(w http.ResponseWriter, r *http.Request) {
 	uid, ok := getUserID(r)
 	if !ok {
-		httpError(w, http.StatusUnauthorized, "not_authenticated")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"data": app.loadUser(r, uid)})
@@ -187,16 +260,30 @@ func (app *App) Me(w http.ResponseWriter, r *http.Request) {
 // ---- helpers ----
 
 func (app *App) issueTokens(r *http.Request, userID, role string) (a.TokenPair, error) {
-	accessTTL := minutesFromEnv("ACCESS_TOKEN_TTL_MIN", 15)
-	refreshTTL := daysFromEnv("REFRESH_TOKEN_TTL_DAYS", 30)
+	return app.issueSessionTokens(r, userID, role, nil)
+}
+
+// issueSessionTokens issues tokens for a new session, or continues sess
+// when a refresh token is used.
+func (app *App) issueSessionTokens(r *http.Request, userID, role string, sess *session) (a.TokenPair, error) {
+	accessTTL := app.Settings.Minutes(r.Context(), settings.AccessTokenTTLMinutes)
+	refreshTTL := app.Settings.Days(r.Context(), settings.RefreshTokenTTLDays)
 
-	access, err := a.GenerateAccess(app.JWTSecret, userID, role, accessTTL)
+	u, err := app.userByID(r.Context(), userID)
+	if err != nil {
+		return a.TokenPair{}, err
+	}
+	sid, startedAt := uuid.NewString(), (*time.Time)(nil)
+	if sess != nil {
+		sid, startedAt = sess.ID, &sess.StartedAt
+	}
+	access, err := a.GenerateAccess(app.JWT, userID, role, u.TokenVersion, sid, accessTTL)
 	if err != nil {
 		return a.TokenPair{}, err
 	}
 
 	jti := uuid.NewString()
-	refresh, err := a.GenerateRefresh(app.JWTSecret, userID, jti, refreshTTL)
+	refresh, err := a.GenerateRefresh(app.JWT, userID, jti, refreshTTL)
 	if err != nil {
 		return a.TokenPair{}, err
 	}
@@ -204,9 +291,9 @@ func (app *App) issueTokens(r *http.Request, userID, role string) (a.TokenPair,
 	ua, ip := r.UserAgent(), clientIP(r)
 	expiresAt := time.Now().Add(refreshTTL)
 	if _, err := app.DB.Exec(r.Context(), `
-		INSERT INTO refresh_tokens (user_id, jti, user_agent, ip, expires_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`, userID, jti, ua, ip, expiresAt); err != nil {
+		INSERT INTO refresh_tokens (user_id, jti, user_agent, ip, expires_at, started_at, last_used_at, session_id)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6::timestamptz, now()), CASE WHEN $6 IS NULL THEN NULL ELSE now() END, $7)
+	`, userID, jti, ua, ip, expiresAt, startedAt, sid); err != nil {
 		return a.TokenPair{}, err
 	}
 
@@ -214,12 +301,8 @@ func (app *App) issueTokens(r *http.Request, userID, role string) (a.TokenPair,
 }
 
 func (app *App) loadUser(r *http.Request, id string) UserDTO {
-	var u UserDTO
-	_ = app.DB.QueryRow(r.Context(), `
-		SELECT id, email, username, display_name, created_at
-		FROM users WHERE id=$1
-	`, id).Scan(&u.ID, &u.Email, &u.Username, &u.DisplayName, &u.CreatedAt)
-	return u
+	u, _ := app.userByID(r.Context(), id)
+	return UserDTO{ID: u.ID, Email: u.Email, Username: u.Username, DisplayName: u.DisplayName, AvatarURL: u.AvatarURL, Phone: u.Phone, Language: u.Language, TimeZone: u.TimeZone, CreatedAt: u.CreatedAt}
 }
 
 func clientIP(r *http.Request) string {
@@ -234,26 +317,6 @@ func clientIP(r *http.Request) string {
 	return host
 }
 
-func minutesFromEnv(k string, def int) time.Duration {
-	if v := os.Getenv(k); v != "" {
-		if i, err := strconv.Atoi(v); err == nil && i > 0 {
-			return time.Duration(i) * time.Minute
-		}
-	}
-	return time.Duration(def) * time.Minute
-}
-func daysFromEnv(k string, def int) time.Duration {
-	if v := os.Getenv(k); v != "" {
-		if i, err := strconv.Atoi(v); err == nil && i > 0 {
-			return time.Duration(i) * 24 * time.Hour
-		}
-	}
-	return time.Duration(def) * 24 * time.Hour
-}
-
-func httpError(w http.ResponseWriter, code int, msg string) {
-	writeJSON(w, code, map[string]any{"error": map[string]string{"code": msg}})
-}
 func writeJSON(w http.ResponseWriter, code int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
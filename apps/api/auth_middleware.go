@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
 	a "github.com/sudo-init-do/okies-backend/pkg/auth"
 )
 
@@ -13,6 +14,8 @@ type ctxKey string
 const (
 	ctxUserID   ctxKey = "userID"
 	ctxUserRole ctxKey = "userRole"
+	ctxActor    ctxKey = "actor"
+	ctxClaims   ctxKey = "claims"
 )
 
 type AccessClaims = a.AccessClaims
@@ -21,17 +24,55 @@ func (app *App) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authz := r.Header.Get("Authorization")
 		if !strings.HasPrefix(authz, "Bearer ") {
-			httpError(w, http.StatusUnauthorized, "missing_bearer_token")
+			apierror.Write(w, apierror.New(http.StatusUnauthorized, "missing_bearer_token"))
 			return
 		}
 		tokenStr := strings.TrimPrefix(authz, "Bearer ")
-		claims, err := a.ParseAccess(app.JWTSecret, tokenStr)
+		claims, err := a.ParseAccess(app.JWT, tokenStr)
 		if err != nil {
-			httpError(w, http.StatusUnauthorized, "invalid_token")
+			apierror.Write(w, apierror.New(http.StatusUnauthorized, "invalid_token"))
 			return
 		}
+		if app.accessRevoked(r.Context(), claims) {
+			apierror.Write(w, apierror.New(http.StatusUnauthorized, "token_revoked"))
+			return
+		}
+		if accountStatusError(w, app.checkAccountActive(r.Context(), claims.Subject)) {
+			return
+		}
+		if !claims.ReadOnly() {
+			// signed out everywhere since this token was issued
+			u, err := app.userByID(r.Context(), claims.Subject)
+			if err != nil {
+				// as checkAccountActive: an unknown version isn't a current one
+				apierror.Write(w, accountStatusAPIError(err))
+				return
+			}
+			if claims.Ver != u.TokenVersion {
+				apierror.Write(w, apierror.New(http.StatusUnauthorized, "token_revoked"))
+				return
+			}
+		}
+		app.applyPreferredLanguage(w, r.Context(), claims.Subject)
+		setLogUser(r.Context(), claims.Subject)
 		ctx := context.WithValue(r.Context(), ctxUserID, claims.Subject)
 		ctx = context.WithValue(ctx, ctxUserRole, claims.Role)
+		ctx = context.WithValue(ctx, ctxClaims, claims)
+		if claims.ReadOnly() {
+			// Impersonation: reads only, and every one of them is audited
+			ctx = context.WithValue(ctx, ctxActor, *claims.Act)
+			r = r.WithContext(ctx)
+			if !isSafeMethod(r.Method) {
+				apierror.Write(w, apierror.New(http.StatusForbidden, "impersonation_read_only"))
+				return
+			}
+			app.audit(r, auditEntry{
+				Action:     "impersonation.request",
+				TargetType: "user",
+				TargetID:   claims.Subject,
+				After:      map[string]any{"method": r.Method, "path": r.URL.Path, "query": r.URL.RawQuery},
+			})
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -39,14 +80,38 @@ func (app *App) AuthMiddleware(next http.Handler) http.Handler {
 func (app *App) RequireAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		role, _ := getUserRole(r)
-		if role != "admin" {
-			httpError(w, http.StatusForbidden, "admin_only")
+		if !a.IsAdminRole(role) {
+			apierror.Write(w, apierror.New(http.StatusForbidden, "admin_only"))
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// RequirePermission gates an admin route on the caller's role granting p.
+func (app *App) RequirePermission(p a.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := getUserRole(r)
+			if !a.HasPermission(role, p) {
+				apierror.Write(w, apierror.New(http.StatusForbidden, "insufficient_permissions"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// getActor returns the admin behind an impersonation token, if any.
+func getActor(r *http.Request) (a.Actor, bool) {
+	act, ok := r.Context().Value(ctxActor).(a.Actor)
+	return act, ok
+}
+
+func isSafeMethod(m string) bool {
+	return m == http.MethodGet || m == http.MethodHead || m == http.MethodOptions
+}
+
 func getUserID(r *http.Request) (string, bool) {
 	v := r.Context().Value(ctxUserID)
 	if v == nil { return "", false }
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/avatar"
+	"github.com/sudo-init-do/okies-backend/pkg/awsv4"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+	"github.com/sudo-init-do/okies-backend/pkg/objectstore"
+)
+
+// avatarUploadTTL is how long a pre-signed avatar upload URL stays valid.
+const avatarUploadTTL = 15 * time.Minute
+
+func newObjectStore(cfg *config.Config) *objectstore.S3 {
+	st := cfg.Storage
+	if st.S3Bucket == "" {
+		return nil
+	}
+	return &objectstore.S3{
+		Bucket:      st.S3Bucket,
+		Endpoint:    st.S3Endpoint,
+		PublicURL:   st.PublicURL,
+		Credentials: awsv4.Credentials{Region: st.S3Region, AccessKeyID: st.AWSAccessKeyID, SecretAccessKey: st.AWSSecretAccessKey},
+		Client:      httpclient.New("s3", httpclient.Options{Timeout: 30 * time.Second, Retries: 2}),
+	}
+}
+
+// Uploads land under uploads/ and are deleted once processed; a lifecycle
+// rule on that prefix can clear the ones never completed. Only the
+// normalized copy under avatars/ is ever served.
+func avatarUploadKey(uid, id string) string { return "uploads/avatars/" + uid + "/" + id }
+func avatarKey(uid, id string) string       { return "avatars/" + uid + "/" + id + ".jpg" }
+
+// POST /v1/users/me/avatar  {"contentType":"image/jpeg"}
+// Issues a pre-signed URL the app PUTs the picture to, with the returned
+// headers, before calling .../complete.
+func (app *App) CreateAvatarUpload(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	if app.Storage == nil {
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "uploads_unavailable"))
+		return
+	}
+	var body struct {
+		ContentType string `json:"contentType" validate:"required,oneof=image/jpeg image/png"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	var id string
+	expiresAt := time.Now().Add(avatarUploadTTL)
+	if err := app.DB.QueryRow(r.Context(), `
+		INSERT INTO avatar_uploads (user_id, content_type, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, uid, body.ContentType, expiresAt).Scan(&id); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("create avatar upload failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	key := avatarUploadKey(uid, id)
+
+	writeJSON(w, http.StatusCreated, map[string]any{"data": map[string]any{
+		"uploadId":  id,
+		"uploadUrl": app.Storage.PresignPut(key, body.ContentType, avatarUploadTTL),
+		"method":    http.MethodPut,
+		"headers":   map[string]string{"Content-Type": body.ContentType},
+		"maxBytes":  avatar.MaxBytes,
+		"expiresAt": expiresAt,
+	}})
+}
+
+// POST /v1/users/me/avatar/{id}/complete
+// Processes the uploaded picture: it must be a JPEG or PNG within the size
+// limits, and is cropped square, resized and re-encoded without metadata
+// before becoming the user's avatar. Returns the updated profile.
+func (app *App) CompleteAvatarUpload(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	if app.Storage == nil {
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "uploads_unavailable"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	ctx := r.Context()
+
+	var (
+		status    string
+		expiresAt time.Time
+	)
+	err := app.DB.QueryRow(ctx, `
+		SELECT status, expires_at FROM avatar_uploads
+		WHERE id::text=$1 AND user_id=$2
+	`, id, uid).Scan(&status, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && status != "pending") {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "avatar_upload_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	// the URL may have been used up to its expiry, so allow a little for
+	// the upload to finish
+	if time.Now().After(expiresAt.Add(avatarUploadTTL)) {
+		apierror.Write(w, apierror.New(http.StatusGone, "avatar_upload_expired"))
+		return
+	}
+
+	key := avatarUploadKey(uid, id)
+	raw, err := app.Storage.Get(ctx, key, avatar.MaxBytes)
+	switch {
+	case errors.Is(err, objectstore.ErrNotFound):
+		apierror.Write(w, apierror.New(http.StatusConflict, "avatar_not_uploaded"))
+		return
+	case errors.Is(err, objectstore.ErrTooLarge):
+		app.rejectAvatarUpload(r, id, key, "too large")
+		apierror.Write(w, apierror.New(http.StatusRequestEntityTooLarge, "image_too_large"))
+		return
+	case err != nil:
+		log.Ctx(ctx).Error().Err(err).Str("upload_id", id).Msg("fetch avatar upload failed")
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "uploads_unavailable"))
+		return
+	}
+
+	img, err := avatar.Normalize(raw)
+	if errors.Is(err, avatar.ErrFormat) || errors.Is(err, avatar.ErrDimensions) {
+		app.rejectAvatarUpload(r, id, key, err.Error())
+		apierror.Write(w, apierror.New(http.StatusUnprocessableEntity, "invalid_image"))
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("upload_id", id).Msg("normalize avatar failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "image_error"))
+		return
+	}
+	finalKey := avatarKey(uid, id)
+	if err := app.Storage.Put(ctx, finalKey, avatar.ContentType, img); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("upload_id", id).Msg("store avatar failed")
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "uploads_unavailable"))
+		return
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+	// a concurrent complete of the same upload loses here
+	tag, err := tx.Exec(ctx, `UPDATE avatar_uploads SET status='done', completed_at=now() WHERE id=$1 AND status='pending'`, id)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "avatar_upload_not_found"))
+		return
+	}
+	var previous *string
+	if err := tx.QueryRow(ctx, `
+		UPDATE users u SET avatar_url=$2 FROM (SELECT avatar_url FROM users WHERE id=$1 FOR UPDATE) old
+		WHERE u.id=$1
+		RETURNING old.avatar_url
+	`, uid, app.Storage.URL(finalKey)).Scan(&previous); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	app.invalidateUser(ctx, uid)
+
+	app.deleteObject(ctx, key)
+	if previous != nil {
+		app.deleteAvatarURL(ctx, *previous)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": app.loadUser(r, uid)})
+}
+
+// DELETE /v1/users/me/avatar
+func (app *App) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var previous *string
+	err := app.DB.QueryRow(r.Context(), `
+		UPDATE users u SET avatar_url=NULL FROM (SELECT avatar_url FROM users WHERE id=$1 FOR UPDATE) old
+		WHERE u.id=$1
+		RETURNING old.avatar_url
+	`, uid).Scan(&previous)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(r.Context(), uid)
+	if previous != nil {
+		app.deleteAvatarURL(r.Context(), *previous)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) rejectAvatarUpload(r *http.Request, id, key, reason string) {
+	if _, err := app.DB.Exec(r.Context(), `
+		UPDATE avatar_uploads SET status='rejected', error=$2, completed_at=now() WHERE id=$1
+	`, id, reason); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("upload_id", id).Msg("reject avatar upload failed")
+	}
+	app.deleteObject(r.Context(), key)
+}
+
+// deleteAvatarURL removes a replaced avatar from the bucket. URLs from
+// another bucket or base URL (after a configuration change) are left alone.
+func (app *App) deleteAvatarURL(ctx context.Context, u string) {
+	if app.Storage == nil {
+		return
+	}
+	base := app.Storage.URL("")
+	if strings.HasPrefix(u, base+"avatars/") {
+		app.deleteObject(ctx, strings.TrimPrefix(u, base))
+	}
+}
+
+// deleteObject is best effort: an object left behind costs storage, not
+// correctness.
+func (app *App) deleteObject(ctx context.Context, key string) {
+	if err := app.Storage.Delete(ctx, key); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("key", key).Msg("delete object failed")
+	}
+}
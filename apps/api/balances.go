@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Wallet balances are the wallet's snapshot in wallet_balance_snapshots
+// plus the ledger entries created since, so reading one costs the same
+// whatever the wallet's history. The snapshot loop below moves snapshots
+// forward; a wallet without one sums its whole ledger.
+
+// balanceSQL is a scalar subquery for the balance of the wallet whose ID is
+// the SQL expression walletID (a parameter or column).
+func balanceSQL(walletID string) string {
+	return `(SELECT (COALESCE(s.balance,0) + COALESCE(SUM(CASE WHEN le.direction='credit' THEN le.amount ELSE -le.amount END),0))::bigint
+		FROM (SELECT 1) one
+		LEFT JOIN wallet_balance_snapshots s ON s.wallet_id = ` + walletID + `
+		LEFT JOIN ledger_entries le ON le.wallet_id = ` + walletID + ` AND le.created_at >= COALESCE(s.as_of,'-infinity')
+		GROUP BY s.balance)`
+}
+
+// rowQuerier is a pool or a transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// balanceOf reads walletID's balance through q. Inside a transaction that
+// moves money, lock the wallet first.
+func balanceOf(ctx context.Context, q rowQuerier, walletID string) (int64, error) {
+	var balance int64
+	err := q.QueryRow(ctx, `SELECT `+balanceSQL("$1::uuid"), walletID).Scan(&balance)
+	return balance, err
+}
+
+func (app *App) walletBalance(ctx context.Context, walletID string) (int64, error) {
+	return balanceOf(ctx, app.DB, walletID)
+}
+
+// snapshotLag keeps snapshots this far behind now. Entries take their
+// created_at when their transaction starts but only become visible when it
+// commits, so a snapshot must not cover times a transaction still open
+// might write at.
+const snapshotLag = 5 * time.Minute
+
+// advanceBalanceSnapshots adds the entries created since the last run to
+// every wallet's snapshot. Each run covers [previous as_of, cutoff) for all
+// wallets, so a wallet whose snapshot is older had no entries in between.
+func (app *App) advanceBalanceSnapshots(ctx context.Context) (int64, error) {
+	tag, err := app.DB.Exec(ctx, `
+		WITH b AS (
+		  SELECT (SELECT max(as_of) FROM wallet_balance_snapshots) AS prev,
+		         LEAST(now() - make_interval(secs => $1),
+		               (SELECT min(xact_start) FROM pg_stat_activity
+		                WHERE datname = current_database() AND xact_start IS NOT NULL)) AS cutoff
+		), delta AS (
+		  SELECT le.wallet_id, SUM(CASE WHEN le.direction='credit' THEN le.amount ELSE -le.amount END)::bigint AS amount,
+		         b.cutoff
+		  FROM ledger_entries le, b
+		  WHERE le.created_at >= COALESCE(b.prev,'-infinity') AND le.created_at < b.cutoff
+		    AND b.cutoff > COALESCE(b.prev,'-infinity')
+		  GROUP BY le.wallet_id, b.cutoff
+		)
+		INSERT INTO wallet_balance_snapshots (wallet_id, balance, as_of)
+		SELECT wallet_id, amount, cutoff FROM delta
+		ON CONFLICT (wallet_id) DO UPDATE
+		  SET balance = wallet_balance_snapshots.balance + EXCLUDED.balance,
+		      as_of = EXCLUDED.as_of, updated_at = now()
+	`, snapshotLag.Seconds())
+	return tag.RowsAffected(), err
+}
+
+// runBalanceSnapshots advances snapshots every interval.
+func (app *App) runBalanceSnapshots(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			start := time.Now()
+			n, err := app.advanceBalanceSnapshots(ctx)
+			if err != nil {
+				log.Ctx(ctx).Error().Err(err).Msg("advance balance snapshots failed")
+				continue
+			}
+			log.Ctx(ctx).Debug().Int64("wallets", n).Dur("took", time.Since(start)).Msg("balance snapshots advanced")
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
+)
+
+// Saved beneficiaries: people a user gifts and bank accounts they withdraw
+// to, under a nickname, so apps can pre-fill both. A beneficiary can carry
+// a daily limit the user sets on themselves; gifts and withdrawals to it
+// beyond that in any 24 hours are refused. One on file for
+// beneficiaries.trusted_after_days that has been paid before is trusted.
+
+type beneficiaryDTO struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"` // user or bank
+	Nickname    string    `json:"nickname"`
+	DailyLimit  *int64    `json:"dailyLimit"` // kobo; null is no limit
+	Trusted     bool      `json:"trusted"`
+	User        *UserMini `json:"user,omitempty"`
+	Destination *destDTO  `json:"destination,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// beneficiaries returns uid's beneficiaries, or only the one with id when
+// id is set. Those saved for deleted destinations are left out.
+func (app *App) beneficiaries(ctx context.Context, uid, id string) ([]beneficiaryDTO, error) {
+	walletID, err := app.walletIDForUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := app.DB.Query(ctx, `
+		SELECT b.id, b.nickname, b.daily_limit, b.created_at,
+		       b.recipient_id, u.username, u.display_name, u.avatar_url,
+		       d.id, d.bank_code, d.account_last4, d.account_name, d.is_default, d.created_at,
+		       b.created_at <= now() - make_interval(days => $4) AND CASE
+		         WHEN b.recipient_id IS NOT NULL THEN EXISTS (
+		           SELECT 1 FROM ledger_entries dr
+		           JOIN ledger_entries c ON c.tx_id = dr.tx_id AND c.direction = 'credit'
+		           JOIN wallets rw ON rw.id = c.wallet_id AND rw.user_id = b.recipient_id
+		           JOIN transactions t ON t.id = dr.tx_id AND t.kind = 'gift'
+		           WHERE dr.wallet_id = $2 AND dr.direction = 'debit')
+		         ELSE EXISTS (
+		           SELECT 1 FROM payouts p
+		           WHERE p.user_id = b.user_id AND p.destination_id = b.destination_id AND p.status = 'succeeded')
+		       END
+		FROM beneficiaries b
+		LEFT JOIN users u ON u.id = b.recipient_id
+		LEFT JOIN payout_destinations d ON d.id = b.destination_id
+		WHERE b.user_id = $1 AND ($3 = '' OR b.id::text = $3)
+		  AND (b.destination_id IS NULL OR d.deleted_at IS NULL)
+		ORDER BY lower(b.nickname), b.id
+	`, uid, walletID, id, app.Settings.Int(ctx, settings.BeneficiaryTrustDays))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []beneficiaryDTO{}
+	for rows.Next() {
+		var (
+			b           beneficiaryDTO
+			recipientID *string
+			u           UserMini
+			destID      *string
+			d           destDTO
+			bankCode    *string
+			last4       *string
+			accountName *string
+			isDefault   *bool
+			destAt      *time.Time
+		)
+		if err := rows.Scan(&b.ID, &b.Nickname, &b.DailyLimit, &b.CreatedAt,
+			&recipientID, &u.Username, &u.DisplayName, &u.AvatarURL,
+			&destID, &bankCode, &last4, &accountName, &isDefault, &destAt,
+			&b.Trusted); err != nil {
+			return nil, err
+		}
+		if recipientID != nil {
+			b.Type = "user"
+			u.ID = *recipientID
+			b.User = &u
+		} else {
+			b.Type = "bank"
+			d.ID, d.BankCode, d.AccountNumber, d.AccountName = *destID, *bankCode, maskAccount(*last4), *accountName
+			d.IsDefault, d.CreatedAt = *isDefault, *destAt
+			b.Destination = &d
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// giftLimitSQL and withdrawalLimitSQL read the daily limit user $1 set on
+// a beneficiary (recipient user or payout destination $2) and what they
+// have sent it in the last 24 hours. No row means no limit. checkMove runs
+// them in the transaction that moves the money, with the sender's wallet
+// locked, so concurrent payments can't both fit.
+const (
+	giftLimitSQL = `
+		SELECT b.daily_limit,
+		  (SELECT COALESCE(SUM(dr.amount),0)
+		   FROM ledger_entries dr
+		   JOIN wallets sw ON sw.id = dr.wallet_id AND sw.user_id = b.user_id
+		   JOIN ledger_entries c ON c.tx_id = dr.tx_id AND c.direction = 'credit'
+		   JOIN wallets rw ON rw.id = c.wallet_id AND rw.user_id = b.recipient_id
+		   JOIN transactions t ON t.id = dr.tx_id AND t.kind = 'gift'
+		   WHERE dr.direction = 'debit' AND t.created_at > now() - interval '24 hours') +
+		  (SELECT COALESCE(SUM(h.amount),0) FROM held_gifts h
+		   WHERE h.sender_id = b.user_id AND h.recipient_id = b.recipient_id
+		     AND h.status <> 'returned' AND h.created_at > now() - interval '24 hours')
+		FROM beneficiaries b
+		WHERE b.user_id = $1 AND b.recipient_id::text = $2 AND b.daily_limit IS NOT NULL`
+	withdrawalLimitSQL = `
+		SELECT b.daily_limit,
+		  (SELECT COALESCE(SUM(p.amount),0) FROM payouts p
+		   WHERE p.user_id = b.user_id AND p.destination_id = b.destination_id
+		     AND p.status NOT IN ('rejected','failed','cancelled')
+		     AND p.created_at > now() - interval '24 hours')
+		FROM beneficiaries b
+		WHERE b.user_id = $1 AND b.destination_id::text = $2 AND b.daily_limit IS NOT NULL`
+)
+
+// GET /v1/beneficiaries
+func (app *App) ListBeneficiaries(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	out, err := app.beneficiaries(r.Context(), uid, "")
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("list beneficiaries failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// POST /v1/beneficiaries
+// {"recipientUserId"|"recipientPhone"|"destinationId":"...","nickname":"Mum","dailyLimit":5000000}
+func (app *App) CreateBeneficiary(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		RecipientUserID string `json:"recipientUserId" validate:"omitempty,uuid"`
+		RecipientPhone  string `json:"recipientPhone" validate:"omitempty,phone"`
+		DestinationID   string `json:"destinationId" validate:"omitempty,uuid"`
+		Nickname        string `json:"nickname" validate:"required,max=50"`
+		DailyLimit      *int64 `json:"dailyLimit" validate:"omitempty,kobo"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	set := 0
+	for _, v := range []string{body.RecipientUserID, body.RecipientPhone, body.DestinationID} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "beneficiary_target_required"))
+		return
+	}
+	nickname := strings.TrimSpace(body.Nickname)
+	if nickname == "" {
+		apierror.Write(w, apierror.InvalidField("nickname"))
+		return
+	}
+	ctx := r.Context()
+
+	var recipientID, destinationID *string
+	switch {
+	case body.DestinationID != "":
+		var owner string
+		err := app.DB.QueryRow(ctx, `
+			SELECT user_id FROM payout_destinations WHERE id=$1 AND deleted_at IS NULL
+		`, body.DestinationID).Scan(&owner)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		if err != nil || owner != uid {
+			apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_destination"))
+			return
+		}
+		destinationID = &body.DestinationID
+	default:
+		id := body.RecipientUserID
+		if body.RecipientPhone != "" {
+			phone, _ := validate.Phone(body.RecipientPhone)
+			var err error
+			id, err = app.userIDByPhone(r, phone)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+				return
+			}
+		}
+		if id == uid {
+			apierror.Write(w, apierror.New(http.StatusBadRequest, "cannot_gift_self"))
+			return
+		}
+		var listed bool
+		if id != "" {
+			if err := app.DB.QueryRow(ctx, `
+				SELECT EXISTS (SELECT 1 FROM users u WHERE u.id=$1 AND `+listedUser+`)
+			`, id).Scan(&listed); err != nil {
+				apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+				return
+			}
+		}
+		if !listed {
+			apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+			return
+		}
+		recipientID = &id
+	}
+
+	var id string
+	err := app.DB.QueryRow(ctx, `
+		INSERT INTO beneficiaries (user_id, recipient_id, destination_id, nickname, daily_limit)
+		VALUES ($1,$2,$3,$4,$5)
+		RETURNING id
+	`, uid, recipientID, destinationID, nickname, body.DailyLimit).Scan(&id)
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) && pgErr.SQLState() == "23505" {
+		apierror.Write(w, apierror.New(http.StatusConflict, "beneficiary_exists"))
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("create beneficiary failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.writeBeneficiary(w, r, uid, id, http.StatusCreated)
+}
+
+// PUT /v1/beneficiaries/{id}  {"nickname":"Mum","dailyLimit":null}
+// Replaces the nickname and limit; a missing or null dailyLimit removes it.
+func (app *App) UpdateBeneficiary(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		Nickname   string `json:"nickname" validate:"required,max=50"`
+		DailyLimit *int64 `json:"dailyLimit" validate:"omitempty,kobo"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	nickname := strings.TrimSpace(body.Nickname)
+	if nickname == "" {
+		apierror.Write(w, apierror.InvalidField("nickname"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	tag, err := app.DB.Exec(r.Context(), `
+		UPDATE beneficiaries SET nickname=$3, daily_limit=$4, updated_at=now()
+		WHERE id::text=$1 AND user_id=$2
+	`, id, uid, nickname, body.DailyLimit)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "beneficiary_not_found"))
+		return
+	}
+	app.writeBeneficiary(w, r, uid, id, http.StatusOK)
+}
+
+// DELETE /v1/beneficiaries/{id}
+func (app *App) DeleteBeneficiary(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	tag, err := app.DB.Exec(r.Context(), `DELETE FROM beneficiaries WHERE id::text=$1 AND user_id=$2`, id, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "beneficiary_not_found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) writeBeneficiary(w http.ResponseWriter, r *http.Request, uid, id string, status int) {
+	list, err := app.beneficiaries(r.Context(), uid, id)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if len(list) == 0 {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "beneficiary_not_found"))
+		return
+	}
+	writeJSON(w, status, map[string]any{"data": list[0]})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+type blacklistEntry struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"` // account_number | bvn
+	Value     string    `json:"value"`
+	BankCode  *string   `json:"bankCode,omitempty"`
+	Action    string    `json:"action"` // block | flag
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// matchBlacklist returns the strongest entry matching a destination: any
+// block wins over a flag. ok is false when nothing matches.
+func (app *App) matchBlacklist(ctx context.Context, bankCode, accountNumber string, bvn *string) (blacklistEntry, bool, error) {
+	var e blacklistEntry
+	err := app.DB.QueryRow(ctx, `
+		SELECT id, kind, value, bank_code, action, reason, created_by, created_at
+		FROM destination_blacklist
+		WHERE (kind='account_number' AND value=$2 AND (bank_code IS NULL OR bank_code=$1))
+		   OR (kind='bvn' AND $3::text IS NOT NULL AND value=$3)
+		ORDER BY action='block' DESC, created_at
+		LIMIT 1
+	`, bankCode, accountNumber, bvn).Scan(&e.ID, &e.Kind, &e.Value, &e.BankCode, &e.Action, &e.Reason, &e.CreatedBy, &e.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return e, false, nil
+	}
+	return e, err == nil, err
+}
+
+// flagBlacklistMatch opens a fraud case for a flag-only blacklist hit.
+func (app *App) flagBlacklistMatch(ctx context.Context, userID, event, subjectType, subjectID string, e blacklistEntry) {
+	details, _ := json.Marshal(map[string]any{"blacklistId": e.ID, "kind": e.Kind, "reason": e.Reason})
+	if _, err := app.DB.Exec(ctx, `
+		INSERT INTO fraud_cases (user_id, rule_name, event, subject_type, subject_id, details)
+		VALUES ($1,'destination_blacklist',$2,$3,$4,$5::jsonb)
+	`, userID, event, subjectType, subjectID, string(details)); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("subject_id", subjectID).Msg("open blacklist fraud case failed")
+		return
+	}
+	app.raiseAlert(ctx, alert{
+		Name:    "fraud_rule_hit",
+		Message: "fraud rule hit; case opened for review",
+		Fields: map[string]any{"rule": "destination_blacklist", "action": "flag", "event": event,
+			"user_id": userID, "subject_type": subjectType, "subject_id": subjectID},
+	})
+}
+
+// ---------- Handlers (Admin) ----------
+
+// GET /v1/admin/blacklist?kind=&q=
+func (app *App) AdminListBlacklist(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT id, kind, value, bank_code, action, reason, created_by, created_at
+		FROM destination_blacklist
+		WHERE ($1 = '' OR kind = $1) AND ($2 = '' OR value LIKE $2 || '%')
+		ORDER BY created_at DESC
+		LIMIT 500
+	`, strings.TrimSpace(q.Get("kind")), strings.TrimSpace(q.Get("q")))
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []blacklistEntry{}
+	for rows.Next() {
+		var e blacklistEntry
+		if err := rows.Scan(&e.ID, &e.Kind, &e.Value, &e.BankCode, &e.Action, &e.Reason, &e.CreatedBy, &e.CreatedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, e)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// POST /v1/admin/blacklist  {"kind":"account_number|bvn","value":"...","bankCode":"...","action":"block|flag","reason":"..."}
+func (app *App) AdminCreateBlacklistEntry(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Kind     string  `json:"kind" validate:"required,oneof=account_number bvn"`
+		Value    string  `json:"value" validate:"required,numeric"`
+		BankCode *string `json:"bankCode,omitempty" validate:"omitempty,bankcode"`
+		Action   string  `json:"action" validate:"omitempty,oneof=block flag"`
+		Reason   string  `json:"reason" validate:"required,max=500"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if body.Action == "" {
+		body.Action = "block"
+	}
+	if body.Kind == "bvn" {
+		body.BankCode = nil
+	}
+
+	actor, _ := getUserID(r)
+	var e blacklistEntry
+	err := app.DB.QueryRow(r.Context(), `
+		INSERT INTO destination_blacklist (kind, value, bank_code, action, reason, created_by)
+		VALUES ($1,$2,$3,$4,$5,$6)
+		ON CONFLICT DO NOTHING
+		RETURNING id, kind, value, bank_code, action, reason, created_by, created_at
+	`, body.Kind, body.Value, body.BankCode, body.Action, body.Reason, actor).
+		Scan(&e.ID, &e.Kind, &e.Value, &e.BankCode, &e.Action, &e.Reason, &e.CreatedBy, &e.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusConflict, "already_blacklisted"))
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("create blacklist entry failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "blacklist.create",
+		TargetType: "blacklist",
+		TargetID:   e.ID,
+		After:      e,
+	})
+	writeJSON(w, http.StatusCreated, map[string]any{"data": e})
+}
+
+// DELETE /v1/admin/blacklist/{id}
+func (app *App) AdminDeleteBlacklistEntry(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var e blacklistEntry
+	err := app.DB.QueryRow(r.Context(), `
+		DELETE FROM destination_blacklist WHERE id=$1
+		RETURNING id, kind, value, bank_code, action, reason, created_by, created_at
+	`, id).Scan(&e.ID, &e.Kind, &e.Value, &e.BankCode, &e.Action, &e.Reason, &e.CreatedBy, &e.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "blacklist.delete",
+		TargetType: "blacklist",
+		TargetID:   id,
+		Before:     e,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"deleted": true}})
+}
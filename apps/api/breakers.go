@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/breaker"
+)
+
+// Circuit breakers around payment provider calls. When the provider keeps
+// failing, calls fail fast with breaker.ErrOpen instead of piling up
+// timeouts; the payout job defers itself until the breaker lets a probe
+// through, leaving the withdrawal approved and untouched.
+
+const (
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+	// every instance records its breakers here on each transition, so the
+	// admin view covers workers as well as API pods
+	breakerStateKey = "okies:breakers"
+)
+
+// newProviderBreaker returns a breaker that exports its state as a gauge,
+// alerts when it opens and publishes transitions to Redis.
+func (app *App) newProviderBreaker(name string) *breaker.Breaker {
+	b := breaker.New(name, breakerThreshold, breakerCooldown)
+	b.IsFailure = func(err error) bool {
+		// a bad request or our own cancellation says nothing about the provider
+		var rejected errTransferRejected
+		return !errors.As(err, &rejected) && !errors.Is(err, context.Canceled)
+	}
+	b.OnStateChange = func(b *breaker.Breaker, from, to breaker.State) {
+		setBreakerGauge(b.Name, to)
+		snap := b.Snapshot()
+		ev := log.Info()
+		if to == breaker.Open {
+			ev = log.Warn()
+		}
+		ev.Str("breaker", b.Name).Str("from", from.String()).Str("to", to.String()).Str("last_error", snap.LastError).Msg("circuit breaker state changed")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if to == breaker.Open && from == breaker.Closed {
+			app.raiseAlert(ctx, alert{
+				Name:     "provider_breaker_open",
+				Severity: "critical",
+				Message:  "payment provider calls are failing; circuit breaker opened",
+				Fields:   map[string]any{"breaker": b.Name, "error": snap.LastError},
+			})
+		}
+		if app.Redis != nil {
+			host, _ := os.Hostname()
+			raw, _ := json.Marshal(instanceBreaker{Snapshot: snap, Instance: host, UpdatedAt: time.Now().UTC()})
+			if err := app.Redis.HSet(ctx, breakerStateKey, b.Name+"|"+host, raw).Err(); err != nil {
+				log.Warn().Err(err).Str("breaker", b.Name).Msg("publish breaker state failed")
+			}
+		}
+	}
+	setBreakerGauge(name, breaker.Closed)
+	app.Breakers = append(app.Breakers, b)
+	return b
+}
+
+func setBreakerGauge(name string, s breaker.State) {
+	gauges.SetLabeled("okies_breaker_state", "Circuit breaker state: 0 closed, 1 half-open, 2 open.", float64(s), "name", name)
+}
+
+// guardFlutterwave wraps the live client in a breaker. The dry-run client
+// never fails, so it is left alone.
+func (app *App) guardFlutterwave() {
+	if _, ok := app.Flutterwave.(*flutterwaveHTTP); !ok {
+		return
+	}
+	app.Flutterwave = breakerFlutterwave{inner: app.Flutterwave, b: app.newProviderBreaker("flutterwave")}
+}
+
+type breakerFlutterwave struct {
+	inner FlutterwaveClient
+	b     *breaker.Breaker
+}
+
+func (f breakerFlutterwave) CreateTransfer(ctx context.Context, bankCode, accountNumber string, amount int64, currency, narration, reference, callbackURL string) error {
+	return f.b.Do(func() error {
+		return f.inner.CreateTransfer(ctx, bankCode, accountNumber, amount, currency, narration, reference, callbackURL)
+	})
+}
+
+func (f breakerFlutterwave) Banks(ctx context.Context, country string) ([]bank, error) {
+	var banks []bank
+	err := f.b.Do(func() (err error) {
+		banks, err = f.inner.Banks(ctx, country)
+		return err
+	})
+	return banks, err
+}
+
+func (f breakerFlutterwave) setSecretKey(key string) {
+	if k, ok := f.inner.(interface{ setSecretKey(string) }); ok {
+		k.setSecretKey(key)
+	}
+}
+
+func (f breakerFlutterwave) Balance(ctx context.Context, currency string) (int64, error) {
+	var bal int64
+	err := f.b.Do(func() (err error) {
+		bal, err = f.inner.Balance(ctx, currency)
+		return err
+	})
+	return bal, err
+}
+
+// ---------- Handlers (Admin) ----------
+
+type instanceBreaker struct {
+	breaker.Snapshot
+	Instance  string    `json:"instance"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// GET /v1/admin/breakers
+// This instance's breakers live, plus the last transition every other
+// instance reported.
+func (app *App) AdminListBreakers(w http.ResponseWriter, r *http.Request) {
+	local := make([]breaker.Snapshot, 0, len(app.Breakers))
+	for _, b := range app.Breakers {
+		local = append(local, b.Snapshot())
+	}
+	instances := []instanceBreaker{}
+	if app.Redis != nil {
+		all, err := app.Redis.HGetAll(r.Context(), breakerStateKey).Result()
+		if err != nil {
+			log.Ctx(r.Context()).Warn().Err(err).Msg("read breaker states failed")
+		}
+		for _, raw := range all {
+			var ib instanceBreaker
+			if json.Unmarshal([]byte(raw), &ib) == nil {
+				instances = append(instances, ib)
+			}
+		}
+		sort.Slice(instances, func(i, j int) bool {
+			if instances[i].Name != instances[j].Name {
+				return instances[i].Name < instances[j].Name
+			}
+			return instances[i].Instance < instances[j].Instance
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"local": local, "instances": instances}})
+}
+
+// POST /v1/admin/breakers/{name}/reset
+// Closes the breaker on this instance; others close on their next
+// successful probe.
+func (app *App) AdminResetBreaker(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(chi.URLParam(r, "name"))
+	for _, b := range app.Breakers {
+		if b.Name != name {
+			continue
+		}
+		before := b.Snapshot()
+		b.Reset()
+		app.audit(r, auditEntry{
+			Action:     "breaker.reset",
+			TargetType: "breaker",
+			TargetID:   name,
+			Before:     map[string]any{"state": before.State},
+			After:      map[string]any{"state": breaker.Closed.String()},
+		})
+		writeJSON(w, http.StatusOK, map[string]any{"data": b.Snapshot()})
+		return
+	}
+	apierror.Write(w, apierror.New(http.StatusNotFound, "breaker_not_found"))
+}
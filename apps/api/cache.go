@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/sudo-init-do/okies-backend/pkg/cache"
+)
+
+// Cached primary-key lookups. Wallet and system IDs never change once
+// created; user rows do, so they get a short TTL and every write to a cached
+// column calls invalidateUser after it commits.
+
+const (
+	userCacheTTL   = 30 * time.Second
+	walletCacheTTL = time.Hour
+)
+
+// cachedUser holds the user columns read on hot paths: the profile returned
+// by /auth/me and the status checks run on every authenticated request.
+type cachedUser struct {
+	ID              string     `json:"id"`
+	Email           string     `json:"email"`
+	Username        *string    `json:"username"`
+	DisplayName     *string    `json:"displayName"`
+	AvatarURL       *string    `json:"avatarUrl"`
+	Phone           *string    `json:"phone"`
+	Role            string     `json:"role"`
+	Status          string     `json:"status"`
+	StatusExpiresAt *time.Time `json:"statusExpiresAt"`
+	Frozen          bool       `json:"frozen"`
+	DeactivatedAt   *time.Time `json:"deactivatedAt"`
+	Language        *string    `json:"language"`
+	TimeZone        *string    `json:"timeZone"`
+	CurrencyDisplay string     `json:"currencyDisplay"`
+	Theme           string     `json:"theme"`
+	TokenVersion    int        `json:"tokenVersion"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+func userCacheKey(id string) string { return "user:" + id }
+
+func (app *App) userByID(ctx context.Context, id string) (cachedUser, error) {
+	return cache.Fetch(ctx, app.Cache, userCacheKey(id), userCacheTTL, func(ctx context.Context) (cachedUser, error) {
+		var u cachedUser
+		err := app.DB.QueryRow(ctx, `
+			SELECT id, email, username, display_name, avatar_url, phone, role, status, status_expires_at, frozen_at IS NOT NULL, deactivated_at, language, time_zone, currency_display, theme, token_version, created_at
+			FROM users WHERE id=$1
+		`, id).Scan(&u.ID, &u.Email, &u.Username, &u.DisplayName, &u.AvatarURL, &u.Phone, &u.Role, &u.Status, &u.StatusExpiresAt, &u.Frozen, &u.DeactivatedAt, &u.Language, &u.TimeZone, &u.CurrencyDisplay, &u.Theme, &u.TokenVersion, &u.CreatedAt)
+		return u, err
+	})
+}
+
+// invalidateUser drops cached user rows after a change to them commits.
+func (app *App) invalidateUser(ctx context.Context, ids ...string) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = userCacheKey(id)
+	}
+	app.Cache.Delete(ctx, keys...)
+}
+
+// walletIDForUser returns userID's wallet; for the system user, its first.
+func (app *App) walletIDForUser(ctx context.Context, userID string) (string, error) {
+	return cache.Fetch(ctx, app.Cache, "wallet:user:"+userID, walletCacheTTL, func(ctx context.Context) (string, error) {
+		var wid string
+		err := app.DB.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id=$1 AND COALESCE(shard,0)=0`, userID).Scan(&wid)
+		return wid, err
+	})
+}
+
+type systemAccount struct {
+	UserID  string   `json:"userId"`
+	Wallets []string `json:"wallets"` // by shard
+}
+
+// systemWallets returns the system user and all its wallets. Platform
+// postings are spread over them so that no one wallet row is locked by
+// every top-up and withdrawal (see migration 0057); summed, they are the
+// system wallet.
+func (app *App) systemWallets(ctx context.Context) (string, []string, error) {
+	acct, err := cache.Fetch(ctx, app.Cache, "system:wallets", walletCacheTTL, func(ctx context.Context) (systemAccount, error) {
+		var acct systemAccount
+		err := app.DB.QueryRow(ctx, `
+			SELECT u.id, array_agg(w.id::text ORDER BY w.shard) FROM users u JOIN wallets w ON w.user_id = u.id
+			WHERE u.email='system@okies.local'
+			GROUP BY u.id
+		`).Scan(&acct.UserID, &acct.Wallets)
+		return acct, err
+	})
+	return acct.UserID, acct.Wallets, err
+}
+
+// systemUserAndWallet returns the system user and one of its wallets,
+// picked at random, to post the system side of a transaction to.
+func (app *App) systemUserAndWallet(ctx context.Context) (string, string, error) {
+	uid, wids, err := app.systemWallets(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return uid, wids[rand.IntN(len(wids))], nil
+}
+
+// lockWalletsSQL locks the wallets in $1 in a fixed order, so concurrent
+// postings can't deadlock.
+const lockWalletsSQL = `SELECT id FROM wallets WHERE id = ANY($1) ORDER BY id FOR UPDATE`
+
+// lockWallets locks ids' wallet rows before a balance check. System
+// wallets are skipped: their balance is never checked, and locking them
+// would serialize every platform posting.
+func (app *App) lockWallets(ctx context.Context, tx pgx.Tx, ids ...string) error {
+	ids, err := app.lockableWallets(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, lockWalletsSQL, ids)
+	return err
+}
+
+// lockableWallets is ids without the system wallets.
+func (app *App) lockableWallets(ctx context.Context, ids ...string) ([]string, error) {
+	_, system, err := app.systemWallets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(slices.Clone(ids), func(id string) bool { return slices.Contains(system, id) }), nil
+}
+
+// platformWallets are the wallets nobody is owed: the system wallets and,
+// last, the migration wallet opening balances are credited from (see
+// user_import.go). Liability and per-user reports leave them out.
+func (app *App) platformWallets(ctx context.Context) ([]string, error) {
+	_, system, err := app.systemWallets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	migrationWid, err := cache.Fetch(ctx, app.Cache, "migration:wallet", walletCacheTTL, func(ctx context.Context) (string, error) {
+		return migrationWalletID(ctx, app.DB)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(slices.Clone(system), migrationWid), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/chaos"
+)
+
+// Chaos mode for resilience testing. With CHAOS_ENABLED set (refused in
+// production) a superadmin can switch on, for a bounded time, added latency
+// on API requests, failing Flutterwave calls and failing database queries,
+// to check that retries, the provider breaker and the refund paths behave.
+// Faults stop when the run expires or is cleared, on every instance.
+
+// how quickly other instances and workers pick up a change
+const chaosPollInterval = 5 * time.Second
+
+// chaosExempt keeps health checks, metrics and the chaos controls
+// themselves free of injected latency.
+func chaosExempt(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return true
+	}
+	return strings.HasPrefix(r.URL.Path, "/v1/admin/chaos")
+}
+
+// requireChaos answers 404 when chaos mode is not available on this deploy.
+func (app *App) requireChaos(w http.ResponseWriter) bool {
+	if app.Chaos == nil {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "chaos_disabled"))
+		return false
+	}
+	return true
+}
+
+// GET /v1/admin/chaos
+func (app *App) AdminGetChaos(w http.ResponseWriter, r *http.Request) {
+	if !app.requireChaos(w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"active": app.Chaos.Current()}})
+}
+
+// PUT /v1/admin/chaos
+// {"latencyPercent":20,"latencyMinMs":200,"latencyMaxMs":2000,
+// "providerPercent":30,"dbPercent":5,"durationMinutes":15}
+func (app *App) AdminSetChaos(w http.ResponseWriter, r *http.Request) {
+	if !app.requireChaos(w) {
+		return
+	}
+	var body struct {
+		LatencyPercent  float64 `json:"latencyPercent" validate:"min=0,max=100"`
+		LatencyMinMS    int     `json:"latencyMinMs" validate:"min=0,max=30000"`
+		LatencyMaxMS    int     `json:"latencyMaxMs" validate:"min=0,max=30000"`
+		ProviderPercent float64 `json:"providerPercent" validate:"min=0,max=100"`
+		DBPercent       float64 `json:"dbPercent" validate:"min=0,max=100"`
+		DurationMinutes int     `json:"durationMinutes" validate:"required,min=1,max=240"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if body.LatencyMaxMS < body.LatencyMinMS {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_latency_range"))
+		return
+	}
+	actor, _ := getUserID(r)
+	before := app.Chaos.Current()
+	cfg := chaos.Config{
+		LatencyPercent:  body.LatencyPercent,
+		LatencyMinMS:    body.LatencyMinMS,
+		LatencyMaxMS:    body.LatencyMaxMS,
+		ProviderPercent: body.ProviderPercent,
+		DBPercent:       body.DBPercent,
+		ExpiresAt:       time.Now().UTC().Add(time.Duration(body.DurationMinutes) * time.Minute).Truncate(time.Second),
+		SetBy:           actor,
+	}
+	if err := app.Chaos.Set(r.Context(), cfg); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("enable chaos mode failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "redis_error"))
+		return
+	}
+	app.audit(r, auditEntry{
+		Action:     "chaos.enable",
+		TargetType: "chaos",
+		TargetID:   "global",
+		Before:     before,
+		After:      cfg,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"active": cfg}})
+}
+
+// DELETE /v1/admin/chaos
+func (app *App) AdminClearChaos(w http.ResponseWriter, r *http.Request) {
+	if !app.requireChaos(w) {
+		return
+	}
+	before := app.Chaos.Current()
+	if err := app.Chaos.Clear(r.Context()); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("disable chaos mode failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "redis_error"))
+		return
+	}
+	app.audit(r, auditEntry{
+		Action:     "chaos.disable",
+		TargetType: "chaos",
+		TargetID:   "global",
+		Before:     before,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+)
+
+type dataRequestDTO struct {
+	ID          string          `json:"id"`
+	UserID      string          `json:"userId"`
+	Kind        string          `json:"kind"`
+	Status      string          `json:"status"`
+	Source      string          `json:"source"`
+	RequestedBy string          `json:"requestedBy"`
+	Reason      *string         `json:"reason,omitempty"`
+	Reference   *string         `json:"reference,omitempty"`
+	Evidence    json.RawMessage `json:"evidence,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty"`
+}
+
+const dataRequestCols = `id, user_id, kind, status, source, requested_by, reason, reference, evidence, created_at, completed_at`
+
+func scanDataRequest(row pgx.Row) (dataRequestDTO, error) {
+	var d dataRequestDTO
+	var evidence []byte
+	err := row.Scan(&d.ID, &d.UserID, &d.Kind, &d.Status, &d.Source, &d.RequestedBy,
+		&d.Reason, &d.Reference, &evidence, &d.CreatedAt, &d.CompletedAt)
+	d.Evidence = evidence
+	return d, err
+}
+
+// runDataRequest records a data request and executes it immediately. The
+// request row is kept whatever the outcome; a failed run returns both the
+// stored record and the error that stopped it.
+func (app *App) runDataRequest(ctx context.Context, userID, kind, source, requestedBy, reason, reference string) (dataRequestDTO, error) {
+	var id string
+	if err := app.DB.QueryRow(ctx, `
+		INSERT INTO data_requests (user_id, kind, source, requested_by, reason, reference)
+		VALUES ($1,$2,$3,$4,NULLIF($5,''),NULLIF($6,''))
+		RETURNING id
+	`, userID, kind, source, requestedBy, reason, reference).Scan(&id); err != nil {
+		return dataRequestDTO{}, err
+	}
+
+	var (
+		result   json.RawMessage
+		evidence = map[string]any{}
+		runErr   error
+	)
+	switch kind {
+	case "export":
+		var digest string
+		result, digest, runErr = app.exportUserData(ctx, userID)
+		if runErr == nil {
+			evidence["sha256"] = digest
+			evidence["bytes"] = len(result)
+		}
+	case "deletion":
+		var counts map[string]int64
+		counts, runErr = app.anonymizeUser(ctx, userID)
+		if runErr == nil {
+			evidence["rowsAffected"] = counts
+			evidence["retained"] = []string{"ledger_entries", "transactions", "payouts", "audit_logs"}
+		}
+	}
+
+	status := "completed"
+	if runErr != nil {
+		status = "failed"
+		evidence["error"] = dataRequestErrorCode(runErr)
+	}
+	ev, _ := json.Marshal(evidence)
+	d, err := scanDataRequest(app.DB.QueryRow(ctx, `
+		UPDATE data_requests
+		SET status=$2, result=$3::jsonb, evidence=$4::jsonb, completed_at=now()
+		WHERE id=$1
+		RETURNING `+dataRequestCols,
+		id, status, nullJSON(result), string(ev)))
+	if err != nil {
+		return d, err
+	}
+	return d, runErr
+}
+
+// POST /v1/admin/users/{id}/data-requests  {"kind":"export|deletion","reason":"...","reference":"..."}
+func (app *App) AdminCreateDataRequest(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimSpace(chi.URLParam(r, "id"))
+	var body struct {
+		Kind      string `json:"kind" validate:"required,oneof=export deletion"`
+		Reason    string `json:"reason" validate:"max=500"`
+		Reference string `json:"reference" validate:"required,max=200"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	actor, _ := getUserID(r)
+	if body.Kind == "deletion" && actor == userID {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "cannot_erase_self"))
+		return
+	}
+	var exists bool
+	if err := app.DB.QueryRow(r.Context(), `SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)`, userID).Scan(&exists); err != nil || !exists {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+
+	d, err := app.runDataRequest(r.Context(), userID, body.Kind, "admin", actor,
+		strings.TrimSpace(body.Reason), strings.TrimSpace(body.Reference))
+	if d.ID != "" {
+		app.audit(r, auditEntry{
+			Action:     "data_request." + body.Kind,
+			TargetType: "user",
+			TargetID:   userID,
+			After:      map[string]any{"dataRequestId": d.ID, "status": d.Status, "reference": body.Reference},
+		})
+	}
+	if err != nil {
+		code := dataRequestErrorCode(err)
+		if code == "db_error" {
+			log.Ctx(r.Context()).Error().Err(err).Str("user_id", userID).Str("kind", body.Kind).Msg("data request failed")
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, code))
+			return
+		}
+		e := apierror.Body(w, apierror.New(http.StatusConflict, code))
+		writeJSON(w, e.Status, map[string]any{"error": e, "data": d})
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"data": d})
+}
+
+// GET /v1/admin/data-requests?userId=&kind=&status=&limit=&cursor=
+func (app *App) AdminListDataRequests(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var (
+		where []string
+		args  []any
+	)
+	for _, f := range []struct{ param, col string }{{"userId", "user_id"}, {"kind", "kind"}, {"status", "status"}} {
+		if v := strings.TrimSpace(q.Get(f.param)); v != "" {
+			args = append(args, v)
+			where = append(where, fmt.Sprintf("%s = $%d", f.col, len(args)))
+		}
+	}
+	pg, ok := app.parsePage(w, r, "admin.data_requests", pagination.Admin)
+	if !ok {
+		return
+	}
+	if pg.After != nil {
+		args = append(args, pg.After.Time, pg.After.ID)
+		where = append(where, fmt.Sprintf("(created_at, id) < ($%d, $%d::uuid)", len(args)-1, len(args)))
+	}
+
+	sql := `SELECT ` + dataRequestCols + ` FROM data_requests`
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, pg.Limit+1)
+	sql += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := app.DB.Query(r.Context(), sql, args...)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []dataRequestDTO{}
+	for rows.Next() {
+		d, err := scanDataRequest(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, d)
+	}
+	out, paging := pagination.Trim(pg, out, func(d dataRequestDTO) pagination.Key { return pagination.Key{Time: d.CreatedAt, ID: d.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
+
+// GET /v1/admin/data-requests/{id}
+func (app *App) AdminGetDataRequest(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	d, err := scanDataRequest(app.DB.QueryRow(r.Context(), `SELECT `+dataRequestCols+` FROM data_requests WHERE id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": d})
+}
+
+// GET /v1/admin/data-requests/{id}/export — the export payload as a download
+func (app *App) AdminDownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var result []byte
+	err := app.DB.QueryRow(r.Context(), `
+		SELECT result FROM data_requests WHERE id=$1 AND kind='export' AND status='completed'
+	`, id).Scan(&result)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && len(result) == 0) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{Action: "data_request.download", TargetType: "data_request", TargetID: id})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="okies-data-export-`+id+`.json"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(result)
+}
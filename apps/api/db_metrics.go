@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	mydb "github.com/sudo-init-do/okies-backend/pkg/db"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+)
+
+// Database pool settings and observability. Every query is timed by the
+// mydb.QueryStats tracer; those slower than DB_SLOW_QUERY_MS are logged with
+// their caller, and the running totals per statement and caller, along with
+// pool saturation, are exported on /metrics.
+
+// poolOptions maps the DB_* pool settings onto the primary and replica pools.
+func poolOptions(c config.DBPool) mydb.PoolOptions {
+	return mydb.PoolOptions{
+		MaxConns:          c.MaxConns,
+		MinConns:          c.MinConns,
+		HealthCheckPeriod: c.HealthCheckPeriod,
+		ConnectTimeout:    c.ConnectTimeout,
+		StatementCache:    c.StatementCache,
+	}
+}
+
+// queryCaller names what issued a query: the route for requests, the job
+// kind for jobs, "background" for everything else.
+func queryCaller(ctx context.Context) string {
+	if rc := chi.RouteContext(ctx); rc != nil && rc.RoutePattern() != "" {
+		return rc.RouteMethod + " " + rc.RoutePattern()
+	}
+	if kind := jobs.KindFromContext(ctx); kind != "" {
+		return "job " + kind
+	}
+	return "background"
+}
+
+// exportQueryStats copies the query aggregates into gauges; it runs on
+// every scrape. The totals count from process start.
+func (app *App) exportQueryStats() {
+	if app.Queries == nil {
+		return
+	}
+	for _, family := range []string{"okies_db_queries", "okies_db_query_errors", "okies_db_query_rows", "okies_db_query_seconds_sum", "okies_db_query_seconds_max"} {
+		gauges.ResetFamily(family)
+	}
+	for k, a := range app.Queries.Snapshot() {
+		labels := []string{"query", k.Query, "caller", k.Caller}
+		gauges.SetLabeled("okies_db_queries", "Queries run since start, by statement and caller.", float64(a.Count), labels...)
+		gauges.SetLabeled("okies_db_query_errors", "Queries that failed since start.", float64(a.Errors), labels...)
+		gauges.SetLabeled("okies_db_query_rows", "Rows returned or affected since start.", float64(a.Rows), labels...)
+		gauges.SetLabeled("okies_db_query_seconds_sum", "Time spent in queries since start.", a.Total.Seconds(), labels...)
+		gauges.SetLabeled("okies_db_query_seconds_max", "Slowest single run since start.", a.Max.Seconds(), labels...)
+	}
+}
+
+// exportPoolStats reports how busy each pool is, to size DB_MAX_CONNS:
+// acquires that had to wait for a connection mean the pool is saturated.
+func (app *App) exportPoolStats() {
+	pools := map[string]*pgxpool.Pool{"primary": app.DB}
+	if app.Reads != nil && app.Reads.ReplicaPool() != nil {
+		pools["replica"] = app.Reads.ReplicaPool()
+	}
+	for name, pool := range pools {
+		st := pool.Stat()
+		gauges.SetLabeled("okies_db_pool_max_conns", "Configured pool size.", float64(st.MaxConns()), "pool", name)
+		gauges.SetLabeled("okies_db_pool_total_conns", "Open connections.", float64(st.TotalConns()), "pool", name)
+		gauges.SetLabeled("okies_db_pool_acquired_conns", "Connections in use.", float64(st.AcquiredConns()), "pool", name)
+		gauges.SetLabeled("okies_db_pool_idle_conns", "Idle connections.", float64(st.IdleConns()), "pool", name)
+		gauges.SetLabeled("okies_db_pool_acquires", "Connection acquires since start.", float64(st.AcquireCount()), "pool", name)
+		gauges.SetLabeled("okies_db_pool_waited_acquires", "Acquires since start that waited for a free connection.", float64(st.EmptyAcquireCount()), "pool", name)
+		gauges.SetLabeled("okies_db_pool_canceled_acquires", "Acquires since start given up before a connection freed.", float64(st.CanceledAcquireCount()), "pool", name)
+		gauges.SetLabeled("okies_db_pool_acquire_seconds_sum", "Time spent acquiring connections since start.", st.AcquireDuration().Seconds(), "pool", name)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
+)
+
+// Self-service deactivation, for owners who think someone else is in their
+// account. It ends every session and checkAccountActive then refuses the
+// account everywhere: no logins, no API calls, no money out. Money can
+// still come in. Only a one-time code sent to the account's email or
+// verified phone reactivates it, so a stolen password or session is not
+// enough to undo it.
+
+// POST /v1/users/me/deactivate  {"reason":"..."} (body optional)
+func (app *App) DeactivateMe(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		Reason string `json:"reason" validate:"max=500"`
+	}
+	if !decodeOptionalBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+
+	var at time.Time
+	if err := app.DB.QueryRow(ctx, `
+		UPDATE users SET deactivated_at = COALESCE(deactivated_at, now())
+		WHERE id=$1
+		RETURNING deactivated_at
+	`, uid).Scan(&at); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("deactivate account failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(ctx, uid)
+	if _, err := app.DB.Exec(ctx, `UPDATE refresh_tokens SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL`, uid); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("revoke sessions on deactivate failed")
+	}
+	data := map[string]any{}
+	if v := strings.TrimSpace(body.Reason); v != "" {
+		data["reason"] = v
+	}
+	app.recordSecurityEvent(r, uid, secDeactivated, data)
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"deactivatedAt": at}})
+}
+
+// POST /v1/auth/reactivate  {"email":"..."} or {"phone":"0803 123 4567"}
+// Sends a reactivation code to the email address or verified number of a
+// deactivated account. The response is the same whether or not there is
+// one.
+func (app *App) RequestReactivation(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email" validate:"omitempty,email,max=254"`
+		Phone string `json:"phone" validate:"omitempty,phone"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if (body.Email == "") == (body.Phone == "") {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "email_or_phone_required"))
+		return
+	}
+	ctx := r.Context()
+
+	var (
+		uid string
+		err error
+	)
+	if body.Phone != "" {
+		if app.SMS == nil {
+			apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "sms_unavailable"))
+			return
+		}
+		body.Phone, _ = validate.Phone(body.Phone)
+		err = app.DB.QueryRow(ctx, `SELECT id FROM users WHERE phone=$1 AND deactivated_at IS NOT NULL`, body.Phone).Scan(&uid)
+	} else {
+		if app.Mailer == nil {
+			apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "email_unavailable"))
+			return
+		}
+		body.Email = strings.ToLower(strings.TrimSpace(body.Email))
+		err = app.DB.QueryRow(ctx, `
+			SELECT id FROM users WHERE email=$1 AND deactivated_at IS NOT NULL AND anonymized_at IS NULL
+		`, body.Email).Scan(&uid)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		// a challenge that can never be confirmed
+		writeJSON(w, http.StatusAccepted, map[string]any{"data": map[string]any{"challengeId": uuid.NewString()}})
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	var id string
+	if body.Phone != "" {
+		id, _, err = app.issueOTP(ctx, uid, body.Phone, otpReactivate)
+	} else {
+		id, _, err = app.issueEmailOTP(ctx, uid, body.Email, otpReactivate)
+	}
+	if err != nil {
+		e := otpAPIError(err)
+		if e.Status == http.StatusInternalServerError {
+			log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("issue reactivation code failed")
+		}
+		apierror.Write(w, e)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"data": map[string]any{"challengeId": id}})
+}
+
+// POST /v1/auth/reactivate/verify  {"challengeId":"...","code":"123456"}
+// Reactivates the account and logs in like /v1/auth/login. A pending
+// deletion is cancelled.
+func (app *App) VerifyReactivation(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ChallengeID string `json:"challengeId" validate:"required"`
+		Code        string `json:"code" validate:"required,len=6,numeric"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+	c, err := app.checkOTP(ctx, body.ChallengeID, otpReactivate, body.Code)
+	if err == nil && c.UserID == nil {
+		err = errOTPInvalid
+	}
+	if err != nil {
+		apierror.Write(w, otpAPIError(err))
+		return
+	}
+	uid := *c.UserID
+
+	// a number that moved to another account since the code was sent no
+	// longer speaks for this one
+	tag, err := app.DB.Exec(ctx, `
+		UPDATE users SET deactivated_at = NULL, deletion_scheduled_at = NULL
+		WHERE id=$1 AND deactivated_at IS NOT NULL AND ($2 = '' OR phone = $2)
+	`, uid, c.Phone)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("reactivate account failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		apierror.Write(w, otpAPIError(errOTPInvalid))
+		return
+	}
+	app.invalidateUser(ctx, uid)
+	channel := "email"
+	if c.Phone != "" {
+		channel = "phone"
+	}
+	app.recordSecurityEvent(r, uid, secReactivated, map[string]any{"channel": channel})
+
+	// an admin suspension or ban still applies
+	if accountStatusError(w, app.checkAccountActive(ctx, uid)) {
+		return
+	}
+	u, err := app.userByID(ctx, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	tokens, err := app.issueTokens(r, uid, u.Role)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("issueTokens failed (reactivate)")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_issue_error"))
+		return
+	}
+	app.recordSecurityEvent(r, uid, secLogin, map[string]any{"method": "reactivate"})
+	writeJSON(w, http.StatusOK, authResp{Tokens: tokens, User: app.loadUser(r, uid)})
+}
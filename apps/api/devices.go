@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+	"github.com/sudo-init-do/okies-backend/pkg/push"
+)
+
+// Push notifications. Transactional notices go through notifyPush, which
+// stores the in-app notification and queues one push.send job per device,
+// so a slow or failing provider never holds up the event that caused it.
+
+const jobPushSend = "push.send" // {"deviceId","kind","lang","currency","data"}
+
+// newPushSenders builds a sender per platform that has credentials.
+func newPushSenders(cfg config.Push) push.Senders {
+	client := httpclient.New("push", httpclient.Options{Retries: 2})
+	s := push.Senders{}
+	if cfg.FCMCredentials != nil {
+		if fcm, err := push.NewFCM(cfg.FCMCredentials, client); err != nil {
+			log.Error().Err(err).Msg("fcm not configured")
+		} else {
+			s["android"] = fcm
+		}
+	}
+	if cfg.APNsKey != nil {
+		if apns, err := push.NewAPNs(cfg.APNsKey, cfg.APNsKeyID, cfg.APNsTeamID, cfg.APNsTopic, cfg.APNsProduction, client); err != nil {
+			log.Error().Err(err).Msg("apns not configured")
+		} else {
+			s["ios"] = apns
+		}
+	}
+	return s
+}
+
+// notifyPush records an in-app notification rendered from the push template
+// for kind, and queues it to each of the user's devices, all in the user's
+// language and currency display.
+func (app *App) notifyPush(ctx context.Context, userID, kind string, data map[string]any) {
+	prefs := app.userPreferences(ctx, userID)
+	if !app.storeNotification(ctx, userID, prefs, kind, data) {
+		return
+	}
+
+	rows, err := app.DB.Query(ctx, `SELECT id FROM devices WHERE user_id=$1`, userID)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", userID).Msg("list devices failed")
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	for _, id := range ids {
+		if err := jobs.Enqueue(ctx, app.DB, jobPushSend,
+			map[string]any{"deviceId": id, "kind": kind, "lang": prefs.language(), "currency": prefs.CurrencyDisplay, "data": data},
+			jobs.Options{MaxAttempts: 5}); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("device_id", id).Msg("enqueue push failed")
+		}
+	}
+}
+
+// sendPushJob delivers one notification to one device. Tokens the provider
+// rejects are deleted; a device removed meanwhile is skipped.
+func (app *App) sendPushJob(ctx context.Context, job *jobs.Job) error {
+	var p struct {
+		DeviceID string         `json:"deviceId"`
+		Kind     string         `json:"kind"`
+		Lang     string         `json:"lang"`
+		Currency string         `json:"currency"` // absent from older jobs
+		Data     map[string]any `json:"data"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+	var platform, token string
+	err := app.DB.QueryRow(ctx, `SELECT platform, token FROM devices WHERE id=$1`, p.DeviceID).Scan(&platform, &token)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m, err := push.Render(p.Kind, p.Lang, p.Currency, p.Data)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	err = app.Push.Send(ctx, platform, token, m)
+	switch {
+	case errors.Is(err, push.ErrInvalidToken):
+		if _, err := app.DB.Exec(ctx, `DELETE FROM devices WHERE id=$1`, p.DeviceID); err != nil {
+			return err
+		}
+		log.Ctx(ctx).Info().Str("device_id", p.DeviceID).Str("platform", platform).Msg("removed invalid push token")
+		return nil
+	case errors.Is(err, push.ErrNoSender):
+		return nil
+	}
+	return err
+}
+
+// ---------- Handlers (User) ----------
+
+type deviceDTO struct {
+	ID         string    `json:"id"`
+	Platform   string    `json:"platform"`
+	AppVersion *string   `json:"appVersion,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+// POST /v1/devices  {"platform":"android|ios","token":"...","appVersion":"1.4.0"}
+// Registering a known token moves it to the caller and refreshes it.
+func (app *App) RegisterDevice(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		Platform   string `json:"platform" validate:"required,oneof=android ios"`
+		Token      string `json:"token" validate:"required,max=4096"`
+		AppVersion string `json:"appVersion,omitempty" validate:"max=32"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	var d deviceDTO
+	if err := app.DB.QueryRow(r.Context(), `
+		INSERT INTO devices (user_id, platform, token, app_version)
+		VALUES ($1,$2,$3,NULLIF($4,''))
+		ON CONFLICT (token) DO UPDATE SET
+		  previous_user_id = CASE WHEN devices.user_id <> EXCLUDED.user_id THEN devices.user_id ELSE devices.previous_user_id END,
+		  user_id = EXCLUDED.user_id, platform = EXCLUDED.platform,
+		  app_version = EXCLUDED.app_version, last_seen_at = now()
+		RETURNING id, platform, app_version, created_at, last_seen_at
+	`, uid, body.Platform, strings.TrimSpace(body.Token), body.AppVersion).
+		Scan(&d.ID, &d.Platform, &d.AppVersion, &d.CreatedAt, &d.LastSeenAt); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": d})
+}
+
+// GET /v1/devices
+func (app *App) ListDevices(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT id, platform, app_version, created_at, last_seen_at
+		FROM devices WHERE user_id=$1 ORDER BY last_seen_at DESC
+	`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []deviceDTO{}
+	for rows.Next() {
+		var d deviceDTO
+		if err := rows.Scan(&d.ID, &d.Platform, &d.AppVersion, &d.CreatedAt, &d.LastSeenAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, d)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// DELETE /v1/devices/{id} — e.g. on logout
+func (app *App) DeleteDevice(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	tag, err := app.DB.Exec(r.Context(), `DELETE FROM devices WHERE id=$1 AND user_id=$2`, id, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "device_not_found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"deleted": true}})
+}
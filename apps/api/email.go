@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+	"github.com/sudo-init-do/okies-backend/pkg/mailer"
+)
+
+// Email. sendEmail queues an email.send job; the job looks up the address
+// and the user's preferences at send time, so an opt-out or erasure that
+// lands while the job waits is still honoured.
+
+const jobEmailSend = "email.send" // {"userId","template","data"}
+
+// newMailer returns nil when no driver is configured.
+func newMailer(cfg config.Mail) *mailer.Mailer {
+	client := httpclient.New("mail_"+cfg.Driver, httpclient.Options{Timeout: 15 * time.Second, Retries: 2})
+	var d mailer.Driver
+	switch cfg.Driver {
+	case "smtp":
+		d = &mailer.SMTP{Host: cfg.SMTPHost, Port: cfg.SMTPPort, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}
+	case "sendgrid":
+		d = &mailer.SendGrid{APIKey: cfg.SendGridAPIKey, Client: client}
+	case "ses":
+		d = &mailer.SES{Region: cfg.SESRegion, AccessKeyID: cfg.AWSAccessKeyID, SecretAccessKey: cfg.AWSSecretAccessKey, Client: client}
+	default:
+		return nil
+	}
+	return mailer.New(cfg.From, d)
+}
+
+// sendEmail queues the named template to userID. Failures are logged; email
+// never blocks the action that triggered it.
+func (app *App) sendEmail(ctx context.Context, userID, template string, data map[string]any) {
+	if mailer.Category(template) == "" {
+		log.Ctx(ctx).Error().Str("template", template).Msg("unknown email template")
+		return
+	}
+	if err := jobs.Enqueue(ctx, app.DB, jobEmailSend,
+		map[string]any{"userId": userID, "template": template, "data": data},
+		jobs.Options{MaxAttempts: 6}); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", userID).Str("template", template).Msg("enqueue email failed")
+	}
+}
+
+func (app *App) sendEmailJob(ctx context.Context, job *jobs.Job) error {
+	var p struct {
+		UserID   string         `json:"userId"`
+		Template string         `json:"template"`
+		Data     map[string]any `json:"data"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+	if app.Mailer == nil {
+		return nil
+	}
+
+	var (
+		email, name, currency    string
+		erased                   bool
+		transactions, statements bool
+	)
+	err := app.DB.QueryRow(ctx, `
+		SELECT u.email, COALESCE(u.display_name, u.username, ''), u.currency_display, u.anonymized_at IS NOT NULL,
+		       COALESCE(ep.transactions, true), COALESCE(ep.statements, true)
+		FROM users u LEFT JOIN email_preferences ep ON ep.user_id = u.id
+		WHERE u.id=$1
+	`, p.UserID).Scan(&email, &name, &currency, &erased, &transactions, &statements)
+	if errors.Is(err, pgx.ErrNoRows) || erased {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch mailer.Category(p.Template) {
+	case mailer.CategoryTransactions:
+		if !transactions {
+			return nil
+		}
+	case mailer.CategoryStatements:
+		if !statements {
+			return nil
+		}
+	}
+
+	if p.Data == nil {
+		p.Data = map[string]any{}
+	}
+	p.Data["name"] = name
+	m, err := mailer.Render(p.Template, email, currency, p.Data)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if err := app.Mailer.Send(ctx, m); err != nil {
+		if errors.Is(err, mailer.ErrRejected) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// ---------- Handlers (User) ----------
+
+type emailPreferences struct {
+	Transactions bool `json:"transactions"`
+	Statements   bool `json:"statements"`
+}
+
+// GET /v1/email-preferences
+func (app *App) GetEmailPreferences(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	prefs := emailPreferences{Transactions: true, Statements: true}
+	err := app.DB.QueryRow(r.Context(), `
+		SELECT transactions, statements FROM email_preferences WHERE user_id=$1
+	`, uid).Scan(&prefs.Transactions, &prefs.Statements)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": prefs})
+}
+
+// PUT /v1/email-preferences  {"transactions":true,"statements":false}
+// Security and account email cannot be turned off.
+func (app *App) UpdateEmailPreferences(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		Transactions *bool `json:"transactions" validate:"required"`
+		Statements   *bool `json:"statements" validate:"required"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if _, err := app.DB.Exec(r.Context(), `
+		INSERT INTO email_preferences (user_id, transactions, statements)
+		VALUES ($1,$2,$3)
+		ON CONFLICT (user_id) DO UPDATE SET
+		  transactions = EXCLUDED.transactions, statements = EXCLUDED.statements, updated_at = now()
+	`, uid, *body.Transactions, *body.Statements); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": emailPreferences{Transactions: *body.Transactions, Statements: *body.Statements}})
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/sudo-init-do/okies-backend/pkg/awsv4"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	mydb "github.com/sudo-init-do/okies-backend/pkg/db"
+	"github.com/sudo-init-do/okies-backend/pkg/envelope"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+)
+
+// Bank account numbers and BVNs on payout_destinations are stored sealed
+// (pkg/envelope). Next to them are keyed hashes for duplicate and lookup
+// checks, and the account's last four digits, so listings and support views
+// never decrypt. Only blacklist screening, the transfer itself and the
+// owner's data export open them.
+
+func newSealer(cfg config.Encryption) (*envelope.Sealer, error) {
+	var p envelope.KeyProvider
+	switch cfg.Provider {
+	case "kms":
+		p = &envelope.KMS{
+			Key:    cfg.KMSKeyID,
+			Creds:  awsv4.Credentials{Region: cfg.KMSRegion, AccessKeyID: cfg.AWSAccessKeyID, SecretAccessKey: cfg.AWSSecretAccessKey},
+			Client: httpclient.New("kms", httpclient.Options{Timeout: 5 * time.Second}),
+		}
+	default:
+		local, err := envelope.NewLocal(cfg.LocalActive, cfg.LocalKeys)
+		if err != nil {
+			return nil, err
+		}
+		p = local
+	}
+	return envelope.New(p, cfg.IndexKey), nil
+}
+
+// maskAccount renders an account number for display from its last digits.
+func maskAccount(last4 string) string { return "****" + last4 }
+
+type sealedDestination struct {
+	AccountNumber string
+	AccountHash   string
+	AccountLast4  string
+	BVN           *string
+	BVNHash       *string
+}
+
+func (app *App) sealDestination(ctx context.Context, accountNumber string, bvn *string) (sealedDestination, error) {
+	return sealDestination(ctx, app.Sealer, accountNumber, bvn)
+}
+
+func sealDestination(ctx context.Context, s *envelope.Sealer, accountNumber string, bvn *string) (sealedDestination, error) {
+	d := sealedDestination{AccountHash: s.Index(accountNumber), AccountLast4: last4(accountNumber)}
+	var err error
+	if d.AccountNumber, err = s.Seal(ctx, accountNumber); err != nil {
+		return d, err
+	}
+	if bvn != nil {
+		sealed, err := s.Seal(ctx, *bvn)
+		if err != nil {
+			return d, err
+		}
+		hash := s.Index(*bvn)
+		d.BVN, d.BVNHash = &sealed, &hash
+	}
+	return d, nil
+}
+
+// openDestination decrypts a stored account number and BVN.
+func (app *App) openDestination(ctx context.Context, accountNumber string, bvn *string) (string, *string, error) {
+	plain, err := app.Sealer.Open(ctx, accountNumber)
+	if err != nil || bvn == nil {
+		return plain, nil, err
+	}
+	b, err := app.Sealer.Open(ctx, *bvn)
+	return plain, &b, err
+}
+
+func last4(s string) string {
+	if len(s) <= 4 {
+		return s
+	}
+	return s[len(s)-4:]
+}
+
+// ---------- api rekey ----------
+
+const rekeyUsage = `usage: api rekey [-all] [-decrypt]
+
+Reseals payout destination account numbers and BVNs that are stored in
+plaintext (saved before encryption) or under a master key other than the
+current one, and recomputes their lookup hashes. Run it after rotating the
+master key; retire the old key once it reports nothing left to reseal.
+
+  -all       reseal every row, e.g. after changing ENCRYPTION_INDEX_KEY
+  -decrypt   write the values back in plaintext, before rolling back
+             migration 0037`
+
+// runRekeyCommand implements `api rekey` and returns the exit code.
+func runRekeyCommand(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("rekey", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, rekeyUsage) }
+	all := fs.Bool("all", false, "reseal every row")
+	decrypt := fs.Bool("decrypt", false, "store plaintext instead")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	sealer, err := newSealer(cfg.Encryption)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rekey:", err)
+		return 1
+	}
+	ctx := context.Background()
+	pool, err := mydb.OpenPool(ctx, cfg.DatabaseURL, poolOptions(cfg.DBPool))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rekey:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	var resealed, skipped, conflicts int
+	after := ""
+	for {
+		rows, err := pool.Query(ctx, `
+			SELECT d.id::text, d.account_number, d.bvn, d.account_number_hash IS NULL
+			FROM payout_destinations d JOIN users u ON u.id = d.user_id
+			WHERE d.id::text > $1 AND u.anonymized_at IS NULL
+			ORDER BY d.id::text LIMIT 500
+		`, after)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "rekey:", err)
+			return 1
+		}
+		type row struct {
+			id, account string
+			bvn         *string
+			unhashed    bool
+		}
+		batch, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (row, error) {
+			var x row
+			return x, r.Scan(&x.id, &x.account, &x.bvn, &x.unhashed)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "rekey:", err)
+			return 1
+		}
+		if len(batch) == 0 {
+			break
+		}
+		after = batch[len(batch)-1].id
+
+		for _, x := range batch {
+			stale := *all || x.unhashed || sealer.Stale(x.account) || (x.bvn != nil && sealer.Stale(*x.bvn))
+			if *decrypt {
+				stale = envelope.IsSealed(x.account) || (x.bvn != nil && envelope.IsSealed(*x.bvn))
+			}
+			if !stale {
+				skipped++
+				continue
+			}
+			account, err := sealer.Open(ctx, x.account)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "rekey: %s: %v\n", x.id, err)
+				return 1
+			}
+			var bvn *string
+			if x.bvn != nil {
+				b, err := sealer.Open(ctx, *x.bvn)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "rekey: %s: %v\n", x.id, err)
+					return 1
+				}
+				bvn = &b
+			}
+			d := sealedDestination{AccountNumber: account, AccountHash: sealer.Index(account), AccountLast4: last4(account), BVN: bvn}
+			if !*decrypt {
+				if d, err = sealDestination(ctx, sealer, account, bvn); err != nil {
+					fmt.Fprintf(os.Stderr, "rekey: %s: %v\n", x.id, err)
+					return 1
+				}
+			}
+			// only if nobody changed the row since it was read
+			_, err = pool.Exec(ctx, `
+				UPDATE payout_destinations
+				SET account_number=$2, account_number_hash=$3, account_last4=$4, bvn=$5, bvn_hash=$6
+				WHERE id=$1 AND account_number=$7 AND bvn IS NOT DISTINCT FROM $8
+			`, x.id, d.AccountNumber, d.AccountHash, d.AccountLast4, d.BVN, d.BVNHash, x.account, x.bvn)
+			var pgErr interface{ SQLState() string }
+			if errors.As(err, &pgErr) && pgErr.SQLState() == "23505" {
+				// a plaintext row duplicating one saved since encryption;
+				// leave it for support to merge
+				fmt.Fprintf(os.Stderr, "rekey: %s: duplicates another live destination, skipped\n", x.id)
+				conflicts++
+				continue
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "rekey: %s: %v\n", x.id, err)
+				return 1
+			}
+			resealed++
+		}
+	}
+	fmt.Printf("resealed: %d unchanged: %d duplicates: %d\n", resealed, skipped, conflicts)
+	if conflicts > 0 {
+		return 1
+	}
+	return 0
+}
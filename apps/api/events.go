@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/events"
+)
+
+// Domain events. Handlers publish after commit; the subscribers below carry
+// the side effects that used to be inlined in each handler.
+
+const (
+	evGiftCreated        = "gift.created"
+	evWithdrawalApproved = "withdrawal.approved"
+	evDepositSettled     = "deposit.settled"
+	evWithdrawalSettled  = "withdrawal.settled"
+	evUserSignedUp       = "user.signed_up"
+)
+
+type userSignedUp struct {
+	UserID     string `json:"userId"`
+	ReferrerID string `json:"referrerId,omitempty"`
+}
+
+type giftCreated struct {
+	GiftID      string `json:"giftId"` // transaction ID, or held gift ID when Held
+	SenderID    string `json:"senderId"`
+	RecipientID string `json:"recipientId"`
+	Amount      int64  `json:"amount"`
+	Held        bool   `json:"held"`
+}
+
+type withdrawalApproved struct {
+	PayoutID  string   `json:"payoutId"`
+	UserID    string   `json:"userId"`
+	Amount    int64    `json:"amount"`
+	Reference string   `json:"reference"`
+	Approvers []string `json:"approvers"`
+}
+
+// withdrawalSettled is a payout reaching a terminal provider outcome.
+type withdrawalSettled struct {
+	PayoutID  string `json:"payoutId"`
+	UserID    string `json:"userId"`
+	Amount    int64  `json:"amount"`
+	Reference string `json:"reference"`
+	Status    string `json:"status"` // succeeded | failed
+	Refunded  bool   `json:"refunded"`
+}
+
+type depositSettled struct {
+	TxID      string `json:"txId"`
+	UserID    string `json:"userId"`
+	Amount    int64  `json:"amount"`
+	Source    string `json:"source"` // admin_topup | bulk_topup | direct_debit
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// registerSubscribers wires the notification, email, fraud, referral,
+// partner webhook and analytics modules to the bus.
+func (app *App) registerSubscribers() {
+	b := app.Events
+
+	// notifications (in-app and push)
+	b.Subscribe(evGiftCreated, func(ctx context.Context, e events.Event) {
+		var g giftCreated
+		if decodeEvent(e, &g) && !g.Held {
+			app.notifyPush(ctx, g.RecipientID, "gift_received",
+				map[string]any{"giftId": g.GiftID, "senderId": g.SenderID, "amount": g.Amount})
+		}
+	})
+	b.Subscribe(evWithdrawalApproved, func(ctx context.Context, e events.Event) {
+		var p withdrawalApproved
+		if decodeEvent(e, &p) {
+			app.notifyPush(ctx, p.UserID, "withdrawal_approved",
+				map[string]any{"payoutId": p.PayoutID, "reference": p.Reference, "amount": p.Amount})
+		}
+	})
+	b.Subscribe(evWithdrawalSettled, func(ctx context.Context, e events.Event) {
+		var p withdrawalSettled
+		if decodeEvent(e, &p) {
+			app.notifyPush(ctx, p.UserID, "withdrawal_settled",
+				map[string]any{"payoutId": p.PayoutID, "reference": p.Reference, "amount": p.Amount, "status": p.Status, "refunded": p.Refunded})
+		}
+	})
+	b.Subscribe(evDepositSettled, func(ctx context.Context, e events.Event) {
+		var d depositSettled
+		if decodeEvent(e, &d) {
+			app.notifyPush(ctx, d.UserID, "deposit_settled", map[string]any{"txId": d.TxID, "amount": d.Amount})
+		}
+	})
+
+	// email
+	b.Subscribe(evUserSignedUp, func(ctx context.Context, e events.Event) {
+		var u userSignedUp
+		if decodeEvent(e, &u) {
+			app.sendEmail(ctx, u.UserID, "welcome", nil)
+		}
+	})
+	b.Subscribe(evGiftCreated, func(ctx context.Context, e events.Event) {
+		var g giftCreated
+		if decodeEvent(e, &g) && !g.Held {
+			app.sendEmail(ctx, g.SenderID, "receipt", map[string]any{"kind": "gift", "amount": g.Amount,
+				"reference": g.GiftID, "at": e.At.In(app.userLocation(ctx, g.SenderID))})
+		}
+	})
+	b.Subscribe(evDepositSettled, func(ctx context.Context, e events.Event) {
+		var d depositSettled
+		if decodeEvent(e, &d) {
+			app.sendEmail(ctx, d.UserID, "receipt", map[string]any{"kind": "deposit", "amount": d.Amount,
+				"reference": d.TxID, "at": e.At.In(app.userLocation(ctx, d.UserID))})
+		}
+	})
+	b.Subscribe(evWithdrawalSettled, func(ctx context.Context, e events.Event) {
+		var p withdrawalSettled
+		if decodeEvent(e, &p) {
+			app.sendEmail(ctx, p.UserID, "withdrawal_settled",
+				map[string]any{"amount": p.Amount, "reference": p.Reference, "status": p.Status, "refunded": p.Refunded})
+		}
+	})
+
+	// fraud screening and referral rewards on deposits
+	b.Subscribe(evDepositSettled, func(ctx context.Context, e events.Event) {
+		var d depositSettled
+		if !decodeEvent(e, &d) {
+			return
+		}
+		app.screenFraud(ctx, fraudEvent{
+			Event: "deposit", UserID: d.UserID, Amount: d.Amount,
+			SubjectType: "transaction", SubjectID: d.TxID, IP: d.IP, UserAgent: d.UserAgent,
+		})
+		if err := app.rewardReferral(ctx, d); err != nil {
+			log.Error().Err(err).Str("user_id", d.UserID).Msg("referral reward failed")
+		}
+	})
+
+	// ops alerts; see alerts.go
+	b.Subscribe(evWithdrawalSettled, func(ctx context.Context, e events.Event) {
+		var p withdrawalSettled
+		if decodeEvent(e, &p) && p.Status == "failed" {
+			app.raiseAlert(ctx, alert{
+				Name:    "payout_failed",
+				Message: "withdrawal failed at the provider",
+				Fields: map[string]any{"payout_id": p.PayoutID, "reference": p.Reference, "amount": p.Amount,
+					"user_id": p.UserID, "refunded": p.Refunded},
+			})
+		}
+	})
+
+	// partner webhooks; see partner_webhooks.go
+	app.registerPartnerWebhookSubscribers()
+
+	// analytics
+	b.Subscribe(events.All, eventStats.record)
+
+	// real-time streams
+	app.registerStreamSubscribers()
+}
+
+func decodeEvent(e events.Event, v any) bool {
+	if err := e.Decode(v); err != nil {
+		log.Error().Err(err).Str("event", e.Name).Msg("decode event failed")
+		return false
+	}
+	return true
+}
+
+// eventStats counts published events and the value they moved, exported as
+// gauges since the registry has no counter type.
+var eventStats = &eventCounter{count: map[string]float64{}, amount: map[string]float64{}}
+
+type eventCounter struct {
+	mu     sync.Mutex
+	count  map[string]float64
+	amount map[string]float64
+}
+
+func (c *eventCounter) record(_ context.Context, e events.Event) {
+	var v struct {
+		Amount int64 `json:"amount"`
+	}
+	_ = e.Decode(&v)
+	c.mu.Lock()
+	c.count[e.Name]++
+	c.amount[e.Name] += float64(v.Amount)
+	n, amt := c.count[e.Name], c.amount[e.Name]
+	c.mu.Unlock()
+	gauges.SetLabeled("okies_events_total", "Domain events published by this instance.", n, "event", e.Name)
+	gauges.SetLabeled("okies_events_amount_kobo_total", "Value moved by published domain events.", amt, "event", e.Name)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// Float monitoring compares what we owe users against the cash backing it.
+//
+// The system wallet is the double-entry counterparty for top-ups, so its
+// balance is (roughly) the mirror image of user balances and says nothing
+// about cash on hand. The float is therefore the provider balance plus any
+// off-provider reserve (float.reserve_kobo, e.g. a settlement account). The
+// system wallet balance is still reported so drift between it and liabilities
+// is visible.
+
+type floatSnapshot struct {
+	UserBalances        int64     `json:"userBalances"`
+	Escrow              int64     `json:"escrow"` // held gifts, active vouchers, payouts in flight
+	Liabilities         int64     `json:"liabilities"`
+	SystemWalletBalance int64     `json:"systemWalletBalance"`
+	ProviderBalance     *int64    `json:"providerBalance"`
+	ProviderError       string    `json:"providerError,omitempty"`
+	Reserve             int64     `json:"reserve"`
+	Float               int64     `json:"float"`
+	Coverage            float64   `json:"coverage"` // float / liabilities
+	Threshold           float64   `json:"threshold"`
+	Healthy             bool      `json:"healthy"`
+	CheckedAt           time.Time `json:"checkedAt"`
+}
+
+// computeFloat takes a fresh liability/coverage reading. A provider outage is
+// not an error: coverage is computed from the reserve alone and the failure is
+// reported alongside.
+func (app *App) computeFloat(ctx context.Context) (floatSnapshot, error) {
+	s := floatSnapshot{
+		Threshold: app.Settings.Float64(ctx, settings.FloatMinCoverage),
+		Reserve:   app.Settings.Int64(ctx, settings.FloatReserveKobo),
+		CheckedAt: time.Now().UTC(),
+	}
+
+	platform, err := app.platformWallets(ctx)
+	if err != nil {
+		return s, err
+	}
+	_, system, err := app.systemWallets(ctx)
+	if err != nil {
+		return s, err
+	}
+	if err := app.DB.QueryRow(ctx, `
+		SELECT
+		  COALESCE(SUM(CASE WHEN le.wallet_id <> ALL($1) THEN (CASE WHEN le.direction='credit' THEN le.amount ELSE -le.amount END) END),0),
+		  COALESCE(SUM(CASE WHEN le.wallet_id = ANY($2)  THEN (CASE WHEN le.direction='credit' THEN le.amount ELSE -le.amount END) END),0)
+		FROM ledger_entries le
+	`, platform, system).Scan(&s.UserBalances, &s.SystemWalletBalance); err != nil {
+		return s, err
+	}
+	if err := app.DB.QueryRow(ctx, `
+		SELECT
+		  (SELECT COALESCE(SUM(amount),0) FROM held_gifts WHERE status='held') +
+		  (SELECT COALESCE(SUM(remaining),0) FROM vouchers WHERE status='active') +
+		  (SELECT COALESCE(SUM(amount),0) FROM payouts WHERE status IN ('pending','approved','processing'))
+	`).Scan(&s.Escrow); err != nil {
+		return s, err
+	}
+	s.Liabilities = s.UserBalances + s.Escrow
+
+	s.Float = s.Reserve
+	pctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if bal, err := app.Flutterwave.Balance(pctx, "NGN"); err != nil {
+		s.ProviderError = err.Error()
+	} else {
+		s.ProviderBalance = &bal
+		s.Float += bal
+	}
+
+	if s.Liabilities <= 0 {
+		s.Coverage = 1
+	} else {
+		s.Coverage = float64(s.Float) / float64(s.Liabilities)
+	}
+	s.Healthy = s.Coverage >= s.Threshold
+	return s, nil
+}
+
+func recordFloatGauges(s floatSnapshot) {
+	gauges.Set("okies_float_liabilities_kobo", "User balances plus escrow owed to users.", float64(s.Liabilities))
+	gauges.Set("okies_float_assets_kobo", "Provider balance plus off-provider reserve.", float64(s.Float))
+	gauges.Set("okies_float_coverage_ratio", "Float divided by liabilities.", s.Coverage)
+	gauges.Set("okies_float_coverage_threshold", "Minimum acceptable coverage ratio.", s.Threshold)
+	provider := 1.0
+	if s.ProviderBalance == nil {
+		provider = 0
+	}
+	gauges.Set("okies_float_provider_up", "Whether the last provider balance lookup succeeded.", provider)
+}
+
+// runFloatMonitor samples coverage every interval, exports it as gauges and
+// raises an alert when coverage crosses below the threshold (and on recovery).
+func (app *App) runFloatMonitor(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	healthy := true
+	for {
+		s, err := app.computeFloat(ctx)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("float monitor failed")
+		} else {
+			recordFloatGauges(s)
+			switch {
+			case !s.Healthy && healthy:
+				app.raiseAlert(ctx, alert{
+					Name:     "float_coverage_low",
+					Severity: "critical",
+					Message:  "liability coverage below threshold",
+					Fields: map[string]any{
+						"coverage":       s.Coverage,
+						"threshold":      s.Threshold,
+						"liabilities":    s.Liabilities,
+						"float":          s.Float,
+						"provider_error": s.ProviderError,
+					},
+				})
+			case s.Healthy && !healthy:
+				log.Ctx(ctx).Info().Float64("coverage", s.Coverage).Msg("liability coverage recovered")
+			}
+			healthy = s.Healthy
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// GET /v1/admin/float
+func (app *App) AdminFloat(w http.ResponseWriter, r *http.Request) {
+	s, err := app.computeFloat(r.Context())
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("compute float failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	recordFloatGauges(s)
+	writeJSON(w, http.StatusOK, map[string]any{"data": s})
+}
@@ -1,40 +1,201 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
-	"os"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/chaos"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+	"github.com/sudo-init-do/okies-backend/pkg/redact"
 )
 
-// --- Minimal client placeholder (safe no-op until you wire real HTTP) ---
+// FlutterwaveClient is the provider API. Without a secret key the no-op
+// client is used and transfers are dry-run.
 type FlutterwaveClient interface {
 	CreateTransfer(ctx context.Context, bankCode, accountNumber string, amount int64, currency, narration, reference, callbackURL string) error
+	// Balance returns the available provider balance for currency, in kobo.
+	Balance(ctx context.Context, currency string) (int64, error)
+	// Banks lists the banks transfers can be sent to in country.
+	Banks(ctx context.Context, country string) ([]bank, error)
+}
+
+type bank struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
 }
 
+var errProviderUnconfigured = errors.New("flutterwave not configured")
+
 type noopFlutterwave struct{}
 
 func (noopFlutterwave) CreateTransfer(ctx context.Context, bankCode, accountNumber string, amount int64, currency, narration, reference, callbackURL string) error {
 	return nil
 }
 
-func NewFlutterwaveClient(baseURL, secretKey, encKey string) (FlutterwaveClient, error) {
+func (noopFlutterwave) Balance(ctx context.Context, currency string) (int64, error) {
+	return 0, errProviderUnconfigured
+}
+
+func (noopFlutterwave) Banks(ctx context.Context, country string) ([]bank, error) {
+	return nil, errProviderUnconfigured
+}
+
+// flutterwaveHTTP talks to the real API. It is only called from background
+// work (the payout.submit job, the float monitor), never from a handler that
+// changes state.
+type flutterwaveHTTP struct {
+	baseURL   string
+	secretKey atomic.Pointer[string] // swapped when FLW_SEC_KEY rotates
+	client    *http.Client
+}
+
+func (f *flutterwaveHTTP) setSecretKey(key string) { f.secretKey.Store(&key) }
+
+// errTransferRejected is a 4xx from the transfers API: the request itself
+// is bad (unknown bank, invalid account), so retrying can't help.
+type errTransferRejected struct{ msg string }
+
+func (e errTransferRejected) Error() string { return "flutterwave rejected transfer: " + e.msg }
+
+// POST /v3/transfers. reference is Flutterwave's idempotency key, so a retry
+// after a lost response does not pay twice.
+func (f *flutterwaveHTTP) CreateTransfer(ctx context.Context, bankCode, accountNumber string, amount int64, currency, narration, reference, callbackURL string) error {
+	payload, err := json.Marshal(map[string]any{
+		"account_bank":   bankCode,
+		"account_number": accountNumber,
+		"amount":         float64(amount) / 100, // API takes major units
+		"currency":       currency,
+		"debit_currency": currency,
+		"narration":      narration,
+		"reference":      reference,
+		"callback_url":   callbackURL,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.baseURL+"/v3/transfers", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+*f.secretKey.Load())
+	req.Header.Set("Content-Type", "application/json")
+	res, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var out struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&out)
+	switch {
+	case res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("flutterwave transfer: status %d", res.StatusCode)
+	case res.StatusCode >= 400:
+		return errTransferRejected{msg: out.Message}
+	case out.Status != "success":
+		return fmt.Errorf("flutterwave transfer: %s: %s", out.Status, out.Message)
+	}
+	return nil
+}
+
+// GET /v3/balances/{currency}
+func (f *flutterwaveHTTP) Balance(ctx context.Context, currency string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseURL+"/v3/balances/"+currency, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+*f.secretKey.Load())
+	res, err := f.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("flutterwave balance: status %d", res.StatusCode)
+	}
+	var out struct {
+		Status string `json:"status"`
+		Data   struct {
+			AvailableBalance float64 `json:"available_balance"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return 0, err
+	}
+	if out.Status != "success" {
+		return 0, fmt.Errorf("flutterwave balance: %s", out.Status)
+	}
+	// API reports major units (naira)
+	return int64(math.Round(out.Data.AvailableBalance * 100)), nil
+}
+
+// GET /v3/banks/{country}
+func (f *flutterwaveHTTP) Banks(ctx context.Context, country string) ([]bank, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseURL+"/v3/banks/"+country, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+*f.secretKey.Load())
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("flutterwave banks: status %d", res.StatusCode)
+	}
+	var out struct {
+		Status string `json:"status"`
+		Data   []bank `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if out.Status != "success" {
+		return nil, fmt.Errorf("flutterwave banks: %s", out.Status)
+	}
+	return out.Data, nil
+}
+
+// NewFlutterwaveClient returns the live client, or the dry-run client when no
+// secret key is set. faults may be nil; see chaos.go.
+func NewFlutterwaveClient(baseURL, secretKey, encKey string, faults *chaos.Injector) (FlutterwaveClient, error) {
 	if strings.TrimSpace(secretKey) == "" {
-		return noopFlutterwave{}, nil
+		return noopFlutterwave{}, errProviderUnconfigured
+	}
+	f := &flutterwaveHTTP{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  httpclient.New("flutterwave", httpclient.Options{Retries: 2, Faults: faults.Transport}),
 	}
-	return noopFlutterwave{}, nil
+	f.setSecretKey(secretKey)
+	return f, nil
 }
 
 // --- Webhook payload ---
 type flwWebhook struct {
 	Event string `json:"event"`
-	Data  struct {
+	// Timestamp is when the provider raised the event, in Unix
+	// milliseconds; older payloads don't carry it.
+	Timestamp int64 `json:"timestamp"`
+	Data      struct {
 		Reference string `json:"reference"`
 		Status    string `json:"status"`
 		Amount    int64  `json:"amount"`
@@ -43,60 +204,260 @@ type flwWebhook struct {
 }
 
 // POST /v1/webhooks/flutterwave
-// Verify with header `verif-hash` against env FLW_WEBHOOK_HASH.
-// Accepts either direct equality or HMAC-SHA256(secret, rawBody) as hex.
+// Verify with header `verif-hash` against FLW_WEBHOOK_HASH, or
+// FLW_WEBHOOK_HASH_PREVIOUS while it is being rotated. Accepts either direct
+// equality or HMAC-SHA256(secret, rawBody) as hex.
 func (app *App) FlutterwaveWebhook(w http.ResponseWriter, r *http.Request) {
-	secret := strings.TrimSpace(os.Getenv("FLW_WEBHOOK_HASH"))
+	secret := app.Secrets.Get(secretFLWWebhookHash)
+	previous := app.Secrets.Get(secretFLWWebhookHashPrevious)
 	verif := strings.TrimSpace(r.Header.Get("verif-hash"))
 	if secret == "" || verif == "" {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		apierror.Write(w, apierror.New(http.StatusForbidden, "forbidden"))
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBody))
 	if err != nil {
-		http.Error(w, "bad_payload", http.StatusBadRequest)
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "bad_payload"))
 		return
 	}
 	_ = r.Body.Close()
 
-	// direct match or HMAC
-	valid := (verif == secret)
-	if !valid {
-		mac := hmac.New(sha256.New, []byte(secret))
-		mac.Write(body)
-		sum := hex.EncodeToString(mac.Sum(nil))
-		valid = (verif == sum)
+	valid := verifyWebhookHash(verif, secret, body)
+	if !valid && previous != "" {
+		valid = verifyWebhookHash(verif, previous, body)
 	}
 	if !valid {
-		http.Error(w, "bad_signature", http.StatusForbidden)
+		app.alertBadWebhookSignature(r, "flutterwave")
+		apierror.Write(w, apierror.New(http.StatusForbidden, "bad_signature"))
 		return
 	}
 
 	var evt flwWebhook
 	if err := json.Unmarshal(body, &evt); err != nil {
-		http.Error(w, "bad_payload", http.StatusBadRequest)
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "bad_payload"))
+		return
+	}
+
+	// Store the delivery and queue it in one transaction, then ack. The
+	// worker applies it, so a slow or failing database write is retried by
+	// us rather than by the provider. The raw body is also kept for disputes
+	// until retention purges it: redacted, with the full copy behind the
+	// admin PII endpoint.
+	ctx := r.Context()
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
 		return
 	}
+	defer tx.Rollback(ctx)
 
-	// Handle transfer outcome
+	var providerAt *time.Time
+	if evt.Timestamp > 0 {
+		t := time.UnixMilli(evt.Timestamp)
+		providerAt = &t
+	}
+	var eventID string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO webhook_events (provider, event, reference, payload, payload_full, provider_at)
+		VALUES ('flutterwave', $1, NULLIF($2,''), $3::jsonb, $4::jsonb, $5)
+		RETURNING id
+	`, evt.Event, evt.Data.Reference, string(redact.JSON(body)), string(body), providerAt).Scan(&eventID); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("reference", evt.Data.Reference).Msg("store webhook event failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
 	if evt.Event == "transfer.completed" || evt.Event == "transfer.failed" {
+		if err := jobs.Enqueue(ctx, tx, jobFlutterwaveEvent, map[string]any{"eventId": eventID}, jobs.Options{}); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(`{"ok":true}`))
+}
+
+// settleBatch is how many transfer events one settlement pass takes.
+const settleBatch = 500
+
+// flutterwaveEventJob settles the transfer webhooks waiting to be applied.
+// A job is queued per event but settles whatever is pending, so during a
+// burst the first jobs work through the backlog in batches and the rest
+// find nothing left to do.
+func (app *App) flutterwaveEventJob(ctx context.Context, job *jobs.Job) error {
+	for {
+		n, err := app.settleTransferEvents(ctx)
+		if err != nil {
+			return err
+		}
+		if n < settleBatch {
+			return nil
+		}
+	}
+}
+
+// settleTransferEvents applies up to settleBatch pending transfer events
+// to their payouts and returns how many it took. Events are grouped by
+// reference and only the last to arrive is applied, with one UPDATE for the
+// whole batch. A payout moves from approved or processing to the event's
+// status; succeeded and failed are final, since the ledger has already
+// followed them (a failure is refunded). An event contradicting a settled
+// payout is left for someone to review rather than applied.
+func (app *App) settleTransferEvents(ctx context.Context) (int, error) {
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, COALESCE(reference,''), provider_at, payload_full
+		FROM webhook_events
+		WHERE provider='flutterwave' AND event IN ('transfer.completed','transfer.failed')
+		  AND processed_at IS NULL
+		ORDER BY received_at, id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, settleBatch)
+	if err != nil {
+		return 0, err
+	}
+	type transferEvent struct {
+		id, reference string
+		at            *time.Time
+		payload       []byte
+	}
+	var (
+		ids    []string
+		latest = map[string]transferEvent{}
+	)
+	for rows.Next() {
+		var e transferEvent
+		if err := rows.Scan(&e.id, &e.reference, &e.at, &e.payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, e.id)
+		if e.reference == "" || e.payload == nil {
+			log.Ctx(ctx).Warn().Str("event_id", e.id).Msg("transfer webhook without reference or payload; skipped")
+			continue
+		}
+		// rows come in arrival order, so the last one seen wins
+		latest[e.reference] = e
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var refs, statuses, redacted, full []string
+	var ats []*time.Time
+	for ref, e := range latest {
+		var evt flwWebhook
+		if err := json.Unmarshal(e.payload, &evt); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("event_id", e.id).Msg("unreadable transfer webhook; skipped")
+			continue
+		}
 		status := "succeeded"
 		if strings.ToUpper(evt.Data.Status) != "SUCCESSFUL" {
 			status = "failed"
 		}
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-		defer cancel()
-		if _, err := app.DB.Exec(ctx, `
-			UPDATE payouts
-			SET status = $1, updated_at = now()
-			WHERE reference = $2
-		`, status, evt.Data.Reference); err != nil {
-			http.Error(w, "db_error", http.StatusInternalServerError)
-			return
+		refs = append(refs, ref)
+		statuses = append(statuses, status)
+		ats = append(ats, e.at)
+		redacted = append(redacted, string(redact.JSON(e.payload)))
+		full = append(full, string(e.payload))
+	}
+
+	var settled []withdrawalSettled
+	rows, err = tx.Query(ctx, `
+		UPDATE payouts p
+		SET status = v.status, provider_response = v.response::jsonb, provider_response_full = v.response_full::jsonb,
+		    provider_event_at = v.provider_at, updated_at = now()
+		FROM unnest($1::text[], $2::text[], $3::timestamptz[], $4::text[], $5::text[])
+		       AS v (reference, status, provider_at, response, response_full)
+		WHERE p.reference = v.reference AND p.status IN ('approved','processing')
+		RETURNING p.id, p.user_id, p.amount, p.reference, p.status
+	`, refs, statuses, ats, redacted, full)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var s withdrawalSettled
+		if err := rows.Scan(&s.PayoutID, &s.UserID, &s.Amount, &s.Reference, &s.Status); err != nil {
+			rows.Close()
+			return 0, err
 		}
+		settled = append(settled, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
 	}
 
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(`{"ok":true}`))
+	// payouts just settled above match their event, so these were settled
+	// before this batch and the provider now says otherwise
+	type conflict struct{ payoutID, reference, status, event string }
+	var conflicts []conflict
+	rows, err = tx.Query(ctx, `
+		SELECT p.id, p.reference, p.status, v.status
+		FROM payouts p
+		JOIN unnest($1::text[], $2::text[]) AS v (reference, status) ON v.reference = p.reference
+		WHERE p.status IN ('succeeded','failed') AND p.status <> v.status
+	`, refs, statuses)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var c conflict
+		if err := rows.Scan(&c.payoutID, &c.reference, &c.status, &c.event); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		conflicts = append(conflicts, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE webhook_events SET processed_at = now() WHERE id = ANY($1)`, ids); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	for _, s := range settled {
+		app.Events.Publish(ctx, evWithdrawalSettled, s)
+	}
+	for _, c := range conflicts {
+		log.Ctx(ctx).Warn().Str("payout_id", c.payoutID).Str("status", c.status).Str("event_status", c.event).
+			Msg("provider event contradicts a settled payout; not applied")
+		app.raiseAlert(ctx, alert{
+			Name:     "payout_settlement_conflict",
+			Severity: "critical",
+			Message:  "provider reported a different outcome for a settled withdrawal; review it by hand",
+			Fields:   map[string]any{"payout_id": c.payoutID, "reference": c.reference, "status": c.status, "provider_status": c.event},
+		})
+	}
+	return len(ids), nil
+}
+
+// verifyWebhookHash reports whether verif is secret itself or the HMAC of
+// body under it.
+func verifyWebhookHash(verif, secret string, body []byte) bool {
+	if hmac.Equal([]byte(verif), []byte(secret)) {
+		return true
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal([]byte(verif), []byte(hex.EncodeToString(mac.Sum(nil))))
 }
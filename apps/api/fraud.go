@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// ---------- Types ----------
+
+// fraudEvent is a money movement submitted to the rules engine.
+type fraudEvent struct {
+	Event          string // gift | deposit | withdrawal
+	UserID         string // the user whose behaviour is being screened
+	Amount         int64
+	SubjectType    string // transaction | payout | held_gift
+	SubjectID      string
+	DestinationID  string // withdrawals only
+	CounterpartyID string // gifts: the recipient
+	IP             string
+	UserAgent      string
+
+	// Pending is set when screening runs before the movement is recorded, so
+	// windowed counts must add the event itself.
+	Pending bool
+}
+
+func fraudEventFromRequest(r *http.Request, event, userID string, amount int64, subjectType, subjectID string) fraudEvent {
+	return fraudEvent{
+		Event:       event,
+		UserID:      userID,
+		Amount:      amount,
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		IP:          clientIP(r),
+		UserAgent:   r.UserAgent(),
+	}
+}
+
+type fraudRule struct {
+	ID     string
+	Name   string
+	Event  string
+	Kind   string
+	Action string // flag | hold
+	Params fraudRuleParams
+}
+
+// fraudRuleParams is the union of all rule kinds' parameters; each kind reads
+// only the fields it needs.
+type fraudRuleParams struct {
+	MinAmount           int64 `json:"minAmount,omitempty"`
+	WindowMinutes       int   `json:"windowMinutes,omitempty"`
+	MaxCount            int64 `json:"maxCount,omitempty"`
+	MaxAmount           int64 `json:"maxAmount,omitempty"`
+	MaxEachAmount       int64 `json:"maxEachAmount,omitempty"`
+	DestinationAgeHours int   `json:"destinationAgeHours,omitempty"`
+	DeviceAgeHours      int   `json:"deviceAgeHours,omitempty"`
+}
+
+type fraudHit struct {
+	Rule    fraudRule
+	Details map[string]any
+}
+
+var errAccountFrozen = errors.New("account frozen")
+
+// ---------- Engine ----------
+
+func (app *App) loadFraudRules(ctx context.Context, event string) ([]fraudRule, error) {
+	rows, err := app.DB.Query(ctx, `
+		SELECT id, name, event, kind, action, params
+		FROM fraud_rules
+		WHERE enabled AND event=$1
+		ORDER BY name
+	`, event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []fraudRule
+	for rows.Next() {
+		var fr fraudRule
+		var raw []byte
+		if err := rows.Scan(&fr.ID, &fr.Name, &fr.Event, &fr.Kind, &fr.Action, &raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &fr.Params); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("rule", fr.Name).Msg("skipping fraud rule with bad params")
+			continue
+		}
+		out = append(out, fr)
+	}
+	return out, rows.Err()
+}
+
+// evaluateFraud runs every enabled rule for ev.Event and returns the ones that fire.
+func (app *App) evaluateFraud(ctx context.Context, ev fraudEvent) ([]fraudHit, error) {
+	rules, err := app.loadFraudRules(ctx, ev.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []fraudHit
+	for _, rule := range rules {
+		var details map[string]any
+		switch rule.Kind {
+		case "amount_threshold":
+			if rule.Params.MinAmount > 0 && ev.Amount >= rule.Params.MinAmount {
+				details = map[string]any{"amount": ev.Amount, "minAmount": rule.Params.MinAmount}
+			}
+		case "velocity":
+			details, err = app.checkVelocity(ctx, ev, rule.Params)
+		case "new_device_new_destination":
+			details, err = app.checkNewDeviceNewDestination(ctx, ev, rule.Params)
+		case "gift_fan_in":
+			details, err = app.checkGiftFanIn(ctx, ev, rule.Params)
+		case "circular_flow":
+			details, err = app.checkCircularFlow(ctx, ev, rule.Params)
+		}
+		if err != nil {
+			return hits, err
+		}
+		if details != nil {
+			hits = append(hits, fraudHit{Rule: rule, Details: details})
+		}
+	}
+	return hits, nil
+}
+
+func (app *App) checkVelocity(ctx context.Context, ev fraudEvent, p fraudRuleParams) (map[string]any, error) {
+	if p.WindowMinutes <= 0 {
+		return nil, nil
+	}
+	since := time.Now().Add(-time.Duration(p.WindowMinutes) * time.Minute)
+
+	var count, sum int64
+	var err error
+	switch ev.Event {
+	case "withdrawal":
+		err = app.DB.QueryRow(ctx, `
+			SELECT COUNT(*), COALESCE(SUM(amount),0) FROM payouts
+			WHERE user_id=$1 AND created_at >= $2
+		`, ev.UserID, since).Scan(&count, &sum)
+	default:
+		kinds, dir := []string{"gift"}, "debit"
+		if ev.Event == "deposit" {
+			kinds, dir = []string{"topup", "direct_debit"}, "credit"
+		}
+		err = app.DB.QueryRow(ctx, `
+			SELECT COUNT(*), COALESCE(SUM(t.amount),0)
+			FROM transactions t
+			JOIN ledger_entries le ON le.tx_id = t.id
+			JOIN wallets wl ON wl.id = le.wallet_id
+			WHERE wl.user_id=$1 AND t.kind = ANY($2) AND le.direction=$3 AND t.created_at >= $4
+		`, ev.UserID, kinds, dir, since).Scan(&count, &sum)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ev.Pending {
+		count, sum = count+1, sum+ev.Amount
+	}
+
+	if (p.MaxCount > 0 && count > p.MaxCount) || (p.MaxAmount > 0 && sum > p.MaxAmount) {
+		return map[string]any{
+			"windowMinutes": p.WindowMinutes,
+			"count":         count,
+			"amount":        sum,
+			"maxCount":      p.MaxCount,
+			"maxAmount":     p.MaxAmount,
+		}, nil
+	}
+	return nil, nil
+}
+
+func (app *App) checkNewDeviceNewDestination(ctx context.Context, ev fraudEvent, p fraudRuleParams) (map[string]any, error) {
+	if ev.DestinationID == "" {
+		return nil, nil
+	}
+	var destCreated time.Time
+	if err := app.DB.QueryRow(ctx, `SELECT created_at FROM payout_destinations WHERE id=$1`, ev.DestinationID).Scan(&destCreated); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if time.Since(destCreated) > time.Duration(p.DestinationAgeHours)*time.Hour {
+		return nil, nil
+	}
+
+	var knownDevice bool
+	if err := app.DB.QueryRow(ctx, `
+		SELECT EXISTS(
+		  SELECT 1 FROM refresh_tokens
+		  WHERE user_id=$1 AND user_agent=$2 AND created_at < $3
+		)
+	`, ev.UserID, ev.UserAgent, time.Now().Add(-time.Duration(p.DeviceAgeHours)*time.Hour)).Scan(&knownDevice); err != nil {
+		return nil, err
+	}
+	if knownDevice {
+		return nil, nil
+	}
+	return map[string]any{
+		"destinationId":        ev.DestinationID,
+		"destinationCreatedAt": destCreated,
+		"userAgent":            ev.UserAgent,
+		"ip":                   ev.IP,
+	}, nil
+}
+
+// checkGiftFanIn fires when the recipient is receiving a burst of small gifts
+// (possibly from many senders) within the window.
+func (app *App) checkGiftFanIn(ctx context.Context, ev fraudEvent, p fraudRuleParams) (map[string]any, error) {
+	if ev.CounterpartyID == "" || p.WindowMinutes <= 0 || p.MaxCount <= 0 {
+		return nil, nil
+	}
+	if p.MaxEachAmount > 0 && ev.Amount > p.MaxEachAmount {
+		return nil, nil
+	}
+	since := time.Now().Add(-time.Duration(p.WindowMinutes) * time.Minute)
+
+	var count, senders int64
+	if err := app.DB.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT snd.wallet_id)
+		FROM transactions t
+		JOIN ledger_entries rcv ON rcv.tx_id = t.id AND rcv.direction='credit'
+		JOIN wallets wl ON wl.id = rcv.wallet_id
+		JOIN ledger_entries snd ON snd.tx_id = t.id AND snd.direction='debit'
+		WHERE wl.user_id=$1 AND t.kind='gift' AND t.created_at >= $2
+		  AND ($3::bigint = 0 OR t.amount <= $3::bigint)
+	`, ev.CounterpartyID, since, p.MaxEachAmount).Scan(&count, &senders); err != nil {
+		return nil, err
+	}
+	if ev.Pending {
+		count++
+	}
+	if count <= p.MaxCount {
+		return nil, nil
+	}
+	return map[string]any{
+		"recipientId":   ev.CounterpartyID,
+		"windowMinutes": p.WindowMinutes,
+		"count":         count,
+		"senders":       senders,
+		"maxCount":      p.MaxCount,
+		"maxEachAmount": p.MaxEachAmount,
+	}, nil
+}
+
+// checkCircularFlow fires when the recipient gifted the sender within the
+// window (A→B→A), a common pattern for laundering or farming rewards.
+func (app *App) checkCircularFlow(ctx context.Context, ev fraudEvent, p fraudRuleParams) (map[string]any, error) {
+	if ev.CounterpartyID == "" || p.WindowMinutes <= 0 {
+		return nil, nil
+	}
+	since := time.Now().Add(-time.Duration(p.WindowMinutes) * time.Minute)
+
+	var count, sum int64
+	if err := app.DB.QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(t.amount),0)
+		FROM transactions t
+		JOIN ledger_entries snd ON snd.tx_id = t.id AND snd.direction='debit'
+		JOIN wallets sw ON sw.id = snd.wallet_id
+		JOIN ledger_entries rcv ON rcv.tx_id = t.id AND rcv.direction='credit'
+		JOIN wallets rw ON rw.id = rcv.wallet_id
+		WHERE t.kind='gift' AND t.created_at >= $3
+		  AND sw.user_id=$1 AND rw.user_id=$2
+	`, ev.CounterpartyID, ev.UserID, since).Scan(&count, &sum); err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	return map[string]any{
+		"counterpartyId": ev.CounterpartyID,
+		"windowMinutes":  p.WindowMinutes,
+		"reverseCount":   count,
+		"reverseAmount":  sum,
+	}, nil
+}
+
+// holdRequested reports whether any hit comes from a rule configured to hold.
+func holdRequested(hits []fraudHit) bool {
+	for _, h := range hits {
+		if h.Rule.Action == "hold" {
+			return true
+		}
+	}
+	return false
+}
+
+// screenFraud evaluates ev and opens a review case per rule hit. It never fails
+// the caller: the movement has already been committed.
+func (app *App) screenFraud(ctx context.Context, ev fraudEvent) []fraudHit {
+	hits, err := app.evaluateFraud(ctx, ev)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("event", ev.Event).Str("user_id", ev.UserID).Msg("fraud evaluation failed")
+	}
+	app.openFraudCases(ctx, ev, hits)
+	return hits
+}
+
+// openFraudCases records one review case per hit against ev's subject.
+func (app *App) openFraudCases(ctx context.Context, ev fraudEvent, hits []fraudHit) {
+	for _, h := range hits {
+		details, _ := json.Marshal(h.Details)
+		if _, err := app.DB.Exec(ctx, `
+			INSERT INTO fraud_cases (user_id, rule_id, rule_name, event, subject_type, subject_id, details)
+			VALUES ($1,$2,$3,$4,$5,$6,$7::jsonb)
+		`, ev.UserID, h.Rule.ID, h.Rule.Name, ev.Event, ev.SubjectType, ev.SubjectID, string(details)); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("rule", h.Rule.Name).Str("subject_id", ev.SubjectID).Msg("open fraud case failed")
+			continue
+		}
+		app.raiseAlert(ctx, alert{
+			Name:    "fraud_rule_hit",
+			Message: "fraud rule hit; case opened for review",
+			Fields: map[string]any{"rule": h.Rule.Name, "action": h.Rule.Action, "event": ev.Event,
+				"user_id": ev.UserID, "subject_type": ev.SubjectType, "subject_id": ev.SubjectID},
+		})
+	}
+}
+
+// checkNotFrozen returns errAccountFrozen if fraud review froze the user's money.
+func (app *App) checkNotFrozen(ctx context.Context, userID string) error {
+	u, err := app.userByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u.Frozen {
+		return errAccountFrozen
+	}
+	return nil
+}
+
+// hasOpenFraudCase reports whether a subject is still waiting on fraud review.
+func (app *App) hasOpenFraudCase(ctx context.Context, subjectType, subjectID string) (bool, error) {
+	var open bool
+	err := app.DB.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM fraud_cases WHERE subject_type=$1 AND subject_id=$2 AND status='open')
+	`, subjectType, subjectID).Scan(&open)
+	return open, err
+}
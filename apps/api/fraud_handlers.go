@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+// ---------- Types ----------
+
+type fraudCaseDTO struct {
+	ID          string          `json:"id"`
+	UserID      string          `json:"userId"`
+	RuleName    string          `json:"ruleName"`
+	Event       string          `json:"event"`
+	SubjectType string          `json:"subjectType"`
+	SubjectID   string          `json:"subjectId"`
+	Details     json.RawMessage `json:"details"`
+	Status      string          `json:"status"`
+	Resolution  *string         `json:"resolution,omitempty"`
+	ReviewNote  *string         `json:"reviewNote,omitempty"`
+	ReviewedBy  *string         `json:"reviewedBy,omitempty"`
+	ReviewedAt  *time.Time      `json:"reviewedAt,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+type fraudRuleDTO struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Event     string          `json:"event"`
+	Kind      string          `json:"kind"`
+	Action    string          `json:"action"`
+	Params    json.RawMessage `json:"params"`
+	Enabled   bool            `json:"enabled"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+const fraudCaseColumns = `id, user_id, rule_name, event, subject_type, subject_id, details,
+		       status, resolution, review_note, reviewed_by, reviewed_at, created_at`
+
+func scanFraudCase(row pgx.Row) (fraudCaseDTO, error) {
+	var d fraudCaseDTO
+	var details []byte
+	err := row.Scan(&d.ID, &d.UserID, &d.RuleName, &d.Event, &d.SubjectType, &d.SubjectID, &details,
+		&d.Status, &d.Resolution, &d.ReviewNote, &d.ReviewedBy, &d.ReviewedAt, &d.CreatedAt)
+	d.Details = details
+	return d, err
+}
+
+// ---------- Handlers (Admin) ----------
+
+// GET /v1/admin/fraud/cases?status=open&userId=
+func (app *App) AdminListFraudCases(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := strings.TrimSpace(q.Get("status"))
+	if status == "" {
+		status = "open"
+	}
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT `+fraudCaseColumns+`
+		FROM fraud_cases
+		WHERE ($1 = 'all' OR status = $1) AND ($2 = '' OR user_id::text = $2)
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, status, strings.TrimSpace(q.Get("userId")))
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	out := []fraudCaseDTO{}
+	for rows.Next() {
+		d, err := scanFraudCase(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, d)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// GET /v1/admin/fraud/cases/{id}
+func (app *App) AdminGetFraudCase(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	d, err := scanFraudCase(app.DB.QueryRow(r.Context(), `SELECT `+fraudCaseColumns+` FROM fraud_cases WHERE id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "case_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": d})
+}
+
+// POST /v1/admin/fraud/cases/{id}/clear
+// Clearing the last open case on a held gift releases it to the recipient.
+func (app *App) AdminClearFraudCase(w http.ResponseWriter, r *http.Request) {
+	uid, _ := getUserID(r)
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var body struct {
+		Note string `json:"note,omitempty"`
+	}
+	if !decodeOptionalBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+
+	var userID, subjectType, subjectID string
+	err := app.DB.QueryRow(ctx, `
+		UPDATE fraud_cases
+		SET status='cleared', review_note=NULLIF($2,''), reviewed_by=$3, reviewed_at=now()
+		WHERE id=$1 AND status='open'
+		RETURNING user_id, subject_type, subject_id
+	`, id, strings.TrimSpace(body.Note), uid).Scan(&userID, &subjectType, &subjectID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusConflict, "case_not_open"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	released := false
+	if subjectType == "held_gift" {
+		open, err := app.hasOpenFraudCase(ctx, subjectType, subjectID)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		if !open {
+			if err := app.resolveHeldGift(ctx, subjectID, true); err != nil && !errors.Is(err, errHeldGiftResolved) {
+				log.Ctx(r.Context()).Error().Err(err).Str("held_gift_id", subjectID).Msg("release held gift failed")
+				apierror.Write(w, apierror.New(http.StatusInternalServerError, "release_error"))
+				return
+			}
+			released = true
+		}
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "fraud_case.clear",
+		TargetType: "user",
+		TargetID:   userID,
+		Before:     map[string]any{"caseId": id, "status": "open"},
+		After:      map[string]any{"caseId": id, "status": "cleared", "note": body.Note, "heldGiftReleased": released},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"caseId": id, "status": "cleared", "heldGiftReleased": released}})
+}
+
+// POST /v1/admin/fraud/cases/{id}/action  {"action":"freeze"|"reject","note":"..."}
+// freeze: blocks the user's outgoing money movement.
+// reject: rejects (and refunds) the withdrawal, or returns the held gift to its
+// sender, that the case was raised on.
+func (app *App) AdminActionFraudCase(w http.ResponseWriter, r *http.Request) {
+	uid, _ := getUserID(r)
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var body struct {
+		Action string `json:"action" validate:"required,oneof=freeze reject"`
+		Note   string `json:"note,omitempty" validate:"max=1000"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+
+	var userID, status, subjectType, subjectID string
+	err := app.DB.QueryRow(ctx, `SELECT user_id, status, subject_type, subject_id FROM fraud_cases WHERE id=$1`, id).
+		Scan(&userID, &status, &subjectType, &subjectID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "case_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if status != "open" {
+		apierror.Write(w, apierror.New(http.StatusConflict, "case_not_open"))
+		return
+	}
+
+	switch body.Action {
+	case "freeze":
+		if _, err := app.DB.Exec(ctx, `UPDATE users SET frozen_at = COALESCE(frozen_at, now()) WHERE id=$1`, userID); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		app.invalidateUser(ctx, userID)
+	case "reject":
+		if subjectType == "held_gift" {
+			if err := app.resolveHeldGift(ctx, subjectID, false); err != nil && !errors.Is(err, errHeldGiftResolved) {
+				log.Ctx(r.Context()).Error().Err(err).Str("held_gift_id", subjectID).Msg("return held gift failed")
+				apierror.Write(w, apierror.New(http.StatusInternalServerError, "reject_error"))
+				return
+			}
+			break
+		}
+		if subjectType != "payout" {
+			apierror.Write(w, apierror.New(http.StatusBadRequest, "reject_requires_withdrawal_or_held_gift"))
+			return
+		}
+		if _, err := app.rejectPayout(ctx, subjectID); err != nil {
+			if errors.Is(err, errPayoutSucceeded) {
+				apierror.Write(w, apierror.New(http.StatusConflict, "cannot_reject_succeeded"))
+				return
+			}
+			log.Ctx(r.Context()).Error().Err(err).Str("payout_id", subjectID).Msg("fraud reject payout failed")
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "reject_error"))
+			return
+		}
+	}
+
+	if _, err := app.DB.Exec(ctx, `
+		UPDATE fraud_cases
+		SET status='actioned', resolution=$2, review_note=NULLIF($3,''), reviewed_by=$4, reviewed_at=now()
+		WHERE id=$1
+	`, id, body.Action, strings.TrimSpace(body.Note), uid); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "fraud_case." + body.Action,
+		TargetType: "user",
+		TargetID:   userID,
+		Before:     map[string]any{"caseId": id, "status": "open"},
+		After:      map[string]any{"caseId": id, "status": "actioned", "resolution": body.Action, "subjectId": subjectID, "note": body.Note},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"caseId": id, "status": "actioned", "resolution": body.Action}})
+}
+
+// POST /v1/admin/users/{id}/unfreeze
+func (app *App) AdminUnfreezeUser(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var frozenAt *time.Time
+	err := app.DB.QueryRow(r.Context(), `
+		WITH prev AS (SELECT frozen_at FROM users WHERE id=$1 FOR UPDATE)
+		UPDATE users SET frozen_at = NULL FROM prev WHERE users.id=$1
+		RETURNING prev.frozen_at
+	`, id).Scan(&frozenAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(r.Context(), id)
+	app.audit(r, auditEntry{
+		Action:     "user.unfreeze",
+		TargetType: "user",
+		TargetID:   id,
+		Before:     map[string]any{"frozenAt": frozenAt},
+		After:      map[string]any{"frozenAt": nil},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"userId": id, "frozen": false}})
+}
+
+// GET /v1/admin/fraud/rules
+func (app *App) AdminListFraudRules(w http.ResponseWriter, r *http.Request) {
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT id, name, event, kind, action, params, enabled, updated_at
+		FROM fraud_rules ORDER BY event, name
+	`)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	out := []fraudRuleDTO{}
+	for rows.Next() {
+		var d fraudRuleDTO
+		var params []byte
+		if err := rows.Scan(&d.ID, &d.Name, &d.Event, &d.Kind, &d.Action, &params, &d.Enabled, &d.UpdatedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		d.Params = params
+		out = append(out, d)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// PUT /v1/admin/fraud/rules/{id}  {"enabled":bool,"action":"flag"|"hold","params":{...}}
+func (app *App) AdminUpdateFraudRule(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var body struct {
+		Enabled *bool            `json:"enabled,omitempty" validate:"required_without_all=Action Params"`
+		Action  *string          `json:"action,omitempty" validate:"omitempty,oneof=flag hold"`
+		Params  *fraudRuleParams `json:"params,omitempty"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	var params *string
+	if body.Params != nil {
+		b, _ := json.Marshal(body.Params)
+		s := string(b)
+		params = &s
+	}
+
+	var before, after fraudRuleDTO
+	var beforeParams, afterParams []byte
+	err := app.DB.QueryRow(r.Context(), `
+		WITH prev AS (SELECT enabled, action, params FROM fraud_rules WHERE id=$1 FOR UPDATE)
+		UPDATE fraud_rules SET
+		  enabled    = COALESCE($2, fraud_rules.enabled),
+		  params     = COALESCE($3::jsonb, fraud_rules.params),
+		  action     = COALESCE($4, fraud_rules.action),
+		  updated_at = now()
+		FROM prev
+		WHERE fraud_rules.id=$1
+		RETURNING prev.enabled, prev.action, prev.params, fraud_rules.enabled, fraud_rules.action, fraud_rules.params
+	`, id, body.Enabled, params, body.Action).Scan(&before.Enabled, &before.Action, &beforeParams, &after.Enabled, &after.Action, &afterParams)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "rule_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	before.Params, after.Params = beforeParams, afterParams
+
+	app.audit(r, auditEntry{
+		Action:     "fraud_rule.update",
+		TargetType: "fraud_rule",
+		TargetID:   id,
+		Before:     map[string]any{"enabled": before.Enabled, "action": before.Action, "params": before.Params},
+		After:      map[string]any{"enabled": after.Enabled, "action": after.Action, "params": after.Params},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"id": id, "enabled": after.Enabled, "action": after.Action, "params": after.Params}})
+}
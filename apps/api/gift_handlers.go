@@ -1,50 +1,69 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"net/http"
-	"sort"
 	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
 )
 
 type createGiftReq struct {
-	RecipientUserID string `json:"recipientUserId"`
-	Amount          int64  `json:"amount"` // kobo > 0
-	Note            string `json:"note,omitempty"`
+	// the recipient by ID, or by their verified phone number
+	RecipientUserID string `json:"recipientUserId" validate:"required_without=RecipientPhone,omitempty,uuid"`
+	RecipientPhone  string `json:"recipientPhone,omitempty" validate:"required_without=RecipientUserID,excluded_with=RecipientUserID,omitempty,phone"`
+	Amount          int64  `json:"amount" validate:"kobo"`
+	Note            string `json:"note,omitempty" validate:"max=280"`
+	// ScheduledAt, when set, defers the gift; the worker sends it then.
+	// Without an offset it is wall-clock time in the sender's time zone.
+	ScheduledAt *localTime `json:"scheduledAt,omitempty"`
 }
 type giftResp struct {
 	GiftID string `json:"giftId"`
 	Status string `json:"status"`
 }
 
+// maxGiftSchedule is how far ahead a gift may be scheduled.
+const maxGiftSchedule = 365 * 24 * time.Hour
+
 func (app *App) CreateGift(w http.ResponseWriter, r *http.Request) {
 	uid, ok := getUserID(r)
 	if !ok {
-		httpError(w, http.StatusUnauthorized, "not_authenticated")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
 		return
 	}
 	var body createGiftReq
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RecipientUserID == "" || body.Amount <= 0 {
-		httpError(w, http.StatusBadRequest, "invalid_request")
+	if !decodeBody(w, r, &body) {
 		return
 	}
-	if body.RecipientUserID == uid {
-		httpError(w, http.StatusBadRequest, "cannot_gift_self")
-		return
+	if body.RecipientPhone != "" {
+		phone, _ := validate.Phone(body.RecipientPhone)
+		id, err := app.userIDByPhone(r, phone)
+		if errors.Is(err, pgx.ErrNoRows) {
+			apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+			return
+		}
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		body.RecipientUserID = id
 	}
-
-	// Resolve wallets
-	var senderWalletID, recipientWalletID string
-	if err := app.DB.QueryRow(r.Context(), `SELECT id FROM wallets WHERE user_id=$1`, uid).Scan(&senderWalletID); err != nil {
-		httpError(w, http.StatusNotFound, "wallet_not_found")
+	if body.RecipientUserID == uid {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "cannot_gift_self"))
 		return
 	}
-	if err := app.DB.QueryRow(r.Context(), `SELECT id FROM wallets WHERE user_id=$1`, body.RecipientUserID).Scan(&recipientWalletID); err != nil {
-		httpError(w, http.StatusBadRequest, "recipient_wallet_not_found")
+	if accountStatusError(w, app.checkCanMoveMoney(r.Context(), uid)) {
 		return
 	}
 
@@ -55,69 +74,453 @@ func (app *App) CreateGift(w http.ResponseWriter, r *http.Request) {
 	}
 	idem = strings.TrimSpace(idem)
 
-	tx, err := app.DB.Begin(r.Context())
-	if err != nil { httpError(w, http.StatusInternalServerError, "tx_begin_error"); return }
-	defer tx.Rollback(r.Context())
+	if body.ScheduledAt != nil {
+		app.scheduleGift(w, r, uid, body, idem)
+		return
+	}
+
+	ev := fraudEventFromRequest(r, "gift", uid, body.Amount, "transaction", "")
+	ev.CounterpartyID = body.RecipientUserID
+	res, replay, err := app.sendGift(r.Context(), ev, idem)
+	switch {
+	case err != nil:
+		apierror.Write(w, err)
+	case replay:
+		writeJSON(w, http.StatusOK, map[string]any{"data": res})
+	case res.Status == "held":
+		writeJSON(w, http.StatusAccepted, map[string]any{"data": res})
+	default:
+		writeJSON(w, http.StatusCreated, map[string]any{"data": res})
+	}
+}
+
+// sendGift moves ev.Amount from ev.UserID to ev.CounterpartyID, or parks it
+// in the system wallet when anomaly rules ask for a hold. replay is true when
+// idem was already used and res describes the earlier gift. Errors are
+// *apierror.Error.
+func (app *App) sendGift(ctx context.Context, ev fraudEvent, idem string) (res giftResp, replay bool, err error) {
+	uid, recipientID, amount := ev.UserID, ev.CounterpartyID, ev.Amount
+
+	// Resolve wallets
+	senderWalletID, err := app.walletIDForUser(ctx, uid)
+	if err != nil {
+		return res, false, apierror.New(http.StatusNotFound, "wallet_not_found")
+	}
+	recipientWalletID, err := app.walletIDForUser(ctx, recipientID)
+	if err != nil {
+		return res, false, apierror.New(http.StatusBadRequest, "recipient_wallet_not_found")
+	}
+
+	// Anomaly screening runs before settlement so hold rules can stop the money
+	ev.Pending = true
+	hits, err := app.evaluateFraud(ctx, ev)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("gift fraud evaluation failed")
+	}
+	hold := holdRequested(hits)
+
+	// Held gifts settle into the system wallet until review
+	creditWalletID := recipientWalletID
+	if hold {
+		_, systemWid, err := app.systemUserAndWallet(ctx)
+		if err != nil {
+			return res, false, apierror.New(http.StatusInternalServerError, "system_wallet_missing")
+		}
+		creditWalletID = systemWid
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return res, false, apierror.New(http.StatusInternalServerError, "tx_begin_error")
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the wallets, then the idempotency key, balance and beneficiary
+	// limit, in one round trip
+	c, err := app.checkMove(ctx, tx, moveReq{
+		UserID:      uid,
+		Idem:        idem,
+		Lock:        []string{senderWalletID, creditWalletID},
+		Debit:       senderWalletID,
+		RecipientID: recipientID,
+		Amount:      amount,
+	})
+	if err != nil {
+		return res, false, apierror.New(http.StatusInternalServerError, "db_error")
+	}
+	if c.ExistingID != "" {
+		if c.ExistingKind == "gift_hold" {
+			var heldID string
+			_ = tx.QueryRow(ctx, `SELECT id FROM held_gifts WHERE hold_tx_id=$1`, c.ExistingID).Scan(&heldID)
+			return giftResp{GiftID: heldID, Status: "held"}, true, nil
+		}
+		return giftResp{GiftID: c.ExistingID, Status: "succeeded"}, true, nil
+	}
+
+	// Recipient's status and privacy settings; after the idempotency check
+	// so a replay still gets the gift it made. A banned, deactivated or
+	// to-be-erased account takes nothing; a suspension lifts, so its holder
+	// still receives.
+	if err := app.checkAccountActive(ctx, recipientID); err != nil && !errors.Is(err, errAccountSuspended) {
+		if e := accountStatusAPIError(err); e.Status >= http.StatusInternalServerError {
+			return res, false, e
+		}
+		return res, false, apierror.New(http.StatusForbidden, "recipient_unavailable")
+	}
+	accepts, err := app.acceptsGiftFrom(ctx, uid, recipientID)
+	if err != nil {
+		return res, false, apierror.New(http.StatusInternalServerError, "db_error")
+	}
+	if !accepts {
+		return res, false, apierror.New(http.StatusForbidden, "recipient_contacts_only")
+	}
+	if c.LimitErr != nil {
+		return res, false, c.LimitErr
+	}
+	if c.Balance < amount {
+		return res, false, apierror.New(http.StatusBadRequest, "insufficient_funds")
+	}
+
+	// Post: debit sender, credit recipient (or the system wallet while
+	// held), and record the hold
+	kind := "gift"
+	if hold {
+		kind = "gift_hold"
+	}
+	var txID, heldID string
+	b := &pgx.Batch{}
+	queuePosting(b, posting{Idem: idem, Kind: kind, Amount: amount, Debit: senderWalletID, Credit: creditWalletID}, &txID)
+	if hold {
+		b.Queue(`
+			INSERT INTO held_gifts (sender_id, recipient_id, amount, hold_tx_id)
+			VALUES ($2,$3,$4,`+postedTxSQL+`)
+			RETURNING id
+		`, idem, uid, recipientID, amount).QueryRow(func(row pgx.Row) error { return row.Scan(&heldID) })
+	}
+	if err := tx.SendBatch(ctx, b).Close(); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("post gift failed")
+		return res, false, apierror.New(http.StatusInternalServerError, "insert_tx_error")
+	}
 
-	// Lock both wallets in deterministic order to avoid deadlocks
-	walletIDs := []string{senderWalletID, recipientWalletID}
-	sort.Strings(walletIDs)
-	if _, err := tx.Exec(r.Context(), `SELECT id FROM wallets WHERE id = ANY($1) FOR UPDATE`, walletIDs); err != nil {
-		httpError(w, http.StatusInternalServerError, "lock_wallets_error"); return
+	if err := tx.Commit(ctx); err != nil {
+		return res, false, apierror.New(http.StatusInternalServerError, "tx_commit_error")
 	}
 
-	// Idempotency check
-	var existing string
-	err = tx.QueryRow(r.Context(), `SELECT id FROM transactions WHERE idempotency_key=$1`, idem).Scan(&existing)
-	if err == nil && existing != "" {
-		writeJSON(w, http.StatusOK, map[string]any{"data": giftResp{GiftID: existing, Status: "succeeded"}})
+	if hold {
+		ev.SubjectType, ev.SubjectID = "held_gift", heldID
+		app.openFraudCases(ctx, ev, hits)
+		app.Events.Publish(ctx, evGiftCreated, giftCreated{GiftID: heldID, SenderID: uid, RecipientID: recipientID, Amount: amount, Held: true})
+		return giftResp{GiftID: heldID, Status: "held"}, false, nil
+	}
+
+	ev.SubjectID = txID
+	app.openFraudCases(ctx, ev, hits)
+	app.Events.Publish(ctx, evGiftCreated, giftCreated{GiftID: txID, SenderID: uid, RecipientID: recipientID, Amount: amount})
+	return giftResp{GiftID: txID, Status: "succeeded"}, false, nil
+}
+
+// ---------- Scheduled gifts ----------
+
+// scheduleGift records a gift to be sent at body.ScheduledAt. Funds are not
+// reserved; the balance is checked when the worker sends it.
+func (app *App) scheduleGift(w http.ResponseWriter, r *http.Request, uid string, body createGiftReq, idem string) {
+	loc := app.userLocation(r.Context(), uid)
+	at := body.ScheduledAt.In(loc).UTC()
+	if now := time.Now(); !at.After(now) || at.Sub(now) > maxGiftSchedule {
+		apierror.Write(w, apierror.InvalidField("scheduledAt"))
 		return
 	}
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		httpError(w, http.StatusInternalServerError, "db_error")
+	var recipientExists bool
+	if err := app.DB.QueryRow(r.Context(), `SELECT EXISTS (SELECT 1 FROM wallets WHERE user_id=$1)`, body.RecipientUserID).Scan(&recipientExists); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
-
-	// Balance check (sender)
-	var balance int64
-	if err := tx.QueryRow(r.Context(), `
-		SELECT COALESCE(SUM(CASE WHEN direction='credit' THEN amount ELSE -amount END),0)
-		FROM ledger_entries WHERE wallet_id=$1
-	`, senderWalletID).Scan(&balance); err != nil {
-		httpError(w, http.StatusInternalServerError, "db_error")
+	if !recipientExists {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "recipient_wallet_not_found"))
+		return
+	}
+	accepts, err := app.acceptsGiftFrom(r.Context(), uid, body.RecipientUserID)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
-	if balance < body.Amount {
-		httpError(w, http.StatusBadRequest, "insufficient_funds")
+	if !accepts {
+		apierror.Write(w, apierror.New(http.StatusForbidden, "recipient_contacts_only"))
 		return
 	}
 
-	// Insert transaction
-	var txID string
-	var meta any = nil
-	err = tx.QueryRow(r.Context(), `
-		INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
-		VALUES ($1,'gift',$2,'NGN', COALESCE($3::jsonb, '{}'::jsonb))
+	ctx := r.Context()
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var id string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO scheduled_gifts (sender_id, recipient_id, amount, note, idempotency_key, scheduled_at)
+		VALUES ($1,$2,$3,NULLIF($4,''),$5,$6)
+		ON CONFLICT (sender_id, idempotency_key) DO NOTHING
 		RETURNING id
-	`, idem, body.Amount, meta).Scan(&txID)
+	`, uid, body.RecipientUserID, body.Amount, body.Note, idem, at).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var status string
+		_ = app.DB.QueryRow(ctx, `SELECT id, status FROM scheduled_gifts WHERE idempotency_key=$1 AND sender_id=$2`, idem, uid).Scan(&id, &status)
+		writeJSON(w, http.StatusOK, map[string]any{"data": giftResp{GiftID: id, Status: status}})
+		return
+	}
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "insert_tx_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
+	if err := jobs.Enqueue(ctx, tx, jobScheduledGift, map[string]any{"scheduledGiftId": id},
+		jobs.Options{RunAt: at, UniqueKey: jobScheduledGift + ":" + id}); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"data": map[string]any{
+		"giftId":      id,
+		"status":      "scheduled",
+		"scheduledAt": at.In(loc),
+	}})
+}
 
-	// Ledger: debit sender, credit recipient
-	if _, err := tx.Exec(r.Context(), `
-		INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
-		VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
-	`, txID, senderWalletID, body.Amount, recipientWalletID); err != nil {
-		httpError(w, http.StatusInternalServerError, "insert_ledger_error")
+// scheduledGiftJob sends a scheduled gift. A gift the sender can no longer
+// make (insufficient funds, frozen account) fails without retrying and the
+// sender is told; infrastructure errors are retried.
+func (app *App) scheduledGiftJob(ctx context.Context, job *jobs.Job) error {
+	var p struct {
+		ScheduledGiftID string `json:"scheduledGiftId"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	// Claim it so a cancel can't race the send. A retry finds it already
+	// 'sending'; the idempotency key stops a second transfer.
+	var senderID, recipientID string
+	var amount int64
+	err := app.DB.QueryRow(ctx, `
+		UPDATE scheduled_gifts SET status='sending'
+		WHERE id=$1 AND status IN ('scheduled','sending')
+		RETURNING sender_id, recipient_id, amount
+	`, p.ScheduledGiftID).Scan(&senderID, &recipientID, &amount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // cancelled
+	}
+	if err != nil {
+		return err
+	}
+
+	err = app.checkCanMoveMoney(ctx, senderID)
+	var res giftResp
+	if err == nil {
+		ev := fraudEvent{Event: "gift", UserID: senderID, Amount: amount, SubjectType: "transaction", CounterpartyID: recipientID}
+		res, _, err = app.sendGift(ctx, ev, "scheduled_gift:"+p.ScheduledGiftID)
+	}
+	if err != nil {
+		e := accountStatusAPIError(err)
+		if e.Status >= http.StatusInternalServerError {
+			return err
+		}
+		if _, err := app.DB.Exec(ctx, `
+			UPDATE scheduled_gifts SET status='failed', error=$2, settled_at=now() WHERE id=$1
+		`, p.ScheduledGiftID, e.Code); err != nil {
+			return err
+		}
+		app.notify(ctx, senderID, "scheduled_gift_failed",
+			map[string]any{"scheduledGiftId": p.ScheduledGiftID, "code": e.Code, "amount": amount})
+		return nil
+	}
+
+	newStatus := "sent"
+	if res.Status == "held" {
+		newStatus = "held"
+	}
+	_, err = app.DB.Exec(ctx, `
+		UPDATE scheduled_gifts SET status=$2, gift_id=$3, settled_at=now() WHERE id=$1
+	`, p.ScheduledGiftID, newStatus, res.GiftID)
+	return err
+}
+
+type scheduledGiftDTO struct {
+	ID              string     `json:"id"`
+	RecipientUserID string     `json:"recipientUserId"`
+	RecipientAvatar *string    `json:"recipientAvatarUrl,omitempty"`
+	Amount          int64      `json:"amount"`
+	Note            *string    `json:"note,omitempty"`
+	ScheduledAt     time.Time  `json:"scheduledAt"`
+	Status          string     `json:"status"` // scheduled | sending | sent | held | failed | cancelled
+	GiftID          *string    `json:"giftId,omitempty"`
+	Error           *string    `json:"error,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	SettledAt       *time.Time `json:"settledAt,omitempty"`
+}
+
+// GET /v1/gifts/scheduled?limit=&cursor=
+func (app *App) ListScheduledGifts(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	pg, ok := app.parsePage(w, r, "gifts.scheduled", pagination.Standard)
+	if !ok {
+		return
+	}
+	afterAt, afterID := pg.AfterArgs()
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT g.id, g.recipient_id, u.avatar_url, g.amount, g.note, g.scheduled_at, g.status, g.gift_id, g.error, g.created_at, g.settled_at
+		FROM scheduled_gifts g
+		JOIN users u ON u.id = g.recipient_id
+		WHERE g.sender_id=$1 AND g.deleted_at IS NULL
+		  AND ($2::timestamptz IS NULL OR (g.scheduled_at, g.id) < ($2, $3::uuid))
+		ORDER BY g.scheduled_at DESC, g.id DESC
+		LIMIT $4
+	`, uid, afterAt, afterID, pg.Limit+1)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
+	defer rows.Close()
+	out := []scheduledGiftDTO{}
+	for rows.Next() {
+		var g scheduledGiftDTO
+		if err := rows.Scan(&g.ID, &g.RecipientUserID, &g.RecipientAvatar, &g.Amount, &g.Note, &g.ScheduledAt, &g.Status,
+			&g.GiftID, &g.Error, &g.CreatedAt, &g.SettledAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, g)
+	}
+	out, paging := pagination.Trim(pg, out, func(g scheduledGiftDTO) pagination.Key { return pagination.Key{Time: g.ScheduledAt, ID: g.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
 
-	if err := tx.Commit(r.Context()); err != nil {
-		httpError(w, http.StatusInternalServerError, "tx_commit_error")
+// DELETE /v1/gifts/scheduled/{id} — cancel before it is sent, and hide it
+// from the list; one already settled is only hidden
+func (app *App) CancelScheduledGift(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
 		return
 	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var status string
+	err := app.DB.QueryRow(r.Context(), `
+		UPDATE scheduled_gifts SET deleted_at=now(),
+		  status     = CASE WHEN status='scheduled' THEN 'cancelled' ELSE status END,
+		  settled_at = CASE WHEN status='scheduled' THEN now() ELSE settled_at END
+		WHERE id=$1 AND sender_id=$2 AND deleted_at IS NULL AND status <> 'sending'
+		RETURNING status
+	`, id, uid).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "scheduled_gift_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"id": id, "status": status}})
+}
 
-	writeJSON(w, http.StatusCreated, map[string]any{"data": giftResp{GiftID: txID, Status: "succeeded"}})
+// POST /v1/gifts/scheduled/{id}/restore — undo a delete. A gift the delete
+// cancelled is scheduled again if its time hasn't come; its job is still
+// queued and finds it 'scheduled' when it runs.
+func (app *App) RestoreScheduledGift(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var status string
+	err := app.DB.QueryRow(r.Context(), `
+		UPDATE scheduled_gifts SET deleted_at=NULL,
+		  status     = CASE WHEN status='cancelled' AND scheduled_at > now() THEN 'scheduled' ELSE status END,
+		  settled_at = CASE WHEN status='cancelled' AND scheduled_at > now() THEN NULL ELSE settled_at END
+		WHERE id=$1 AND sender_id=$2 AND deleted_at IS NOT NULL
+		RETURNING status
+	`, id, uid).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "scheduled_gift_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"id": id, "status": status}})
+}
+
+// ---------- Held gifts ----------
+
+var errHeldGiftResolved = errors.New("held gift already resolved")
+
+// resolveHeldGift settles a gift held by anomaly rules: release pays the
+// recipient, otherwise the amount returns to the sender. Either way the value
+// leaves the system wallet it was parked in.
+func (app *App) resolveHeldGift(ctx context.Context, id string, release bool) error {
+	_, systemWid, err := app.systemUserAndWallet(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var senderID, recipientID, status string
+	var amount int64
+	if err := tx.QueryRow(ctx, `
+		SELECT sender_id, recipient_id, amount, status
+		FROM held_gifts WHERE id=$1 FOR UPDATE
+	`, id).Scan(&senderID, &recipientID, &amount, &status); err != nil {
+		return err
+	}
+	if status != "held" {
+		return errHeldGiftResolved
+	}
+
+	kind, newStatus, payee := "gift_release", "released", recipientID
+	if !release {
+		kind, newStatus, payee = "gift_return", "returned", senderID
+	}
+	var payeeWid string
+	if err := tx.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id=$1`, payee).Scan(&payeeWid); err != nil {
+		return err
+	}
+
+	if err := app.lockWallets(ctx, tx, systemWid, payeeWid); err != nil {
+		return err
+	}
+
+	var txID string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+		VALUES ($1,$2,$3,'NGN', jsonb_build_object('heldGiftId', $4::text))
+		RETURNING id
+	`, "held_gift:"+id+":"+newStatus, kind, amount, id).Scan(&txID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+		VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+	`, txID, systemWid, amount, payeeWid); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE held_gifts SET status=$2, settle_tx_id=$3, resolved_at=now() WHERE id=$1
+	`, id, newStatus, txID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
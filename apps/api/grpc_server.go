@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/sudo-init-do/okies-backend/pkg/internalpb"
+)
+
+// Internal gRPC API (proto/okies/internal/v1) for services inside the
+// cluster. It shares the App with the HTTP API but not its auth: callers
+// present the shared INTERNAL_GRPC_TOKEN instead of a user JWT, so the port
+// must never be exposed publicly.
+
+type internalServer struct {
+	internalpb.UnimplementedInternalServer
+	app *App
+}
+
+// serveGRPC listens on port until the returned server is stopped.
+func (app *App) serveGRPC(port int) (*grpc.Server, error) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		logUnary,
+		internalAuth([]byte(app.Config.InternalGRPCToken)),
+	))
+	internalpb.RegisterInternalServer(srv, &internalServer{app: app})
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			log.Error().Err(err).Msg("grpc server error")
+		}
+	}()
+	log.Info().Msgf("internal gRPC running on %s", lis.Addr())
+	return srv, nil
+}
+
+// internalAuth requires "authorization: Bearer <token>" metadata.
+func internalAuth(token []byte) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var got string
+		if v := md.Get("authorization"); len(v) > 0 {
+			got = strings.TrimPrefix(v[0], "Bearer ")
+		}
+		if got == "" || subtle.ConstantTimeCompare([]byte(got), token) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "invalid internal token")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func logUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	ev := log.Info()
+	if status.Code(err) == codes.Internal || status.Code(err) == codes.Unknown {
+		ev = log.Error().Err(err)
+	}
+	ev.Str("method", info.FullMethod).
+		Str("code", status.Code(err).String()).
+		Dur("duration", time.Since(start)).
+		Msg("grpc")
+	return resp, err
+}
+
+func (s *internalServer) GetBalance(ctx context.Context, req *internalpb.GetBalanceRequest) (*internalpb.GetBalanceResponse, error) {
+	if _, err := uuid.Parse(req.GetUserId()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "user_id must be a uuid")
+	}
+	walletID, err := s.app.walletIDForUser(ctx, req.GetUserId())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, status.Error(codes.NotFound, "wallet not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "wallet lookup failed")
+	}
+	balance, err := s.app.walletBalance(ctx, walletID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "balance query failed")
+	}
+	return &internalpb.GetBalanceResponse{WalletId: walletID, Balance: balance, Currency: "NGN"}, nil
+}
+
+// internalLedgerKinds are the transaction kinds internal callers may post;
+// gifts and withdrawals have their own flows and invariants.
+var internalLedgerKinds = map[string]bool{"topup": true, "referral_reward": true, "adjustment": true}
+
+func (s *internalServer) PostLedger(ctx context.Context, req *internalpb.PostLedgerRequest) (*internalpb.PostLedgerResponse, error) {
+	switch {
+	case strings.TrimSpace(req.GetIdempotencyKey()) == "":
+		return nil, status.Error(codes.InvalidArgument, "idempotency_key is required")
+	case !internalLedgerKinds[req.GetKind()]:
+		return nil, status.Error(codes.InvalidArgument, "kind must be topup, referral_reward or adjustment")
+	case req.GetAmount() <= 0:
+		return nil, status.Error(codes.InvalidArgument, "amount must be positive")
+	case req.GetDebitUserId() == req.GetCreditUserId():
+		return nil, status.Error(codes.InvalidArgument, "debit and credit users must differ")
+	}
+
+	systemUID, systemWids, err := s.app.systemWallets(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "system wallet missing")
+	}
+	systemWid := systemWids[rand.IntN(len(systemWids))]
+	// empty user ids mean the system wallet
+	walletFor := func(field, userID string) (string, error) {
+		if userID == "" {
+			return systemWid, nil
+		}
+		if _, err := uuid.Parse(userID); err != nil {
+			return "", status.Errorf(codes.InvalidArgument, "%s must be a uuid", field)
+		}
+		wid, err := s.app.walletIDForUser(ctx, userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", status.Errorf(codes.NotFound, "%s has no wallet", field)
+		}
+		if err != nil {
+			return "", status.Error(codes.Internal, "wallet lookup failed")
+		}
+		return wid, nil
+	}
+	from, err := walletFor("debit_user_id", req.GetDebitUserId())
+	if err != nil {
+		return nil, err
+	}
+	to, err := walletFor("credit_user_id", req.GetCreditUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	meta := map[string]string{}
+	for k, v := range req.GetMetadata() {
+		meta[k] = v
+	}
+	meta["source"] = "grpc"
+	metaJSON, _ := json.Marshal(meta)
+	// namespaced so internal keys can't collide with client Idempotency-Keys
+	idem := "internal:" + req.GetIdempotencyKey()
+
+	tx, err := s.app.DB.Begin(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "tx begin failed")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.app.lockWallets(ctx, tx, from, to); err != nil {
+		return nil, status.Error(codes.Internal, "lock wallets failed")
+	}
+
+	var existing string
+	err = tx.QueryRow(ctx, `SELECT id FROM transactions WHERE idempotency_key=$1`, idem).Scan(&existing)
+	if err == nil {
+		return &internalpb.PostLedgerResponse{TransactionId: existing, Replayed: true}, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, status.Error(codes.Internal, "idempotency lookup failed")
+	}
+
+	if !slices.Contains(systemWids, from) {
+		balance, err := balanceOf(ctx, tx, from)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "balance query failed")
+		}
+		if balance < req.GetAmount() {
+			return nil, status.Error(codes.FailedPrecondition, "insufficient funds")
+		}
+	}
+
+	var txID string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+		VALUES ($1,$2,$3,'NGN',$4::jsonb)
+		RETURNING id
+	`, idem, req.GetKind(), req.GetAmount(), string(metaJSON)).Scan(&txID); err != nil {
+		return nil, status.Error(codes.Internal, "insert transaction failed")
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+		VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+	`, txID, from, req.GetAmount(), to); err != nil {
+		return nil, status.Error(codes.Internal, "insert ledger failed")
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, status.Error(codes.Internal, "tx commit failed")
+	}
+
+	log.Info().Str("tx_id", txID).Str("kind", req.GetKind()).Int64("amount", req.GetAmount()).
+		Str("debit_user_id", req.GetDebitUserId()).Str("credit_user_id", req.GetCreditUserId()).
+		Msg("internal ledger posting")
+	if req.GetKind() == "topup" && req.GetDebitUserId() == "" && req.GetCreditUserId() != systemUID {
+		s.app.Events.Publish(ctx, evDepositSettled, depositSettled{
+			TxID: txID, UserID: req.GetCreditUserId(), Amount: req.GetAmount(), Source: "internal",
+		})
+	}
+	return &internalpb.PostLedgerResponse{TransactionId: txID}, nil
+}
+
+func (s *internalServer) GetUser(ctx context.Context, req *internalpb.GetUserRequest) (*internalpb.GetUserResponse, error) {
+	id := req.GetId()
+	email := strings.ToLower(strings.TrimSpace(req.GetEmail()))
+	username := strings.TrimSpace(req.GetUsername())
+
+	set := 0
+	for _, v := range []string{id, email, username} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, status.Error(codes.InvalidArgument, "set exactly one of id, email or username")
+	}
+
+	if id == "" {
+		col, v := "email", email
+		if username != "" {
+			col, v = "lower(username)", strings.ToLower(username)
+		}
+		err := s.app.DB.QueryRow(ctx, `SELECT id FROM users WHERE `+col+`=$1`, v).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		if err != nil {
+			return nil, status.Error(codes.Internal, "user lookup failed")
+		}
+	} else if _, err := uuid.Parse(id); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id must be a uuid")
+	}
+
+	u, err := s.app.userByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "user lookup failed")
+	}
+	return &internalpb.GetUserResponse{User: &internalpb.User{
+		Id:          u.ID,
+		Email:       u.Email,
+		Username:    deref(u.Username),
+		DisplayName: deref(u.DisplayName),
+		Role:        u.Role,
+		Status:      u.Status,
+		Frozen:      u.Frozen,
+		CreatedAt:   timestamppb.New(u.CreatedAt),
+	}}, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
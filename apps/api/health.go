@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	mydb "github.com/sudo-init-do/okies-backend/pkg/db"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+)
+
+// Health checks. /healthz is liveness: the process is up and can reach
+// Postgres. /readyz checks every dependency. A failing critical check
+// (Postgres, migrations) makes the endpoint return 503; anything else only
+// marks the report "degraded", since the API still serves without it.
+
+const healthCheckTimeout = 2 * time.Second
+
+var (
+	errRedisDisabled    = errors.New("redis unreachable at startup")
+	errMigrationDirty   = errors.New("schema is dirty; a migration failed part way")
+	errMigrationPending = errors.New("migrations pending")
+	errSchemaDrift      = errors.New("schema is missing what this binary expects")
+	errQueueStalled     = errors.New("runnable jobs are not being picked up")
+)
+
+type healthCheck struct {
+	name     string
+	critical bool
+	run      func(ctx context.Context) (details any, skipped bool, err error)
+}
+
+type checkResult struct {
+	Status    string  `json:"status"` // ok | down | skipped
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+	Details   any     `json:"details,omitempty"`
+}
+
+type healthReport struct {
+	Status string                 `json:"status"` // ok | degraded | down
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// runHealthChecks runs checks concurrently, each with its own timeout.
+func runHealthChecks(ctx context.Context, checks []healthCheck) healthReport {
+	rep := healthReport{Status: "ok", Checks: make(map[string]checkResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			details, skipped, err := c.run(cctx)
+			res := checkResult{
+				Status:    "ok",
+				Critical:  c.critical,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Details:   details,
+			}
+			switch {
+			case skipped:
+				res.Status = "skipped"
+			case err != nil:
+				res.Status = "down"
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			rep.Checks[c.name] = res
+			if res.Status == "down" {
+				if c.critical {
+					rep.Status = "down"
+				} else if rep.Status == "ok" {
+					rep.Status = "degraded"
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return rep
+}
+
+func (app *App) writeHealth(w http.ResponseWriter, r *http.Request, checks []healthCheck) {
+	rep := runHealthChecks(r.Context(), checks)
+	// error text can name internal hosts; only operators see it
+	if tok := app.Config.MetricsToken; tok != "" && r.Header.Get("Authorization") != "Bearer "+tok {
+		for name, c := range rep.Checks {
+			c.Error = ""
+			rep.Checks[name] = c
+		}
+	}
+	status := http.StatusOK
+	if rep.Status == "down" {
+		status = http.StatusServiceUnavailable
+		log.Ctx(r.Context()).Warn().Interface("checks", rep.Checks).Str("path", r.URL.Path).Msg("health check failed")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, rep)
+}
+
+// GET /healthz
+func (app *App) Healthz(w http.ResponseWriter, r *http.Request) {
+	app.writeHealth(w, r, []healthCheck{app.checkPostgres()})
+}
+
+// GET /readyz
+func (app *App) Readyz(w http.ResponseWriter, r *http.Request) {
+	app.writeHealth(w, r, []healthCheck{
+		app.checkPostgres(),
+		app.checkReplica(),
+		app.checkRedis(),
+		app.checkMigrations(),
+		app.checkSchemaHealth(),
+		app.checkJobQueue(),
+		app.checkFlutterwave(),
+	})
+}
+
+func (app *App) checkPostgres() healthCheck {
+	return healthCheck{name: "postgres", critical: true, run: func(ctx context.Context) (any, bool, error) {
+		if err := app.DB.Ping(ctx); err != nil {
+			return nil, false, err
+		}
+		s := app.DB.Stat()
+		return map[string]any{"totalConns": s.TotalConns(), "idleConns": s.IdleConns(), "maxConns": s.MaxConns()}, false, nil
+	}}
+}
+
+func (app *App) checkReplica() healthCheck {
+	return healthCheck{name: "postgres_replica", run: func(ctx context.Context) (any, bool, error) {
+		if app.Config.DatabaseReplicaURL == "" {
+			return nil, true, nil
+		}
+		lag, err := app.Reads.Lag(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		return map[string]any{"lagSeconds": lag.Seconds(), "inUse": app.Reads.Replica()}, false, nil
+	}}
+}
+
+func (app *App) checkRedis() healthCheck {
+	return healthCheck{name: "redis", run: func(ctx context.Context) (any, bool, error) {
+		if app.Redis == nil {
+			// startup found Redis unreachable; rate limiting and cache are off
+			return nil, false, errRedisDisabled
+		}
+		return nil, false, app.Redis.Ping(ctx).Err()
+	}}
+}
+
+func (app *App) checkMigrations() healthCheck {
+	return healthCheck{name: "migrations", critical: true, run: func(ctx context.Context) (any, bool, error) {
+		st, err := mydb.Migrations(ctx, app.DB)
+		if err != nil {
+			return nil, false, err
+		}
+		switch {
+		case st.Dirty:
+			return st, false, errMigrationDirty
+		case st.Pending():
+			return st, false, errMigrationPending
+		}
+		return st, false, nil
+	}}
+}
+
+// queueStallAfter is how long a runnable job may wait before the queue is
+// reported down, which usually means no worker is running.
+const queueStallAfter = 5 * time.Minute
+
+func (app *App) checkJobQueue() healthCheck {
+	return healthCheck{name: "job_queue", run: func(ctx context.Context) (any, bool, error) {
+		var pending, running, dead int64
+		var oldest float64
+		if err := app.DB.QueryRow(ctx, `
+			SELECT COUNT(*) FILTER (WHERE status='pending'),
+			       COUNT(*) FILTER (WHERE status='running'),
+			       COUNT(*) FILTER (WHERE status='dead'),
+			       COALESCE(EXTRACT(EPOCH FROM now() - MIN(run_at) FILTER (WHERE status='pending' AND run_at <= now())), 0)
+			FROM jobs WHERE status IN ('pending','running','dead')
+		`).Scan(&pending, &running, &dead, &oldest); err != nil {
+			return nil, false, err
+		}
+		details := map[string]any{"pending": pending, "running": running, "dead": dead, "oldestPendingSeconds": oldest}
+		if time.Duration(oldest*float64(time.Second)) > queueStallAfter {
+			return details, false, errQueueStalled
+		}
+		return details, false, nil
+	}}
+}
+
+// probeClient never retries: a probe should report what it saw.
+var probeClient = httpclient.New("health_probe", httpclient.Options{Timeout: healthCheckTimeout})
+
+// Flutterwave reachability is cached so frequent probes don't turn into a
+// request to the provider each.
+var flwProbe struct {
+	sync.Mutex
+	at  time.Time
+	err error
+}
+
+func (app *App) checkFlutterwave() healthCheck {
+	return healthCheck{name: "flutterwave", run: func(ctx context.Context) (any, bool, error) {
+		if app.Config.Flutterwave.SecretKey == "" {
+			return nil, true, nil
+		}
+		flwProbe.Lock()
+		defer flwProbe.Unlock()
+		if time.Since(flwProbe.at) < 30*time.Second {
+			return map[string]any{"cached": true}, false, flwProbe.err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, app.Config.Flutterwave.BaseURL, nil)
+		if err == nil {
+			var res *http.Response
+			// any HTTP answer means the network path and TLS work
+			if res, err = probeClient.Do(req); err == nil {
+				res.Body.Close()
+			}
+		}
+		flwProbe.at, flwProbe.err = time.Now(), err
+		return nil, false, err
+	}}
+}
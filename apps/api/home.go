@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+// homeTransactions and homeNotifications bound the lists on the home
+// screen; the full lists have their own endpoints.
+const (
+	homeTransactions  = 10
+	homeNotifications = 20
+)
+
+// GET /v1/home
+// What the app shows at start-up in one call: the wallet, recent
+// transactions, withdrawals still in flight and unread notifications. Each
+// part has the same shape as its own endpoint.
+func (app *App) GetHome(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	ctx := r.Context()
+
+	walletID, err := app.walletIDForUser(ctx, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "wallet_not_found"))
+		return
+	}
+	balance, err := app.walletBalance(ctx, walletID)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("home wallet balance failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	txs, err := app.walletTransactions(ctx, walletID, app.userLocation(ctx, uid), homeTransactions, 0)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("home transactions failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if txs == nil {
+		txs = []TxDTO{}
+	}
+
+	rows, err := app.DB.Query(ctx, `
+		SELECT id, destination_id, amount, status, reference, created_at
+		FROM payouts
+		WHERE user_id=$1 AND status IN ('pending','approved','processing')
+		ORDER BY created_at DESC
+	`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	withdrawals := []withdrawalDTO{}
+	for rows.Next() {
+		var d withdrawalDTO
+		if err := rows.Scan(&d.ID, &d.Destination, &d.Amount, &d.Status, &d.Reference, &d.CreatedAt); err != nil {
+			rows.Close()
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		withdrawals = append(withdrawals, d)
+	}
+	rows.Close()
+
+	notifications, err := app.listNotifications(ctx, uid, true, homeNotifications)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("home notifications failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	var unread int64
+	if err := app.DB.QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications WHERE user_id=$1 AND read_at IS NULL
+	`, uid).Scan(&unread); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"wallet":             WalletDTO{Balance: balance, Currency: "NGN"},
+		"transactions":       txs,
+		"pendingWithdrawals": withdrawals,
+		"notifications":      map[string]any{"unreadCount": unread, "items": notifications},
+	}})
+}
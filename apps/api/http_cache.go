@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Response compression and HTTP caching, for mobile clients on slow
+// networks.
+
+// compressor encodes JSON and CSV responses with brotli or gzip, whichever
+// the client prefers (brotli when it accepts both). Event streams and files
+// already compressed are left alone.
+func compressor() func(http.Handler) http.Handler {
+	c := middleware.NewCompressor(5, "application/json", "application/problem+json", "text/csv")
+	c.SetEncoder("br", func(w io.Writer, level int) io.Writer {
+		return brotli.NewWriterLevel(w, level)
+	})
+	return c.Handler
+}
+
+// Cacheable lets clients and shared caches keep a GET response for maxAge
+// and revalidate it with If-None-Match. The ETag hashes the uncompressed
+// body, so it is weak: the same content may be sent with different
+// encodings. Only 200s are cached; errors pass through untouched. Use it on
+// responses that are the same for every caller unless private is set.
+//
+// With maxAge 0 clients revalidate on every use; that suits per-user data
+// the apps poll (wallet, transactions, gifts), where an unchanged response
+// costs a 304 and no body.
+func Cacheable(maxAge time.Duration, private bool) func(http.Handler) http.Handler {
+	scope := "public"
+	if private {
+		scope = "private"
+	}
+	cacheControl := fmt.Sprintf("%s, max-age=%d", scope, int(maxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			buf := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(buf, r)
+
+			h := w.Header()
+			for k, v := range buf.header {
+				h[k] = v
+			}
+			if buf.status != http.StatusOK {
+				w.WriteHeader(buf.status)
+				w.Write(buf.body.Bytes())
+				return
+			}
+			etag := contentETag(buf.body.Bytes())
+			h.Set("ETag", etag)
+			h.Set("Cache-Control", cacheControl)
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				h.Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write(buf.body.Bytes())
+		})
+	}
+}
+
+// contentETag is a weak validator for body.
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches applies If-None-Match's weak comparison.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponse holds a response until its ETag is known.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+	"github.com/sudo-init-do/okies-backend/pkg/idtoken"
+)
+
+// Ways into an account. Email and password is always one; a verified phone
+// number (phone.go) and any linked Google or Apple accounts are the others.
+// Linking needs a fresh ID token from the provider's sign-in, so only
+// someone who controls both accounts can join them.
+
+// signInProviders verify ID tokens by provider name; a provider without
+// client IDs is absent.
+type signInProviders map[string]*idtoken.Provider
+
+func newSignInProviders(cfg config.SignIn) signInProviders {
+	client := httpclient.New("idtoken", httpclient.Options{Retries: 2})
+	p := signInProviders{}
+	if len(cfg.GoogleClientIDs) > 0 {
+		p["google"] = idtoken.Google(cfg.GoogleClientIDs, client)
+	}
+	if len(cfg.AppleClientIDs) > 0 {
+		p["apple"] = idtoken.Apple(cfg.AppleClientIDs, client)
+	}
+	return p
+}
+
+type identityDTO struct {
+	ID         string     `json:"id"`
+	Provider   string     `json:"provider"`
+	Email      *string    `json:"email,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+type idTokenReq struct {
+	Provider string `json:"provider" validate:"required,oneof=google apple"`
+	IDToken  string `json:"idToken" validate:"required,max=8192"`
+}
+
+// verifyIDToken checks a provider's ID token.
+func (app *App) verifyIDToken(ctx context.Context, provider, raw string) (idtoken.Claims, *apierror.Error) {
+	p, ok := app.SignIn[provider]
+	if !ok {
+		return idtoken.Claims{}, apierror.New(http.StatusServiceUnavailable, "sign_in_unavailable")
+	}
+	c, err := p.Verify(ctx, raw)
+	if errors.Is(err, idtoken.ErrInvalid) {
+		return c, apierror.New(http.StatusUnauthorized, "invalid_id_token")
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("provider", provider).Msg("verify id token failed")
+		return c, apierror.New(http.StatusServiceUnavailable, "sign_in_unavailable").Wrap(err)
+	}
+	return c, nil
+}
+
+// GET /v1/users/me/identities
+func (app *App) ListMyIdentities(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT id, provider, email, created_at, last_used_at
+		FROM user_identities WHERE user_id=$1
+		ORDER BY created_at
+	`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	linked := []identityDTO{}
+	for rows.Next() {
+		var d identityDTO
+		if err := rows.Scan(&d.ID, &d.Provider, &d.Email, &d.CreatedAt, &d.LastUsedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		linked = append(linked, d)
+	}
+	u := app.loadUser(r, uid)
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"email": u.Email, "phone": u.Phone, "linked": linked,
+	}})
+}
+
+// POST /v1/users/me/identities  {"provider":"google","idToken":"..."}
+// Links the provider account the token is for; relinking one already
+// linked here refreshes its email.
+func (app *App) LinkMyIdentity(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body idTokenReq
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	c, e := app.verifyIDToken(r.Context(), body.Provider, body.IDToken)
+	if e != nil {
+		apierror.Write(w, e)
+		return
+	}
+	var d identityDTO
+	err := app.DB.QueryRow(r.Context(), `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1,$2,$3,NULLIF($4,''))
+		ON CONFLICT (provider, subject) DO UPDATE SET email = EXCLUDED.email
+		WHERE user_identities.user_id = EXCLUDED.user_id
+		RETURNING id, provider, email, created_at, last_used_at
+	`, uid, body.Provider, c.Subject, c.Email).Scan(&d.ID, &d.Provider, &d.Email, &d.CreatedAt, &d.LastUsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusConflict, "identity_in_use"))
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("link identity failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.recordSecurityEvent(r, uid, secIdentityLinked, map[string]any{"provider": d.Provider})
+	writeJSON(w, http.StatusCreated, map[string]any{"data": d})
+}
+
+// DELETE /v1/users/me/identities/{id}
+func (app *App) UnlinkMyIdentity(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var provider string
+	err := app.DB.QueryRow(r.Context(), `
+		DELETE FROM user_identities WHERE id::text=$1 AND user_id=$2
+		RETURNING provider
+	`, id, uid).Scan(&provider)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "identity_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.recordSecurityEvent(r, uid, secIdentityUnlinked, map[string]any{"provider": provider})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /v1/auth/identity  {"provider":"apple","idToken":"..."}
+// Logs in like /v1/auth/login with a linked Google or Apple account.
+// Accounts are never created here: sign up, then link.
+func (app *App) IdentityLogin(w http.ResponseWriter, r *http.Request) {
+	var body idTokenReq
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	c, e := app.verifyIDToken(r.Context(), body.Provider, body.IDToken)
+	if e != nil {
+		apierror.Write(w, e)
+		return
+	}
+	var uid string
+	err := app.DB.QueryRow(r.Context(), `
+		UPDATE user_identities SET last_used_at=now()
+		WHERE provider=$1 AND subject=$2
+		RETURNING user_id
+	`, body.Provider, c.Subject).Scan(&uid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "identity_not_linked"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if accountStatusError(w, app.checkAccountActive(r.Context(), uid)) {
+		return
+	}
+	u, err := app.userByID(r.Context(), uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	tokens, err := app.issueTokens(r, uid, u.Role)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("issueTokens failed (identity login)")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_issue_error"))
+		return
+	}
+	app.recordSecurityEvent(r, uid, secLogin, map[string]any{"method": body.Provider})
+	writeJSON(w, http.StatusOK, authResp{Tokens: tokens, User: app.loadUser(r, uid)})
+}
@@ -0,0 +1,441 @@
+//go:build integration
+
+// Integration tests run the API against real Postgres and Redis started in
+// containers, with the mock Flutterwave server standing in for the provider:
+//
+//	go test -tags integration -count=1 ./apps/api
+//
+// They need a Docker daemon. Every test signs up its own users, so tests
+// don't depend on each other or on order.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/cache"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	mydb "github.com/sudo-init-do/okies-backend/pkg/db"
+	"github.com/sudo-init-do/okies-backend/pkg/events"
+	"github.com/sudo-init-do/okies-backend/pkg/flwmock"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+	"github.com/sudo-init-do/okies-backend/pkg/ratelimit"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+const testWebhookHash = "integration-webhook-hash"
+
+// the App and servers every test shares; see TestMain
+var (
+	testApp *App
+	testAPI *httptest.Server
+	testFLW *flwmock.Server
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	os.Exit(runIntegration(m))
+}
+
+func runIntegration(m *testing.M) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pg, err := tcpostgres.Run(ctx, "postgres:16-alpine",
+		tcpostgres.WithDatabase("okies"),
+		tcpostgres.WithUsername("okies"),
+		tcpostgres.WithPassword("okies"),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	defer testcontainers.TerminateContainer(pg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "start postgres:", err)
+		return 1
+	}
+	dsn, err := pg.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "postgres dsn:", err)
+		return 1
+	}
+	rc, err := tcredis.Run(ctx, "redis:7-alpine")
+	defer testcontainers.TerminateContainer(rc)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "start redis:", err)
+		return 1
+	}
+	redisURL, err := rc.ConnectionString(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "redis url:", err)
+		return 1
+	}
+
+	if err := mydb.MigrateUp(dsn); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	pool, err := mydb.OpenPool(ctx, dsn, mydb.DefaultPoolOptions())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "open pool:", err)
+		return 1
+	}
+	defer pool.Close()
+	ropts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "redis url:", err)
+		return 1
+	}
+	rdb := redis.NewClient(ropts)
+	defer rdb.Close()
+
+	// the API's address is only known once it listens, and the mock needs
+	// it for webhooks, so the handler is filled in afterwards
+	var handler http.Handler
+	testAPI = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	defer testAPI.Close()
+	testFLW = flwmock.New(flwmock.Options{
+		WebhookURL:  testAPI.URL + "/v1/webhooks/flutterwave",
+		WebhookHash: testWebhookHash,
+		BalanceKobo: 1_000_000_000_00,
+	})
+	flwSrv := httptest.NewServer(testFLW.Handler())
+	defer flwSrv.Close()
+
+	cfg := &config.Config{
+		Env:               "development",
+		JWTSecret:         []byte("integration-test-secret-at-least-32-bytes"),
+		WorkerConcurrency: 4,
+		ShutdownTimeout:   5 * time.Second,
+		ReplicaMaxLag:     10 * time.Second,
+		Flutterwave:       config.Flutterwave{BaseURL: flwSrv.URL, SecretKey: "test", WebhookHash: testWebhookHash},
+		Encryption: config.Encryption{
+			Provider:    "local",
+			LocalActive: "test",
+			LocalKeys:   map[string][]byte{"test": make([]byte, 32)},
+			IndexKey:    make([]byte, 32),
+		},
+	}
+	cfg.CursorSecret = cfg.JWTSecret
+	sealer, err := newSealer(cfg.Encryption)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sealer:", err)
+		return 1
+	}
+	secretStore, err := newSecretStore(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "secrets:", err)
+		return 1
+	}
+	flw, err := NewFlutterwaveClient(flwSrv.URL, "test", "", nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "flutterwave client:", err)
+		return 1
+	}
+	testApp = &App{
+		DB:          pool,
+		Reads:       mydb.NewRouter(pool, nil, cfg.ReplicaMaxLag),
+		Sealer:      sealer,
+		Config:      cfg,
+		JWT:         a.NewKeyring(cfg.JWTSecret),
+		Secrets:     secretStore,
+		Redis:       rdb,
+		Flutterwave: flw,
+		PartnerHTTP: http.DefaultClient,
+		Settings:    settings.New(pool, rdb),
+		Events:      events.New(rdb),
+		Cache:       cache.New(rdb, "okies:cache:"),
+		Limiter:     ratelimit.New(rdb, "rl:"),
+		Pager:       pagination.New(cfg.CursorSecret),
+		Push:        newPushSenders(cfg.Push),
+	}
+	testApp.guardFlutterwave()
+	testApp.registerSubscribers()
+	go testApp.Events.Run(ctx)
+	go testApp.runWorker(ctx)
+	handler = testApp.routes()
+
+	return m.Run()
+}
+
+// client is one signed-in user talking to the test API. Each client has
+// its own X-Forwarded-For, so per-IP rate limits don't couple tests.
+type client struct {
+	t      testing.TB
+	ip     string
+	token  string
+	UserID string
+	Email  string
+}
+
+func newClient(t testing.TB) *client {
+	return &client{t: t, ip: fmt.Sprintf("10.%d.%d.%d", rand.IntN(256), rand.IntN(256), rand.IntN(254)+1)}
+}
+
+// do sends body as JSON and decodes the response's "data" into out, if
+// given, or the whole response for the few endpoints without an envelope.
+// It returns the status code.
+func (c *client) do(method, path string, body, out any, header ...string) int {
+	c.t.Helper()
+	var rd io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		rd = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, testAPI.URL+path, rd)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-For", c.ip)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	raw, _ := io.ReadAll(res.Body)
+	if out != nil && res.StatusCode < 300 {
+		var env struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &env); err != nil {
+			c.t.Fatalf("%s %s: decode %q: %v", method, path, raw, err)
+		}
+		if env.Data == nil {
+			env.Data = raw
+		}
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			c.t.Fatalf("%s %s: decode data %q: %v", method, path, env.Data, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// must is do, failing the test unless the status is want.
+func (c *client) must(want int, method, path string, body, out any, header ...string) {
+	c.t.Helper()
+	if got := c.do(method, path, body, out, header...); got != want {
+		c.t.Fatalf("%s %s: status %d, want %d", method, path, got, want)
+	}
+}
+
+// signUp registers a fresh user and signs in as them.
+func signUp(t testing.TB) *client {
+	t.Helper()
+	c := newClient(t)
+	c.Email = fmt.Sprintf("it-%d-%d@example.com", time.Now().UnixNano(), rand.IntN(1_000_000))
+	var res authResp
+	c.must(http.StatusCreated, http.MethodPost, "/v1/auth/signup", map[string]any{"email": c.Email, "password": "correct horse battery"}, nil)
+	c.must(http.StatusOK, http.MethodPost, "/v1/auth/login", map[string]any{"email": c.Email, "password": "correct horse battery"}, &res)
+	c.token, c.UserID = res.Tokens.AccessToken, res.User.ID
+	return c
+}
+
+// signUpAdmin registers a user, promotes them to role and signs in again so
+// the token carries it.
+func signUpAdmin(t testing.TB, role string) *client {
+	t.Helper()
+	c := signUp(t)
+	if _, err := testApp.DB.Exec(context.Background(), `UPDATE users SET role=$2 WHERE id=$1`, c.UserID, role); err != nil {
+		t.Fatal(err)
+	}
+	var res authResp
+	c.must(http.StatusOK, http.MethodPost, "/v1/auth/login", map[string]any{"email": c.Email, "password": "correct horse battery"}, &res)
+	c.token = res.Tokens.AccessToken
+	return c
+}
+
+func (c *client) balance() int64 {
+	c.t.Helper()
+	var w WalletDTO
+	c.must(http.StatusOK, http.MethodGet, "/v1/wallet", nil, &w)
+	return w.Balance
+}
+
+// fund tops up c's wallet from the system wallet through the admin API.
+func fund(t testing.TB, admin, c *client, amount int64) {
+	t.Helper()
+	admin.must(http.StatusCreated, http.MethodPost, "/v1/admin/topups", map[string]any{"userId": c.UserID, "amount": amount}, nil)
+}
+
+// eventually polls cond until it holds or timeout passes.
+func eventually(t testing.TB, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func payoutStatus(t testing.TB, id string) string {
+	t.Helper()
+	var status string
+	if err := testApp.DB.QueryRow(context.Background(), `SELECT status FROM payouts WHERE id=$1`, id).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+// withdraw saves a destination for c and requests a withdrawal to it,
+// returning the payout id.
+func withdraw(t testing.TB, c *client, accountNumber string, amount int64) string {
+	t.Helper()
+	var dest struct {
+		ID string `json:"id"`
+	}
+	c.must(http.StatusCreated, http.MethodPost, "/v1/payout-destinations", map[string]any{
+		"bankCode": "058", "accountNumber": accountNumber, "accountName": "Integration Test",
+	}, &dest)
+	var wd struct {
+		PayoutID string `json:"payoutId"`
+	}
+	c.must(http.StatusCreated, http.MethodPost, "/v1/withdrawals", map[string]any{"destinationId": dest.ID, "amount": amount}, &wd)
+	return wd.PayoutID
+}
+
+// TestMoneyFlow walks one naira amount through the whole product: sign-up,
+// top-up, gift, withdrawal, approval, provider transfer and the settling
+// webhook.
+func TestMoneyFlow(t *testing.T) {
+	admin := signUpAdmin(t, "superadmin")
+	alice, bob := signUp(t), signUp(t)
+
+	fund(t, admin, alice, 20_000_00)
+	if got := alice.balance(); got != 20_000_00 {
+		t.Fatalf("alice balance after top-up = %d, want %d", got, 20_000_00)
+	}
+
+	var gift giftResp
+	alice.must(http.StatusCreated, http.MethodPost, "/v1/gifts", map[string]any{"recipientUserId": bob.UserID, "amount": 5_000_00}, &gift)
+	if a, b := alice.balance(), bob.balance(); a != 15_000_00 || b != 5_000_00 {
+		t.Fatalf("balances after gift = %d/%d, want %d/%d", a, b, 15_000_00, 5_000_00)
+	}
+
+	// a replayed gift with the same key moves no more money
+	key := "it-gift-" + alice.UserID
+	alice.must(http.StatusCreated, http.MethodPost, "/v1/gifts", map[string]any{"recipientUserId": bob.UserID, "amount": 1_000_00}, nil, "Idempotency-Key", key)
+	alice.must(http.StatusOK, http.MethodPost, "/v1/gifts", map[string]any{"recipientUserId": bob.UserID, "amount": 1_000_00}, nil, "Idempotency-Key", key)
+	if b := bob.balance(); b != 6_000_00 {
+		t.Fatalf("bob balance after replayed gift = %d, want %d", b, 6_000_00)
+	}
+
+	payoutID := withdraw(t, bob, "0123456789", 4_000_00)
+	if b := bob.balance(); b != 2_000_00 {
+		t.Fatalf("bob balance with withdrawal reserved = %d, want %d", b, 2_000_00)
+	}
+	admin.must(http.StatusOK, http.MethodPost, "/v1/admin/withdrawals/"+payoutID+"/approve", nil, nil)
+
+	eventually(t, 30*time.Second, "payout to settle", func() bool { return payoutStatus(t, payoutID) == "succeeded" })
+	if b := bob.balance(); b != 2_000_00 {
+		t.Fatalf("bob balance after payout = %d, want %d", b, 2_000_00)
+	}
+}
+
+// TestWithdrawalRejectedByProvider checks that a transfer the provider
+// refuses outright fails the payout and returns the money.
+func TestWithdrawalRejectedByProvider(t *testing.T) {
+	admin := signUpAdmin(t, "superadmin")
+	carol := signUp(t)
+	fund(t, admin, carol, 10_000_00)
+
+	// flwmock rejects 9999xxxxxx accounts with a 400
+	payoutID := withdraw(t, carol, "9999000001", 3_000_00)
+	admin.must(http.StatusOK, http.MethodPost, "/v1/admin/withdrawals/"+payoutID+"/approve", nil, nil)
+
+	eventually(t, 30*time.Second, "payout to fail", func() bool { return payoutStatus(t, payoutID) == "failed" })
+	eventually(t, 10*time.Second, "refund", func() bool { return carol.balance() == 10_000_00 })
+
+	// once sent to the provider it is past rejecting
+	admin.must(http.StatusConflict, http.MethodPost, "/v1/admin/withdrawals/"+payoutID+"/reject", nil, nil)
+}
+
+// TestAdminRejectRefunds checks that rejecting a pending withdrawal
+// returns the reserved amount.
+func TestAdminRejectRefunds(t *testing.T) {
+	admin := signUpAdmin(t, "superadmin")
+	dave := signUp(t)
+	fund(t, admin, dave, 8_000_00)
+
+	payoutID := withdraw(t, dave, "0123456700", 8_000_00)
+	if b := dave.balance(); b != 0 {
+		t.Fatalf("balance with withdrawal reserved = %d, want 0", b)
+	}
+	admin.must(http.StatusOK, http.MethodPost, "/v1/admin/withdrawals/"+payoutID+"/reject", nil, nil)
+	if b := dave.balance(); b != 8_000_00 {
+		t.Fatalf("balance after rejection = %d, want %d", b, 8_000_00)
+	}
+}
+
+// TestRefreshTokenIsNotAccessToken checks that a refresh token, here one
+// already revoked by logging out, can't stand in for an access token.
+func TestRefreshTokenIsNotAccessToken(t *testing.T) {
+	erin := signUp(t)
+	var res authResp
+	erin.must(http.StatusOK, http.MethodPost, "/v1/auth/login", map[string]any{"email": erin.Email, "password": "correct horse battery"}, &res)
+	erin.token = res.Tokens.AccessToken
+	erin.must(http.StatusNoContent, http.MethodPost, "/v1/auth/logout", map[string]any{"refreshToken": res.Tokens.RefreshToken}, nil)
+
+	erin.token = res.Tokens.RefreshToken
+	erin.must(http.StatusUnauthorized, http.MethodGet, "/v1/wallet", nil, nil)
+}
+
+// TestRevokeSessionSignsDeviceOut checks that signing a device out from
+// another refuses both of its tokens.
+func TestRevokeSessionSignsDeviceOut(t *testing.T) {
+	phone := signUp(t)
+	laptop := newClient(t)
+	var res authResp
+	laptop.must(http.StatusOK, http.MethodPost, "/v1/auth/login", map[string]any{"email": phone.Email, "password": "correct horse battery"}, &res)
+	laptop.token = res.Tokens.AccessToken
+	laptop.must(http.StatusOK, http.MethodGet, "/v1/wallet", nil, nil)
+
+	var sessions []sessionDTO
+	phone.must(http.StatusOK, http.MethodGet, "/v1/auth/sessions", nil, &sessions)
+	claims, err := a.ParseRefresh(testApp.JWT, res.Tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, s := range sessions {
+		found = found || s.ID == claims.ID
+	}
+	if !found {
+		t.Fatalf("laptop session %s not listed in %+v", claims.ID, sessions)
+	}
+	phone.must(http.StatusNoContent, http.MethodDelete, "/v1/auth/sessions/"+claims.ID, nil, nil)
+
+	laptop.must(http.StatusUnauthorized, http.MethodGet, "/v1/wallet", nil, nil)
+	laptop.token = res.Tokens.RefreshToken
+	laptop.must(http.StatusUnauthorized, http.MethodGet, "/v1/wallet", nil, nil)
+	laptop.token = ""
+	laptop.must(http.StatusUnauthorized, http.MethodPost, "/v1/auth/refresh", map[string]any{"refreshToken": res.Tokens.RefreshToken}, nil)
+	phone.must(http.StatusOK, http.MethodGet, "/v1/wallet", nil, nil)
+}
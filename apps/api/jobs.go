@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+)
+
+// Background jobs. The API enqueues; `api worker` runs them. Handlers live
+// next to the feature they serve.
+
+const (
+	jobPayoutSubmit      = "payout.submit"       // {"payoutId"}
+	jobFlutterwaveEvent  = "webhook.flutterwave" // {"eventId"}
+	jobStatementGenerate = "statement.generate"  // {"statementId"}
+	jobScheduledGift     = "gift.scheduled"      // {"scheduledGiftId"}
+)
+
+// runWorker works the job queue until ctx is cancelled, then lets running
+// jobs (payout submissions, webhook processing) finish.
+func (app *App) runWorker(ctx context.Context) {
+	w := jobs.NewWorker(app.DB, app.Config.WorkerConcurrency)
+	w.DrainTimeout = app.Config.ShutdownTimeout
+	w.Handle(jobPayoutSubmit, app.submitPayoutJob)
+	w.Handle(jobFlutterwaveEvent, app.flutterwaveEventJob)
+	w.Handle(jobStatementGenerate, app.generateStatementJob)
+	w.Handle(jobScheduledGift, app.scheduledGiftJob)
+	w.Handle(jobPushSend, app.sendPushJob)
+	w.Handle(jobEmailSend, app.sendEmailJob)
+	w.Handle(jobSMSSend, app.sendSMSJob)
+	w.Handle(jobSMSPrice, app.smsPriceJob)
+	w.Handle(jobPartnerWebhook, app.partnerWebhookJob)
+	w.Handle(jobAccountingExport, app.accountingExportJob)
+	w.Handle(jobDirectDebitSubmit, app.submitDirectDebitJob)
+	w.Handle(jobOpenBankingEvent, app.openBankingEventJob)
+	w.Handle(jobAccountErase, app.accountEraseJob)
+	w.OnDead = func(ctx context.Context, j *jobs.Job, err error) {
+		app.raiseAlert(ctx, alert{
+			Name:     "job_dead_lettered",
+			Severity: "critical",
+			Message:  "background job exhausted its retries",
+			Fields:   map[string]any{"job_id": j.ID, "kind": j.Kind, "attempts": j.Attempt, "error": err.Error()},
+		})
+	}
+	w.Run(ctx)
+}
+
+// runJobMetrics exports queue depth gauges every interval. It runs in the
+// API process, which already serves /metrics.
+func (app *App) runJobMetrics(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		stats, err := jobs.Stats(ctx, app.DB)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("job stats failed")
+		} else {
+			gauges.ResetFamily("okies_jobs")
+			gauges.ResetFamily("okies_jobs_oldest_pending_seconds")
+			for _, s := range stats {
+				gauges.SetLabeled("okies_jobs", "Jobs by kind and status.", float64(s.Count), "kind", s.Kind, "status", s.Status)
+				if s.Status == "pending" {
+					age := time.Since(s.Oldest).Seconds()
+					if age < 0 {
+						age = 0 // scheduled for later
+					}
+					gauges.SetLabeled("okies_jobs_oldest_pending_seconds", "Age of the oldest runnable pending job.", age, "kind", s.Kind)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ---------- Handlers (Admin) ----------
+
+type jobDTO struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"`
+	Payload     any       `json:"payload"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"maxAttempts"`
+	RunAt       time.Time `json:"runAt"`
+	LastError   *string   `json:"lastError,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// GET /v1/admin/jobs?status=dead&kind=
+// Queue counts plus the most recent jobs matching the filter.
+func (app *App) AdminListJobs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats, err := jobs.Stats(ctx, app.DB)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	q := r.URL.Query()
+	status := strings.TrimSpace(q.Get("status"))
+	if status == "" {
+		status = "dead"
+	}
+	rows, err := app.DB.Query(ctx, `
+		SELECT id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at
+		FROM jobs
+		WHERE status = $1 AND ($2 = '' OR kind = $2)
+		ORDER BY created_at DESC
+		LIMIT 200
+	`, status, strings.TrimSpace(q.Get("kind")))
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []jobDTO{}
+	for rows.Next() {
+		var j jobDTO
+		if err := rows.Scan(&j.ID, &j.Kind, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.RunAt, &j.LastError, &j.CreatedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, j)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"stats": stats, "jobs": out}})
+}
+
+// POST /v1/admin/jobs/{id}/retry — requeue a dead-lettered job
+func (app *App) AdminRetryJob(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	ok, err := jobs.Retry(r.Context(), app.DB, id)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "job_not_dead"))
+		return
+	}
+	app.audit(r, auditEntry{
+		Action:     "job.retry",
+		TargetType: "job",
+		TargetID:   id,
+		After:      map[string]any{"status": "pending"},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"id": id, "status": "pending"}})
+}
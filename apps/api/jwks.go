@@ -0,0 +1,14 @@
+package main
+
+import "net/http"
+
+// GET /.well-known/jwks.json
+// The public keys access tokens are signed with, for services that verify
+// them without sharing a secret. Empty while tokens are signed with HMAC
+// secrets. Caches may hold it for a few minutes, so publish a new key as a
+// previous one before making it current.
+func (app *App) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(app.JWT.JWKS())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/i18n"
+)
+
+// Response language. Language negotiates from Accept-Language; when the
+// client sends none, AuthMiddleware falls back to the user's saved
+// preference. The choice travels in the Content-Language response header,
+// which apierror.Write reads, so handlers don't need to pass it around.
+// Notifications have no request and always use the saved preference.
+
+// Language sets Content-Language from the request's Accept-Language.
+func Language(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Language")
+		if lang := i18n.Negotiate(r.Header.Get("Accept-Language")); lang != "" {
+			w.Header().Set(i18n.Header, lang)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// applyPreferredLanguage sets Content-Language from userID's preference
+// unless the request already negotiated one.
+func (app *App) applyPreferredLanguage(w http.ResponseWriter, ctx context.Context, userID string) {
+	if w.Header().Get(i18n.Header) != "" {
+		return
+	}
+	if u, err := app.userByID(ctx, userID); err == nil && u.Language != nil {
+		w.Header().Set(i18n.Header, *u.Language)
+	}
+}
+
+// userLanguage is userID's preferred language, English when unset.
+func (app *App) userLanguage(ctx context.Context, userID string) string {
+	return app.userPreferences(ctx, userID).language()
+}
+
+// PUT /v1/users/me/language  {"language":"yo"} — null clears the preference
+func (app *App) SetMyLanguage(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		Language *string `json:"language" validate:"omitempty,oneof=en pcm yo ha ig"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if _, err := app.DB.Exec(r.Context(), `UPDATE users SET language=$2 WHERE id=$1`, uid, body.Language); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("update language failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(r.Context(), uid)
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"language": body.Language}})
+}
@@ -0,0 +1,220 @@
+//go:build integration
+
+// Ledger throughput benchmarks. They share the containers from TestMain:
+//
+//	go test -tags integration -run '^$' -bench Ledger -benchtime 2000x ./apps/api
+//
+// Besides ns/op every benchmark reports lock-waiters, the average number of
+// backends blocked on a row or transaction lock while it ran, and errors/op.
+// Compare the disjoint and contended variants to see how much of a transfer's
+// cost is queueing on a shared wallet.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// the amount every benchmarked transfer moves, and what each sending wallet
+// is funded with so it never runs dry
+const (
+	benchAmount  = 100_00
+	benchFunding = 100_000_000_00
+)
+
+// BenchmarkLedgerGiftDisjoint sends gifts between pairs of users that share
+// nothing, the baseline for the contended cases.
+func BenchmarkLedgerGiftDisjoint(b *testing.B) {
+	flagOnlyFraud(b)
+	admin := signUpAdmin(b, "superadmin")
+	var next atomic.Int64
+	pairs := benchPairs(b, admin, false)
+	benchRun(b, func() error {
+		p := pairs[int(next.Add(1))%len(pairs)]
+		return benchGift(p[0], p[1])
+	})
+}
+
+// BenchmarkLedgerGiftHotRecipient has every sender gift the same user, so
+// all transfers queue on one wallet lock.
+func BenchmarkLedgerGiftHotRecipient(b *testing.B) {
+	flagOnlyFraud(b)
+	admin := signUpAdmin(b, "superadmin")
+	var next atomic.Int64
+	pairs := benchPairs(b, admin, true)
+	benchRun(b, func() error {
+		p := pairs[int(next.Add(1))%len(pairs)]
+		return benchGift(p[0], p[1])
+	})
+}
+
+// BenchmarkLedgerWithdrawal creates withdrawals from many users. Each one
+// credits the system wallet, which is the contention point the
+// materialized-balance work is meant to remove.
+func BenchmarkLedgerWithdrawal(b *testing.B) {
+	flagOnlyFraud(b)
+	admin := signUpAdmin(b, "superadmin")
+	type sender struct {
+		c    *client
+		dest string
+	}
+	senders := make([]sender, benchWorkers())
+	for i := range senders {
+		c := signUp(b)
+		fund(b, admin, c, benchFunding)
+		var dest struct {
+			ID string `json:"id"`
+		}
+		c.must(http.StatusCreated, http.MethodPost, "/v1/payout-destinations", map[string]any{
+			"bankCode": "058", "accountNumber": fmt.Sprintf("01%08d", i), "accountName": "Benchmark",
+		}, &dest)
+		senders[i] = sender{c, dest.ID}
+	}
+	var next atomic.Int64
+	benchRun(b, func() error {
+		s := senders[int(next.Add(1))%len(senders)]
+		if code := s.c.do(http.MethodPost, "/v1/withdrawals", map[string]any{"destinationId": s.dest, "amount": benchAmount}, nil); code != http.StatusCreated {
+			return fmt.Errorf("withdrawal status %d", code)
+		}
+		return nil
+	})
+}
+
+// BenchmarkLedgerMixed runs gifts and withdrawals together, the shape of
+// production traffic.
+func BenchmarkLedgerMixed(b *testing.B) {
+	flagOnlyFraud(b)
+	admin := signUpAdmin(b, "superadmin")
+	pairs := benchPairs(b, admin, false)
+	dests := make([]string, len(pairs))
+	for i, p := range pairs {
+		var dest struct {
+			ID string `json:"id"`
+		}
+		p[0].must(http.StatusCreated, http.MethodPost, "/v1/payout-destinations", map[string]any{
+			"bankCode": "058", "accountNumber": fmt.Sprintf("02%08d", i), "accountName": "Benchmark",
+		}, &dest)
+		dests[i] = dest.ID
+	}
+	var next atomic.Int64
+	benchRun(b, func() error {
+		n := int(next.Add(1))
+		i := n % len(pairs)
+		if n%2 == 0 {
+			return benchGift(pairs[i][0], pairs[i][1])
+		}
+		if code := pairs[i][0].do(http.MethodPost, "/v1/withdrawals", map[string]any{"destinationId": dests[i], "amount": benchAmount}, nil); code != http.StatusCreated {
+			return fmt.Errorf("withdrawal status %d", code)
+		}
+		return nil
+	})
+}
+
+// benchWorkers is how many goroutines RunParallel starts, so there are
+// about as many senders as concurrent transfers.
+func benchWorkers() int {
+	return runtime.GOMAXPROCS(0)
+}
+
+// benchPairs signs up one funded sender per worker, each with its own
+// recipient or, when hot, all sharing one.
+func benchPairs(b *testing.B, admin *client, hot bool) [][2]*client {
+	b.Helper()
+	var shared *client
+	if hot {
+		shared = signUp(b)
+	}
+	pairs := make([][2]*client, benchWorkers())
+	for i := range pairs {
+		from, to := signUp(b), shared
+		if to == nil {
+			to = signUp(b)
+		}
+		fund(b, admin, from, benchFunding)
+		pairs[i] = [2]*client{from, to}
+	}
+	return pairs
+}
+
+// benchGift calls the gift path below the HTTP layer, so the per-user gift
+// rate limit doesn't cap the benchmark.
+func benchGift(from, to *client) error {
+	ev := fraudEvent{Event: "gift", UserID: from.UserID, CounterpartyID: to.UserID, Amount: benchAmount, SubjectType: "transaction"}
+	res, _, err := testApp.sendGift(context.Background(), ev, uuid.NewString())
+	if err != nil {
+		return err
+	}
+	if res.Status != "succeeded" {
+		return fmt.Errorf("gift %s", res.Status)
+	}
+	return nil
+}
+
+// benchRun times op across parallel workers while sampling lock waits.
+func benchRun(b *testing.B, op func() error) {
+	b.Helper()
+	var failed atomic.Int64
+	stop := sampleLockWaits(b)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := op(); err != nil {
+				if failed.Add(1) == 1 {
+					b.Log(err)
+				}
+			}
+		}
+	})
+	b.StopTimer()
+	b.ReportMetric(stop(), "lock-waiters")
+	b.ReportMetric(float64(failed.Load())/float64(b.N), "errors/op")
+}
+
+// sampleLockWaits polls pg_stat_activity for backends waiting on a lock
+// until the returned func is called, which reports the average count.
+func sampleLockWaits(b *testing.B) func() float64 {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	var samples, waiting int64
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tick := time.NewTicker(5 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+			}
+			var n int64
+			if err := testApp.DB.QueryRow(ctx, `
+				SELECT count(*) FROM pg_stat_activity
+				WHERE datname = current_database() AND wait_event_type = 'Lock'
+			`).Scan(&n); err != nil {
+				if ctx.Err() == nil {
+					b.Log("sample lock waits:", err)
+				}
+				return
+			}
+			samples++
+			waiting += n
+		}
+	}()
+	return func() float64 {
+		cancel()
+		wg.Wait()
+		if samples == 0 {
+			return 0
+		}
+		return float64(waiting) / float64(samples)
+	}
+}
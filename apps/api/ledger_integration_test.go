@@ -0,0 +1,178 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentGiftsNeverOverdraw races more gifts than the sender can
+// afford: exactly as many as the balance covers may succeed, the rest must
+// fail with insufficient_funds, and no money may appear or vanish.
+func TestConcurrentGiftsNeverOverdraw(t *testing.T) {
+	admin := signUpAdmin(t, "superadmin")
+	sender, recipient := signUp(t), signUp(t)
+	const amount, affordable, attempts = 1_000_00, 10, 25
+	fund(t, admin, sender, amount*affordable)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, attempts)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- sender.do(http.MethodPost, "/v1/gifts", map[string]any{"recipientUserId": recipient.UserID, "amount": amount}, nil)
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created, refused := 0, 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusBadRequest:
+			refused++
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if created != affordable || refused != attempts-affordable {
+		t.Fatalf("created %d, refused %d; want %d and %d", created, refused, affordable, attempts-affordable)
+	}
+	if s, r := sender.balance(), recipient.balance(); s != 0 || r != amount*affordable {
+		t.Fatalf("balances = %d/%d, want 0/%d", s, r, amount*affordable)
+	}
+	assertLedgerBalanced(t)
+}
+
+// TestOpposingGiftsDontDeadlock sends gifts both ways between two users at
+// once. Wallet locks are taken in id order, so every gift must go through.
+func TestOpposingGiftsDontDeadlock(t *testing.T) {
+	flagOnlyFraud(t)
+	admin := signUpAdmin(t, "superadmin")
+	a, b := signUp(t), signUp(t)
+	const amount, each = 100_00, 20
+	fund(t, admin, a, amount*each)
+	fund(t, admin, b, amount*each)
+
+	var wg sync.WaitGroup
+	for range each {
+		for _, pair := range [][2]*client{{a, b}, {b, a}} {
+			wg.Add(1)
+			go func(from, to *client) {
+				defer wg.Done()
+				if code := from.do(http.MethodPost, "/v1/gifts", map[string]any{"recipientUserId": to.UserID, "amount": amount}, nil); code != http.StatusCreated {
+					t.Errorf("gift status %d", code)
+				}
+			}(pair[0], pair[1])
+		}
+	}
+	wg.Wait()
+
+	if ab, bb := a.balance(), b.balance(); ab+bb != 2*amount*each {
+		t.Fatalf("balances %d + %d, want a total of %d", ab, bb, 2*amount*each)
+	}
+	assertLedgerBalanced(t)
+}
+
+// TestConcurrentWithdrawalsAndGifts withdraws and gifts from one wallet at
+// the same time; both paths lock the sender's wallet, and it must never go
+// below zero.
+func TestConcurrentWithdrawalsAndGifts(t *testing.T) {
+	admin := signUpAdmin(t, "superadmin")
+	sender, recipient := signUp(t), signUp(t)
+	const amount, attempts = 1_000_00, 10
+	fund(t, admin, sender, amount*attempts)
+
+	var dest struct {
+		ID string `json:"id"`
+	}
+	sender.must(http.StatusCreated, http.MethodPost, "/v1/payout-destinations", map[string]any{
+		"bankCode": "058", "accountNumber": "0123456711", "accountName": "Integration Test",
+	}, &dest)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	moved := int64(0)
+	for i := range 2 * attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var code int
+			if i%2 == 0 {
+				code = sender.do(http.MethodPost, "/v1/withdrawals", map[string]any{"destinationId": dest.ID, "amount": amount}, nil)
+			} else {
+				code = sender.do(http.MethodPost, "/v1/gifts", map[string]any{"recipientUserId": recipient.UserID, "amount": amount}, nil)
+			}
+			switch code {
+			case http.StatusCreated:
+				mu.Lock()
+				moved += amount
+				mu.Unlock()
+			case http.StatusBadRequest:
+			default:
+				t.Errorf("unexpected status %d", code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if moved != amount*attempts {
+		t.Fatalf("moved %d, want exactly the funded %d", moved, amount*attempts)
+	}
+	if s := sender.balance(); s != 0 {
+		t.Fatalf("sender balance = %d, want 0", s)
+	}
+	assertLedgerBalanced(t)
+}
+
+// flagOnlyFraud turns fraud rules that hold money into flag-only ones for
+// the rest of the test, so traffic that looks circular still settles.
+func flagOnlyFraud(t testing.TB) {
+	t.Helper()
+	ctx := context.Background()
+	rows, err := testApp.DB.Query(ctx, `UPDATE fraud_rules SET action='flag' WHERE action='hold' RETURNING id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := testApp.DB.Exec(ctx, `UPDATE fraud_rules SET action='hold' WHERE id::text = ANY($1)`, ids); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// assertLedgerBalanced checks the double-entry invariant: every
+// transaction's debits equal its credits.
+func assertLedgerBalanced(t *testing.T) {
+	t.Helper()
+	var unbalanced int
+	if err := testApp.DB.QueryRow(context.Background(), `
+		SELECT count(*) FROM (
+			SELECT tx_id FROM ledger_entries
+			GROUP BY tx_id
+			HAVING sum(CASE WHEN direction='credit' THEN amount ELSE -amount END) <> 0
+		) t
+	`).Scan(&unbalanced); err != nil {
+		t.Fatal(err)
+	}
+	if unbalanced != 0 {
+		t.Fatalf("%d transactions have unequal debits and credits", unbalanced)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+// The statements a gift or withdrawal runs inside its transaction, sent as
+// pgx batches: one round trip locks the wallets and reads everything the
+// checks need, and one posts the transaction, its legs and whatever record
+// goes with it, instead of a round trip per statement.
+
+// moveReq describes a money movement about to be checked.
+type moveReq struct {
+	UserID        string   // who is paying
+	Idem          string   // idempotency key
+	Lock          []string // wallets to lock; system wallets are skipped
+	Debit         string   // the wallet whose balance is checked
+	RecipientID   string   // for gifts, to check the beneficiary limit
+	DestinationID string   // for withdrawals, likewise
+	Amount        int64
+}
+
+// moveChecks is what checkMove read.
+type moveChecks struct {
+	// ExistingID and ExistingKind are set when a transaction was already
+	// posted under the idempotency key.
+	ExistingID, ExistingKind string
+	Balance                  int64 // of the debited wallet
+	// LimitErr is set when the beneficiary's daily limit would be exceeded.
+	LimitErr *apierror.Error
+}
+
+// checkMove locks m's wallets and reads the idempotency key, the debited
+// wallet's balance and the beneficiary's daily limit in one round trip.
+// The reads follow the lock, so concurrent movements from the same wallet
+// see each other.
+func (app *App) checkMove(ctx context.Context, tx pgx.Tx, m moveReq) (moveChecks, error) {
+	var c moveChecks
+	lock, err := app.lockableWallets(ctx, m.Lock...)
+	if err != nil {
+		return c, err
+	}
+	limitSQL, target := giftLimitSQL, m.RecipientID
+	if m.DestinationID != "" {
+		limitSQL, target = withdrawalLimitSQL, m.DestinationID
+	}
+	var (
+		limit *int64
+		sent  int64
+	)
+
+	b := &pgx.Batch{}
+	b.Queue(lockWalletsSQL, lock)
+	b.Queue(`SELECT id, kind FROM transactions WHERE idempotency_key=$1`, m.Idem).QueryRow(func(row pgx.Row) error {
+		err := row.Scan(&c.ExistingID, &c.ExistingKind)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	b.Queue(`SELECT `+balanceSQL("$1::uuid"), m.Debit).QueryRow(func(row pgx.Row) error {
+		return row.Scan(&c.Balance)
+	})
+	b.Queue(limitSQL, m.UserID, target).QueryRow(func(row pgx.Row) error {
+		err := row.Scan(&limit, &sent)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	if err := tx.SendBatch(ctx, b).Close(); err != nil {
+		return c, err
+	}
+	if limit != nil && sent+m.Amount > *limit {
+		c.LimitErr = apierror.New(http.StatusUnprocessableEntity, "beneficiary_limit_exceeded")
+	}
+	return c, nil
+}
+
+// posting is a transaction moving Amount from the Debit wallet to the
+// Credit wallet.
+type posting struct {
+	Idem     string
+	Kind     string
+	Amount   int64
+	Debit    string
+	Credit   string
+	Metadata []byte // JSON; nil for {}
+}
+
+// postingSQL inserts a transaction and both its legs, returning its ID.
+const postingSQL = `
+	WITH t AS (
+	  INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+	  VALUES ($1,$2,$3,'NGN', COALESCE($4::jsonb, '{}'::jsonb))
+	  RETURNING id
+	), legs AS (
+	  INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+	  SELECT t.id, l.wallet_id, l.direction, $3
+	  FROM t, (VALUES ($5::uuid,'debit'), ($6::uuid,'credit')) AS l (wallet_id, direction)
+	)
+	SELECT id FROM t`
+
+// postedTxSQL is the ID of the transaction posted earlier in the same
+// batch under idempotency key $1, for statements queued after it.
+const postedTxSQL = `(SELECT id FROM transactions WHERE idempotency_key=$1)`
+
+// queuePosting queues p on b, setting *txID when the batch is sent.
+// Statements queued after it find the transaction with postedTxSQL.
+func queuePosting(b *pgx.Batch, p posting, txID *string) {
+	var meta any
+	if p.Metadata != nil {
+		meta = string(p.Metadata)
+	}
+	b.Queue(postingSQL, p.Idem, p.Kind, p.Amount, meta, p.Debit, p.Credit).QueryRow(func(row pgx.Row) error {
+		return row.Scan(txID)
+	})
+}
@@ -3,27 +3,77 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/cors"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-
+	"google.golang.org/grpc"
+
+	"github.com/sudo-init-do/okies-backend/pkg/alerting"
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/breaker"
+	"github.com/sudo-init-do/okies-backend/pkg/cache"
+	"github.com/sudo-init-do/okies-backend/pkg/chaos"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
 	mydb "github.com/sudo-init-do/okies-backend/pkg/db"
+	"github.com/sudo-init-do/okies-backend/pkg/envelope"
+	"github.com/sudo-init-do/okies-backend/pkg/events"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+	"github.com/sudo-init-do/okies-backend/pkg/mailer"
+	"github.com/sudo-init-do/okies-backend/pkg/moderation"
+	"github.com/sudo-init-do/okies-backend/pkg/objectstore"
+	"github.com/sudo-init-do/okies-backend/pkg/openbanking"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+	"github.com/sudo-init-do/okies-backend/pkg/push"
+	"github.com/sudo-init-do/okies-backend/pkg/ratelimit"
+	"github.com/sudo-init-do/okies-backend/pkg/redact"
+	"github.com/sudo-init-do/okies-backend/pkg/secrets"
+	"github.com/sudo-init-do/okies-backend/pkg/sentry"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+	"github.com/sudo-init-do/okies-backend/pkg/signing"
+	"github.com/sudo-init-do/okies-backend/pkg/sms"
+	"github.com/sudo-init-do/okies-backend/pkg/telemetry"
 )
 
 type App struct {
+	Config      *config.Config
 	DB          *pgxpool.Pool
-	JWTSecret   []byte
+	Reads       *mydb.Router // replica routing for staleness-tolerant reads
+	Queries     *mydb.QueryStats
+	Sealer      *envelope.Sealer // bank details at rest; see encryption.go
+	JWT         *a.Keyring
+	Secrets     *secrets.Store // rotatable credentials; see secrets.go
 	Redis       *redis.Client
 	Flutterwave FlutterwaveClient
+	OpenBanking openbanking.Provider
+	PartnerHTTP *http.Client // partner webhook deliveries; see partner_webhooks.go
+	Breakers    []*breaker.Breaker
+	Settings    *settings.Store
+	Events      *events.Bus
+	Cache       *cache.Cache
+	Limiter     *ratelimit.Limiter
+	Pager       *pagination.Pager
+	Names       *moderation.Checker
+	Push        push.Senders
+	Alerts      alerting.Channels
+	Mailer      *mailer.Mailer  // nil when no mail driver is configured
+	SMS         sms.Driver      // nil when no SMS driver is configured
+	Errors      *sentry.Client  // nil (discarding) when SENTRY_DSN is unset
+	Chaos       *chaos.Injector // nil unless CHAOS_ENABLED
+	Storage     *objectstore.S3 // user uploads; nil when no bucket is configured
+	SignIn      signInProviders // Google and Apple; see identities.go
+
+	schema atomic.Pointer[schemaState] // last schema check; see schema_guard.go
 }
 
 type UserDTO struct {
@@ -31,206 +81,269 @@ type UserDTO struct {
 	Email       string    `json:"email"`
 	Username    *string   `json:"username,omitempty"`
 	DisplayName *string   `json:"displayName,omitempty"`
+	AvatarURL   *string   `json:"avatarUrl,omitempty"`
+	Phone       *string   `json:"phone,omitempty"` // verified, E.164
+	Language    *string   `json:"language,omitempty"`
+	TimeZone    *string   `json:"timeZone,omitempty"`
 	CreatedAt   time.Time `json:"createdAt"`
 }
 
-// custom response writer to capture status codes
-type logResponseWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (lrw *logResponseWriter) WriteHeader(code int) {
-	lrw.statusCode = code
-	lrw.ResponseWriter.WriteHeader(code)
-}
-
 func main() {
 	zerolog.TimeFieldFormat = time.RFC3339
+	// mask personal data and credentials in every log line; see pkg/redact
+	log.Logger = log.Output(redact.NewWriter(os.Stderr))
 	zerolog.SetGlobalLevel(zerolog.DebugLevel) // 👈 show all logs
-	port := getenv("PORT", "8081")
+	// log.Ctx outside a request (jobs, events) falls back to the global logger
+	zerolog.DefaultContextLogger = &log.Logger
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(cfg, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		os.Exit(runSeedCommand(cfg, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rekey" {
+		os.Exit(runRekeyCommand(cfg, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import-users" {
+		os.Exit(runImportUsersCommand(cfg, os.Args[2:]))
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	// DB
-	pool := mydb.MustOpenPool(ctx)
-	defer pool.Close()
+	// Tracing
+	shutdownTracing, err := telemetry.Setup(ctx, telemetry.Options{
+		ServiceName: cfg.ServiceName,
+		Environment: cfg.Env,
+		Endpoint:    cfg.OTLPEndpoint,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("tracing setup failed")
+	}
+	defer func() {
+		c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(c)
+	}()
+
+	// Error tracking (optional). Request failures are reported by
+	// RequestLog; the log writer reports errors logged outside requests.
+	hostname, _ := os.Hostname()
+	tracker, err := sentry.New(sentry.Options{
+		DSN:         cfg.SentryDSN,
+		Environment: cfg.Env,
+		Release:     cfg.SentryRelease,
+		ServerName:  hostname,
+		SampleRate:  cfg.SentrySampleRate,
+		InAppPrefix: "github.com/sudo-init-do/okies-backend",
+		Client:      httpclient.New("sentry", httpclient.Options{Timeout: 10 * time.Second}),
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid SENTRY_DSN")
+	}
+	log.Logger = log.Output(redact.NewWriter(io.MultiWriter(os.Stderr, tracker.LogWriter("request_id"))))
+	defer func() {
+		c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		tracker.Flush(c)
+	}()
 
 	// Redis (optional)
 	var rdb *redis.Client
 	rc := redis.NewClient(&redis.Options{
-		Addr: getenv("REDIS_ADDR", "localhost:6379"),
+		Addr: cfg.RedisAddr,
 	})
 	if err := rc.Ping(ctx).Err(); err != nil {
 		log.Warn().Err(err).Msg("redis not reachable; rate limiting disabled")
 	} else {
 		rdb = rc
 		defer rdb.Close()
+		if err := redisotel.InstrumentTracing(rdb); err != nil {
+			log.Warn().Err(err).Msg("redis tracing not enabled")
+		}
+	}
+
+	// per-query timings and the slow-query log; see db_metrics.go
+	queries := mydb.NewQueryStats(cfg.SlowQuery, queryCaller)
+	tracers := []pgx.QueryTracer{queries}
+
+	// Fault injection (development only); see chaos.go
+	var faults *chaos.Injector
+	if cfg.ChaosEnabled {
+		faults = chaos.New(rdb)
+		tracers = append(tracers, faults.Tracer())
+		log.Warn().Msg("chaos mode available; faults are injected while enabled through the admin API")
+	}
+
+	// DB
+	if cfg.MigrateOnStart {
+		if err := mydb.MigrateUp(cfg.DatabaseURL); err != nil {
+			log.Fatal().Err(err).Msg("migrate on start failed")
+		}
+		log.Info().Msg("database migrations applied")
+	}
+	pool := mydb.MustOpenPool(ctx, cfg.DatabaseURL, poolOptions(cfg.DBPool), tracers...)
+	defer pool.Close()
+	var replica *pgxpool.Pool
+	if cfg.DatabaseReplicaURL != "" {
+		replica, err = mydb.OpenPool(ctx, cfg.DatabaseReplicaURL, poolOptions(cfg.DBPool), tracers...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid DATABASE_REPLICA_URL")
+		}
+		defer replica.Close()
+	}
+	reads := mydb.NewRouter(pool, replica, cfg.ReplicaMaxLag)
+
+	sealer, err := newSealer(cfg.Encryption)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid encryption keys")
+	}
+
+	secretStore, err := newSecretStore(cfg)
+	if err != nil {
+		log.Error().Err(err).Str("dir", cfg.SecretsDir).Msg("reading SECRETS_DIR failed; using the environment where a file couldn't be read")
+	}
+	jwtCurrent, jwtPrevious := jwtSecrets(secretStore)
+	jwtKeys := a.NewKeyring(jwtCurrent, jwtPrevious...)
+	privateKeys, err := a.ParsePrivateKeys(secretStore.Get(secretJWTPrivateKeys))
+	if err == nil {
+		err = jwtKeys.SetPrivateKeys(privateKeys...)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid JWT_PRIVATE_KEYS")
 	}
 
 	// Flutterwave client
-	flw, err := NewFlutterwaveClient(
-		getenv("FLW_BASE_URL", "https://api.flutterwave.com"),
-		getenv("FLW_SEC_KEY", ""),
-		getenv("FLW_ENC_KEY", ""),
-	)
+	flw, err := NewFlutterwaveClient(cfg.Flutterwave.BaseURL, secretStore.Get(secretFLWKey), cfg.Flutterwave.EncKey, faults)
 	if err != nil {
 		log.Warn().Err(err).Msg("flutterwave not configured; payouts will be dry-run until set")
 	}
 
 	app := &App{
 		DB:          pool,
-		JWTSecret:   []byte(getenv("JWT_SECRET", "dev_change_me")),
+		Reads:       reads,
+		Queries:     queries,
+		Sealer:      sealer,
+		Config:      cfg,
+		JWT:         jwtKeys,
+		Secrets:     secretStore,
 		Redis:       rdb,
 		Flutterwave: flw,
+		PartnerHTTP: httpclient.New("partner_webhooks", httpclient.Options{Timeout: 10 * time.Second, PublicOnly: cfg.Env == "production"}),
+		Settings:    settings.New(pool, rdb),
+		Events:      events.New(rdb),
+		Cache:       cache.New(rdb, "okies:cache:"),
+		Limiter:     ratelimit.New(rdb, "rl:"),
+		Pager:       pagination.New(cfg.CursorSecret),
+		Push:        newPushSenders(cfg.Push),
+		Mailer:      newMailer(cfg.Mail),
+		SMS:         newSMSDriver(cfg),
+		OpenBanking: newOpenBankingProvider(cfg),
+		Storage:     newObjectStore(cfg),
+		SignIn:      newSignInProviders(cfg.SignIn),
+		Names:       newNameChecker(cfg.Moderation),
+		Alerts:      newAlertChannels(cfg, func() []signing.Key { return internalSigningKeys(secretStore) }),
+		Errors:      tracker,
+		Chaos:       faults,
 	}
-
-	r := chi.NewRouter()
-	r.Use(cors.AllowAll().Handler)
-
-	// 🔎 Logging middleware
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			start := time.Now()
-			lrw := &logResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-
-			// panic recovery
-			defer func() {
-				if rec := recover(); rec != nil {
-					log.Error().
-						Interface("panic", rec).
-						Str("url", req.URL.String()).
-						Msg("panic recovered")
-					http.Error(lrw, "internal server error", http.StatusInternalServerError)
-				}
-			}()
-
-			next.ServeHTTP(lrw, req)
-			duration := time.Since(start)
-
-			if lrw.statusCode >= 400 {
-				log.Error().
-					Str("method", req.Method).
-					Str("url", req.URL.String()).
-					Int("status", lrw.statusCode).
-					Dur("duration", duration).
-					Msg("request failed")
-			} else {
-				log.Debug().
-					Str("method", req.Method).
-					Str("url", req.URL.String()).
-					Int("status", lrw.statusCode).
-					Dur("duration", duration).
-					Msg("request completed")
-			}
-		})
-	})
-
-	// Health
-	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		c, cancel := context.WithTimeout(r.Context(), 2*time.Second)
-		defer cancel()
-		if err := pool.Ping(c); err != nil {
-			log.Error().Err(err).Msg("db ping failed")
-			http.Error(w, "db not ready", http.StatusServiceUnavailable)
-			return
+	app.guardFlutterwave()
+	if _, _, err := app.systemUserAndWallet(ctx); err != nil {
+		// every deposit, withdrawal and fee moves money through this wallet
+		log.Error().Err(err).Msg("system account system@okies.local not found; run `api migrate up`, or `api seed` in development")
+	}
+	if st, err := app.checkSchema(ctx); err != nil {
+		log.Error().Err(err).Msg("schema check failed at startup")
+	} else if !st.OK {
+		log.Error().Interface("schema", st).Msg("database schema does not match this binary; money-moving endpoints will refuse requests until `api migrate up`")
+	}
+	go app.Settings.Watch(ctx)
+	go app.Secrets.Watch(ctx, secretsPollInterval, func(changed []string) { app.applySecrets(ctx, changed) })
+	go app.Chaos.Watch(ctx, chaosPollInterval)
+	app.registerSubscribers()
+	go app.Events.Run(ctx)
+
+	// `api worker` runs background jobs instead of serving HTTP
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		if app.waitForSchema(ctx, 15*time.Second) {
+			app.runWorker(ctx)
 		}
-		_, _ = w.Write([]byte("ok"))
-	})
-	r.Get("/readyz", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ready")) })
-
-	// Public webhooks
-	r.Post("/v1/webhooks/flutterwave", app.FlutterwaveWebhook)
-
-	// Public auth
-	r.With(app.RateLimitIP(10, time.Minute)).Post("/v1/auth/signup", app.Signup)
-	r.With(app.RateLimitIP(20, time.Minute)).Post("/v1/auth/login", app.Login)
-	r.With(app.RateLimitIP(30, time.Minute)).Post("/v1/auth/refresh", app.Refresh)
-
-	// Protected
-	r.Group(func(pr chi.Router) {
-		pr.Use(app.AuthMiddleware)
-
-		// self
-		pr.Get("/v1/auth/me", app.Me)
-		pr.Get("/v1/auth/whoami", app.WhoAmI)
-
-		// wallet
-		pr.Get("/v1/wallet", app.GetWallet)
-		pr.Get("/v1/wallet/transactions", app.ListWalletTransactions)
-		pr.Get("/v1/wallet/withdrawals", app.ListMyWithdrawals)
-
-		// gifting
-		pr.With(app.RateLimitUser(60, time.Minute)).Post("/v1/gifts", app.CreateGift)
-
-		// users
-		pr.Get("/v1/users/search", app.SearchUsers)
-
-		// payout destinations
-		pr.Get("/v1/payout-destinations", app.ListPayoutDestinations)
-		pr.Post("/v1/payout-destinations", app.CreatePayoutDestination)
-		pr.Delete("/v1/payout-destinations/{id}", app.DeletePayoutDestination)
-
-		// withdrawals
-		pr.Post("/v1/withdrawals", app.CreateWithdrawal)
-
-		// admin
-		pr.Group(func(ad chi.Router) {
-			ad.Use(app.RequireAdmin)
-			ad.Post("/v1/admin/topups", app.AdminTopup)
-			ad.Post("/v1/admin/withdrawals/{id}/approve", app.AdminApproveWithdrawal)
-			ad.Post("/v1/admin/withdrawals/{id}/reject", app.AdminRejectWithdrawal)
-		})
-	})
+		dctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		app.drainEvents(dctx)
+		return
+	}
 
-	// dev: quick users list
-	r.Get("/v1/users", func(w http.ResponseWriter, r *http.Request) {
-		rows, err := pool.Query(r.Context(), `
-			SELECT id, email, username, display_name, created_at
-			FROM users
-			ORDER BY created_at DESC
-			LIMIT 50`)
-		if err != nil {
-			log.Error().Err(err).Msg("failed to query users")
-			http.Error(w, "query failed", http.StatusInternalServerError)
-			return
-		}
-		defer rows.Close()
-
-		var out []UserDTO
-		for rows.Next() {
-			var u UserDTO
-			if err := rows.Scan(&u.ID, &u.Email, &u.Username, &u.DisplayName, &u.CreatedAt); err != nil {
-				log.Error().Err(err).Msg("failed to scan user row")
-				http.Error(w, "scan failed", http.StatusInternalServerError)
-				return
-			}
-			out = append(out, u)
-		}
-		writeJSON(w, http.StatusOK, map[string]any{"data": out})
-	})
+	// background: route reads away from a lagging replica
+	go app.Reads.Monitor(ctx, 5*time.Second)
+	// background: job queue depth gauges
+	go app.runJobMetrics(ctx, 30*time.Second)
+	// background: sweeps and reports, on the elected replica only
+	go app.runSingletons(ctx)
+	// background: refuse money movement while the schema has drifted
+	go app.runSchemaGuard(ctx, time.Minute)
+
+	r := app.routes()
 
-	addr := fmt.Sprintf(":%s", port)
+	addr := fmt.Sprintf(":%d", cfg.Port)
 	log.Info().Msgf("API running on %s", addr)
 
 	srv := &http.Server{Addr: addr, Handler: r}
+	srv.RegisterOnShutdown(hub.closeAll)
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("server error")
 		}
 	}()
 
+	var grpcSrv *grpc.Server
+	if cfg.GRPCPort != 0 {
+		if grpcSrv, err = app.serveGRPC(cfg.GRPCPort); err != nil {
+			log.Fatal().Err(err).Msg("grpc listen failed")
+		}
+	}
+
 	<-ctx.Done()
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// stop accepting, let in-flight requests (webhooks included) finish, then
+	// deliver the events they published
+	log.Info().Dur("timeout", cfg.ShutdownTimeout).Msg("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
-	_ = srv.Shutdown(shutdownCtx)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Warn().Err(err).Msg("in-flight requests did not finish in time")
+	}
+	if grpcSrv != nil {
+		stopGRPC(shutdownCtx, grpcSrv)
+	}
+	app.drainEvents(shutdownCtx)
 	log.Info().Msg("server shutdown complete")
 }
 
-func getenv(k, d string) string {
-	if v := os.Getenv(k); v != "" {
-		return v
+// stopGRPC lets in-flight RPCs finish, cutting them off when ctx ends.
+func stopGRPC(ctx context.Context, srv *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn().Msg("in-flight RPCs did not finish in time")
+		srv.Stop()
+	}
+}
+
+// drainEvents waits for event subscribers still delivering notifications
+// and enqueueing follow-up work, until ctx ends.
+func (app *App) drainEvents(ctx context.Context) {
+	if err := app.Events.Drain(ctx); err != nil {
+		log.Warn().Err(err).Msg("event subscribers did not finish in time")
 	}
-	return d
 }
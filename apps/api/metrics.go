@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+// gauges is a tiny Prometheus-compatible registry. We only export a handful of
+// gauges, which doesn't justify pulling in client_golang.
+var gauges = &gaugeRegistry{vals: map[string]gauge{}}
+
+type gauge struct {
+	name  string // metric family
+	help  string
+	value float64
+}
+
+type gaugeRegistry struct {
+	mu   sync.RWMutex
+	vals map[string]gauge // keyed by series: name plus labels
+}
+
+func (g *gaugeRegistry) Set(name, help string, v float64) {
+	g.mu.Lock()
+	g.vals[name] = gauge{name: name, help: help, value: v}
+	g.mu.Unlock()
+}
+
+// SetLabeled sets one series of a labelled gauge; labels are alternating
+// name/value pairs.
+func (g *gaugeRegistry) SetLabeled(name, help string, v float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", labels[i], labels[i+1])
+	}
+	b.WriteByte('}')
+	g.mu.Lock()
+	g.vals[b.String()] = gauge{name: name, help: help, value: v}
+	g.mu.Unlock()
+}
+
+// ResetFamily drops every series of name, for gauges whose label sets come
+// and go (a kind with no jobs left should not keep its last count).
+func (g *gaugeRegistry) ResetFamily(name string) {
+	g.mu.Lock()
+	for k, v := range g.vals {
+		if v.name == name {
+			delete(g.vals, k)
+		}
+	}
+	g.mu.Unlock()
+}
+
+// GET /metrics (Prometheus text exposition format)
+// When METRICS_TOKEN is set, scrapers must send it as a bearer token.
+func (app *App) PrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	if tok := app.Config.MetricsToken; tok != "" && r.Header.Get("Authorization") != "Bearer "+tok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "invalid_token"))
+		return
+	}
+	app.exportQueryStats()
+	app.exportPoolStats()
+
+	gauges.mu.RLock()
+	names := make([]string, 0, len(gauges.vals))
+	for n := range gauges.vals {
+		names = append(names, n)
+	}
+	// group series by family so each family gets one HELP/TYPE header
+	sort.Slice(names, func(i, j int) bool {
+		fi, fj := gauges.vals[names[i]].name, gauges.vals[names[j]].name
+		if fi != fj {
+			return fi < fj
+		}
+		return names[i] < names[j]
+	})
+	var b strings.Builder
+	last := ""
+	for _, n := range names {
+		g := gauges.vals[n]
+		if g.name != last {
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+			last = g.name
+		}
+		fmt.Fprintf(&b, "%s %g\n", n, g.value)
+	}
+	gauges.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
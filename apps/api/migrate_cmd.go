@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	mydb "github.com/sudo-init-do/okies-backend/pkg/db"
+)
+
+const migrateUsage = `usage: api migrate <command>
+
+  up            apply all pending migrations
+  down N        roll back the last N migrations
+  goto V        migrate up or down to version V
+  version       print the current version
+  force V       set the version without running anything (clears dirty state)`
+
+// runMigrateCommand implements `api migrate ...` and returns the exit code.
+func runMigrateCommand(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	m, err := mydb.NewMigrator(cfg.DatabaseURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	defer m.Close()
+
+	needN := func() (int, bool) {
+		if len(args) < 2 {
+			return 0, false
+		}
+		n, err := strconv.Atoi(args[1])
+		return n, err == nil && n >= 0
+	}
+
+	switch args[0] {
+	case "up":
+		err = m.Up()
+	case "down":
+		n, ok := needN()
+		if !ok || n == 0 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		err = m.Steps(-n)
+	case "goto":
+		v, ok := needN()
+		if !ok {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		err = m.Migrate(uint(v))
+	case "force":
+		v, ok := needN()
+		if !ok {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		err = m.Force(v)
+	case "version":
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+
+	v, dirty, err := m.Version()
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+		fmt.Println("version: none")
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	default:
+		fmt.Printf("version: %d dirty: %t\n", v, dirty)
+	}
+	return 0
+}
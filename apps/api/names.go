@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+	"github.com/sudo-init-do/okies-backend/pkg/moderation"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
+)
+
+// Name moderation. Usernames and display names are screened when chosen
+// (see pkg/moderation): blocked names are refused, doubtful ones are saved
+// and queued in name_reviews. Moderators approve them or rename the user.
+
+func newNameChecker(cfg config.Moderation) *moderation.Checker {
+	if cfg.APIURL == "" {
+		return moderation.New(nil)
+	}
+	return moderation.New(&moderation.API{
+		URL:    cfg.APIURL,
+		Key:    cfg.APIKey,
+		Client: httpclient.New("moderation", httpclient.Options{Timeout: 3 * time.Second}),
+	})
+}
+
+// screenName checks a name the user chose for field (username or
+// display_name). A blocked name is an API error; otherwise the verdict is
+// for queueNameReview once the name is saved.
+func (app *App) screenName(ctx context.Context, field, name string) (moderation.Verdict, *apierror.Error) {
+	v, err := app.Names.Check(ctx, name)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("field", field).Msg("moderation api failed; denylist only")
+	}
+	if v.Action == moderation.Block {
+		return v, apierror.New(http.StatusUnprocessableEntity, "name_not_allowed")
+	}
+	return v, nil
+}
+
+// queueNameReview queues a saved name whose verdict asks for review.
+func (app *App) queueNameReview(ctx context.Context, userID, field, value string, v moderation.Verdict) {
+	if v.Action != moderation.Review {
+		return
+	}
+	if _, err := app.DB.Exec(ctx, `
+		INSERT INTO name_reviews (user_id, field, value, reason) VALUES ($1,$2,$3,$4)
+	`, userID, field, value, v.Reason); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", userID).Str("field", field).Msg("queue name review failed")
+	}
+}
+
+// PUT /v1/users/me/display-name  {"displayName":"Ada L."}
+// An empty or null displayName removes it.
+func (app *App) SetMyDisplayName(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		DisplayName *string `json:"displayName" validate:"omitempty,max=60"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+	var name string
+	if body.DisplayName != nil {
+		name = strings.TrimSpace(*body.DisplayName)
+	}
+	var v moderation.Verdict
+	if name != "" {
+		var e *apierror.Error
+		if v, e = app.screenName(ctx, "display_name", name); e != nil {
+			apierror.Write(w, e)
+			return
+		}
+	}
+	if _, err := app.DB.Exec(ctx, `UPDATE users SET display_name=NULLIF($2,'') WHERE id=$1`, uid, name); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(ctx, uid)
+	app.queueNameReview(ctx, uid, "display_name", name, v)
+	writeJSON(w, http.StatusOK, map[string]any{"data": app.loadUser(r, uid)})
+}
+
+// ---------- Admin ----------
+
+type nameReviewDTO struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"userId"`
+	Field      string     `json:"field"`
+	Value      string     `json:"value"`
+	Current    *string    `json:"current"` // the user's name in field now
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	ReviewedBy *string    `json:"reviewedBy,omitempty"`
+	ReviewedAt *time.Time `json:"reviewedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// GET /v1/admin/name-reviews?status=pending&limit=&cursor=
+// status defaults to pending.
+func (app *App) AdminListNameReviews(w http.ResponseWriter, r *http.Request) {
+	status := strings.TrimSpace(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = "pending"
+	case "pending", "approved", "renamed":
+	default:
+		apierror.Write(w, apierror.InvalidField("status"))
+		return
+	}
+	pg, ok := app.parsePage(w, r, "admin.name_reviews", pagination.Admin)
+	if !ok {
+		return
+	}
+	afterAt, afterID := pg.AfterArgs()
+
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT n.id, n.user_id, n.field, n.value,
+		       CASE n.field WHEN 'username' THEN u.username ELSE u.display_name END,
+		       n.reason, n.status, n.reviewed_by, n.reviewed_at, n.created_at
+		FROM name_reviews n
+		JOIN users u ON u.id = n.user_id
+		WHERE n.status = $1
+		  AND ($2::timestamptz IS NULL OR (n.created_at, n.id) < ($2, $3::uuid))
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $4
+	`, status, afterAt, afterID, pg.Limit+1)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	out := []nameReviewDTO{}
+	for rows.Next() {
+		var d nameReviewDTO
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Field, &d.Value, &d.Current,
+			&d.Reason, &d.Status, &d.ReviewedBy, &d.ReviewedAt, &d.CreatedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, d)
+	}
+	out, paging := pagination.Trim(pg, out, func(d nameReviewDTO) pagination.Key { return pagination.Key{Time: d.CreatedAt, ID: d.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
+
+// POST /v1/admin/name-reviews/{id}/approve
+// Leaves the name as it is.
+func (app *App) AdminApproveNameReview(w http.ResponseWriter, r *http.Request) {
+	actor, _ := getUserID(r)
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var userID, field, value string
+	err := app.DB.QueryRow(r.Context(), `
+		UPDATE name_reviews SET status='approved', reviewed_by=$2, reviewed_at=now()
+		WHERE id::text=$1 AND status='pending'
+		RETURNING user_id, field, value
+	`, id, actor).Scan(&userID, &field, &value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "name_review_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.audit(r, auditEntry{
+		Action:     "name_review.approve",
+		TargetType: "user",
+		TargetID:   userID,
+		After:      map[string]any{"reviewId": id, "field": field, "value": value},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"id": id, "status": "approved"}})
+}
+
+// POST /v1/admin/users/{id}/rename  {"field":"username|displayName","value":"...","reason":"..."}
+// Replaces the user's name in field with value, or removes it when value is
+// empty. A removed username is not held for the user and stops resolving
+// to them, and they may pick a new one straight away.
+func (app *App) AdminRenameUser(w http.ResponseWriter, r *http.Request) {
+	actor, _ := getUserID(r)
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var body struct {
+		Field  string `json:"field" validate:"required,oneof=username displayName"`
+		Value  string `json:"value" validate:"max=60"`
+		Reason string `json:"reason" validate:"required,max=500"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	value := strings.TrimSpace(body.Value)
+	field := "display_name"
+	if body.Field == "username" {
+		field = "username"
+		if value != "" && !validate.Username(value) {
+			apierror.Write(w, apierror.InvalidField("value"))
+			return
+		}
+	}
+	ctx := r.Context()
+	if field == "username" && value != "" {
+		taken, err := app.usernameTaken(ctx, value, id)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		if taken {
+			apierror.Write(w, apierror.New(http.StatusConflict, "username_in_use"))
+			return
+		}
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var before *string
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT %s FROM users WHERE id::text=$1 FOR UPDATE`, field), id).Scan(&before)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if field == "username" {
+		_, err = tx.Exec(ctx, `UPDATE users SET username=NULLIF($2,''), username_changed_at=NULL WHERE id::text=$1`, id, value)
+		if err == nil && before != nil {
+			_, err = tx.Exec(ctx, `DELETE FROM username_redirects WHERE username=lower($1)`, *before)
+		}
+	} else {
+		_, err = tx.Exec(ctx, `UPDATE users SET display_name=NULLIF($2,'') WHERE id::text=$1`, id, value)
+	}
+	if usernameConflict(err) {
+		apierror.Write(w, apierror.New(http.StatusConflict, "username_in_use"))
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", id).Msg("rename user failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE name_reviews SET status='renamed', reviewed_by=$3, reviewed_at=now()
+		WHERE user_id::text=$1 AND field=$2 AND status='pending'
+	`, id, field, actor); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	app.invalidateUser(ctx, id)
+	app.notify(ctx, id, "name_changed", map[string]any{"field": field})
+
+	reason := strings.TrimSpace(body.Reason)
+	app.audit(r, auditEntry{
+		Action:     "user.rename",
+		TargetType: "user",
+		TargetID:   id,
+		Before:     map[string]any{field: before},
+		After:      map[string]any{field: value, "reason": reason},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"userId": id, "field": body.Field, "value": value}})
+}
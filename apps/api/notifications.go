@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/push"
+)
+
+type notificationDTO struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data"`
+	ReadAt    *time.Time      `json:"readAt,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// notify stores an in-app notification for userID, rendered from the
+// template for kind (pkg/push) in the user's preferences. Delivery is
+// best-effort: failures are logged and never block the action that
+// triggered them.
+func (app *App) notify(ctx context.Context, userID, kind string, data map[string]any) {
+	app.storeNotification(ctx, userID, app.userPreferences(ctx, userID), kind, data)
+}
+
+func (app *App) storeNotification(ctx context.Context, userID string, p preferencesDTO, kind string, data map[string]any) bool {
+	if data == nil {
+		data = map[string]any{}
+	}
+	m, err := push.Render(kind, p.language(), p.CurrencyDisplay, data)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("kind", kind).Msg("render notification failed")
+		return false
+	}
+	raw, _ := json.Marshal(data)
+	if _, err := app.DB.Exec(ctx, `
+		INSERT INTO notifications (user_id, kind, title, body, data)
+		VALUES ($1,$2,$3,$4,$5::jsonb)
+	`, userID, kind, m.Title, m.Body, string(raw)); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", userID).Str("kind", kind).Msg("store notification failed")
+	}
+	return true
+}
+
+// GET /v1/notifications?unread=true
+func (app *App) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	out, err := app.listNotifications(r.Context(), uid, r.URL.Query().Get("unread") == "true", 100)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// listNotifications returns userID's latest notifications, newest first.
+func (app *App) listNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) ([]notificationDTO, error) {
+	rows, err := app.DB.Query(ctx, `
+		SELECT id, kind, title, body, data, read_at, created_at
+		FROM notifications
+		WHERE user_id=$1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, userID, unreadOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []notificationDTO{}
+	for rows.Next() {
+		var n notificationDTO
+		var data []byte
+		if err := rows.Scan(&n.ID, &n.Kind, &n.Title, &n.Body, &data, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.Data = data
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+// POST /v1/notifications/{id}/read
+func (app *App) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	res, err := app.DB.Exec(r.Context(), `
+		UPDATE notifications SET read_at = COALESCE(read_at, now())
+		WHERE id=$1 AND user_id=$2
+	`, id, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if res.RowsAffected() == 0 {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"read": true}})
+}
@@ -0,0 +1,856 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+	"github.com/sudo-init-do/okies-backend/pkg/openbanking"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+	"github.com/sudo-init-do/okies-backend/pkg/redact"
+)
+
+// Open banking, a deposit channel beside admin top-ups. A user links a bank
+// account through the provider's widget, approves a direct-debit mandate at
+// their bank, then funds their wallet from it. Each debit is queued as a
+// direct_debit.submit job; the provider answers at once or settles it later
+// by webhook, and a successful debit is credited from the system wallet as
+// a direct_debit transaction.
+
+const (
+	jobDirectDebitSubmit = "direct_debit.submit" // {"debitId"}
+	jobOpenBankingEvent  = "webhook.openbanking" // {"eventId","type","mandateId","reference","error"}
+)
+
+// bankBalanceMaxAge is how old a stored bank balance may be before a debit
+// refreshes it from the provider.
+const bankBalanceMaxAge = 5 * time.Minute
+
+// newOpenBankingProvider returns nil when no provider is configured.
+func newOpenBankingProvider(cfg *config.Config) openbanking.Provider {
+	ob := cfg.OpenBanking
+	switch ob.Driver {
+	case "mono":
+		return &openbanking.Mono{
+			BaseURL:       ob.MonoBaseURL,
+			SecretKey:     ob.MonoSecretKey,
+			WebhookSecret: ob.MonoWebhookSecret,
+			Client:        httpclient.New("openbanking_mono", httpclient.Options{Timeout: 15 * time.Second, Retries: 2}),
+		}
+	}
+	return nil
+}
+
+// ---------- Types ----------
+
+type bankLinkDTO struct {
+	ID            string     `json:"id"`
+	Institution   string     `json:"institution"`
+	BankCode      *string    `json:"bankCode,omitempty"`
+	AccountNumber string     `json:"accountNumber"` // masked, e.g. ****1234
+	AccountName   string     `json:"accountName"`
+	Balance       *int64     `json:"balance,omitempty"`
+	BalanceAt     *time.Time `json:"balanceAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+const bankLinkCols = `id, institution, bank_code, account_last4, account_name, balance, balance_at, created_at`
+
+func scanBankLink(row pgx.Row) (bankLinkDTO, error) {
+	var d bankLinkDTO
+	err := row.Scan(&d.ID, &d.Institution, &d.BankCode, &d.AccountNumber, &d.AccountName, &d.Balance, &d.BalanceAt, &d.CreatedAt)
+	d.AccountNumber = maskAccount(d.AccountNumber)
+	return d, err
+}
+
+type mandateDTO struct {
+	ID           string    `json:"id"`
+	BankLinkID   string    `json:"bankLinkId"`
+	MaxAmount    int64     `json:"maxAmount"`
+	Status       string    `json:"status"`
+	AuthorizeURL *string   `json:"authorizeUrl,omitempty"` // while pending
+	ExpiresAt    time.Time `json:"expiresAt"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+const mandateCols = `id, bank_link_id, max_amount, status,
+	CASE WHEN status='pending' THEN authorize_url END, expires_at, created_at`
+
+func scanMandate(row pgx.Row) (mandateDTO, error) {
+	var d mandateDTO
+	err := row.Scan(&d.ID, &d.BankLinkID, &d.MaxAmount, &d.Status, &d.AuthorizeURL, &d.ExpiresAt, &d.CreatedAt)
+	return d, err
+}
+
+type directDebitDTO struct {
+	ID        string    `json:"id"`
+	MandateID string    `json:"mandateId"`
+	Amount    int64     `json:"amount"`
+	Status    string    `json:"status"`
+	Reference string    `json:"reference"`
+	TxID      *string   `json:"txId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const directDebitCols = `id, mandate_id, amount, status, reference, tx_id, created_at`
+
+func scanDirectDebit(row pgx.Row) (directDebitDTO, error) {
+	var d directDebitDTO
+	err := row.Scan(&d.ID, &d.MandateID, &d.Amount, &d.Status, &d.Reference, &d.TxID, &d.CreatedAt)
+	return d, err
+}
+
+// openBankingAvailable writes the response when no provider is configured.
+func (app *App) openBankingAvailable(w http.ResponseWriter) bool {
+	if app.OpenBanking == nil {
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "open_banking_unavailable"))
+		return false
+	}
+	return true
+}
+
+// ---------- Bank links ----------
+
+// POST /v1/bank-links  {"code":"..."}
+// Links the account the user connected in the provider's widget, whose code
+// expires within minutes. Linking the same account again refreshes it.
+func (app *App) LinkBankAccount(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	if !app.openBankingAvailable(w) {
+		return
+	}
+	var body struct {
+		Code string `json:"code" validate:"required,max=200"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	ctx := r.Context()
+	acct, err := app.OpenBanking.Link(ctx, body.Code)
+	if errors.Is(err, openbanking.ErrRejected) {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_link_code"))
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("bank account link failed")
+		apierror.Write(w, apierror.New(http.StatusBadGateway, "open_banking_unavailable"))
+		return
+	}
+
+	hit, listed, err := app.matchBlacklist(ctx, acct.BankCode, acct.AccountNumber, nil)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if listed && hit.Action == "block" {
+		log.Ctx(ctx).Warn().Str("user_id", uid).Str("blacklist_id", hit.ID).Msg("blacklisted bank account link refused")
+		apierror.Write(w, apierror.New(http.StatusForbidden, "bank_account_blocked"))
+		return
+	}
+
+	d, err := scanBankLink(app.DB.QueryRow(ctx, `
+		INSERT INTO bank_links
+		  (user_id, provider, provider_account_id, institution, bank_code, account_name, account_last4, balance, balance_at)
+		VALUES ($1,$2,$3,$4,NULLIF($5,''),$6,$7,$8,now())
+		ON CONFLICT (provider, provider_account_id) WHERE unlinked_at IS NULL
+		DO UPDATE SET balance=EXCLUDED.balance, balance_at=EXCLUDED.balance_at
+		WHERE bank_links.user_id = EXCLUDED.user_id
+		RETURNING `+bankLinkCols,
+		uid, app.OpenBanking.Name(), acct.ID, acct.Institution, acct.BankCode, acct.AccountName, last4(acct.AccountNumber), acct.Balance))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusConflict, "bank_link_exists"))
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("insert bank link failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if listed {
+		app.flagBlacklistMatch(ctx, uid, "deposit", "bank_link", d.ID, hit)
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"data": d})
+}
+
+// GET /v1/bank-links
+func (app *App) ListBankLinks(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT `+bankLinkCols+` FROM bank_links
+		WHERE user_id=$1 AND unlinked_at IS NULL
+		ORDER BY created_at DESC
+	`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []bankLinkDTO{}
+	for rows.Next() {
+		d, err := scanBankLink(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, d)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// refreshBankBalance asks the provider for a linked account's balance and
+// stores it.
+func (app *App) refreshBankBalance(ctx context.Context, linkID, providerAccountID string) (int64, time.Time, error) {
+	balance, err := app.OpenBanking.Balance(ctx, providerAccountID)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	var at time.Time
+	err = app.DB.QueryRow(ctx, `
+		UPDATE bank_links SET balance=$2, balance_at=now() WHERE id=$1 RETURNING balance_at
+	`, linkID, balance).Scan(&at)
+	return balance, at, err
+}
+
+// GET /v1/bank-links/{id}/balance — the live balance, from the provider
+func (app *App) GetBankLinkBalance(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	if !app.openBankingAvailable(w) {
+		return
+	}
+	ctx := r.Context()
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var providerAccountID string
+	err := app.DB.QueryRow(ctx, `
+		SELECT provider_account_id FROM bank_links
+		WHERE id=$1 AND user_id=$2 AND provider=$3 AND unlinked_at IS NULL
+	`, id, uid, app.OpenBanking.Name()).Scan(&providerAccountID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	balance, at, err := app.refreshBankBalance(ctx, id, providerAccountID)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("bank_link_id", id).Msg("bank balance refresh failed")
+		apierror.Write(w, apierror.New(http.StatusBadGateway, "bank_balance_unavailable"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"balance": balance, "balanceAt": at}})
+}
+
+// DELETE /v1/bank-links/{id}
+// Unlinks the account and cancels its mandates, here and at the provider.
+// Debits already submitted still settle.
+func (app *App) UnlinkBankAccount(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	if !app.openBankingAvailable(w) {
+		return
+	}
+	ctx := r.Context()
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var providerAccountID string
+	err := app.DB.QueryRow(ctx, `
+		UPDATE bank_links SET unlinked_at=now()
+		WHERE id=$1 AND user_id=$2 AND provider=$3 AND unlinked_at IS NULL
+		RETURNING provider_account_id
+	`, id, uid, app.OpenBanking.Name()).Scan(&providerAccountID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	rows, err := app.DB.Query(ctx, `
+		UPDATE direct_debit_mandates SET status='cancelled', updated_at=now()
+		WHERE bank_link_id=$1 AND status IN ('pending','active')
+		RETURNING provider_mandate_id
+	`, id)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	mandates, err := pgx.CollectRows(rows, pgx.RowTo[*string])
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	// we have stopped using them; the provider finding out is best-effort
+	for _, m := range mandates {
+		if m == nil {
+			continue
+		}
+		if err := app.OpenBanking.CancelMandate(ctx, *m); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("mandate_id", *m).Msg("provider mandate cancel failed")
+		}
+	}
+	if err := app.OpenBanking.Unlink(ctx, providerAccountID); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("bank_link_id", id).Msg("provider unlink failed")
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"unlinked": true}})
+}
+
+// ---------- Mandates ----------
+
+// POST /v1/bank-links/{id}/mandates  {"maxAmount":5000000,"days":365,"redirectUrl":"..."}
+// Starts a mandate for debits of up to maxAmount kobo each. The user opens
+// authorizeUrl to approve it at their bank; it becomes active by webhook.
+func (app *App) CreateMandate(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	if !app.openBankingAvailable(w) {
+		return
+	}
+	var body struct {
+		MaxAmount   int64  `json:"maxAmount" validate:"kobo"`
+		Days        int    `json:"days,omitempty" validate:"omitempty,min=1,max=365"`
+		RedirectURL string `json:"redirectUrl,omitempty" validate:"omitempty,url,max=500"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if body.Days == 0 {
+		body.Days = 365
+	}
+
+	ctx := r.Context()
+	if accountStatusError(w, app.checkCanMoveMoney(ctx, uid)) {
+		return
+	}
+	linkID := strings.TrimSpace(chi.URLParam(r, "id"))
+	var providerAccountID, email, name string
+	err := app.DB.QueryRow(ctx, `
+		SELECT b.provider_account_id, u.email, COALESCE(u.display_name, u.username, '')
+		FROM bank_links b JOIN users u ON u.id = b.user_id
+		WHERE b.id=$1 AND b.user_id=$2 AND b.provider=$3 AND b.unlinked_at IS NULL
+	`, linkID, uid, app.OpenBanking.Name()).Scan(&providerAccountID, &email, &name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	start := time.Now()
+	req := openbanking.MandateRequest{
+		AccountID:     providerAccountID,
+		Reference:     "ddm-" + uuid.NewString(),
+		MaxAmount:     body.MaxAmount,
+		Description:   "Okies wallet funding",
+		CustomerName:  name,
+		CustomerEmail: email,
+		RedirectURL:   body.RedirectURL,
+		Start:         start,
+		End:           start.AddDate(0, 0, body.Days),
+	}
+	m, err := app.OpenBanking.CreateMandate(ctx, req)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("bank_link_id", linkID).Msg("create mandate failed")
+		apierror.Write(w, apierror.New(http.StatusBadGateway, "open_banking_unavailable"))
+		return
+	}
+
+	d, err := scanMandate(app.DB.QueryRow(ctx, `
+		INSERT INTO direct_debit_mandates
+		  (user_id, bank_link_id, provider, provider_mandate_id, reference, max_amount, authorize_url, expires_at)
+		VALUES ($1,$2,$3,NULLIF($4,''),$5,$6,$7,$8)
+		RETURNING `+mandateCols,
+		uid, linkID, app.OpenBanking.Name(), m.ID, req.Reference, body.MaxAmount, m.AuthorizeURL, req.End))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("reference", req.Reference).Msg("insert mandate failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"data": d})
+}
+
+// GET /v1/mandates
+func (app *App) ListMandates(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT `+mandateCols+` FROM direct_debit_mandates
+		WHERE user_id=$1
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []mandateDTO{}
+	for rows.Next() {
+		d, err := scanMandate(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, d)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// DELETE /v1/mandates/{id}
+func (app *App) CancelMandate(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	if !app.openBankingAvailable(w) {
+		return
+	}
+	ctx := r.Context()
+	var providerMandateID *string
+	err := app.DB.QueryRow(ctx, `
+		UPDATE direct_debit_mandates SET status='cancelled', updated_at=now()
+		WHERE id=$1 AND user_id=$2 AND status IN ('pending','active')
+		RETURNING provider_mandate_id
+	`, strings.TrimSpace(chi.URLParam(r, "id")), uid).Scan(&providerMandateID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if providerMandateID != nil {
+		if err := app.OpenBanking.CancelMandate(ctx, *providerMandateID); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("mandate_id", *providerMandateID).Msg("provider mandate cancel failed")
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"cancelled": true}})
+}
+
+// ---------- Direct-debit deposits ----------
+
+// POST /v1/deposits/direct-debit  {"mandateId":"...","amount":100000}
+// Funds the wallet from the mandate's bank account. The bank balance is
+// checked first (refreshed if older than bankBalanceMaxAge); the debit then
+// runs in the background and the wallet is credited when it succeeds.
+// Idempotency-Key makes retries return the original debit.
+func (app *App) CreateDirectDebit(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	if !app.openBankingAvailable(w) {
+		return
+	}
+	var body struct {
+		MandateID string `json:"mandateId" validate:"required,uuid"`
+		Amount    int64  `json:"amount" validate:"kobo"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	ctx := r.Context()
+	if accountStatusError(w, app.checkCanMoveMoney(ctx, uid)) {
+		return
+	}
+	idem := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if idem == "" {
+		idem = uuid.NewString()
+	}
+	if d, err := scanDirectDebit(app.DB.QueryRow(ctx, `
+		SELECT `+directDebitCols+` FROM direct_debits WHERE user_id=$1 AND idempotency_key=$2
+	`, uid, idem)); err == nil {
+		writeJSON(w, http.StatusOK, map[string]any{"data": d})
+		return
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	var linkID, providerAccountID, status string
+	var maxAmount int64
+	var balance *int64
+	var balanceAt *time.Time
+	err := app.DB.QueryRow(ctx, `
+		SELECT b.id, b.provider_account_id, b.balance, b.balance_at,
+		       CASE WHEN m.expires_at <= now() THEN 'expired' ELSE m.status END, m.max_amount
+		FROM direct_debit_mandates m JOIN bank_links b ON b.id = m.bank_link_id
+		WHERE m.id=$1 AND m.user_id=$2 AND m.provider=$3 AND b.unlinked_at IS NULL
+	`, body.MandateID, uid, app.OpenBanking.Name()).Scan(&linkID, &providerAccountID, &balance, &balanceAt, &status, &maxAmount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if status != openbanking.MandateActive {
+		apierror.Write(w, apierror.New(http.StatusConflict, "mandate_not_active"))
+		return
+	}
+	if body.Amount > maxAmount {
+		apierror.Write(w, apierror.New(http.StatusUnprocessableEntity, "amount_exceeds_mandate"))
+		return
+	}
+	if balance == nil || balanceAt == nil || time.Since(*balanceAt) > bankBalanceMaxAge {
+		b, _, err := app.refreshBankBalance(ctx, linkID, providerAccountID)
+		if err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("bank_link_id", linkID).Msg("bank balance refresh failed")
+			apierror.Write(w, apierror.New(http.StatusBadGateway, "bank_balance_unavailable"))
+			return
+		}
+		balance = &b
+	}
+	if *balance < body.Amount {
+		apierror.Write(w, apierror.New(http.StatusUnprocessableEntity, "insufficient_bank_balance"))
+		return
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+	d, err := scanDirectDebit(tx.QueryRow(ctx, `
+		INSERT INTO direct_debits (user_id, mandate_id, amount, reference, idempotency_key)
+		VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (user_id, idempotency_key) DO NOTHING
+		RETURNING `+directDebitCols,
+		uid, body.MandateID, body.Amount, "dd-"+uuid.NewString(), idem))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// a concurrent retry with the same key won
+		d, err = scanDirectDebit(app.DB.QueryRow(ctx, `
+			SELECT `+directDebitCols+` FROM direct_debits WHERE user_id=$1 AND idempotency_key=$2
+		`, uid, idem))
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"data": d})
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("insert direct debit failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := jobs.Enqueue(ctx, tx, jobDirectDebitSubmit, map[string]any{"debitId": d.ID},
+		jobs.Options{MaxAttempts: 5, UniqueKey: "direct_debit.submit:" + d.ID}); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"data": d})
+}
+
+// GET /v1/deposits/direct-debit?limit=&cursor=
+func (app *App) ListMyDirectDebits(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	pg, ok := app.parsePage(w, r, "deposits.direct_debit", pagination.Standard)
+	if !ok {
+		return
+	}
+	afterAt, afterID := pg.AfterArgs()
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT `+directDebitCols+` FROM direct_debits
+		WHERE user_id=$1
+		  AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3::uuid))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, uid, afterAt, afterID, pg.Limit+1)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []directDebitDTO{}
+	for rows.Next() {
+		d, err := scanDirectDebit(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, d)
+	}
+	out, paging := pagination.Trim(pg, out, func(d directDebitDTO) pagination.Key { return pagination.Key{Time: d.CreatedAt, ID: d.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
+
+// submitDirectDebitJob asks the provider to pull a pending debit. The debit
+// reference is the provider's idempotency key, so a retry after a lost
+// response is safe.
+func (app *App) submitDirectDebitJob(ctx context.Context, job *jobs.Job) error {
+	var p struct {
+		DebitID string `json:"debitId"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+	var status, reference, mandateStatus string
+	var providerMandateID *string
+	var amount int64
+	err := app.DB.QueryRow(ctx, `
+		SELECT d.status, d.reference, d.amount, m.provider_mandate_id, m.status
+		FROM direct_debits d JOIN direct_debit_mandates m ON m.id = d.mandate_id
+		WHERE d.id=$1
+	`, p.DebitID).Scan(&status, &reference, &amount, &providerMandateID, &mandateStatus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if status != "pending" {
+		return nil
+	}
+	if app.OpenBanking == nil || providerMandateID == nil || mandateStatus != openbanking.MandateActive {
+		return app.settleDirectDebit(ctx, reference, false, "mandate no longer active")
+	}
+
+	// other errors are retried and, once exhausted, dead-lettered with the
+	// debit left pending: the bank may have been debited
+	result, err := app.OpenBanking.Debit(ctx, *providerMandateID, amount, reference, "Okies wallet funding")
+	if errors.Is(err, openbanking.ErrRejected) {
+		if serr := app.settleDirectDebit(ctx, reference, false, err.Error()); serr != nil {
+			return serr
+		}
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	switch result {
+	case openbanking.DebitSucceeded:
+		return app.settleDirectDebit(ctx, reference, true, "")
+	case openbanking.DebitFailed:
+		return app.settleDirectDebit(ctx, reference, false, "declined by the bank")
+	}
+	_, err = app.DB.Exec(ctx, `
+		UPDATE direct_debits SET status='processing', updated_at=now() WHERE id=$1 AND status='pending'
+	`, p.DebitID)
+	return err
+}
+
+// settleDirectDebit moves a debit to its final state; a successful one
+// credits the wallet in the same transaction. Settling twice is a no-op.
+func (app *App) settleDirectDebit(ctx context.Context, reference string, succeeded bool, reason string) error {
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var id, uid, mandateID, status string
+	var amount int64
+	err = tx.QueryRow(ctx, `
+		SELECT id, user_id, mandate_id, amount, status FROM direct_debits WHERE reference=$1 FOR UPDATE
+	`, reference).Scan(&id, &uid, &mandateID, &amount, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if status == "succeeded" || status == "failed" {
+		return nil
+	}
+	if !succeeded {
+		if _, err := tx.Exec(ctx, `
+			UPDATE direct_debits SET status='failed', error=NULLIF($2,''), updated_at=now() WHERE id=$1
+		`, id, reason); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+
+	userWid, err := app.walletIDForUser(ctx, uid)
+	if err != nil {
+		return err
+	}
+	_, systemWid, err := app.systemUserAndWallet(ctx)
+	if err != nil {
+		return err
+	}
+	if err := app.lockWallets(ctx, tx, systemWid, userWid); err != nil {
+		return err
+	}
+	var txID string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+		VALUES ($1,'direct_debit',$2,'NGN', jsonb_build_object('directDebitId', $3::text, 'mandateId', $4::text))
+		RETURNING id
+	`, "direct_debit:"+id, amount, id, mandateID).Scan(&txID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+		VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+	`, txID, systemWid, amount, userWid); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE direct_debits SET status='succeeded', tx_id=$2, updated_at=now() WHERE id=$1
+	`, id, txID); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	app.Events.Publish(ctx, evDepositSettled, depositSettled{
+		TxID: txID, UserID: uid, Amount: amount, Source: "direct_debit",
+	})
+	return nil
+}
+
+// ---------- Handlers (Webhooks) ----------
+
+// POST /v1/webhooks/openbanking/mono
+// Mandate approvals and debit results. Stored and queued like the
+// Flutterwave webhook, then acknowledged.
+func (app *App) OpenBankingWebhook(w http.ResponseWriter, r *http.Request) {
+	if app.OpenBanking == nil || app.OpenBanking.Name() != chi.URLParam(r, "provider") {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "webhook_not_configured"))
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBody))
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "bad_payload"))
+		return
+	}
+	provider := app.OpenBanking.Name()
+	ev, err := app.OpenBanking.ParseWebhook(body, r.Header)
+	if errors.Is(err, openbanking.ErrBadSignature) {
+		app.alertBadWebhookSignature(r, provider)
+		apierror.Write(w, apierror.New(http.StatusForbidden, "bad_signature"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "bad_payload"))
+		return
+	}
+	var raw struct {
+		Event string `json:"event"`
+	}
+	_ = json.Unmarshal(body, &raw)
+
+	ctx := r.Context()
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+	var eventID string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO webhook_events (provider, event, reference, payload, payload_full)
+		VALUES ($1, $2, NULLIF($3,''), $4::jsonb, $5::jsonb)
+		RETURNING id
+	`, provider, raw.Event, ev.Reference, string(redact.JSON(body)), string(body)).Scan(&eventID); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("reference", ev.Reference).Msg("store webhook event failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if ev.Type != "" {
+		if err := jobs.Enqueue(ctx, tx, jobOpenBankingEvent, map[string]any{
+			"eventId": eventID, "type": ev.Type, "mandateId": ev.MandateID, "reference": ev.Reference, "error": ev.Error,
+		}, jobs.Options{}); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// openBankingEventJob applies a stored webhook to its mandate or debit.
+func (app *App) openBankingEventJob(ctx context.Context, job *jobs.Job) error {
+	var p struct {
+		EventID   string `json:"eventId"`
+		Type      string `json:"type"`
+		MandateID string `json:"mandateId"`
+		Reference string `json:"reference"`
+		Error     string `json:"error"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+	var err error
+	switch p.Type {
+	case openbanking.EventMandateActive:
+		_, err = app.DB.Exec(ctx, `
+			UPDATE direct_debit_mandates
+			SET status='active', provider_mandate_id=COALESCE(provider_mandate_id, NULLIF($2,'')), updated_at=now()
+			WHERE (reference=$1 OR provider_mandate_id=NULLIF($2,'')) AND status='pending'
+		`, p.Reference, p.MandateID)
+	case openbanking.EventMandateCancelled, openbanking.EventMandateFailed:
+		status := openbanking.MandateCancelled
+		if p.Type == openbanking.EventMandateFailed {
+			status = openbanking.MandateFailed
+		}
+		_, err = app.DB.Exec(ctx, `
+			UPDATE direct_debit_mandates SET status=$3, error=NULLIF($4,''), updated_at=now()
+			WHERE (reference=$1 OR provider_mandate_id=NULLIF($2,'')) AND status IN ('pending','active')
+		`, p.Reference, p.MandateID, status, p.Error)
+	case openbanking.EventDebitSucceeded, openbanking.EventDebitFailed:
+		err = app.settleDirectDebit(ctx, p.Reference, p.Type == openbanking.EventDebitSucceeded, p.Error)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = app.DB.Exec(ctx, `UPDATE webhook_events SET processed_at = now() WHERE id=$1`, p.EventID)
+	return err
+}
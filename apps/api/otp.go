@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// One-time codes sent by SMS, for verifying a phone number and for logging
+// in with one, or by email. A code is six digits, lives otpTTL, and allows
+// otpMaxAttempts guesses; only a keyed hash of it is stored.
+
+const (
+	otpTTL         = 10 * time.Minute
+	otpMaxAttempts = 5
+	// per number or address, whoever asks, so it can't be flooded with codes
+	otpResendGap   = time.Minute
+	otpMaxPerHour  = 5
+	otpPhoneVerify = "phone_verify"
+	otpLogin       = "login"
+	otpReactivate  = "reactivate"
+	otpStepUp      = "step_up"
+)
+
+var (
+	errOTPInvalid     = errors.New("otp wrong, expired or used up")
+	errOTPRateLimited = errors.New("too many codes sent to this number")
+)
+
+// otpCode is what a confirmed code was issued for. Phone is empty for codes
+// sent by email.
+type otpCode struct {
+	UserID *string
+	Phone  string
+}
+
+func (app *App) otpHash(id, code string) string { return app.Sealer.Index("otp:" + id + ":" + code) }
+
+// issueOTP texts a new code for purpose to phone and returns the ID the
+// client confirms it against. userID may be empty when the number isn't
+// tied to an account yet.
+func (app *App) issueOTP(ctx context.Context, userID, phone, purpose string) (string, time.Time, error) {
+	id, code, expiresAt, err := app.newOTP(ctx, userID, phone, "", purpose)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if _, err := app.sendSMS(ctx, userID, phone, "otp", map[string]any{"code": code, "minutes": int(otpTTL.Minutes())}); err != nil {
+		return "", time.Time{}, err
+	}
+	return id, expiresAt, nil
+}
+
+// issueEmailOTP emails a new code for purpose to userID's address, email.
+func (app *App) issueEmailOTP(ctx context.Context, userID, email, purpose string) (string, time.Time, error) {
+	id, code, expiresAt, err := app.newOTP(ctx, userID, "", email, purpose)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	app.sendEmail(ctx, userID, "security_code", map[string]any{"code": code, "minutes": int(otpTTL.Minutes())})
+	return id, expiresAt, nil
+}
+
+// newOTP stores a code for phone or email, whichever is set, and returns it
+// for sending.
+func (app *App) newOTP(ctx context.Context, userID, phone, email, purpose string) (id, code string, expiresAt time.Time, err error) {
+	to := phone + email
+	var recent int
+	var last *time.Time
+	if err := app.DB.QueryRow(ctx, `
+		SELECT COUNT(*), MAX(created_at) FROM otp_codes
+		WHERE (phone=$1 OR email=$1) AND created_at > now() - interval '1 hour'
+	`, to).Scan(&recent, &last); err != nil {
+		return "", "", time.Time{}, err
+	}
+	if recent >= otpMaxPerHour || (last != nil && time.Since(*last) < otpResendGap) {
+		return "", "", time.Time{}, errOTPRateLimited
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	code = fmt.Sprintf("%06d", n.Int64())
+
+	// the hash covers the ID, so the same code in two rows hashes apart
+	id = uuid.NewString()
+	expiresAt = time.Now().Add(otpTTL)
+	if _, err := app.DB.Exec(ctx, `
+		INSERT INTO otp_codes (id, user_id, phone, email, purpose, code_hash, expires_at)
+		VALUES ($1, NULLIF($2,'')::uuid, NULLIF($3,''), NULLIF($4,''), $5, $6, $7)
+	`, id, userID, phone, email, purpose, app.otpHash(id, code), expiresAt); err != nil {
+		return "", "", time.Time{}, err
+	}
+	return id, code, expiresAt, nil
+}
+
+// checkOTP spends one attempt on code and, if it matches, uses it up.
+func (app *App) checkOTP(ctx context.Context, id, purpose, code string) (otpCode, error) {
+	var (
+		c    otpCode
+		hash string
+	)
+	err := app.DB.QueryRow(ctx, `
+		UPDATE otp_codes SET attempts = attempts + 1
+		WHERE id::text=$1 AND purpose=$2 AND consumed_at IS NULL AND expires_at > now() AND attempts < $3
+		RETURNING code_hash, user_id, COALESCE(phone,'')
+	`, id, purpose, otpMaxAttempts).Scan(&hash, &c.UserID, &c.Phone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c, errOTPInvalid
+	}
+	if err != nil {
+		return c, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(app.otpHash(id, code))) != 1 {
+		return c, errOTPInvalid
+	}
+	tag, err := app.DB.Exec(ctx, `UPDATE otp_codes SET consumed_at=now() WHERE id=$1 AND consumed_at IS NULL`, id)
+	if err != nil {
+		return c, err
+	}
+	if tag.RowsAffected() == 0 {
+		return c, errOTPInvalid
+	}
+	return c, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+)
+
+// OAuth2 client-credentials grant (RFC 6749 §4.4) for partners. An admin
+// registers a client for a partner with the scopes it may ask for; the
+// partner exchanges its client ID and secret at POST /v1/oauth/token for a
+// short-lived access token and calls /v1/partner with it. Errors from the
+// token endpoint use the RFC's format, not apierror, so OAuth libraries can
+// read them.
+
+const (
+	partnerTokenTTL = time.Hour
+
+	partnerClientIDPrefix     = "okc_"
+	partnerClientSecretPrefix = "okcs_"
+)
+
+type partnerClientDTO struct {
+	ID         string     `json:"id"`
+	PartnerID  string     `json:"partnerId"`
+	ClientID   string     `json:"clientId"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+const partnerClientCols = `id, partner_id, client_id, scopes, created_at, last_used_at, revoked_at`
+
+func scanPartnerClient(row pgx.Row) (partnerClientDTO, error) {
+	var c partnerClientDTO
+	err := row.Scan(&c.ID, &c.PartnerID, &c.ClientID, &c.Scopes, &c.CreatedAt, &c.LastUsedAt, &c.RevokedAt)
+	return c, err
+}
+
+func oauthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+// clientCredentials reads the client's ID and secret from HTTP Basic auth,
+// or failing that from the form body.
+func clientCredentials(r *http.Request) (id, secret string, basic bool) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		// RFC 6749 §2.3.1: both are form-encoded before going into the header
+		if u, err := url.QueryUnescape(id); err == nil {
+			id = u
+		}
+		if u, err := url.QueryUnescape(secret); err == nil {
+			secret = u
+		}
+		return id, secret, true
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), false
+}
+
+// POST /v1/oauth/token  (application/x-www-form-urlencoded)
+// grant_type=client_credentials&scope=gifts:write wallet:read
+// Without scope, the token gets every scope the client was registered with.
+func (app *App) OAuthToken(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "the body must be form-encoded")
+		return
+	}
+	if gt := r.PostForm.Get("grant_type"); gt != "client_credentials" {
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type", "only client_credentials is supported")
+		return
+	}
+
+	clientID, secret, basic := clientCredentials(r)
+	invalidClient := func() {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="okies"`)
+		}
+		oauthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+	if !strings.HasPrefix(clientID, partnerClientIDPrefix) || secret == "" {
+		invalidClient()
+		return
+	}
+	var partnerID, userID, secretHash string
+	var granted []string
+	err := app.DB.QueryRow(r.Context(), `
+		SELECT c.partner_id, p.user_id, c.secret_hash, c.scopes
+		FROM partner_clients c JOIN partners p ON p.id = c.partner_id
+		WHERE c.client_id=$1 AND c.revoked_at IS NULL AND p.revoked_at IS NULL
+	`, clientID).Scan(&partnerID, &userID, &secretHash, &granted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		invalidClient()
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("look up oauth client failed")
+		oauthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(hashPartnerKey(secret)), []byte(secretHash)) != 1 {
+		invalidClient()
+		return
+	}
+	if err := app.checkAccountActive(r.Context(), userID); err != nil {
+		oauthError(w, http.StatusBadRequest, "unauthorized_client", "the partner's account is not active")
+		return
+	}
+
+	scopes := granted
+	if requested := a.ParseScopes(r.PostForm.Get("scope")); len(requested) > 0 {
+		for _, s := range requested {
+			if !slices.Contains(granted, s) {
+				oauthError(w, http.StatusBadRequest, "invalid_scope", "scope "+s+" is not granted to this client")
+				return
+			}
+		}
+		scopes = requested
+	}
+
+	token, err := a.GeneratePartner(app.JWT, userID, partnerID, clientID, scopes, partnerTokenTTL)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if _, err := app.DB.Exec(r.Context(), `UPDATE partner_clients SET last_used_at=now() WHERE client_id=$1`, clientID); err != nil {
+		log.Ctx(r.Context()).Warn().Err(err).Msg("record oauth client use failed")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(partnerTokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// ---------- Handlers (Admin) ----------
+
+// POST /v1/admin/partners/{id}/clients  {"scopes":["gifts:write","wallet:read"]}
+// The response carries the client secret; it can't be retrieved again.
+func (app *App) AdminCreatePartnerClient(w http.ResponseWriter, r *http.Request) {
+	partnerID := strings.TrimSpace(chi.URLParam(r, "id"))
+	var body struct {
+		Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=wallet:read gifts:write vouchers:write webhooks:manage"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	idBuf, secretBuf := make([]byte, 12), make([]byte, 32)
+	if _, err := rand.Read(idBuf); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_error"))
+		return
+	}
+	if _, err := rand.Read(secretBuf); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_error"))
+		return
+	}
+	clientID := partnerClientIDPrefix + hex.EncodeToString(idBuf)
+	secret := partnerClientSecretPrefix + base64.RawURLEncoding.EncodeToString(secretBuf)
+	slices.Sort(body.Scopes)
+	body.Scopes = slices.Compact(body.Scopes)
+
+	actor, _ := getUserID(r)
+	c, err := scanPartnerClient(app.DB.QueryRow(r.Context(), `
+		INSERT INTO partner_clients (partner_id, client_id, secret_hash, scopes, created_by)
+		SELECT id, $2, $3, $4, $5 FROM partners WHERE id=$1 AND revoked_at IS NULL
+		RETURNING `+partnerClientCols,
+		partnerID, clientID, hashPartnerKey(secret), body.Scopes, actor))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("create partner client failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "partner_client.create",
+		TargetType: "partner",
+		TargetID:   partnerID,
+		After:      c,
+	})
+	writeJSON(w, http.StatusCreated, map[string]any{"data": map[string]any{"client": c, "clientSecret": secret}})
+}
+
+// GET /v1/admin/partners/{id}/clients
+func (app *App) AdminListPartnerClients(w http.ResponseWriter, r *http.Request) {
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT `+partnerClientCols+` FROM partner_clients WHERE partner_id=$1 ORDER BY created_at DESC
+	`, strings.TrimSpace(chi.URLParam(r, "id")))
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []partnerClientDTO{}
+	for rows.Next() {
+		c, err := scanPartnerClient(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, c)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// DELETE /v1/admin/partners/{id}/clients/{clientId}
+// Tokens already issued to the client stop working immediately.
+func (app *App) AdminRevokePartnerClient(w http.ResponseWriter, r *http.Request) {
+	c, err := scanPartnerClient(app.DB.QueryRow(r.Context(), `
+		UPDATE partner_clients SET revoked_at=now()
+		WHERE partner_id=$1 AND id=$2 AND revoked_at IS NULL
+		RETURNING `+partnerClientCols,
+		strings.TrimSpace(chi.URLParam(r, "id")), strings.TrimSpace(chi.URLParam(r, "clientId"))))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.audit(r, auditEntry{
+		Action:     "partner_client.revoke",
+		TargetType: "partner",
+		TargetID:   c.PartnerID,
+		After:      c,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": c})
+}
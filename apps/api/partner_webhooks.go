@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/events"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+	"github.com/sudo-init-do/okies-backend/pkg/signing"
+)
+
+// Outgoing webhooks for partners. Domain events about a partner's account
+// become one delivery per subscribed endpoint; each is a job, retried with
+// the queue's backoff until it gets a 2xx or runs out of attempts. Every
+// request is signed with the endpoint's secret, under its key id, as
+// described in pkg/signing; after a rotation the previous secret signs too
+// until its overlap ends.
+//
+// Deliveries may arrive more than once and out of order; partners dedupe on
+// the event id.
+
+const (
+	partnerEvGiftReceived   = "gift.received"
+	partnerEvDepositSettled = "deposit.settled"
+	partnerEvWithdrawalPaid = "withdrawal.paid"
+
+	jobPartnerWebhook = "partner.webhook" // {"deliveryId"}
+
+	partnerWebhookSecretPrefix = "whsec_"
+	partnerWebhookKeyIDPrefix  = "whk_"
+	// response bodies kept in the delivery log, for debugging
+	partnerWebhookResponseMax = 1024
+)
+
+type partnerWebhookEndpoint struct {
+	ID                string     `json:"id"`
+	URL               string     `json:"url"`
+	Events            []string   `json:"events"`
+	KeyID             string     `json:"keyId"`
+	PreviousKeyID     *string    `json:"previousKeyId,omitempty"`
+	PreviousExpiresAt *time.Time `json:"previousKeyExpiresAt,omitempty"`
+	CreatedAt         time.Time  `json:"createdAt"`
+}
+
+const partnerWebhookEndpointCols = `id, url, events, key_id,
+	CASE WHEN previous_expires_at > now() THEN previous_key_id END,
+	CASE WHEN previous_expires_at > now() THEN previous_expires_at END, created_at`
+
+func scanPartnerWebhookEndpoint(row pgx.Row) (partnerWebhookEndpoint, error) {
+	var e partnerWebhookEndpoint
+	err := row.Scan(&e.ID, &e.URL, &e.Events, &e.KeyID, &e.PreviousKeyID, &e.PreviousExpiresAt, &e.CreatedAt)
+	return e, err
+}
+
+// newPartnerWebhookSecret returns a fresh secret, its key id and the
+// secret sealed for storage.
+func (app *App) newPartnerWebhookSecret(ctx context.Context) (secret, keyID, sealed string, err error) {
+	buf := make([]byte, 38)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	secret = partnerWebhookSecretPrefix + base64.RawURLEncoding.EncodeToString(buf[:32])
+	keyID = partnerWebhookKeyIDPrefix + hex.EncodeToString(buf[32:])
+	sealed, err = app.Sealer.Seal(ctx, secret)
+	return secret, keyID, sealed, err
+}
+
+type partnerWebhookDelivery struct {
+	ID             string     `json:"id"`
+	EndpointID     string     `json:"endpointId"`
+	EventID        string     `json:"eventId"`
+	Event          string     `json:"event"`
+	Status         string     `json:"status"` // pending | delivered | failed
+	Attempts       int        `json:"attempts"`
+	ResponseStatus *int       `json:"responseStatus,omitempty"`
+	ResponseBody   *string    `json:"responseBody,omitempty"`
+	LastError      *string    `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+}
+
+const partnerWebhookDeliveryCols = `d.id, d.endpoint_id, d.event_id, d.event, d.status, d.attempts,
+	d.response_status, d.response_body, d.last_error, d.created_at, d.delivered_at`
+
+func scanPartnerWebhookDelivery(row pgx.Row) (partnerWebhookDelivery, error) {
+	var d partnerWebhookDelivery
+	err := row.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.Event, &d.Status, &d.Attempts,
+		&d.ResponseStatus, &d.ResponseBody, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+	return d, err
+}
+
+// registerPartnerWebhookSubscribers turns domain events into partner events.
+func (app *App) registerPartnerWebhookSubscribers() {
+	b := app.Events
+	b.Subscribe(evGiftCreated, func(ctx context.Context, e events.Event) {
+		var g giftCreated
+		if decodeEvent(e, &g) && !g.Held {
+			app.emitPartnerEvent(ctx, g.RecipientID, partnerEvGiftReceived, e.At,
+				map[string]any{"giftId": g.GiftID, "senderId": g.SenderID, "amount": g.Amount})
+		}
+	})
+	b.Subscribe(evDepositSettled, func(ctx context.Context, e events.Event) {
+		var d depositSettled
+		if decodeEvent(e, &d) {
+			app.emitPartnerEvent(ctx, d.UserID, partnerEvDepositSettled, e.At,
+				map[string]any{"transactionId": d.TxID, "amount": d.Amount})
+		}
+	})
+	b.Subscribe(evWithdrawalSettled, func(ctx context.Context, e events.Event) {
+		var p withdrawalSettled
+		if decodeEvent(e, &p) && p.Status == "succeeded" {
+			app.emitPartnerEvent(ctx, p.UserID, partnerEvWithdrawalPaid, e.At,
+				map[string]any{"payoutId": p.PayoutID, "reference": p.Reference, "amount": p.Amount})
+		}
+	})
+}
+
+// emitPartnerEvent queues a delivery of event to every live endpoint
+// subscribed to it by the partners of userID.
+func (app *App) emitPartnerEvent(ctx context.Context, userID, event string, at time.Time, data any) {
+	l := log.Ctx(ctx).With().Str("event", event).Str("user_id", userID).Logger()
+	rows, err := app.DB.Query(ctx, `
+		SELECT e.id FROM partner_webhook_endpoints e JOIN partners p ON p.id = e.partner_id
+		WHERE p.user_id=$1 AND p.revoked_at IS NULL AND e.deleted_at IS NULL AND $2 = ANY(e.events)
+	`, userID, event)
+	if err != nil {
+		l.Error().Err(err).Msg("find partner webhook endpoints failed")
+		return
+	}
+	endpoints, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil || len(endpoints) == 0 {
+		if err != nil {
+			l.Error().Err(err).Msg("find partner webhook endpoints failed")
+		}
+		return
+	}
+
+	eventID := uuid.NewString()
+	body, err := json.Marshal(map[string]any{"id": eventID, "type": event, "createdAt": at, "data": data})
+	if err != nil {
+		l.Error().Err(err).Msg("marshal partner event failed")
+		return
+	}
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		l.Error().Err(err).Msg("queue partner webhooks failed")
+		return
+	}
+	defer tx.Rollback(ctx)
+	for _, endpointID := range endpoints {
+		var deliveryID string
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO partner_webhook_deliveries (endpoint_id, event_id, event, body)
+			VALUES ($1,$2,$3,$4) RETURNING id
+		`, endpointID, eventID, event, string(body)).Scan(&deliveryID); err != nil {
+			l.Error().Err(err).Msg("queue partner webhooks failed")
+			return
+		}
+		if err := jobs.Enqueue(ctx, tx, jobPartnerWebhook, map[string]string{"deliveryId": deliveryID}, jobs.Options{}); err != nil {
+			l.Error().Err(err).Msg("queue partner webhooks failed")
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		l.Error().Err(err).Msg("queue partner webhooks failed")
+	}
+}
+
+// partnerWebhookJob sends one delivery. Non-2xx responses are retried; the
+// last failure marks the delivery failed rather than dead-lettering the job,
+// since a partner's endpoint being down is not an operator problem. Admins
+// can redeliver it later.
+func (app *App) partnerWebhookJob(ctx context.Context, job *jobs.Job) error {
+	var p struct {
+		DeliveryID string `json:"deliveryId"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+	var endpointURL, secret, keyID, event, body, status string
+	var prevSecret, prevKeyID *string
+	var live bool
+	err := app.DB.QueryRow(ctx, `
+		SELECT e.url, e.secret, e.key_id,
+		       CASE WHEN e.previous_expires_at > now() THEN e.previous_secret END,
+		       CASE WHEN e.previous_expires_at > now() THEN e.previous_key_id END,
+		       d.event, d.body, d.status, e.deleted_at IS NULL AND pt.revoked_at IS NULL
+		FROM partner_webhook_deliveries d
+		JOIN partner_webhook_endpoints e ON e.id = d.endpoint_id
+		JOIN partners pt ON pt.id = e.partner_id
+		WHERE d.id=$1
+	`, p.DeliveryID).Scan(&endpointURL, &secret, &keyID, &prevSecret, &prevKeyID, &event, &body, &status, &live)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && status != "pending") {
+		return nil // purged, or already delivered by a redelivery
+	}
+	if err != nil {
+		return err
+	}
+	if !live {
+		_, err := app.DB.Exec(ctx, `
+			UPDATE partner_webhook_deliveries SET status='failed', last_error='endpoint removed', updated_at=now()
+			WHERE id=$1`, p.DeliveryID)
+		return err
+	}
+	if secret, err = app.Sealer.Open(ctx, secret); err != nil {
+		return err
+	}
+	keys := []signing.Key{{ID: keyID, Secret: []byte(secret)}}
+	if prevSecret != nil && prevKeyID != nil {
+		prev, err := app.Sealer.Open(ctx, *prevSecret)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, signing.Key{ID: *prevKeyID, Secret: []byte(prev)})
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpointURL, strings.NewReader(body))
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Okies-Webhooks/1")
+	req.Header.Set("Okies-Event", event)
+	req.Header.Set("Okies-Delivery", p.DeliveryID)
+	signing.SignRequest(req, []byte(body), keys...)
+
+	var code *int
+	var respBody *string
+	res, sendErr := app.PartnerHTTP.Do(req)
+	if sendErr == nil {
+		raw, _ := io.ReadAll(io.LimitReader(res.Body, partnerWebhookResponseMax))
+		res.Body.Close()
+		s := string(bytes.ToValidUTF8(raw, nil))
+		code, respBody = &res.StatusCode, &s
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			sendErr = fmt.Errorf("endpoint answered %d", res.StatusCode)
+		}
+	}
+
+	status = "delivered"
+	var lastErr *string
+	if sendErr != nil {
+		msg := sendErr.Error()
+		lastErr = &msg
+		status = "pending"
+		if job.Attempt >= job.MaxAttempts {
+			status = "failed"
+		}
+	}
+	if _, err := app.DB.Exec(ctx, `
+		UPDATE partner_webhook_deliveries
+		SET status=$2, attempts=attempts+1, response_status=$3, response_body=$4, last_error=$5, updated_at=now(),
+		    delivered_at=CASE WHEN $2='delivered' THEN now() END
+		WHERE id=$1
+	`, p.DeliveryID, status, code, respBody, lastErr); err != nil {
+		return err
+	}
+	if status == "pending" {
+		return sendErr
+	}
+	return nil
+}
+
+// ---------- Handlers (Partner) ----------
+
+// POST /v1/partner/webhooks  {"url":"https://...","events":["gift.received"]}
+// The response carries the signing secret; it can't be retrieved again.
+func (app *App) PartnerCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	partnerID, _ := getPartnerID(r)
+	var body struct {
+		URL    string   `json:"url" validate:"required,http_url,max=2000"`
+		Events []string `json:"events" validate:"required,min=1,dive,oneof=gift.received deposit.settled withdrawal.paid"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if u, err := url.Parse(body.URL); err != nil || (u.Scheme != "https" && app.Config.Env == "production") {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_webhook_url"))
+		return
+	}
+
+	secret, keyID, sealed, err := app.newPartnerWebhookSecret(r.Context())
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("generate webhook secret failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "encryption_error"))
+		return
+	}
+
+	e, err := scanPartnerWebhookEndpoint(app.DB.QueryRow(r.Context(), `
+		INSERT INTO partner_webhook_endpoints (partner_id, url, events, secret, key_id)
+		VALUES ($1,$2,$3,$4,$5)
+		RETURNING `+partnerWebhookEndpointCols,
+		partnerID, body.URL, body.Events, sealed, keyID))
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("create partner webhook failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"data": map[string]any{"endpoint": e, "secret": secret}})
+}
+
+// GET /v1/partner/webhooks
+func (app *App) PartnerListWebhooks(w http.ResponseWriter, r *http.Request) {
+	partnerID, _ := getPartnerID(r)
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT `+partnerWebhookEndpointCols+` FROM partner_webhook_endpoints
+		WHERE partner_id=$1 AND deleted_at IS NULL
+		ORDER BY created_at
+	`, partnerID)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []partnerWebhookEndpoint{}
+	for rows.Next() {
+		e, err := scanPartnerWebhookEndpoint(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, e)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// POST /v1/partner/webhooks/{id}/rotate-secret  {"overlapHours":24}
+// Issues a new signing secret under a new key id. For overlapHours (0-168,
+// default 24) deliveries are signed with both secrets, so the partner can
+// deploy the new one before the old stops working. The response carries the
+// new secret; it can't be retrieved again.
+func (app *App) PartnerRotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	partnerID, _ := getPartnerID(r)
+	var body struct {
+		OverlapHours *int `json:"overlapHours" validate:"omitempty,min=0,max=168"`
+	}
+	if r.ContentLength != 0 && !decodeBody(w, r, &body) {
+		return
+	}
+	overlap := 24
+	if body.OverlapHours != nil {
+		overlap = *body.OverlapHours
+	}
+	secret, keyID, sealed, err := app.newPartnerWebhookSecret(r.Context())
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("generate webhook secret failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "encryption_error"))
+		return
+	}
+
+	e, err := scanPartnerWebhookEndpoint(app.DB.QueryRow(r.Context(), `
+		UPDATE partner_webhook_endpoints
+		SET previous_secret=secret, previous_key_id=key_id,
+		    previous_expires_at=now() + make_interval(hours => $5::int),
+		    secret=$3, key_id=$4
+		WHERE id=$1 AND partner_id=$2 AND deleted_at IS NULL
+		RETURNING `+partnerWebhookEndpointCols,
+		strings.TrimSpace(chi.URLParam(r, "id")), partnerID, sealed, keyID, overlap))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("rotate partner webhook secret failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"endpoint": e, "secret": secret}})
+}
+
+// DELETE /v1/partner/webhooks/{id}
+// Pending deliveries to the endpoint are dropped when their turn comes.
+func (app *App) PartnerDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	partnerID, _ := getPartnerID(r)
+	tag, err := app.DB.Exec(r.Context(), `
+		UPDATE partner_webhook_endpoints SET deleted_at=now()
+		WHERE id=$1 AND partner_id=$2 AND deleted_at IS NULL
+	`, strings.TrimSpace(chi.URLParam(r, "id")), partnerID)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /v1/partner/webhooks/{id}/deliveries?status=
+func (app *App) PartnerListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	partnerID, _ := getPartnerID(r)
+	app.listPartnerWebhookDeliveries(w, r, `
+		SELECT `+partnerWebhookDeliveryCols+`
+		FROM partner_webhook_deliveries d JOIN partner_webhook_endpoints e ON e.id = d.endpoint_id
+		WHERE e.id=$1 AND e.partner_id=$2 AND ($3 = '' OR d.status = $3)
+		ORDER BY d.created_at DESC LIMIT 200
+	`, strings.TrimSpace(chi.URLParam(r, "id")), partnerID, strings.TrimSpace(r.URL.Query().Get("status")))
+}
+
+func (app *App) listPartnerWebhookDeliveries(w http.ResponseWriter, r *http.Request, query string, args ...any) {
+	rows, err := app.DB.Query(r.Context(), query, args...)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []partnerWebhookDelivery{}
+	for rows.Next() {
+		d, err := scanPartnerWebhookDelivery(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, d)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// ---------- Handlers (Admin) ----------
+
+// GET /v1/admin/partners/{id}/webhook-deliveries?status=
+func (app *App) AdminListPartnerWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	app.listPartnerWebhookDeliveries(w, r, `
+		SELECT `+partnerWebhookDeliveryCols+`
+		FROM partner_webhook_deliveries d JOIN partner_webhook_endpoints e ON e.id = d.endpoint_id
+		WHERE e.partner_id=$1 AND ($2 = '' OR d.status = $2)
+		ORDER BY d.created_at DESC LIMIT 500
+	`, strings.TrimSpace(chi.URLParam(r, "id")), strings.TrimSpace(r.URL.Query().Get("status")))
+}
+
+// POST /v1/admin/webhook-deliveries/{id}/redeliver
+// Sends a delivery again with a fresh set of attempts, whatever its status.
+// The body and event id are unchanged, so partners dedupe it as usual.
+func (app *App) AdminRedeliverPartnerWebhook(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	ctx := r.Context()
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := scanPartnerWebhookDelivery(tx.QueryRow(ctx, `
+		UPDATE partner_webhook_deliveries d SET status='pending', updated_at=now()
+		WHERE id=$1
+		RETURNING `+partnerWebhookDeliveryCols, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := jobs.Enqueue(ctx, tx, jobPartnerWebhook, map[string]string{"deliveryId": d.ID}, jobs.Options{}); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "partner_webhook.redeliver",
+		TargetType: "partner_webhook_delivery",
+		TargetID:   d.ID,
+		After:      map[string]any{"status": d.Status, "event": d.Event, "eventId": d.EventID},
+	})
+	writeJSON(w, http.StatusAccepted, map[string]any{"data": d})
+}
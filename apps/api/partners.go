@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+)
+
+// Partners are third parties integrating on behalf of one Okies account
+// (a merchant's or business's). They call /v1/partner with an API key in
+// X-API-Key, shown once when an admin creates the partner, or with a scoped
+// OAuth access token; see partner_oauth.go.
+
+const (
+	ctxPartnerID     ctxKey = "partnerID"
+	ctxPartnerScopes ctxKey = "partnerScopes"
+
+	partnerKeyPrefix = "okp_"
+)
+
+type partnerDTO struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"userId"`
+	Name      string     `json:"name"`
+	KeyPrefix string     `json:"keyPrefix"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+func newPartnerKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return partnerKeyPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashPartnerKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// PartnerAuth authenticates a partner by API key, which grants every
+// scope, or by an OAuth access token (see partner_oauth.go), which grants
+// the scopes it was issued with. The partner acts as its account, so a
+// frozen or suspended account locks the partner out too.
+func (app *App) PartnerAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var partnerID, userID string
+		var scopes []string
+		var err error
+		if authz := r.Header.Get("Authorization"); strings.HasPrefix(authz, "Bearer ") {
+			claims, perr := a.ParsePartner(app.JWT, strings.TrimPrefix(authz, "Bearer "))
+			if perr != nil {
+				apierror.Write(w, apierror.New(http.StatusUnauthorized, "invalid_token"))
+				return
+			}
+			// revoking the client or partner cuts off tokens already issued
+			partnerID, scopes = claims.Partner, a.ParseScopes(claims.Scope)
+			err = app.DB.QueryRow(r.Context(), `
+				SELECT p.user_id FROM partner_clients c JOIN partners p ON p.id = c.partner_id
+				WHERE c.client_id=$1 AND c.partner_id=$2 AND c.revoked_at IS NULL AND p.revoked_at IS NULL
+			`, claims.ClientID, claims.Partner).Scan(&userID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				apierror.Write(w, apierror.New(http.StatusUnauthorized, "invalid_token"))
+				return
+			}
+		} else {
+			key := strings.TrimSpace(r.Header.Get("X-API-Key"))
+			if !strings.HasPrefix(key, partnerKeyPrefix) {
+				apierror.Write(w, apierror.New(http.StatusUnauthorized, "invalid_api_key"))
+				return
+			}
+			for _, sc := range a.AllScopes {
+				scopes = append(scopes, string(sc))
+			}
+			err = app.DB.QueryRow(r.Context(), `
+				SELECT id, user_id FROM partners WHERE key_hash=$1 AND revoked_at IS NULL
+			`, hashPartnerKey(key)).Scan(&partnerID, &userID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				apierror.Write(w, apierror.New(http.StatusUnauthorized, "invalid_api_key"))
+				return
+			}
+		}
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		if accountStatusError(w, app.checkAccountActive(r.Context(), userID)) {
+			return
+		}
+		setLogUser(r.Context(), userID)
+		ctx := context.WithValue(r.Context(), ctxPartnerID, partnerID)
+		ctx = context.WithValue(ctx, ctxPartnerScopes, scopes)
+		ctx = context.WithValue(ctx, ctxUserID, userID)
+		ctx = context.WithValue(ctx, ctxUserRole, a.RoleUser)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireScope gates a partner route on the caller holding s.
+func RequireScope(s a.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, _ := r.Context().Value(ctxPartnerScopes).([]string)
+			if !slices.Contains(scopes, string(s)) {
+				apierror.Write(w, apierror.New(http.StatusForbidden, "insufficient_scope"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func getPartnerID(r *http.Request) (string, bool) {
+	s, ok := r.Context().Value(ctxPartnerID).(string)
+	return s, ok
+}
+
+// ---------- Handlers (Admin) ----------
+
+// POST /v1/admin/partners  {"userId":"...","name":"..."}
+// The response carries the API key; it can't be retrieved again.
+func (app *App) AdminCreatePartner(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		UserID string `json:"userId" validate:"required,uuid"`
+		Name   string `json:"name" validate:"required,max=100"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	key, err := newPartnerKey()
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_error"))
+		return
+	}
+
+	actor, _ := getUserID(r)
+	p := partnerDTO{KeyPrefix: key[:len(partnerKeyPrefix)+6]}
+	err = app.DB.QueryRow(r.Context(), `
+		INSERT INTO partners (user_id, name, key_prefix, key_hash, created_by)
+		SELECT id, $2, $3, $4, $5 FROM users WHERE id=$1 AND anonymized_at IS NULL
+		RETURNING id, user_id, name, created_at
+	`, body.UserID, strings.TrimSpace(body.Name), p.KeyPrefix, hashPartnerKey(key), actor).
+		Scan(&p.ID, &p.UserID, &p.Name, &p.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("create partner failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "partner.create",
+		TargetType: "partner",
+		TargetID:   p.ID,
+		After:      p,
+	})
+	writeJSON(w, http.StatusCreated, map[string]any{"data": map[string]any{"partner": p, "apiKey": key}})
+}
+
+// GET /v1/admin/partners
+func (app *App) AdminListPartners(w http.ResponseWriter, r *http.Request) {
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT id, user_id, name, key_prefix, created_at, revoked_at
+		FROM partners ORDER BY created_at DESC LIMIT 500
+	`)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []partnerDTO{}
+	for rows.Next() {
+		var p partnerDTO
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.KeyPrefix, &p.CreatedAt, &p.RevokedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, p)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// DELETE /v1/admin/partners/{id}
+// Revokes the API key and stops webhook deliveries.
+func (app *App) AdminRevokePartner(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var p partnerDTO
+	err := app.DB.QueryRow(r.Context(), `
+		UPDATE partners SET revoked_at=now() WHERE id=$1 AND revoked_at IS NULL
+		RETURNING id, user_id, name, key_prefix, created_at, revoked_at
+	`, id).Scan(&p.ID, &p.UserID, &p.Name, &p.KeyPrefix, &p.CreatedAt, &p.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.audit(r, auditEntry{
+		Action:     "partner.revoke",
+		TargetType: "partner",
+		TargetID:   p.ID,
+		After:      p,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": p})
+}
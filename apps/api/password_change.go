@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+)
+
+// POST /v1/auth/change-password
+// {"currentPassword":"...","newPassword":"...","refreshToken":"..."}
+// Signs every other device out. The caller gets fresh tokens, which carry
+// on the session refreshToken belongs to when it is given.
+func (app *App) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		CurrentPassword string `json:"currentPassword" validate:"required,max=128"`
+		NewPassword     string `json:"newPassword" validate:"required,min=8,max=128"`
+		RefreshToken    string `json:"refreshToken"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+
+	var current, role string
+	err := app.DB.QueryRow(ctx, `SELECT COALESCE(password_hash,''), role FROM users WHERE id=$1`, uid).Scan(&current, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	// accounts made with Google or Apple have no password to check; they
+	// set one through forgot-password
+	if ok, err := a.CheckPassword(body.CurrentPassword, current); err != nil || !ok {
+		app.recordSecurityEvent(r, uid, secLoginFailed, map[string]any{"method": "change_password"})
+		apierror.Write(w, apierror.New(http.StatusForbidden, "current_password_incorrect"))
+		return
+	}
+	hash, err := a.HashPassword(body.NewPassword)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "hash_error"))
+		return
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var kept *session
+	if tok := strings.TrimSpace(body.RefreshToken); tok != "" {
+		if claims, err := a.ParseRefresh(app.JWT, tok); err == nil {
+			var s session
+			err := tx.QueryRow(ctx, `
+				SELECT session_id::text, COALESCE(started_at, created_at) FROM refresh_tokens
+				WHERE jti::text = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > now()
+			`, claims.ID, uid).Scan(&s.ID, &s.StartedAt)
+			if err == nil {
+				kept = &s
+			}
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET password_hash = $2 WHERE id = $1`, uid, hash)
+	if err == nil {
+		// a reset link sent before the change shouldn't undo it
+		_, err = tx.Exec(ctx, `UPDATE password_reset_tokens SET used_at = now() WHERE user_id = $1 AND used_at IS NULL`, uid)
+	}
+	var sessions int64
+	if err == nil {
+		sessions, err = revokeAllSessions(ctx, tx, uid)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("change password failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	// before issuing, so the new access token carries the bumped version
+	app.invalidateUser(ctx, uid)
+	if kept != nil {
+		sessions-- // the caller's own, which carries on
+	}
+	app.recordSecurityEvent(r, uid, secPasswordChanged, map[string]any{"sessions": sessions})
+
+	tokens, err := app.issueSessionTokens(r, uid, role, kept)
+	if err != nil {
+		// the password has changed; the caller signs in again with it
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("issueTokens failed (change password)")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_issue_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"tokens": tokens, "sessionsRevoked": sessions}})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// Password reset. A forgotten password is replaced through a single-use
+// link emailed to the account's address; only a hash of the link's token
+// is stored. Requests get the same answer whether or not the address has an
+// account, and are limited per caller and per address, so the endpoint
+// can't be used to find out who has signed up or to flood an inbox.
+
+const (
+	passwordResetTTL  = 30 * time.Minute
+	passwordResetLink = "https://okies.app/reset-password?token="
+)
+
+// allowPerEmail applies the rate limit setting to email rather than to the
+// caller. Like RateLimit it lets everything through without Redis, and on
+// a Redis error unless the rule fails closed.
+func (app *App) allowPerEmail(ctx context.Context, setting, email string) bool {
+	if app.Redis == nil {
+		return true
+	}
+	rule := app.Settings.RateLimit(ctx, setting)
+	sum := sha256.Sum256([]byte(email))
+	res, err := app.Limiter.Allow(ctx, setting+":email:"+hex.EncodeToString(sum[:8]), rule.LimitFor("anonymous"), rule.WindowDuration())
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("rule", setting).Bool("fail_closed", rule.FailClosed).Msg("rate limit check failed")
+		return !rule.FailClosed
+	}
+	return res.Allowed
+}
+
+// POST /v1/auth/forgot-password  {"email":"..."}
+// Always 202; the link goes out only if the address has an active account.
+func (app *App) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email" validate:"required,email,max=254"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if app.Mailer == nil {
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "email_unavailable"))
+		return
+	}
+	ctx := r.Context()
+	email := strings.ToLower(strings.TrimSpace(body.Email))
+	accepted := func() { writeJSON(w, http.StatusAccepted, map[string]any{"data": map[string]any{"sent": true}}) }
+
+	if !app.allowPerEmail(ctx, settings.RateLimitPasswordResetEmail, email) {
+		accepted()
+		return
+	}
+	var uid string
+	err := app.DB.QueryRow(ctx, `
+		SELECT id FROM users WHERE email=$1 AND deactivated_at IS NULL AND anonymized_at IS NULL
+	`, email).Scan(&uid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		accepted()
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_issue_error"))
+		return
+	}
+	if _, err := app.DB.Exec(ctx, `
+		INSERT INTO password_reset_tokens (user_id, token_hash, ip, expires_at)
+		VALUES ($1, $2, NULLIF($3,''), $4)
+	`, uid, hashOpaqueToken(token), clientIP(r), time.Now().Add(passwordResetTTL)); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("store password reset token failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.sendEmail(ctx, uid, "password_reset", map[string]any{
+		"link":           passwordResetLink + token,
+		"expiresMinutes": int(passwordResetTTL.Minutes()),
+	})
+	app.recordSecurityEvent(r, uid, secResetRequested, nil)
+	accepted()
+}
+
+// POST /v1/auth/reset-password  {"token":"...","password":"..."}
+// Sets the new password, uses up every outstanding link and signs the
+// account out everywhere.
+func (app *App) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token    string `json:"token" validate:"required,max=128"`
+		Password string `json:"password" validate:"required,min=8,max=128"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	hash, err := a.HashPassword(body.Password)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "hash_error"))
+		return
+	}
+	ctx := r.Context()
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var uid string
+	err = tx.QueryRow(ctx, `
+		UPDATE password_reset_tokens SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id
+	`, hashOpaqueToken(strings.TrimSpace(body.Token))).Scan(&uid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "reset_token_invalid"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET password_hash = $2
+		WHERE id = $1 AND deactivated_at IS NULL AND anonymized_at IS NULL
+	`, uid, hash)
+	if err == nil && tag.RowsAffected() == 0 {
+		// deactivated or erased since the link was sent
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "reset_token_invalid"))
+		return
+	}
+	if err == nil {
+		_, err = tx.Exec(ctx, `UPDATE password_reset_tokens SET used_at = now() WHERE user_id = $1 AND used_at IS NULL`, uid)
+	}
+	var sessions int64
+	if err == nil {
+		sessions, err = revokeAllSessions(ctx, tx, uid)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("reset password failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	app.invalidateUser(ctx, uid)
+	app.recordSecurityEvent(r, uid, secPasswordReset, map[string]any{"sessions": sessions})
+	w.WriteHeader(http.StatusNoContent)
+}
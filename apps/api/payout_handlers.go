@@ -2,9 +2,10 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -13,29 +14,39 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/breaker"
+	"github.com/sudo-init-do/okies-backend/pkg/cache"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
 )
 
 // ---------- Types ----------
 
 type createDestReq struct {
-	BankCode      string `json:"bankCode"`
-	AccountNumber string `json:"accountNumber"`
-	AccountName   string `json:"accountName"`
-	IsDefault     *bool  `json:"isDefault,omitempty"`
+	BankCode      string  `json:"bankCode" validate:"required,bankcode"`
+	AccountNumber string  `json:"accountNumber" validate:"required,nuban"`
+	AccountName   string  `json:"accountName" validate:"required,max=100"`
+	BVN           *string `json:"bvn,omitempty" validate:"omitempty,bvn"`
+	IsDefault     *bool   `json:"isDefault,omitempty"`
 }
 
 type destDTO struct {
 	ID            string    `json:"id"`
 	BankCode      string    `json:"bankCode"`
-	AccountNumber string    `json:"accountNumber"`
+	AccountNumber string    `json:"accountNumber"` // masked, e.g. ****1234
 	AccountName   string    `json:"accountName"`
 	IsDefault     bool      `json:"isDefault"`
 	CreatedAt     time.Time `json:"createdAt"`
 }
 
 type createWithdrawalReq struct {
-	DestinationID string `json:"destinationId"`
-	Amount        int64  `json:"amount"`
+	DestinationID string `json:"destinationId" validate:"required,uuid"`
+	Amount        int64  `json:"amount" validate:"kobo"`
+	// StepUpToken is needed for large withdrawals; see stepup.go.
+	StepUpToken string `json:"stepUpToken,omitempty"`
 }
 
 type withdrawalDTO struct {
@@ -47,23 +58,27 @@ type withdrawalDTO struct {
 	CreatedAt   time.Time `json:"createdAt"`
 }
 
-// ---------- Helpers ----------
+// ---------- Banks ----------
 
-func (app *App) walletIDForUser(ctx context.Context, userID string) (string, error) {
-	var wid string
-	err := app.DB.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id=$1`, userID).Scan(&wid)
-	return wid, err
-}
+// banksCacheTTL bounds how stale the bank list can be; banks join and leave
+// the transfer network rarely.
+const banksCacheTTL = 24 * time.Hour
 
-func (app *App) systemUserAndWallet(ctx context.Context) (string, string, error) {
-	var sysID, wid string
-	if err := app.DB.QueryRow(ctx, `SELECT id FROM users WHERE email='system@okies.local'`).Scan(&sysID); err != nil {
-		return "", "", err
-	}
-	if err := app.DB.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id=$1`, sysID).Scan(&wid); err != nil {
-		return "", "", err
+// GET /v1/banks
+// The banks payout destinations can use, by name. Public and the same for
+// everyone, so clients and CDNs may cache it; see Cacheable.
+func (app *App) ListBanks(w http.ResponseWriter, r *http.Request) {
+	banks, err := cache.Fetch(r.Context(), app.Cache, "banks:NG", banksCacheTTL, func(ctx context.Context) ([]bank, error) {
+		banks, err := app.Flutterwave.Banks(ctx, "NG")
+		sort.Slice(banks, func(i, j int) bool { return banks[i].Name < banks[j].Name })
+		return banks, err
+	})
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("listing banks failed")
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "banks_unavailable"))
+		return
 	}
-	return sysID, wid, nil
+	writeJSON(w, http.StatusOK, map[string]any{"data": banks})
 }
 
 // ---------- Payout Destinations ----------
@@ -71,16 +86,12 @@ func (app *App) systemUserAndWallet(ctx context.Context) (string, string, error)
 func (app *App) CreatePayoutDestination(w http.ResponseWriter, r *http.Request) {
 	uid, ok := getUserID(r)
 	if !ok {
-		httpError(w, http.StatusUnauthorized, "not_authenticated")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
 		return
 	}
 
 	var body createDestReq
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil ||
-		strings.TrimSpace(body.BankCode) == "" ||
-		strings.TrimSpace(body.AccountNumber) == "" ||
-		strings.TrimSpace(body.AccountName) == "" {
-		httpError(w, http.StatusBadRequest, "invalid_request")
+	if !decodeBody(w, r, &body) {
 		return
 	}
 
@@ -90,38 +101,60 @@ func (app *App) CreatePayoutDestination(w http.ResponseWriter, r *http.Request)
 	}
 
 	ctx := r.Context()
+	hit, listed, err := app.matchBlacklist(ctx, body.BankCode, body.AccountNumber, body.BVN)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if listed && hit.Action == "block" {
+		log.Ctx(r.Context()).Warn().Str("user_id", uid).Str("blacklist_id", hit.ID).Msg("blacklisted payout destination refused")
+		apierror.Write(w, apierror.New(http.StatusForbidden, "destination_blocked"))
+		return
+	}
+
+	sealed, err := app.sealDestination(ctx, body.AccountNumber, body.BVN)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("sealing payout destination failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "encryption_error"))
+		return
+	}
+
 	tx, err := app.DB.Begin(ctx)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "tx_begin_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
 		return
 	}
 	defer tx.Rollback(ctx)
 
 	if isDefault {
-		_, _ = tx.Exec(ctx, `UPDATE payout_destinations SET is_default=false WHERE user_id=$1`, uid)
+		_, _ = tx.Exec(ctx, `UPDATE payout_destinations SET is_default=false WHERE user_id=$1 AND deleted_at IS NULL`, uid)
 	}
 
 	var id string
 	if err := tx.QueryRow(ctx, `
-		INSERT INTO payout_destinations (user_id, bank_code, account_number, account_name, is_default)
-		VALUES ($1,$2,$3,$4,$5)
+		INSERT INTO payout_destinations
+		  (user_id, bank_code, account_number, account_number_hash, account_last4, account_name, is_default, bvn, bvn_hash)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
 		RETURNING id
-	`, uid, body.BankCode, body.AccountNumber, body.AccountName, isDefault).Scan(&id); err != nil {
-		log.Error().Err(err).
+	`, uid, body.BankCode, sealed.AccountNumber, sealed.AccountHash, sealed.AccountLast4, body.AccountName, isDefault, sealed.BVN, sealed.BVNHash).Scan(&id); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).
 			Str("user_id", uid).
 			Str("bank_code", body.BankCode).
-			Str("account_number", body.AccountNumber).
+			Str("account_last4", sealed.AccountLast4).
 			Str("account_name", body.AccountName).
 			Bool("is_default", isDefault).
 			Msg("failed to insert payout destination")
-		httpError(w, http.StatusInternalServerError, "insert_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_error"))
 		return
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		httpError(w, http.StatusInternalServerError, "tx_commit_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
 		return
 	}
+	if listed {
+		app.flagBlacklistMatch(ctx, uid, "withdrawal", "payout_destination", id, hit)
+	}
 
 	writeJSON(w, http.StatusCreated, map[string]any{"data": map[string]any{"id": id}})
 }
@@ -129,18 +162,18 @@ func (app *App) CreatePayoutDestination(w http.ResponseWriter, r *http.Request)
 func (app *App) ListPayoutDestinations(w http.ResponseWriter, r *http.Request) {
 	uid, ok := getUserID(r)
 	if !ok {
-		httpError(w, http.StatusUnauthorized, "not_authenticated")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
 		return
 	}
 
 	rows, err := app.DB.Query(r.Context(), `
-		SELECT id, bank_code, account_number, account_name, is_default, created_at
+		SELECT id, bank_code, account_last4, account_name, is_default, created_at
 		FROM payout_destinations
-		WHERE user_id=$1
+		WHERE user_id=$1 AND deleted_at IS NULL
 		ORDER BY created_at DESC
 	`, uid)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "db_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
 	defer rows.Close()
@@ -149,9 +182,10 @@ func (app *App) ListPayoutDestinations(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var d destDTO
 		if err := rows.Scan(&d.ID, &d.BankCode, &d.AccountNumber, &d.AccountName, &d.IsDefault, &d.CreatedAt); err != nil {
-			httpError(w, http.StatusInternalServerError, "scan_error")
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
 			return
 		}
+		d.AccountNumber = maskAccount(d.AccountNumber)
 		list = append(list, d)
 	}
 
@@ -161,61 +195,137 @@ func (app *App) ListPayoutDestinations(w http.ResponseWriter, r *http.Request) {
 func (app *App) DeletePayoutDestination(w http.ResponseWriter, r *http.Request) {
 	uid, ok := getUserID(r)
 	if !ok {
-		httpError(w, http.StatusUnauthorized, "not_authenticated")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
 		return
 	}
 	id := strings.TrimSpace(chi.URLParam(r, "id"))
 	if id == "" {
-		httpError(w, http.StatusBadRequest, "missing_id")
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "missing_id"))
 		return
 	}
 
+	// soft delete: withdrawals made to it still show where the money went
 	res, err := app.DB.Exec(r.Context(), `
-		DELETE FROM payout_destinations
-		WHERE id=$1 AND user_id=$2
+		UPDATE payout_destinations SET deleted_at=now(), is_default=false
+		WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL
 	`, id, uid)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "db_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
 	if res.RowsAffected() == 0 {
-		httpError(w, http.StatusNotFound, "not_found")
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"deleted": true}})
 }
 
+// POST /v1/payout-destinations/{id}/restore — undo a delete, unless the same
+// account has been added again since
+func (app *App) RestorePayoutDestination(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	ctx := r.Context()
+	var d destDTO
+	err := app.DB.QueryRow(ctx, `
+		UPDATE payout_destinations d SET deleted_at=NULL
+		WHERE d.id=$1 AND d.user_id=$2 AND d.deleted_at IS NOT NULL
+		  AND NOT EXISTS (
+		    SELECT 1 FROM payout_destinations o
+		    WHERE o.user_id=d.user_id AND o.bank_code=d.bank_code AND o.account_number_hash=d.account_number_hash
+		      AND o.deleted_at IS NULL
+		  )
+		RETURNING id, bank_code, account_last4, account_name, is_default, created_at
+	`, id, uid).Scan(&d.ID, &d.BankCode, &d.AccountNumber, &d.AccountName, &d.IsDefault, &d.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var deleted bool
+		_ = app.DB.QueryRow(ctx, `
+			SELECT deleted_at IS NOT NULL FROM payout_destinations WHERE id=$1 AND user_id=$2
+		`, id, uid).Scan(&deleted)
+		if deleted {
+			apierror.Write(w, apierror.New(http.StatusConflict, "destination_exists"))
+			return
+		}
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	d.AccountNumber = maskAccount(d.AccountNumber)
+	writeJSON(w, http.StatusOK, map[string]any{"data": d})
+}
+
 // ---------- Withdrawals (User) ----------
 
 func (app *App) CreateWithdrawal(w http.ResponseWriter, r *http.Request) {
 	uid, ok := getUserID(r)
 	if !ok {
-		httpError(w, http.StatusUnauthorized, "not_authenticated")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
 		return
 	}
 
 	var body createWithdrawalReq
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Amount <= 0 || strings.TrimSpace(body.DestinationID) == "" {
-		httpError(w, http.StatusBadRequest, "invalid_request")
+	if !decodeBody(w, r, &body) {
 		return
 	}
 
 	ctx := r.Context()
 
-	var destUser string
-	if err := app.DB.QueryRow(ctx, `SELECT user_id FROM payout_destinations WHERE id=$1`, body.DestinationID).Scan(&destUser); err != nil || destUser != uid {
-		httpError(w, http.StatusBadRequest, "invalid_destination")
+	if accountStatusError(w, app.checkCanMoveMoney(ctx, uid)) {
+		return
+	}
+
+	var destUser, bankCode, accountNumber string
+	var bvn *string
+	if err := app.DB.QueryRow(ctx, `
+		SELECT user_id, bank_code, account_number, bvn FROM payout_destinations WHERE id=$1 AND deleted_at IS NULL
+	`, body.DestinationID).Scan(&destUser, &bankCode, &accountNumber, &bvn); err != nil || destUser != uid {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_destination"))
+		return
+	}
+	accountNumber, bvn, err := app.openDestination(ctx, accountNumber, bvn)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("destination_id", body.DestinationID).Msg("opening payout destination failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "encryption_error"))
+		return
+	}
+	// Entries may be added after the destination was saved
+	hit, listed, err := app.matchBlacklist(ctx, bankCode, accountNumber, bvn)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if listed && hit.Action == "block" {
+		log.Ctx(r.Context()).Warn().Str("user_id", uid).Str("blacklist_id", hit.ID).Msg("withdrawal to blacklisted destination refused")
+		apierror.Write(w, apierror.New(http.StatusForbidden, "destination_blocked"))
+		return
+	}
+
+	stepUp, err := app.withdrawalNeedsStepUp(ctx, uid, body.DestinationID, body.Amount)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if stepUp && strings.TrimSpace(body.StepUpToken) == "" {
+		apierror.Write(w, apierror.New(http.StatusForbidden, "step_up_required"))
 		return
 	}
 
 	userWid, err := app.walletIDForUser(ctx, uid)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "wallet_not_found")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "wallet_not_found"))
 		return
 	}
 	_, systemWid, err := app.systemUserAndWallet(ctx)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "system_wallet_missing")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "system_wallet_missing"))
 		return
 	}
 
@@ -227,65 +337,75 @@ func (app *App) CreateWithdrawal(w http.ResponseWriter, r *http.Request) {
 
 	tx, err := app.DB.Begin(ctx)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "tx_begin_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
 		return
 	}
 	defer tx.Rollback(ctx)
 
-	wids := []string{systemWid, userWid}
-	sort.Strings(wids)
-	if _, err := tx.Exec(ctx, `SELECT id FROM wallets WHERE id = ANY($1) FOR UPDATE`, wids); err != nil {
-		httpError(w, http.StatusInternalServerError, "lock_wallets_error")
-		return
-	}
-
-	var existing string
-	err = tx.QueryRow(ctx, `SELECT id FROM transactions WHERE idempotency_key=$1`, idem).Scan(&existing)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		httpError(w, http.StatusInternalServerError, "db_error")
+	c, err := app.checkMove(ctx, tx, moveReq{
+		UserID:        uid,
+		Idem:          idem,
+		Lock:          []string{systemWid, userWid},
+		Debit:         userWid,
+		DestinationID: body.DestinationID,
+		Amount:        body.Amount,
+	})
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
-	if existing != "" {
+	if c.ExistingID != "" {
 		var payoutID string
 		_ = tx.QueryRow(ctx, `SELECT id FROM payouts WHERE reference=$1`, idem).Scan(&payoutID)
 		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"payoutId": payoutID, "status": "pending"}})
 		return
 	}
-
-	var txID string
-	if err := tx.QueryRow(ctx, `
-		INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
-		VALUES ($1,'withdrawal_reserve',$2,'NGN','{}'::jsonb)
-		RETURNING id
-	`, idem, body.Amount).Scan(&txID); err != nil {
-		httpError(w, http.StatusInternalServerError, "insert_tx_error")
+	if c.LimitErr != nil {
+		apierror.Write(w, c.LimitErr)
 		return
 	}
-	if _, err := tx.Exec(ctx, `
-		INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
-		VALUES
-		  ($1,$2,'debit',$3),
-		  ($1,$4,'credit',$3)
-	`, txID, userWid, body.Amount, systemWid); err != nil {
-		httpError(w, http.StatusInternalServerError, "insert_ledger_error")
+	if c.Balance < body.Amount {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "insufficient_funds"))
 		return
 	}
+	if stepUp {
+		ok, err := spendStepUpToken(ctx, tx, uid, body.StepUpToken)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		if !ok {
+			apierror.Write(w, apierror.New(http.StatusForbidden, "step_up_required"))
+			return
+		}
+	}
 
-	var payoutID string
-	if err := tx.QueryRow(ctx, `
+	var txID, payoutID string
+	b := &pgx.Batch{}
+	queuePosting(b, posting{Idem: idem, Kind: "withdrawal_reserve", Amount: body.Amount, Debit: userWid, Credit: systemWid}, &txID)
+	b.Queue(`
 		INSERT INTO payouts (user_id, destination_id, amount, status, reference)
 		VALUES ($1,$2,$3,'pending',$4)
 		RETURNING id
-	`, uid, body.DestinationID, body.Amount, idem).Scan(&payoutID); err != nil {
-		httpError(w, http.StatusInternalServerError, "insert_payout_error")
+	`, uid, body.DestinationID, body.Amount, idem).QueryRow(func(row pgx.Row) error { return row.Scan(&payoutID) })
+	if err := tx.SendBatch(ctx, b).Close(); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("post withdrawal failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_tx_error"))
 		return
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		httpError(w, http.StatusInternalServerError, "tx_commit_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
 		return
 	}
 
+	ev := fraudEventFromRequest(r, "withdrawal", uid, body.Amount, "payout", payoutID)
+	ev.DestinationID = body.DestinationID
+	app.screenFraud(ctx, ev)
+	if listed {
+		app.flagBlacklistMatch(ctx, uid, "withdrawal", "payout", payoutID, hit)
+	}
+
 	writeJSON(w, http.StatusCreated, map[string]any{
 		"data": map[string]any{
 			"payoutId":  payoutID,
@@ -295,22 +415,30 @@ func (app *App) CreateWithdrawal(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GET /v1/wallet/withdrawals?limit=&cursor=
 func (app *App) ListMyWithdrawals(w http.ResponseWriter, r *http.Request) {
 	uid, ok := getUserID(r)
 	if !ok {
-		httpError(w, http.StatusUnauthorized, "not_authenticated")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+
+	pg, ok := app.parsePage(w, r, "wallet.withdrawals", pagination.Standard)
+	if !ok {
 		return
 	}
+	afterAt, afterID := pg.AfterArgs()
 
 	rows, err := app.DB.Query(r.Context(), `
 		SELECT id, destination_id, amount, status, reference, created_at
 		FROM payouts
 		WHERE user_id=$1
-		ORDER BY created_at DESC
-		LIMIT 100
-	`, uid)
+		  AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3::uuid))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, uid, afterAt, afterID, pg.Limit+1)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "db_error")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
 	defer rows.Close()
@@ -319,49 +447,147 @@ func (app *App) ListMyWithdrawals(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var d withdrawalDTO
 		if err := rows.Scan(&d.ID, &d.Destination, &d.Amount, &d.Status, &d.Reference, &d.CreatedAt); err != nil {
-			httpError(w, http.StatusInternalServerError, "scan_error")
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
 			return
 		}
 		out = append(out, d)
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+	out, paging := pagination.Trim(pg, out, func(d withdrawalDTO) pagination.Key { return pagination.Key{Time: d.CreatedAt, ID: d.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
 }
 
 // ---------- Withdrawals (Admin) ----------
 
+// AdminApproveWithdrawal records the caller's sign-off. Payouts above
+// payouts.dual_control_threshold_kobo stay pending until a second, distinct
+// admin approves; only then does the payout move to approved.
 func (app *App) AdminApproveWithdrawal(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimSpace(chi.URLParam(r, "id"))
 	if id == "" {
-		httpError(w, http.StatusBadRequest, "missing_id")
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "missing_id"))
 		return
 	}
+	actor, _ := getUserID(r)
+	actorRole, _ := getUserRole(r)
 
 	ctx := r.Context()
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	var (
-		userID, destID, status, reference string
-		amount                            int64
+		userID, status, reference string
+		amount                    int64
 	)
-	if err := app.DB.QueryRow(ctx, `
-		SELECT user_id, destination_id, amount, status, reference
+	if err := tx.QueryRow(ctx, `
+		SELECT user_id, amount, status, reference
 		FROM payouts
 		WHERE id = $1
-	`, id).Scan(&userID, &destID, &amount, &status, &reference); err != nil {
-		httpError(w, http.StatusNotFound, "payout_not_found")
+		FOR UPDATE
+	`, id).Scan(&userID, &amount, &status, &reference); err != nil {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "payout_not_found"))
+		return
+	}
+
+	switch status {
+	case "succeeded", "approved":
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"status": status, "payoutId": id, "reference": reference}})
+		return
+	case "pending", "processing":
+	default:
+		apierror.Write(w, apierror.New(http.StatusConflict, "payout_not_pending"))
+		return
+	}
+	if actor == userID {
+		apierror.Write(w, apierror.New(http.StatusForbidden, "cannot_approve_own_payout"))
+		return
+	}
+	if open, err := app.hasOpenFraudCase(ctx, "payout", id); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	} else if open {
+		apierror.Write(w, apierror.New(http.StatusConflict, "open_fraud_case"))
 		return
 	}
 
-	if status == "succeeded" {
-		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"status": "succeeded"}})
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO payout_approvals (payout_id, approver_id, approver_role)
+		VALUES ($1,$2,$3)
+		ON CONFLICT DO NOTHING
+	`, id, actor, actorRole)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		apierror.Write(w, apierror.New(http.StatusConflict, "already_approved_by_you"))
 		return
 	}
 
-	_, _ = app.DB.Exec(ctx, `UPDATE payouts SET status='approved', updated_at=now() WHERE id=$1`, id)
+	var approvers []string
+	if err := tx.QueryRow(ctx, `
+		SELECT array_agg(approver_id::text ORDER BY created_at) FROM payout_approvals WHERE payout_id=$1
+	`, id).Scan(&approvers); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	required := 1
+	if limit := app.Settings.Int64(ctx, settings.PayoutDualControlKobo); limit > 0 && amount > limit {
+		required = 2
+	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	newStatus := status
+	if len(approvers) >= required {
+		newStatus = "approved"
+		if _, err := tx.Exec(ctx, `UPDATE payouts SET status='approved', updated_at=now() WHERE id=$1`, id); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		// submitted to the provider by the worker once this commits
+		if err := jobs.Enqueue(ctx, tx, jobPayoutSubmit, map[string]any{"payoutId": id},
+			jobs.Options{UniqueKey: jobPayoutSubmit + ":" + id}); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+
+	action := "withdrawal.approve"
+	if newStatus != "approved" {
+		action = "withdrawal.approval_recorded"
+	}
+	app.audit(r, auditEntry{
+		Action:     action,
+		TargetType: "payout",
+		TargetID:   id,
+		Before:     map[string]any{"status": status},
+		After: map[string]any{"status": newStatus, "userId": userID, "amount": amount, "reference": reference,
+			"approvers": approvers, "requiredApprovals": required},
+	})
+	if newStatus == "approved" {
+		app.Events.Publish(ctx, evWithdrawalApproved, withdrawalApproved{
+			PayoutID: id, UserID: userID, Amount: amount, Reference: reference, Approvers: approvers,
+		})
+	}
+
+	code := http.StatusOK
+	if newStatus != "approved" {
+		newStatus = "awaiting_second_approval"
+		code = http.StatusAccepted
+	}
+	writeJSON(w, code, map[string]any{
 		"data": map[string]any{
-			"status":    "approved",
-			"payoutId":  id,
-			"reference": reference,
+			"status":            newStatus,
+			"payoutId":          id,
+			"reference":         reference,
+			"approvers":         approvers,
+			"requiredApprovals": required,
 		},
 	})
 }
@@ -369,67 +595,124 @@ func (app *App) AdminApproveWithdrawal(w http.ResponseWriter, r *http.Request) {
 func (app *App) AdminRejectWithdrawal(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimSpace(chi.URLParam(r, "id"))
 	if id == "" {
-		httpError(w, http.StatusBadRequest, "missing_id")
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "missing_id"))
 		return
 	}
 
-	ctx := r.Context()
-	var (
-		userID, status, reference string
-		amount                    int64
-	)
-	if err := app.DB.QueryRow(ctx, `
+	p, err := app.rejectPayout(r.Context(), id)
+	switch {
+	case errors.Is(err, errPayoutNotFound):
+		apierror.Write(w, apierror.New(http.StatusNotFound, "payout_not_found"))
+		return
+	case errors.Is(err, errPayoutSucceeded):
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "cannot_reject_succeeded"))
+		return
+	case errors.Is(err, errPayoutSubmitted):
+		apierror.Write(w, apierror.New(http.StatusConflict, "cannot_reject_submitted"))
+		return
+	case err != nil:
+		log.Ctx(r.Context()).Error().Err(err).Str("payout_id", id).Msg("reject payout failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "reject_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "withdrawal.reject",
+		TargetType: "payout",
+		TargetID:   id,
+		Before:     map[string]any{"status": p.Status},
+		After:      map[string]any{"status": "rejected", "userId": p.UserID, "amount": p.Amount, "refunded": true},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": map[string]any{
+			"status":    "rejected",
+			"payoutId":  id,
+			"reference": p.Reference,
+			"refunded":  true,
+		},
+	})
+}
+
+var (
+	errPayoutNotFound  = errors.New("payout not found")
+	errPayoutSucceeded = errors.New("payout already succeeded")
+	errPayoutSubmitted = errors.New("payout already submitted")
+)
+
+// payoutRecord is the payout state read before a transition (Status is the prior status).
+type payoutRecord struct {
+	ID, UserID, Status, Reference string
+	Amount                        int64
+}
+
+// rejectPayout marks a payout rejected and refunds the reserved amount from the
+// system wallet back to the user. Only a payout the provider hasn't been sent
+// can be rejected: once submitPayoutJob claims it, the transfer may go through.
+// Rejecting a rejected payout again changes nothing.
+func (app *App) rejectPayout(ctx context.Context, id string) (payoutRecord, error) {
+	return app.refundPayout(ctx, id, "rejected", "pending", "approved")
+}
+
+// refundPayout moves a payout from one of the statuses in from to status
+// (rejected or failed) and refunds it. Both statuses share one refund key, so
+// a payout is refunded at most once whichever way it ends.
+func (app *App) refundPayout(ctx context.Context, id, status string, from ...string) (payoutRecord, error) {
+	p := payoutRecord{ID: id}
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return p, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
 		SELECT user_id, status, reference, amount
 		FROM payouts
 		WHERE id=$1
-	`, id).Scan(&userID, &status, &reference, &amount); err != nil {
-		httpError(w, http.StatusNotFound, "payout_not_found")
-		return
+		FOR UPDATE
+	`, id).Scan(&p.UserID, &p.Status, &p.Reference, &p.Amount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, errPayoutNotFound
 	}
-	if status == "succeeded" {
-		httpError(w, http.StatusBadRequest, "cannot_reject_succeeded")
-		return
+	if err != nil {
+		return p, err
+	}
+	switch {
+	case p.Status == status:
+		return p, nil
+	case p.Status == "succeeded":
+		return p, errPayoutSucceeded
+	case !slices.Contains(from, p.Status):
+		return p, errPayoutSubmitted
 	}
 
-	userWid, err := app.walletIDForUser(ctx, userID)
+	userWid, err := app.walletIDForUser(ctx, p.UserID)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "wallet_not_found")
-		return
+		return p, err
 	}
 	_, systemWid, err := app.systemUserAndWallet(ctx)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "system_wallet_missing")
-		return
+		return p, err
 	}
 
-	refundIdem := reference + ":rejected_refund"
+	refundIdem := p.Reference + ":rejected_refund"
 
-	tx, err := app.DB.Begin(ctx)
-	if err != nil {
-		httpError(w, http.StatusInternalServerError, "tx_begin_error")
-		return
+	if err := app.lockWallets(ctx, tx, systemWid, userWid); err != nil {
+		return p, err
 	}
-	defer tx.Rollback(ctx)
 
-	if _, err := tx.Exec(ctx, `SELECT id FROM payouts WHERE id=$1 FOR UPDATE`, id); err != nil {
-		httpError(w, http.StatusInternalServerError, "lock_payout_error")
-		return
+	tag, err := tx.Exec(ctx, `UPDATE payouts SET status=$2, updated_at=now() WHERE id=$1 AND status=$3`, id, status, p.Status)
+	if err != nil {
+		return p, err
 	}
-
-	wids := []string{systemWid, userWid}
-	sort.Strings(wids)
-	if _, err := tx.Exec(ctx, `SELECT id FROM wallets WHERE id = ANY($1) FOR UPDATE`, wids); err != nil {
-		httpError(w, http.StatusInternalServerError, "lock_wallets_error")
-		return
+	if tag.RowsAffected() != 1 {
+		return p, fmt.Errorf("payout %s changed status under lock", id)
 	}
 
-	_, _ = tx.Exec(ctx, `UPDATE payouts SET status='rejected', updated_at=now() WHERE id=$1`, id)
-
 	var exists string
 	err = tx.QueryRow(ctx, `SELECT id FROM transactions WHERE idempotency_key=$1`, refundIdem).Scan(&exists)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		httpError(w, http.StatusInternalServerError, "db_error")
-		return
+		return p, err
 	}
 	if exists == "" {
 		var txID string
@@ -437,32 +720,79 @@ func (app *App) AdminRejectWithdrawal(w http.ResponseWriter, r *http.Request) {
 			INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
 			VALUES ($1,'withdrawal_refund',$2,'NGN','{}'::jsonb)
 			RETURNING id
-		`, refundIdem, amount).Scan(&txID); err != nil {
-			httpError(w, http.StatusInternalServerError, "insert_tx_error")
-			return
+		`, refundIdem, p.Amount).Scan(&txID); err != nil {
+			return p, err
 		}
 		if _, err := tx.Exec(ctx, `
 			INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
 			VALUES
 				($1,$2,'credit',$3),
 				($1,$4,'debit',$3)
-		`, txID, userWid, amount, systemWid); err != nil {
-			httpError(w, http.StatusInternalServerError, "insert_ledger_error")
-			return
+		`, txID, userWid, p.Amount, systemWid); err != nil {
+			return p, err
 		}
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		httpError(w, http.StatusInternalServerError, "tx_commit_error")
-		return
+	return p, tx.Commit(ctx)
+}
+
+// submitPayoutJob claims an approved payout, marking it processing, then
+// sends it to Flutterwave; the transfer webhook settles it. Claiming first
+// means a payout can't be rejected and refunded while its transfer is on the
+// way. The payout reference is the provider's idempotency key, so a retry
+// after a lost response resends the claimed payout safely.
+func (app *App) submitPayoutJob(ctx context.Context, job *jobs.Job) error {
+	var p struct {
+		PayoutID string `json:"payoutId"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	var reference, currency, bankCode, accountNumber string
+	var amount int64
+	err := app.DB.QueryRow(ctx, `
+		UPDATE payouts p SET status='processing', updated_at=now()
+		FROM payout_destinations d
+		WHERE p.id=$1 AND d.id = p.destination_id AND p.status IN ('approved','processing')
+		RETURNING p.reference, p.currency, p.amount, d.bank_code, d.account_number
+	`, p.PayoutID).Scan(&reference, &currency, &amount, &bankCode, &accountNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// rejected since approval, settled, or gone
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if accountNumber, err = app.Sealer.Open(ctx, accountNumber); err != nil {
+		return err
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"data": map[string]any{
-			"status":    "rejected",
-			"payoutId":  id,
-			"reference": reference,
-			"refunded":  true,
-		},
-	})
+	err = app.Flutterwave.CreateTransfer(ctx, bankCode, accountNumber, amount, currency, "Okies withdrawal", reference, "")
+	var rejected errTransferRejected
+	if errors.As(err, &rejected) {
+		// the provider will never accept it; give the user their money back
+		rec, rerr := app.refundPayout(ctx, p.PayoutID, "failed", "processing")
+		if rerr != nil {
+			return rerr
+		}
+		log.Ctx(ctx).Warn().Err(err).Str("payout_id", p.PayoutID).Msg("payout rejected by provider; refunded")
+		app.Events.Publish(ctx, evWithdrawalSettled, withdrawalSettled{
+			PayoutID: p.PayoutID, UserID: rec.UserID, Amount: amount, Reference: reference, Status: "failed", Refunded: true,
+		})
+		return nil
+	}
+	var open *breaker.OpenError
+	if errors.As(err, &open) {
+		// provider is down: nothing was sent, so hand the payout back to
+		// approved (where it can still be rejected) and try again without
+		// spending an attempt
+		if _, uerr := app.DB.Exec(ctx, `
+			UPDATE payouts SET status='approved', updated_at=now() WHERE id=$1 AND status='processing'
+		`, p.PayoutID); uerr != nil {
+			return uerr
+		}
+		return jobs.RetryAfter(open.RetryAfter, err)
+	}
+	return err
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+)
+
+// Approved payouts reach Flutterwave only through the payout.submit job,
+// which approval enqueues in the same transaction (the jobs table is the
+// outbox; `api worker` is the relay). runPayoutRelayCheck is the backstop: it
+// enqueues any approved payout that somehow has no job, and alerts when
+// approved payouts sit unsubmitted, so none can silently miss its transfer.
+
+const payoutSubmitGrace = 15 * time.Minute
+
+func (app *App) runPayoutRelayCheck(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := app.checkPayoutRelay(ctx); err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("payout relay check failed")
+		}
+	}
+}
+
+func (app *App) checkPayoutRelay(ctx context.Context) error {
+	// approved before the queue existed, or the job row was lost
+	rows, err := app.DB.Query(ctx, `
+		SELECT p.id FROM payouts p
+		WHERE p.status='approved'
+		  AND NOT EXISTS (SELECT 1 FROM jobs j WHERE j.unique_key = $1 || p.id::text)
+	`, jobPayoutSubmit+":")
+	if err != nil {
+		return err
+	}
+	var orphans []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		orphans = append(orphans, id)
+	}
+	rows.Close()
+	for _, id := range orphans {
+		if err := jobs.Enqueue(ctx, app.DB, jobPayoutSubmit, map[string]any{"payoutId": id},
+			jobs.Options{UniqueKey: jobPayoutSubmit + ":" + id}); err != nil {
+			return err
+		}
+		log.Ctx(ctx).Warn().Str("payout_id", id).Msg("approved payout had no submit job; enqueued")
+	}
+
+	var stuck int64
+	var oldest *time.Time
+	if err := app.DB.QueryRow(ctx, `
+		SELECT COUNT(*), MIN(updated_at) FROM payouts
+		WHERE status='approved' AND updated_at < $1
+	`, time.Now().Add(-payoutSubmitGrace)).Scan(&stuck, &oldest); err != nil {
+		return err
+	}
+	gauges.Set("okies_payouts_unsubmitted", "Approved payouts not yet accepted by the provider after the grace period.", float64(stuck))
+	if stuck == 0 {
+		return nil
+	}
+	first := true
+	if app.Redis != nil {
+		first, _ = app.Redis.SetNX(ctx, "alert:payouts_unsubmitted", 1, time.Hour).Result()
+	}
+	if first {
+		app.raiseAlert(ctx, alert{
+			Name:     "payouts_unsubmitted",
+			Severity: "critical",
+			Message:  "approved payouts have not been submitted to the provider; is the worker running?",
+			Fields:   map[string]any{"count": stuck, "oldest_approved_at": oldest},
+		})
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
+)
+
+// otpAPIError maps issueOTP and checkOTP failures to API errors.
+func otpAPIError(err error) *apierror.Error {
+	switch {
+	case errors.Is(err, errOTPInvalid):
+		return apierror.New(http.StatusUnprocessableEntity, "invalid_otp")
+	case errors.Is(err, errOTPRateLimited):
+		return apierror.New(http.StatusTooManyRequests, "otp_rate_limited")
+	}
+	return apierror.New(http.StatusInternalServerError, "otp_error").Wrap(err)
+}
+
+// userIDByPhone finds the user whose verified number is phone.
+func (app *App) userIDByPhone(r *http.Request, phone string) (string, error) {
+	var id string
+	err := app.DB.QueryRow(r.Context(), `SELECT id FROM users WHERE phone=$1`, phone).Scan(&id)
+	return id, err
+}
+
+// PUT /v1/users/me/phone  {"phone":"0803 123 4567"}
+// Texts a code to the number; it replaces the current one only once
+// confirmed with .../phone/verify.
+func (app *App) SetMyPhone(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	if app.SMS == nil {
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "sms_unavailable"))
+		return
+	}
+	var body struct {
+		Phone string `json:"phone" validate:"required,phone"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	phone, _ := validate.Phone(body.Phone)
+
+	owner, err := app.userIDByPhone(r, phone)
+	switch {
+	case err == nil && owner == uid:
+		apierror.Write(w, apierror.New(http.StatusConflict, "phone_already_verified"))
+		return
+	case err == nil:
+		apierror.Write(w, apierror.New(http.StatusConflict, "phone_in_use"))
+		return
+	case !errors.Is(err, pgx.ErrNoRows):
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	id, expiresAt, err := app.issueOTP(r.Context(), uid, phone, otpPhoneVerify)
+	if err != nil {
+		e := otpAPIError(err)
+		if e.Status == http.StatusInternalServerError {
+			log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("issue phone otp failed")
+		}
+		apierror.Write(w, e)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"data": map[string]any{
+		"verificationId": id, "phone": phone, "expiresAt": expiresAt,
+	}})
+}
+
+// POST /v1/users/me/phone/verify  {"verificationId":"...","code":"123456"}
+func (app *App) VerifyMyPhone(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		VerificationID string `json:"verificationId" validate:"required"`
+		Code           string `json:"code" validate:"required,len=6,numeric"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	c, err := app.checkOTP(r.Context(), body.VerificationID, otpPhoneVerify, body.Code)
+	if err == nil && (c.UserID == nil || *c.UserID != uid) {
+		err = errOTPInvalid
+	}
+	if err != nil {
+		apierror.Write(w, otpAPIError(err))
+		return
+	}
+	if _, err := app.DB.Exec(r.Context(), `
+		UPDATE users SET phone=$2, phone_verified_at=now() WHERE id=$1
+	`, uid, c.Phone); err != nil {
+		var pgErr interface{ SQLState() string }
+		if errors.As(err, &pgErr) && pgErr.SQLState() == "23505" {
+			// verified by someone else since the code was sent
+			apierror.Write(w, apierror.New(http.StatusConflict, "phone_in_use"))
+			return
+		}
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("set phone failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(r.Context(), uid)
+	app.recordSecurityEvent(r, uid, secPhoneVerified, map[string]any{"phone": c.Phone})
+	writeJSON(w, http.StatusOK, map[string]any{"data": app.loadUser(r, uid)})
+}
+
+// DELETE /v1/users/me/phone
+func (app *App) DeleteMyPhone(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	tag, err := app.DB.Exec(r.Context(), `UPDATE users SET phone=NULL, phone_verified_at=NULL WHERE id=$1 AND phone IS NOT NULL`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(r.Context(), uid)
+	if tag.RowsAffected() > 0 {
+		app.recordSecurityEvent(r, uid, secPhoneRemoved, nil)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ---------- OTP login ----------
+
+// POST /v1/auth/otp/request  {"phone":"0803 123 4567"}
+// Texts a login code to an account's verified number. The response is the
+// same whether or not the number belongs to an account.
+func (app *App) RequestLoginOTP(w http.ResponseWriter, r *http.Request) {
+	if app.SMS == nil {
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "sms_unavailable"))
+		return
+	}
+	var body struct {
+		Phone string `json:"phone" validate:"required,phone"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	phone, _ := validate.Phone(body.Phone)
+
+	uid, err := app.userIDByPhone(r, phone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// a challenge that can never be confirmed
+		writeJSON(w, http.StatusAccepted, map[string]any{"data": map[string]any{"challengeId": uuid.NewString()}})
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	id, _, err := app.issueOTP(r.Context(), uid, phone, otpLogin)
+	if err != nil {
+		e := otpAPIError(err)
+		if e.Status == http.StatusInternalServerError {
+			log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("issue login otp failed")
+		}
+		apierror.Write(w, e)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"data": map[string]any{"challengeId": id}})
+}
+
+// POST /v1/auth/otp/verify  {"challengeId":"...","code":"123456"}
+// Logs in like /v1/auth/login.
+func (app *App) VerifyLoginOTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ChallengeID string `json:"challengeId" validate:"required"`
+		Code        string `json:"code" validate:"required,len=6,numeric"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	c, err := app.checkOTP(r.Context(), body.ChallengeID, otpLogin, body.Code)
+	if err != nil {
+		apierror.Write(w, otpAPIError(err))
+		return
+	}
+	// the number may have moved to another account since the code was sent
+	uid, err := app.userIDByPhone(r, c.Phone)
+	if err != nil || c.UserID == nil || uid != *c.UserID {
+		apierror.Write(w, otpAPIError(errOTPInvalid))
+		return
+	}
+	if accountStatusError(w, app.checkAccountActive(r.Context(), uid)) {
+		return
+	}
+	u, err := app.userByID(r.Context(), uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	tokens, err := app.issueTokens(r, uid, u.Role)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("issueTokens failed (otp login)")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_issue_error"))
+		return
+	}
+	app.recordSecurityEvent(r, uid, secLogin, map[string]any{"method": "otp"})
+	writeJSON(w, http.StatusOK, authResp{Tokens: tokens, User: app.loadUser(r, uid)})
+}
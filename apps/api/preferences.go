@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/i18n"
+)
+
+// Per-user display preferences, kept server-side so every client and every
+// text the server renders for the user (notifications, emails, statements)
+// agree. Language and time zone are the same columns as
+// /v1/users/me/language and /v1/users/me/timezone; the theme is only
+// stored for the apps.
+
+type preferencesDTO struct {
+	Language        *string `json:"language"`        // null: negotiated per request, English otherwise
+	TimeZone        *string `json:"timeZone"`        // null: Africa/Lagos
+	CurrencyDisplay string  `json:"currencyDisplay"` // symbol | code
+	Theme           string  `json:"theme"`           // system | light | dark
+}
+
+// language is the language to render text in.
+func (p preferencesDTO) language() string {
+	if p.Language == nil {
+		return i18n.English
+	}
+	return *p.Language
+}
+
+// userPreferences is userID's preferences, the defaults when they can't be
+// read.
+func (app *App) userPreferences(ctx context.Context, userID string) preferencesDTO {
+	p := preferencesDTO{CurrencyDisplay: i18n.CurrencySymbol, Theme: "system"}
+	u, err := app.userByID(ctx, userID)
+	if err != nil {
+		return p
+	}
+	p.Language, p.TimeZone = u.Language, u.TimeZone
+	// rows cached before the columns existed have neither
+	if u.CurrencyDisplay != "" {
+		p.CurrencyDisplay = u.CurrencyDisplay
+	}
+	if u.Theme != "" {
+		p.Theme = u.Theme
+	}
+	return p
+}
+
+// GET /v1/users/me/preferences
+func (app *App) GetMyPreferences(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": app.userPreferences(r.Context(), uid)})
+}
+
+// PUT /v1/users/me/preferences
+// {"language":"yo","timeZone":"Africa/Lagos","currencyDisplay":"symbol","theme":"dark"}
+// Replaces every preference: send the full set as returned by GET. Null
+// language or timeZone clears it.
+func (app *App) UpdateMyPreferences(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		Language        *string `json:"language" validate:"omitempty,oneof=en pcm yo ha ig"`
+		TimeZone        *string `json:"timeZone" validate:"omitempty,timezone"`
+		CurrencyDisplay string  `json:"currencyDisplay" validate:"required,oneof=symbol code"`
+		Theme           string  `json:"theme" validate:"required,oneof=system light dark"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if _, err := app.DB.Exec(r.Context(), `
+		UPDATE users SET language=$2, time_zone=$3, currency_display=$4, theme=$5 WHERE id=$1
+	`, uid, body.Language, body.TimeZone, body.CurrencyDisplay, body.Theme); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("update preferences failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(r.Context(), uid)
+	writeJSON(w, http.StatusOK, map[string]any{"data": preferencesDTO{
+		Language: body.Language, TimeZone: body.TimeZone, CurrencyDisplay: body.CurrencyDisplay, Theme: body.Theme,
+	}})
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Subject-access export and erasure. Both admin-run data requests and the
+// self-serve flow go through exportUserData / anonymizeUser.
+//
+// Erasure is anonymisation, not deletion: ledger rows, payouts and audit logs
+// must be retained, so the user row survives with its PII replaced.
+
+var (
+	errAlreadyAnonymized  = errors.New("user already anonymized")
+	errDeletionBalance    = errors.New("wallet balance not zero")
+	errDeletionInProgress = errors.New("money movement in progress")
+)
+
+// exportSections maps each export section to a query producing a JSON array
+// for user $1. Keep in step with what anonymizeUser erases. Payout
+// destinations are added by exportDestinations, which decrypts them.
+var exportSections = []struct{ name, sql string }{
+	{"profile", `
+		SELECT id, email, username, display_name, avatar_url, phone, role, status, referral_code,
+		       language, time_zone, currency_display, theme,
+		       hide_from_search, hide_from_leaderboards, gifts_from_contacts_only, created_at
+		FROM users WHERE id=$1`},
+	{"transactions", `
+		SELECT t.id, t.kind, t.currency, le.direction, le.amount, t.created_at
+		FROM ledger_entries le
+		JOIN wallets wl ON wl.id = le.wallet_id
+		JOIN transactions t ON t.id = le.tx_id
+		WHERE wl.user_id=$1
+		ORDER BY t.created_at`},
+	{"withdrawals", `
+		SELECT id, amount, currency, status, reference, created_at
+		FROM payouts WHERE user_id=$1 ORDER BY created_at`},
+	{"referrals", `
+		SELECT id, referrer_id, referred_id, status, reward_amount, created_at
+		FROM referrals WHERE referrer_id=$1 OR referred_id=$1`},
+	{"vouchers", `
+		SELECT id, code_last4, amount, remaining, status, expires_at, created_at
+		FROM vouchers WHERE issuer_user_id=$1`},
+	{"devices", `
+		SELECT id, platform, app_version, created_at, last_seen_at
+		FROM devices WHERE user_id=$1 ORDER BY created_at`},
+	{"linkedIdentities", `
+		SELECT id, provider, email, created_at, last_used_at
+		FROM user_identities WHERE user_id=$1 ORDER BY created_at`},
+	{"beneficiaries", `
+		SELECT id, recipient_id, destination_id, nickname, daily_limit, created_at
+		FROM beneficiaries WHERE user_id=$1 ORDER BY created_at`},
+	{"securityEvents", `
+		SELECT id, kind, ip, user_agent, data, created_at
+		FROM security_events WHERE user_id=$1 ORDER BY created_at`},
+	{"emailPreferences", `
+		SELECT transactions, statements, updated_at
+		FROM email_preferences WHERE user_id=$1`},
+	{"smsMessages", `
+		SELECT id, to_number, template, body, status, created_at
+		FROM sms_messages WHERE user_id=$1 ORDER BY created_at`},
+	{"notifications", `
+		SELECT id, kind, title, body, read_at, created_at
+		FROM notifications WHERE user_id=$1 ORDER BY created_at`},
+	{"scheduledGifts", `
+		SELECT id, recipient_id, amount, note, scheduled_at, status, gift_id, created_at
+		FROM scheduled_gifts WHERE sender_id=$1 ORDER BY created_at`},
+	{"statements", `
+		SELECT id, period_from, period_to, status, created_at
+		FROM statements WHERE user_id=$1 ORDER BY created_at`},
+	{"supportTickets", `
+		SELECT t.id, t.subject_type, t.subject_id, t.subject, t.status, t.created_at,
+		       (SELECT json_agg(json_build_object('fromStaff', m.from_staff, 'body', m.body, 'createdAt', m.created_at)
+		                        ORDER BY m.created_at)
+		        FROM support_ticket_messages m WHERE m.ticket_id = t.id) AS messages
+		FROM support_tickets t WHERE t.user_id=$1 ORDER BY t.created_at`},
+	{"sessions", `
+		SELECT created_at, started_at, last_used_at, expires_at, revoked_at, ip, user_agent
+		FROM refresh_tokens WHERE user_id=$1 ORDER BY created_at`},
+	{"bankLinks", `
+		SELECT id, provider, institution, bank_code, account_name, account_last4, balance, balance_at, created_at, unlinked_at
+		FROM bank_links WHERE user_id=$1 ORDER BY created_at`},
+	{"directDebitMandates", `
+		SELECT id, bank_link_id, reference, max_amount, status, expires_at, created_at
+		FROM direct_debit_mandates WHERE user_id=$1 ORDER BY created_at`},
+	{"directDebits", `
+		SELECT id, mandate_id, amount, reference, status, error, tx_id, created_at
+		FROM direct_debits WHERE user_id=$1 ORDER BY created_at`},
+}
+
+// exportUserData collects everything we hold about userID. The digest is the
+// SHA-256 of the marshalled export and goes into the evidence record.
+func (app *App) exportUserData(ctx context.Context, userID string) (json.RawMessage, string, error) {
+	out := map[string]json.RawMessage{}
+	for _, s := range exportSections {
+		var section []byte
+		if err := app.DB.QueryRow(ctx,
+			`SELECT COALESCE(json_agg(x), '[]'::json) FROM (`+s.sql+`) x`, userID,
+		).Scan(&section); err != nil {
+			return nil, "", err
+		}
+		out[s.name] = section
+	}
+	destinations, err := app.exportDestinations(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	out["payoutDestinations"] = destinations
+	var balance int64
+	if err := app.DB.QueryRow(ctx, `
+		SELECT COALESCE(SUM(`+balanceSQL("wl.id")+`),0)::bigint FROM wallets wl WHERE wl.user_id = $1
+	`, userID).Scan(&balance); err != nil {
+		return nil, "", err
+	}
+	out["wallet"], _ = json.Marshal(map[string]any{"balance": balance, "currency": "NGN"})
+	out["exportedAt"], _ = json.Marshal(time.Now().UTC())
+
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(raw)
+	return raw, hex.EncodeToString(sum[:]), nil
+}
+
+// exportDestinations lists userID's payout destinations with their bank
+// details opened; the export goes to the account holder.
+func (app *App) exportDestinations(ctx context.Context, userID string) (json.RawMessage, error) {
+	rows, err := app.DB.Query(ctx, `
+		SELECT id, bank_code, account_number, account_name, bvn, is_default, created_at, deleted_at
+		FROM payout_destinations WHERE user_id=$1 ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	type destination struct {
+		ID            string     `json:"id"`
+		BankCode      string     `json:"bank_code"`
+		AccountNumber string     `json:"account_number"`
+		AccountName   string     `json:"account_name"`
+		BVN           *string    `json:"bvn"`
+		IsDefault     bool       `json:"is_default"`
+		CreatedAt     time.Time  `json:"created_at"`
+		DeletedAt     *time.Time `json:"deleted_at"`
+	}
+	list, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (destination, error) {
+		var d destination
+		err := r.Scan(&d.ID, &d.BankCode, &d.AccountNumber, &d.AccountName, &d.BVN, &d.IsDefault, &d.CreatedAt, &d.DeletedAt)
+		return d, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		d := &list[i]
+		if d.AccountNumber, d.BVN, err = app.openDestination(ctx, d.AccountNumber, d.BVN); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(list)
+}
+
+// anonymizeUser erases userID's personal data and ends their sessions. It
+// refuses while the wallet holds funds or money is in flight, since the user
+// could no longer claim it. Returns rows touched per table as evidence.
+func (app *App) anonymizeUser(ctx context.Context, userID string) (map[string]int64, error) {
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		anonymizedAt *time.Time
+		avatarURL    *string
+	)
+	if err := tx.QueryRow(ctx, `SELECT anonymized_at, avatar_url FROM users WHERE id=$1 FOR UPDATE`, userID).Scan(&anonymizedAt, &avatarURL); err != nil {
+		return nil, err
+	}
+	if anonymizedAt != nil {
+		return nil, errAlreadyAnonymized
+	}
+
+	if err := checkErasable(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int64{}
+	steps := []struct{ name, sql string }{
+		{"users", `
+			UPDATE users SET
+			  email = 'deleted+' || id::text || '@okies.invalid',
+			  password_hash = '!',
+			  username = NULL, display_name = NULL, avatar_url = NULL, referral_code = NULL,
+			  phone = NULL, phone_verified_at = NULL,
+			  status = 'banned', status_reason = 'account erased',
+			  status_changed_at = now(), anonymized_at = now(), deletion_scheduled_at = NULL
+			WHERE id=$1`},
+		{"payout_destinations", `
+			UPDATE payout_destinations SET
+			  account_number = account_last4, account_number_hash = NULL,
+			  account_name = 'REDACTED', bvn = NULL, bvn_hash = NULL
+			WHERE user_id=$1`},
+		{"bank_links", `
+			UPDATE bank_links SET account_name = 'REDACTED', unlinked_at = COALESCE(unlinked_at, now())
+			WHERE user_id=$1`},
+		{"direct_debit_mandates", `
+			UPDATE direct_debit_mandates SET status = 'cancelled', authorize_url = NULL, updated_at = now()
+			WHERE user_id=$1 AND status IN ('pending','active')`},
+		{"refresh_tokens", `
+			UPDATE refresh_tokens SET revoked_at = COALESCE(revoked_at, now()), ip = NULL, user_agent = NULL
+			WHERE user_id=$1`},
+		{"referrals", `UPDATE referrals SET signup_ip = NULL WHERE referrer_id=$1 OR referred_id=$1`},
+		{"avatar_uploads", `DELETE FROM avatar_uploads WHERE user_id=$1`},
+		{"username_redirects", `DELETE FROM username_redirects WHERE user_id=$1`},
+		{"otp_codes", `DELETE FROM otp_codes WHERE user_id=$1`},
+		{"user_identities", `DELETE FROM user_identities WHERE user_id=$1`},
+		{"security_events", `DELETE FROM security_events WHERE user_id=$1`},
+		{"beneficiaries", `DELETE FROM beneficiaries WHERE user_id=$1`},
+		{"name_reviews", `DELETE FROM name_reviews WHERE user_id=$1`},
+		{"notifications", `DELETE FROM notifications WHERE user_id=$1`},
+		{"devices", `DELETE FROM devices WHERE user_id=$1`},
+		{"email_preferences", `DELETE FROM email_preferences WHERE user_id=$1`},
+		{"sms_messages", `UPDATE sms_messages SET to_number = 'REDACTED', body = NULL WHERE user_id=$1`},
+		{"scheduled_gifts", `
+			UPDATE scheduled_gifts SET note = NULL,
+			  status = CASE WHEN status='scheduled' THEN 'cancelled' ELSE status END,
+			  settled_at = COALESCE(settled_at, now())
+			WHERE sender_id=$1`},
+		{"statements", `DELETE FROM statements WHERE user_id=$1`},
+		{"partners", `UPDATE partners SET revoked_at = COALESCE(revoked_at, now()) WHERE user_id=$1`},
+	}
+	for _, s := range steps {
+		tag, err := tx.Exec(ctx, s.sql, userID)
+		if err != nil {
+			return nil, err
+		}
+		counts[s.name] = tag.RowsAffected()
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	app.invalidateUser(ctx, userID)
+	if avatarURL != nil {
+		app.deleteAvatarURL(ctx, *avatarURL)
+	}
+	return counts, nil
+}
+
+// checkErasable returns errDeletionBalance while userID's wallet holds
+// funds and errDeletionInProgress while money is in flight.
+func checkErasable(ctx context.Context, q rowQuerier, userID string) error {
+	var balance, inFlight int64
+	if err := q.QueryRow(ctx, `
+		SELECT
+		  (SELECT COALESCE(SUM(`+balanceSQL("wl.id")+`),0)::bigint FROM wallets wl WHERE wl.user_id = $1),
+		  (SELECT COUNT(*) FROM payouts WHERE user_id=$1 AND status IN ('pending','processing','approved')) +
+		  (SELECT COUNT(*) FROM held_gifts WHERE (sender_id=$1 OR recipient_id=$1) AND status='held') +
+		  (SELECT COUNT(*) FROM vouchers WHERE issuer_user_id=$1 AND status='active') +
+		  (SELECT COUNT(*) FROM direct_debits WHERE user_id=$1 AND status IN ('pending','processing'))
+	`, userID).Scan(&balance, &inFlight); err != nil {
+		return err
+	}
+	if balance != 0 {
+		return errDeletionBalance
+	}
+	if inFlight > 0 {
+		return errDeletionInProgress
+	}
+	return nil
+}
+
+// dataRequestErrorCode maps machinery errors to API error codes.
+func dataRequestErrorCode(err error) string {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return "user_not_found"
+	case errors.Is(err, errAlreadyAnonymized):
+		return "already_anonymized"
+	case errors.Is(err, errDeletionBalance):
+		return "balance_not_zero"
+	case errors.Is(err, errDeletionInProgress):
+		return "money_in_flight"
+	}
+	return "db_error"
+}
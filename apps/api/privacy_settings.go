@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+// Privacy settings: who can find a user and who can send them money.
+// Hiding from search doesn't stop payments by QR code, profile link, phone
+// number or ID.
+// With gifts from contacts only, a sender must be someone the user has
+// sent a gift to before. Leaderboards must leave out users hiding from
+// them.
+
+type privacySettings struct {
+	HideFromSearch        bool `json:"hideFromSearch"`
+	HideFromLeaderboards  bool `json:"hideFromLeaderboards"`
+	GiftsFromContactsOnly bool `json:"giftsFromContactsOnly"`
+}
+
+// acceptsGiftFrom reports whether recipientID's settings let senderID send
+// them a gift.
+func (app *App) acceptsGiftFrom(ctx context.Context, senderID, recipientID string) (bool, error) {
+	senderWid, err := app.walletIDForUser(ctx, senderID)
+	if err != nil {
+		return false, err
+	}
+	recipientWid, err := app.walletIDForUser(ctx, recipientID)
+	if err != nil {
+		return false, err
+	}
+	var ok bool
+	err = app.DB.QueryRow(ctx, `
+		SELECT NOT gifts_from_contacts_only OR EXISTS (
+		  SELECT 1 FROM ledger_entries d
+		  JOIN ledger_entries c ON c.tx_id = d.tx_id AND c.wallet_id = $3 AND c.direction = 'credit'
+		  JOIN transactions t ON t.id = d.tx_id AND t.kind = 'gift'
+		  WHERE d.wallet_id = $2 AND d.direction = 'debit')
+		FROM users WHERE id=$1
+	`, recipientID, recipientWid, senderWid).Scan(&ok)
+	return ok, err
+}
+
+// GET /v1/users/me/privacy
+func (app *App) GetMyPrivacySettings(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var s privacySettings
+	if err := app.DB.QueryRow(r.Context(), `
+		SELECT hide_from_search, hide_from_leaderboards, gifts_from_contacts_only FROM users WHERE id=$1
+	`, uid).Scan(&s.HideFromSearch, &s.HideFromLeaderboards, &s.GiftsFromContactsOnly); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": s})
+}
+
+// PUT /v1/users/me/privacy
+// {"hideFromSearch":true,"hideFromLeaderboards":true,"giftsFromContactsOnly":false}
+func (app *App) UpdateMyPrivacySettings(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		HideFromSearch        *bool `json:"hideFromSearch" validate:"required"`
+		HideFromLeaderboards  *bool `json:"hideFromLeaderboards" validate:"required"`
+		GiftsFromContactsOnly *bool `json:"giftsFromContactsOnly" validate:"required"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if _, err := app.DB.Exec(r.Context(), `
+		UPDATE users SET hide_from_search=$2, hide_from_leaderboards=$3, gifts_from_contacts_only=$4 WHERE id=$1
+	`, uid, *body.HideFromSearch, *body.HideFromLeaderboards, *body.GiftsFromContactsOnly); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("update privacy settings failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": privacySettings{
+		HideFromSearch:        *body.HideFromSearch,
+		HideFromLeaderboards:  *body.HideFromLeaderboards,
+		GiftsFromContactsOnly: *body.GiftsFromContactsOnly,
+	}})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
+)
+
+// Receive QR codes carry a deep link naming the recipient, and optionally
+// an amount, signed so a scanned code can't be altered to pay someone else
+// or a different amount:
+//
+//	okies://pay?to=<user id>&amount=<kobo>&sig=<base64url HMAC>
+//
+// The user ID, not the username, is encoded so printed codes keep working
+// after a username change. Apps render the QR themselves.
+const qrScheme, qrHost = "okies", "pay"
+
+var errInvalidQR = errors.New("invalid receive QR payload")
+
+func (app *App) signQR(to string, amount int64) string {
+	mac := hmac.New(sha256.New, app.Config.QRSecret)
+	mac.Write([]byte("qr:" + to + ":" + strconv.FormatInt(amount, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// qrPayload builds the deep link for to; amount 0 leaves it to the payer.
+func (app *App) qrPayload(to string, amount int64) string {
+	q := url.Values{"to": {to}, "sig": {app.signQR(to, amount)}}
+	if amount > 0 {
+		q.Set("amount", strconv.FormatInt(amount, 10))
+	}
+	return (&url.URL{Scheme: qrScheme, Host: qrHost, RawQuery: q.Encode()}).String()
+}
+
+// parseQRPayload checks a scanned deep link and returns who it pays and how
+// much (0 for any amount).
+func (app *App) parseQRPayload(payload string) (to string, amount int64, err error) {
+	u, err := url.Parse(strings.TrimSpace(payload))
+	if err != nil || u.Scheme != qrScheme || u.Host != qrHost {
+		return "", 0, errInvalidQR
+	}
+	q := u.Query()
+	to = q.Get("to")
+	if v := q.Get("amount"); v != "" {
+		if amount, err = strconv.ParseInt(v, 10, 64); err != nil || amount <= 0 || amount > validate.MaxKobo {
+			return "", 0, errInvalidQR
+		}
+	}
+	if to == "" || !hmac.Equal([]byte(q.Get("sig")), []byte(app.signQR(to, amount))) {
+		return "", 0, errInvalidQR
+	}
+	return to, amount, nil
+}
+
+// listedUserMini loads id if others may find and pay them; see listedUser.
+func (app *App) listedUserMini(ctx context.Context, id string) (UserMini, error) {
+	var u UserMini
+	err := app.DB.QueryRow(ctx, `
+		SELECT u.id, u.username, u.display_name, u.avatar_url FROM users u
+		WHERE u.id::text=$1 AND `+listedUser, id).Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarURL)
+	return u, err
+}
+
+// GET /v1/users/me/qr?amount=
+// The caller's receive code, optionally for a fixed amount in kobo.
+func (app *App) GetMyQR(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var amount int64
+	if v := strings.TrimSpace(r.URL.Query().Get("amount")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > validate.MaxKobo {
+			apierror.Write(w, apierror.InvalidField("amount"))
+			return
+		}
+		amount = n
+	}
+	u := app.loadUser(r, uid)
+	out := map[string]any{
+		"payload":   app.qrPayload(uid, amount),
+		"recipient": UserMini{ID: u.ID, Username: u.Username, DisplayName: u.DisplayName, AvatarURL: u.AvatarURL},
+	}
+	if amount > 0 {
+		out["amount"] = amount
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// POST /v1/qr/resolve  {"payload":"okies://pay?..."}
+// What the app calls after scanning: the recipient to confirm with the
+// payer, and the amount if the code fixes one. Send with POST /v1/gifts.
+func (app *App) ResolveQR(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Payload string `json:"payload" validate:"required,max=512"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	to, amount, err := app.parseQRPayload(body.Payload)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusUnprocessableEntity, "invalid_qr_code"))
+		return
+	}
+	u, err := app.listedUserMini(r.Context(), to)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	out := map[string]any{"recipient": u}
+	if amount > 0 {
+		out["amount"] = amount
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
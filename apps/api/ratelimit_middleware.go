@@ -1,12 +1,15 @@
 package main
 
 import (
+	"math"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
 )
 
 // use a UNIQUE helper name so we don't clash with any other clientIP in this package
@@ -22,7 +25,13 @@ func remoteIP(r *http.Request) string {
 	return host
 }
 
-func (app *App) rateLimit(limit int, window time.Duration, keyf func(*http.Request) string) func(http.Handler) http.Handler {
+// RateLimit applies the limit defined by the named setting (see
+// settings.RateLimit), so ops can tighten it at runtime. The rule is read
+// per request from the settings cache. A rule with failClosed rejects
+// requests when Redis errors mid-request; the rest fail open so a Redis
+// blip doesn't take the API down with it. Redis being unreachable at
+// startup disables limiting either way.
+func (app *App) RateLimit(setting string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// If Redis isn't configured/available, skip limiting.
@@ -31,36 +40,33 @@ func (app *App) rateLimit(limit int, window time.Duration, keyf func(*http.Reque
 				return
 			}
 
-			key := "rl:" + r.URL.Path + ":" + keyf(r)
-			pipe := app.Redis.TxPipeline()
-			incr := pipe.Incr(r.Context(), key)
-			pipe.Expire(r.Context(), key, window)
-
-			if _, err := pipe.Exec(r.Context()); err != nil {
-				httpError(w, http.StatusInternalServerError, "rate_limit_error")
+			rule := app.Settings.RateLimit(r.Context(), setting)
+			tier := "anonymous"
+			if role, ok := getUserRole(r); ok && role != "" {
+				tier = role
+			}
+			key := "ip:" + remoteIP(r)
+			if uid, ok := getUserID(r); ok && uid != "" && rule.Key == "user" {
+				key = "uid:" + uid
+			}
+			res, err := app.Limiter.Allow(r.Context(), setting+":"+key, rule.LimitFor(tier), rule.WindowDuration())
+			if err != nil {
+				log.Warn().Err(err).Str("rule", setting).Bool("fail_closed", rule.FailClosed).Msg("rate limit check failed")
+				if rule.FailClosed {
+					apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "rate_limit_error"))
+					return
+				}
+				next.ServeHTTP(w, r)
 				return
 			}
-			if incr.Val() > int64(limit) {
-				httpError(w, http.StatusTooManyRequests, "rate_limited")
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+				apierror.Write(w, apierror.New(http.StatusTooManyRequests, "rate_limited"))
 				return
 			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
-
-func (app *App) RateLimitIP(limit int, window time.Duration) func(http.Handler) http.Handler {
-	return app.rateLimit(limit, window, func(r *http.Request) string { return "ip:" + remoteIP(r) })
-}
-
-func (app *App) RateLimitUser(limit int, window time.Duration) func(http.Handler) http.Handler {
-	return app.rateLimit(limit, window, func(r *http.Request) string {
-		if uid, ok := getUserID(r); ok && uid != "" {
-			return "uid:" + uid
-		}
-		return "ip:" + remoteIP(r)
-	})
-}
-
-// keep redis import from being trimmed in some builds
-var _ = redis.Nil
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/events"
+)
+
+// Real-time delivery over Server-Sent Events. Each instance keeps its own
+// connections and listens to domain events as a broadcast subscriber, so
+// with Redis a client hears about events published on any instance (or by
+// the worker).
+
+const (
+	maxStreamsPerUser = 5
+	streamHeartbeat   = 25 * time.Second
+)
+
+type streamMsg struct {
+	Type string         `json:"type"` // gift.received | withdrawal.settled | balance.changed
+	Data map[string]any `json:"data"`
+	At   time.Time      `json:"at"`
+}
+
+type streamHub struct {
+	mu      sync.RWMutex
+	conns   map[string]map[chan streamMsg]struct{} // user ID -> open streams
+	closing chan struct{}                          // closed on shutdown
+	once    sync.Once
+}
+
+var hub = &streamHub{conns: map[string]map[chan streamMsg]struct{}{}, closing: make(chan struct{})}
+
+// closeAll ends every open stream so server shutdown isn't held up by them;
+// clients reconnect to another instance.
+func (h *streamHub) closeAll() {
+	h.once.Do(func() { close(h.closing) })
+}
+
+func (h *streamHub) add(userID string) (chan streamMsg, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.conns[userID]) >= maxStreamsPerUser {
+		return nil, false
+	}
+	ch := make(chan streamMsg, 16)
+	if h.conns[userID] == nil {
+		h.conns[userID] = map[chan streamMsg]struct{}{}
+	}
+	h.conns[userID][ch] = struct{}{}
+	gauges.Set("okies_stream_connections", "Open real-time streams on this instance.", float64(h.countLocked()))
+	return ch, true
+}
+
+func (h *streamHub) remove(userID string, ch chan streamMsg) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns[userID], ch)
+	if len(h.conns[userID]) == 0 {
+		delete(h.conns, userID)
+	}
+	gauges.Set("okies_stream_connections", "Open real-time streams on this instance.", float64(h.countLocked()))
+}
+
+func (h *streamHub) countLocked() int {
+	n := 0
+	for _, cs := range h.conns {
+		n += len(cs)
+	}
+	return n
+}
+
+func (h *streamHub) connected(userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns[userID]) > 0
+}
+
+// send delivers m to every stream userID has open here. A stream that
+// isn't keeping up misses the message rather than blocking the bus.
+func (h *streamHub) send(userID string, m streamMsg) {
+	m.At = time.Now().UTC()
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.conns[userID] {
+		select {
+		case ch <- m:
+		default:
+		}
+	}
+}
+
+// sendBalance pushes userID's current balance if they are connected here.
+func (app *App) sendBalance(ctx context.Context, userID string) {
+	if !hub.connected(userID) {
+		return
+	}
+	var balance int64
+	if err := app.DB.QueryRow(ctx, `
+		SELECT COALESCE(SUM(`+balanceSQL("wl.id")+`),0)::bigint FROM wallets wl WHERE wl.user_id = $1
+	`, userID).Scan(&balance); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", userID).Msg("stream balance lookup failed")
+		return
+	}
+	hub.send(userID, streamMsg{Type: "balance.changed", Data: map[string]any{"balance": balance, "currency": "NGN"}})
+}
+
+// registerStreamSubscribers turns domain events into stream messages.
+func (app *App) registerStreamSubscribers() {
+	b := app.Events
+	b.SubscribeBroadcast(evGiftCreated, func(ctx context.Context, e events.Event) {
+		var g giftCreated
+		if !decodeEvent(e, &g) {
+			return
+		}
+		app.sendBalance(ctx, g.SenderID)
+		if g.Held {
+			return
+		}
+		hub.send(g.RecipientID, streamMsg{Type: "gift.received", Data: map[string]any{
+			"giftId": g.GiftID, "senderId": g.SenderID, "amount": g.Amount,
+		}})
+		app.sendBalance(ctx, g.RecipientID)
+	})
+	b.SubscribeBroadcast(evDepositSettled, func(ctx context.Context, e events.Event) {
+		var d depositSettled
+		if decodeEvent(e, &d) {
+			app.sendBalance(ctx, d.UserID)
+		}
+	})
+	b.SubscribeBroadcast(evWithdrawalSettled, func(ctx context.Context, e events.Event) {
+		var p withdrawalSettled
+		if !decodeEvent(e, &p) {
+			return
+		}
+		hub.send(p.UserID, streamMsg{Type: "withdrawal.settled", Data: map[string]any{
+			"payoutId": p.PayoutID, "reference": p.Reference, "status": p.Status, "amount": p.Amount,
+		}})
+		if p.Refunded {
+			app.sendBalance(ctx, p.UserID)
+		}
+	})
+}
+
+// GET /v1/stream (text/event-stream)
+// Each message is `event: <type>` plus a JSON `data:` line; comments are
+// sent as heartbeats so proxies keep the connection open.
+func (app *App) Stream(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	rc := http.NewResponseController(w)
+	ch, ok := hub.add(uid)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusTooManyRequests, "too_many_streams"))
+		return
+	}
+	defer hub.remove(uid, ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil || rc.Flush() != nil {
+		return
+	}
+	app.sendBalance(r.Context(), uid)
+
+	t := time.NewTicker(streamHeartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-hub.closing:
+			return
+		case <-t.C:
+			_, err := fmt.Fprint(w, ": ping\n\n")
+			if err != nil || rc.Flush() != nil {
+				return
+			}
+		case m := <-ch:
+			data, _ := json.Marshal(m)
+			_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.Type, data)
+			if err != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// ---------- Types ----------
+
+type referralDTO struct {
+	ID           string     `json:"id"`
+	ReferredID   string     `json:"referredUserId"`
+	Username     *string    `json:"username,omitempty"`
+	DisplayName  *string    `json:"displayName,omitempty"`
+	Status       string     `json:"status"`
+	RewardAmount int64      `json:"rewardAmount"`
+	RewardedAt   *time.Time `json:"rewardedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// ---------- Helpers ----------
+
+// unambiguous alphabet: no 0/O, 1/I/L
+const referralAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+func newReferralCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i := range buf {
+		buf[i] = referralAlphabet[int(buf[i])%len(referralAlphabet)]
+	}
+	return string(buf), nil
+}
+
+func normalizeReferralCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ensureReferralCode returns the user's referral code, generating one for
+// accounts created before the referral program existed.
+func (app *App) ensureReferralCode(ctx context.Context, userID string) (string, error) {
+	var code *string
+	if err := app.DB.QueryRow(ctx, `SELECT referral_code FROM users WHERE id=$1`, userID).Scan(&code); err != nil {
+		return "", err
+	}
+	if code != nil && *code != "" {
+		return *code, nil
+	}
+	for i := 0; i < 5; i++ {
+		c, err := newReferralCode()
+		if err != nil {
+			return "", err
+		}
+		var out string
+		err = app.DB.QueryRow(ctx, `
+			UPDATE users SET referral_code = COALESCE(referral_code, $2)
+			WHERE id=$1
+			RETURNING referral_code
+		`, userID, c).Scan(&out)
+		if err == nil {
+			return out, nil
+		}
+		// unique collision: try another code
+	}
+	return "", errors.New("could not allocate referral code")
+}
+
+// attachReferral records that referredID signed up with referrerID's code.
+// Signups that share an IP with one of the referrer's sessions are recorded as
+// flagged and never rewarded (self-referral via a second account).
+func (app *App) attachReferral(ctx context.Context, referrerID, referredID, ip string) error {
+	if referrerID == referredID {
+		return nil
+	}
+	status := "pending"
+	var sameIP bool
+	if err := app.DB.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM refresh_tokens WHERE user_id=$1 AND ip=$2)
+	`, referrerID, ip).Scan(&sameIP); err != nil {
+		return err
+	}
+	if sameIP {
+		status = "flagged"
+	}
+	_, err := app.DB.Exec(ctx, `
+		INSERT INTO referrals (referrer_id, referred_id, status, signup_ip)
+		VALUES ($1,$2,$3,$4)
+		ON CONFLICT (referred_id) DO NOTHING
+	`, referrerID, referredID, status, ip)
+	return err
+}
+
+// referralDepositSources are the deposits a user funds themselves. Staff
+// top-ups and internal postings don't qualify a referral.
+var referralDepositSources = map[string]bool{"direct_debit": true}
+
+// rewardReferral credits both parties of a pending referral once the referred
+// user completes the qualifying action: a deposit they fund themselves of at
+// least referrals.min_deposit_kobo. Safe to call on every deposit:
+// non-qualifying deposits, non-pending referrals and repeats are no-ops.
+// A referral whose two accounts turn out to share a session IP, a phone or a
+// payout account is flagged instead.
+func (app *App) rewardReferral(ctx context.Context, d depositSettled) error {
+	if !app.Settings.Bool(ctx, settings.ReferralRewardsEnabled) {
+		return nil
+	}
+	if !referralDepositSources[d.Source] || d.Amount < app.Settings.Int64(ctx, settings.ReferralMinDepositKobo) {
+		return nil
+	}
+	amount := app.Settings.Int64(ctx, settings.ReferralRewardKobo)
+	if amount <= 0 {
+		return nil
+	}
+	referredID := d.UserID
+
+	var referralID, referrerID string
+	err := app.DB.QueryRow(ctx, `
+		SELECT id, referrer_id FROM referrals
+		WHERE referred_id=$1 AND status='pending'
+	`, referredID).Scan(&referralID, &referrerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	referrerWid, err := app.walletIDForUser(ctx, referrerID)
+	if err != nil {
+		return err
+	}
+	referredWid, err := app.walletIDForUser(ctx, referredID)
+	if err != nil {
+		return err
+	}
+	_, systemWid, err := app.systemUserAndWallet(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM referrals WHERE id=$1 FOR UPDATE`, referralID).Scan(&status); err != nil {
+		return err
+	}
+	if status != "pending" {
+		return nil
+	}
+
+	var shared bool
+	if err := tx.QueryRow(ctx, `
+		SELECT
+		  EXISTS (SELECT 1 FROM refresh_tokens a JOIN refresh_tokens b ON b.ip = a.ip
+		          WHERE a.user_id = $1 AND b.user_id = $2 AND a.ip IS NOT NULL)
+		  OR EXISTS (SELECT 1 FROM devices
+		             WHERE (user_id = $1 AND previous_user_id = $2) OR (user_id = $2 AND previous_user_id = $1))
+		  OR EXISTS (SELECT 1 FROM payout_destinations a JOIN payout_destinations b
+		               ON b.bank_code = a.bank_code AND b.account_number_hash = a.account_number_hash
+		             WHERE a.user_id = $1 AND b.user_id = $2)
+	`, referrerID, referredID).Scan(&shared); err != nil {
+		return err
+	}
+	if shared {
+		log.Ctx(ctx).Warn().Str("referral_id", referralID).Msg("referral shares a session IP, phone or payout account; flagged")
+		if _, err := tx.Exec(ctx, `UPDATE referrals SET status='flagged' WHERE id=$1`, referralID); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+
+	if err := app.lockWallets(ctx, tx, systemWid, referrerWid, referredWid); err != nil {
+		return err
+	}
+
+	legs := []struct{ suffix, walletID string }{
+		{"referrer", referrerWid},
+		{"referred", referredWid},
+	}
+	for _, leg := range legs {
+		var txID string
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+			VALUES ($1,'referral_reward',$2,'NGN', jsonb_build_object('referralId', $3::text))
+			RETURNING id
+		`, "referral:"+referralID+":"+leg.suffix, amount, referralID).Scan(&txID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+			VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+		`, txID, systemWid, amount, leg.walletID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE referrals SET status='rewarded', reward_amount=$2, rewarded_at=now()
+		WHERE id=$1
+	`, referralID, amount); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ---------- Handlers ----------
+
+// GET /v1/referrals
+func (app *App) GetReferrals(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	ctx := r.Context()
+
+	code, err := app.ensureReferralCode(ctx, uid)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("ensure referral code failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	rows, err := app.DB.Query(ctx, `
+		SELECT rf.id, u.id, u.username, u.display_name,
+		       rf.status, rf.reward_amount, rf.rewarded_at, rf.created_at
+		FROM referrals rf
+		JOIN users u ON u.id = rf.referred_id
+		WHERE rf.referrer_id=$1
+		ORDER BY rf.created_at DESC
+		LIMIT 100
+	`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	list := []referralDTO{}
+	var pending, rewarded int
+	var earned int64
+	for rows.Next() {
+		var d referralDTO
+		if err := rows.Scan(&d.ID, &d.ReferredID, &d.Username, &d.DisplayName,
+			&d.Status, &d.RewardAmount, &d.RewardedAt, &d.CreatedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		switch d.Status {
+		case "pending":
+			pending++
+		case "rewarded":
+			rewarded++
+			earned += d.RewardAmount
+		}
+		list = append(list, d)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": map[string]any{
+			"code":      code,
+			"pending":   pending,
+			"rewarded":  rewarded,
+			"earned":    earned,
+			"referrals": list,
+		},
+	})
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// Currency transaction reports list, for one UTC day, every single movement
+// at or above the single threshold and every user whose total inflow or
+// outflow reached the daily threshold. Only user wallets are reported; the
+// system wallet is our own counterparty.
+
+type ctrRow struct {
+	XMLName    xml.Name  `json:"-" xml:"Transaction"`
+	ReportType string    `json:"reportType" xml:"ReportType"` // single | aggregate
+	TxID       string    `json:"txId,omitempty" xml:"TransactionId,omitempty"`
+	TxKind     string    `json:"txKind,omitempty" xml:"TransactionType,omitempty"`
+	TxDate     time.Time `json:"txDate" xml:"TransactionDate"`
+	UserID     string    `json:"userId" xml:"Subject>CustomerId"`
+	FullName   string    `json:"fullName" xml:"Subject>FullName"`
+	Email      string    `json:"email" xml:"Subject>Email"`
+	Direction  string    `json:"direction" xml:"Direction"` // credit = inflow to user
+	Amount     int64     `json:"amount" xml:"AmountKobo"`
+	Currency   string    `json:"currency" xml:"Currency"`
+	Count      int64     `json:"count" xml:"TransactionCount"`
+}
+
+type regulatoryReport struct {
+	ID              string    `json:"id"`
+	Date            string    `json:"date"`
+	Kind            string    `json:"kind"`
+	SingleThreshold int64     `json:"singleThreshold"`
+	DailyThreshold  int64     `json:"dailyThreshold"`
+	RowCount        int       `json:"rowCount"`
+	Rows            []ctrRow  `json:"rows,omitempty"`
+	GeneratedBy     *string   `json:"generatedBy,omitempty"`
+	GeneratedAt     time.Time `json:"generatedAt"`
+}
+
+// buildCTRRows computes report rows for the UTC day starting at day.
+func (app *App) buildCTRRows(ctx context.Context, day time.Time, single, daily int64) ([]ctrRow, error) {
+	platform, err := app.platformWallets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start, end := day, day.Add(24*time.Hour)
+
+	out := []ctrRow{}
+	rows, err := app.DB.Query(ctx, `
+		SELECT t.id, t.kind, t.created_at, u.id, COALESCE(u.display_name, u.username, ''), u.email,
+		       le.direction, le.amount, t.currency
+		FROM ledger_entries le
+		JOIN transactions t ON t.id = le.tx_id
+		JOIN wallets wl ON wl.id = le.wallet_id
+		JOIN users u ON u.id = wl.user_id
+		WHERE le.wallet_id <> ALL($1) AND t.created_at >= $2 AND t.created_at < $3 AND le.amount >= $4
+		ORDER BY t.created_at
+	`, platform, start, end, single)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		c := ctrRow{ReportType: "single", Count: 1}
+		if err := rows.Scan(&c.TxID, &c.TxKind, &c.TxDate, &c.UserID, &c.FullName, &c.Email,
+			&c.Direction, &c.Amount, &c.Currency); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = app.DB.Query(ctx, `
+		SELECT u.id, COALESCE(u.display_name, u.username, ''), u.email,
+		       le.direction, SUM(le.amount), COUNT(*), MAX(t.currency)
+		FROM ledger_entries le
+		JOIN transactions t ON t.id = le.tx_id
+		JOIN wallets wl ON wl.id = le.wallet_id
+		JOIN users u ON u.id = wl.user_id
+		WHERE le.wallet_id <> ALL($1) AND t.created_at >= $2 AND t.created_at < $3
+		GROUP BY u.id, le.direction
+		HAVING SUM(le.amount) >= $4
+		ORDER BY u.id, le.direction
+	`, platform, start, end, daily)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c := ctrRow{ReportType: "aggregate", TxDate: start}
+		if err := rows.Scan(&c.UserID, &c.FullName, &c.Email, &c.Direction, &c.Amount, &c.Count, &c.Currency); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// generateCTR builds and stores the report for day, replacing any earlier
+// version. generatedBy is empty for scheduled runs.
+func (app *App) generateCTR(ctx context.Context, day time.Time, generatedBy string) (regulatoryReport, error) {
+	single := app.Settings.Int64(ctx, settings.CTRSingleThresholdKobo)
+	daily := app.Settings.Int64(ctx, settings.CTRDailyThresholdKobo)
+	rows, err := app.buildCTRRows(ctx, day, single, daily)
+	if err != nil {
+		return regulatoryReport{}, err
+	}
+	raw, err := json.Marshal(rows)
+	if err != nil {
+		return regulatoryReport{}, err
+	}
+
+	rep := regulatoryReport{Date: day.Format("2006-01-02"), Kind: "ctr", SingleThreshold: single, DailyThreshold: daily, RowCount: len(rows), Rows: rows}
+	var by *string
+	if generatedBy != "" {
+		by = &generatedBy
+	}
+	err = app.DB.QueryRow(ctx, `
+		INSERT INTO regulatory_reports (report_date, kind, single_threshold, daily_threshold, row_count, rows, generated_by)
+		VALUES ($1,'ctr',$2,$3,$4,$5::jsonb,$6)
+		ON CONFLICT (kind, report_date) DO UPDATE SET
+		  single_threshold=EXCLUDED.single_threshold, daily_threshold=EXCLUDED.daily_threshold,
+		  row_count=EXCLUDED.row_count, rows=EXCLUDED.rows,
+		  generated_by=EXCLUDED.generated_by, generated_at=now()
+		RETURNING id, generated_by, generated_at
+	`, day, single, daily, len(rows), string(raw), by).Scan(&rep.ID, &rep.GeneratedBy, &rep.GeneratedAt)
+	return rep, err
+}
+
+// runRegulatoryReporter makes sure yesterday's CTR exists, checking every
+// interval so a missed run (deploy, outage) is caught up.
+func (app *App) runRegulatoryReporter(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+		var exists bool
+		if err := app.DB.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM regulatory_reports WHERE kind='ctr' AND report_date=$1)
+		`, day).Scan(&exists); err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("regulatory report check failed")
+		} else if !exists {
+			if rep, err := app.generateCTR(ctx, day, ""); err != nil {
+				log.Ctx(ctx).Error().Err(err).Str("date", day.Format("2006-01-02")).Msg("regulatory report generation failed")
+			} else {
+				log.Ctx(ctx).Info().Str("date", rep.Date).Int("rows", rep.RowCount).Msg("regulatory report generated")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ---------- Handlers (Admin) ----------
+
+// GET /v1/admin/reports/regulatory?limit=&offset=
+func (app *App) AdminListRegulatoryReports(w http.ResponseWriter, r *http.Request) {
+	limit := 30
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 366 {
+			limit = n
+		}
+	}
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			offset = n
+		}
+	}
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT id, to_char(report_date,'YYYY-MM-DD'), kind, single_threshold, daily_threshold, row_count, generated_by, generated_at
+		FROM regulatory_reports
+		ORDER BY report_date DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []regulatoryReport{}
+	for rows.Next() {
+		var rep regulatoryReport
+		if err := rows.Scan(&rep.ID, &rep.Date, &rep.Kind, &rep.SingleThreshold, &rep.DailyThreshold,
+			&rep.RowCount, &rep.GeneratedBy, &rep.GeneratedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, rep)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": map[string]any{"limit": limit, "offset": offset}})
+}
+
+// POST /v1/admin/reports/regulatory  {"date":"YYYY-MM-DD"} — (re)generate a day
+func (app *App) AdminGenerateRegulatoryReport(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Date string `json:"date" validate:"required,datetime=2006-01-02"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	day, err := time.Parse("2006-01-02", strings.TrimSpace(body.Date))
+	if err != nil || !day.Before(time.Now().UTC().Truncate(24*time.Hour)) {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_date"))
+		return
+	}
+	actor, _ := getUserID(r)
+	rep, err := app.generateCTR(r.Context(), day, actor)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("date", body.Date).Msg("regulatory report generation failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.audit(r, auditEntry{
+		Action:     "report.regulatory_generate",
+		TargetType: "regulatory_report",
+		TargetID:   rep.ID,
+		After:      map[string]any{"date": rep.Date, "rows": rep.RowCount},
+	})
+	rep.Rows = nil
+	writeJSON(w, http.StatusCreated, map[string]any{"data": rep})
+}
+
+// GET /v1/admin/reports/regulatory/{date}[?format=csv|xml]
+func (app *App) AdminGetRegulatoryReport(w http.ResponseWriter, r *http.Request) {
+	day, err := time.Parse("2006-01-02", chi.URLParam(r, "date"))
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_date"))
+		return
+	}
+	rep := regulatoryReport{Date: day.Format("2006-01-02")}
+	var raw []byte
+	err = app.DB.QueryRow(r.Context(), `
+		SELECT id, kind, single_threshold, daily_threshold, row_count, rows, generated_by, generated_at
+		FROM regulatory_reports WHERE kind='ctr' AND report_date=$1
+	`, day).Scan(&rep.ID, &rep.Kind, &rep.SingleThreshold, &rep.DailyThreshold, &rep.RowCount, &raw, &rep.GeneratedBy, &rep.GeneratedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "report_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := json.Unmarshal(raw, &rep.Rows); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "decode_error"))
+		return
+	}
+
+	filename := "okies-ctr-" + rep.Date
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		w.WriteHeader(http.StatusOK)
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"report_type", "transaction_id", "transaction_type", "transaction_date",
+			"customer_id", "full_name", "email", "direction", "amount_kobo", "currency", "transaction_count"})
+		for _, c := range rep.Rows {
+			_ = cw.Write([]string{c.ReportType, c.TxID, c.TxKind, c.TxDate.UTC().Format(time.RFC3339),
+				c.UserID, c.FullName, c.Email, c.Direction, strconv.FormatInt(c.Amount, 10), c.Currency,
+				strconv.FormatInt(c.Count, 10)})
+		}
+		cw.Flush()
+	case "xml":
+		doc := struct {
+			XMLName         xml.Name `xml:"CurrencyTransactionReport"`
+			ReportDate      string   `xml:"reportDate,attr"`
+			GeneratedAt     string   `xml:"generatedAt,attr"`
+			SingleThreshold int64    `xml:"singleThresholdKobo,attr"`
+			DailyThreshold  int64    `xml:"dailyThresholdKobo,attr"`
+			Rows            []ctrRow `xml:"Transactions>Transaction"`
+		}{ReportDate: rep.Date, GeneratedAt: rep.GeneratedAt.UTC().Format(time.RFC3339),
+			SingleThreshold: rep.SingleThreshold, DailyThreshold: rep.DailyThreshold, Rows: rep.Rows}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.xml"`)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(xml.Header))
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		_ = enc.Encode(doc)
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"data": rep})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
+)
+
+// maxJSONBody caps JSON request bodies. Nothing the API accepts as JSON
+// comes close; uploads have their own limits.
+const maxJSONBody = 1 << 20
+
+// StrictJSON guards routes that take JSON: bodies over maxJSONBody get 413,
+// and a non-empty body that isn't application/json gets 415. Empty bodies
+// pass, for actions that take none.
+func StrictJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > maxJSONBody {
+			apierror.Write(w, apierror.New(http.StatusRequestEntityTooLarge, "payload_too_large"))
+			return
+		}
+		if r.ContentLength != 0 {
+			mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mt != "application/json" {
+				apierror.Write(w, apierror.New(http.StatusUnsupportedMediaType, "unsupported_media_type"))
+				return
+			}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxJSONBody)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeBody decodes the JSON request body into dst and checks its
+// `validate` tags. Unknown fields and trailing data are rejected. On failure
+// it writes the error response (a 400 naming the offending field where
+// there is one, 413, or validation_failed with per-field details) and
+// returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return decode(w, r, dst, false)
+}
+
+// decodeOptionalBody is decodeBody for endpoints whose body may be omitted;
+// an empty body leaves dst as it is.
+func decodeOptionalBody(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return decode(w, r, dst, true)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, dst any, optional bool) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil && dec.More() {
+		err = errTrailingData
+	}
+	if errors.Is(err, io.EOF) && optional {
+		err = nil
+	}
+	if err != nil {
+		apierror.Write(w, decodeError(err))
+		return false
+	}
+	if err := validate.Struct(dst); err != nil {
+		apierror.Write(w, err)
+		return false
+	}
+	return true
+}
+
+var errTrailingData = errors.New("data after JSON value")
+
+func decodeError(err error) *apierror.Error {
+	var (
+		maxBytes *http.MaxBytesError
+		typeErr  *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &maxBytes):
+		return apierror.New(http.StatusRequestEntityTooLarge, "payload_too_large")
+	case errors.Is(err, io.EOF):
+		return apierror.New(http.StatusBadRequest, "empty_body")
+	case errors.As(err, &typeErr):
+		return apierror.New(http.StatusBadRequest, "invalid_field_type").
+			WithDetails(apierror.FieldError{Field: typeErr.Field, Code: "type", Message: "expected " + typeErr.Type.String()})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for this
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return apierror.New(http.StatusBadRequest, "unknown_field").
+			WithDetails(apierror.FieldError{Field: field, Code: "unknown"})
+	}
+	// syntax errors, truncated bodies, trailing data
+	return apierror.New(http.StatusBadRequest, "invalid_json")
+}
+
+// parsePage reads the limit and cursor of a list request for the list named
+// scope. On a bad value it writes the 400 and returns false.
+func (app *App) parsePage(w http.ResponseWriter, r *http.Request, scope string, b pagination.Bounds) (pagination.Page, bool) {
+	pg, err := app.Pager.Parse(r.URL.Query(), scope, b)
+	switch {
+	case errors.Is(err, pagination.ErrInvalidLimit):
+		apierror.Write(w, apierror.InvalidField("limit"))
+		return pg, false
+	case err != nil:
+		apierror.Write(w, apierror.InvalidField("cursor"))
+		return pg, false
+	}
+	return pg, true
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/redact"
+	"github.com/sudo-init-do/okies-backend/pkg/sentry"
+)
+
+// Request logging. RequestLog puts a logger carrying request_id in the
+// request context and AuthMiddleware adds user_id to it, so anything that
+// logs with log.Ctx(ctx) is correlated with the request. Once the handler
+// returns, the same logger writes one access line per request.
+//
+// Panics and 5xx responses are also reported to the error tracker, with
+// the request's earlier warnings and errors as breadcrumbs. Error logs that
+// carry request_id are kept out of the tracker's log writer (see main.go)
+// so each failed request is reported once.
+
+// responseRecorder captures the status and body size for the access log.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.status == 0 {
+		rr.status = code
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach Flush on the real writer.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter { return rr.ResponseWriter }
+
+// requestScope is what the error report needs from deeper in the request.
+type requestScope struct {
+	mu     sync.Mutex
+	userID string
+	crumbs []sentry.Breadcrumb
+}
+
+type requestScopeKey struct{}
+
+func (s *requestScope) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level < zerolog.WarnLevel || msg == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.crumbs) < 20 {
+		s.crumbs = append(s.crumbs, sentry.Breadcrumb{Timestamp: time.Now().UTC(), Level: level.String(), Category: "log", Message: msg})
+	}
+}
+
+// RequestLog logs each request once it completes and recovers panics into
+// a 500. It must run after RequestIDMiddleware.
+func (app *App) RequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		reqID := reqIDFromCtx(r.Context())
+		scope := &requestScope{}
+		ctx := context.WithValue(r.Context(), requestScopeKey{}, scope)
+		ctx = log.With().Str("request_id", reqID).Logger().Hook(scope).WithContext(ctx)
+		r = r.WithContext(ctx)
+		l := zerolog.Ctx(ctx) // the context's copy, which AuthMiddleware extends
+		rr := &responseRecorder{ResponseWriter: w}
+
+		defer func() {
+			var report *sentry.Event
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				l.Error().Interface("panic", rec).Str("method", r.Method).Str("path", r.URL.Path).Msg("panic recovered")
+				if rr.status == 0 {
+					apierror.Write(rr, apierror.New(http.StatusInternalServerError, "internal_error"))
+				}
+				report = &sentry.Event{Level: sentry.LevelFatal, Exception: &sentry.Exceptions{Values: []sentry.Exception{{
+					Type: "panic", Value: redact.String(fmt.Sprint(rec)), Stacktrace: app.Errors.Stack(2),
+				}}}}
+			}
+			if rr.status == 0 {
+				rr.status = http.StatusOK
+			}
+
+			// the raw path can carry ids and tokens; the pattern can't
+			route := "unmatched"
+			if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+				route = rc.RoutePattern()
+			}
+
+			if report == nil && rr.status >= 500 {
+				report = &sentry.Event{
+					Level:       sentry.LevelError,
+					Message:     fmt.Sprintf("%s %s returned %d", r.Method, route, rr.status),
+					Fingerprint: []string{r.Method, route, fmt.Sprint(rr.status)},
+				}
+			}
+			if report != nil {
+				scope.mu.Lock()
+				report.Tags = map[string]string{"request_id": reqID, "route": route, "status": fmt.Sprint(rr.status)}
+				report.Request = &sentry.Request{Method: r.Method, URL: route}
+				if scope.userID != "" {
+					report.User = &sentry.User{ID: scope.userID}
+				}
+				if len(scope.crumbs) > 0 {
+					report.Breadcrumbs = &sentry.Breadcrumbs{Values: scope.crumbs}
+				}
+				scope.mu.Unlock()
+				app.Errors.Capture(report)
+			}
+
+			var ev *zerolog.Event
+			switch {
+			case rr.status >= 500:
+				ev = l.Error()
+			case rr.status >= 400:
+				ev = l.Warn()
+			default:
+				ev = l.Info()
+			}
+			ev.Str("method", r.Method).
+				Str("route", route).
+				Int("status", rr.status).
+				Dur("duration", time.Since(start)).
+				Int("bytes", rr.bytes).
+				Msg("request")
+		}()
+
+		next.ServeHTTP(rr, r)
+	})
+}
+
+// setLogUser adds user_id to the request's logger, and so to its access
+// line and error report. Outside a request there is no logger of its own
+// to extend.
+func setLogUser(ctx context.Context, userID string) {
+	if l := zerolog.Ctx(ctx); l != zerolog.DefaultContextLogger {
+		l.UpdateContext(func(c zerolog.Context) zerolog.Context { return c.Str("user_id", userID) })
+	}
+	if s, ok := ctx.Value(requestScopeKey{}).(*requestScope); ok {
+		s.mu.Lock()
+		s.userID = userID
+		s.mu.Unlock()
+	}
+}
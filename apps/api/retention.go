@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// Retention policies. Each policy has a count query (dry run) and a purge
+// statement, both taking the cutoff as $1; purges run in batches of
+// retentionBatch so a large backlog doesn't hold long locks.
+
+const retentionBatch = 5000
+
+type retentionPolicy struct {
+	Name        string
+	Description string
+	setting     string // age in days, from pkg/settings
+	count       string
+	purge       string // must touch at most retentionBatch rows per call
+}
+
+var retentionPolicies = []retentionPolicy{
+	{
+		Name:        "webhook_payloads",
+		Description: "Drop raw webhook payload bodies; the event row is kept.",
+		setting:     settings.RetentionWebhookDays,
+		count:       `SELECT COUNT(*) FROM webhook_events WHERE payload IS NOT NULL AND received_at < $1`,
+		purge: `
+			UPDATE webhook_events SET payload = NULL, payload_full = NULL, payload_purged_at = now()
+			WHERE id IN (SELECT id FROM webhook_events WHERE payload IS NOT NULL AND received_at < $1 LIMIT 5000)`,
+	},
+	{
+		Name:        "revoked_refresh_tokens",
+		Description: "Delete refresh tokens that were revoked or expired before the cutoff.",
+		setting:     settings.RetentionRefreshDays,
+		count: `
+			SELECT COUNT(*) FROM refresh_tokens
+			WHERE (revoked_at IS NOT NULL AND revoked_at < $1) OR expires_at < $1`,
+		purge: `
+			DELETE FROM refresh_tokens WHERE id IN (
+			  SELECT id FROM refresh_tokens
+			  WHERE (revoked_at IS NOT NULL AND revoked_at < $1) OR expires_at < $1
+			  LIMIT 5000)`,
+	},
+	{
+		Name:        "provider_responses",
+		Description: "Drop raw provider responses stored on settled payouts.",
+		setting:     settings.RetentionProviderDays,
+		count: `
+			SELECT COUNT(*) FROM payouts
+			WHERE provider_response IS NOT NULL AND updated_at < $1
+			  AND status IN ('succeeded','failed','cancelled','rejected')`,
+		purge: `
+			UPDATE payouts SET provider_response = NULL, provider_response_full = NULL
+			WHERE id IN (
+			  SELECT id FROM payouts
+			  WHERE provider_response IS NOT NULL AND updated_at < $1
+			    AND status IN ('succeeded','failed','cancelled','rejected')
+			  LIMIT 5000)`,
+	},
+	{
+		Name:        "sms_bodies",
+		Description: "Drop the text of sent SMS; delivery status and cost are kept.",
+		setting:     settings.RetentionSMSDays,
+		count:       `SELECT COUNT(*) FROM sms_messages WHERE body IS NOT NULL AND created_at < $1`,
+		purge: `
+			UPDATE sms_messages SET body = NULL
+			WHERE id IN (SELECT id FROM sms_messages WHERE body IS NOT NULL AND created_at < $1 LIMIT 5000)`,
+	},
+	{
+		Name:        "partner_webhook_deliveries",
+		Description: "Delete partner webhook deliveries that were delivered or gave up.",
+		setting:     settings.RetentionPartnerHooks,
+		count:       `SELECT COUNT(*) FROM partner_webhook_deliveries WHERE status <> 'pending' AND created_at < $1`,
+		purge: `
+			DELETE FROM partner_webhook_deliveries
+			WHERE id IN (SELECT id FROM partner_webhook_deliveries WHERE status <> 'pending' AND created_at < $1 LIMIT 5000)`,
+	},
+	{
+		Name:        "security_events",
+		Description: "Delete account security events; they drop out of users' activity trail.",
+		setting:     settings.RetentionSecurityEvents,
+		count:       `SELECT COUNT(*) FROM security_events WHERE created_at < $1`,
+		purge: `
+			DELETE FROM security_events
+			WHERE id IN (SELECT id FROM security_events WHERE created_at < $1 LIMIT 5000)`,
+	},
+}
+
+type retentionResult struct {
+	Policy   string    `json:"policy"`
+	DryRun   bool      `json:"dryRun"`
+	Cutoff   time.Time `json:"cutoff"`
+	Affected int64     `json:"affected"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// runRetention applies every policy (or only counts, when dryRun) and records
+// each outcome in retention_runs. triggeredBy is empty for the scheduler.
+func (app *App) runRetention(ctx context.Context, dryRun bool, triggeredBy string) []retentionResult {
+	out := make([]retentionResult, 0, len(retentionPolicies))
+	for _, p := range retentionPolicies {
+		res := retentionResult{
+			Policy: p.Name,
+			DryRun: dryRun,
+			Cutoff: time.Now().UTC().Add(-app.Settings.Days(ctx, p.setting)),
+		}
+		var err error
+		if dryRun {
+			err = app.DB.QueryRow(ctx, p.count, res.Cutoff).Scan(&res.Affected)
+		} else {
+			for {
+				tag, e := app.DB.Exec(ctx, p.purge, res.Cutoff)
+				if e != nil {
+					err = e
+					break
+				}
+				res.Affected += tag.RowsAffected()
+				if tag.RowsAffected() < retentionBatch {
+					break
+				}
+			}
+		}
+		if err != nil {
+			res.Error = err.Error()
+			log.Ctx(ctx).Error().Err(err).Str("policy", p.Name).Msg("retention policy failed")
+		}
+
+		if _, err := app.DB.Exec(ctx, `
+			INSERT INTO retention_runs (policy, dry_run, cutoff, affected, error, triggered_by)
+			VALUES ($1,$2,$3,$4,NULLIF($5,''),NULLIF($6,'')::uuid)
+		`, res.Policy, res.DryRun, res.Cutoff, res.Affected, res.Error, triggeredBy); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("policy", p.Name).Msg("record retention run failed")
+		}
+		out = append(out, res)
+	}
+	return out
+}
+
+// runRetentionJobs applies retention policies every interval. With
+// retention.enabled off it still records dry runs, so the impact of turning
+// it on is visible first.
+func (app *App) runRetentionJobs(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			dryRun := !app.Settings.Bool(ctx, settings.RetentionEnabled)
+			for _, res := range app.runRetention(ctx, dryRun, "") {
+				if res.Affected > 0 {
+					log.Ctx(ctx).Info().Str("policy", res.Policy).Bool("dry_run", res.DryRun).
+						Int64("affected", res.Affected).Msg("retention applied")
+				}
+			}
+		}
+	}
+}
+
+// ---------- Handlers (Admin) ----------
+
+// GET /v1/admin/retention — policies with current cutoffs and recent runs
+func (app *App) AdminListRetention(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	policies := make([]map[string]any, 0, len(retentionPolicies))
+	for _, p := range retentionPolicies {
+		days := app.Settings.Int64(ctx, p.setting)
+		policies = append(policies, map[string]any{
+			"policy":      p.Name,
+			"description": p.Description,
+			"setting":     p.setting,
+			"days":        days,
+			"cutoff":      time.Now().UTC().AddDate(0, 0, -int(days)),
+		})
+	}
+
+	rows, err := app.DB.Query(ctx, `
+		SELECT policy, dry_run, cutoff, affected, COALESCE(error,''), triggered_by, created_at
+		FROM retention_runs ORDER BY created_at DESC LIMIT 100
+	`)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	type runDTO struct {
+		retentionResult
+		TriggeredBy *string   `json:"triggeredBy,omitempty"`
+		CreatedAt   time.Time `json:"createdAt"`
+	}
+	runs := []runDTO{}
+	for rows.Next() {
+		var d runDTO
+		if err := rows.Scan(&d.Policy, &d.DryRun, &d.Cutoff, &d.Affected, &d.Error, &d.TriggeredBy, &d.CreatedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		runs = append(runs, d)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"enabled":  app.Settings.Bool(ctx, settings.RetentionEnabled),
+		"policies": policies,
+		"runs":     runs,
+	}})
+}
+
+// POST /v1/admin/retention/run  {"dryRun":true}  — defaults to a dry run
+func (app *App) AdminRunRetention(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		DryRun *bool `json:"dryRun"`
+	}{}
+	if !decodeOptionalBody(w, r, &body) {
+		return
+	}
+	dryRun := body.DryRun == nil || *body.DryRun
+
+	actor, _ := getUserID(r)
+	results := app.runRetention(r.Context(), dryRun, actor)
+	if !dryRun {
+		app.audit(r, auditEntry{
+			Action:     "retention.run",
+			TargetType: "retention",
+			After:      results,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": results})
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/cors"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// routes builds the HTTP API: middleware, then every route, v1 and v2.
+func (app *App) routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(cors.AllowAll().Handler)
+	r.Use(RequestIDMiddleware)
+	r.Use(otelhttp.NewMiddleware("http.server"), TraceAnnotateMiddleware)
+
+	// access log, panic recovery and request-scoped loggers; see request_log.go
+	r.Use(app.RequestLog)
+	// injected latency when chaos mode is on; see chaos.go
+	r.Use(app.Chaos.Middleware(chaosExempt))
+
+	// v1 unless a route says otherwise; see versioning.go
+	r.Use(Version(1))
+	// error messages in the client's language; see language.go
+	r.Use(Language)
+	// gzip or brotli for JSON; see http_cache.go
+	r.Use(compressor())
+
+	// Health
+	r.Get("/healthz", app.Healthz)
+	r.Get("/readyz", app.Readyz)
+	r.Get("/metrics", app.PrometheusMetrics)
+
+	// Public webhooks
+	r.With(app.RequireSchema).Post("/v1/webhooks/flutterwave", app.FlutterwaveWebhook)
+	r.Post("/v1/webhooks/sms/termii", app.TermiiWebhook)
+	r.Post("/v1/webhooks/sms/twilio", app.TwilioWebhook)
+	r.With(app.RequireSchema).Post("/v1/webhooks/openbanking/{provider}", app.OpenBankingWebhook)
+
+	// Public reference data
+	r.With(Cacheable(time.Hour, false)).Get("/v1/banks", app.ListBanks)
+	r.With(Cacheable(5*time.Minute, false)).Get("/v1/app-config", app.GetAppConfig)
+	r.With(Cacheable(5*time.Minute, false)).Get("/.well-known/jwks.json", app.JWKS)
+	r.With(app.RateLimit(settings.RateLimitUsernameCheck)).Get("/v1/users/username-available", app.UsernameAvailable)
+
+	// Public auth
+	r.With(app.RateLimit(settings.RateLimitSignup), StrictJSON).Post("/v1/auth/signup", app.Signup)
+	r.With(app.RateLimit(settings.RateLimitLogin), StrictJSON).Post("/v1/auth/login", app.Login)
+	r.With(app.RateLimit(settings.RateLimitLogin), StrictJSON).Post("/v1/auth/identity", app.IdentityLogin)
+	r.With(app.RateLimit(settings.RateLimitRefresh), StrictJSON).Post("/v1/auth/refresh", app.Refresh)
+	r.With(app.RateLimit(settings.RateLimitOTPLogin), StrictJSON).Post("/v1/auth/otp/request", app.RequestLoginOTP)
+	r.With(app.RateLimit(settings.RateLimitOTPLogin), StrictJSON).Post("/v1/auth/otp/verify", app.VerifyLoginOTP)
+	r.With(app.RateLimit(settings.RateLimitOTPLogin), StrictJSON).Post("/v1/auth/reactivate", app.RequestReactivation)
+	r.With(app.RateLimit(settings.RateLimitOTPLogin), StrictJSON).Post("/v1/auth/reactivate/verify", app.VerifyReactivation)
+	r.With(app.RateLimit(settings.RateLimitPasswordReset), StrictJSON).Post("/v1/auth/forgot-password", app.ForgotPassword)
+	r.With(app.RateLimit(settings.RateLimitPasswordReset), StrictJSON).Post("/v1/auth/reset-password", app.ResetPassword)
+
+	// Uploads (not JSON; they set their own size limits)
+	r.Group(func(up chi.Router) {
+		up.Use(app.AuthMiddleware, app.RequireAdmin)
+		up.With(app.RequireSchema, app.RequirePermission(a.PermTopup), app.AdminActionGuard("topup.bulk")).Post("/v1/admin/topups/bulk", app.AdminBulkTopup)
+		up.With(app.RequireSchema, app.RequirePermission(a.PermUsersImport), app.AdminActionGuard("user.import")).Post("/v1/admin/users/import", app.AdminImportUsers)
+	})
+
+	// Protected
+	r.Group(func(pr chi.Router) {
+		pr.Use(app.AuthMiddleware, StrictJSON)
+
+		// self
+		pr.Get("/v1/auth/me", app.Me)
+		pr.Get("/v1/auth/whoami", app.WhoAmI)
+		pr.Post("/v1/auth/logout", app.Logout)
+		pr.Post("/v1/auth/logout-all", app.LogoutAll)
+		pr.With(app.RateLimit(settings.RateLimitStepUp)).Post("/v1/auth/change-password", app.ChangePassword)
+		pr.Get("/v1/auth/sessions", app.ListSessions)
+		pr.Delete("/v1/auth/sessions/{jti}", app.RevokeSession)
+		pr.With(app.RateLimit(settings.RateLimitStepUp)).Post("/v1/auth/step-up/code", app.RequestStepUpCode)
+		pr.With(app.RateLimit(settings.RateLimitStepUp)).Post("/v1/auth/step-up", app.StepUp)
+
+		// real-time events
+		pr.Get("/v1/stream", app.Stream)
+
+		// app start-up in one call; see home.go
+		pr.With(Cacheable(0, true)).Get("/v1/home", app.GetHome)
+
+		// wallet
+		pr.With(Cacheable(0, true)).Get("/v1/wallet", app.GetWallet)
+		pr.With(Deprecated("/v2/wallet/transactions", time.Time{}), Cacheable(0, true)).Get("/v1/wallet/transactions", app.ListWalletTransactions)
+		pr.Get("/v1/wallet/withdrawals", app.ListMyWithdrawals)
+		pr.Get("/v1/wallet/statements", app.ListMyStatements)
+		pr.With(app.RateLimit(settings.RateLimitStatements)).Post("/v1/wallet/statements", app.RequestStatement)
+		pr.Get("/v1/wallet/statements/{id}", app.GetMyStatement)
+
+		// gifting
+		pr.With(app.RequireSchema, app.RateLimit(settings.RateLimitGifts)).Post("/v1/gifts", app.CreateGift)
+		pr.With(Cacheable(0, true)).Get("/v1/gifts/scheduled", app.ListScheduledGifts)
+		pr.Delete("/v1/gifts/scheduled/{id}", app.CancelScheduledGift)
+		pr.Post("/v1/gifts/scheduled/{id}/restore", app.RestoreScheduledGift)
+
+		// users
+		pr.Get("/v1/users/search", app.SearchUsers)
+		pr.Put("/v1/users/me/language", app.SetMyLanguage)
+		pr.Put("/v1/users/me/timezone", app.SetMyTimeZone)
+		pr.Get("/v1/users/me/preferences", app.GetMyPreferences)
+		pr.Put("/v1/users/me/preferences", app.UpdateMyPreferences)
+		pr.Get("/v1/users/me/privacy", app.GetMyPrivacySettings)
+		pr.Put("/v1/users/me/privacy", app.UpdateMyPrivacySettings)
+		pr.Get("/v1/users/me/activity", app.ListMyActivity)
+		pr.Post("/v1/users/me/deactivate", app.DeactivateMe)
+		pr.Delete("/v1/users/me", app.DeleteMe)
+		pr.Put("/v1/users/me/username", app.SetMyUsername)
+		pr.Put("/v1/users/me/display-name", app.SetMyDisplayName)
+		pr.Get("/v1/users/me/qr", app.GetMyQR)
+		pr.With(app.RateLimit(settings.RateLimitPhoneVerify)).Put("/v1/users/me/phone", app.SetMyPhone)
+		pr.With(app.RateLimit(settings.RateLimitPhoneVerify)).Post("/v1/users/me/phone/verify", app.VerifyMyPhone)
+		pr.Delete("/v1/users/me/phone", app.DeleteMyPhone)
+		pr.Post("/v1/qr/resolve", app.ResolveQR)
+		pr.With(app.RateLimit(settings.RateLimitResolve)).Get("/v1/resolve", app.ResolveHandle)
+		pr.Post("/v1/users/me/avatar", app.CreateAvatarUpload)
+		pr.Post("/v1/users/me/avatar/{id}/complete", app.CompleteAvatarUpload)
+		pr.Delete("/v1/users/me/avatar", app.DeleteAvatar)
+		pr.Get("/v1/users/me/identities", app.ListMyIdentities)
+		pr.Post("/v1/users/me/identities", app.LinkMyIdentity)
+		pr.Delete("/v1/users/me/identities/{id}", app.UnlinkMyIdentity)
+
+		// notifications
+		pr.Get("/v1/devices", app.ListDevices)
+		pr.Post("/v1/devices", app.RegisterDevice)
+		pr.Delete("/v1/devices/{id}", app.DeleteDevice)
+		pr.Get("/v1/email-preferences", app.GetEmailPreferences)
+		pr.Put("/v1/email-preferences", app.UpdateEmailPreferences)
+		pr.Get("/v1/notifications", app.ListNotifications)
+		pr.Post("/v1/notifications/{id}/read", app.MarkNotificationRead)
+
+		// support
+		pr.Post("/v1/support/tickets", app.CreateSupportTicket)
+		pr.Get("/v1/support/tickets", app.ListMySupportTickets)
+		pr.Get("/v1/support/tickets/{id}", app.GetMySupportTicket)
+		pr.Post("/v1/support/tickets/{id}/messages", app.AddSupportTicketMessage)
+
+		// referrals
+		pr.Get("/v1/referrals", app.GetReferrals)
+
+		// vouchers
+		pr.Get("/v1/vouchers", app.ListMyVouchers)
+		pr.With(app.RequireSchema).Post("/v1/vouchers", app.CreateVoucher)
+		pr.With(app.RequireSchema, app.RateLimit(settings.RateLimitVoucherRedeem)).Post("/v1/vouchers/redeem", app.RedeemVoucher)
+
+		// payout destinations
+		pr.Get("/v1/payout-destinations", app.ListPayoutDestinations)
+		pr.Post("/v1/payout-destinations", app.CreatePayoutDestination)
+		pr.Delete("/v1/payout-destinations/{id}", app.DeletePayoutDestination)
+		pr.Post("/v1/payout-destinations/{id}/restore", app.RestorePayoutDestination)
+
+		// saved beneficiaries
+		pr.Get("/v1/beneficiaries", app.ListBeneficiaries)
+		pr.Post("/v1/beneficiaries", app.CreateBeneficiary)
+		pr.Put("/v1/beneficiaries/{id}", app.UpdateBeneficiary)
+		pr.Delete("/v1/beneficiaries/{id}", app.DeleteBeneficiary)
+
+		// withdrawals
+		pr.With(app.RequireSchema).Post("/v1/withdrawals", app.CreateWithdrawal)
+
+		// open banking: linked accounts, mandates and direct-debit deposits
+		pr.Get("/v1/bank-links", app.ListBankLinks)
+		pr.Post("/v1/bank-links", app.LinkBankAccount)
+		pr.Delete("/v1/bank-links/{id}", app.UnlinkBankAccount)
+		pr.Get("/v1/bank-links/{id}/balance", app.GetBankLinkBalance)
+		pr.Post("/v1/bank-links/{id}/mandates", app.CreateMandate)
+		pr.Get("/v1/mandates", app.ListMandates)
+		pr.Delete("/v1/mandates/{id}", app.CancelMandate)
+		pr.Get("/v1/deposits/direct-debit", app.ListMyDirectDebits)
+		pr.With(app.RequireSchema).Post("/v1/deposits/direct-debit", app.CreateDirectDebit)
+
+		// admin
+		pr.Group(func(ad chi.Router) {
+			ad.Use(app.RequireAdmin)
+			ad.With(app.RequirePermission(a.PermUsersRead)).Get("/v1/admin/users", app.AdminListUsers)
+			ad.With(app.RequirePermission(a.PermUsersRead)).Get("/v1/admin/users/{id}", app.AdminGetUser)
+			ad.With(app.RequirePermission(a.PermRolesManage), app.AdminActionGuard("user.role")).Put("/v1/admin/users/{id}/role", app.AdminSetUserRole)
+			ad.With(app.RequirePermission(a.PermUsersStatus), app.AdminActionGuard("user.status")).Put("/v1/admin/users/{id}/status", app.AdminSetUserStatus)
+			ad.With(app.RequirePermission(a.PermUsersManage), app.AdminActionGuard("user.rename")).Post("/v1/admin/users/{id}/rename", app.AdminRenameUser)
+			ad.With(app.RequirePermission(a.PermUsersManage)).Get("/v1/admin/name-reviews", app.AdminListNameReviews)
+			ad.With(app.RequirePermission(a.PermUsersManage)).Post("/v1/admin/name-reviews/{id}/approve", app.AdminApproveNameReview)
+			ad.With(app.RequirePermission(a.PermImpersonate), app.AdminActionGuard("user.impersonate")).Post("/v1/admin/users/{id}/impersonate", app.AdminImpersonateUser)
+			ad.With(app.RequireSchema, app.RequirePermission(a.PermUsersMerge), app.AdminActionGuard("user.merge")).Post("/v1/admin/users/{id}/merge", app.AdminMergeUser)
+			ad.With(app.RequirePermission(a.PermDataRequests), app.AdminActionGuard("data_request")).Post("/v1/admin/users/{id}/data-requests", app.AdminCreateDataRequest)
+			ad.With(app.RequirePermission(a.PermDataRequests)).Get("/v1/admin/data-requests", app.AdminListDataRequests)
+			ad.With(app.RequirePermission(a.PermDataRequests)).Get("/v1/admin/data-requests/{id}", app.AdminGetDataRequest)
+			ad.With(app.RequirePermission(a.PermDataRequests)).Get("/v1/admin/data-requests/{id}/export", app.AdminDownloadDataExport)
+			ad.With(app.RequirePermission(a.PermTransactionsRead)).Get("/v1/admin/transactions", app.AdminSearchTransactions)
+			ad.With(app.RequirePermission(a.PermTransactionsRead)).Get("/v1/admin/webhook-events/{id}", app.AdminGetWebhookEvent)
+			ad.With(app.RequirePermission(a.PermPIIRead), app.AdminActionGuard("pii.read")).Get("/v1/admin/webhook-events/{id}/full", app.AdminGetWebhookEventFull)
+			ad.With(app.RequirePermission(a.PermPIIRead), app.AdminActionGuard("pii.read")).Get("/v1/admin/payouts/{id}/provider-response/full", app.AdminGetPayoutProviderResponseFull)
+			ad.With(app.RequireSchema, app.RequirePermission(a.PermTopup), app.AdminActionGuard("topup")).Post("/v1/admin/topups", app.AdminTopup)
+			ad.With(app.RequireSchema, app.RequirePermission(a.PermWithdrawalsAct), app.AdminActionGuard("withdrawal.approve")).Post("/v1/admin/withdrawals/{id}/approve", app.AdminApproveWithdrawal)
+			ad.With(app.RequireSchema, app.RequirePermission(a.PermWithdrawalsAct), app.AdminActionGuard("withdrawal.reject")).Post("/v1/admin/withdrawals/{id}/reject", app.AdminRejectWithdrawal)
+			ad.With(app.RequireSchema, app.RequirePermission(a.PermVouchersManage), app.AdminActionGuard("voucher.create")).Post("/v1/admin/vouchers", app.AdminCreateVoucher)
+			ad.With(app.RequirePermission(a.PermReportsRead)).Get("/v1/admin/vouchers/liability", app.AdminVoucherLiability)
+			ad.With(app.RequirePermission(a.PermReportsRead)).Get("/v1/admin/metrics", app.AdminMetrics)
+			ad.With(app.RequirePermission(a.PermReportsRead)).Get("/v1/admin/float", app.AdminFloat)
+			ad.With(app.RequirePermission(a.PermReportsRead)).Get("/v1/admin/reports/daily", app.AdminDailyReport)
+			ad.With(app.RequirePermission(a.PermReportsRead)).Get("/v1/admin/sms/costs", app.AdminSMSCosts)
+			ad.With(app.RequirePermission(a.PermReportsRead)).Get("/v1/admin/reports/regulatory", app.AdminListRegulatoryReports)
+			ad.With(app.RequirePermission(a.PermReportsGenerate), app.AdminActionGuard("regulatory.generate")).Post("/v1/admin/reports/regulatory", app.AdminGenerateRegulatoryReport)
+			ad.With(app.RequirePermission(a.PermReportsRead)).Get("/v1/admin/reports/regulatory/{date}", app.AdminGetRegulatoryReport)
+			ad.With(app.RequirePermission(a.PermReportsRead)).Get("/v1/admin/accounting/exports", app.AdminListAccountingExports)
+			ad.With(app.RequirePermission(a.PermReportsGenerate), app.AdminActionGuard("accounting.export")).Post("/v1/admin/accounting/exports", app.AdminCreateAccountingExport)
+			ad.With(app.RequirePermission(a.PermReportsRead)).Get("/v1/admin/accounting/exports/{id}", app.AdminGetAccountingExport)
+			ad.With(app.RequirePermission(a.PermReportsRead)).Get("/v1/admin/accounting/exports/{id}/download", app.AdminDownloadAccountingExport)
+			ad.With(app.RequireSchema, app.RequirePermission(a.PermVouchersManage)).Post("/v1/admin/vouchers/sweep", app.AdminSweepVouchers)
+			ad.With(app.RequirePermission(a.PermAuditRead)).Get("/v1/admin/audit-logs", app.AdminListAuditLogs)
+			ad.With(app.RequirePermission(a.PermSettingsManage)).Get("/v1/admin/settings", app.AdminListSettings)
+			ad.With(app.RequirePermission(a.PermSettingsManage)).Put("/v1/admin/settings/{key}", app.AdminUpdateSetting)
+			ad.With(app.RequirePermission(a.PermSettingsManage)).Delete("/v1/admin/settings/{key}", app.AdminResetSetting)
+			ad.With(app.RequirePermission(a.PermSettingsManage)).Get("/v1/admin/retention", app.AdminListRetention)
+			ad.With(app.RequirePermission(a.PermSettingsManage)).Post("/v1/admin/retention/run", app.AdminRunRetention)
+			ad.With(app.RequirePermission(a.PermSettingsManage)).Get("/v1/admin/jobs", app.AdminListJobs)
+			ad.With(app.RequirePermission(a.PermSettingsManage)).Post("/v1/admin/jobs/{id}/retry", app.AdminRetryJob)
+			ad.With(app.RequirePermission(a.PermSettingsManage)).Get("/v1/admin/breakers", app.AdminListBreakers)
+			ad.With(app.RequirePermission(a.PermSettingsManage)).Post("/v1/admin/breakers/{name}/reset", app.AdminResetBreaker)
+			ad.With(app.RequirePermission(a.PermSettingsManage)).Get("/v1/admin/chaos", app.AdminGetChaos)
+			ad.With(app.RequirePermission(a.PermSettingsManage), app.AdminActionGuard("chaos")).Put("/v1/admin/chaos", app.AdminSetChaos)
+			ad.With(app.RequirePermission(a.PermSettingsManage), app.AdminActionGuard("chaos")).Delete("/v1/admin/chaos", app.AdminClearChaos)
+			ad.With(app.RequirePermission(a.PermAdjustPropose)).Post("/v1/admin/adjustments", app.AdminProposeAdjustment)
+			ad.With(app.RequirePermission(a.PermAdjustPropose)).Get("/v1/admin/adjustments", app.AdminListAdjustments)
+			ad.With(app.RequireSchema, app.RequirePermission(a.PermAdjustApprove), app.AdminActionGuard("adjustment.approve")).Post("/v1/admin/adjustments/{id}/approve", app.AdminApproveAdjustment)
+			ad.With(app.RequirePermission(a.PermAdjustApprove)).Post("/v1/admin/adjustments/{id}/reject", app.AdminRejectAdjustment)
+			ad.With(app.RequirePermission(a.PermFraudRead)).Get("/v1/admin/fraud/cases", app.AdminListFraudCases)
+			ad.With(app.RequirePermission(a.PermFraudRead)).Get("/v1/admin/fraud/cases/{id}", app.AdminGetFraudCase)
+			ad.With(app.RequireSchema, app.RequirePermission(a.PermFraudReview)).Post("/v1/admin/fraud/cases/{id}/clear", app.AdminClearFraudCase)
+			ad.With(app.RequireSchema, app.RequirePermission(a.PermFraudReview)).Post("/v1/admin/fraud/cases/{id}/action", app.AdminActionFraudCase)
+			ad.With(app.RequirePermission(a.PermFraudRead)).Get("/v1/admin/fraud/rules", app.AdminListFraudRules)
+			ad.With(app.RequirePermission(a.PermFraudReview)).Put("/v1/admin/fraud/rules/{id}", app.AdminUpdateFraudRule)
+			ad.With(app.RequirePermission(a.PermFraudReview), app.AdminActionGuard("user.unfreeze")).Post("/v1/admin/users/{id}/unfreeze", app.AdminUnfreezeUser)
+			ad.With(app.RequirePermission(a.PermSupportTickets)).Get("/v1/admin/support/tickets", app.AdminListSupportTickets)
+			ad.With(app.RequirePermission(a.PermSupportTickets)).Get("/v1/admin/support/tickets/{id}", app.AdminGetSupportTicket)
+			ad.With(app.RequirePermission(a.PermSupportTickets)).Post("/v1/admin/support/tickets/{id}/messages", app.AdminReplySupportTicket)
+			ad.With(app.RequirePermission(a.PermSupportTickets)).Post("/v1/admin/support/tickets/{id}/resolve", app.AdminResolveSupportTicket)
+			ad.With(app.RequirePermission(a.PermFraudRead)).Get("/v1/admin/blacklist", app.AdminListBlacklist)
+			ad.With(app.RequirePermission(a.PermFraudReview)).Post("/v1/admin/blacklist", app.AdminCreateBlacklistEntry)
+			ad.With(app.RequirePermission(a.PermFraudReview), app.AdminActionGuard("blacklist.delete")).Delete("/v1/admin/blacklist/{id}", app.AdminDeleteBlacklistEntry)
+			ad.With(app.RequirePermission(a.PermPartnersManage)).Get("/v1/admin/partners", app.AdminListPartners)
+			ad.With(app.RequirePermission(a.PermPartnersManage), app.AdminActionGuard("partner.create")).Post("/v1/admin/partners", app.AdminCreatePartner)
+			ad.With(app.RequirePermission(a.PermPartnersManage)).Delete("/v1/admin/partners/{id}", app.AdminRevokePartner)
+			ad.With(app.RequirePermission(a.PermPartnersManage)).Get("/v1/admin/partners/{id}/webhook-deliveries", app.AdminListPartnerWebhookDeliveries)
+			ad.With(app.RequirePermission(a.PermPartnersManage)).Get("/v1/admin/partners/{id}/clients", app.AdminListPartnerClients)
+			ad.With(app.RequirePermission(a.PermPartnersManage), app.AdminActionGuard("partner_client.create")).Post("/v1/admin/partners/{id}/clients", app.AdminCreatePartnerClient)
+			ad.With(app.RequirePermission(a.PermPartnersManage)).Delete("/v1/admin/partners/{id}/clients/{clientId}", app.AdminRevokePartnerClient)
+			ad.With(app.RequirePermission(a.PermPartnersManage)).Post("/v1/admin/webhook-deliveries/{id}/redeliver", app.AdminRedeliverPartnerWebhook)
+		})
+	})
+
+	// Partners (API key or OAuth token), acting as their account; see partners.go
+	r.With(app.RateLimit(settings.RateLimitOAuthToken)).Post("/v1/oauth/token", app.OAuthToken)
+	r.Group(func(pt chi.Router) {
+		pt.Use(app.PartnerAuth, StrictJSON)
+		pt.With(RequireScope(a.ScopeWalletRead), Cacheable(0, true)).Get("/v1/partner/wallet", app.GetWallet)
+		pt.With(RequireScope(a.ScopeWalletRead), Cacheable(0, true)).Get("/v1/partner/wallet/transactions", app.ListWalletTransactions)
+		pt.With(RequireScope(a.ScopeGiftsWrite), app.RequireSchema, app.RateLimit(settings.RateLimitGifts)).Post("/v1/partner/gifts", app.CreateGift)
+		pt.With(RequireScope(a.ScopeVouchersWrite)).Get("/v1/partner/vouchers", app.ListMyVouchers)
+		pt.With(RequireScope(a.ScopeVouchersWrite), app.RequireSchema).Post("/v1/partner/vouchers", app.CreateVoucher)
+		pt.With(RequireScope(a.ScopeWebhooksManage)).Get("/v1/partner/webhooks", app.PartnerListWebhooks)
+		pt.With(RequireScope(a.ScopeWebhooksManage)).Post("/v1/partner/webhooks", app.PartnerCreateWebhook)
+		pt.With(RequireScope(a.ScopeWebhooksManage)).Delete("/v1/partner/webhooks/{id}", app.PartnerDeleteWebhook)
+		pt.With(RequireScope(a.ScopeWebhooksManage)).Post("/v1/partner/webhooks/{id}/rotate-secret", app.PartnerRotateWebhookSecret)
+		pt.With(RequireScope(a.ScopeWebhooksManage)).Get("/v1/partner/webhooks/{id}/deliveries", app.PartnerListWebhookDeliveries)
+	})
+
+	// Version 2
+	r.Route("/v2", app.mountV2)
+
+	return r
+}
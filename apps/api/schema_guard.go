@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	mydb "github.com/sudo-init-do/okies-backend/pkg/db"
+)
+
+// moneySchema is what the ledger, payout, gift, voucher and webhook paths
+// read and write. A database missing any of it (a skipped or half-applied
+// migration, a restore from an old dump) would fail those paths part way, so
+// they refuse to run instead.
+var moneySchema = mydb.Schema{
+	"users":               {"id", "email", "role", "status", "frozen_at", "token_version"},
+	"wallets":             {"id", "user_id"},
+	"transactions":        {"id", "idempotency_key", "kind", "amount", "currency", "metadata"},
+	"ledger_entries":      {"tx_id", "wallet_id", "direction", "amount"},
+	"payouts":             {"id", "user_id", "destination_id", "amount", "currency", "status", "reference", "provider_response", "provider_response_full", "provider_event_at", "updated_at"},
+	"payout_destinations": {"id", "user_id", "bank_code", "account_number", "account_number_hash", "account_last4", "account_name", "is_default", "bvn", "bvn_hash", "deleted_at"},
+	"payout_approvals":    {"payout_id", "approver_id", "approver_role"},
+	"held_gifts":          {"id", "sender_id", "recipient_id", "amount", "hold_tx_id", "settle_tx_id", "status"},
+	"scheduled_gifts":     {"id", "sender_id", "recipient_id", "amount", "idempotency_key", "scheduled_at", "status", "gift_id", "deleted_at"},
+	"vouchers":            {"id", "code_hash", "issuer_user_id", "amount", "remaining", "status", "expires_at"},
+	"webhook_events":      {"id", "provider", "event", "reference", "payload", "payload_full", "provider_at", "processed_at"},
+	"jobs":                {"id", "kind", "payload", "status", "run_at", "attempts", "max_attempts", "unique_key"},
+}
+
+// schemaState is the outcome of the last schema check.
+type schemaState struct {
+	OK         bool                `json:"ok"`
+	Migrations mydb.MigrationState `json:"migrations"`
+	Missing    []string            `json:"missing,omitempty"`
+	CheckedAt  time.Time           `json:"checkedAt"`
+}
+
+// checkSchema compares the database with what this binary expects and
+// records the result. A database migrated past this binary is fine, as
+// during a rolling deploy; one behind it, dirty, or missing columns is not.
+// When the check itself fails the previous result stands.
+func (app *App) checkSchema(ctx context.Context) (*schemaState, error) {
+	mig, err := mydb.Migrations(ctx, app.DB)
+	if err != nil {
+		return nil, err
+	}
+	missing, err := mydb.SchemaDrift(ctx, app.DB, moneySchema)
+	if err != nil {
+		return nil, err
+	}
+	st := &schemaState{
+		OK:         !mig.Dirty && !mig.Pending() && len(missing) == 0,
+		Migrations: mig,
+		Missing:    missing,
+		CheckedAt:  time.Now().UTC(),
+	}
+	app.schema.Store(st)
+	v := 0.0
+	if !st.OK {
+		v = 1
+	}
+	gauges.Set("okies_schema_drift", "Whether the database schema is behind or missing what this binary expects.", v)
+	return st, nil
+}
+
+// schemaOK reports whether money may move. Before any check has run (tests,
+// or a boot that couldn't reach the database) it doesn't block.
+func (app *App) schemaOK() bool {
+	st := app.schema.Load()
+	return st == nil || st.OK
+}
+
+// runSchemaGuard rechecks the schema every interval, alerting when it
+// drifts and logging when it recovers, e.g. after `api migrate up`.
+func (app *App) runSchemaGuard(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	ok := true // so drift found at boot is alerted on the first tick
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		st, err := app.checkSchema(ctx)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("schema check failed")
+			continue
+		}
+		switch {
+		case !st.OK && ok:
+			app.raiseAlert(ctx, alert{
+				Name:     "schema_drift",
+				Severity: "critical",
+				Message:  "database schema does not match this binary; money-moving endpoints are refusing requests",
+				Fields: map[string]any{
+					"current": st.Migrations.Current,
+					"latest":  st.Migrations.Latest,
+					"dirty":   st.Migrations.Dirty,
+					"missing": st.Missing,
+				},
+			})
+		case st.OK && !ok:
+			log.Ctx(ctx).Info().Uint("version", st.Migrations.Current).Msg("schema drift resolved")
+		}
+		ok = st.OK
+	}
+}
+
+// waitForSchema blocks until the schema checks out or ctx ends, so a worker
+// started ahead of its migration doesn't run payout jobs against it.
+func (app *App) waitForSchema(ctx context.Context, interval time.Duration) bool {
+	for {
+		if st, err := app.checkSchema(ctx); err == nil && st.OK {
+			return true
+		} else if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("schema check failed")
+		} else {
+			log.Ctx(ctx).Error().Interface("schema", st).Msg("schema drift; worker waiting for migrations")
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(interval):
+		}
+	}
+}
+
+// RequireSchema refuses a money-moving request with 503 while the schema
+// has drifted.
+func (app *App) RequireSchema(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.schemaOK() {
+			apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "schema_drift"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *App) checkSchemaHealth() healthCheck {
+	return healthCheck{name: "schema", critical: true, run: func(ctx context.Context) (any, bool, error) {
+		st := app.schema.Load()
+		if st == nil {
+			return nil, true, nil
+		}
+		if !st.OK {
+			return st, false, errSchemaDrift
+		}
+		return st, false, nil
+	}}
+}
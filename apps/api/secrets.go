@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	"github.com/sudo-init-do/okies-backend/pkg/secrets"
+	"github.com/sudo-init-do/okies-backend/pkg/signing"
+)
+
+// Secrets that can be rotated without a restart, by file name in
+// SECRETS_DIR; see pkg/secrets.
+const (
+	secretJWT                    = "JWT_SECRET"
+	secretJWTPrevious            = "JWT_PREVIOUS_SECRETS"
+	secretJWTPrivateKeys         = "JWT_PRIVATE_KEYS"
+	secretFLWKey                 = "FLW_SEC_KEY"
+	secretFLWWebhookHash         = "FLW_WEBHOOK_HASH"
+	secretFLWWebhookHashPrevious = "FLW_WEBHOOK_HASH_PREVIOUS"
+	secretSigningKeys            = "SIGNING_KEYS"
+)
+
+const secretsPollInterval = 30 * time.Second
+
+// newSecretStore starts from the configured values; files in SECRETS_DIR
+// override them.
+func newSecretStore(cfg *config.Config) (*secrets.Store, error) {
+	return secrets.New(cfg.SecretsDir, map[string]string{
+		secretJWT:                    string(cfg.JWTSecret),
+		secretJWTPrevious:            string(bytes.Join(cfg.JWTPreviousSecrets, []byte(","))),
+		secretJWTPrivateKeys:         cfg.JWTPrivateKeys,
+		secretFLWKey:                 cfg.Flutterwave.SecretKey,
+		secretFLWWebhookHash:         cfg.Flutterwave.WebhookHash,
+		secretFLWWebhookHashPrevious: cfg.Flutterwave.WebhookHashPrevious,
+		secretSigningKeys:            cfg.SigningKeys,
+	})
+}
+
+// jwtSecrets returns the current and previous JWT secrets from s.
+func jwtSecrets(s *secrets.Store) ([]byte, [][]byte) {
+	return []byte(s.Get(secretJWT)), config.SplitSecrets(s.Get(secretJWTPrevious))
+}
+
+// internalSigningKeys returns the keys that sign calls to internal
+// services. A malformed rotated value signs nothing rather than failing
+// every call.
+func internalSigningKeys(s *secrets.Store) []signing.Key {
+	keys, err := signing.ParseKeys(s.Get(secretSigningKeys))
+	if err != nil {
+		log.Error().Err(err).Msg("SIGNING_KEYS is malformed; internal calls go unsigned")
+		return nil
+	}
+	return keys
+}
+
+// applySecrets puts rotated secrets into use. Webhook hashes and signing
+// keys are read from the store on every use and need nothing here.
+func (app *App) applySecrets(ctx context.Context, changed []string) {
+	if slices.Contains(changed, secretJWT) || slices.Contains(changed, secretJWTPrevious) {
+		current, previous := jwtSecrets(app.Secrets)
+		switch {
+		case len(current) == 0:
+			log.Ctx(ctx).Error().Msg("rotated JWT_SECRET is empty; keeping the previous keys")
+		case app.Config.Production() && len(current) < 32:
+			log.Ctx(ctx).Error().Msg("rotated JWT_SECRET is shorter than 32 bytes; keeping the previous keys")
+		default:
+			app.JWT.Set(current, previous...)
+			log.Ctx(ctx).Info().Int("previous", len(previous)).Msg("JWT keys rotated")
+		}
+	}
+	if slices.Contains(changed, secretJWTPrivateKeys) {
+		keys, err := a.ParsePrivateKeys(app.Secrets.Get(secretJWTPrivateKeys))
+		if err == nil {
+			err = app.JWT.SetPrivateKeys(keys...)
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("rotated JWT_PRIVATE_KEYS is invalid; keeping the previous keys")
+		} else {
+			log.Ctx(ctx).Info().Int("keys", len(keys)).Msg("JWT private keys rotated")
+		}
+	}
+	if slices.Contains(changed, secretFLWKey) {
+		key := app.Secrets.Get(secretFLWKey)
+		if f, ok := app.Flutterwave.(interface{ setSecretKey(string) }); ok && key != "" {
+			f.setSecretKey(key)
+			log.Ctx(ctx).Info().Msg("flutterwave secret key rotated")
+		} else {
+			// a dry-run client isn't swapped for a live one in flight
+			log.Ctx(ctx).Warn().Msg("FLW_SEC_KEY changed but the running client can't take it; restart to apply")
+		}
+	}
+}
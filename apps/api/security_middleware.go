@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"net/http"
-	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // unique key type for request-id in context; avoids clashing with other files
@@ -28,6 +30,23 @@ func RequestIDMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// TraceAnnotateMiddleware names the server span after the matched chi route
+// (known only once routing is done) and tags it with the request ID, so
+// traces can be found from a request ID in logs or a support ticket.
+func TraceAnnotateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(attribute.String("request.id", reqIDFromCtx(r.Context())))
+		next.ServeHTTP(w, r)
+		if rc := chi.RouteContext(r.Context()); rc != nil {
+			if p := rc.RoutePattern(); p != "" {
+				span.SetName(r.Method + " " + p)
+				span.SetAttributes(semconv.HTTPRoute(p))
+			}
+		}
+	})
+}
+
 // SecurityHeadersMiddleware sets a safe baseline of security headers.
 func SecurityHeadersMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -40,22 +59,6 @@ func SecurityHeadersMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// ----- tiny helpers: status capture + ctx getter -----
-
-type statusWriter struct {
-	http.ResponseWriter
-	status int
-}
-
-func (w *statusWriter) WriteHeader(code int) {
-	w.status = code
-	w.ResponseWriter.WriteHeader(code)
-}
-
-func wrapWriter(w http.ResponseWriter) *statusWriter {
-	return &statusWriter{ResponseWriter: w, status: http.StatusOK}
-}
-
 func reqIDFromCtx(ctx context.Context) string {
 	if v := ctx.Value(reqIDKey); v != nil {
 		if s, ok := v.(string); ok {
@@ -64,20 +67,3 @@ func reqIDFromCtx(ctx context.Context) string {
 	}
 	return ""
 }
-
-// AccessLogMiddleware logs a concise structured access log per request.
-func AccessLogMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		ww := wrapWriter(w)
-		next.ServeHTTP(ww, r)
-
-		log.Info().
-			Str("req_id", reqIDFromCtx(r.Context())).
-			Str("method", r.Method).
-			Str("path", r.URL.Path).
-			Int("status", ww.status).
-			Dur("duration", time.Since(start)).
-			Msg("http_request")
-	})
-}
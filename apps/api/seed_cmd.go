@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	mydb "github.com/sudo-init-do/okies-backend/pkg/db"
+	"github.com/sudo-init-do/okies-backend/pkg/envelope"
+)
+
+const seedUsage = `usage: api seed [-password P] [-no-migrate]
+
+Fills a development database with the system account, admin logins for each
+role, demo users with funded wallets, gifts between them and withdrawals in
+a few states. Safe to run again: existing rows are left alone. Refused when
+APP_ENV=production.`
+
+// every seeded transaction's idempotency key starts with this, so reruns
+// find what earlier runs created
+const seedKeyPrefix = "seed:"
+
+const seedFundingKobo = 50_000_00
+
+type seedUser struct {
+	Email, Username, DisplayName, Role string
+}
+
+var seedAdmins = []seedUser{
+	{"admin@okies.local", "admin", "Demo Superadmin", a.RoleSuperadmin},
+	{"finance@okies.local", "finance", "Demo Finance", a.RoleFinance},
+	{"support@okies.local", "support", "Demo Support", a.RoleSupport},
+}
+
+var seedUsers = []seedUser{
+	{"ada@demo.okies.local", "ada", "Ada Obi", a.RoleUser},
+	{"bayo@demo.okies.local", "bayo", "Bayo Adeyemi", a.RoleUser},
+	{"chidi@demo.okies.local", "chidi", "Chidi Nwosu", a.RoleUser},
+	{"dayo@demo.okies.local", "dayo", "Dayo Bello", a.RoleUser},
+	{"emeka@demo.okies.local", "emeka", "Emeka Eze", a.RoleUser},
+}
+
+// runSeedCommand implements `api seed` and returns the exit code.
+func runSeedCommand(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, seedUsage) }
+	password := fs.String("password", "okies-dev-password", "password for every seeded login")
+	noMigrate := fs.Bool("no-migrate", false, "skip applying pending migrations first")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if cfg.Production() {
+		fmt.Fprintln(os.Stderr, "seed: refusing to seed a production database")
+		return 1
+	}
+	if !*noMigrate {
+		if err := mydb.MigrateUp(cfg.DatabaseURL); err != nil {
+			fmt.Fprintln(os.Stderr, "seed: migrate:", err)
+			return 1
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	pool, err := mydb.OpenPool(ctx, cfg.DatabaseURL, poolOptions(cfg.DBPool))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "seed:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	sealer, err := newSealer(cfg.Encryption)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "seed:", err)
+		return 1
+	}
+
+	if err := seed(ctx, pool, sealer, *password); err != nil {
+		fmt.Fprintln(os.Stderr, "seed:", err)
+		return 1
+	}
+	fmt.Printf("\nlog in with any of the emails above and password %q\n", *password)
+	return 0
+}
+
+func seed(ctx context.Context, db *pgxpool.Pool, sealer *envelope.Sealer, password string) error {
+	hash, err := a.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, sysWallet, err := seedSystemAccount(ctx, db)
+	if err != nil {
+		return fmt.Errorf("system account: %w", err)
+	}
+	fmt.Println("system account  system@okies.local")
+
+	for _, u := range seedAdmins {
+		if _, _, err := seedAccount(ctx, db, u, hash); err != nil {
+			return fmt.Errorf("%s: %w", u.Email, err)
+		}
+		fmt.Printf("%-15s %s\n", u.Role, u.Email)
+	}
+
+	wallets := make(map[string]string, len(seedUsers))
+	userIDs := make(map[string]string, len(seedUsers))
+	for _, u := range seedUsers {
+		uid, wid, err := seedAccount(ctx, db, u, hash)
+		if err != nil {
+			return fmt.Errorf("%s: %w", u.Email, err)
+		}
+		userIDs[u.Username], wallets[u.Username] = uid, wid
+
+		if err := seedTransfer(ctx, db, "topup", seedKeyPrefix+"topup:"+u.Username, sysWallet, wid, seedFundingKobo); err != nil {
+			return fmt.Errorf("fund %s: %w", u.Email, err)
+		}
+		fmt.Printf("%-15s %s  (funded with NGN %d)\n", u.Role, u.Email, seedFundingKobo/100)
+	}
+
+	// a ring of gifts, so every demo user has history on both sides
+	for i, from := range seedUsers {
+		to := seedUsers[(i+1)%len(seedUsers)]
+		amount := int64(1_000_00 * (i + 1))
+		key := fmt.Sprintf("%sgift:%s:%s", seedKeyPrefix, from.Username, to.Username)
+		if err := seedTransfer(ctx, db, "gift", key, wallets[from.Username], wallets[to.Username], amount); err != nil {
+			return fmt.Errorf("gift %s -> %s: %w", from.Username, to.Username, err)
+		}
+	}
+	fmt.Printf("%d gifts\n", len(seedUsers))
+
+	// withdrawals awaiting review, paid out, and failed then refunded
+	withdrawals := []struct {
+		user   string
+		amount int64
+		status string
+	}{
+		{"ada", 5_000_00, "pending"},
+		{"bayo", 7_500_00, "succeeded"},
+		{"chidi", 2_000_00, "failed"},
+	}
+	for i, wd := range withdrawals {
+		dest, err := seedDestination(ctx, db, sealer, userIDs[wd.user], fmt.Sprintf("00000000%02d", i+1))
+		if err != nil {
+			return fmt.Errorf("destination for %s: %w", wd.user, err)
+		}
+		if err := seedWithdrawal(ctx, db, userIDs[wd.user], wallets[wd.user], sysWallet, dest, wd.amount, wd.status); err != nil {
+			return fmt.Errorf("withdrawal for %s: %w", wd.user, err)
+		}
+	}
+	fmt.Printf("%d withdrawals\n", len(withdrawals))
+	return nil
+}
+
+// seedSystemAccount makes sure the treasury account every ledger movement
+// in and out of the platform goes through exists, and returns its wallet.
+func seedSystemAccount(ctx context.Context, db *pgxpool.Pool) (string, string, error) {
+	return seedAccount(ctx, db, seedUser{"system@okies.local", "system", "System Account", a.RoleSuperadmin}, "")
+}
+
+// seedAccount creates u with a wallet unless the email is taken, and
+// returns the user and wallet ids. Existing users keep their password and
+// role.
+func seedAccount(ctx context.Context, db *pgxpool.Pool, u seedUser, hash string) (string, string, error) {
+	var uid, wid string
+	err := db.QueryRow(ctx, `
+		INSERT INTO users (email, password_hash, role, username, display_name)
+		VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email
+		RETURNING id
+	`, u.Email, hash, u.Role, u.Username, u.DisplayName).Scan(&uid)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := db.Exec(ctx, `
+		INSERT INTO wallets (user_id, balance)
+		SELECT $1, 0 WHERE NOT EXISTS (SELECT 1 FROM wallets WHERE user_id=$1)
+	`, uid); err != nil {
+		return "", "", err
+	}
+	err = db.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id=$1 ORDER BY created_at LIMIT 1`, uid).Scan(&wid)
+	return uid, wid, err
+}
+
+// seedTransfer moves amount from one wallet to another as one transaction,
+// once per key.
+func seedTransfer(ctx context.Context, db *pgxpool.Pool, kind, key, fromWallet, toWallet string, amount int64) error {
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		_, err := seedLedger(ctx, tx, kind, key, fromWallet, toWallet, amount)
+		return err
+	})
+}
+
+// seedLedger writes a transaction and its two ledger entries unless key was
+// used before. It returns the transaction id, or "" when it already existed.
+func seedLedger(ctx context.Context, tx pgx.Tx, kind, key, fromWallet, toWallet string, amount int64) (string, error) {
+	var txID string
+	err := tx.QueryRow(ctx, `
+		INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+		VALUES ($1,$2,$3,'NGN','{"seed":true}'::jsonb)
+		ON CONFLICT (idempotency_key) DO NOTHING
+		RETURNING id
+	`, key, kind, amount).Scan(&txID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+		VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+	`, txID, fromWallet, amount, toWallet)
+	return txID, err
+}
+
+func seedDestination(ctx context.Context, db *pgxpool.Pool, sealer *envelope.Sealer, userID, accountNumber string) (string, error) {
+	sealed, err := sealDestination(ctx, sealer, accountNumber, nil)
+	if err != nil {
+		return "", err
+	}
+	var id string
+	err = db.QueryRow(ctx, `
+		INSERT INTO payout_destinations (id, user_id, bank_code, account_number, account_number_hash, account_last4, account_name, is_default)
+		SELECT gen_random_uuid(), $1, '058', $2, $3, $4, display_name, TRUE FROM users WHERE id=$1
+		ON CONFLICT (user_id, bank_code, account_number_hash) WHERE deleted_at IS NULL DO UPDATE SET account_name = EXCLUDED.account_name
+		RETURNING id
+	`, userID, sealed.AccountNumber, sealed.AccountHash, sealed.AccountLast4).Scan(&id)
+	return id, err
+}
+
+// seedWithdrawal reserves the amount like CreateWithdrawal does and records
+// the payout in the given state: a succeeded one gets a provider response,
+// a failed one its refund.
+func seedWithdrawal(ctx context.Context, db *pgxpool.Pool, userID, userWallet, sysWallet, destID string, amount int64, status string) error {
+	reference := seedKeyPrefix + "withdrawal:" + userID
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		txID, err := seedLedger(ctx, tx, "withdrawal_reserve", reference, userWallet, sysWallet, amount)
+		if err != nil || txID == "" {
+			return err
+		}
+		var resp *string
+		switch status {
+		case "succeeded":
+			s := `{"status":"success","data":{"status":"SUCCESSFUL","reference":"` + reference + `"}}`
+			resp = &s
+		case "failed":
+			if _, err := seedLedger(ctx, tx, "withdrawal_refund", reference+":refund", sysWallet, userWallet, amount); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO payouts (id, user_id, destination_id, amount, status, reference, provider_response, provider_response_full)
+			VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6::jsonb, $6::jsonb)
+		`, userID, destID, amount, status, reference, resp)
+		return err
+	})
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// Sessions. A session is a refresh token row; signing out revokes it. Access
+// tokens are short-lived and checked without the database, so the one a
+// user signs out with is also denied in Redis until it would have expired.
+// Without Redis it stays usable until then. Signing out everywhere bumps the
+// user's token version instead, which AuthMiddleware checks against the
+// version each access token was issued under.
+
+// newOpaqueToken returns a random token to hand out once. Store only
+// hashOpaqueToken of it.
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// session identifies a chain of refresh tokens from sign-in; each link
+// and the access token issued with it carry its ID.
+type session struct {
+	ID        string
+	StartedAt time.Time
+}
+
+func revokedAccessKey(jti string) string  { return "auth:revoked:" + jti }
+func revokedSessionKey(sid string) string { return "auth:revoked-session:" + sid }
+
+// revokeAccessToken denies the access token with claims until it expires.
+func (app *App) revokeAccessToken(ctx context.Context, claims *AccessClaims) {
+	if app.Redis == nil || claims == nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return
+	}
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return
+	}
+	if err := app.Redis.Set(ctx, revokedAccessKey(claims.ID), 1, ttl).Err(); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", claims.Subject).Msg("revoke access token failed")
+	}
+}
+
+// revokeSessionAccess denies the access tokens issued to session sid until
+// the longest-lived of them expires.
+func (app *App) revokeSessionAccess(ctx context.Context, sid string) {
+	if app.Redis == nil || sid == "" {
+		return
+	}
+	ttl := app.Settings.Minutes(ctx, settings.AccessTokenTTLMinutes)
+	if err := app.Redis.Set(ctx, revokedSessionKey(sid), 1, ttl).Err(); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("session_id", sid).Msg("revoke session access tokens failed")
+	}
+}
+
+// accessRevoked reports whether the access token with claims, or the
+// session it was issued to, was revoked. Tokens issued before they carried
+// an ID can't be, and a Redis failure lets the token through rather than
+// signing everyone out.
+func (app *App) accessRevoked(ctx context.Context, claims *AccessClaims) bool {
+	var keys []string
+	if claims.ID != "" {
+		keys = append(keys, revokedAccessKey(claims.ID))
+	}
+	if claims.Sid != "" {
+		keys = append(keys, revokedSessionKey(claims.Sid))
+	}
+	if app.Redis == nil || len(keys) == 0 {
+		return false
+	}
+	n, err := app.Redis.Exists(ctx, keys...).Result()
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("access token revocation check failed")
+		return false
+	}
+	return n > 0
+}
+
+// getAccessClaims returns the claims of the request's access token.
+func getAccessClaims(r *http.Request) *AccessClaims {
+	c, _ := r.Context().Value(ctxClaims).(*AccessClaims)
+	return c
+}
+
+// POST /v1/auth/logout  {"refreshToken":"..."} or {"jti":"..."}
+// Revokes the refresh token and the access token the request is made with.
+func (app *App) Logout(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+		JTI          string `json:"jti" validate:"omitempty,uuid"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	jti := strings.TrimSpace(body.JTI)
+	if tok := strings.TrimSpace(body.RefreshToken); tok != "" {
+		// an expired refresh token is still worth revoking: signing out
+		// shouldn't fail because the app held on to a stale one
+		claims, err := a.ParseRefresh(app.JWT, tok, jwt.WithoutClaimsValidation())
+		if err != nil || claims.ID == "" {
+			apierror.Write(w, apierror.New(http.StatusUnauthorized, "invalid_refresh"))
+			return
+		}
+		jti = claims.ID
+	}
+	if jti == "" {
+		apierror.Write(w, apierror.InvalidField("refreshToken"))
+		return
+	}
+
+	ctx := r.Context()
+	// scoped to the caller, so one user can't end another's session
+	tag, err := app.DB.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = now()
+		WHERE jti = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, jti, uid)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("revoke refresh token failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.revokeAccessToken(ctx, getAccessClaims(r))
+	if tag.RowsAffected() > 0 {
+		app.recordSecurityEvent(r, uid, secLogout, nil)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /v1/auth/logout-all
+// Revokes every session the user has, including the one making the request.
+func (app *App) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	ctx := r.Context()
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	n, err := revokeAllSessions(ctx, tx, uid)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("revoke all sessions failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	app.invalidateUser(ctx, uid)
+	app.recordSecurityEvent(r, uid, secLogoutAll, map[string]any{"sessions": n})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"sessionsRevoked": n}})
+}
+
+// revokeAllSessions revokes userID's refresh tokens and bumps their token
+// version, returning how many sessions were open. Invalidate the cached
+// user once tx commits.
+func revokeAllSessions(ctx context.Context, tx pgx.Tx, userID string) (int64, error) {
+	tag, err := tx.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET token_version = token_version + 1 WHERE id = $1`, userID); err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+type sessionDTO struct {
+	ID         string     `json:"id"` // the jti of its current refresh token
+	UserAgent  *string    `json:"userAgent"`
+	IP         *string    `json:"ip"`
+	StartedAt  time.Time  `json:"startedAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"` // last refresh; null if never refreshed
+	ExpiresAt  time.Time  `json:"expiresAt"`
+}
+
+// GET /v1/auth/sessions
+// The user's signed-in devices, most recently used first.
+func (app *App) ListSessions(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT jti, user_agent, ip, COALESCE(started_at, created_at), last_used_at, expires_at
+		FROM refresh_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		ORDER BY COALESCE(last_used_at, created_at) DESC, id
+	`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	out := []sessionDTO{}
+	for rows.Next() {
+		var d sessionDTO
+		if err := rows.Scan(&d.ID, &d.UserAgent, &d.IP, &d.StartedAt, &d.LastUsedAt, &d.ExpiresAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, d)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// DELETE /v1/auth/sessions/{jti}
+// Signs a device out, refusing its access token as well. Without Redis
+// that keeps working until it expires, minutes at most.
+func (app *App) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	jti := strings.TrimSpace(chi.URLParam(r, "jti"))
+	var userAgent *string
+	var sid string
+	err := app.DB.QueryRow(r.Context(), `
+		UPDATE refresh_tokens SET revoked_at = now()
+		WHERE jti::text = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > now()
+		RETURNING user_agent, session_id::text
+	`, jti, uid).Scan(&userAgent, &sid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "session_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.revokeSessionAccess(r.Context(), sid)
+	app.recordSecurityEvent(r, uid, secSessionRevoked, map[string]any{"userAgent": userAgent})
+	w.WriteHeader(http.StatusNoContent)
+}
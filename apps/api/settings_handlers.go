@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// GET /v1/admin/settings
+func (app *App) AdminListSettings(w http.ResponseWriter, r *http.Request) {
+	vals, err := app.Settings.All(r.Context())
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("list settings failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": vals})
+}
+
+// PUT /v1/admin/settings/{key}  {"value":"..."}
+func (app *App) AdminUpdateSetting(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimSpace(chi.URLParam(r, "key"))
+	var body struct {
+		Value *string `json:"value" validate:"required"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	value := strings.TrimSpace(*body.Value)
+	actor, _ := getUserID(r)
+
+	prev, err := app.Settings.Set(r.Context(), key, value, actor)
+	switch {
+	case errors.Is(err, settings.ErrUnknownKey):
+		apierror.Write(w, apierror.New(http.StatusNotFound, "unknown_setting"))
+		return
+	case errors.Is(err, settings.ErrInvalidValue):
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_value"))
+		return
+	case err != nil:
+		log.Ctx(r.Context()).Error().Err(err).Str("key", key).Msg("update setting failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "setting.update",
+		TargetType: "setting",
+		TargetID:   key,
+		Before:     map[string]any{"value": prev},
+		After:      map[string]any{"value": value},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"key": key, "value": value}})
+}
+
+// DELETE /v1/admin/settings/{key} — fall back to the env var / default
+func (app *App) AdminResetSetting(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimSpace(chi.URLParam(r, "key"))
+	prev, err := app.Settings.Reset(r.Context(), key)
+	if errors.Is(err, settings.ErrUnknownKey) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "unknown_setting"))
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("key", key).Msg("reset setting failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.audit(r, auditEntry{
+		Action:     "setting.reset",
+		TargetType: "setting",
+		TargetID:   key,
+		Before:     map[string]any{"value": prev},
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"key": key, "reset": true}})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sudo-init-do/okies-backend/pkg/leader"
+)
+
+// Periodic loops that sweep or report over shared data run on one API
+// replica at a time: the replicas elect a leader through a Postgres advisory
+// lock and only the leader runs them. Queue jobs (payout submission,
+// statements, webhooks) need no election; workers claim them with SKIP
+// LOCKED. Per-process loops such as replica monitoring and the job gauges
+// stay outside.
+
+const singletonElection = "api-background"
+
+// runSingletons campaigns for leadership until ctx is cancelled, running the
+// loops below while this process leads.
+func (app *App) runSingletons(ctx context.Context) {
+	el := leader.New(app.DB, singletonElection)
+	el.OnChange = func(leading bool) {
+		v := 0.0
+		if leading {
+			v = 1
+		}
+		gauges.Set("okies_background_leader", "Whether this process runs the singleton background loops.", v)
+	}
+	el.Run(ctx, func(ctx context.Context) {
+		loops := []func(context.Context){
+			// return value of expired vouchers to their issuers
+			func(ctx context.Context) { app.runVoucherSweeper(ctx, time.Hour) },
+			// liability coverage gauges and alerts
+			func(ctx context.Context) { app.runFloatMonitor(ctx, app.Config.FloatMonitorInterval) },
+			// daily currency transaction report for the previous day
+			func(ctx context.Context) { app.runRegulatoryReporter(ctx, time.Hour) },
+			// purge data past its retention period
+			func(ctx context.Context) { app.runRetentionJobs(ctx, 24*time.Hour) },
+			// make sure every approved payout reaches the provider
+			func(ctx context.Context) { app.runPayoutRelayCheck(ctx, 5*time.Minute) },
+			// keep balance reads to the entries since a recent snapshot
+			func(ctx context.Context) { app.runBalanceSnapshots(ctx, 10*time.Minute) },
+		}
+		var wg sync.WaitGroup
+		for _, loop := range loops {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				loop(ctx)
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	"github.com/sudo-init-do/okies-backend/pkg/httpclient"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+	"github.com/sudo-init-do/okies-backend/pkg/sms"
+)
+
+// SMS. sendSMS records the message and queues an sms.send job in one
+// transaction; delivery reports from the provider move it to a terminal
+// status and, where the provider prices late, an sms.price job fills in
+// the cost.
+
+const (
+	jobSMSSend  = "sms.send"  // {"messageId","body"}
+	jobSMSPrice = "sms.price" // {"messageId"}
+)
+
+// newSMSDriver returns nil when no driver is configured.
+func newSMSDriver(cfg *config.Config) sms.Driver {
+	client := httpclient.New("sms_"+cfg.SMS.Driver, httpclient.Options{Timeout: 15 * time.Second, Retries: 2})
+	s := cfg.SMS
+	switch s.Driver {
+	case "termii":
+		return &sms.Termii{BaseURL: s.TermiiBaseURL, APIKey: s.TermiiAPIKey, SenderID: s.SenderID, Channel: s.TermiiChannel, Client: client}
+	case "twilio":
+		t := &sms.Twilio{AccountSID: s.TwilioAccountSID, AuthToken: s.TwilioAuthToken, From: s.SenderID, Client: client}
+		if cfg.PublicURL != "" {
+			t.StatusCallback = cfg.PublicURL + "/v1/webhooks/sms/twilio"
+		}
+		return t
+	}
+	return nil
+}
+
+// sendSMS queues the named template to an E.164 number. userID may be empty
+// for numbers not yet attached to an account. It returns the message ID.
+func (app *App) sendSMS(ctx context.Context, userID, to, template string, data map[string]any) (string, error) {
+	body, err := sms.Render(template, data)
+	if err != nil {
+		return "", err
+	}
+	stored := &body
+	if sms.Sensitive(template) {
+		stored = nil
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+	var id string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO sms_messages (user_id, to_number, template, body)
+		VALUES (NULLIF($1,'')::uuid, $2, $3, $4)
+		RETURNING id
+	`, userID, to, template, stored).Scan(&id); err != nil {
+		return "", err
+	}
+	if err := jobs.Enqueue(ctx, tx, jobSMSSend, map[string]any{"messageId": id, "body": body},
+		jobs.Options{MaxAttempts: 4, UniqueKey: "sms.send:" + id}); err != nil {
+		return "", err
+	}
+	return id, tx.Commit(ctx)
+}
+
+func (app *App) sendSMSJob(ctx context.Context, job *jobs.Job) error {
+	var p struct {
+		MessageID string `json:"messageId"`
+		Body      string `json:"body"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+	var to, status string
+	err := app.DB.QueryRow(ctx, `SELECT to_number, status FROM sms_messages WHERE id=$1`, p.MessageID).Scan(&to, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if status != sms.StatusQueued {
+		return nil
+	}
+	if app.SMS == nil {
+		return app.failSMS(ctx, p.MessageID, "no sms provider configured")
+	}
+
+	res, err := app.SMS.Send(ctx, to, p.Body)
+	if err != nil {
+		if errors.Is(err, sms.ErrRejected) || job.Attempt >= job.MaxAttempts {
+			if ferr := app.failSMS(ctx, p.MessageID, err.Error()); ferr != nil {
+				return ferr
+			}
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	if _, err := app.DB.Exec(ctx, `
+		UPDATE sms_messages
+		SET provider=$2, provider_message_id=$3, status='sent', sent_at=now(), updated_at=now(),
+		    cost=NULLIF($4,'')::numeric, cost_currency=NULLIF($5,'')
+		WHERE id=$1
+	`, p.MessageID, app.SMS.Name(), res.ProviderID, res.Cost, res.Currency); err != nil {
+		// the provider has the message; don't send it twice
+		log.Ctx(ctx).Error().Err(err).Str("sms_id", p.MessageID).Str("provider_id", res.ProviderID).Msg("record sent sms failed")
+	}
+	return nil
+}
+
+func (app *App) failSMS(ctx context.Context, id, reason string) error {
+	_, err := app.DB.Exec(ctx, `
+		UPDATE sms_messages SET status='failed', error=$2, updated_at=now()
+		WHERE id=$1 AND status='queued'
+	`, id, reason)
+	return err
+}
+
+// applySMSUpdate records a delivery report. Statuses only move forward, so
+// a late "sent" never overwrites "delivered".
+func (app *App) applySMSUpdate(ctx context.Context, provider string, u sms.Update) error {
+	var id string
+	var priced bool
+	err := app.DB.QueryRow(ctx, `
+		UPDATE sms_messages SET
+		  status = CASE WHEN status IN ('queued','sent') THEN $3 ELSE status END,
+		  error = COALESCE(NULLIF($4,''), error),
+		  cost = COALESCE(NULLIF($5,'')::numeric, cost),
+		  cost_currency = COALESCE(cost_currency, NULLIF($6,'')),
+		  updated_at = now()
+		WHERE provider=$1 AND provider_message_id=$2
+		RETURNING id, cost IS NOT NULL
+	`, provider, u.ProviderID, u.Status, u.Error, u.Cost, u.Currency).Scan(&id, &priced)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := app.SMS.(sms.Pricer); ok && !priced && u.Status != sms.StatusSent {
+		return jobs.Enqueue(ctx, app.DB, jobSMSPrice, map[string]any{"messageId": id},
+			jobs.Options{RunAt: time.Now().Add(time.Minute), MaxAttempts: 6, UniqueKey: "sms.price:" + id})
+	}
+	return nil
+}
+
+// smsPriceJob asks the provider what a message cost, retrying with backoff
+// until it has been priced.
+func (app *App) smsPriceJob(ctx context.Context, job *jobs.Job) error {
+	var p struct {
+		MessageID string `json:"messageId"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+	pricer, ok := app.SMS.(sms.Pricer)
+	if !ok {
+		return nil
+	}
+	var providerID string
+	err := app.DB.QueryRow(ctx, `
+		SELECT provider_message_id FROM sms_messages WHERE id=$1 AND cost IS NULL AND provider=$2
+	`, p.MessageID, app.SMS.Name()).Scan(&providerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cost, currency, err := pricer.Price(ctx, providerID)
+	if err != nil {
+		return err
+	}
+	_, err = app.DB.Exec(ctx, `
+		UPDATE sms_messages SET cost=$2::numeric, cost_currency=$3, updated_at=now() WHERE id=$1
+	`, p.MessageID, cost, strings.ToUpper(currency))
+	return err
+}
+
+// ---------- Handlers (Webhooks) ----------
+
+// POST /v1/webhooks/sms/termii — delivery reports
+func (app *App) TermiiWebhook(w http.ResponseWriter, r *http.Request) {
+	t, ok := app.SMS.(*sms.Termii)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "webhook_not_configured"))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "bad_payload"))
+		return
+	}
+	u, err := t.ParseCallback(body, r.Header.Get("X-Termii-Signature"), app.Config.SMS.TermiiWebhookSecret)
+	if errors.Is(err, sms.ErrBadSignature) {
+		app.alertBadWebhookSignature(r, t.Name())
+		apierror.Write(w, apierror.New(http.StatusForbidden, "bad_signature"))
+		return
+	}
+	if err != nil || u.ProviderID == "" {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "bad_payload"))
+		return
+	}
+	if err := app.applySMSUpdate(r.Context(), t.Name(), u); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("provider_id", u.ProviderID).Msg("apply sms report failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// POST /v1/webhooks/sms/twilio — status callbacks, signed with the auth token
+func (app *App) TwilioWebhook(w http.ResponseWriter, r *http.Request) {
+	t, ok := app.SMS.(*sms.Twilio)
+	if !ok || t.StatusCallback == "" {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "webhook_not_configured"))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "bad_payload"))
+		return
+	}
+	u, err := t.ParseCallback(t.StatusCallback, r.PostForm, r.Header.Get("X-Twilio-Signature"))
+	if err != nil {
+		app.alertBadWebhookSignature(r, t.Name())
+		apierror.Write(w, apierror.New(http.StatusForbidden, "bad_signature"))
+		return
+	}
+	if u.ProviderID == "" {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "bad_payload"))
+		return
+	}
+	if err := app.applySMSUpdate(r.Context(), t.Name(), u); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("provider_id", u.ProviderID).Msg("apply sms report failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ---------- Handlers (Admin) ----------
+
+type smsCostRow struct {
+	Provider  string  `json:"provider"`
+	Template  string  `json:"template"`
+	Currency  *string `json:"currency"`
+	Messages  int64   `json:"messages"`
+	Delivered int64   `json:"delivered"`
+	Failed    int64   `json:"failed"`
+	Cost      string  `json:"cost"`
+	Unpriced  int64   `json:"unpriced"`
+}
+
+// GET /v1/admin/sms/costs?from=2025-01-01&to=2025-01-31
+// Message counts, delivery outcomes and spend per provider and template.
+func (app *App) AdminSMSCosts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -30)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_date"))
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_date"))
+			return
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT COALESCE(provider, 'none'), template, cost_currency,
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE status='delivered'),
+		       COUNT(*) FILTER (WHERE status IN ('failed','undelivered')),
+		       COALESCE(SUM(cost), 0)::text,
+		       COUNT(*) FILTER (WHERE cost IS NULL AND provider IS NOT NULL)
+		FROM sms_messages
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3
+	`, from, to)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []smsCostRow{}
+	for rows.Next() {
+		var c smsCostRow
+		if err := rows.Scan(&c.Provider, &c.Template, &c.Currency, &c.Messages, &c.Delivered, &c.Failed, &c.Cost, &c.Unpriced); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, c)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"from": from.Format("2006-01-02"), "to": to.AddDate(0, 0, -1).Format("2006-01-02"), "rows": out,
+	}})
+}
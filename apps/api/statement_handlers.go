@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/i18n"
+	"github.com/sudo-init-do/okies-backend/pkg/jobs"
+)
+
+// Account statements are generated by the worker: the request returns a
+// pending statement immediately and the client polls until it is ready.
+// Periods are whole days, inclusive, in the user's time zone when requested;
+// amounts carry display text in the user's currency display at generation.
+
+const maxStatementDays = 366
+
+type statementDTO struct {
+	ID          string          `json:"id"`
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	Status      string          `json:"status"` // pending | ready | failed
+	Content     json.RawMessage `json:"content,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty"`
+}
+
+type statementEntry struct {
+	TxID      string    `json:"txId"`
+	Kind      string    `json:"kind"`
+	Direction string    `json:"direction"`
+	Amount    int64     `json:"amount"`
+	Display   string    `json:"display"` // amount as shown to the user
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// generateStatementJob builds the statement content: opening and closing
+// balances plus every ledger entry in the period. The statement is marked
+// failed when the last attempt fails, so clients stop polling.
+func (app *App) generateStatementJob(ctx context.Context, job *jobs.Job) (err error) {
+	var p struct {
+		StatementID string `json:"statementId"`
+	}
+	if err := job.Decode(&p); err != nil {
+		return jobs.Permanent(err)
+	}
+	defer func() {
+		if err != nil && job.Attempt >= job.MaxAttempts {
+			_, _ = app.DB.Exec(ctx, `
+				UPDATE statements SET status='failed', error=$2, completed_at=now()
+				WHERE id=$1 AND status='pending'
+			`, p.StatementID, err.Error())
+		}
+	}()
+
+	var userID, status, zone string
+	var from, to time.Time
+	err = app.DB.QueryRow(ctx, `
+		SELECT user_id, period_from, period_to, status, time_zone FROM statements WHERE id=$1
+	`, p.StatementID).Scan(&userID, &from, &to, &status, &zone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // user erased
+	}
+	if err != nil {
+		return err
+	}
+	if status != "pending" {
+		return nil
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	// DATE columns scan as UTC midnight; rebase them onto the statement's zone
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+	end := to.AddDate(0, 0, 1)
+	currency := app.userPreferences(ctx, userID).CurrencyDisplay
+
+	var opening int64
+	if err := app.DB.QueryRow(ctx, `
+		SELECT COALESCE(SUM(CASE WHEN le.direction='credit' THEN le.amount ELSE -le.amount END),0)
+		FROM ledger_entries le
+		JOIN wallets wl ON wl.id = le.wallet_id
+		JOIN transactions t ON t.id = le.tx_id
+		WHERE wl.user_id=$1 AND t.created_at < $2
+	`, userID, from).Scan(&opening); err != nil {
+		return err
+	}
+
+	rows, err := app.DB.Query(ctx, `
+		SELECT t.id, t.kind, le.direction, le.amount, t.created_at
+		FROM ledger_entries le
+		JOIN wallets wl ON wl.id = le.wallet_id
+		JOIN transactions t ON t.id = le.tx_id
+		WHERE wl.user_id=$1 AND t.created_at >= $2 AND t.created_at < $3
+		ORDER BY t.created_at, t.id
+	`, userID, from, end)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	entries := []statementEntry{}
+	var credits, debits int64
+	for rows.Next() {
+		var e statementEntry
+		if err := rows.Scan(&e.TxID, &e.Kind, &e.Direction, &e.Amount, &e.CreatedAt); err != nil {
+			return err
+		}
+		e.CreatedAt = e.CreatedAt.In(loc)
+		e.Display = i18n.Money(e.Amount, currency)
+		if e.Direction == "credit" {
+			credits += e.Amount
+		} else {
+			debits += e.Amount
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	closing := opening + credits - debits
+	content, err := json.Marshal(map[string]any{
+		"currency":        "NGN",
+		"currencyDisplay": currency,
+		"timeZone":        zone,
+		"openingBalance":  opening,
+		"totalCredits":    credits,
+		"totalDebits":     debits,
+		"closingBalance":  closing,
+		"display": map[string]string{
+			"openingBalance": i18n.Money(opening, currency),
+			"totalCredits":   i18n.Money(credits, currency),
+			"totalDebits":    i18n.Money(debits, currency),
+			"closingBalance": i18n.Money(closing, currency),
+		},
+		"entries":     entries,
+		"generatedAt": time.Now().In(loc),
+	})
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if _, err := app.DB.Exec(ctx, `
+		UPDATE statements SET status='ready', content=$2::jsonb, completed_at=now()
+		WHERE id=$1 AND status='pending'
+	`, p.StatementID, string(content)); err != nil {
+		return err
+	}
+	app.notify(ctx, userID, "statement_ready", map[string]any{
+		"statementId": p.StatementID, "from": from.Format("2 Jan 2006"), "to": to.Format("2 Jan 2006"),
+	})
+	app.sendEmail(ctx, userID, "statement_ready",
+		map[string]any{"statementId": p.StatementID, "from": from, "to": to})
+	return nil
+}
+
+// ---------- Handlers (User) ----------
+
+// POST /v1/wallet/statements  {"from":"2025-01-01","to":"2025-01-31"}
+func (app *App) RequestStatement(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		From string `json:"from" validate:"required,datetime=2006-01-02"`
+		To   string `json:"to" validate:"required,datetime=2006-01-02"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	loc := app.userLocation(r.Context(), uid)
+	from, _ := time.ParseInLocation("2006-01-02", body.From, loc)
+	to, _ := time.ParseInLocation("2006-01-02", body.To, loc)
+	today := startOfDay(time.Now(), loc)
+	switch {
+	case to.Before(from), to.After(today):
+		apierror.Write(w, apierror.InvalidField("to"))
+		return
+	case to.After(from.AddDate(0, 0, maxStatementDays)):
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "statement_period_too_long"))
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var s statementDTO
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO statements (user_id, period_from, period_to, time_zone)
+		VALUES ($1,$2::date,$3::date,$4)
+		RETURNING id, status, created_at
+	`, uid, body.From, body.To, loc.String()).Scan(&s.ID, &s.Status, &s.CreatedAt); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := jobs.Enqueue(ctx, tx, jobStatementGenerate, map[string]any{"statementId": s.ID}, jobs.Options{}); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	s.From, s.To = body.From, body.To
+	writeJSON(w, http.StatusAccepted, map[string]any{"data": s})
+}
+
+// GET /v1/wallet/statements — most recent first, without content
+func (app *App) ListMyStatements(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	rows, err := app.Reads.Read().Query(r.Context(), `
+		SELECT id, to_char(period_from,'YYYY-MM-DD'), to_char(period_to,'YYYY-MM-DD'), status, created_at, completed_at
+		FROM statements WHERE user_id=$1
+		ORDER BY created_at DESC
+		LIMIT 50
+	`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []statementDTO{}
+	for rows.Next() {
+		var s statementDTO
+		if err := rows.Scan(&s.ID, &s.From, &s.To, &s.Status, &s.CreatedAt, &s.CompletedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, s)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// GET /v1/wallet/statements/{id}
+func (app *App) GetMyStatement(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var s statementDTO
+	var content []byte
+	err := app.DB.QueryRow(r.Context(), `
+		SELECT id, to_char(period_from,'YYYY-MM-DD'), to_char(period_to,'YYYY-MM-DD'), status, content, created_at, completed_at
+		FROM statements WHERE id=$1 AND user_id=$2
+	`, id, uid).Scan(&s.ID, &s.From, &s.To, &s.Status, &content, &s.CreatedAt, &s.CompletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "statement_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	s.Content = content
+	writeJSON(w, http.StatusOK, map[string]any{"data": s})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// Step-up authentication. A stolen session shouldn't be enough to empty a
+// wallet or delete the account, so large withdrawals and account deletion
+// need the user to prove again that they are who they signed in as: with
+// their password, or a code sent to their phone or email. Doing so returns
+// a step-up token good for a few minutes and one action; the action's
+// handler spends it.
+
+const stepUpTTL = 5 * time.Minute
+
+// POST /v1/auth/step-up/code
+// Sends a step-up code to the user's phone, or their email when they have
+// no phone or SMS is unavailable.
+func (app *App) RequestStepUpCode(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	ctx := r.Context()
+	u, err := app.userByID(ctx, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	var (
+		id      string
+		channel string
+	)
+	switch {
+	case u.Phone != nil && app.SMS != nil:
+		id, _, err = app.issueOTP(ctx, uid, *u.Phone, otpStepUp)
+		channel = "phone"
+	case app.Mailer != nil:
+		id, _, err = app.issueEmailOTP(ctx, uid, u.Email, otpStepUp)
+		channel = "email"
+	default:
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, "email_unavailable"))
+		return
+	}
+	if err != nil {
+		e := otpAPIError(err)
+		if e.Status == http.StatusInternalServerError {
+			log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("issue step-up code failed")
+		}
+		apierror.Write(w, e)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"data": map[string]any{"challengeId": id, "channel": channel}})
+}
+
+// POST /v1/auth/step-up  {"password":"..."} or {"challengeId":"...","code":"123456"}
+// Returns {"stepUpToken","expiresAt"}.
+func (app *App) StepUp(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		Password    string `json:"password" validate:"omitempty,max=128"`
+		ChallengeID string `json:"challengeId"`
+		Code        string `json:"code" validate:"omitempty,len=6,numeric"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+
+	var method string
+	switch {
+	case body.Password != "":
+		method = "password"
+		var hash string
+		err := app.DB.QueryRow(ctx, `SELECT COALESCE(password_hash,'') FROM users WHERE id=$1`, uid).Scan(&hash)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		if ok, err := a.CheckPassword(body.Password, hash); err != nil || !ok {
+			app.recordSecurityEvent(r, uid, secStepUpFailed, map[string]any{"method": method})
+			apierror.Write(w, apierror.New(http.StatusForbidden, "step_up_failed"))
+			return
+		}
+	case body.ChallengeID != "" && body.Code != "":
+		method = "code"
+		c, err := app.checkOTP(ctx, body.ChallengeID, otpStepUp, body.Code)
+		if err == nil && (c.UserID == nil || *c.UserID != uid) {
+			err = errOTPInvalid
+		}
+		if errors.Is(err, errOTPInvalid) {
+			app.recordSecurityEvent(r, uid, secStepUpFailed, map[string]any{"method": method})
+			apierror.Write(w, apierror.New(http.StatusForbidden, "step_up_failed"))
+			return
+		}
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+	default:
+		apierror.Write(w, apierror.InvalidField("password"))
+		return
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "token_issue_error"))
+		return
+	}
+	expiresAt := time.Now().Add(stepUpTTL)
+	if _, err := app.DB.Exec(ctx, `
+		INSERT INTO step_up_tokens (user_id, token_hash, method, expires_at) VALUES ($1,$2,$3,$4)
+	`, uid, hashOpaqueToken(token), method, expiresAt); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("store step-up token failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.recordSecurityEvent(r, uid, secStepUp, map[string]any{"method": method})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"stepUpToken": token, "expiresAt": expiresAt}})
+}
+
+// withdrawalNeedsStepUp reports whether a withdrawal of amount to
+// destinationID needs a step-up token: it reaches the threshold and the
+// destination isn't a trusted beneficiary.
+func (app *App) withdrawalNeedsStepUp(ctx context.Context, uid, destinationID string, amount int64) (bool, error) {
+	threshold := app.Settings.Int64(ctx, settings.StepUpThresholdKobo)
+	if threshold <= 0 || amount < threshold {
+		return false, nil
+	}
+	bs, err := app.beneficiaries(ctx, uid, "")
+	if err != nil {
+		return false, err
+	}
+	for _, b := range bs {
+		if b.Destination != nil && b.Destination.ID == destinationID && b.Trusted {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// spendStepUpToken uses up uid's step-up token in tx, reporting whether it
+// was valid. Spend it in the transaction of the action it allows, so an
+// action that fails leaves it for a retry.
+func spendStepUpToken(ctx context.Context, tx pgx.Tx, uid, token string) (bool, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return false, nil
+	}
+	tag, err := tx.Exec(ctx, `
+		UPDATE step_up_tokens SET used_at = now()
+		WHERE token_hash = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > now()
+	`, hashOpaqueToken(token), uid)
+	return tag.RowsAffected() == 1, err
+}
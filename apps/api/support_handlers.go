@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+)
+
+type ticketMessageDTO struct {
+	ID        string    `json:"id"`
+	AuthorID  string    `json:"authorId"`
+	FromStaff bool      `json:"fromStaff"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ticketDTO struct {
+	ID          string             `json:"id"`
+	UserID      string             `json:"userId"`
+	SubjectType *string            `json:"subjectType,omitempty"`
+	SubjectID   *string            `json:"subjectId,omitempty"`
+	Subject     string             `json:"subject"`
+	Status      string             `json:"status"`
+	Resolution  *string            `json:"resolution,omitempty"`
+	ResolvedAt  *time.Time         `json:"resolvedAt,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+	Ledger      json.RawMessage    `json:"ledger,omitempty"` // facts about the linked transaction / payout
+	Messages    []ticketMessageDTO `json:"messages,omitempty"`
+}
+
+const ticketCols = `id, user_id, subject_type, subject_id, subject, status, resolution, resolved_at, created_at, updated_at`
+
+func scanTicket(row pgx.Row) (ticketDTO, error) {
+	var t ticketDTO
+	err := row.Scan(&t.ID, &t.UserID, &t.SubjectType, &t.SubjectID, &t.Subject, &t.Status,
+		&t.Resolution, &t.ResolvedAt, &t.CreatedAt, &t.UpdatedAt)
+	return t, err
+}
+
+// ticketLedgerFacts describes the transaction or payout a ticket is about,
+// from the point of view of the ticket's user.
+func (app *App) ticketLedgerFacts(ctx context.Context, t ticketDTO) (json.RawMessage, error) {
+	if t.SubjectType == nil || t.SubjectID == nil {
+		return nil, nil
+	}
+	var facts []byte
+	var err error
+	switch *t.SubjectType {
+	case "transaction":
+		err = app.DB.QueryRow(ctx, `
+			SELECT json_build_object(
+			  'id', t.id, 'kind', t.kind, 'amount', t.amount, 'currency', t.currency,
+			  'amountDelta', SUM(CASE WHEN le.direction='credit' THEN le.amount ELSE -le.amount END),
+			  'createdAt', t.created_at)
+			FROM transactions t
+			JOIN ledger_entries le ON le.tx_id = t.id
+			JOIN wallets wl ON wl.id = le.wallet_id AND wl.user_id = $2
+			WHERE t.id = $1
+			GROUP BY t.id
+		`, *t.SubjectID, t.UserID).Scan(&facts)
+	case "payout":
+		err = app.DB.QueryRow(ctx, `
+			SELECT json_build_object(
+			  'id', p.id, 'amount', p.amount, 'currency', p.currency, 'status', p.status,
+			  'reference', p.reference, 'bankCode', d.bank_code,
+			  'accountLast4', d.account_last4,
+			  'createdAt', p.created_at, 'updatedAt', p.updated_at)
+			FROM payouts p
+			JOIN payout_destinations d ON d.id = p.destination_id
+			WHERE p.id = $1 AND p.user_id = $2
+		`, *t.SubjectID, t.UserID).Scan(&facts)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return facts, err
+}
+
+func (app *App) loadTicketMessages(ctx context.Context, ticketID string) ([]ticketMessageDTO, error) {
+	rows, err := app.DB.Query(ctx, `
+		SELECT id, author_id, from_staff, body, created_at
+		FROM support_ticket_messages WHERE ticket_id=$1 ORDER BY created_at
+	`, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ticketMessageDTO{}
+	for rows.Next() {
+		var m ticketMessageDTO
+		if err := rows.Scan(&m.ID, &m.AuthorID, &m.FromStaff, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// writeTicket loads messages and ledger facts for t and writes it out.
+func (app *App) writeTicket(w http.ResponseWriter, r *http.Request, status int, t ticketDTO) {
+	var err error
+	if t.Messages, err = app.loadTicketMessages(r.Context(), t.ID); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if t.Ledger, err = app.ticketLedgerFacts(r.Context(), t); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	writeJSON(w, status, map[string]any{"data": t})
+}
+
+// ---------- Handlers (User) ----------
+
+// POST /v1/support/tickets  {"transactionId"|"withdrawalId":"...","subject":"...","message":"..."}
+func (app *App) CreateSupportTicket(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		TransactionID string `json:"transactionId" validate:"omitempty,uuid"`
+		WithdrawalID  string `json:"withdrawalId" validate:"omitempty,uuid,excluded_with=TransactionID"`
+		Subject       string `json:"subject" validate:"required,max=200"`
+		Message       string `json:"message" validate:"required,max=5000"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	body.Subject = strings.TrimSpace(body.Subject)
+	body.Message = strings.TrimSpace(body.Message)
+
+	ctx := r.Context()
+	var subjectType, subjectID *string
+	switch {
+	case body.TransactionID != "":
+		var mine bool
+		if err := app.DB.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM ledger_entries le JOIN wallets wl ON wl.id = le.wallet_id
+			               WHERE le.tx_id::text = $1 AND wl.user_id = $2)
+		`, body.TransactionID, uid).Scan(&mine); err != nil || !mine {
+			apierror.Write(w, apierror.New(http.StatusNotFound, "transaction_not_found"))
+			return
+		}
+		st := "transaction"
+		subjectType, subjectID = &st, &body.TransactionID
+	case body.WithdrawalID != "":
+		var mine bool
+		if err := app.DB.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM payouts WHERE id::text = $1 AND user_id = $2)
+		`, body.WithdrawalID, uid).Scan(&mine); err != nil || !mine {
+			apierror.Write(w, apierror.New(http.StatusNotFound, "withdrawal_not_found"))
+			return
+		}
+		st := "payout"
+		subjectType, subjectID = &st, &body.WithdrawalID
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+	t, err := scanTicket(tx.QueryRow(ctx, `
+		INSERT INTO support_tickets (user_id, subject_type, subject_id, subject)
+		VALUES ($1,$2,$3,$4)
+		RETURNING `+ticketCols, uid, subjectType, subjectID, body.Subject))
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("create support ticket failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO support_ticket_messages (ticket_id, author_id, body) VALUES ($1,$2,$3)
+	`, t.ID, uid, body.Message); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	app.writeTicket(w, r, http.StatusCreated, t)
+}
+
+// GET /v1/support/tickets
+func (app *App) ListMySupportTickets(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT `+ticketCols+` FROM support_tickets WHERE user_id=$1 ORDER BY updated_at DESC LIMIT 100
+	`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []ticketDTO{}
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, t)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// GET /v1/support/tickets/{id}
+func (app *App) GetMySupportTicket(w http.ResponseWriter, r *http.Request) {
+	uid, _ := getUserID(r)
+	t, err := scanTicket(app.DB.QueryRow(r.Context(), `
+		SELECT `+ticketCols+` FROM support_tickets WHERE id::text=$1 AND user_id=$2
+	`, chi.URLParam(r, "id"), uid))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.writeTicket(w, r, http.StatusOK, t)
+}
+
+// POST /v1/support/tickets/{id}/messages  {"message":"..."} — reopens a resolved ticket
+func (app *App) AddSupportTicketMessage(w http.ResponseWriter, r *http.Request) {
+	uid, _ := getUserID(r)
+	var body struct {
+		Message string `json:"message" validate:"required,max=5000"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+	t, err := scanTicket(app.DB.QueryRow(ctx, `
+		UPDATE support_tickets SET status='open', updated_at=now()
+		WHERE id::text=$1 AND user_id=$2
+		RETURNING `+ticketCols, chi.URLParam(r, "id"), uid))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if _, err := app.DB.Exec(ctx, `
+		INSERT INTO support_ticket_messages (ticket_id, author_id, body) VALUES ($1,$2,$3)
+	`, t.ID, uid, strings.TrimSpace(body.Message)); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.writeTicket(w, r, http.StatusCreated, t)
+}
+
+// ---------- Handlers (Admin) ----------
+
+// GET /v1/admin/support/tickets?status=&userId=&limit=&cursor=
+// Most recently updated first.
+func (app *App) AdminListSupportTickets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pg, ok := app.parsePage(w, r, "admin.support_tickets", pagination.Admin)
+	if !ok {
+		return
+	}
+	afterAt, afterID := pg.AfterArgs()
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT `+ticketCols+` FROM support_tickets
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR user_id::text = $2)
+		  AND ($3::timestamptz IS NULL OR (updated_at, id) < ($3, $4::uuid))
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $5
+	`, strings.TrimSpace(q.Get("status")), strings.TrimSpace(q.Get("userId")), afterAt, afterID, pg.Limit+1)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+	out := []ticketDTO{}
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, t)
+	}
+	out, paging := pagination.Trim(pg, out, func(t ticketDTO) pagination.Key { return pagination.Key{Time: t.UpdatedAt, ID: t.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
+
+// GET /v1/admin/support/tickets/{id}
+func (app *App) AdminGetSupportTicket(w http.ResponseWriter, r *http.Request) {
+	t, err := scanTicket(app.DB.QueryRow(r.Context(), `
+		SELECT `+ticketCols+` FROM support_tickets WHERE id::text=$1
+	`, chi.URLParam(r, "id")))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.writeTicket(w, r, http.StatusOK, t)
+}
+
+// POST /v1/admin/support/tickets/{id}/messages  {"message":"..."}
+func (app *App) AdminReplySupportTicket(w http.ResponseWriter, r *http.Request) {
+	actor, _ := getUserID(r)
+	var body struct {
+		Message string `json:"message" validate:"required,max=5000"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+	t, err := scanTicket(app.DB.QueryRow(ctx, `
+		UPDATE support_tickets SET status='awaiting_user', updated_at=now()
+		WHERE id::text=$1 AND status <> 'resolved'
+		RETURNING `+ticketCols, chi.URLParam(r, "id")))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "ticket_not_found_or_resolved"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if _, err := app.DB.Exec(ctx, `
+		INSERT INTO support_ticket_messages (ticket_id, author_id, from_staff, body) VALUES ($1,$2,TRUE,$3)
+	`, t.ID, actor, strings.TrimSpace(body.Message)); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.notify(ctx, t.UserID, "support_reply", map[string]any{"ticketId": t.ID, "subject": t.Subject})
+	app.audit(r, auditEntry{Action: "support.reply", TargetType: "support_ticket", TargetID: t.ID})
+	app.writeTicket(w, r, http.StatusCreated, t)
+}
+
+// POST /v1/admin/support/tickets/{id}/resolve  {"resolution":"..."}
+func (app *App) AdminResolveSupportTicket(w http.ResponseWriter, r *http.Request) {
+	actor, _ := getUserID(r)
+	var body struct {
+		Resolution string `json:"resolution" validate:"required,max=2000"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+	t, err := scanTicket(app.DB.QueryRow(ctx, `
+		UPDATE support_tickets
+		SET status='resolved', resolution=$2, resolved_by=$3, resolved_at=now(), updated_at=now()
+		WHERE id::text=$1 AND status <> 'resolved'
+		RETURNING `+ticketCols, chi.URLParam(r, "id"), strings.TrimSpace(body.Resolution), actor))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "ticket_not_found_or_resolved"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	app.notify(ctx, t.UserID, "support_resolved", map[string]any{"ticketId": t.ID, "resolution": *t.Resolution})
+	app.audit(r, auditEntry{
+		Action:     "support.resolve",
+		TargetType: "support_ticket",
+		TargetID:   t.ID,
+		After:      map[string]any{"resolution": t.Resolution},
+	})
+	app.writeTicket(w, r, http.StatusOK, t)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+	_ "time/tzdata" // zone names must resolve in minimal containers too
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+// User time zones. Day boundaries a user sees (statement periods) and times
+// shown to them (receipts, scheduled gifts) follow their saved IANA zone,
+// Lagos when unset. Regulatory and finance reports keep fixed days.
+
+// defaultTimeZone applies to users who haven't chosen one. It is stored
+// by name with statements, so it must be an IANA zone, not the fixed WAT.
+const defaultTimeZone = "Africa/Lagos"
+
+var defaultLocation = func() *time.Location {
+	loc, err := time.LoadLocation(defaultTimeZone)
+	if err != nil {
+		panic("timezone: " + err.Error())
+	}
+	return loc
+}()
+
+// userLocation is userID's time zone, the default when unset or unknown.
+func (app *App) userLocation(ctx context.Context, userID string) *time.Location {
+	u, err := app.userByID(ctx, userID)
+	if err != nil || u.TimeZone == nil {
+		return defaultLocation
+	}
+	loc, err := time.LoadLocation(*u.TimeZone)
+	if err != nil {
+		return defaultLocation
+	}
+	return loc
+}
+
+// startOfDay is midnight at the start of t's calendar day in loc.
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// PUT /v1/users/me/timezone  {"timeZone":"Africa/Lagos"} — null clears the preference
+func (app *App) SetMyTimeZone(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		TimeZone *string `json:"timeZone" validate:"omitempty,timezone"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if _, err := app.DB.Exec(r.Context(), `UPDATE users SET time_zone=$2 WHERE id=$1`, uid, body.TimeZone); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("update time zone failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(r.Context(), uid)
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"timeZone": body.TimeZone}})
+}
+
+// localTime is a request time that may omit its offset ("2025-12-25T09:00"),
+// meaning wall-clock time in the user's zone. Times with an offset are
+// absolute.
+type localTime struct {
+	t     time.Time
+	local bool
+}
+
+var localTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+func (lt *localTime) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		*lt = localTime{t: t}
+		return nil
+	}
+	var err error
+	for _, layout := range localTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			*lt = localTime{t: t, local: true}
+			return nil
+		}
+	}
+	return err
+}
+
+// In resolves lt, reading an offset-less time as wall-clock time in loc.
+func (lt localTime) In(loc *time.Location) time.Time {
+	if !lt.local {
+		return lt.t
+	}
+	return time.Date(lt.t.Year(), lt.t.Month(), lt.t.Day(), lt.t.Hour(), lt.t.Minute(), lt.t.Second(), 0, loc)
+}
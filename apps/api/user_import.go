@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/config"
+	mydb "github.com/sudo-init-do/okies-backend/pkg/db"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
+)
+
+// User imports bring an existing user base onto Okies from a CSV, through
+// the admin API or `api import-users`. The header row names the columns:
+// email (required), username, display_name, language, opening_balance (in
+// kobo), external_id (the user's id on the old platform, echoed in the
+// report) and password_hash (an argon2id hash, for platforms that used
+// one; users imported without it can't log in until they set a password).
+//
+// Every row is checked, against the file and against existing accounts,
+// before anything is written, and a dry run stops there. Emails already
+// registered are skipped rather than rejected, so an interrupted import can
+// be run again. Opening balances are credited from the migration wallet
+// (migration@okies.local) as opening_balance transactions, once per user.
+
+const (
+	userImportBatchSize = 100
+	migrationEmail      = "migration@okies.local"
+)
+
+var userImportColumns = map[string]bool{
+	"email": true, "username": true, "display_name": true, "language": true,
+	"opening_balance": true, "external_id": true, "password_hash": true,
+}
+
+type userImportRow struct {
+	Row            int    `json:"row"` // 1-based data row, header excluded
+	Email          string `json:"email" validate:"required,email,max=254"`
+	Username       string `json:"username,omitempty" validate:"omitempty,username"`
+	DisplayName    string `json:"displayName,omitempty" validate:"max=60"`
+	Language       string `json:"language,omitempty" validate:"omitempty,oneof=en pcm yo ha ig"`
+	OpeningBalance int64  `json:"openingBalance"`
+	ExternalID     string `json:"externalId,omitempty" validate:"max=100"`
+	UserID         string `json:"userId,omitempty"`
+	TxID           string `json:"txId,omitempty"`
+	Status         string `json:"status"` // invalid | valid (dry run) | exists | created | failed
+	Error          string `json:"error,omitempty"`
+
+	passwordHash string
+}
+
+var errUnknownColumn = errors.New("unknown column")
+
+// parseUserImportCSV reads rows by the header's column names. maxRows 0
+// means no limit.
+func parseUserImportCSV(rd io.Reader, maxRows int) ([]*userImportRow, error) {
+	cr := csv.NewReader(rd)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !userImportColumns[name] {
+			return nil, fmt.Errorf("%w %q", errUnknownColumn, name)
+		}
+		col[name] = i
+	}
+	if _, ok := col["email"]; !ok {
+		return nil, fmt.Errorf("missing email column")
+	}
+
+	var rows []*userImportRow
+	seenEmail, seenUsername := map[string]bool{}, map[string]bool{}
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		row := &userImportRow{
+			Row:          len(rows) + 1,
+			Email:        strings.ToLower(get("email")),
+			Username:     get("username"),
+			DisplayName:  get("display_name"),
+			Language:     get("language"),
+			ExternalID:   get("external_id"),
+			Status:       "pending",
+			passwordHash: get("password_hash"),
+		}
+		rows = append(rows, row)
+		if maxRows > 0 && len(rows) > maxRows {
+			return nil, errBulkTooLarge
+		}
+
+		if v := get("opening_balance"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				row.Status, row.Error = "invalid", "invalid_opening_balance"
+				continue
+			}
+			row.OpeningBalance = n
+		}
+		var verr *apierror.Error
+		if err := validate.Struct(row); errors.As(err, &verr) && len(verr.Details) > 0 {
+			row.Status, row.Error = "invalid", "invalid_"+verr.Details[0].Field
+			continue
+		}
+		if row.passwordHash != "" && !strings.HasPrefix(row.passwordHash, "$argon2id$") {
+			row.Status, row.Error = "invalid", "invalid_password_hash"
+			continue
+		}
+		if seenEmail[row.Email] {
+			row.Status, row.Error = "invalid", "duplicate_email"
+			continue
+		}
+		seenEmail[row.Email] = true
+		if u := strings.ToLower(row.Username); u != "" {
+			if seenUsername[u] {
+				row.Status, row.Error = "invalid", "duplicate_username"
+				continue
+			}
+			seenUsername[u] = true
+		}
+	}
+	return rows, nil
+}
+
+// checkUserImportConflicts marks rows whose email is already registered as
+// existing, with the account's id, and rows asking for a username someone
+// else holds as invalid. The remaining rows are valid.
+func checkUserImportConflicts(ctx context.Context, db *pgxpool.Pool, rows []*userImportRow) error {
+	var emails, usernames []string
+	for _, row := range rows {
+		if row.Status == "pending" {
+			emails = append(emails, row.Email)
+		}
+	}
+	existing, err := usersByLower(ctx, db, `SELECT lower(email), id FROM users WHERE lower(email) = ANY($1)`, emails)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row.Status != "pending" {
+			continue
+		}
+		if id, ok := existing[row.Email]; ok {
+			row.Status, row.UserID = "exists", id
+			continue
+		}
+		if row.Username != "" {
+			usernames = append(usernames, strings.ToLower(row.Username))
+		}
+	}
+	taken, err := usersByLower(ctx, db, `SELECT lower(username), id FROM users WHERE lower(username) = ANY($1)`, usernames)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row.Status != "pending" {
+			continue
+		}
+		if _, ok := taken[strings.ToLower(row.Username)]; ok {
+			row.Status, row.Error = "invalid", "username_taken"
+			continue
+		}
+		row.Status = "valid"
+	}
+	return nil
+}
+
+// usersByLower runs a query returning (key, user id) pairs for values.
+func usersByLower(ctx context.Context, db *pgxpool.Pool, query string, values []string) (map[string]string, error) {
+	out := map[string]string{}
+	if len(values) == 0 {
+		return out, nil
+	}
+	rows, err := db.Query(ctx, query, values)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, id string
+		if err := rows.Scan(&k, &id); err != nil {
+			return nil, err
+		}
+		out[k] = id
+	}
+	return out, rows.Err()
+}
+
+// migrationWalletID looks up the wallet opening balances are credited from.
+func migrationWalletID(ctx context.Context, db *pgxpool.Pool) (string, error) {
+	var wid string
+	err := db.QueryRow(ctx, `
+		SELECT w.id FROM users u JOIN wallets w ON w.user_id = u.id WHERE u.email=$1
+	`, migrationEmail).Scan(&wid)
+	return wid, err
+}
+
+// importUsers checks rows and, unless this is a dry run or any row is
+// invalid, creates the valid ones in batches. Each row records its outcome;
+// the error is for failures that stop the whole import.
+func importUsers(ctx context.Context, db *pgxpool.Pool, batchKey string, rows []*userImportRow, dryRun bool) error {
+	if err := checkUserImportConflicts(ctx, db, rows); err != nil {
+		return err
+	}
+	var pending []*userImportRow
+	for _, row := range rows {
+		switch row.Status {
+		case "invalid":
+			return nil
+		case "valid":
+			pending = append(pending, row)
+		}
+	}
+	if dryRun || len(pending) == 0 {
+		return nil
+	}
+
+	migrationWid, err := migrationWalletID(ctx, db)
+	if err != nil {
+		return fmt.Errorf("migration wallet: %w", err)
+	}
+	for start := 0; start < len(pending); start += userImportBatchSize {
+		batch := pending[start:min(start+userImportBatchSize, len(pending))]
+		if err := postUserImportBatch(ctx, db, batchKey, migrationWid, batch); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("batch", batchKey).Int("from_row", batch[0].Row).Msg("user import batch failed")
+			for _, row := range batch {
+				row.Status, row.Error, row.UserID, row.TxID = "failed", "batch_failed", "", ""
+			}
+		}
+	}
+	return nil
+}
+
+// postUserImportBatch creates one batch of users, their wallets and
+// opening balances in a single DB transaction.
+func postUserImportBatch(ctx context.Context, db *pgxpool.Pool, batchKey, migrationWid string, rows []*userImportRow) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SELECT id FROM wallets WHERE id=$1 FOR UPDATE`, migrationWid); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		code, err := newReferralCode()
+		if err != nil {
+			return err
+		}
+		var uid string
+		err = tx.QueryRow(ctx, `
+			INSERT INTO users (email, password_hash, role, username, display_name, language, referral_code)
+			VALUES ($1,$2,'user',NULLIF($3,''),NULLIF($4,''),NULLIF($5,''),$6)
+			ON CONFLICT (email) DO NOTHING
+			RETURNING id
+		`, row.Email, row.passwordHash, row.Username, row.DisplayName, row.Language, code).Scan(&uid)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// signed up since the check
+			row.Status = "exists"
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var wid string
+		if err := tx.QueryRow(ctx, `INSERT INTO wallets (user_id, balance) VALUES ($1, 0) RETURNING id`, uid).Scan(&wid); err != nil {
+			return err
+		}
+		row.UserID = uid
+
+		if row.OpeningBalance > 0 {
+			if err := tx.QueryRow(ctx, `
+				INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+				VALUES ($1,'opening_balance',$2,'NGN', jsonb_build_object('importBatch', $3::text, 'externalId', NULLIF($4,'')))
+				RETURNING id
+			`, "opening_balance:"+uid, row.OpeningBalance, batchKey, row.ExternalID).Scan(&row.TxID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+				VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+			`, row.TxID, migrationWid, row.OpeningBalance, wid); err != nil {
+				return err
+			}
+		}
+		row.Status = "created"
+	}
+	return tx.Commit(ctx)
+}
+
+func userImportCounts(rows []*userImportRow) (map[string]int, int64) {
+	counts := map[string]int{}
+	var total int64
+	for _, row := range rows {
+		counts[row.Status]++
+		if row.Status == "created" {
+			total += row.OpeningBalance
+		}
+	}
+	return counts, total
+}
+
+// writeUserImportCSV writes the per-row report.
+func writeUserImportCSV(w io.Writer, rows []*userImportRow) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"row", "email", "username", "external_id", "opening_balance_kobo", "user_id", "tx_id", "status", "error"})
+	for _, row := range rows {
+		_ = cw.Write([]string{
+			strconv.Itoa(row.Row), row.Email, row.Username, row.ExternalID, strconv.FormatInt(row.OpeningBalance, 10),
+			row.UserID, row.TxID, row.Status, row.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+const importUsersUsage = `usage: api import-users [-dry-run] [-report FILE] users.csv
+
+Imports users, and their opening balances, from a CSV with a header row;
+see user_import.go for the columns. Nothing is written while any row is
+invalid. Users whose email is already registered are skipped, so the same
+file can be imported again after an interruption.
+
+  -dry-run       check every row but create nothing
+  -report FILE   write the per-row report as CSV (default: stdout)`
+
+// runImportUsersCommand implements `api import-users` and returns the exit
+// code: 0 when every row was imported or skipped, 1 otherwise.
+func runImportUsersCommand(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("import-users", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, importUsersUsage) }
+	dryRun := fs.Bool("dry-run", false, "check rows without importing")
+	reportPath := fs.String("report", "", "write the report here instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import-users:", err)
+		return 1
+	}
+	defer f.Close()
+	rows, err := parseUserImportCSV(f, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import-users:", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	pool, err := mydb.OpenPool(ctx, cfg.DatabaseURL, poolOptions(cfg.DBPool))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import-users:", err)
+		return 1
+	}
+	defer pool.Close()
+	batchKey := uuid.NewString()
+	if err := importUsers(ctx, pool, batchKey, rows, *dryRun); err != nil {
+		fmt.Fprintln(os.Stderr, "import-users:", err)
+		return 1
+	}
+
+	out := io.Writer(os.Stdout)
+	if *reportPath != "" {
+		rf, err := os.Create(*reportPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import-users:", err)
+			return 1
+		}
+		defer rf.Close()
+		out = rf
+	}
+	if err := writeUserImportCSV(out, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "import-users: report:", err)
+		return 1
+	}
+
+	counts, total := userImportCounts(rows)
+	fmt.Fprintf(os.Stderr, "import %s: %d rows, %d created, %d existing, %d invalid, %d failed, opening balances %d kobo",
+		batchKey, len(rows), counts["created"], counts["exists"], counts["invalid"], counts["failed"], total)
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, " (dry run: %d valid)", counts["valid"])
+	}
+	fmt.Fprintln(os.Stderr)
+	if counts["invalid"] > 0 || counts["failed"] > 0 {
+		return 1
+	}
+	return 0
+}
+
+// ---------- Handlers (Admin) ----------
+
+// POST /v1/admin/users/import[?dryRun=true][&format=csv]
+// Body: CSV (text/csv) or multipart form field "file"; see the columns above.
+func (app *App) AdminImportUsers(w http.ResponseWriter, r *http.Request) {
+	src, ok := csvUpload(w, r)
+	if !ok {
+		return
+	}
+	defer src.Close()
+
+	rows, err := parseUserImportCSV(src, app.Settings.Int(r.Context(), settings.UserImportMaxRows))
+	if errors.Is(err, errBulkTooLarge) {
+		apierror.Write(w, apierror.New(http.StatusRequestEntityTooLarge, "too_many_rows"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_csv").WithMessage(err.Error()))
+		return
+	}
+	if len(rows) == 0 {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "empty_csv"))
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	batchKey := uuid.NewString()
+	if err := importUsers(r.Context(), app.DB, batchKey, rows, dryRun); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("user import failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	counts, total := userImportCounts(rows)
+	status := http.StatusOK
+	if counts["invalid"] > 0 {
+		status = http.StatusUnprocessableEntity
+	} else if !dryRun {
+		app.audit(r, auditEntry{
+			Action:     "user.import",
+			TargetType: "user_import",
+			TargetID:   batchKey,
+			After:      map[string]any{"rows": len(rows), "openingBalances": total, "counts": counts},
+		})
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="okies-user-import-`+batchKey+`.csv"`)
+		w.WriteHeader(status)
+		_ = writeUserImportCSV(w, rows)
+		return
+	}
+	writeJSON(w, status, map[string]any{"data": map[string]any{
+		"batchKey":        batchKey,
+		"dryRun":          dryRun,
+		"total":           len(rows),
+		"counts":          counts,
+		"openingBalances": total,
+		"rows":            rows,
+	}})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	a "github.com/sudo-init-do/okies-backend/pkg/auth"
+)
+
+var (
+	errAccountSuspended   = errors.New("account suspended")
+	errAccountBanned      = errors.New("account banned")
+	errAccountDeactivated = errors.New("account deactivated")
+)
+
+// checkAccountActive returns errAccountSuspended / errAccountBanned when the
+// user may not act, or errAccountDeactivated when they froze the account
+// themselves. Suspensions past their expiry count as active.
+func (app *App) checkAccountActive(ctx context.Context, userID string) error {
+	u, err := app.userByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	switch u.Status {
+	case "banned":
+		return errAccountBanned
+	case "suspended":
+		if u.StatusExpiresAt == nil || time.Now().Before(*u.StatusExpiresAt) {
+			return errAccountSuspended
+		}
+	}
+	if u.DeactivatedAt != nil {
+		return errAccountDeactivated
+	}
+	return nil
+}
+
+// checkCanMoveMoney gates outgoing money movement: the account must be active
+// and not frozen by fraud review.
+func (app *App) checkCanMoveMoney(ctx context.Context, userID string) error {
+	if err := app.checkAccountActive(ctx, userID); err != nil {
+		return err
+	}
+	return app.checkNotFrozen(ctx, userID)
+}
+
+// accountStatusError writes the response for a checkAccountActive/checkNotFrozen
+// failure and reports whether it did.
+func accountStatusError(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return false
+	}
+	apierror.Write(w, accountStatusAPIError(err))
+	return true
+}
+
+// accountStatusAPIError maps a checkAccountActive/checkNotFrozen failure to
+// its API error. API errors pass through; anything else is a 500.
+func accountStatusAPIError(err error) *apierror.Error {
+	var e *apierror.Error
+	switch {
+	case errors.Is(err, errAccountBanned):
+		return apierror.New(http.StatusForbidden, "account_banned")
+	case errors.Is(err, errAccountSuspended):
+		return apierror.New(http.StatusForbidden, "account_suspended")
+	case errors.Is(err, errAccountDeactivated):
+		return apierror.New(http.StatusForbidden, "account_deactivated")
+	case errors.Is(err, errAccountFrozen):
+		return apierror.New(http.StatusForbidden, "account_frozen")
+	case errors.As(err, &e):
+		return e
+	}
+	return apierror.New(http.StatusInternalServerError, "db_error").Wrap(err)
+}
+
+// PUT /v1/admin/users/{id}/status  {"status":"active|suspended|banned","reason":"...","expiresAt":"RFC3339"}
+func (app *App) AdminSetUserStatus(w http.ResponseWriter, r *http.Request) {
+	actor, _ := getUserID(r)
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	var body struct {
+		Status    string     `json:"status" validate:"required,oneof=active suspended banned"`
+		Reason    string     `json:"reason" validate:"max=500"`
+		ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	switch body.Status {
+	case "active":
+		body.ExpiresAt = nil
+	case "suspended":
+		if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+			apierror.Write(w, apierror.New(http.StatusBadRequest, "expiry_in_past"))
+			return
+		}
+	case "banned":
+		body.ExpiresAt = nil
+	default:
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "invalid_status"))
+		return
+	}
+	if body.Status != "active" && body.Reason == "" {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "reason_required"))
+		return
+	}
+	if actor == id {
+		apierror.Write(w, apierror.New(http.StatusBadRequest, "cannot_change_own_status"))
+		return
+	}
+	ctx := r.Context()
+
+	// only a superadmin may suspend or ban another admin
+	var role string
+	err := app.DB.QueryRow(ctx, `SELECT role FROM users WHERE id=$1`, id).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if actorRole, _ := getUserRole(r); a.IsAdminRole(role) && !a.IsSuperadmin(actorRole) {
+		apierror.Write(w, apierror.New(http.StatusForbidden, "cannot_change_admin_status"))
+		return
+	}
+
+	var prevStatus string
+	var prevReason *string
+	err = app.DB.QueryRow(ctx, `
+		WITH prev AS (SELECT status, status_reason FROM users WHERE id=$1 FOR UPDATE)
+		UPDATE users SET
+		  status=$2, status_reason=NULLIF($3,''), status_expires_at=$4,
+		  status_changed_by=$5, status_changed_at=now()
+		FROM prev
+		WHERE users.id=$1
+		RETURNING prev.status, prev.status_reason
+	`, id, body.Status, body.Reason, body.ExpiresAt, actor).Scan(&prevStatus, &prevReason)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("user_id", id).Msg("update user status failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	app.invalidateUser(ctx, id)
+
+	// Bans end every session immediately; suspensions are enforced per request
+	if body.Status == "banned" {
+		if _, err := app.DB.Exec(ctx, `UPDATE refresh_tokens SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL`, id); err != nil {
+			log.Ctx(r.Context()).Error().Err(err).Str("user_id", id).Msg("revoke sessions on ban failed")
+		}
+	}
+
+	data := map[string]any{"status": body.Status, "reason": body.Reason}
+	if body.ExpiresAt != nil {
+		data["expiresAt"] = body.ExpiresAt
+	}
+	app.notify(ctx, id, "account_status", data)
+	// a suspended or banned user can't sign in to read the notification
+	app.sendEmail(ctx, id, "account_status", data)
+
+	app.audit(r, auditEntry{
+		Action:     "user.status_change",
+		TargetType: "user",
+		TargetID:   id,
+		Before:     map[string]any{"status": prevStatus, "reason": prevReason},
+		After:      map[string]any{"status": body.Status, "reason": body.Reason, "expiresAt": body.ExpiresAt},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"userId":    id,
+		"status":    body.Status,
+		"reason":    body.Reason,
+		"expiresAt": body.ExpiresAt,
+	}})
+}
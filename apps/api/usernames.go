@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
+)
+
+// reservedUsernames can't be taken by users: routes, roles and words people
+// would read as speaking for Okies.
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "api": true, "app": true, "billing": true,
+	"compliance": true, "help": true, "helpdesk": true, "info": true, "me": true,
+	"moderator": true, "null": true, "official": true, "operator": true, "payments": true,
+	"root": true, "security": true, "staff": true, "support": true, "system": true,
+	"team": true, "undefined": true, "verified": true, "wallet": true,
+}
+
+// reservedUsernameParts can't appear anywhere in a username, so
+// "okies_support" or "the_admin" are refused too.
+var reservedUsernameParts = []string{"okies", "admin", "support", "official"}
+
+func reservedUsername(u string) bool {
+	u = strings.ToLower(u)
+	if reservedUsernames[u] {
+		return true
+	}
+	for _, p := range reservedUsernameParts {
+		if strings.Contains(u, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// usernameTaken reports whether u (in any case) belongs to someone other
+// than uid, or is still held for its previous owner. uid may be empty.
+func (app *App) usernameTaken(ctx context.Context, u, uid string) (bool, error) {
+	var taken bool
+	err := app.DB.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE lower(username)=lower($1) AND id::text<>$2)
+		    OR EXISTS (SELECT 1 FROM username_redirects WHERE username=lower($1) AND expires_at > now() AND user_id::text<>$2)
+	`, u, uid).Scan(&taken)
+	return taken, err
+}
+
+// usernameConflict reports whether err is the unique index on usernames
+// refusing a write that lost a race with another user.
+func usernameConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && strings.Contains(pgErr.ConstraintName, "username")
+}
+
+// GET /v1/users/username-available?u=
+// Public, for the sign-up form; reason is invalid, reserved or taken when
+// the name isn't available.
+func (app *App) UsernameAvailable(w http.ResponseWriter, r *http.Request) {
+	u := strings.TrimSpace(r.URL.Query().Get("u"))
+	reason := ""
+	switch {
+	case !validate.Username(u):
+		reason = "invalid"
+	case reservedUsername(u):
+		reason = "reserved"
+	default:
+		taken, err := app.usernameTaken(r.Context(), u, "")
+		if err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+		if taken {
+			reason = "taken"
+		}
+	}
+	out := map[string]any{"username": u, "available": reason == ""}
+	if reason != "" {
+		out["reason"] = reason
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// PUT /v1/users/me/username  {"username":"ada_l"}
+// Changes are limited to one per users.username_cooldown_days. The old name
+// is held for the user for users.username_hold_days: it keeps resolving to
+// them, nobody else can take it, and they can switch back to it.
+func (app *App) SetMyUsername(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body struct {
+		Username string `json:"username" validate:"required,username"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if reservedUsername(body.Username) {
+		apierror.Write(w, apierror.New(http.StatusUnprocessableEntity, "username_reserved"))
+		return
+	}
+	ctx := r.Context()
+	verdict, e := app.screenName(ctx, "username", body.Username)
+	if e != nil {
+		apierror.Write(w, e)
+		return
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		current   *string
+		changedAt *time.Time
+	)
+	if err := tx.QueryRow(ctx, `
+		SELECT username, username_changed_at FROM users WHERE id=$1 FOR UPDATE
+	`, uid).Scan(&current, &changedAt); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if current != nil && *current == body.Username {
+		writeJSON(w, http.StatusOK, map[string]any{"data": app.loadUser(r, uid)})
+		return
+	}
+	// fixing the case of the same name is not a change
+	caseOnly := current != nil && strings.EqualFold(*current, body.Username)
+	cooldown := time.Duration(app.Settings.Int(ctx, settings.UsernameCooldownDays)) * 24 * time.Hour
+	if !caseOnly && changedAt != nil && time.Since(*changedAt) < cooldown {
+		apierror.Write(w, apierror.New(http.StatusConflict, "username_change_cooldown"))
+		return
+	}
+	taken, err := app.usernameTaken(ctx, body.Username, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if taken {
+		apierror.Write(w, apierror.New(http.StatusConflict, "username_in_use"))
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE users SET username=$2, username_changed_at = CASE WHEN $3 THEN username_changed_at ELSE now() END
+		WHERE id=$1
+	`, uid, body.Username, caseOnly); err != nil {
+		if usernameConflict(err) {
+			apierror.Write(w, apierror.New(http.StatusConflict, "username_in_use"))
+			return
+		}
+		log.Ctx(ctx).Error().Err(err).Str("user_id", uid).Msg("update username failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	// taking back a held name ends its hold
+	if _, err := tx.Exec(ctx, `DELETE FROM username_redirects WHERE username=lower($1)`, body.Username); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if current != nil && !caseOnly {
+		hold := app.Settings.Int(ctx, settings.UsernameHoldDays)
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO username_redirects (username, user_id, expires_at)
+			VALUES (lower($1), $2, now() + make_interval(days => $3))
+			ON CONFLICT (username) DO UPDATE
+			  SET user_id=EXCLUDED.user_id, created_at=now(), expires_at=EXCLUDED.expires_at
+		`, *current, uid, hold); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+	app.invalidateUser(ctx, uid)
+	if !caseOnly {
+		app.queueNameReview(ctx, uid, "username", body.Username, verdict)
+	}
+	app.recordSecurityEvent(r, uid, secUsernameChanged, map[string]any{"from": current, "to": body.Username})
+	writeJSON(w, http.StatusOK, map[string]any{"data": app.loadUser(r, uid)})
+}
+
+// handleHosts are the hosts of shareable profile links.
+var handleHosts = []string{"okies.app/", "www.okies.app/"}
+
+// parseHandle accepts "@ada", "ada", "okies.app/ada" or
+// "https://okies.app/@ada?ref=share" and returns the username in it.
+func parseHandle(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "https://"), "http://")
+	for _, h := range handleHosts {
+		if len(s) >= len(h) && strings.EqualFold(s[:len(h)], h) {
+			s = s[len(h):]
+			break
+		}
+	}
+	if i := strings.IndexAny(s, "?#"); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimPrefix(strings.TrimSuffix(s, "/"), "@")
+	return s, validate.Username(s)
+}
+
+// GET /v1/resolve?handle=@ada
+// What the app calls when a shared profile link is opened: the recipient
+// to show on the send-money screen. A username released within the hold
+// period still resolves to its previous owner, with redirected set and
+// the owner's current username in the recipient. Users hiding from search
+// still resolve, as the link is theirs to share, but only by exact handle;
+// unknown, banned and erased users are all user_not_found. acceptsGifts is
+// false when the recipient only takes gifts from contacts and the caller
+// isn't one.
+func (app *App) ResolveHandle(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	handle, ok := parseHandle(r.URL.Query().Get("handle"))
+	if !ok {
+		apierror.Write(w, apierror.InvalidField("handle"))
+		return
+	}
+	ctx := r.Context()
+
+	var (
+		u          UserMini
+		redirected bool
+	)
+	err := app.DB.QueryRow(ctx, `
+		SELECT u.id, u.username, u.display_name, u.avatar_url, false FROM users u
+		WHERE lower(u.username)=lower($1) AND `+listedUser+`
+		UNION ALL
+		SELECT u.id, u.username, u.display_name, u.avatar_url, true FROM username_redirects h
+		JOIN users u ON u.id = h.user_id
+		WHERE h.username=lower($1) AND h.expires_at > now() AND `+listedUser+`
+		ORDER BY 5 -- a current username wins over a held one
+		LIMIT 1
+	`, handle).Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarURL, &redirected)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "user_not_found"))
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("handle", handle).Msg("resolve handle failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	accepts := true
+	if u.ID != uid {
+		if accepts, err = app.acceptsGiftFrom(ctx, uid, u.ID); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"recipient":    u,
+		"redirected":   redirected,
+		"acceptsGifts": accepts,
+	}})
+}
@@ -3,43 +3,98 @@ package main
 import (
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+	"github.com/sudo-init-do/okies-backend/pkg/validate"
 )
 
+// listedUser is the SQL condition (on users u) for users others can find
+// and pay: customers not banned, suspended or erased.
+const listedUser = `u.role = 'user' AND u.anonymized_at IS NULL AND u.status <> 'banned'
+		AND NOT (u.status = 'suspended' AND (u.status_expires_at IS NULL OR u.status_expires_at > now()))`
+
 type UserMini struct {
 	ID          string  `json:"id"`
-	Email       string  `json:"email"`
 	Username    *string `json:"username,omitempty"`
 	DisplayName *string `json:"displayName,omitempty"`
+	AvatarURL   *string `json:"avatarUrl,omitempty"`
 }
 
+// GET /v1/users/search?query=&limit=&cursor=
+// Matches usernames and display names, best first: an exact username (or
+// verified phone number), then usernames starting with the query, then
+// fuzzy matches (similar spelling, or a word of the display name). A
+// leading @ is ignored. Phone numbers match only in full. Banned,
+// suspended and erased users, staff accounts and users hiding from search
+// are left out, and emails are neither searched nor returned.
 func (app *App) SearchUsers(w http.ResponseWriter, r *http.Request) {
-	q := strings.TrimSpace(r.URL.Query().Get("query"))
+	q := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("query")), "@"))
+	// the cursor is only valid for the query it came from
+	pg, ok := app.parsePage(w, r, "users.search:"+q, pagination.Standard)
+	if !ok {
+		return
+	}
 	if q == "" {
-		writeJSON(w, http.StatusOK, map[string]any{"data": []UserMini{}})
+		writeJSON(w, http.StatusOK, map[string]any{"data": []UserMini{}, "paging": pagination.Paging{Limit: pg.Limit}})
 		return
 	}
-	qpat := "%" + strings.ToLower(q) + "%"
-	rows, err := app.DB.Query(r.Context(), `
-		SELECT id, email, username, display_name
-		FROM users
-		WHERE lower(email) LIKE $1 OR lower(username) LIKE $1
-		ORDER BY created_at DESC
-		LIMIT 20
-	`, qpat)
+	prefix := likeEscaper.Replace(q) + "%"
+	var phone *string
+	if p, ok := validate.Phone(q); ok {
+		phone = &p
+	}
+	afterRank, afterAt, afterID := pg.AfterRankArgs()
+	rows, err := app.Reads.Read().Query(r.Context(), `
+		SELECT id, username, display_name, avatar_url, created_at, score FROM (
+		  SELECT u.id, u.username, u.display_name, u.avatar_url, u.created_at,
+		         (CASE WHEN lower(u.username) = $1 OR u.phone = $7::text THEN 3
+		               WHEN lower(u.username) LIKE $2 ESCAPE '\' THEN 2
+		               ELSE 0 END
+		          + LEAST(1, GREATEST(similarity(lower(coalesce(u.username, '')), $1),
+		                              similarity(lower(coalesce(u.display_name, '')), $1),
+		                              ts_rank(to_tsvector('simple', coalesce(u.display_name, '')), plainto_tsquery('simple', $1)))))::float8 AS score
+		  FROM users u
+		  WHERE (lower(u.username) LIKE $2 ESCAPE '\'
+		         OR u.phone = $7::text
+		         OR lower(u.username) % $1
+		         OR lower(u.display_name) % $1
+		         OR to_tsvector('simple', coalesce(u.display_name, '')) @@ plainto_tsquery('simple', $1))
+		    AND `+listedUser+` AND NOT u.hide_from_search
+		) s
+		WHERE $3::float8 IS NULL OR (score, created_at, id) < ($3, $4::timestamptz, $5::uuid)
+		ORDER BY score DESC, created_at DESC, id DESC
+		LIMIT $6
+	`, q, prefix, afterRank, afterAt, afterID, pg.Limit+1, phone)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "db_error")
+		log.Ctx(r.Context()).Error().Err(err).Msg("search users failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
 	defer rows.Close()
 
-	var out []UserMini
+	type row struct {
+		UserMini           // marshals as its fields
+		at       time.Time // cursor key
+		score    float64   // cursor key
+	}
+	out := []row{}
 	for rows.Next() {
-		var u UserMini
-		if err := rows.Scan(&u.ID, &u.Email, &u.Username, &u.DisplayName); err != nil {
-			httpError(w, http.StatusInternalServerError, "scan_error")
+		var u row
+		if err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarURL, &u.at, &u.score); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
 			return
 		}
 		out = append(out, u)
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+	out, paging := pagination.Trim(pg, out, func(u row) pagination.Key {
+		return pagination.Key{Rank: u.score, Time: u.at, ID: u.ID}
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
 }
+
+// likeEscaper escapes LIKE wildcards, underscores being common in usernames.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/pagination"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// API versioning. The version is the path prefix (/v1, /v2). v2 exists for
+// breaking changes only (problem+json errors, cursor pagination); an
+// endpoint that doesn't change is mounted under /v2 with its v1 handler,
+// and handlers that differ in small ways branch on apiVersion(r) rather
+// than being copied. A v1 route with a v2 replacement is marked Deprecated.
+
+type apiVersionKeyType struct{}
+
+var apiVersionKey apiVersionKeyType
+
+// Version tags requests with API version n and echoes it in the
+// API-Version response header, which also selects the error format.
+func Version(n int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(apierror.VersionHeader, strconv.Itoa(n))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey, n)))
+		})
+	}
+}
+
+// apiVersion returns the API version the request was routed to.
+func apiVersion(r *http.Request) int {
+	if n, ok := r.Context().Value(apiVersionKey).(int); ok {
+		return n
+	}
+	return 1
+}
+
+// Deprecated marks a route as replaced by successor (RFC 9745 Deprecation,
+// RFC 8594 Sunset when a removal date is set).
+func Deprecated(successor string, sunset time.Time) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// mountV2 registers the /v2 routes on r.
+func (app *App) mountV2(r chi.Router) {
+	r.Use(Version(2))
+
+	r.With(app.RateLimit(settings.RateLimitLogin), StrictJSON).Post("/auth/login", app.Login)
+	r.With(app.RateLimit(settings.RateLimitRefresh), StrictJSON).Post("/auth/refresh", app.Refresh)
+
+	r.Group(func(pr chi.Router) {
+		pr.Use(app.AuthMiddleware, StrictJSON)
+
+		// unchanged from v1
+		pr.Get("/auth/me", app.Me)
+		pr.With(Cacheable(0, true)).Get("/wallet", app.GetWallet)
+
+		// cursor pagination
+		pr.With(Cacheable(0, true)).Get("/wallet/transactions", app.ListWalletTransactionsV2)
+	})
+}
+
+// GET /v2/wallet/transactions?limit=20&cursor=
+// Newest first. paging.nextCursor is absent on the last page.
+func (app *App) ListWalletTransactionsV2(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	walletID, err := app.walletIDForUser(r.Context(), uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "wallet_not_found"))
+		return
+	}
+	pg, ok := app.parsePage(w, r, "wallet.transactions", pagination.Standard)
+	if !ok {
+		return
+	}
+	afterAt, afterID := pg.AfterArgs()
+
+	rows, err := app.Reads.Read().Query(r.Context(), `
+		SELECT t.id, t.kind,
+		       COALESCE(SUM(CASE WHEN le.wallet_id=$1 AND le.direction='credit' THEN le.amount ELSE -le.amount END),0) AS delta,
+		       t.currency, t.created_at
+		FROM transactions t
+		JOIN ledger_entries le ON le.tx_id = t.id
+		WHERE le.wallet_id = $1
+		  AND ($2::timestamptz IS NULL OR (t.created_at, t.id) < ($2, $3::uuid))
+		GROUP BY t.id
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT $4
+	`, walletID, afterAt, afterID, pg.Limit+1)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	type row struct {
+		TxDTO           // marshals as its fields
+		at    time.Time // cursor key
+	}
+	out := []row{}
+	for rows.Next() {
+		var t row
+		if err := rows.Scan(&t.ID, &t.Kind, &t.AmountDelta, &t.Currency, &t.at); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		t.CreatedAt = t.at.UTC().Format(time.RFC3339)
+		out = append(out, t)
+	}
+	if rows.Err() != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "rows_error"))
+		return
+	}
+
+	out, paging := pagination.Trim(pg, out, func(t row) pagination.Key { return pagination.Key{Time: t.at, ID: t.ID} })
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": paging})
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+)
+
+// ---------- Types ----------
+
+type createVoucherReq struct {
+	Amount        int64 `json:"amount" validate:"kobo"`
+	ExpiresInDays int   `json:"expiresInDays,omitempty" validate:"gte=0"`
+	AllowPartial  bool  `json:"allowPartial,omitempty"`
+}
+
+type redeemVoucherReq struct {
+	Code   string `json:"code" validate:"required,max=64"`
+	Amount int64  `json:"amount,omitempty" validate:"omitempty,kobo"` // optional; defaults to the full remaining value
+}
+
+type voucherDTO struct {
+	ID           string    `json:"id"`
+	Code         string    `json:"code,omitempty"` // only returned once, at issue time
+	CodeLast4    string    `json:"codeLast4"`
+	FundedBy     string    `json:"fundedBy"`
+	Amount       int64     `json:"amount"`
+	Remaining    int64     `json:"remaining"`
+	Currency     string    `json:"currency"`
+	AllowPartial bool      `json:"allowPartial"`
+	Status       string    `json:"status"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+var (
+	errInsufficientFunds = errors.New("insufficient funds")
+	errVoucherNotFound   = errors.New("voucher not found")
+	errVoucherInactive   = errors.New("voucher not active")
+	errVoucherAmount     = errors.New("invalid redemption amount")
+)
+
+// ---------- Helpers ----------
+
+func newVoucherCode() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i := range buf {
+		buf[i] = referralAlphabet[int(buf[i])%len(referralAlphabet)]
+	}
+	s := string(buf)
+	return "OKV-" + s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16], nil
+}
+
+func hashVoucherCode(code string) string {
+	c := strings.ToUpper(strings.TrimSpace(code))
+	c = strings.ReplaceAll(c, "-", "")
+	c = strings.TrimPrefix(c, "OKV")
+	sum := sha256.Sum256([]byte(c))
+	return hex.EncodeToString(sum[:])
+}
+
+func voucherTTL(days, maxDays int) time.Duration {
+	if days <= 0 {
+		days = 90
+	}
+	if days > maxDays {
+		days = maxDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// issueVoucher creates a voucher. User-funded vouchers move the value from the
+// issuer's wallet into the system wallet; admin vouchers are backed by the
+// system wallet already and post nothing until redemption.
+func (app *App) issueVoucher(ctx context.Context, issuerID, fundedBy string, body createVoucherReq) (voucherDTO, error) {
+	code, err := newVoucherCode()
+	if err != nil {
+		return voucherDTO{}, err
+	}
+	_, systemWid, err := app.systemUserAndWallet(ctx)
+	if err != nil {
+		return voucherDTO{}, err
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return voucherDTO{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if fundedBy == "user" {
+		userWid, err := app.walletIDForUser(ctx, issuerID)
+		if err != nil {
+			return voucherDTO{}, err
+		}
+		if err := app.lockWallets(ctx, tx, systemWid, userWid); err != nil {
+			return voucherDTO{}, err
+		}
+		balance, err := balanceOf(ctx, tx, userWid)
+		if err != nil {
+			return voucherDTO{}, err
+		}
+		if balance < body.Amount {
+			return voucherDTO{}, errInsufficientFunds
+		}
+		var txID string
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+			VALUES ($1,'voucher_issue',$2,'NGN','{}'::jsonb)
+			RETURNING id
+		`, "voucher-issue-"+uuid.NewString(), body.Amount).Scan(&txID); err != nil {
+			return voucherDTO{}, err
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+			VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+		`, txID, userWid, body.Amount, systemWid); err != nil {
+			return voucherDTO{}, err
+		}
+	}
+
+	v := voucherDTO{Code: code, CodeLast4: code[len(code)-4:], FundedBy: fundedBy, AllowPartial: body.AllowPartial}
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO vouchers (code_hash, code_last4, issuer_user_id, funded_by, amount, remaining, allow_partial, expires_at)
+		VALUES ($1,$2,$3,$4,$5,$5,$6,$7)
+		RETURNING id, amount, remaining, currency, status, expires_at, created_at
+	`, hashVoucherCode(code), v.CodeLast4, issuerID, fundedBy, body.Amount, body.AllowPartial, time.Now().Add(voucherTTL(body.ExpiresInDays, app.Settings.Int(ctx, settings.VoucherMaxDays)))).
+		Scan(&v.ID, &v.Amount, &v.Remaining, &v.Currency, &v.Status, &v.ExpiresAt, &v.CreatedAt); err != nil {
+		return voucherDTO{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return voucherDTO{}, err
+	}
+	return v, nil
+}
+
+// sweepExpiredVouchers marks past-expiry vouchers expired and returns any
+// unredeemed value of user-funded vouchers to the issuer.
+func (app *App) sweepExpiredVouchers(ctx context.Context) (int, error) {
+	rows, err := app.DB.Query(ctx, `
+		SELECT id FROM vouchers
+		WHERE status='active' AND expires_at <= now()
+		ORDER BY expires_at
+		LIMIT 500
+	`)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	_, systemWid, err := app.systemUserAndWallet(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	swept := 0
+	for _, id := range ids {
+		if err := app.sweepVoucher(ctx, id, systemWid); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("voucher_id", id).Msg("voucher sweep failed")
+			continue
+		}
+		swept++
+	}
+	return swept, nil
+}
+
+func (app *App) sweepVoucher(ctx context.Context, id, systemWid string) error {
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var issuerID, fundedBy, status string
+	var remaining int64
+	if err := tx.QueryRow(ctx, `
+		SELECT issuer_user_id, funded_by, status, remaining
+		FROM vouchers WHERE id=$1 FOR UPDATE
+	`, id).Scan(&issuerID, &fundedBy, &status, &remaining); err != nil {
+		return err
+	}
+	if status != "active" {
+		return nil
+	}
+
+	if fundedBy == "user" && remaining > 0 {
+		var issuerWid string
+		if err := tx.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id=$1`, issuerID).Scan(&issuerWid); err != nil {
+			return err
+		}
+		if err := app.lockWallets(ctx, tx, systemWid, issuerWid); err != nil {
+			return err
+		}
+		var txID string
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+			VALUES ($1,'voucher_sweep',$2,'NGN', jsonb_build_object('voucherId', $3::text))
+			RETURNING id
+		`, "voucher:"+id+":sweep", remaining, id).Scan(&txID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+			VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+		`, txID, systemWid, remaining, issuerWid); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE vouchers SET status='expired', remaining=0, updated_at=now() WHERE id=$1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// runVoucherSweeper periodically sweeps expired vouchers until ctx is done.
+func (app *App) runVoucherSweeper(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := app.sweepExpiredVouchers(ctx)
+			if err != nil {
+				log.Ctx(ctx).Error().Err(err).Msg("voucher sweeper failed")
+			} else if n > 0 {
+				log.Ctx(ctx).Info().Int("count", n).Msg("expired vouchers swept")
+			}
+		}
+	}
+}
+
+func voucherError(err error) *apierror.Error {
+	switch {
+	case errors.Is(err, errInsufficientFunds):
+		return apierror.New(http.StatusBadRequest, "insufficient_funds")
+	case errors.Is(err, errVoucherNotFound):
+		return apierror.New(http.StatusNotFound, "voucher_not_found")
+	case errors.Is(err, errVoucherInactive):
+		return apierror.New(http.StatusConflict, "voucher_not_active")
+	case errors.Is(err, errVoucherAmount):
+		return apierror.New(http.StatusBadRequest, "invalid_redemption_amount")
+	}
+	return apierror.New(http.StatusInternalServerError, "voucher_error").Wrap(err)
+}
+
+// ---------- Handlers (User) ----------
+
+// POST /v1/vouchers
+func (app *App) CreateVoucher(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body createVoucherReq
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if accountStatusError(w, app.checkCanMoveMoney(r.Context(), uid)) {
+		return
+	}
+
+	v, err := app.issueVoucher(r.Context(), uid, "user", body)
+	if err != nil {
+		e := voucherError(err)
+		if e.Status == http.StatusInternalServerError {
+			log.Ctx(r.Context()).Error().Err(err).Str("user_id", uid).Msg("issue voucher failed")
+		}
+		apierror.Write(w, e)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"data": v})
+}
+
+// GET /v1/vouchers
+func (app *App) ListMyVouchers(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT id, code_last4, funded_by, amount, remaining, currency, allow_partial, status, expires_at, created_at
+		FROM vouchers
+		WHERE issuer_user_id=$1
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	out := []voucherDTO{}
+	for rows.Next() {
+		var v voucherDTO
+		if err := rows.Scan(&v.ID, &v.CodeLast4, &v.FundedBy, &v.Amount, &v.Remaining, &v.Currency, &v.AllowPartial, &v.Status, &v.ExpiresAt, &v.CreatedAt); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		out = append(out, v)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": out})
+}
+
+// POST /v1/vouchers/redeem
+func (app *App) RedeemVoucher(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body redeemVoucherReq
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	ctx := r.Context()
+
+	userWid, err := app.walletIDForUser(ctx, uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "wallet_not_found"))
+		return
+	}
+	_, systemWid, err := app.systemUserAndWallet(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "system_wallet_missing"))
+		return
+	}
+
+	idem := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if idem == "" {
+		idem = "voucher-redeem-" + uuid.NewString()
+	}
+
+	tx, err := app.DB.Begin(ctx)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_begin_error"))
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var existing string
+	err = tx.QueryRow(ctx, `SELECT id FROM transactions WHERE idempotency_key=$1`, idem).Scan(&existing)
+	if err == nil && existing != "" {
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"redemptionTxId": existing, "status": "succeeded"}})
+		return
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	var (
+		voucherID, status string
+		remaining         int64
+		allowPartial      bool
+		expiresAt         time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT id, status, remaining, allow_partial, expires_at
+		FROM vouchers WHERE code_hash=$1 FOR UPDATE
+	`, hashVoucherCode(body.Code)).Scan(&voucherID, &status, &remaining, &allowPartial, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, voucherError(errVoucherNotFound))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	if status != "active" || remaining == 0 || time.Now().After(expiresAt) {
+		apierror.Write(w, voucherError(errVoucherInactive))
+		return
+	}
+
+	amount := body.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	// partial rules: non-partial vouchers redeem in one go; partial ones may not overdraw
+	if amount > remaining || (!allowPartial && amount != remaining) {
+		apierror.Write(w, voucherError(errVoucherAmount))
+		return
+	}
+
+	if err := app.lockWallets(ctx, tx, systemWid, userWid); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "lock_wallets_error"))
+		return
+	}
+
+	var txID string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO transactions (idempotency_key, kind, amount, currency, metadata)
+		VALUES ($1,'voucher_redeem',$2,'NGN', jsonb_build_object('voucherId', $3::text))
+		RETURNING id
+	`, idem, amount, voucherID).Scan(&txID); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_tx_error"))
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO ledger_entries (tx_id, wallet_id, direction, amount)
+		VALUES ($1,$2,'debit',$3), ($1,$4,'credit',$3)
+	`, txID, systemWid, amount, userWid); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_ledger_error"))
+		return
+	}
+
+	left := remaining - amount
+	newStatus := "active"
+	if left == 0 {
+		newStatus = "redeemed"
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE vouchers SET remaining=$2, status=$3, updated_at=now() WHERE id=$1
+	`, voucherID, left, newStatus); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "update_voucher_error"))
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO voucher_redemptions (voucher_id, user_id, amount, tx_id) VALUES ($1,$2,$3,$4)
+	`, voucherID, uid, amount, txID); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "insert_redemption_error"))
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "tx_commit_error"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"data": map[string]any{
+			"redemptionTxId": txID,
+			"voucherId":      voucherID,
+			"amount":         amount,
+			"remaining":      left,
+			"status":         "succeeded",
+		},
+	})
+}
+
+// ---------- Handlers (Admin) ----------
+
+// POST /v1/admin/vouchers
+func (app *App) AdminCreateVoucher(w http.ResponseWriter, r *http.Request) {
+	uid, ok := getUserID(r)
+	if !ok {
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
+		return
+	}
+	var body createVoucherReq
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	v, err := app.issueVoucher(r.Context(), uid, "admin", body)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("admin_id", uid).Msg("admin issue voucher failed")
+		apierror.Write(w, voucherError(err))
+		return
+	}
+	app.audit(r, auditEntry{
+		Action:     "voucher.create",
+		TargetType: "voucher",
+		TargetID:   v.ID,
+		After:      map[string]any{"amount": v.Amount, "allowPartial": v.AllowPartial, "expiresAt": v.ExpiresAt},
+	})
+	writeJSON(w, http.StatusCreated, map[string]any{"data": v})
+}
+
+// GET /v1/admin/vouchers/liability
+func (app *App) AdminVoucherLiability(w http.ResponseWriter, r *http.Request) {
+	rows, err := app.DB.Query(r.Context(), `
+		SELECT funded_by,
+		       COUNT(*),
+		       COALESCE(SUM(remaining),0),
+		       COUNT(*) FILTER (WHERE expires_at <= now()),
+		       COALESCE(SUM(remaining) FILTER (WHERE expires_at <= now()),0)
+		FROM vouchers
+		WHERE status='active'
+		GROUP BY funded_by
+	`)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+	defer rows.Close()
+
+	type bucket struct {
+		FundedBy       string `json:"fundedBy"`
+		Count          int64  `json:"count"`
+		Outstanding    int64  `json:"outstanding"`
+		AwaitingSweep  int64  `json:"awaitingSweep"`
+		AwaitingAmount int64  `json:"awaitingSweepAmount"`
+	}
+	out := []bucket{}
+	var total int64
+	for rows.Next() {
+		var b bucket
+		if err := rows.Scan(&b.FundedBy, &b.Count, &b.Outstanding, &b.AwaitingSweep, &b.AwaitingAmount); err != nil {
+			apierror.Write(w, apierror.New(http.StatusInternalServerError, "scan_error"))
+			return
+		}
+		total += b.Outstanding
+		out = append(out, b)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"currency":         "NGN",
+		"totalOutstanding": total,
+		"byFunding":        out,
+	}})
+}
+
+// POST /v1/admin/vouchers/sweep
+func (app *App) AdminSweepVouchers(w http.ResponseWriter, r *http.Request) {
+	n, err := app.sweepExpiredVouchers(r.Context())
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("manual voucher sweep failed")
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "sweep_error"))
+		return
+	}
+	app.audit(r, auditEntry{Action: "voucher.sweep", TargetType: "voucher", After: map[string]any{"swept": n}})
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"swept": n}})
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"strconv"
+	"time"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
 )
 
 type WalletDTO struct {
@@ -15,29 +19,25 @@ type TxDTO struct {
 	Kind        string `json:"kind"`
 	AmountDelta int64  `json:"amountDelta"` // +credit / -debit for THIS wallet
 	Currency    string `json:"currency"`
-	CreatedAt   string `json:"createdAt"`
+	CreatedAt   string `json:"createdAt"` // RFC 3339 in the user's time zone
 }
 
 func (app *App) GetWallet(w http.ResponseWriter, r *http.Request) {
 	uid, ok := getUserID(r)
 	if !ok {
-		httpError(w, http.StatusUnauthorized, "not_authenticated")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
 		return
 	}
 
-	var walletID string
-	if err := app.DB.QueryRow(r.Context(), `SELECT id FROM wallets WHERE user_id=$1`, uid).Scan(&walletID); err != nil {
-		httpError(w, http.StatusNotFound, "wallet_not_found")
+	walletID, err := app.walletIDForUser(r.Context(), uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "wallet_not_found"))
 		return
 	}
 
-	var balance int64
-	if err := app.DB.QueryRow(r.Context(), `
-		SELECT COALESCE(SUM(CASE WHEN direction='credit' THEN amount ELSE -amount END),0)
-		FROM ledger_entries
-		WHERE wallet_id=$1
-	`, walletID).Scan(&balance); err != nil {
-		httpError(w, http.StatusInternalServerError, "db_error")
+	balance, err := app.walletBalance(r.Context(), walletID)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
 		return
 	}
 
@@ -47,13 +47,13 @@ func (app *App) GetWallet(w http.ResponseWriter, r *http.Request) {
 func (app *App) ListWalletTransactions(w http.ResponseWriter, r *http.Request) {
 	uid, ok := getUserID(r)
 	if !ok {
-		httpError(w, http.StatusUnauthorized, "not_authenticated")
+		apierror.Write(w, apierror.New(http.StatusUnauthorized, "not_authenticated"))
 		return
 	}
 
-	var walletID string
-	if err := app.DB.QueryRow(r.Context(), `SELECT id FROM wallets WHERE user_id=$1`, uid).Scan(&walletID); err != nil {
-		httpError(w, http.StatusNotFound, "wallet_not_found")
+	walletID, err := app.walletIDForUser(r.Context(), uid)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusNotFound, "wallet_not_found"))
 		return
 	}
 
@@ -70,11 +70,22 @@ func (app *App) ListWalletTransactions(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	rows, err := app.DB.Query(r.Context(), `
+	out, err := app.walletTransactions(r.Context(), walletID, app.userLocation(r.Context(), uid), limit, offset)
+	if err != nil {
+		apierror.Write(w, apierror.New(http.StatusInternalServerError, "db_error"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": map[string]any{"limit": limit, "offset": offset}})
+}
+
+// walletTransactions returns a page of walletID's transactions, newest
+// first, with times in loc. It reads from a replica when one is healthy.
+func (app *App) walletTransactions(ctx context.Context, walletID string, loc *time.Location, limit, offset int) ([]TxDTO, error) {
+	rows, err := app.Reads.Read().Query(ctx, `
 		SELECT t.id, t.kind,
 		       COALESCE(SUM(CASE WHEN le.wallet_id=$1 AND le.direction='credit' THEN le.amount ELSE -le.amount END),0) AS delta,
-		       t.currency,
-		       to_char(t.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+		       t.currency, t.created_at
 		FROM transactions t
 		JOIN ledger_entries le ON le.tx_id = t.id
 		WHERE le.wallet_id = $1
@@ -83,24 +94,19 @@ func (app *App) ListWalletTransactions(w http.ResponseWriter, r *http.Request) {
 		LIMIT $2 OFFSET $3
 	`, walletID, limit, offset)
 	if err != nil {
-		httpError(w, http.StatusInternalServerError, "db_error")
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	var out []TxDTO
 	for rows.Next() {
 		var t TxDTO
-		if err := rows.Scan(&t.ID, &t.Kind, &t.AmountDelta, &t.Currency, &t.CreatedAt); err != nil {
-			httpError(w, http.StatusInternalServerError, "scan_error")
-			return
+		var at time.Time
+		if err := rows.Scan(&t.ID, &t.Kind, &t.AmountDelta, &t.Currency, &at); err != nil {
+			return nil, err
 		}
+		t.CreatedAt = at.In(loc).Format(time.RFC3339)
 		out = append(out, t)
 	}
-	if rows.Err() != nil {
-		httpError(w, http.StatusInternalServerError, "rows_error")
-		return
-	}
-
-	writeJSON(w, http.StatusOK, map[string]any{"data": out, "paging": map[string]any{"limit": limit, "offset": offset}})
+	return out, rows.Err()
 }
@@ -0,0 +1,50 @@
+// Command flwmock serves a fake Flutterwave API for local development and
+// CI; see pkg/flwmock for the scripted accounts and control endpoints.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sudo-init-do/okies-backend/pkg/flwmock"
+)
+
+func main() {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.TimeOnly})
+
+	addr := flag.String("addr", ":8090", "listen address")
+	outcome := flag.String("outcome", flwmock.Successful, "default transfer outcome: SUCCESSFUL, FAILED or NEW (left pending)")
+	responseDelay := flag.Duration("response-delay", 0, "delay before every API response")
+	webhookDelay := flag.Duration("webhook-delay", 2*time.Second, "delay between a transfer and its webhook")
+	webhookURL := flag.String("webhook-url", "http://localhost:8081/v1/webhooks/flutterwave", "where webhooks go when a transfer has no callback_url")
+	webhookHash := flag.String("webhook-hash", "dev_webhook_hash", "verif-hash sent with webhooks; set FLW_WEBHOOK_HASH on the API to match")
+	balance := flag.Int64("balance-kobo", 100_000_000_00, "opening NGN balance in kobo")
+	secretKey := flag.String("secret-key", "", "bearer token API calls must carry; any token when empty")
+	flag.Parse()
+
+	switch *outcome {
+	case flwmock.Successful, flwmock.Failed, flwmock.Pending:
+	default:
+		log.Fatal().Str("outcome", *outcome).Msg("outcome must be SUCCESSFUL, FAILED or NEW")
+	}
+
+	srv := flwmock.New(flwmock.Options{
+		Outcome:       *outcome,
+		ResponseDelay: *responseDelay,
+		WebhookDelay:  *webhookDelay,
+		WebhookURL:    *webhookURL,
+		WebhookHash:   *webhookHash,
+		BalanceKobo:   *balance,
+		SecretKey:     *secretKey,
+	})
+	log.Info().Str("addr", *addr).Str("webhook_url", *webhookURL).Msg("flwmock listening")
+	s := &http.Server{Addr: *addr, Handler: srv.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	if err := s.ListenAndServe(); err != nil {
+		log.Fatal().Err(err).Msg("flwmock stopped")
+	}
+}
@@ -0,0 +1,299 @@
+// Command loadtest drives gift and withdrawal traffic at a running API and
+// reports throughput, latency percentiles and status codes per operation.
+// It signs up its own users and funds them through an admin login, so point
+// it at a development stack seeded with `api seed`:
+//
+//	go run ./apps/loadtest -duration 1m -concurrency 32 -hot
+//
+// Gifts are rate limited per user (ratelimit.gifts); use more -users or
+// raise the limit through the admin settings API when 429s dominate.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type options struct {
+	api           string
+	adminEmail    string
+	adminPassword string
+	users         int
+	concurrency   int
+	duration      time.Duration
+	withdrawRatio float64
+	hot           bool
+	amount        int64
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.api, "api", "http://localhost:8081", "API base URL")
+	flag.StringVar(&o.adminEmail, "admin-email", "admin@okies.local", "superadmin or finance login used to fund test users")
+	flag.StringVar(&o.adminPassword, "admin-password", "okies-dev-password", "password for -admin-email")
+	flag.IntVar(&o.users, "users", 20, "number of sending users")
+	flag.IntVar(&o.concurrency, "concurrency", 20, "concurrent requests")
+	flag.DurationVar(&o.duration, "duration", 30*time.Second, "how long to send traffic")
+	flag.Float64Var(&o.withdrawRatio, "withdraw-ratio", 0.2, "share of operations that are withdrawals, 0 to 1")
+	flag.BoolVar(&o.hot, "hot", false, "send every gift to one recipient instead of spreading them")
+	flag.Int64Var(&o.amount, "amount-kobo", 100_00, "amount of each gift and withdrawal")
+	flag.Parse()
+
+	if o.users < 1 || o.concurrency < 1 || o.withdrawRatio < 0 || o.withdrawRatio > 1 {
+		fmt.Fprintln(os.Stderr, "loadtest: -users and -concurrency must be positive and -withdraw-ratio between 0 and 1")
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, o); err != nil {
+		fmt.Fprintln(os.Stderr, "loadtest:", err)
+		os.Exit(1)
+	}
+}
+
+// user is one signed-in account with a saved payout destination.
+type user struct {
+	id, token, ip, dest string
+}
+
+func run(ctx context.Context, o options) error {
+	c := &apiClient{base: o.api, http: &http.Client{Timeout: 30 * time.Second}}
+
+	admin, err := c.login(o.adminEmail, o.adminPassword, randomIP())
+	if err != nil {
+		return fmt.Errorf("admin login: %w", err)
+	}
+
+	fmt.Printf("preparing %d users...\n", o.users)
+	stamp := time.Now().UnixNano()
+	// a hundred thousand operations each, more than any run gets through
+	funding := o.amount * 100_000
+	senders := make([]*user, o.users)
+	recipients := make([]*user, o.users)
+	for i := range senders {
+		if senders[i], err = c.newUser(fmt.Sprintf("load-%d-s%d@example.com", stamp, i)); err != nil {
+			return err
+		}
+		if err := c.fund(admin, senders[i], funding); err != nil {
+			return err
+		}
+		if err := c.saveDestination(senders[i], fmt.Sprintf("03%08d", i)); err != nil {
+			return err
+		}
+		if o.hot && i > 0 {
+			recipients[i] = recipients[0]
+			continue
+		}
+		if recipients[i], err = c.newUser(fmt.Sprintf("load-%d-r%d@example.com", stamp, i)); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("sending for %s with %d workers...\n", o.duration, o.concurrency)
+	ctx, cancel := context.WithTimeout(ctx, o.duration)
+	defer cancel()
+	stats := newStats()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := range o.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := w; ctx.Err() == nil; n += o.concurrency {
+				i := n % o.users
+				op, path := "gift", "/v1/gifts"
+				body := map[string]any{"recipientUserId": recipients[i].id, "amount": o.amount}
+				if rand.Float64() < o.withdrawRatio {
+					op, path = "withdrawal", "/v1/withdrawals"
+					body = map[string]any{"destinationId": senders[i].dest, "amount": o.amount}
+				}
+				t := time.Now()
+				code, err := c.do(http.MethodPost, path, senders[i], body, nil)
+				if err != nil && ctx.Err() != nil {
+					return
+				}
+				stats.record(op, code, time.Since(t))
+			}
+		}()
+	}
+	wg.Wait()
+	stats.print(os.Stdout, time.Since(start))
+	return nil
+}
+
+// ---------- API client ----------
+
+type apiClient struct {
+	base string
+	http *http.Client
+}
+
+// do sends body as JSON as u and decodes the response's "data" into out. A
+// transport failure is reported as status 0.
+func (c *apiClient) do(method, path string, u *user, body, out any) (int, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(method, c.base+path, bytes.NewReader(raw))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if u != nil {
+		req.Header.Set("X-Forwarded-For", u.ip)
+		if u.token != "" {
+			req.Header.Set("Authorization", "Bearer "+u.token)
+		}
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil || out == nil || res.StatusCode >= 300 {
+		return res.StatusCode, err
+	}
+	var env struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		return res.StatusCode, err
+	}
+	if env.Data == nil {
+		env.Data = data
+	}
+	return res.StatusCode, json.Unmarshal(env.Data, out)
+}
+
+func (c *apiClient) expect(want int, method, path string, u *user, body, out any) error {
+	code, err := c.do(method, path, u, body, out)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	if code != want {
+		return fmt.Errorf("%s %s: status %d, want %d", method, path, code, want)
+	}
+	return nil
+}
+
+func (c *apiClient) login(email, password, ip string) (*user, error) {
+	u := &user{ip: ip}
+	var res struct {
+		Tokens struct {
+			AccessToken string `json:"accessToken"`
+		} `json:"tokens"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	if err := c.expect(http.StatusOK, http.MethodPost, "/v1/auth/login", u, map[string]any{"email": email, "password": password}, &res); err != nil {
+		return nil, err
+	}
+	u.id, u.token = res.User.ID, res.Tokens.AccessToken
+	return u, nil
+}
+
+// newUser signs up email from its own address, so the per-IP sign-up limit
+// doesn't stop the preparation.
+func (c *apiClient) newUser(email string) (*user, error) {
+	const password = "load test password"
+	ip := randomIP()
+	if err := c.expect(http.StatusCreated, http.MethodPost, "/v1/auth/signup", &user{ip: ip}, map[string]any{"email": email, "password": password}, nil); err != nil {
+		return nil, err
+	}
+	return c.login(email, password, ip)
+}
+
+func (c *apiClient) fund(admin, u *user, amount int64) error {
+	return c.expect(http.StatusCreated, http.MethodPost, "/v1/admin/topups", admin, map[string]any{"userId": u.id, "amount": amount}, nil)
+}
+
+func (c *apiClient) saveDestination(u *user, accountNumber string) error {
+	var dest struct {
+		ID string `json:"id"`
+	}
+	err := c.expect(http.StatusCreated, http.MethodPost, "/v1/payout-destinations", u, map[string]any{
+		"bankCode": "058", "accountNumber": accountNumber, "accountName": "Load Test",
+	}, &dest)
+	u.dest = dest.ID
+	return err
+}
+
+func randomIP() string {
+	return fmt.Sprintf("10.%d.%d.%d", rand.IntN(256), rand.IntN(256), rand.IntN(254)+1)
+}
+
+// ---------- Results ----------
+
+type opStats struct {
+	latencies []time.Duration
+	codes     map[int]int
+}
+
+type stats struct {
+	mu  sync.Mutex
+	ops map[string]*opStats
+}
+
+func newStats() *stats {
+	return &stats{ops: map[string]*opStats{}}
+}
+
+func (s *stats) record(op string, code int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.ops[op]
+	if st == nil {
+		st = &opStats{codes: map[int]int{}}
+		s.ops[op] = st
+	}
+	st.latencies = append(st.latencies, d)
+	st.codes[code]++
+}
+
+func (s *stats) print(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.ops))
+	for name := range s.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "\n%-11s %8s %8s %9s %9s %9s %9s  %s\n", "op", "count", "req/s", "p50", "p95", "p99", "max", "statuses")
+	for _, name := range names {
+		st := s.ops[name]
+		slices.Sort(st.latencies)
+		codes := make([]int, 0, len(st.codes))
+		for code := range st.codes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		var statuses string
+		for _, code := range codes {
+			statuses += fmt.Sprintf(" %d×%d", code, st.codes[code])
+		}
+		n := len(st.latencies)
+		fmt.Fprintf(w, "%-11s %8d %8.1f %9s %9s %9s %9s %s\n", name, n, float64(n)/elapsed.Seconds(),
+			percentile(st.latencies, 0.50), percentile(st.latencies, 0.95), percentile(st.latencies, 0.99), st.latencies[n-1].Round(time.Millisecond), statuses)
+	}
+}
+
+// percentile expects sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(p*float64(len(sorted)-1))].Round(time.Millisecond)
+}
@@ -0,0 +1,7 @@
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal'));
+
+DROP INDEX IF EXISTS idx_referrals_referrer;
+DROP TABLE IF EXISTS referrals;
+ALTER TABLE users DROP COLUMN IF EXISTS referral_code;
@@ -0,0 +1,21 @@
+-- Referral program: per-user invite codes + attribution of referred signups
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS referral_code TEXT UNIQUE;
+
+CREATE TABLE IF NOT EXISTS referrals (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  referrer_id   UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  referred_id   UUID        NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE, -- a user can only be referred once
+  status        TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','rewarded','flagged')),
+  signup_ip     TEXT,
+  reward_amount BIGINT      NOT NULL DEFAULT 0,                                      -- kobo credited to EACH party
+  rewarded_at   TIMESTAMPTZ,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (referrer_id <> referred_id)
+);
+CREATE INDEX IF NOT EXISTS idx_referrals_referrer ON referrals(referrer_id, created_at DESC);
+
+-- Allow every kind the API actually writes (reserve/refund were missing from 0005)
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward'));
@@ -0,0 +1,6 @@
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward'));
+
+DROP TABLE IF EXISTS voucher_redemptions;
+DROP TABLE IF EXISTS vouchers;
@@ -0,0 +1,35 @@
+-- Prepaid voucher codes. Funds sit in the system wallet while a voucher is
+-- outstanding; `remaining` is the live liability.
+CREATE TABLE IF NOT EXISTS vouchers (
+  id             UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  code_hash      TEXT        NOT NULL UNIQUE,          -- sha256(code) hex; plaintext is shown once at issue
+  code_last4     TEXT        NOT NULL,
+  issuer_user_id UUID        NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+  funded_by      TEXT        NOT NULL CHECK (funded_by IN ('user','admin')),
+  amount         BIGINT      NOT NULL CHECK (amount > 0),
+  remaining      BIGINT      NOT NULL CHECK (remaining >= 0),
+  currency       TEXT        NOT NULL DEFAULT 'NGN',
+  allow_partial  BOOLEAN     NOT NULL DEFAULT FALSE,
+  status         TEXT        NOT NULL DEFAULT 'active' CHECK (status IN ('active','redeemed','expired')),
+  expires_at     TIMESTAMPTZ NOT NULL,
+  created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (remaining <= amount)
+);
+CREATE INDEX IF NOT EXISTS idx_vouchers_issuer ON vouchers(issuer_user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_vouchers_active_expiry ON vouchers(expires_at) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS voucher_redemptions (
+  id          UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  voucher_id  UUID        NOT NULL REFERENCES vouchers(id) ON DELETE CASCADE,
+  user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  amount      BIGINT      NOT NULL CHECK (amount > 0),
+  tx_id       UUID        NOT NULL REFERENCES transactions(id) ON DELETE RESTRICT,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_voucher_redemptions_voucher ON voucher_redemptions(voucher_id);
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep'));
@@ -0,0 +1,20 @@
+-- Every admin mutation, with before/after state and request correlation.
+-- Supersedes admin_audits (0012), which the API never wrote to.
+CREATE TABLE IF NOT EXISTS audit_logs (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  actor_user_id UUID        NOT NULL REFERENCES users(id),
+  actor_role    TEXT        NOT NULL,
+  action        TEXT        NOT NULL,               -- e.g. topup.create, withdrawal.approve
+  target_type   TEXT        NOT NULL,               -- user | payout | voucher | ...
+  target_id     TEXT,
+  before_value  JSONB,
+  after_value   JSONB,
+  request_id    TEXT,
+  ip            TEXT,
+  user_agent    TEXT,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_audit_logs_created ON audit_logs(created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_audit_logs_actor ON audit_logs(actor_user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_audit_logs_target ON audit_logs(target_type, target_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_audit_logs_action ON audit_logs(action, created_at DESC);
@@ -0,0 +1,6 @@
+-- Split the single admin role into support / finance / superadmin
+UPDATE users SET role = 'superadmin' WHERE role = 'admin';
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+  CHECK (role IN ('user','support','finance','superadmin'));
@@ -0,0 +1,6 @@
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep'));
+
+DROP TABLE IF EXISTS ledger_adjustments;
@@ -0,0 +1,25 @@
+-- Manual ledger corrections: proposed by one admin, posted only after a
+-- second, different admin approves (maker-checker).
+CREATE TABLE IF NOT EXISTS ledger_adjustments (
+  id           UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id      UUID        NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+  direction    TEXT        NOT NULL CHECK (direction IN ('credit','debit')), -- from the user's point of view
+  amount       BIGINT      NOT NULL CHECK (amount > 0),
+  currency     TEXT        NOT NULL DEFAULT 'NGN',
+  reason       TEXT        NOT NULL,
+  status       TEXT        NOT NULL DEFAULT 'proposed' CHECK (status IN ('proposed','approved','rejected')),
+  proposed_by  UUID        NOT NULL REFERENCES users(id),
+  reviewed_by  UUID        REFERENCES users(id),
+  review_note  TEXT,
+  reviewed_at  TIMESTAMPTZ,
+  tx_id        UUID        REFERENCES transactions(id) ON DELETE RESTRICT,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (reviewed_by IS NULL OR reviewed_by <> proposed_by)
+);
+CREATE INDEX IF NOT EXISTS ix_ledger_adjustments_status ON ledger_adjustments(status, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_ledger_adjustments_user ON ledger_adjustments(user_id, created_at DESC);
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep','adjustment'));
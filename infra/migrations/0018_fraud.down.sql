@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS fraud_cases;
+DROP TABLE IF EXISTS fraud_rules;
+ALTER TABLE users DROP COLUMN IF EXISTS frozen_at;
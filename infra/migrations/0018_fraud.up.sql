@@ -0,0 +1,45 @@
+-- Money freeze set by fraud review: blocks outgoing movements (gifts, withdrawals)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS frozen_at TIMESTAMPTZ;
+
+-- Configurable fraud rules evaluated on money events
+CREATE TABLE IF NOT EXISTS fraud_rules (
+  id          UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  name        TEXT        NOT NULL UNIQUE,
+  event       TEXT        NOT NULL CHECK (event IN ('gift','deposit','withdrawal')),
+  kind        TEXT        NOT NULL CHECK (kind IN ('amount_threshold','velocity','new_device_new_destination')),
+  params      JSONB       NOT NULL DEFAULT '{}',
+  enabled     BOOLEAN     NOT NULL DEFAULT TRUE,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Review queue
+CREATE TABLE IF NOT EXISTS fraud_cases (
+  id           UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id      UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  rule_id      UUID        REFERENCES fraud_rules(id) ON DELETE SET NULL,
+  rule_name    TEXT        NOT NULL,
+  event        TEXT        NOT NULL,
+  subject_type TEXT        NOT NULL,              -- transaction | payout
+  subject_id   TEXT        NOT NULL,
+  details      JSONB       NOT NULL DEFAULT '{}',
+  status       TEXT        NOT NULL DEFAULT 'open' CHECK (status IN ('open','cleared','actioned')),
+  resolution   TEXT,                              -- freeze | reject
+  review_note  TEXT,
+  reviewed_by  UUID        REFERENCES users(id),
+  reviewed_at  TIMESTAMPTZ,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_fraud_cases_status ON fraud_cases(status, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_fraud_cases_user ON fraud_cases(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_fraud_cases_subject ON fraud_cases(subject_type, subject_id);
+
+-- Starter rules (amounts in kobo)
+INSERT INTO fraud_rules (name, event, kind, params) VALUES
+  ('large_gift',               'gift',       'amount_threshold',           '{"minAmount": 50000000}'),
+  ('gift_velocity',            'gift',       'velocity',                   '{"windowMinutes": 10, "maxCount": 20, "maxAmount": 100000000}'),
+  ('large_deposit',            'deposit',    'amount_threshold',           '{"minAmount": 100000000}'),
+  ('large_withdrawal',         'withdrawal', 'amount_threshold',           '{"minAmount": 50000000}'),
+  ('withdrawal_velocity',      'withdrawal', 'velocity',                   '{"windowMinutes": 60, "maxCount": 5, "maxAmount": 200000000}'),
+  ('new_device_new_destination','withdrawal','new_device_new_destination', '{"destinationAgeHours": 24, "deviceAgeHours": 24}')
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,14 @@
+DELETE FROM fraud_rules WHERE kind IN ('gift_fan_in','circular_flow');
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep','adjustment'));
+
+DROP TABLE IF EXISTS held_gifts;
+
+ALTER TABLE fraud_rules DROP CONSTRAINT IF EXISTS fraud_rules_kind_check;
+ALTER TABLE fraud_rules ADD CONSTRAINT fraud_rules_kind_check
+  CHECK (kind IN ('amount_threshold','velocity','new_device_new_destination'));
+ALTER TABLE fraud_rules DROP CONSTRAINT IF EXISTS fraud_rules_action_check;
+ALTER TABLE fraud_rules DROP COLUMN IF EXISTS action;
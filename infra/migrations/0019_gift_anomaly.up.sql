@@ -0,0 +1,35 @@
+-- Gift anomaly rules (fan-in bursts, circular flows) that can HOLD a gift
+-- instead of settling it. Held value sits in the system wallet until review.
+ALTER TABLE fraud_rules
+  ADD COLUMN IF NOT EXISTS action TEXT NOT NULL DEFAULT 'flag';
+ALTER TABLE fraud_rules DROP CONSTRAINT IF EXISTS fraud_rules_action_check;
+ALTER TABLE fraud_rules ADD CONSTRAINT fraud_rules_action_check CHECK (action IN ('flag','hold'));
+
+ALTER TABLE fraud_rules DROP CONSTRAINT IF EXISTS fraud_rules_kind_check;
+ALTER TABLE fraud_rules ADD CONSTRAINT fraud_rules_kind_check
+  CHECK (kind IN ('amount_threshold','velocity','new_device_new_destination','gift_fan_in','circular_flow'));
+
+CREATE TABLE IF NOT EXISTS held_gifts (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  sender_id     UUID        NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+  recipient_id  UUID        NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+  amount        BIGINT      NOT NULL CHECK (amount > 0),
+  currency      TEXT        NOT NULL DEFAULT 'NGN',
+  hold_tx_id    UUID        NOT NULL UNIQUE REFERENCES transactions(id) ON DELETE RESTRICT,
+  settle_tx_id  UUID        REFERENCES transactions(id) ON DELETE RESTRICT,
+  status        TEXT        NOT NULL DEFAULT 'held' CHECK (status IN ('held','released','returned')),
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  resolved_at   TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS ix_held_gifts_status ON held_gifts(status, created_at DESC);
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep','adjustment',
+                  'gift_hold','gift_release','gift_return'));
+
+INSERT INTO fraud_rules (name, event, kind, params, action) VALUES
+  ('gift_fan_in_burst',  'gift', 'gift_fan_in',   '{"windowMinutes": 15, "maxCount": 10, "maxEachAmount": 100000}', 'hold'),
+  ('circular_gift_flow', 'gift', 'circular_flow', '{"windowMinutes": 60}',                                       'hold')
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS notifications;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users
+  DROP COLUMN IF EXISTS status_changed_at,
+  DROP COLUMN IF EXISTS status_changed_by,
+  DROP COLUMN IF EXISTS status_expires_at,
+  DROP COLUMN IF EXISTS status_reason,
+  DROP COLUMN IF EXISTS status;
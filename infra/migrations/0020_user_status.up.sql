@@ -0,0 +1,23 @@
+-- Account status: suspended (optionally until a time) or banned
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS status            TEXT NOT NULL DEFAULT 'active',
+  ADD COLUMN IF NOT EXISTS status_reason     TEXT,
+  ADD COLUMN IF NOT EXISTS status_expires_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS status_changed_by UUID REFERENCES users(id),
+  ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users ADD CONSTRAINT users_status_check CHECK (status IN ('active','suspended','banned'));
+
+-- In-app notifications delivered to users
+CREATE TABLE IF NOT EXISTS notifications (
+  id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  kind       TEXT        NOT NULL,
+  title      TEXT        NOT NULL,
+  body       TEXT        NOT NULL,
+  data       JSONB       NOT NULL DEFAULT '{}',
+  read_at    TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_notifications_user ON notifications(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
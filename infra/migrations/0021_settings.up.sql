@@ -0,0 +1,7 @@
+-- runtime settings; keys are defined in pkg/settings
+CREATE TABLE IF NOT EXISTS settings (
+  key         TEXT        PRIMARY KEY,
+  value       TEXT        NOT NULL,
+  updated_by  UUID        REFERENCES users(id) ON DELETE SET NULL,
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
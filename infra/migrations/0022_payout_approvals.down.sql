@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS payout_approvals;
+ALTER TABLE payouts DROP CONSTRAINT IF EXISTS payouts_status_check;
+ALTER TABLE payouts ADD CONSTRAINT payouts_status_check
+  CHECK (status IN ('pending','processing','succeeded','failed','cancelled'));
@@ -0,0 +1,13 @@
+-- approve/reject were being written without being allowed by the check
+ALTER TABLE payouts DROP CONSTRAINT IF EXISTS payouts_status_check;
+ALTER TABLE payouts ADD CONSTRAINT payouts_status_check
+  CHECK (status IN ('pending','processing','approved','rejected','succeeded','failed','cancelled'));
+
+-- one row per admin sign-off; large payouts need two distinct approvers
+CREATE TABLE IF NOT EXISTS payout_approvals (
+  payout_id     UUID        NOT NULL REFERENCES payouts(id) ON DELETE CASCADE,
+  approver_id   UUID        NOT NULL REFERENCES users(id),
+  approver_role TEXT        NOT NULL,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (payout_id, approver_id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS data_requests;
+ALTER TABLE users DROP COLUMN IF EXISTS anonymized_at;
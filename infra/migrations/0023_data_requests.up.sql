@@ -0,0 +1,20 @@
+-- Set once a user's personal data has been erased; the row stays for the ledger
+ALTER TABLE users ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMPTZ;
+
+-- Subject-access exports and erasures, kept as compliance evidence
+CREATE TABLE IF NOT EXISTS data_requests (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id       UUID        NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+  kind          TEXT        NOT NULL CHECK (kind IN ('export','deletion')),
+  status        TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','completed','failed')),
+  source        TEXT        NOT NULL DEFAULT 'admin' CHECK (source IN ('admin','self')),
+  requested_by  UUID        NOT NULL REFERENCES users(id),
+  reason        TEXT,
+  reference     TEXT,                     -- ticket / correspondence id
+  result        JSONB,                    -- export payload
+  evidence      JSONB,                    -- hashes, row counts, failure detail
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at  TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS ix_data_requests_user ON data_requests(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_data_requests_status ON data_requests(status, created_at DESC);
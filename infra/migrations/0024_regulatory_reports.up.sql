@@ -0,0 +1,13 @@
+-- Threshold-based currency transaction reports (NFIU CTR style), one per UTC day
+CREATE TABLE IF NOT EXISTS regulatory_reports (
+  id                UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  report_date       DATE        NOT NULL,
+  kind              TEXT        NOT NULL DEFAULT 'ctr' CHECK (kind IN ('ctr')),
+  single_threshold  BIGINT      NOT NULL,
+  daily_threshold   BIGINT      NOT NULL,
+  row_count         INT         NOT NULL,
+  rows              JSONB       NOT NULL,
+  generated_by      UUID        REFERENCES users(id), -- NULL when generated by the scheduler
+  generated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (kind, report_date)
+);
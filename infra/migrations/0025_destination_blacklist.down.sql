@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS destination_blacklist;
+ALTER TABLE payout_destinations DROP COLUMN IF EXISTS bvn;
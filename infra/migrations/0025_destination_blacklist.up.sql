@@ -0,0 +1,17 @@
+-- BVN of the account holder, when known (user-supplied or from account lookup)
+ALTER TABLE payout_destinations ADD COLUMN IF NOT EXISTS bvn TEXT;
+
+-- Bank accounts / BVNs tied to fraud. block refuses the destination or
+-- withdrawal outright; flag lets it through but opens a fraud case.
+CREATE TABLE IF NOT EXISTS destination_blacklist (
+  id          UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  kind        TEXT        NOT NULL CHECK (kind IN ('account_number','bvn')),
+  value       TEXT        NOT NULL,
+  bank_code   TEXT,                  -- account_number only; NULL matches any bank
+  action      TEXT        NOT NULL DEFAULT 'block' CHECK (action IN ('block','flag')),
+  reason      TEXT        NOT NULL,
+  created_by  UUID        NOT NULL REFERENCES users(id),
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_destination_blacklist
+  ON destination_blacklist (kind, value, COALESCE(bank_code, ''));
@@ -0,0 +1,28 @@
+-- User support requests, optionally tied to a transaction or withdrawal
+CREATE TABLE IF NOT EXISTS support_tickets (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id       UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  subject_type  TEXT        CHECK (subject_type IN ('transaction','payout')),
+  subject_id    UUID,
+  subject       TEXT        NOT NULL,
+  status        TEXT        NOT NULL DEFAULT 'open' CHECK (status IN ('open','awaiting_user','resolved')),
+  resolution    TEXT,
+  resolved_by   UUID        REFERENCES users(id),
+  resolved_at   TIMESTAMPTZ,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK ((subject_type IS NULL) = (subject_id IS NULL))
+);
+CREATE INDEX IF NOT EXISTS ix_support_tickets_user ON support_tickets(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_support_tickets_status ON support_tickets(status, updated_at DESC);
+CREATE INDEX IF NOT EXISTS ix_support_tickets_subject ON support_tickets(subject_type, subject_id);
+
+CREATE TABLE IF NOT EXISTS support_ticket_messages (
+  id          UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  ticket_id   UUID        NOT NULL REFERENCES support_tickets(id) ON DELETE CASCADE,
+  author_id   UUID        NOT NULL REFERENCES users(id),
+  from_staff  BOOLEAN     NOT NULL DEFAULT FALSE,
+  body        TEXT        NOT NULL,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_support_ticket_messages_ticket ON support_ticket_messages(ticket_id, created_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS retention_runs;
+ALTER TABLE payouts DROP COLUMN IF EXISTS provider_response;
+DROP TABLE IF EXISTS webhook_events;
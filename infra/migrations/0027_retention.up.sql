@@ -0,0 +1,28 @@
+-- Raw webhook deliveries, kept so disputes can be replayed; payload is purged by retention
+CREATE TABLE IF NOT EXISTS webhook_events (
+  id                UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  provider          TEXT        NOT NULL,
+  event             TEXT        NOT NULL,
+  reference         TEXT,
+  payload           JSONB,
+  payload_purged_at TIMESTAMPTZ,
+  received_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_webhook_events_reference ON webhook_events(reference);
+CREATE INDEX IF NOT EXISTS ix_webhook_events_received ON webhook_events(received_at) WHERE payload IS NOT NULL;
+
+-- Last provider response seen for a payout
+ALTER TABLE payouts ADD COLUMN IF NOT EXISTS provider_response JSONB;
+
+-- One row per policy per retention run (scheduled or admin-triggered)
+CREATE TABLE IF NOT EXISTS retention_runs (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  policy        TEXT        NOT NULL,
+  dry_run       BOOLEAN     NOT NULL,
+  cutoff        TIMESTAMPTZ NOT NULL,
+  affected      BIGINT      NOT NULL,
+  error         TEXT,
+  triggered_by  UUID        REFERENCES users(id) ON DELETE SET NULL, -- NULL = scheduler
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_retention_runs_created ON retention_runs(created_at DESC);
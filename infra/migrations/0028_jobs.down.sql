@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS scheduled_gifts;
+DROP TABLE IF EXISTS statements;
+ALTER TABLE webhook_events DROP COLUMN IF EXISTS processed_at;
+DROP TABLE IF EXISTS jobs;
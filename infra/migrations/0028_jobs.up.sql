@@ -0,0 +1,57 @@
+-- Background job queue, worked by `api worker` with FOR UPDATE SKIP LOCKED
+CREATE TABLE IF NOT EXISTS jobs (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  kind          TEXT        NOT NULL,
+  payload       JSONB       NOT NULL DEFAULT '{}'::jsonb,
+  status        TEXT        NOT NULL DEFAULT 'pending'
+                            CHECK (status IN ('pending','running','succeeded','dead')),
+  attempts      INT         NOT NULL DEFAULT 0,
+  max_attempts  INT         NOT NULL DEFAULT 10,
+  run_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+  locked_at     TIMESTAMPTZ,
+  locked_by     TEXT,
+  last_error    TEXT,
+  unique_key    TEXT,       -- at most one job per key, whatever its status
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  finished_at   TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_jobs_unique_key ON jobs(unique_key) WHERE unique_key IS NOT NULL;
+CREATE INDEX IF NOT EXISTS ix_jobs_ready ON jobs(run_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS ix_jobs_running ON jobs(locked_at) WHERE status = 'running';
+
+-- Webhook deliveries are applied by the worker
+ALTER TABLE webhook_events ADD COLUMN IF NOT EXISTS processed_at TIMESTAMPTZ;
+
+-- Account statements, generated in the background
+CREATE TABLE IF NOT EXISTS statements (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id       UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  period_from   DATE        NOT NULL,
+  period_to     DATE        NOT NULL,
+  status        TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','ready','failed')),
+  content       JSONB,
+  error         TEXT,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at  TIMESTAMPTZ,
+  CHECK (period_to >= period_from)
+);
+CREATE INDEX IF NOT EXISTS ix_statements_user ON statements(user_id, created_at DESC);
+
+-- Gifts scheduled for later; settled by the worker at scheduled_at
+CREATE TABLE IF NOT EXISTS scheduled_gifts (
+  id               UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  sender_id        UUID        NOT NULL REFERENCES users(id),
+  recipient_id     UUID        NOT NULL REFERENCES users(id),
+  amount           BIGINT      NOT NULL CHECK (amount > 0),
+  note             TEXT,
+  idempotency_key  TEXT        NOT NULL,
+  scheduled_at     TIMESTAMPTZ NOT NULL,
+  status           TEXT        NOT NULL DEFAULT 'scheduled'
+                               CHECK (status IN ('scheduled','sending','sent','held','failed','cancelled')),
+  gift_id          UUID,
+  error            TEXT,
+  created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+  settled_at       TIMESTAMPTZ,
+  UNIQUE (sender_id, idempotency_key)
+);
+CREATE INDEX IF NOT EXISTS ix_scheduled_gifts_sender ON scheduled_gifts(sender_id, scheduled_at DESC);
@@ -0,0 +1,11 @@
+-- Push notification device tokens, one row per app install
+CREATE TABLE IF NOT EXISTS devices (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id       UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  platform      TEXT        NOT NULL CHECK (platform IN ('android','ios')),
+  token         TEXT        NOT NULL UNIQUE, -- a token moves with the install, not the user
+  app_version   TEXT,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_devices_user ON devices(user_id);
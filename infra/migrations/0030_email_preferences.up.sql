@@ -0,0 +1,8 @@
+-- Per-user opt-outs for optional email categories. A missing row means
+-- every category is enabled; security and account mail is always sent.
+CREATE TABLE IF NOT EXISTS email_preferences (
+  user_id       UUID        PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  transactions  BOOLEAN     NOT NULL DEFAULT true,
+  statements    BOOLEAN     NOT NULL DEFAULT true,
+  updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
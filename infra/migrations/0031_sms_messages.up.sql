@@ -0,0 +1,23 @@
+-- Outbound SMS, one row per message. Bodies of templates that carry a
+-- secret (OTPs) are not stored.
+CREATE TABLE IF NOT EXISTS sms_messages (
+  id                   UUID          PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id              UUID          REFERENCES users(id) ON DELETE SET NULL,
+  to_number            TEXT          NOT NULL,
+  template             TEXT          NOT NULL,
+  body                 TEXT,
+  provider             TEXT,
+  provider_message_id  TEXT,
+  status               TEXT          NOT NULL DEFAULT 'queued'
+                       CHECK (status IN ('queued','sent','delivered','undelivered','failed')),
+  error                TEXT,
+  cost                 NUMERIC(12,5),
+  cost_currency        TEXT,
+  created_at           TIMESTAMPTZ   NOT NULL DEFAULT now(),
+  sent_at              TIMESTAMPTZ,
+  updated_at           TIMESTAMPTZ   NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_sms_provider_message
+  ON sms_messages(provider, provider_message_id) WHERE provider_message_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS ix_sms_user ON sms_messages(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_sms_created ON sms_messages(created_at);
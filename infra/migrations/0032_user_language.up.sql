@@ -0,0 +1,4 @@
+-- Preferred language for notifications, and for API responses when the
+-- client sends no Accept-Language. NULL means not chosen (English).
+ALTER TABLE users ADD COLUMN IF NOT EXISTS language TEXT
+  CHECK (language IN ('en','pcm','yo','ha','ig'));
@@ -0,0 +1,2 @@
+ALTER TABLE statements DROP COLUMN IF EXISTS time_zone;
+ALTER TABLE users DROP COLUMN IF EXISTS time_zone;
@@ -0,0 +1,7 @@
+-- IANA time zone for the user's day boundaries and displayed times
+-- (statements, receipts, scheduled gifts). NULL means not chosen (Lagos).
+ALTER TABLE users ADD COLUMN IF NOT EXISTS time_zone TEXT;
+
+-- The zone a statement's period was requested in, so generating it later
+-- uses the same day boundaries. Earlier statements were whole UTC days.
+ALTER TABLE statements ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT 'UTC';
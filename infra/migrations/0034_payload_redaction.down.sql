@@ -0,0 +1,4 @@
+UPDATE webhook_events SET payload = payload_full WHERE payload_full IS NOT NULL;
+UPDATE payouts SET provider_response = provider_response_full WHERE provider_response_full IS NOT NULL;
+ALTER TABLE payouts DROP COLUMN IF EXISTS provider_response_full;
+ALTER TABLE webhook_events DROP COLUMN IF EXISTS payload_full;
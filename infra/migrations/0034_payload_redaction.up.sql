@@ -0,0 +1,26 @@
+-- Provider payloads are stored redacted (pkg/redact); the full body is kept
+-- alongside for disputes, readable only through the admin PII endpoints.
+-- Both copies are purged together by retention.
+ALTER TABLE webhook_events ADD COLUMN IF NOT EXISTS payload_full JSONB;
+ALTER TABLE payouts ADD COLUMN IF NOT EXISTS provider_response_full JSONB;
+
+-- Backfill: keep the originals as the full copy and mask the personal
+-- fields Flutterwave transfer events carry. New rows are redacted in full
+-- by the API.
+UPDATE webhook_events SET payload_full = payload WHERE payload IS NOT NULL AND payload_full IS NULL;
+UPDATE payouts SET provider_response_full = provider_response
+WHERE provider_response IS NOT NULL AND provider_response_full IS NULL;
+
+UPDATE webhook_events
+SET payload = jsonb_set(payload, '{data,account_number}', to_jsonb(
+      repeat('*', greatest(length(payload #>> '{data,account_number}') - 4, 0)) || right(payload #>> '{data,account_number}', 4)))
+WHERE payload #>> '{data,account_number}' IS NOT NULL;
+UPDATE webhook_events SET payload = jsonb_set(payload, '{data,fullname}', '"[REDACTED]"')
+WHERE payload #>> '{data,fullname}' IS NOT NULL;
+
+UPDATE payouts
+SET provider_response = jsonb_set(provider_response, '{data,account_number}', to_jsonb(
+      repeat('*', greatest(length(provider_response #>> '{data,account_number}') - 4, 0)) || right(provider_response #>> '{data,account_number}', 4)))
+WHERE provider_response #>> '{data,account_number}' IS NOT NULL;
+UPDATE payouts SET provider_response = jsonb_set(provider_response, '{data,fullname}', '"[REDACTED]"')
+WHERE provider_response #>> '{data,fullname}' IS NOT NULL;
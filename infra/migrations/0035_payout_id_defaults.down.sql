@@ -0,0 +1,2 @@
+ALTER TABLE payouts ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE payout_destinations ALTER COLUMN id DROP DEFAULT;
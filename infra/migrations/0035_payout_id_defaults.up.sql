@@ -0,0 +1,4 @@
+-- payout_destinations and payouts were created without id defaults, but
+-- the handlers insert without an id
+ALTER TABLE payout_destinations ALTER COLUMN id SET DEFAULT gen_random_uuid();
+ALTER TABLE payouts ALTER COLUMN id SET DEFAULT gen_random_uuid();
@@ -0,0 +1,10 @@
+-- deleted rows that aren't referenced go for good; referenced ones come back
+-- to keep the foreign key from payouts intact
+DELETE FROM payout_destinations d
+WHERE d.deleted_at IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM payouts p WHERE p.destination_id = d.id);
+DROP INDEX IF EXISTS ux_payout_destinations_live;
+ALTER TABLE payout_destinations
+  ADD CONSTRAINT payout_destinations_user_id_bank_code_account_number_key UNIQUE (user_id, bank_code, account_number);
+ALTER TABLE scheduled_gifts DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE payout_destinations DROP COLUMN IF EXISTS deleted_at;
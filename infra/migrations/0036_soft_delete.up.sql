@@ -0,0 +1,10 @@
+-- Payout destinations and scheduled gifts are soft deleted: deleted_at hides
+-- them from the owner's lists but keeps the row, so past withdrawals still
+-- render their bank details and a mistaken delete can be restored.
+ALTER TABLE payout_destinations ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE scheduled_gifts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- a deleted account can be added again as a new destination
+ALTER TABLE payout_destinations DROP CONSTRAINT IF EXISTS payout_destinations_user_id_bank_code_account_number_key;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_payout_destinations_live
+  ON payout_destinations(user_id, bank_code, account_number) WHERE deleted_at IS NULL;
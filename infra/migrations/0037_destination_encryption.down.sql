@@ -0,0 +1,9 @@
+-- Run `api rekey -decrypt` first: this leaves account_number and bvn as they
+-- are, and the previous release can't read sealed values.
+DROP INDEX IF EXISTS ux_payout_destinations_live;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_payout_destinations_live
+  ON payout_destinations(user_id, bank_code, account_number) WHERE deleted_at IS NULL;
+ALTER TABLE payout_destinations
+  DROP COLUMN IF EXISTS bvn_hash,
+  DROP COLUMN IF EXISTS account_last4,
+  DROP COLUMN IF EXISTS account_number_hash;
@@ -0,0 +1,14 @@
+-- account_number and bvn hold envelope-encrypted values (pkg/envelope).
+-- Lookups and uniqueness go through keyed hashes of the plaintext, and
+-- listings show account_last4. Rows saved before this stay in plaintext,
+-- without hashes, until `api rekey` seals them.
+ALTER TABLE payout_destinations
+  ADD COLUMN IF NOT EXISTS account_number_hash TEXT,
+  ADD COLUMN IF NOT EXISTS account_last4 TEXT,
+  ADD COLUMN IF NOT EXISTS bvn_hash TEXT;
+UPDATE payout_destinations SET account_last4 = right(account_number, 4) WHERE account_last4 IS NULL;
+ALTER TABLE payout_destinations ALTER COLUMN account_last4 SET NOT NULL;
+
+DROP INDEX IF EXISTS ux_payout_destinations_live;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_payout_destinations_live
+  ON payout_destinations(user_id, bank_code, account_number_hash) WHERE deleted_at IS NULL;
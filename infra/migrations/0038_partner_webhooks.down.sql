@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS partner_webhook_deliveries;
+DROP TABLE IF EXISTS partner_webhook_endpoints;
+DROP TABLE IF EXISTS partners;
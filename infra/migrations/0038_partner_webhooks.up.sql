@@ -0,0 +1,48 @@
+-- Partners integrate on behalf of one Okies account with an API key. Only a
+-- SHA-256 of the key is kept; key_prefix identifies it in listings.
+CREATE TABLE IF NOT EXISTS partners (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id       UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name          TEXT        NOT NULL,
+  key_prefix    TEXT        NOT NULL,
+  key_hash      TEXT        NOT NULL UNIQUE,
+  created_by    UUID        REFERENCES users(id),
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  revoked_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS ix_partners_user ON partners(user_id);
+
+-- Endpoints a partner receives events at. The signing secret is sealed
+-- (pkg/envelope) since it has to be read back to sign.
+CREATE TABLE IF NOT EXISTS partner_webhook_endpoints (
+  id          UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  partner_id  UUID        NOT NULL REFERENCES partners(id) ON DELETE CASCADE,
+  url         TEXT        NOT NULL,
+  events      TEXT[]      NOT NULL,
+  secret      TEXT        NOT NULL,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  deleted_at  TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS ix_partner_webhook_endpoints_partner
+  ON partner_webhook_endpoints(partner_id) WHERE deleted_at IS NULL;
+
+-- One row per event per endpoint; body is sent byte for byte on every
+-- attempt and redelivery.
+CREATE TABLE IF NOT EXISTS partner_webhook_deliveries (
+  id               UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  endpoint_id      UUID        NOT NULL REFERENCES partner_webhook_endpoints(id) ON DELETE CASCADE,
+  event_id         UUID        NOT NULL,
+  event            TEXT        NOT NULL,
+  body             TEXT        NOT NULL,
+  status           TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','delivered','failed')),
+  attempts         INT         NOT NULL DEFAULT 0,
+  response_status  INT,
+  response_body    TEXT,
+  last_error       TEXT,
+  created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+  delivered_at     TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS ix_partner_webhook_deliveries_endpoint
+  ON partner_webhook_deliveries(endpoint_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_partner_webhook_deliveries_event ON partner_webhook_deliveries(event_id);
@@ -0,0 +1,14 @@
+-- OAuth2 client credentials for partners. A partner may hold several
+-- clients, each limited to some scopes; only a SHA-256 of the secret is kept.
+CREATE TABLE IF NOT EXISTS partner_clients (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  partner_id    UUID        NOT NULL REFERENCES partners(id) ON DELETE CASCADE,
+  client_id     TEXT        NOT NULL UNIQUE,
+  secret_hash   TEXT        NOT NULL,
+  scopes        TEXT[]      NOT NULL,
+  created_by    UUID        REFERENCES users(id),
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at  TIMESTAMPTZ,
+  revoked_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS ix_partner_clients_partner ON partner_clients(partner_id);
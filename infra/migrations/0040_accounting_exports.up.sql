@@ -0,0 +1,18 @@
+-- Ledger journals for the accounting system, generated in the background.
+-- account_map is the mapping the file was built with.
+CREATE TABLE IF NOT EXISTS accounting_exports (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  format        TEXT        NOT NULL CHECK (format IN ('quickbooks_iif','xero_csv')),
+  period_from   DATE        NOT NULL,
+  period_to     DATE        NOT NULL,
+  status        TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','ready','failed')),
+  account_map   JSONB       NOT NULL,
+  content       TEXT,
+  journal_count INT,
+  error         TEXT,
+  requested_by  UUID        REFERENCES users(id),
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at  TIMESTAMPTZ,
+  CHECK (period_to >= period_from)
+);
+CREATE INDEX IF NOT EXISTS ix_accounting_exports_created ON accounting_exports(created_at DESC);
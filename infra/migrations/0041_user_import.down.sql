@@ -0,0 +1,16 @@
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep','adjustment',
+                  'gift_hold','gift_release','gift_return'));
+
+-- Only removable while nothing was imported against it
+DO $$
+DECLARE mig_id UUID;
+BEGIN
+  SELECT id INTO mig_id FROM users WHERE email = 'migration@okies.local';
+  IF mig_id IS NOT NULL THEN
+    DELETE FROM wallets WHERE user_id = mig_id;
+    DELETE FROM users WHERE id = mig_id;
+  END IF;
+END$$;
@@ -0,0 +1,23 @@
+-- User imports: accounts brought over from another platform, with their
+-- balances credited from a migration wallet so the ledger stays balanced
+-- and the carried-over total is visible in one place.
+DO $$
+DECLARE mig_id UUID;
+BEGIN
+  SELECT id INTO mig_id FROM users WHERE email = 'migration@okies.local';
+  IF mig_id IS NULL THEN
+    INSERT INTO users (email, password_hash, role, username, display_name)
+    VALUES ('migration@okies.local', '', 'superadmin', 'migration', 'Migration Account')
+    RETURNING id INTO mig_id;
+  END IF;
+
+  IF NOT EXISTS (SELECT 1 FROM wallets WHERE user_id = mig_id) THEN
+    INSERT INTO wallets (user_id, balance) VALUES (mig_id, 0);
+  END IF;
+END$$;
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep','adjustment',
+                  'gift_hold','gift_release','gift_return','opening_balance'));
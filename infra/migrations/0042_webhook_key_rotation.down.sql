@@ -0,0 +1,5 @@
+ALTER TABLE partner_webhook_endpoints
+  DROP COLUMN IF EXISTS previous_expires_at,
+  DROP COLUMN IF EXISTS previous_key_id,
+  DROP COLUMN IF EXISTS previous_secret,
+  DROP COLUMN IF EXISTS key_id;
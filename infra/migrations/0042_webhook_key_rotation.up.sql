@@ -0,0 +1,12 @@
+-- Webhook signing secrets get a key id, sent with each signature (see
+-- pkg/signing), and can be rotated: the previous secret keeps signing
+-- alongside the new one until previous_expires_at, so a partner can switch
+-- keys without rejecting deliveries.
+ALTER TABLE partner_webhook_endpoints
+  ADD COLUMN IF NOT EXISTS key_id              TEXT,
+  ADD COLUMN IF NOT EXISTS previous_secret     TEXT,
+  ADD COLUMN IF NOT EXISTS previous_key_id     TEXT,
+  ADD COLUMN IF NOT EXISTS previous_expires_at TIMESTAMPTZ;
+
+UPDATE partner_webhook_endpoints SET key_id = 'whk_' || substr(md5(id::text), 1, 12) WHERE key_id IS NULL;
+ALTER TABLE partner_webhook_endpoints ALTER COLUMN key_id SET NOT NULL;
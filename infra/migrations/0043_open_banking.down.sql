@@ -0,0 +1,9 @@
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep','adjustment',
+                  'gift_hold','gift_release','gift_return','opening_balance'));
+
+DROP TABLE IF EXISTS direct_debits;
+DROP TABLE IF EXISTS direct_debit_mandates;
+DROP TABLE IF EXISTS bank_links;
@@ -0,0 +1,65 @@
+-- Open banking: bank accounts users link through the provider (see
+-- pkg/openbanking), mandates that let us debit them, and the debits that
+-- fund wallets. Only the last four digits of a linked account are kept;
+-- balance is the provider's figure as of balance_at.
+CREATE TABLE IF NOT EXISTS bank_links (
+  id                   UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id              UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  provider             TEXT        NOT NULL,
+  provider_account_id  TEXT        NOT NULL,
+  institution          TEXT        NOT NULL,
+  bank_code            TEXT,
+  account_name         TEXT        NOT NULL,
+  account_last4        TEXT        NOT NULL,
+  balance              BIGINT,
+  balance_at           TIMESTAMPTZ,
+  created_at           TIMESTAMPTZ NOT NULL DEFAULT now(),
+  unlinked_at          TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_bank_links_provider_account
+  ON bank_links(provider, provider_account_id) WHERE unlinked_at IS NULL;
+CREATE INDEX IF NOT EXISTS ix_bank_links_user ON bank_links(user_id) WHERE unlinked_at IS NULL;
+
+-- A mandate is pending until the user approves it at their bank; the
+-- provider's id may only arrive with that approval.
+CREATE TABLE IF NOT EXISTS direct_debit_mandates (
+  id                   UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id              UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  bank_link_id         UUID        NOT NULL REFERENCES bank_links(id) ON DELETE CASCADE,
+  provider             TEXT        NOT NULL,
+  provider_mandate_id  TEXT,
+  reference            TEXT        NOT NULL UNIQUE,
+  max_amount           BIGINT      NOT NULL CHECK (max_amount > 0),
+  status               TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','active','cancelled','failed')),
+  authorize_url        TEXT,
+  error                TEXT,
+  expires_at           TIMESTAMPTZ NOT NULL,
+  created_at           TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at           TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_direct_debit_mandates_provider_id
+  ON direct_debit_mandates(provider, provider_mandate_id) WHERE provider_mandate_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS ix_direct_debit_mandates_user ON direct_debit_mandates(user_id, created_at DESC);
+
+-- One row per funding attempt. tx_id is set when the money lands.
+CREATE TABLE IF NOT EXISTS direct_debits (
+  id               UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id          UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  mandate_id       UUID        NOT NULL REFERENCES direct_debit_mandates(id),
+  amount           BIGINT      NOT NULL CHECK (amount > 0),
+  reference        TEXT        NOT NULL UNIQUE,
+  idempotency_key  TEXT        NOT NULL,
+  status           TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','processing','succeeded','failed')),
+  error            TEXT,
+  tx_id            UUID        REFERENCES transactions(id),
+  created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (user_id, idempotency_key)
+);
+CREATE INDEX IF NOT EXISTS ix_direct_debits_user ON direct_debits(user_id, created_at DESC);
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep','adjustment',
+                  'gift_hold','gift_release','gift_return','opening_balance','direct_debit'));
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS avatar_uploads;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
@@ -0,0 +1,18 @@
+-- Profile pictures. Clients upload straight to the bucket with a pre-signed
+-- URL (one avatar_uploads row per URL issued; the object key follows from
+-- its id). Completing the upload normalizes the image and points
+-- users.avatar_url at the result.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url TEXT;
+
+CREATE TABLE IF NOT EXISTS avatar_uploads (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id       UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  content_type  TEXT        NOT NULL,
+  status        TEXT        NOT NULL DEFAULT 'pending'
+                CHECK (status IN ('pending','done','rejected')),
+  error         TEXT,
+  expires_at    TIMESTAMPTZ NOT NULL,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at  TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS ix_avatar_uploads_user ON avatar_uploads(user_id, created_at DESC);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS username_redirects;
+ALTER TABLE users DROP COLUMN IF EXISTS username_changed_at;
+DROP INDEX IF EXISTS ux_users_username_lower;
+CREATE INDEX IF NOT EXISTS idx_users_username_lower ON users (lower(username));
@@ -0,0 +1,15 @@
+-- Usernames are unique regardless of case. A username given up in a change
+-- keeps resolving to its previous owner until expires_at, so nobody can
+-- claim it straight away and pose as them; see usernames.go.
+DROP INDEX IF EXISTS idx_users_username_lower;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_users_username_lower ON users (lower(username));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_changed_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS username_redirects (
+  username    TEXT        PRIMARY KEY, -- lower case
+  user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at  TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS ix_username_redirects_user ON username_redirects(user_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ix_users_display_name_fts;
+DROP INDEX IF EXISTS ix_users_display_name_trgm;
+DROP INDEX IF EXISTS ix_users_username_trgm;
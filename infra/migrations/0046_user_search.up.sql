@@ -0,0 +1,8 @@
+-- User search ranks exact and prefix username matches above fuzzy ones
+-- (trigram similarity on usernames and display names, word matches on
+-- display names); these indexes serve each kind of match.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS ix_users_username_trgm ON users USING gin (lower(username) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS ix_users_display_name_trgm ON users USING gin (lower(display_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS ix_users_display_name_fts ON users USING gin (to_tsvector('simple', coalesce(display_name, '')));
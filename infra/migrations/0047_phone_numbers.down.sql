@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS otp_codes;
+DROP INDEX IF EXISTS ux_users_phone;
+ALTER TABLE users
+  DROP COLUMN IF EXISTS phone_verified_at,
+  DROP COLUMN IF EXISTS phone;
@@ -0,0 +1,22 @@
+-- Verified phone numbers (E.164). A number is only stored on the user once
+-- its one-time code is confirmed; a change goes through otp_codes again
+-- and the old number stays until the new one is verified.
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS phone             TEXT,
+  ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMPTZ;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_users_phone ON users(phone) WHERE phone IS NOT NULL;
+
+-- One-time codes sent by SMS. Only a keyed hash of the code is kept.
+CREATE TABLE IF NOT EXISTS otp_codes (
+  id           UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id      UUID        REFERENCES users(id) ON DELETE CASCADE,
+  phone        TEXT        NOT NULL,
+  purpose      TEXT        NOT NULL CHECK (purpose IN ('phone_verify','login')),
+  code_hash    TEXT        NOT NULL,
+  attempts     INT         NOT NULL DEFAULT 0,
+  expires_at   TIMESTAMPTZ NOT NULL,
+  consumed_at  TIMESTAMPTZ,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_otp_codes_phone ON otp_codes(phone, created_at DESC);
+CREATE INDEX IF NOT EXISTS ix_otp_codes_user ON otp_codes(user_id) WHERE user_id IS NOT NULL;
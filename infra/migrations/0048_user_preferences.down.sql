@@ -0,0 +1,3 @@
+ALTER TABLE users
+  DROP COLUMN IF EXISTS theme,
+  DROP COLUMN IF EXISTS currency_display;
@@ -0,0 +1,8 @@
+-- Display preferences kept alongside language and time_zone, so every
+-- client and every server-rendered text (notifications, emails,
+-- statements) shows amounts the same way.
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS currency_display TEXT NOT NULL DEFAULT 'symbol'
+    CHECK (currency_display IN ('symbol','code')),
+  ADD COLUMN IF NOT EXISTS theme TEXT NOT NULL DEFAULT 'system'
+    CHECK (theme IN ('system','light','dark'));
@@ -0,0 +1,11 @@
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep','adjustment',
+                  'gift_hold','gift_release','gift_return','opening_balance','direct_debit'));
+
+ALTER TABLE users
+  DROP COLUMN IF EXISTS merged_at,
+  DROP COLUMN IF EXISTS merged_into;
+
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,27 @@
+-- Google and Apple accounts linked to a user, for logging in with them. The
+-- subject is the provider's stable user ID; the email is what the provider
+-- reported when the identity was linked.
+CREATE TABLE IF NOT EXISTS user_identities (
+  id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id       UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  provider      TEXT        NOT NULL CHECK (provider IN ('google','apple')),
+  subject       TEXT        NOT NULL,
+  email         TEXT,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at  TIMESTAMPTZ,
+  UNIQUE (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS ix_user_identities_user ON user_identities(user_id);
+
+-- Duplicate accounts merged by an admin: the source keeps its history but
+-- is closed and points at the account that absorbed it.
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS merged_into UUID REFERENCES users(id),
+  ADD COLUMN IF NOT EXISTS merged_at   TIMESTAMPTZ;
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_kind_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_kind_check
+  CHECK (kind IN ('gift','topup','withdrawal','withdrawal_reserve','withdrawal_refund','referral_reward',
+                  'voucher_issue','voucher_redeem','voucher_sweep','adjustment',
+                  'gift_hold','gift_release','gift_return','opening_balance','direct_debit',
+                  'account_merge'));
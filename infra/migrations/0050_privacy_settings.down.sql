@@ -0,0 +1,4 @@
+ALTER TABLE users
+  DROP COLUMN IF EXISTS gifts_from_contacts_only,
+  DROP COLUMN IF EXISTS hide_from_leaderboards,
+  DROP COLUMN IF EXISTS hide_from_search;
@@ -0,0 +1,7 @@
+-- Privacy settings. Hidden users can still be paid by anyone who has their
+-- QR code, phone number or ID; contacts-only gifts refuse senders the user
+-- has never sent a gift to.
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS hide_from_search         BOOLEAN NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS hide_from_leaderboards   BOOLEAN NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS gifts_from_contacts_only BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,15 @@
+-- Security-relevant things that happened to an account: sign-ins, failed
+-- password attempts, and changes to how the account is reached. Users see
+-- these next to their money movements in GET /v1/users/me/activity.
+CREATE TABLE IF NOT EXISTS security_events (
+  id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  kind       TEXT NOT NULL,
+  ip         TEXT,
+  user_agent TEXT,
+  data       JSONB NOT NULL DEFAULT '{}'::jsonb,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS security_events_user_idx ON security_events (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS security_events_created_idx ON security_events (created_at);
@@ -0,0 +1,9 @@
+DELETE FROM otp_codes WHERE phone IS NULL OR purpose = 'reactivate';
+DROP INDEX IF EXISTS ix_otp_codes_email;
+ALTER TABLE otp_codes DROP CONSTRAINT IF EXISTS otp_codes_purpose_check;
+ALTER TABLE otp_codes ADD CONSTRAINT otp_codes_purpose_check CHECK (purpose IN ('phone_verify','login'));
+ALTER TABLE otp_codes DROP CONSTRAINT IF EXISTS otp_codes_channel_check;
+ALTER TABLE otp_codes DROP COLUMN IF EXISTS email;
+ALTER TABLE otp_codes ALTER COLUMN phone SET NOT NULL;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deactivated_at;
@@ -0,0 +1,13 @@
+-- Self-service deactivation: the owner freezes their own account until they
+-- reactivate it with a one-time code sent to their email or verified phone.
+-- Separate from status, which only admins set.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+
+-- One-time codes can now go by email as well as SMS
+ALTER TABLE otp_codes ALTER COLUMN phone DROP NOT NULL;
+ALTER TABLE otp_codes ADD COLUMN IF NOT EXISTS email TEXT;
+ALTER TABLE otp_codes DROP CONSTRAINT IF EXISTS otp_codes_channel_check;
+ALTER TABLE otp_codes ADD CONSTRAINT otp_codes_channel_check CHECK (phone IS NOT NULL OR email IS NOT NULL);
+ALTER TABLE otp_codes DROP CONSTRAINT IF EXISTS otp_codes_purpose_check;
+ALTER TABLE otp_codes ADD CONSTRAINT otp_codes_purpose_check CHECK (purpose IN ('phone_verify','login','reactivate'));
+CREATE INDEX IF NOT EXISTS ix_otp_codes_email ON otp_codes(email, created_at DESC) WHERE email IS NOT NULL;
@@ -0,0 +1,16 @@
+-- Saved beneficiaries: another user to send gifts to, or one of the user's
+-- own payout destinations. daily_limit caps what may go to the beneficiary
+-- in any 24 hours; NULL means no cap beyond the usual ones.
+CREATE TABLE IF NOT EXISTS beneficiaries (
+  id             UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id        UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  recipient_id   UUID        REFERENCES users(id) ON DELETE CASCADE,
+  destination_id UUID        REFERENCES payout_destinations(id) ON DELETE CASCADE,
+  nickname       TEXT        NOT NULL,
+  daily_limit    BIGINT      CHECK (daily_limit > 0),
+  created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK ((recipient_id IS NULL) <> (destination_id IS NULL))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_beneficiaries_recipient ON beneficiaries(user_id, recipient_id) WHERE recipient_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_beneficiaries_destination ON beneficiaries(user_id, destination_id) WHERE destination_id IS NOT NULL;
@@ -0,0 +1,16 @@
+-- Names that passed moderation but look doubtful, queued for a moderator.
+-- Approving leaves the name; a forced rename replaces it (see
+-- POST /v1/admin/users/{id}/rename) and closes the user's open reviews.
+CREATE TABLE IF NOT EXISTS name_reviews (
+  id          UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  field       TEXT        NOT NULL CHECK (field IN ('username','display_name')),
+  value       TEXT        NOT NULL,
+  reason      TEXT        NOT NULL,
+  status      TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','approved','renamed')),
+  reviewed_by UUID        REFERENCES users(id),
+  reviewed_at TIMESTAMPTZ,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_name_reviews_status ON name_reviews(status, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS ix_name_reviews_user ON name_reviews(user_id);
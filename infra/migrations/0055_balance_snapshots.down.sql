@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS ix_ledger_created;
+CREATE INDEX IF NOT EXISTS idx_ledger_wallet ON ledger_entries(wallet_id);
+DROP INDEX IF EXISTS ix_ledger_wallet_created;
+DROP TABLE IF EXISTS wallet_balance_snapshots;
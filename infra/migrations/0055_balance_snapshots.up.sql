@@ -0,0 +1,19 @@
+-- Wallet balances as of a point in time, so a balance is the snapshot plus
+-- the entries since rather than a sum over the wallet's whole history.
+-- Snapshots cover every entry created before as_of; a background loop
+-- moves them forward.
+CREATE TABLE IF NOT EXISTS wallet_balance_snapshots (
+    wallet_id UUID PRIMARY KEY REFERENCES wallets(id) ON DELETE CASCADE,
+    balance BIGINT NOT NULL,
+    as_of TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_balance_snapshots_as_of ON wallet_balance_snapshots (as_of);
+
+-- Entries since a snapshot, read from the index alone. Replaces the plain
+-- wallet_id index.
+CREATE INDEX IF NOT EXISTS ix_ledger_wallet_created ON ledger_entries (wallet_id, created_at) INCLUDE (direction, amount);
+DROP INDEX IF EXISTS idx_ledger_wallet;
+
+-- What the snapshot loop reads: every entry in a time window.
+CREATE INDEX IF NOT EXISTS ix_ledger_created ON ledger_entries (created_at) INCLUDE (wallet_id, direction, amount);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ix_users_email_pattern;
+DROP INDEX IF EXISTS ix_users_created_id;
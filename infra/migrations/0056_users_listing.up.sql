@@ -0,0 +1,4 @@
+-- Keyset paging through users, newest or oldest first.
+CREATE INDEX IF NOT EXISTS ix_users_created_id ON users (created_at, id);
+-- Email prefix filters.
+CREATE INDEX IF NOT EXISTS ix_users_email_pattern ON users (email text_pattern_ops);
@@ -0,0 +1,9 @@
+-- Fold the shards' postings back into the original system wallet first,
+-- dropping the snapshots that no longer add up.
+DELETE FROM wallet_balance_snapshots s USING wallets w WHERE s.wallet_id = w.id AND w.shard IS NOT NULL;
+UPDATE ledger_entries le SET wallet_id = w0.id
+FROM wallets w, wallets w0
+WHERE le.wallet_id = w.id AND w.shard > 0 AND w0.user_id = w.user_id AND w0.shard = 0;
+DELETE FROM wallets WHERE shard > 0;
+DROP INDEX IF EXISTS ux_wallets_user_shard;
+ALTER TABLE wallets DROP COLUMN IF EXISTS shard;
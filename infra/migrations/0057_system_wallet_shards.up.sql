@@ -0,0 +1,20 @@
+-- The system side of platform postings (top-ups, withdrawals, rewards...)
+-- is spread over several wallets of the system user, so no single wallet
+-- row is locked by every posting. Together they are the system wallet.
+-- shard numbers them, the original system wallet being 0; other wallets
+-- have none.
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS shard SMALLINT;
+
+DO $$
+DECLARE sys_id UUID;
+BEGIN
+  SELECT id INTO sys_id FROM users WHERE email = 'system@okies.local';
+  IF sys_id IS NOT NULL THEN
+    UPDATE wallets SET shard = 0 WHERE user_id = sys_id AND shard IS NULL;
+    INSERT INTO wallets (user_id, balance, shard)
+    SELECT sys_id, 0, s FROM generate_series(1, 15) s
+    WHERE NOT EXISTS (SELECT 1 FROM wallets WHERE user_id = sys_id AND shard = s);
+  END IF;
+END$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_wallets_user_shard ON wallets (user_id, shard) WHERE shard IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ix_webhook_events_unprocessed;
+ALTER TABLE payouts DROP COLUMN IF EXISTS provider_event_at;
+ALTER TABLE webhook_events DROP COLUMN IF EXISTS provider_at;
@@ -0,0 +1,12 @@
+-- Transfer webhooks are settled in batches, per reference, in the order the
+-- provider sent them rather than the order they arrived. provider_at is the
+-- provider's own time for the event, when the payload carries one.
+ALTER TABLE webhook_events ADD COLUMN IF NOT EXISTS provider_at TIMESTAMPTZ;
+
+-- The provider time of the event that last settled the payout, so an older
+-- event arriving late can't undo a newer one.
+ALTER TABLE payouts ADD COLUMN IF NOT EXISTS provider_event_at TIMESTAMPTZ;
+
+-- Events still to settle, oldest first.
+CREATE INDEX IF NOT EXISTS ix_webhook_events_unprocessed
+  ON webhook_events (provider, event, received_at) WHERE processed_at IS NULL;
@@ -0,0 +1,3 @@
+-- Bumped to sign a user out everywhere: access tokens carry the version
+-- they were issued under and stop working once it moves on.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INT NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+-- Emailed password reset links. Only a hash of the token is kept; a token
+-- works once, before it expires.
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+  id          UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash  TEXT        NOT NULL UNIQUE,
+  ip          TEXT,
+  expires_at  TIMESTAMPTZ NOT NULL,
+  used_at     TIMESTAMPTZ,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ix_password_reset_tokens_user ON password_reset_tokens(user_id) WHERE used_at IS NULL;
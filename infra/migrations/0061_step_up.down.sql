@@ -0,0 +1,4 @@
+DELETE FROM otp_codes WHERE purpose = 'step_up';
+ALTER TABLE otp_codes DROP CONSTRAINT IF EXISTS otp_codes_purpose_check;
+ALTER TABLE otp_codes ADD CONSTRAINT otp_codes_purpose_check CHECK (purpose IN ('phone_verify','login','reactivate'));
+DROP TABLE IF EXISTS step_up_tokens;
@@ -0,0 +1,15 @@
+-- Step-up tokens: proof that the user re-authenticated moments ago, spent
+-- by one sensitive action such as a large withdrawal. Only a hash is kept.
+CREATE TABLE IF NOT EXISTS step_up_tokens (
+  id          UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash  TEXT        NOT NULL UNIQUE,
+  method      TEXT        NOT NULL CHECK (method IN ('password','code')),
+  expires_at  TIMESTAMPTZ NOT NULL,
+  used_at     TIMESTAMPTZ,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Codes sent to confirm a step-up.
+ALTER TABLE otp_codes DROP CONSTRAINT IF EXISTS otp_codes_purpose_check;
+ALTER TABLE otp_codes ADD CONSTRAINT otp_codes_purpose_check CHECK (purpose IN ('phone_verify','login','reactivate','step_up'));
@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens
+  DROP COLUMN IF EXISTS last_used_at,
+  DROP COLUMN IF EXISTS started_at;
@@ -0,0 +1,7 @@
+-- A session is a chain of refresh tokens, each replacing the last when it
+-- is used. started_at is carried along the chain from sign-in; last_used_at
+-- is when the token's predecessor was refreshed into it.
+ALTER TABLE refresh_tokens
+  ADD COLUMN IF NOT EXISTS started_at   TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ;
+UPDATE refresh_tokens SET started_at = created_at WHERE started_at IS NULL;
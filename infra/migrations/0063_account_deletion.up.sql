@@ -0,0 +1,3 @@
+-- Set while a self-service deletion is pending: the account is deactivated
+-- and is erased at this time unless it is reactivated first.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMPTZ;
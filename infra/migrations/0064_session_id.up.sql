@@ -0,0 +1,4 @@
+-- Names the session a refresh token belongs to; carried along the chain
+-- like started_at, and on the access tokens issued with each link, so a
+-- signed-out device's access token can be refused too.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS session_id UUID NOT NULL DEFAULT gen_random_uuid();
@@ -0,0 +1 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS previous_user_id;
@@ -0,0 +1,3 @@
+-- A push token moves with the install; remember the account it last moved
+-- from, so a referral between two accounts on one phone can be spotted.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS previous_user_id UUID REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL schema migrations so they ship with the
+// binary. Files follow golang-migrate naming: NNNN_name.up.sql / .down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
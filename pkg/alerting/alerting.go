@@ -0,0 +1,157 @@
+// Package alerting delivers operational alerts to the channels the on-call
+// team watches: a generic JSON webhook, a Slack incoming webhook or a
+// Telegram chat. Which channels hear about which alert is decided by the
+// caller; see settings.AlertRoutes.
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sudo-init-do/okies-backend/pkg/signing"
+)
+
+// Alert is an operational event someone should look at.
+type Alert struct {
+	Name     string         `json:"name"`
+	Severity string         `json:"severity"` // warning | critical
+	Message  string         `json:"message"`
+	Fields   map[string]any `json:"fields,omitempty"`
+	At       time.Time      `json:"at"`
+}
+
+// Sender delivers an alert to one channel.
+type Sender interface {
+	Send(ctx context.Context, a Alert) error
+}
+
+// Channels routes by channel name ("webhook", "slack", "telegram"). A
+// channel without a configured sender is skipped.
+type Channels map[string]Sender
+
+// Channel names.
+const (
+	ChannelWebhook  = "webhook"
+	ChannelSlack    = "slack"
+	ChannelTelegram = "telegram"
+)
+
+// Send delivers a to each named channel that is configured and returns the
+// errors joined.
+func (c Channels) Send(ctx context.Context, names []string, a Alert) error {
+	var errs []error
+	for _, name := range names {
+		s, ok := c[name]
+		if !ok {
+			continue
+		}
+		if err := s.Send(ctx, a); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Webhook POSTs the alert as JSON, signed with the keys Keys returns (see
+// pkg/signing) when it is set.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+	Keys   func() []signing.Key
+}
+
+func (w *Webhook) Send(ctx context.Context, a Alert) error {
+	body, _ := json.Marshal(a)
+	var keys []signing.Key
+	if w.Keys != nil {
+		keys = w.Keys()
+	}
+	return post(ctx, w.Client, w.URL, body, keys...)
+}
+
+// Slack posts to an incoming webhook.
+type Slack struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func (s *Slack) Send(ctx context.Context, a Alert) error {
+	esc := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s *%s* [%s]\n%s", severityIcon(a.Severity), a.Name, a.Severity, esc.Replace(a.Message))
+	for _, k := range sortedKeys(a.Fields) {
+		fmt.Fprintf(&b, "\n• `%s`: %s", k, esc.Replace(fmt.Sprint(a.Fields[k])))
+	}
+	body, _ := json.Marshal(map[string]string{"text": b.String()})
+	return post(ctx, s.Client, s.WebhookURL, body)
+}
+
+// Telegram sends through a bot to one chat (a user, group or channel the
+// bot has been added to).
+type Telegram struct {
+	BaseURL string // https://api.telegram.org
+	Token   string
+	ChatID  string
+	Client  *http.Client
+}
+
+func (t *Telegram) Send(ctx context.Context, a Alert) error {
+	// plain text: Telegram's Markdown rejects messages with stray markup,
+	// and alert fields hold provider error strings
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s [%s]\n%s", severityIcon(a.Severity), a.Name, a.Severity, a.Message)
+	for _, k := range sortedKeys(a.Fields) {
+		fmt.Fprintf(&b, "\n%s: %v", k, a.Fields[k])
+	}
+	body, _ := json.Marshal(map[string]any{
+		"chat_id":                  t.ChatID,
+		"text":                     b.String(),
+		"disable_web_page_preview": true,
+	})
+	return post(ctx, t.Client, t.BaseURL+"/bot"+t.Token+"/sendMessage", body)
+}
+
+func post(ctx context.Context, client *http.Client, url string, body []byte, keys ...signing.Key) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(keys) > 0 {
+		signing.SignRequest(req, body, keys...)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		raw, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return fmt.Errorf("alerting: status %d %s", res.StatusCode, raw)
+	}
+	return nil
+}
+
+func severityIcon(severity string) string {
+	if severity == "critical" {
+		return "🔴"
+	}
+	return "🟠"
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
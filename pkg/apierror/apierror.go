@@ -0,0 +1,166 @@
+// Package apierror defines the error body every API handler returns:
+//
+//	{"error": {"code": "voucher_not_found", "message": "...", "details": [...], "requestId": "..."}}
+//
+// Codes are stable and meant for clients to branch on; messages are for
+// humans and may change. The request ID lets support correlate a report
+// with logs and traces. Version 2 routes carry the same fields as an RFC
+// 9457 problem document; see Write. Catalogued messages are translated into
+// the response's Content-Language (see pkg/i18n).
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/sudo-init-do/okies-backend/pkg/i18n"
+)
+
+// FieldError describes one invalid input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type Error struct {
+	Status    int          `json:"-"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+
+	cause  error
+	custom bool // Message was set by WithMessage and is not translated
+}
+
+// New returns an error with the catalogued message for code.
+func New(status int, code string) *Error {
+	return &Error{Status: status, Code: code, Message: Message(code, status)}
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Code + ": " + e.cause.Error()
+	}
+	return e.Code
+}
+
+func (e *Error) Unwrap() error { return e.cause }
+
+// WithMessage returns a copy of e with a custom human message.
+func (e *Error) WithMessage(msg string) *Error {
+	c := *e
+	c.Message = msg
+	c.custom = true
+	return &c
+}
+
+// WithDetails returns a copy of e carrying field-level details.
+func (e *Error) WithDetails(d ...FieldError) *Error {
+	c := *e
+	c.Details = append(append([]FieldError(nil), e.Details...), d...)
+	return &c
+}
+
+// Wrap returns a copy of e that records cause for logging. The cause is
+// never sent to clients.
+func (e *Error) Wrap(cause error) *Error {
+	c := *e
+	c.cause = cause
+	return &c
+}
+
+// Validation is the 422 returned when one or more fields are invalid.
+func Validation(details ...FieldError) *Error {
+	return New(http.StatusUnprocessableEntity, "validation_failed").WithDetails(details...)
+}
+
+// InvalidField is the 400 "invalid_<field>" error, with the field named in
+// details so clients don't have to parse the code.
+func InvalidField(field string) *Error {
+	return New(http.StatusBadRequest, "invalid_"+field).
+		WithDetails(FieldError{Field: field, Code: "invalid"})
+}
+
+// From converts any error into an *Error; anything untyped becomes a 500.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return New(http.StatusInternalServerError, "internal_error").Wrap(err)
+}
+
+// VersionHeader is the response header carrying the API version a route
+// belongs to; Write picks the error format from it.
+const VersionHeader = "API-Version"
+
+// Write sends err as the response. The request ID is taken from the
+// X-Request-ID response header set by the request-ID middleware. Version 2
+// routes get an RFC 9457 problem document instead of the v1 envelope.
+func Write(w http.ResponseWriter, err error) {
+	e := *From(err)
+	e.RequestID = w.Header().Get("X-Request-ID")
+	e.localize(w.Header().Get(i18n.Header))
+	if w.Header().Get(VersionHeader) == "2" {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(e.Status)
+		_ = json.NewEncoder(w).Encode(problem{
+			Type:      "urn:okies:error:" + e.Code,
+			Title:     e.Message,
+			Status:    e.Status,
+			Code:      e.Code,
+			Errors:    e.Details,
+			RequestID: e.RequestID,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": &e})
+}
+
+// localize translates a catalogued message into lang, keeping English
+// where there is no translation.
+func (e *Error) localize(lang string) {
+	if e.custom || lang == "" || lang == i18n.English {
+		return
+	}
+	key := e.Code
+	if _, ok := messages[key]; !ok {
+		key = genericKey(e.Status)
+	}
+	if m, ok := i18n.ErrorMessage(lang, key); ok {
+		e.Message = m
+	}
+}
+
+// LocalizedMessage is Message in lang.
+func LocalizedMessage(lang, code string, status int) string {
+	e := New(status, code)
+	e.localize(lang)
+	return e.Message
+}
+
+// problem is the v2 error body:
+//
+//	{"type": "urn:okies:error:voucher_not_found", "title": "...", "status": 404, "code": "voucher_not_found", "errors": [...], "requestId": "..."}
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// Body is e as it appears under "error", for responses that carry data
+// alongside an error.
+func Body(w http.ResponseWriter, e *Error) *Error {
+	c := *e
+	c.RequestID = w.Header().Get("X-Request-ID")
+	c.localize(w.Header().Get(i18n.Header))
+	return &c
+}
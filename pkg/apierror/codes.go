@@ -0,0 +1,199 @@
+package apierror
+
+import "net/http"
+
+// messages holds the default human message for each stable code. Codes not
+// listed fall back to a generic message for their status. Internal failure
+// codes (db_error, insert_*_error, ...) deliberately share the 5xx fallback.
+var messages = map[string]string{
+	"account_banned":                          "This account has been banned.",
+	"account_deactivated":                     "This account is deactivated. Reactivate it with a code sent to your email or phone.",
+	"account_frozen":                          "Outgoing transfers are frozen on this account pending review.",
+	"account_suspended":                       "This account is suspended.",
+	"adjustment_already_reviewed":             "This adjustment has already been reviewed.",
+	"adjustment_not_found":                    "Adjustment not found.",
+	"adjustment_not_reviewable":               "This adjustment can no longer be reviewed.",
+	"admin_only":                              "This action requires an admin account.",
+	"admin_rate_limited":                      "Too many sensitive actions in a short time; try again in a minute.",
+	"already_anonymized":                      "This user has already been erased.",
+	"already_approved_by_you":                 "You have already approved this; a different admin must give the second approval.",
+	"already_blacklisted":                     "This destination is already on the blacklist.",
+	"amount_exceeds_mandate":                  "This amount is more than your mandate allows per debit.",
+	"avatar_not_uploaded":                     "No image was uploaded. Please upload your photo first.",
+	"avatar_upload_expired":                   "This upload has expired. Please start again.",
+	"avatar_upload_not_found":                 "Upload not found.",
+	"bad_payload":                             "The payload could not be read.",
+	"bad_signature":                           "The webhook signature is invalid.",
+	"balance_not_zero":                        "The wallet balance must be zero first.",
+	"bank_account_blocked":                    "Deposits from this bank account are not allowed.",
+	"bank_balance_unavailable":                "We could not check your bank balance right now. Please try again shortly.",
+	"bank_link_exists":                        "This bank account is already linked to another Okies account.",
+	"banks_unavailable":                       "The bank list is unavailable right now. Please try again shortly.",
+	"beneficiary_exists":                      "This beneficiary is already saved.",
+	"beneficiary_limit_exceeded":              "This would go over the daily limit you set for this beneficiary.",
+	"beneficiary_not_found":                   "Beneficiary not found.",
+	"beneficiary_target_required":             "Choose one user, phone number or payout destination.",
+	"breaker_not_found":                       "No circuit breaker with that name on this instance.",
+	"cannot_approve_own_payout":               "You cannot approve your own withdrawal.",
+	"cannot_change_admin_status":              "Only a superadmin can change an admin account's status.",
+	"cannot_change_own_role":                  "You cannot change your own role.",
+	"cannot_change_own_status":                "You cannot change your own account status.",
+	"cannot_erase_self":                       "You cannot erase your own account from the admin console.",
+	"cannot_gift_self":                        "You cannot send a gift to yourself.",
+	"cannot_impersonate_admin":                "Admin accounts cannot be impersonated.",
+	"cannot_impersonate_self":                 "You cannot impersonate yourself.",
+	"cannot_reject_submitted":                 "This withdrawal has already been sent for payment and cannot be rejected.",
+	"cannot_reject_succeeded":                 "A withdrawal that has already paid out cannot be rejected.",
+	"case_not_found":                          "Case not found.",
+	"case_not_open":                           "This fraud case is already closed.",
+	"chaos_disabled":                          "Chaos mode is not enabled on this deployment.",
+	"current_password_incorrect":              "The current password is not correct.",
+	"db_not_ready":                            "The service is not ready.",
+	"destination_blocked":                     "Withdrawals to this account are not allowed.",
+	"destination_exists":                      "This account is already saved as a payout destination.",
+	"device_not_found":                        "Device not found.",
+	"email_and_password_required":             "Email and password are required.",
+	"email_in_use":                            "An account with this email already exists.",
+	"email_or_phone_required":                 "Enter your email address or phone number.",
+	"email_unavailable":                       "Email is not available right now.",
+	"empty_body":                              "A request body is required.",
+	"empty_csv":                               "The uploaded CSV has no data rows.",
+	"expiry_in_past":                          "The expiry time must be in the future.",
+	"export_not_ready":                        "The export is not ready yet.",
+	"export_period_too_long":                  "An export can cover at most 92 days.",
+	"forbidden":                               "You are not allowed to do this.",
+	"identity_in_use":                         "This account is already linked to another Okies account.",
+	"identity_not_found":                      "Linked account not found.",
+	"identity_not_linked":                     "This account isn't linked to Okies yet. Log in with your email and link it from your profile.",
+	"image_too_large":                         "The photo is too large. The limit is 5 MB.",
+	"impersonation_read_only":                 "Impersonation sessions are read-only.",
+	"insufficient_bank_balance":               "Your bank balance is too low for this deposit.",
+	"insufficient_funds":                      "Your wallet balance is too low for this transaction.",
+	"insufficient_permissions":                "Your role does not allow this action.",
+	"insufficient_scope":                      "The access token was not granted the scope this needs.",
+	"invalid_action":                          "Invalid action.",
+	"invalid_api_key":                         "The API key is missing, invalid or revoked.",
+	"invalid_credentials":                     "Email or password is incorrect.",
+	"invalid_csv":                             "The uploaded file is not valid CSV.",
+	"invalid_date":                            "The date must be in YYYY-MM-DD format.",
+	"invalid_destination":                     "The payout destination is invalid.",
+	"invalid_field_type":                      "A field has the wrong type.",
+	"invalid_id_token":                        "We couldn't confirm your sign-in. Please try again.",
+	"invalid_image":                           "The photo must be a JPEG or PNG at least 64 pixels wide and high.",
+	"invalid_json":                            "The request body is not valid JSON.",
+	"invalid_kind":                            "Invalid kind.",
+	"invalid_latency_range":                   "latencyMaxMs must not be less than latencyMinMs.",
+	"invalid_link_code":                       "The bank linking session has expired. Please link your account again.",
+	"invalid_otp":                             "The code is wrong or has expired. Please request a new one.",
+	"invalid_period":                          "Invalid period.",
+	"invalid_qr_code":                         "This QR code isn't valid. Ask the person to show their code again.",
+	"invalid_redemption_amount":               "The redemption amount must be positive and within the voucher balance.",
+	"invalid_referral_code":                   "Invalid referral code.",
+	"invalid_refresh":                         "The refresh token is invalid.",
+	"invalid_request":                         "The request is missing required fields or has invalid values.",
+	"invalid_role":                            "Invalid role.",
+	"invalid_scheduledAt":                     "A gift can be scheduled from now up to a year ahead.",
+	"invalid_status":                          "Invalid status.",
+	"invalid_token":                           "The access token is invalid or expired.",
+	"invalid_upload":                          "The upload could not be read.",
+	"invalid_value":                           "Invalid value.",
+	"invalid_webhook_url":                     "The webhook URL must be a valid https URL.",
+	"job_not_dead":                            "Job not found, or not dead-lettered.",
+	"maker_cannot_approve":                    "The admin who proposed an adjustment cannot approve it.",
+	"mandate_not_active":                      "This direct debit mandate is not active. Approve it with your bank first.",
+	"merge_in_progress":                       "The account being merged has withdrawals, held gifts, vouchers or debits in progress.",
+	"merge_not_allowed":                       "Only active customer accounts that haven't been erased or merged can be merged.",
+	"merge_same_user":                         "An account cannot be merged into itself.",
+	"missing_bearer_token":                    "An Authorization: Bearer token is required.",
+	"missing_file":                            "A file upload is required.",
+	"missing_id":                              "An ID is required.",
+	"missing_value":                           "A value is required.",
+	"money_in_flight":                         "Pending withdrawals, held gifts or active vouchers must settle first.",
+	"name_not_allowed":                        "This name isn't allowed. Please choose another.",
+	"name_review_not_found":                   "Name review not found or already decided.",
+	"not_authenticated":                       "Authentication is required.",
+	"not_found":                               "Not found.",
+	"one_subject_only":                        "Attach either a transaction or a withdrawal, not both.",
+	"open_banking_unavailable":                "Bank account linking is not available right now.",
+	"open_fraud_case":                         "An open fraud case blocks this action until it is reviewed.",
+	"otp_rate_limited":                        "Too many codes have been sent to this number. Please wait and try again.",
+	"payload_too_large":                       "The request body is too large.",
+	"payout_not_found":                        "Payout not found.",
+	"payout_not_pending":                      "This withdrawal is no longer pending.",
+	"phone_already_verified":                  "This phone number is already verified on your account.",
+	"phone_in_use":                            "This phone number is already used by another account.",
+	"rate_limited":                            "Too many requests; slow down and try again shortly.",
+	"reason_required":                         "A reason is required.",
+	"recipient_contacts_only":                 "This person only accepts gifts from people they've sent gifts to.",
+	"recipient_unavailable":                   "This person can't receive gifts right now.",
+	"recipient_wallet_not_found":              "Recipient wallet not found.",
+	"reference_required":                      "A reference is required.",
+	"referral_code_error":                     "The referral code could not be applied.",
+	"refresh_not_valid":                       "The refresh token has expired or been revoked.",
+	"reject_requires_withdrawal_or_held_gift": "Only withdrawals and held gifts can be rejected.",
+	"report_not_found":                        "Report not found.",
+	"reset_token_invalid":                     "The password reset link is invalid or has expired.",
+	"resolution_required":                     "A resolution note is required.",
+	"rule_not_found":                          "Rule not found.",
+	"scheduled_gift_not_found":                "Scheduled gift not found, or already sent.",
+	"schema_drift":                            "Payments are briefly unavailable while we update our systems. Please try again shortly.",
+	"session_not_found":                       "Session not found.",
+	"sign_in_unavailable":                     "This sign-in option isn't available right now.",
+	"sms_unavailable":                         "Text messages are not available right now.",
+	"statement_not_found":                     "Statement not found.",
+	"statement_period_too_long":               "A statement can cover at most 366 days.",
+	"step_up_failed":                          "The password or code is not correct.",
+	"step_up_required":                        "Confirm it is you to continue.",
+	"target_wallet_not_found":                 "Target wallet not found.",
+	"ticket_not_found_or_resolved":            "Ticket not found, or already resolved.",
+	"token_revoked":                           "The access token has been revoked. Sign in again.",
+	"too_many_rows":                           "The upload has more rows than allowed.",
+	"too_many_streams":                        "Too many open real-time connections; close one and retry.",
+	"transaction_not_found":                   "Transaction not found.",
+	"unknown_field":                           "The request body has a field this endpoint does not accept.",
+	"unknown_setting":                         "No such setting.",
+	"unsupported_media_type":                  "Send the request body as application/json.",
+	"uploads_unavailable":                     "Photo uploads are not available right now.",
+	"user_not_found":                          "User not found.",
+	"username_change_cooldown":                "You changed your username recently. Please try again later.",
+	"username_in_use":                         "This username is already taken.",
+	"username_reserved":                       "This username is reserved. Please choose another.",
+	"validation_failed":                       "Some fields are invalid; see details.",
+	"voucher_not_active":                      "This voucher has been used up, expired or cancelled.",
+	"voucher_not_found":                       "Voucher not found.",
+	"wallet_not_found":                        "Wallet not found.",
+	"webhook_event_not_found":                 "Webhook event not found.",
+	"webhook_not_configured":                  "This webhook is not enabled.",
+	"withdrawal_not_found":                    "Withdrawal not found.",
+}
+
+// Message returns the catalogued message for code, or a generic one for status.
+func Message(code string, status int) string {
+	if m, ok := messages[code]; ok {
+		return m
+	}
+	return generic[genericKey(status)]
+}
+
+// generic holds the fallback messages, keyed as in pkg/i18n catalogues.
+var generic = map[string]string{
+	"_internal":  "Something went wrong on our side. Quote the request ID if you contact support.",
+	"_not_found": "Not found.",
+	"_forbidden": "You are not allowed to do this.",
+	"_conflict":  "The request conflicts with the current state.",
+	"_invalid":   "The request is invalid.",
+}
+
+func genericKey(status int) string {
+	switch {
+	case status >= 500:
+		return "_internal"
+	case status == http.StatusNotFound:
+		return "_not_found"
+	case status == http.StatusForbidden:
+		return "_forbidden"
+	case status == http.StatusConflict:
+		return "_conflict"
+	}
+	return "_invalid"
+}
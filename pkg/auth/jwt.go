@@ -1,11 +1,152 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// Keyring holds the keys tokens are signed and verified with: HMAC secrets
+// and, optionally, RSA or Ed25519 private keys. New tokens are signed with
+// the current private key when there is one, otherwise with the current
+// secret, and name their key in the kid header; tokens verify against any
+// key on the ring, so a rotation doesn't sign everyone out. Public keys are
+// published by JWKS so other services can verify tokens themselves. Set
+// and SetPrivateKeys swap keys while tokens are being issued and checked.
+//
+// To rotate: add the new key to the previous ones everywhere, then make it
+// current with the old one among the previous, and drop the old one once
+// the longest-lived token signed with it (a refresh token) has expired.
+// Moving from secrets to private keys works the same way: the secrets keep
+// verifying until they are dropped.
+type Keyring struct {
+	mu      sync.Mutex // serialises Set and SetPrivateKeys
+	secrets [][]byte   // current first
+	private []crypto.Signer
+	v       atomic.Pointer[keyset]
+}
+
+type keyset struct {
+	kid    string
+	method jwt.SigningMethod
+	signer any
+	byKID  map[string]verifyKey
+	all    jwt.VerificationKeySet // the secrets, for tokens without a kid
+	jwks   []byte
+}
+
+type verifyKey struct {
+	alg string
+	key any
+}
+
+// Methods are the signing algorithms a Keyring verifies.
+var Methods = []string{"HS256", "RS256", "EdDSA"}
+
+var (
+	errUnknownKID  = errors.New("auth: token signed with an unknown key")
+	errAlgMismatch = errors.New("auth: token algorithm doesn't match its key")
+)
+
+func NewKeyring(current []byte, previous ...[]byte) *Keyring {
+	k := &Keyring{}
+	k.Set(current, previous...)
+	return k
+}
+
+// Set replaces the HMAC secrets.
+func (k *Keyring) Set(current []byte, previous ...[]byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.secrets = append([][]byte{current}, previous...)
+	k.rebuild()
+}
+
+// SetPrivateKeys replaces the private keys: the first signs new tokens and
+// the rest only verify. With none, the current secret signs again.
+func (k *Keyring) SetPrivateKeys(keys ...crypto.Signer) error {
+	for _, key := range keys {
+		if _, err := methodFor(key); err != nil {
+			return err
+		}
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.private = keys
+	k.rebuild()
+	return nil
+}
+
+func (k *Keyring) rebuild() {
+	ks := &keyset{byKID: map[string]verifyKey{}}
+	for _, secret := range k.secrets {
+		ks.byKID[keyID(secret)] = verifyKey{alg: "HS256", key: secret}
+		ks.all.Keys = append(ks.all.Keys, secret)
+	}
+	public := []jwk{}
+	for _, p := range k.private {
+		m, _ := methodFor(p)
+		kid := publicKeyID(p.Public())
+		ks.byKID[kid] = verifyKey{alg: m.Alg(), key: p.Public()}
+		public = append(public, toJWK(kid, m.Alg(), p.Public()))
+	}
+	if len(k.private) > 0 {
+		ks.method, _ = methodFor(k.private[0])
+		ks.signer, ks.kid = k.private[0], publicKeyID(k.private[0].Public())
+	} else {
+		ks.method, ks.signer, ks.kid = jwt.SigningMethodHS256, k.secrets[0], keyID(k.secrets[0])
+	}
+	ks.jwks, _ = json.Marshal(map[string]any{"keys": public})
+	k.v.Store(ks)
+}
+
+// keyID names a secret without revealing it.
+func keyID(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	ks := k.v.Load()
+	t := jwt.NewWithClaims(ks.method, claims)
+	t.Header["kid"] = ks.kid
+	return t.SignedString(ks.signer)
+}
+
+// Keyfunc picks the key a token names, or tries all the secrets for tokens
+// issued before key IDs were added.
+func (k *Keyring) Keyfunc(t *jwt.Token) (any, error) {
+	ks := k.v.Load()
+	kid, ok := t.Header["kid"].(string)
+	if !ok {
+		return ks.all, nil
+	}
+	v, ok := ks.byKID[kid]
+	if !ok {
+		return nil, errUnknownKID
+	}
+	if t.Method.Alg() != v.alg {
+		return nil, errAlgMismatch
+	}
+	return v.key, nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set. Secrets are never
+// included, so it is {"keys":[]} until private keys are set.
+func (k *Keyring) JWKS() []byte {
+	return k.v.Load().jwks
+}
+
 type TokenPair struct {
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
@@ -14,9 +155,31 @@ type TokenPair struct {
 type AccessClaims struct {
 	jwt.RegisteredClaims
 	Role string `json:"role"`
+	// Act is set on impersonation tokens and names the admin acting as Subject.
+	Act *Actor `json:"act,omitempty"`
+	// Ver is the user's token version when the token was issued; the token
+	// stops working once the version is bumped.
+	Ver int `json:"ver,omitempty"`
+	// Sid names the session the token was issued to, so signing a device
+	// out can refuse its access token too.
+	Sid string `json:"sid,omitempty"`
 }
 
-func GenerateAccess(secret []byte, sub, role string, ttl time.Duration) (string, error) {
+// Actor identifies the admin behind an impersonation token.
+type Actor struct {
+	Subject string `json:"sub"`
+	Role    string `json:"role"`
+}
+
+// ReadOnly reports whether the token may only be used for safe (read) requests.
+func (c *AccessClaims) ReadOnly() bool {
+	return c.Act != nil
+}
+
+// GenerateAccess mints an access token for session sid under the user's
+// token version ver. Its ID lets a single token be revoked before it
+// expires.
+func GenerateAccess(keys *Keyring, sub, role string, ver int, sid string, ttl time.Duration) (string, error) {
 	now := time.Now()
 	claims := AccessClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
@@ -24,30 +187,72 @@ func GenerateAccess(secret []byte, sub, role string, ttl time.Duration) (string,
 			Issuer:    "okies-api",
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        uuid.NewString(),
 		},
 		Role: role,
+		Ver:  ver,
+		Sid:  sid,
+	}
+	return keys.sign(claims)
+}
+
+// GenerateImpersonation mints a read-only access token for sub on behalf of
+// the admin act. The token always carries the user role, so admin routes stay
+// closed to it.
+func GenerateImpersonation(keys *Keyring, sub string, act Actor, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   sub,
+			Issuer:    "okies-api",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        uuid.NewString(),
+		},
+		Role: RoleUser,
+		Act:  &act,
 	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString(secret)
+	return keys.sign(claims)
 }
 
-func GenerateRefresh(secret []byte, sub, jti string, ttl time.Duration) (string, error) {
+// RefreshAudience marks refresh tokens, so one can't be presented as an
+// access token.
+const RefreshAudience = "okies-refresh"
+
+func GenerateRefresh(keys *Keyring, sub, jti string, ttl time.Duration) (string, error) {
 	now := time.Now()
 	claims := jwt.RegisteredClaims{
 		Subject:   sub,
 		Issuer:    "okies-api",
+		Audience:  jwt.ClaimStrings{RefreshAudience},
 		IssuedAt:  jwt.NewNumericDate(now),
 		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 		ID:        jti,
 	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString(secret)
+	return keys.sign(claims)
+}
+
+// ParseRefresh parses a refresh token. Whether it is still good is up to
+// its refresh_tokens row. Tokens issued before refresh tokens carried an
+// audience are accepted until they expire.
+func ParseRefresh(keys *Keyring, tokenStr string, opts ...jwt.ParserOption) (*jwt.RegisteredClaims, error) {
+	opts = append([]jwt.ParserOption{jwt.WithValidMethods(Methods)}, opts...)
+	t, err := jwt.ParseWithClaims(tokenStr, &jwt.RegisteredClaims{}, keys.Keyfunc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !t.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	c := t.Claims.(*jwt.RegisteredClaims)
+	if len(c.Audience) > 0 && !slices.Contains(c.Audience, RefreshAudience) {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+	return c, nil
 }
 
-func ParseAccess(secret []byte, tokenStr string) (*AccessClaims, error) {
-	t, err := jwt.ParseWithClaims(tokenStr, &AccessClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return secret, nil
-	}, jwt.WithValidMethods([]string{"HS256"}))
+func ParseAccess(keys *Keyring, tokenStr string) (*AccessClaims, error) {
+	t, err := jwt.ParseWithClaims(tokenStr, &AccessClaims{}, keys.Keyfunc, jwt.WithValidMethods(Methods))
 	if err != nil {
 		return nil, err
 	}
@@ -55,5 +260,66 @@ func ParseAccess(secret []byte, tokenStr string) (*AccessClaims, error) {
 		return nil, jwt.ErrTokenInvalidClaims
 	}
 	c := t.Claims.(*AccessClaims)
+	if len(c.Audience) > 0 {
+		// a partner or refresh token; see ParsePartner and ParseRefresh
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+	if c.Role == "" {
+		// a refresh token from before they carried an audience
+		return nil, jwt.ErrTokenInvalidClaims
+	}
 	return c, nil
 }
+
+// PartnerAudience marks partner access tokens. User access tokens carry no
+// audience, and each parser rejects the other kinds.
+const PartnerAudience = "okies-partner"
+
+// PartnerClaims are carried by access tokens issued to partner clients
+// through the OAuth2 client-credentials grant. Subject is the account the
+// partner acts for.
+type PartnerClaims struct {
+	jwt.RegisteredClaims
+	Partner  string `json:"partner"`
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"` // space-delimited, as in OAuth
+}
+
+// Has reports whether the token was granted s.
+func (c *PartnerClaims) Has(s Scope) bool {
+	for _, sc := range ParseScopes(c.Scope) {
+		if sc == string(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func GeneratePartner(keys *Keyring, sub, partnerID, clientID string, scopes []string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := PartnerClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   sub,
+			Issuer:    "okies-api",
+			Audience:  jwt.ClaimStrings{PartnerAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Partner:  partnerID,
+		ClientID: clientID,
+		Scope:    strings.Join(scopes, " "),
+	}
+	return keys.sign(claims)
+}
+
+func ParsePartner(keys *Keyring, tokenStr string) (*PartnerClaims, error) {
+	t, err := jwt.ParseWithClaims(tokenStr, &PartnerClaims{}, keys.Keyfunc,
+		jwt.WithValidMethods(Methods), jwt.WithAudience(PartnerAudience))
+	if err != nil {
+		return nil, err
+	}
+	if !t.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return t.Claims.(*PartnerClaims), nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA key accepted for signing tokens.
+const minRSABits = 2048
+
+// ParsePrivateKeys reads concatenated PEM private keys, PKCS#8 or PKCS#1
+// RSA, in order. Escaped newlines ("\n") are accepted so the keys can sit
+// in one environment variable. Empty input is no keys.
+func ParsePrivateKeys(data string) ([]crypto.Signer, error) {
+	rest := []byte(strings.ReplaceAll(strings.TrimSpace(data), `\n`, "\n"))
+	var keys []crypto.Signer
+	for len(rest) > 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			if strings.TrimSpace(string(rest)) != "" {
+				return nil, errors.New("auth: private keys must be PEM-encoded")
+			}
+			break
+		}
+		var (
+			key any
+			err error
+		)
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		default:
+			return nil, fmt.Errorf("auth: unexpected PEM block %q", block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("auth: private key %d: %w", len(keys)+1, err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("auth: private key %d: unsupported key type %T", len(keys)+1, key)
+		}
+		if _, err := methodFor(signer); err != nil {
+			return nil, fmt.Errorf("auth: private key %d: %w", len(keys)+1, err)
+		}
+		keys = append(keys, signer)
+	}
+	return keys, nil
+}
+
+// methodFor returns the algorithm key signs with.
+func methodFor(key crypto.Signer) (jwt.SigningMethod, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("auth: RSA keys must be at least %d bits", minRSABits)
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("auth: unsupported key type %T; use RSA or Ed25519", pub)
+	}
+}
+
+// publicKeyID names a key pair by its public half, so verifiers and the
+// JWKS agree on it without sharing anything secret.
+func publicKeyID(pub crypto.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// jwk is a public key in JSON Web Key form (RFC 7517, RFC 8037).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+func toJWK(kid, alg string, pub crypto.PublicKey) jwk {
+	k := jwk{Kid: kid, Use: "sig", Alg: alg}
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		k.Kty, k.N, k.E = "RSA", b64(pub.N.Bytes()), b64(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		k.Kty, k.Crv, k.X = "OKP", "Ed25519", b64(pub)
+	}
+	return k
+}
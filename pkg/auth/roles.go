@@ -0,0 +1,98 @@
+package auth
+
+// Roles carried in the access token's `role` claim.
+const (
+	RoleUser       = "user"
+	RoleSupport    = "support"
+	RoleFinance    = "finance"
+	RoleSuperadmin = "superadmin"
+
+	// RoleLegacyAdmin is the pre-split admin role; treated as superadmin so
+	// access tokens minted before the migration keep working until expiry.
+	RoleLegacyAdmin = "admin"
+)
+
+type Permission string
+
+const (
+	PermUsersRead        Permission = "users:read"
+	PermUsersManage      Permission = "users:manage"
+	PermTransactionsRead Permission = "transactions:read"
+	PermTopup            Permission = "topups:create"
+	PermWithdrawalsAct   Permission = "withdrawals:approve"
+	PermVouchersManage   Permission = "vouchers:manage"
+	PermAdjustPropose    Permission = "adjustments:propose"
+	PermAdjustApprove    Permission = "adjustments:approve"
+	PermReportsRead      Permission = "reports:read"
+	PermReportsGenerate  Permission = "reports:generate"
+	PermFraudRead        Permission = "fraud:read"
+	PermFraudReview      Permission = "fraud:review"
+	PermAuditRead        Permission = "audit:read"
+	PermRolesManage      Permission = "roles:manage"
+	PermImpersonate      Permission = "users:impersonate"
+	PermSettingsManage   Permission = "settings:manage"
+	PermDataRequests     Permission = "privacy:requests"
+	PermSupportTickets   Permission = "support:tickets"
+	PermPIIRead          Permission = "pii:read" // unredacted provider payloads
+	PermPartnersManage   Permission = "partners:manage"
+	PermUsersImport      Permission = "users:import"
+	PermUsersMerge       Permission = "users:merge" // moves balances between accounts
+	PermUsersStatus      Permission = "users:status"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleSupport: {
+		PermUsersRead,
+		PermTransactionsRead,
+		PermFraudRead,
+		PermImpersonate,
+		PermDataRequests,
+		PermSupportTickets,
+	},
+	RoleFinance: {
+		PermUsersRead,
+		PermTransactionsRead,
+		PermTopup,
+		PermWithdrawalsAct,
+		PermVouchersManage,
+		PermAdjustPropose,
+		PermAdjustApprove,
+		PermReportsRead,
+		PermReportsGenerate,
+		PermFraudRead,
+		PermFraudReview,
+	},
+}
+
+// IsAdminRole reports whether role grants access to any /v1/admin route.
+func IsAdminRole(role string) bool {
+	switch role {
+	case RoleSupport, RoleFinance, RoleSuperadmin, RoleLegacyAdmin:
+		return true
+	}
+	return false
+}
+
+// IsValidRole reports whether role may be assigned to a user.
+func IsValidRole(role string) bool {
+	return role == RoleUser || (IsAdminRole(role) && role != RoleLegacyAdmin)
+}
+
+// IsSuperadmin reports whether role is superadmin (or legacy admin).
+func IsSuperadmin(role string) bool {
+	return role == RoleSuperadmin || role == RoleLegacyAdmin
+}
+
+// HasPermission reports whether role is allowed to perform p.
+// Superadmin (and legacy admin) can do everything.
+func HasPermission(role string, p Permission) bool {
+	if IsSuperadmin(role) {
+		return true
+	}
+	for _, rp := range rolePermissions[role] {
+		if rp == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package auth
+
+import "strings"
+
+// Scope is what a partner access token may do on its account.
+type Scope string
+
+const (
+	ScopeWalletRead     Scope = "wallet:read"
+	ScopeGiftsWrite     Scope = "gifts:write"
+	ScopeVouchersWrite  Scope = "vouchers:write" // top-ups for the partner's customers
+	ScopeWebhooksManage Scope = "webhooks:manage"
+)
+
+// AllScopes is every scope, in the order they are listed to clients.
+var AllScopes = []Scope{ScopeWalletRead, ScopeGiftsWrite, ScopeVouchersWrite, ScopeWebhooksManage}
+
+// IsValidScope reports whether s is a known scope.
+func IsValidScope(s string) bool {
+	for _, sc := range AllScopes {
+		if string(sc) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScopes splits a space-delimited OAuth scope string.
+func ParseScopes(s string) []string {
+	return strings.Fields(s)
+}
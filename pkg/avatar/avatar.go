@@ -0,0 +1,86 @@
+// Package avatar checks uploaded profile pictures and normalizes them to a
+// square JPEG of one size, which also drops any metadata (EXIF location and
+// the like) the original carried.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+)
+
+const (
+	Size        = 512          // edge of the normalized image, pixels
+	MaxBytes    = 5 << 20      // largest upload accepted
+	ContentType = "image/jpeg" // of normalized images
+
+	minEdge   = 64         // smaller images are refused
+	maxPixels = 40_000_000 // bounds decoding memory
+	quality   = 85         // JPEG quality of normalized images
+)
+
+var (
+	ErrFormat     = errors.New("avatar: not a JPEG or PNG image")
+	ErrDimensions = errors.New("avatar: image too small or too large")
+)
+
+// Normalize decodes a JPEG or PNG, crops it to a centred square and scales
+// that to Size×Size, returning it as a JPEG.
+func Normalize(b []byte) ([]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return nil, ErrFormat
+	}
+	if cfg.Width < minEdge || cfg.Height < minEdge || cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrDimensions
+	}
+	src, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrFormat
+	}
+
+	bounds := src.Bounds()
+	edge := min(bounds.Dx(), bounds.Dy())
+	x0 := bounds.Min.X + (bounds.Dx()-edge)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-edge)/2
+	dst := scale(src, image.Rect(x0, y0, x0+edge, y0+edge), Size)
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// scale box-filters the square r of src down (or nearest-neighbour up) to
+// size×size, flattening transparency onto white.
+func scale(src image.Image, r image.Rectangle, size int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	edge := r.Dx()
+	for y := 0; y < size; y++ {
+		sy0 := r.Min.Y + y*edge/size
+		sy1 := max(r.Min.Y+(y+1)*edge/size, sy0+1)
+		for x := 0; x < size; x++ {
+			sx0 := r.Min.X + x*edge/size
+			sx1 := max(r.Min.X+(x+1)*edge/size, sx0+1)
+			var rs, gs, bs, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					// premultiplied: add the white the alpha leaves showing
+					rs += uint64(cr + 0xffff - ca)
+					gs += uint64(cg + 0xffff - ca)
+					bs += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(rs / n >> 8), G: uint8(gs / n >> 8), B: uint8(bs / n >> 8), A: 0xff,
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,159 @@
+// Package breaker is a circuit breaker for calls to external services.
+// After Threshold consecutive failures it opens and fails calls fast for
+// Cooldown; then it lets a single probe through (half-open) and closes
+// again if the probe succeeds.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is matched (errors.Is) by the *OpenError returned, without
+// calling the service, while the breaker is open.
+var ErrOpen = errors.New("circuit breaker open")
+
+// OpenError says which breaker refused the call and when to try again.
+type OpenError struct {
+	Name       string
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string     { return e.Name + ": " + ErrOpen.Error() }
+func (e *OpenError) Is(err error) bool { return err == ErrOpen }
+
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	}
+	return "closed"
+}
+
+// probeWait is the retry hint given to callers turned away while a
+// half-open probe is in flight.
+const probeWait = 5 * time.Second
+
+type Breaker struct {
+	Name      string
+	Threshold int
+	Cooldown  time.Duration
+	// IsFailure decides which errors count against the service. Nil counts
+	// every non-nil error.
+	IsFailure func(error) bool
+	// OnStateChange is called, outside the lock, after each transition.
+	OnStateChange func(b *Breaker, from, to State)
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+}
+
+func New(name string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Name: name, Threshold: threshold, Cooldown: cooldown}
+}
+
+// Do runs fn unless the breaker is open, and records its outcome.
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case Open:
+		if d := b.Cooldown - time.Since(b.openedAt); d > 0 {
+			b.mu.Unlock()
+			return &OpenError{Name: b.Name, RetryAfter: d}
+		}
+		b.state, b.probing = HalfOpen, true
+	case HalfOpen:
+		if b.probing {
+			// a probe is in flight; its outcome decides
+			b.mu.Unlock()
+			return &OpenError{Name: b.Name, RetryAfter: probeWait}
+		}
+		b.probing = true
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+	return nil
+}
+
+func (b *Breaker) record(err error) {
+	failed := err != nil && (b.IsFailure == nil || b.IsFailure(err))
+	b.mu.Lock()
+	from := b.state
+	b.probing = false
+	if failed {
+		b.failures++
+		b.lastError = err.Error()
+		if b.state == HalfOpen || b.failures >= b.Threshold {
+			b.state, b.openedAt = Open, time.Now()
+		}
+	} else {
+		b.failures = 0
+		b.state = Closed
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.OnStateChange != nil {
+		b.OnStateChange(b, from, to)
+	}
+}
+
+// Reset closes the breaker, e.g. after an operator confirms the provider
+// has recovered.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	from := b.state
+	b.state, b.failures, b.probing = Closed, 0, false
+	b.mu.Unlock()
+	b.notify(from, Closed)
+}
+
+// Snapshot is a point-in-time view of a breaker.
+type Snapshot struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	Failures  int        `json:"consecutiveFailures"`
+	OpenedAt  *time.Time `json:"openedAt,omitempty"`
+	RetryAt   *time.Time `json:"retryAt,omitempty"` // when an open breaker lets a probe through
+	LastError string     `json:"lastError,omitempty"`
+}
+
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Snapshot{Name: b.Name, State: b.state.String(), Failures: b.failures, LastError: b.lastError}
+	if b.state != Closed {
+		opened, retry := b.openedAt, b.openedAt.Add(b.Cooldown)
+		s.OpenedAt, s.RetryAt = &opened, &retry
+	}
+	return s
+}
@@ -0,0 +1,67 @@
+// Package cache is a read-through JSON cache in Redis for hot primary-key
+// lookups. It is an optimisation only: when Redis is unavailable, or the
+// Cache is nil, every read falls through to the loader.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+type Cache struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// New returns a cache whose keys are namespaced under prefix.
+func New(rdb *redis.Client, prefix string) *Cache {
+	return &Cache{rdb: rdb, prefix: prefix}
+}
+
+// Fetch returns the cached value for key, or calls load and caches its
+// result for ttl. Errors from load are returned and never cached.
+func Fetch[T any](ctx context.Context, c *Cache, key string, ttl time.Duration, load func(context.Context) (T, error)) (T, error) {
+	if c == nil || c.rdb == nil {
+		return load(ctx)
+	}
+	raw, err := c.rdb.Get(ctx, c.prefix+key).Bytes()
+	if err == nil {
+		var v T
+		if json.Unmarshal(raw, &v) == nil {
+			return v, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		log.Warn().Err(err).Str("key", key).Msg("cache read failed")
+	}
+
+	v, err := load(ctx)
+	if err != nil {
+		return v, err
+	}
+	if raw, err := json.Marshal(v); err == nil {
+		if err := c.rdb.Set(ctx, c.prefix+key, raw, ttl).Err(); err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("cache write failed")
+		}
+	}
+	return v, nil
+}
+
+// Delete invalidates keys. Call it after the change commits; an entry a
+// concurrent reader re-caches from the old row lives at most one TTL.
+func (c *Cache) Delete(ctx context.Context, keys ...string) {
+	if c == nil || c.rdb == nil || len(keys) == 0 {
+		return
+	}
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = c.prefix + k
+	}
+	if err := c.rdb.Del(ctx, full...).Err(); err != nil {
+		log.Error().Err(err).Strs("keys", keys).Msg("cache invalidation failed")
+	}
+}
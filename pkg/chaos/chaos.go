@@ -0,0 +1,214 @@
+// Package chaos injects faults on purpose so retry, circuit breaker and
+// refund paths can be exercised outside production: added latency on HTTP
+// requests, failing payment provider calls and failing database queries,
+// each on a configurable share of calls.
+//
+// An Injector does nothing until a Config is applied, and a Config always
+// expires. With Redis the active Config is shared, so setting it through one
+// API instance reaches the others and the workers on their next poll. A nil
+// *Injector is valid and never injects anything, which is what production
+// gets.
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInjected is the cause of every injected failure.
+var ErrInjected = errors.New("chaos: injected failure")
+
+// MaxDuration bounds how long one Config may stay active.
+const MaxDuration = 4 * time.Hour
+
+const stateKey = "okies:chaos"
+
+// Config is one fault-injection run. Percentages are 0-100.
+type Config struct {
+	// LatencyPercent of HTTP requests are delayed by a uniformly random
+	// LatencyMinMS-LatencyMaxMS before they are handled.
+	LatencyPercent float64 `json:"latencyPercent"`
+	LatencyMinMS   int     `json:"latencyMinMs"`
+	LatencyMaxMS   int     `json:"latencyMaxMs"`
+	// ProviderPercent of payment provider calls fail before leaving the
+	// process, half with a network error and half with a 503.
+	ProviderPercent float64 `json:"providerPercent"`
+	// DBPercent of database queries fail before being sent.
+	DBPercent float64   `json:"dbPercent"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// SetBy is the admin who applied the Config, for the status view.
+	SetBy string `json:"setBy,omitempty"`
+}
+
+func (c *Config) active() bool { return c != nil && time.Now().Before(c.ExpiresAt) }
+
+type Injector struct {
+	rdb *redis.Client // optional
+	cur atomic.Pointer[Config]
+}
+
+// New returns an Injector with nothing active. rdb may be nil, in which case
+// a Config only applies to this process.
+func New(rdb *redis.Client) *Injector {
+	return &Injector{rdb: rdb}
+}
+
+// Current returns the active Config, or nil.
+func (in *Injector) Current() *Config {
+	if in == nil {
+		return nil
+	}
+	c := in.cur.Load()
+	if !c.active() {
+		return nil
+	}
+	return c
+}
+
+// Set activates c until c.ExpiresAt, on every instance when Redis is
+// available.
+func (in *Injector) Set(ctx context.Context, c Config) error {
+	if in.rdb != nil {
+		raw, _ := json.Marshal(c)
+		if err := in.rdb.Set(ctx, stateKey, raw, time.Until(c.ExpiresAt)).Err(); err != nil {
+			return err
+		}
+	}
+	in.cur.Store(&c)
+	log.Ctx(ctx).Warn().
+		Float64("latency_percent", c.LatencyPercent).
+		Float64("provider_percent", c.ProviderPercent).
+		Float64("db_percent", c.DBPercent).
+		Time("expires_at", c.ExpiresAt).
+		Msg("chaos mode enabled")
+	return nil
+}
+
+// Clear stops fault injection everywhere.
+func (in *Injector) Clear(ctx context.Context) error {
+	in.cur.Store(nil)
+	if in.rdb != nil {
+		if err := in.rdb.Del(ctx, stateKey).Err(); err != nil {
+			return err
+		}
+	}
+	log.Ctx(ctx).Warn().Msg("chaos mode disabled")
+	return nil
+}
+
+// Watch picks up Configs set or cleared by other instances, polling every
+// interval until ctx is done. It is a no-op without Redis.
+func (in *Injector) Watch(ctx context.Context, every time.Duration) {
+	if in == nil || in.rdb == nil {
+		return
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		in.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (in *Injector) refresh(ctx context.Context) {
+	raw, err := in.rdb.Get(ctx, stateKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		in.cur.Store(nil)
+		return
+	}
+	if err != nil {
+		// keep the current Config; it expires on its own
+		log.Warn().Err(err).Msg("chaos: read state failed")
+		return
+	}
+	var c Config
+	if json.Unmarshal(raw, &c) != nil {
+		return
+	}
+	in.cur.Store(&c)
+}
+
+// hit reports whether a call should fail, given a 0-100 percentage.
+func hit(percent float64) bool {
+	return percent > 0 && rand.Float64()*100 < percent
+}
+
+// Middleware delays a share of requests. Requests for which skip returns
+// true, such as health checks and the chaos controls themselves, are left
+// alone.
+func (in *Injector) Middleware(skip func(*http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if in == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := in.Current()
+			if c != nil && hit(c.LatencyPercent) && !skip(r) {
+				d := time.Duration(c.LatencyMinMS) * time.Millisecond
+				if spread := c.LatencyMaxMS - c.LatencyMinMS; spread > 0 {
+					d += time.Duration(rand.IntN(spread+1)) * time.Millisecond
+				}
+				log.Ctx(r.Context()).Debug().Dur("delay", d).Msg("chaos: delaying request")
+				select {
+				case <-time.After(d):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Transport wraps an outbound transport so a share of provider calls fail.
+// It belongs under any retrying transport, so the retries see the faults.
+func (in *Injector) Transport(next http.RoundTripper) http.RoundTripper {
+	if in == nil {
+		return next
+	}
+	return faultTransport{in: in, next: next}
+}
+
+type faultTransport struct {
+	in   *Injector
+	next http.RoundTripper
+}
+
+func (t faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := t.in.Current()
+	if c == nil || !hit(c.ProviderPercent) {
+		return t.next.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if rand.IntN(2) == 0 {
+		return nil, ErrInjected
+	}
+	body := `{"status":"error","message":"` + ErrInjected.Error() + `"}`
+	return &http.Response{
+		Status:        "503 Service Unavailable",
+		StatusCode:    http.StatusServiceUnavailable,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
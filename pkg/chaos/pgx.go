@@ -0,0 +1,29 @@
+package chaos
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Tracer returns a pgx query tracer that fails a share of queries. A failed
+// query gets an already-cancelled context, so pgx gives up before writing
+// anything and the connection stays usable; callers see the same error as
+// for a query whose request was cancelled.
+func (in *Injector) Tracer() pgx.QueryTracer {
+	return queryTracer{in: in}
+}
+
+type queryTracer struct{ in *Injector }
+
+func (t queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	c := t.in.Current()
+	if c == nil || !hit(c.DBPercent) {
+		return ctx
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	cancel(ErrInjected)
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
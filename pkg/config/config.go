@@ -0,0 +1,656 @@
+// Package config loads process configuration from the environment once at
+// startup. Load collects every problem it finds so a misconfigured deploy
+// fails fast with one complete error instead of one variable at a time.
+//
+// Values that can change at runtime (TTLs, limits, thresholds) live in
+// pkg/settings; their legacy env overrides are only validated here.
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sudo-init-do/okies-backend/pkg/auth"
+	"github.com/sudo-init-do/okies-backend/pkg/settings"
+	"github.com/sudo-init-do/okies-backend/pkg/signing"
+)
+
+const devJWTSecret = "dev_change_me"
+
+type Flutterwave struct {
+	BaseURL     string
+	SecretKey   string
+	EncKey      string
+	WebhookHash string
+	// WebhookHashPrevious is also accepted while the dashboard's webhook
+	// hash is being changed.
+	WebhookHashPrevious string
+}
+
+type Config struct {
+	Env         string // development | production
+	Port        int
+	DatabaseURL string
+	// DatabaseReplicaURL is an optional read-only replica for listings,
+	// search and reports; it is skipped while lagging more than ReplicaMaxLag.
+	DatabaseReplicaURL string
+	ReplicaMaxLag      time.Duration
+	// DBPool tunes the primary and replica pools alike.
+	DBPool DBPool
+	// MigrateOnStart applies pending embedded migrations before serving.
+	MigrateOnStart bool
+	RedisAddr      string
+	JWTSecret      []byte
+	// JWTPreviousSecrets still verify tokens after JWTSecret is rotated;
+	// see auth.Keyring.
+	JWTPreviousSecrets [][]byte
+	// JWTPrivateKeys are PEM RSA or Ed25519 keys; when set, the first signs
+	// tokens instead of JWTSecret and the rest still verify. Their public
+	// halves are served at /.well-known/jwks.json.
+	JWTPrivateKeys string
+	// CursorSecret signs pagination cursors; it defaults to JWTSecret.
+	CursorSecret []byte
+	// QRSecret signs receive QR codes, which may be printed and so must
+	// outlive JWT secret rotations; it defaults to JWTSecret.
+	QRSecret []byte
+	// SecretsDir, when set, is watched for files named after the rotatable
+	// secrets (JWT_SECRET, JWT_PREVIOUS_SECRETS, JWT_PRIVATE_KEYS,
+	// FLW_SEC_KEY, FLW_WEBHOOK_HASH, FLW_WEBHOOK_HASH_PREVIOUS,
+	// SIGNING_KEYS), which
+	// override the environment and take effect without a restart.
+	SecretsDir string
+	// SigningKeys sign calls to internal services ("id:secret,..."; see
+	// pkg/signing). The first key is current; list the next one too while
+	// consumers pick it up.
+	SigningKeys string
+
+	Flutterwave Flutterwave
+
+	// Tracing; spans are only exported when OTLPEndpoint is set.
+	OTLPEndpoint     string
+	ServiceName      string
+	TraceSampleRatio float64
+
+	// Error tracking; panics, 5xx responses and error logs are reported to
+	// Sentry when SentryDSN is set.
+	SentryDSN        string
+	SentryRelease    string
+	SentrySampleRate float64
+
+	MetricsToken         string // optional bearer for GET /metrics
+	AlertWebhookURL      string // optional; see Alerts for the other channels
+	FloatMonitorInterval time.Duration
+	// SlowQuery is the duration from which a database query is logged as
+	// slow; 0 logs none.
+	SlowQuery time.Duration
+
+	WorkerConcurrency int // jobs run in parallel by `api worker`
+	// ShutdownTimeout bounds how long a stopping process waits for
+	// in-flight requests, jobs and event deliveries.
+	ShutdownTimeout time.Duration
+
+	// GRPCPort serves the internal gRPC API (0 disables it); callers send
+	// InternalGRPCToken as a bearer token in the authorization metadata.
+	GRPCPort          int
+	InternalGRPCToken string
+
+	// PublicURL is where clients and providers reach this API, used for
+	// callback URLs and links in messages.
+	PublicURL string
+
+	Push   Push
+	Mail   Mail
+	SMS    SMS
+	Alerts Alerts
+
+	Encryption Encryption
+
+	OpenBanking OpenBanking
+
+	Storage Storage
+
+	SignIn SignIn
+
+	Moderation Moderation
+
+	// ChaosEnabled allows fault injection to be switched on through the
+	// admin API; never in production. See pkg/chaos.
+	ChaosEnabled bool
+}
+
+// DBPool sizes the pgx connection pools and picks how statements are
+// prepared.
+type DBPool struct {
+	MaxConns          int
+	MinConns          int
+	HealthCheckPeriod time.Duration
+	ConnectTimeout    time.Duration
+	// StatementCache is the pgx exec mode: cache_statement (prepare and
+	// cache), cache_describe, describe_exec, exec or simple_protocol. Behind
+	// PgBouncer in transaction mode, use one of the last three.
+	StatementCache string
+}
+
+// Encryption protects bank account numbers and BVNs at rest; see
+// pkg/envelope. In development, without keys, a fixed development key is
+// used.
+type Encryption struct {
+	Provider string // local | kms
+	// LocalKeys are the master keys of the local provider by ID, from
+	// ENCRYPTION_KEYS ("id:base64key,..."). The first listed, LocalActive,
+	// wraps new data keys; the rest only unwrap until resealed.
+	LocalKeys   map[string][]byte
+	LocalActive string
+
+	KMSKeyID           string // key ID, ARN or alias
+	KMSRegion          string
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+
+	// IndexKey keys the lookup hashes of encrypted values.
+	IndexKey []byte
+}
+
+// Push credentials; a platform without them gets no push notifications.
+type Push struct {
+	FCMCredentials []byte // service-account JSON, read from FCM_CREDENTIALS_FILE
+	APNsKey        []byte // .p8 key, read from APNS_KEY_FILE
+	APNsKeyID      string
+	APNsTeamID     string
+	APNsTopic      string // app bundle ID
+	APNsProduction bool
+}
+
+// Mail selects the email driver; with no driver, email is not sent.
+type Mail struct {
+	Driver string // smtp | sendgrid | ses
+	From   string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	SendGridAPIKey string
+
+	SESRegion          string
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+}
+
+// Alerts configures the chat channels operational alerts can go to besides
+// AlertWebhookURL; which alerts reach which channel is the alerts.routing
+// setting.
+type Alerts struct {
+	SlackWebhookURL string // a Slack incoming webhook
+	TelegramBaseURL string
+	TelegramToken   string // bot token
+	TelegramChatID  string
+}
+
+// OpenBanking selects the provider users link bank accounts through for
+// direct-debit deposits; with no driver, linking is unavailable.
+type OpenBanking struct {
+	Driver string // mono
+
+	MonoBaseURL       string
+	MonoSecretKey     string
+	MonoWebhookSecret string
+}
+
+// Storage is the S3 bucket user uploads (avatars) go to; with no bucket,
+// uploads are unavailable.
+type Storage struct {
+	S3Bucket           string
+	S3Region           string
+	S3Endpoint         string // for S3-compatible stores; empty for AWS
+	PublicURL          string // base URL clients read objects from, e.g. a CDN
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+}
+
+// SignIn lists our client IDs at Google and Apple, the audiences their ID
+// tokens must be issued to; a provider with none can't be linked or used to
+// log in.
+type SignIn struct {
+	GoogleClientIDs []string // the web, Android and iOS client IDs
+	AppleClientIDs  []string // the app's bundle ID and any services IDs
+}
+
+// Moderation is the optional external API names are screened with, on top
+// of the built-in denylist; see pkg/moderation.
+type Moderation struct {
+	APIURL string
+	APIKey string
+}
+
+// SMS selects the text message driver; with no driver, SMS is not sent.
+type SMS struct {
+	Driver   string // termii | twilio
+	SenderID string // Termii sender ID, or Twilio number / messaging service SID
+
+	TermiiBaseURL       string
+	TermiiAPIKey        string
+	TermiiChannel       string
+	TermiiWebhookSecret string // optional; verifies delivery reports
+
+	TwilioAccountSID string
+	TwilioAuthToken  string
+}
+
+func (c *Config) Production() bool { return c.Env == "production" }
+
+// Load reads and validates the environment.
+func Load() (*Config, error) {
+	l := loader{}
+	c := &Config{
+		Env:                l.str("APP_ENV", "development"),
+		Port:               l.intRange("PORT", 8081, 1, 65535),
+		DatabaseURL:        l.required("DATABASE_URL"),
+		DatabaseReplicaURL: l.str("DATABASE_REPLICA_URL", ""),
+		ReplicaMaxLag:      time.Duration(l.intRange("DATABASE_REPLICA_MAX_LAG_SEC", 10, 1, 3600)) * time.Second,
+		MigrateOnStart:     l.bool("MIGRATE_ON_START", false),
+		RedisAddr:          l.str("REDIS_ADDR", "localhost:6379"),
+		JWTSecret:          []byte(l.str("JWT_SECRET", devJWTSecret)),
+		JWTPreviousSecrets: SplitSecrets(l.str("JWT_PREVIOUS_SECRETS", "")),
+		JWTPrivateKeys:     l.str("JWT_PRIVATE_KEYS", ""),
+		SecretsDir:         l.str("SECRETS_DIR", ""),
+		SigningKeys:        l.str("SIGNING_KEYS", ""),
+		CursorSecret:       []byte(l.str("CURSOR_SECRET", "")),
+		QRSecret:           []byte(l.str("QR_SECRET", "")),
+		DBPool: DBPool{
+			MaxConns:          l.intRange("DB_MAX_CONNS", 10, 1, 1000),
+			MinConns:          l.intRange("DB_MIN_CONNS", 1, 0, 1000),
+			HealthCheckPeriod: time.Duration(l.intRange("DB_HEALTH_CHECK_SEC", 30, 1, 3600)) * time.Second,
+			ConnectTimeout:    time.Duration(l.intRange("DB_CONNECT_TIMEOUT_SEC", 5, 1, 300)) * time.Second,
+			StatementCache:    l.str("DB_STATEMENT_CACHE", "cache_statement"),
+		},
+		Flutterwave: Flutterwave{
+			BaseURL:             l.url("FLW_BASE_URL", "https://api.flutterwave.com"),
+			SecretKey:           l.str("FLW_SEC_KEY", ""),
+			EncKey:              l.str("FLW_ENC_KEY", ""),
+			WebhookHash:         l.str("FLW_WEBHOOK_HASH", ""),
+			WebhookHashPrevious: l.str("FLW_WEBHOOK_HASH_PREVIOUS", ""),
+		},
+		OTLPEndpoint:         l.url("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		ServiceName:          l.str("OTEL_SERVICE_NAME", "okies-api"),
+		TraceSampleRatio:     l.floatRange("OTEL_TRACES_SAMPLE_RATIO", 1, 0, 1),
+		SentryDSN:            l.url("SENTRY_DSN", ""),
+		SentryRelease:        l.str("SENTRY_RELEASE", ""),
+		SentrySampleRate:     l.floatRange("SENTRY_SAMPLE_RATE", 1, 0, 1),
+		MetricsToken:         l.str("METRICS_TOKEN", ""),
+		SlowQuery:            time.Duration(l.intRange("DB_SLOW_QUERY_MS", 250, 0, 60_000)) * time.Millisecond,
+		AlertWebhookURL:      l.url("ALERT_WEBHOOK_URL", ""),
+		FloatMonitorInterval: time.Duration(l.intRange("FLOAT_MONITOR_INTERVAL_MIN", 5, 1, 24*60)) * time.Minute,
+		WorkerConcurrency:    l.intRange("WORKER_CONCURRENCY", 4, 1, 64),
+		ShutdownTimeout:      time.Duration(l.intRange("SHUTDOWN_TIMEOUT_SEC", 25, 1, 600)) * time.Second,
+		GRPCPort:             l.intRange("GRPC_PORT", 0, 0, 65535),
+		InternalGRPCToken:    l.str("INTERNAL_GRPC_TOKEN", ""),
+		ChaosEnabled:         l.bool("CHAOS_ENABLED", false),
+		Push: Push{
+			FCMCredentials: l.file("FCM_CREDENTIALS_FILE"),
+			APNsKey:        l.file("APNS_KEY_FILE"),
+			APNsKeyID:      l.str("APNS_KEY_ID", ""),
+			APNsTeamID:     l.str("APNS_TEAM_ID", ""),
+			APNsTopic:      l.str("APNS_TOPIC", ""),
+			APNsProduction: l.bool("APNS_PRODUCTION", false),
+		},
+		PublicURL: l.url("PUBLIC_URL", ""),
+		Mail: Mail{
+			Driver:             l.str("MAIL_DRIVER", ""),
+			From:               l.str("MAIL_FROM", "Okies <no-reply@okies.app>"),
+			SMTPHost:           l.str("SMTP_HOST", ""),
+			SMTPPort:           l.intRange("SMTP_PORT", 587, 1, 65535),
+			SMTPUsername:       l.str("SMTP_USERNAME", ""),
+			SMTPPassword:       l.str("SMTP_PASSWORD", ""),
+			SendGridAPIKey:     l.str("SENDGRID_API_KEY", ""),
+			SESRegion:          l.str("SES_REGION", ""),
+			AWSAccessKeyID:     l.str("AWS_ACCESS_KEY_ID", ""),
+			AWSSecretAccessKey: l.str("AWS_SECRET_ACCESS_KEY", ""),
+		},
+		SMS: SMS{
+			Driver:              l.str("SMS_DRIVER", ""),
+			SenderID:            l.str("SMS_SENDER_ID", "Okies"),
+			TermiiBaseURL:       l.url("TERMII_BASE_URL", "https://api.ng.termii.com"),
+			TermiiAPIKey:        l.str("TERMII_API_KEY", ""),
+			TermiiChannel:       l.str("TERMII_CHANNEL", "dnd"),
+			TermiiWebhookSecret: l.str("TERMII_WEBHOOK_SECRET", ""),
+			TwilioAccountSID:    l.str("TWILIO_ACCOUNT_SID", ""),
+			TwilioAuthToken:     l.str("TWILIO_AUTH_TOKEN", ""),
+		},
+		Alerts: Alerts{
+			SlackWebhookURL: l.url("ALERT_SLACK_WEBHOOK_URL", ""),
+			TelegramBaseURL: l.url("ALERT_TELEGRAM_BASE_URL", "https://api.telegram.org"),
+			TelegramToken:   l.str("ALERT_TELEGRAM_BOT_TOKEN", ""),
+			TelegramChatID:  l.str("ALERT_TELEGRAM_CHAT_ID", ""),
+		},
+		OpenBanking: OpenBanking{
+			Driver:            l.str("OPEN_BANKING_DRIVER", ""),
+			MonoBaseURL:       l.url("MONO_BASE_URL", "https://api.withmono.com"),
+			MonoSecretKey:     l.str("MONO_SECRET_KEY", ""),
+			MonoWebhookSecret: l.str("MONO_WEBHOOK_SECRET", ""),
+		},
+		Storage: Storage{
+			S3Bucket:           l.str("S3_BUCKET", ""),
+			S3Region:           l.str("S3_REGION", ""),
+			S3Endpoint:         l.url("S3_ENDPOINT", ""),
+			PublicURL:          l.url("MEDIA_PUBLIC_URL", ""),
+			AWSAccessKeyID:     l.str("AWS_ACCESS_KEY_ID", ""),
+			AWSSecretAccessKey: l.str("AWS_SECRET_ACCESS_KEY", ""),
+		},
+		SignIn: SignIn{
+			GoogleClientIDs: l.list("GOOGLE_CLIENT_IDS"),
+			AppleClientIDs:  l.list("APPLE_CLIENT_IDS"),
+		},
+		Moderation: Moderation{
+			APIURL: l.url("MODERATION_API_URL", ""),
+			APIKey: l.str("MODERATION_API_KEY", ""),
+		},
+	}
+
+	if len(c.CursorSecret) == 0 {
+		c.CursorSecret = c.JWTSecret
+	}
+	if len(c.QRSecret) == 0 {
+		c.QRSecret = c.JWTSecret
+	}
+	c.Encryption = l.encryption(c.Env == "production")
+
+	switch c.Env {
+	case "development", "production":
+	default:
+		l.fail("APP_ENV", "must be development or production, got %q", c.Env)
+	}
+	if c.Production() {
+		if string(c.JWTSecret) == devJWTSecret || len(c.JWTSecret) < 32 {
+			l.fail("JWT_SECRET", "must be set to at least 32 bytes in production")
+		}
+		for _, s := range c.JWTPreviousSecrets {
+			if len(s) < 32 {
+				l.fail("JWT_PREVIOUS_SECRETS", "each must be at least 32 bytes in production")
+				break
+			}
+		}
+		if c.Flutterwave.SecretKey != "" && c.Flutterwave.WebhookHash == "" {
+			l.fail("FLW_WEBHOOK_HASH", "required when FLW_SEC_KEY is set in production")
+		}
+		if c.ChaosEnabled {
+			l.fail("CHAOS_ENABLED", "must not be set in production")
+		}
+	}
+
+	if _, err := auth.ParsePrivateKeys(c.JWTPrivateKeys); err != nil {
+		l.fail("JWT_PRIVATE_KEYS", "%v", err)
+	}
+	if _, err := signing.ParseKeys(c.SigningKeys); err != nil {
+		l.fail("SIGNING_KEYS", "%v", err)
+	}
+
+	if c.DBPool.MinConns > c.DBPool.MaxConns {
+		l.fail("DB_MIN_CONNS", "must not exceed DB_MAX_CONNS")
+	}
+	switch c.DBPool.StatementCache {
+	case "cache_statement", "cache_describe", "describe_exec", "exec", "simple_protocol":
+	default:
+		l.fail("DB_STATEMENT_CACHE", "must be cache_statement, cache_describe, describe_exec, exec or simple_protocol, got %q", c.DBPool.StatementCache)
+	}
+
+	if c.GRPCPort != 0 {
+		if c.GRPCPort == c.Port {
+			l.fail("GRPC_PORT", "must differ from PORT")
+		}
+		if len(c.InternalGRPCToken) < 32 {
+			l.fail("INTERNAL_GRPC_TOKEN", "must be at least 32 bytes when GRPC_PORT is set")
+		}
+	}
+
+	if c.Push.APNsKey != nil && (c.Push.APNsKeyID == "" || c.Push.APNsTeamID == "" || c.Push.APNsTopic == "") {
+		l.fail("APNS_KEY_FILE", "needs APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC")
+	}
+
+	switch c.Mail.Driver {
+	case "":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			l.fail("SMTP_HOST", "required when MAIL_DRIVER=smtp")
+		}
+	case "sendgrid":
+		if c.Mail.SendGridAPIKey == "" {
+			l.fail("SENDGRID_API_KEY", "required when MAIL_DRIVER=sendgrid")
+		}
+	case "ses":
+		if c.Mail.SESRegion == "" || c.Mail.AWSAccessKeyID == "" || c.Mail.AWSSecretAccessKey == "" {
+			l.fail("SES_REGION", "SES_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required when MAIL_DRIVER=ses")
+		}
+	default:
+		l.fail("MAIL_DRIVER", "must be smtp, sendgrid or ses, got %q", c.Mail.Driver)
+	}
+
+	switch c.SMS.Driver {
+	case "":
+	case "termii":
+		if c.SMS.TermiiAPIKey == "" {
+			l.fail("TERMII_API_KEY", "required when SMS_DRIVER=termii")
+		}
+	case "twilio":
+		if c.SMS.TwilioAccountSID == "" || c.SMS.TwilioAuthToken == "" {
+			l.fail("TWILIO_ACCOUNT_SID", "TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required when SMS_DRIVER=twilio")
+		}
+	default:
+		l.fail("SMS_DRIVER", "must be termii or twilio, got %q", c.SMS.Driver)
+	}
+
+	switch c.OpenBanking.Driver {
+	case "":
+	case "mono":
+		if c.OpenBanking.MonoSecretKey == "" || c.OpenBanking.MonoWebhookSecret == "" {
+			l.fail("MONO_SECRET_KEY", "MONO_SECRET_KEY and MONO_WEBHOOK_SECRET are required when OPEN_BANKING_DRIVER=mono")
+		}
+	default:
+		l.fail("OPEN_BANKING_DRIVER", "must be mono, got %q", c.OpenBanking.Driver)
+	}
+
+	if st := c.Storage; st.S3Bucket != "" && (st.S3Region == "" || st.AWSAccessKeyID == "" || st.AWSSecretAccessKey == "") {
+		l.fail("S3_REGION", "S3_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required when S3_BUCKET is set")
+	}
+
+	if (c.Alerts.TelegramToken == "") != (c.Alerts.TelegramChatID == "") {
+		l.fail("ALERT_TELEGRAM_BOT_TOKEN", "ALERT_TELEGRAM_BOT_TOKEN and ALERT_TELEGRAM_CHAT_ID must be set together")
+	}
+
+	// env overrides for runtime settings must at least parse
+	for _, d := range settings.Defs() {
+		if d.Env == "" {
+			continue
+		}
+		if v := strings.TrimSpace(os.Getenv(d.Env)); v != "" && d.Validate(v) != nil {
+			l.fail(d.Env, "invalid %s value %q for setting %s", d.Kind, v, d.Key)
+		}
+	}
+
+	if err := errors.Join(l.errs...); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return c, nil
+}
+
+type loader struct{ errs []error }
+
+func (l *loader) fail(key, format string, args ...any) {
+	l.errs = append(l.errs, fmt.Errorf("  %s: "+format, append([]any{key}, args...)...))
+}
+
+func (l *loader) str(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+// list reads a comma-separated list, skipping blanks.
+func (l *loader) list(key string) []string {
+	var out []string
+	for _, v := range strings.Split(l.str(key, ""), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (l *loader) required(key string) string {
+	v := l.str(key, "")
+	if v == "" {
+		l.fail(key, "required")
+	}
+	return v
+}
+
+func (l *loader) intRange(key string, def, min, max int) int {
+	v := l.str(key, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		l.fail(key, "must be an integer in [%d, %d], got %q", min, max, v)
+		return def
+	}
+	return n
+}
+
+func (l *loader) floatRange(key string, def, min, max float64) float64 {
+	v := l.str(key, "")
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < min || f > max {
+		l.fail(key, "must be a number in [%g, %g], got %q", min, max, v)
+		return def
+	}
+	return f
+}
+
+func (l *loader) bool(key string, def bool) bool {
+	v := l.str(key, "")
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		l.fail(key, "must be a boolean, got %q", v)
+		return def
+	}
+	return b
+}
+
+// file returns the contents of the file named by key, or nil when unset.
+func (l *loader) file(key string) []byte {
+	path := l.str(key, "")
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		l.fail(key, "cannot read %q: %v", path, err)
+		return nil
+	}
+	return b
+}
+
+func (l *loader) url(key, def string) string {
+	v := l.str(key, def)
+	if v == "" {
+		return ""
+	}
+	if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		l.fail(key, "must be an http(s) URL, got %q", v)
+	}
+	return strings.TrimRight(v, "/")
+}
+
+// SplitSecrets parses a comma-separated list of secrets, skipping blanks.
+func SplitSecrets(v string) [][]byte {
+	var out [][]byte
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, []byte(s))
+		}
+	}
+	return out
+}
+
+// devEncryptionKey stands in for the master and index keys in development.
+var devEncryptionKey = sha256.Sum256([]byte("okies-dev-encryption-key"))
+
+func (l *loader) encryption(production bool) Encryption {
+	e := Encryption{
+		Provider:           l.str("ENCRYPTION_PROVIDER", "local"),
+		KMSKeyID:           l.str("KMS_KEY_ID", ""),
+		KMSRegion:          l.str("KMS_REGION", ""),
+		AWSAccessKeyID:     l.str("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretAccessKey: l.str("AWS_SECRET_ACCESS_KEY", ""),
+		IndexKey:           l.key("ENCRYPTION_INDEX_KEY"),
+	}
+	if e.IndexKey == nil {
+		if production && l.str("ENCRYPTION_INDEX_KEY", "") == "" {
+			l.fail("ENCRYPTION_INDEX_KEY", "required in production")
+		}
+		e.IndexKey = devEncryptionKey[:]
+	}
+
+	switch e.Provider {
+	case "local":
+		raw := l.str("ENCRYPTION_KEYS", "")
+		if raw == "" {
+			if production {
+				l.fail("ENCRYPTION_KEYS", "required in production when ENCRYPTION_PROVIDER=local")
+			}
+			e.LocalActive = "dev"
+			e.LocalKeys = map[string][]byte{"dev": devEncryptionKey[:]}
+			break
+		}
+		e.LocalKeys = map[string][]byte{}
+		for _, entry := range strings.Split(raw, ",") {
+			id, b64, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			key, err := base64.StdEncoding.DecodeString(b64)
+			if !ok || id == "" || err != nil || len(key) != 32 {
+				l.fail("ENCRYPTION_KEYS", "entries must be id:base64 of 32 bytes, got one for %q", id)
+				continue
+			}
+			if e.LocalActive == "" {
+				e.LocalActive = id
+			}
+			e.LocalKeys[id] = key
+		}
+	case "kms":
+		if e.KMSKeyID == "" || e.KMSRegion == "" || e.AWSAccessKeyID == "" || e.AWSSecretAccessKey == "" {
+			l.fail("KMS_KEY_ID", "KMS_KEY_ID, KMS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required when ENCRYPTION_PROVIDER=kms")
+		}
+	default:
+		l.fail("ENCRYPTION_PROVIDER", "must be local or kms, got %q", e.Provider)
+	}
+	return e
+}
+
+// key decodes a base64 32-byte key, or returns nil when unset.
+func (l *loader) key(name string) []byte {
+	v := l.str(name, "")
+	if v == "" {
+		return nil
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || len(b) != 32 {
+		l.fail(name, "must be base64 of 32 bytes")
+		return nil
+	}
+	return b
+}
@@ -2,26 +2,75 @@ package db
 
 import (
 	"context"
-	"os"
+	"fmt"
 	"time"
 
+	"github.com/exaring/otelpgx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func MustOpenPool(ctx context.Context) *pgxpool.Pool {
-	url := os.Getenv("DATABASE_URL")
-	if url == "" {
-		panic("DATABASE_URL not set")
-	}
+// PoolOptions sizes a pool and picks how statements are prepared. Zero
+// fields keep pgx's defaults.
+type PoolOptions struct {
+	MaxConns          int
+	MinConns          int
+	HealthCheckPeriod time.Duration
+	ConnectTimeout    time.Duration
+	// StatementCache names a pgx.QueryExecMode: cache_statement,
+	// cache_describe, describe_exec, exec or simple_protocol.
+	StatementCache string
+}
+
+// DefaultPoolOptions suits tools and tests that don't read the config.
+func DefaultPoolOptions() PoolOptions {
+	return PoolOptions{MaxConns: 10, MinConns: 1, HealthCheckPeriod: 30 * time.Second, ConnectTimeout: 5 * time.Second}
+}
+
+var execModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// OpenPool creates a pool without connecting; the first query dials. Queries
+// are traced with OpenTelemetry and then any extra tracers, in order.
+func OpenPool(ctx context.Context, url string, o PoolOptions, tracers ...pgx.QueryTracer) (*pgxpool.Pool, error) {
 	cfg, err := pgxpool.ParseConfig(url)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	cfg.MaxConns = 10
-	cfg.MinConns = 1
-	cfg.HealthCheckPeriod = 30 * time.Second
+	if o.MaxConns > 0 {
+		cfg.MaxConns = int32(o.MaxConns)
+	}
+	if o.MinConns > 0 {
+		cfg.MinConns = int32(o.MinConns)
+	}
+	if o.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = o.HealthCheckPeriod
+	}
+	if o.ConnectTimeout > 0 {
+		cfg.ConnConfig.ConnectTimeout = o.ConnectTimeout
+	}
+	if o.StatementCache != "" {
+		mode, ok := execModes[o.StatementCache]
+		if !ok {
+			return nil, fmt.Errorf("unknown statement cache mode %q", o.StatementCache)
+		}
+		cfg.ConnConfig.DefaultQueryExecMode = mode
+	}
+	cfg.ConnConfig.Tracer = otelpgx.NewTracer()
+	if len(tracers) > 0 {
+		cfg.ConnConfig.Tracer = multitracer.New(append([]pgx.QueryTracer{cfg.ConnConfig.Tracer}, tracers...)...)
+	}
+	return pgxpool.NewWithConfig(ctx, cfg)
+}
 
-	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+func MustOpenPool(ctx context.Context, url string, o PoolOptions, tracers ...pgx.QueryTracer) *pgxpool.Pool {
+	pool, err := OpenPool(ctx, url, o, tracers...)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	pgxmigrate "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/sudo-init-do/okies-backend/infra/migrations"
+)
+
+// NewMigrator returns a golang-migrate instance over the embedded migrations.
+// It shares the schema_migrations table with the migrate CLI, so databases
+// migrated by hand keep working. Callers must Close it.
+func NewMigrator(url string) (*migrate.Migrate, error) {
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+	drv, err := pgxmigrate.WithInstance(conn, &pgxmigrate.Config{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return migrate.NewWithInstance("iofs", src, "pgx5", drv)
+}
+
+// MigrateUp applies all pending migrations. Being up to date is not an error.
+func MigrateUp(url string) error {
+	m, err := NewMigrator(url)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// MigrationState compares the database's schema version with the newest
+// embedded migration.
+type MigrationState struct {
+	Current uint `json:"current"`
+	Latest  uint `json:"latest"`
+	Dirty   bool `json:"dirty"`
+}
+
+// Pending reports whether embedded migrations have not been applied.
+func (s MigrationState) Pending() bool { return s.Current < s.Latest }
+
+// Migrations reads schema_migrations without taking golang-migrate's lock,
+// so it is cheap enough for health checks.
+func Migrations(ctx context.Context, pool *pgxpool.Pool) (MigrationState, error) {
+	var st MigrationState
+	latest, err := latestMigration()
+	if err != nil {
+		return st, err
+	}
+	st.Latest = latest
+	var v int64
+	err = pool.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&v, &st.Dirty)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return st, err
+	}
+	st.Current = uint(v)
+	return st, nil
+}
+
+func latestMigration() (uint, error) {
+	entries, err := fs.ReadDir(migrations.FS, ".")
+	if err != nil {
+		return 0, err
+	}
+	var latest uint
+	for _, e := range entries {
+		num, _, ok := strings.Cut(e.Name(), "_")
+		if !ok || !strings.HasSuffix(e.Name(), ".up.sql") {
+			continue
+		}
+		if n, err := strconv.ParseUint(num, 10, 64); err == nil && uint(n) > latest {
+			latest = uint(n)
+		}
+	}
+	return latest, nil
+}
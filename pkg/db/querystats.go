@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// maxQueryKeys bounds the aggregates kept; queries first seen after that
+// are counted under OtherQuery so dynamic SQL can't grow memory or metric
+// cardinality without limit.
+const maxQueryKeys = 1000
+
+// OtherQuery stands in for queries past maxQueryKeys.
+const OtherQuery = "other"
+
+// maxQueryText is how much of a normalized statement is kept as its key.
+const maxQueryText = 160
+
+// QueryKey identifies an aggregate: a statement, whitespace-collapsed and
+// truncated, and the caller that ran it (a route or job kind).
+type QueryKey struct {
+	Query  string
+	Caller string
+}
+
+// QueryAgg is what QueryStats has seen of one QueryKey.
+type QueryAgg struct {
+	Count  int64
+	Errors int64
+	Rows   int64
+	Total  time.Duration
+	Max    time.Duration
+}
+
+// QueryStats is a pgx tracer that times every query, logs the ones slower
+// than Slow with their caller and row count, and aggregates the rest for
+// metrics. Pass it to OpenPool.
+type QueryStats struct {
+	Slow time.Duration
+	// Caller names what issued a query from its context; "" when unknown.
+	Caller func(ctx context.Context) string
+
+	mu   sync.Mutex
+	aggs map[QueryKey]*QueryAgg
+}
+
+func NewQueryStats(slow time.Duration, caller func(ctx context.Context) string) *QueryStats {
+	return &QueryStats{Slow: slow, Caller: caller, aggs: map[QueryKey]*QueryAgg{}}
+}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql string
+	at  time.Time
+}
+
+func (s *QueryStats) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, at: time.Now()})
+}
+
+func (s *QueryStats) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	took := time.Since(start.at)
+	key := QueryKey{Query: normalizeQuery(start.sql)}
+	if s.Caller != nil {
+		key.Caller = s.Caller(ctx)
+	}
+	rows := data.CommandTag.RowsAffected()
+
+	s.mu.Lock()
+	agg := s.aggs[key]
+	if agg == nil {
+		if len(s.aggs) >= maxQueryKeys {
+			key.Query = OtherQuery
+			agg = s.aggs[key]
+		}
+		if agg == nil {
+			agg = &QueryAgg{}
+			s.aggs[key] = agg
+		}
+	}
+	agg.Count++
+	agg.Rows += rows
+	agg.Total += took
+	agg.Max = max(agg.Max, took)
+	if data.Err != nil {
+		agg.Errors++
+	}
+	s.mu.Unlock()
+
+	if s.Slow > 0 && took >= s.Slow {
+		log.Ctx(ctx).Warn().
+			Str("sql", key.Query).
+			Str("caller", key.Caller).
+			Dur("duration", took).
+			Int64("rows", rows).
+			AnErr("query_error", data.Err).
+			Msg("slow query")
+	}
+}
+
+// Snapshot copies the aggregates.
+func (s *QueryStats) Snapshot() map[QueryKey]QueryAgg {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[QueryKey]QueryAgg, len(s.aggs))
+	for k, v := range s.aggs {
+		out[k] = *v
+	}
+	return out
+}
+
+// normalizeQuery collapses whitespace so the same statement formatted across
+// lines gets one key, and truncates it. Arguments are never part of it.
+func normalizeQuery(sql string) string {
+	q := strings.Join(strings.Fields(sql), " ")
+	if len(q) > maxQueryText {
+		q = q[:maxQueryText]
+	}
+	return q
+}
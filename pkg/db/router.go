@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Router picks a pool per query. Writes, and reads that must see them (balance
+// checks, read-your-write flows), use Primary. Reads that tolerate a few
+// seconds of staleness (listings, search, reports) use Read, which is the
+// replica while it is reachable and within maxLag of the primary.
+type Router struct {
+	Primary *pgxpool.Pool
+	replica *pgxpool.Pool
+	maxLag  time.Duration
+	healthy atomic.Bool
+}
+
+// NewRouter returns a router; replica may be nil, in which case every read
+// goes to the primary.
+func NewRouter(primary, replica *pgxpool.Pool, maxLag time.Duration) *Router {
+	r := &Router{Primary: primary, replica: replica, maxLag: maxLag}
+	r.healthy.Store(replica != nil)
+	return r
+}
+
+// ReplicaPool returns the replica pool, nil when none is configured.
+func (r *Router) ReplicaPool() *pgxpool.Pool { return r.replica }
+
+// Read returns the pool for staleness-tolerant reads.
+func (r *Router) Read() *pgxpool.Pool {
+	if r.replica != nil && r.healthy.Load() {
+		return r.replica
+	}
+	return r.Primary
+}
+
+// Lag reports the replica's replay delay. It is zero on an idle primary
+// with nothing to replay, which is fine: nothing is stale.
+func (r *Router) Lag(ctx context.Context) (time.Duration, error) {
+	var secs float64
+	err := r.replica.QueryRow(ctx, `
+		SELECT COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		       * CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0 ELSE 1 END
+	`).Scan(&secs)
+	return time.Duration(secs * float64(time.Second)), err
+}
+
+// Monitor checks the replica every interval and routes reads back to the
+// primary while it is unreachable or lagging. It returns when ctx is done.
+func (r *Router) Monitor(ctx context.Context, interval time.Duration) {
+	if r.replica == nil {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		c, cancel := context.WithTimeout(ctx, interval)
+		lag, err := r.Lag(c)
+		cancel()
+		ok := err == nil && lag <= r.maxLag
+		if was := r.healthy.Swap(ok); was != ok {
+			ev := log.Warn()
+			if ok {
+				ev = log.Info()
+			}
+			ev.Err(err).Dur("lag", lag).Bool("replica_in_use", ok).Msg("read replica routing changed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Replica reports whether a replica is configured and currently in use.
+func (r *Router) Replica() bool { return r.replica != nil && r.healthy.Load() }
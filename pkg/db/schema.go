@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Schema is what code expects to find: table name to the columns it reads
+// or writes.
+type Schema map[string][]string
+
+// SchemaDrift lists what is missing from the database's current schema,
+// as "table" or "table.column", sorted. Nil means everything is there.
+func SchemaDrift(ctx context.Context, pool *pgxpool.Pool, want Schema) ([]string, error) {
+	tables := make([]string, 0, len(want))
+	for t := range want {
+		tables = append(tables, t)
+	}
+	rows, err := pool.Query(ctx, `
+		SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ANY($1)
+	`, tables)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	have := map[string]map[string]bool{}
+	for rows.Next() {
+		var t, c string
+		if err := rows.Scan(&t, &c); err != nil {
+			return nil, err
+		}
+		if have[t] == nil {
+			have[t] = map[string]bool{}
+		}
+		have[t][c] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for t, cols := range want {
+		if have[t] == nil {
+			missing = append(missing, t)
+			continue
+		}
+		for _, c := range cols {
+			if !have[t][c] {
+				missing = append(missing, fmt.Sprintf("%s.%s", t, c))
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
@@ -0,0 +1,215 @@
+// Package envelope encrypts small secrets, such as bank account numbers and
+// BVNs, for storage. Each value is sealed with AES-256-GCM under a data key;
+// the data key is itself encrypted ("wrapped") by a master key held by a
+// KeyProvider (AWS KMS, or a local keyring in development) and stored
+// alongside the value. The database therefore never holds a key that opens
+// its own contents.
+//
+// A data key is reused for DataKeyTTL so sealing doesn't call the provider
+// every time, and unwrapped data keys are cached so opening doesn't either.
+//
+// Rotating the master key only changes which key wraps new data keys; older
+// values stay readable as long as the provider still holds their key. Stale
+// reports values sealed under an older master key so they can be resealed.
+//
+// Sealed values are randomized, so equal plaintexts never compare equal;
+// Index gives a keyed hash to look values up and enforce uniqueness with.
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyProvider generates and unwraps data keys under master keys it holds.
+type KeyProvider interface {
+	// KeyID names the master key new data keys are wrapped under.
+	KeyID() string
+	// GenerateDataKey returns a new 32-byte data key, in plaintext and
+	// wrapped under the current master key.
+	GenerateDataKey(ctx context.Context) (plain, wrapped []byte, err error)
+	// DecryptDataKey unwraps a data key wrapped under master key keyID.
+	DecryptDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// prefix marks a sealed value: enc1:<key id>:<wrapped data key>:<nonce and
+// ciphertext>, each part base64url.
+const prefix = "enc1:"
+
+var ErrMalformed = errors.New("envelope: malformed sealed value")
+
+// maxOpenedKeys bounds the cache of unwrapped data keys.
+const maxOpenedKeys = 4096
+
+type dataKey struct {
+	keyID   string
+	plain   []byte
+	wrapped []byte
+	expires time.Time
+}
+
+type Sealer struct {
+	Provider KeyProvider
+	// DataKeyTTL is how long one data key seals new values. Default 1h.
+	DataKeyTTL time.Duration
+
+	indexKey []byte
+
+	mu      sync.Mutex
+	current *dataKey
+	opened  map[string][]byte // wrapped data key -> plain
+}
+
+// New returns a Sealer over p. indexKey keys Index and should be 32 random
+// bytes kept apart from the master keys.
+func New(p KeyProvider, indexKey []byte) *Sealer {
+	return &Sealer{Provider: p, DataKeyTTL: time.Hour, indexKey: indexKey, opened: map[string][]byte{}}
+}
+
+// IsSealed reports whether s was produced by Seal.
+func IsSealed(s string) bool { return strings.HasPrefix(s, prefix) }
+
+// Seal encrypts plaintext under the current data key.
+func (s *Sealer) Seal(ctx context.Context, plaintext string) (string, error) {
+	dk, err := s.dataKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dk.plain)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	ct := aead.Seal(nonce, nonce, []byte(plaintext), []byte(dk.keyID))
+	enc := base64.RawURLEncoding
+	return prefix + enc.EncodeToString([]byte(dk.keyID)) + ":" + enc.EncodeToString(dk.wrapped) + ":" + enc.EncodeToString(ct), nil
+}
+
+// Open decrypts a value from Seal. Values that were never sealed (stored
+// before encryption was turned on) are returned as they are.
+func (s *Sealer) Open(ctx context.Context, sealed string) (string, error) {
+	if !IsSealed(sealed) {
+		return sealed, nil
+	}
+	keyID, wrapped, ct, err := parse(sealed)
+	if err != nil {
+		return "", err
+	}
+	plain, err := s.unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(plain)
+	if err != nil {
+		return "", err
+	}
+	if len(ct) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	pt, err := aead.Open(nil, ct[:aead.NonceSize()], ct[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("envelope: open: %w", err)
+	}
+	return string(pt), nil
+}
+
+// Stale reports whether sealed should be resealed: it was never sealed, or
+// its data key is wrapped under a master key other than the current one.
+func (s *Sealer) Stale(sealed string) bool {
+	if !IsSealed(sealed) {
+		return true
+	}
+	keyID, _, _, err := parse(sealed)
+	return err != nil || keyID != s.Provider.KeyID()
+}
+
+// Index returns a keyed hash of value for equality lookups. It is stable
+// across data and master key rotation; changing the index key means
+// recomputing every stored index.
+func (s *Sealer) Index(value string) string {
+	h := hmac.New(sha256.New, s.indexKey)
+	h.Write([]byte(value))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *Sealer) dataKey(ctx context.Context) (*dataKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keyID := s.Provider.KeyID()
+	if dk := s.current; dk != nil && dk.keyID == keyID && time.Now().Before(dk.expires) {
+		return dk, nil
+	}
+	plain, wrapped, err := s.Provider.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: generate data key: %w", err)
+	}
+	ttl := s.DataKeyTTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	s.current = &dataKey{keyID: keyID, plain: plain, wrapped: wrapped, expires: time.Now().Add(ttl)}
+	s.remember(wrapped, plain)
+	return s.current, nil
+}
+
+func (s *Sealer) unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	s.mu.Lock()
+	plain, ok := s.opened[string(wrapped)]
+	s.mu.Unlock()
+	if ok {
+		return plain, nil
+	}
+	plain, err := s.Provider.DecryptDataKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: decrypt data key: %w", err)
+	}
+	s.mu.Lock()
+	s.remember(wrapped, plain)
+	s.mu.Unlock()
+	return plain, nil
+}
+
+// remember caches an unwrapped data key; s.mu must be held.
+func (s *Sealer) remember(wrapped, plain []byte) {
+	if len(s.opened) >= maxOpenedKeys {
+		clear(s.opened)
+	}
+	s.opened[string(wrapped)] = plain
+}
+
+func parse(sealed string) (keyID string, wrapped, ct []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(sealed, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+	enc := base64.RawURLEncoding
+	id, err1 := enc.DecodeString(parts[0])
+	wrapped, err2 := enc.DecodeString(parts[1])
+	ct, err3 := enc.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return string(id), wrapped, ct, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
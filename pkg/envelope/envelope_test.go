@@ -0,0 +1,172 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	key1     = bytes.Repeat([]byte{1}, 32)
+	key2     = bytes.Repeat([]byte{2}, 32)
+	indexKey = bytes.Repeat([]byte{9}, 32)
+)
+
+func newSealer(t *testing.T, active string) *Sealer {
+	t.Helper()
+	p, err := NewLocal(active, map[string][]byte{"k1": key1, "k2": key2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(p, indexKey)
+}
+
+func TestSealOpen(t *testing.T) {
+	ctx := context.Background()
+	s := newSealer(t, "k1")
+	for _, pt := range []string{"0123456789", "", "22233344455", "Adébáyọ̀ Ọlálérè"} {
+		sealed, err := s.Seal(ctx, pt)
+		if err != nil {
+			t.Fatalf("Seal(%q): %v", pt, err)
+		}
+		if !IsSealed(sealed) || (pt != "" && strings.Contains(sealed, pt)) {
+			t.Fatalf("Seal(%q) = %q, want an opaque sealed value", pt, sealed)
+		}
+		// a fresh Sealer has no cached data keys and must unwrap through
+		// the provider
+		for _, opener := range []*Sealer{s, newSealer(t, "k1")} {
+			got, err := opener.Open(ctx, sealed)
+			if err != nil || got != pt {
+				t.Errorf("Open(Seal(%q)) = %q, %v", pt, got, err)
+			}
+		}
+	}
+
+	a, _ := s.Seal(ctx, "0123456789")
+	b, _ := s.Seal(ctx, "0123456789")
+	if a == b {
+		t.Error("sealing the same value twice gave the same output")
+	}
+}
+
+func TestOpenUnsealed(t *testing.T) {
+	s := newSealer(t, "k1")
+	got, err := s.Open(context.Background(), "0123456789")
+	if err != nil || got != "0123456789" {
+		t.Errorf("Open(plain) = %q, %v; want it back unchanged", got, err)
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	ctx := context.Background()
+	s := newSealer(t, "k1")
+	sealed, err := s.Seal(ctx, "0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(sealed, prefix), ":")
+	enc := base64.RawURLEncoding
+	flip := func(part string, i int) string {
+		b, _ := enc.DecodeString(part)
+		b[i%len(b)] ^= 0x01
+		return enc.EncodeToString(b)
+	}
+
+	tests := []struct {
+		name   string
+		sealed string
+	}{
+		{"ciphertext bit flipped", prefix + parts[0] + ":" + parts[1] + ":" + flip(parts[2], 20)},
+		{"nonce bit flipped", prefix + parts[0] + ":" + parts[1] + ":" + flip(parts[2], 0)},
+		{"tag truncated", prefix + parts[0] + ":" + parts[1] + ":" + parts[2][:len(parts[2])-4]},
+		{"wrapped key bit flipped", prefix + parts[0] + ":" + flip(parts[1], 20) + ":" + parts[2]},
+		{"relabelled master key", prefix + enc.EncodeToString([]byte("k2")) + ":" + parts[1] + ":" + parts[2]},
+		{"unknown master key", prefix + enc.EncodeToString([]byte("k3")) + ":" + parts[1] + ":" + parts[2]},
+		{"too short", prefix + parts[0] + ":" + parts[1] + ":" + enc.EncodeToString([]byte("short"))},
+		{"missing part", prefix + parts[0] + ":" + parts[2]},
+		{"bad base64", prefix + parts[0] + ":" + parts[1] + ":!!!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// through the cache, and through the provider
+			for _, opener := range []*Sealer{s, newSealer(t, "k1")} {
+				if got, err := opener.Open(ctx, tt.sealed); err == nil {
+					t.Fatalf("Open = %q, want an error", got)
+				}
+			}
+		})
+	}
+
+	if _, err := s.Open(ctx, prefix+"only-one-part"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Open(malformed) error = %v, want ErrMalformed", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	old := newSealer(t, "k1")
+	sealed, err := old.Seal(ctx, "0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Stale(sealed) {
+		t.Error("Stale under the key it was sealed with")
+	}
+
+	rotated := newSealer(t, "k2")
+	if !rotated.Stale(sealed) {
+		t.Error("not Stale after the master key rotated")
+	}
+	if got, err := rotated.Open(ctx, sealed); err != nil || got != "0123456789" {
+		t.Errorf("Open after rotation = %q, %v", got, err)
+	}
+	resealed, _ := rotated.Seal(ctx, "0123456789")
+	if rotated.Stale(resealed) {
+		t.Error("resealed value is Stale")
+	}
+	if !rotated.Stale("0123456789") {
+		t.Error("an unsealed value is not Stale")
+	}
+
+	// once the old key is retired its values can't be opened
+	p, _ := NewLocal("k2", map[string][]byte{"k2": key2})
+	if _, err := New(p, indexKey).Open(ctx, sealed); err == nil {
+		t.Error("opened a value whose master key was retired")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	s1, s2 := newSealer(t, "k1"), newSealer(t, "k2")
+	if s1.Index("0123456789") != s2.Index("0123456789") {
+		t.Error("Index changed with the master key")
+	}
+	if s1.Index("0123456789") == s1.Index("0123456780") {
+		t.Error("different values share an Index")
+	}
+	p, _ := NewLocal("k1", map[string][]byte{"k1": key1})
+	if New(p, bytes.Repeat([]byte{8}, 32)).Index("0123456789") == s1.Index("0123456789") {
+		t.Error("Index did not depend on the index key")
+	}
+}
+
+func TestNewLocal(t *testing.T) {
+	tests := []struct {
+		name   string
+		active string
+		keys   map[string][]byte
+		ok     bool
+	}{
+		{"valid", "k1", map[string][]byte{"k1": key1, "k2": key2}, true},
+		{"active missing", "k3", map[string][]byte{"k1": key1}, false},
+		{"short key", "k1", map[string][]byte{"k1": key1[:16]}, false},
+		{"short retired key", "k1", map[string][]byte{"k1": key1, "k2": key2[:31]}, false},
+	}
+	for _, tt := range tests {
+		if _, err := NewLocal(tt.active, tt.keys); (err == nil) != tt.ok {
+			t.Errorf("%s: NewLocal error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sudo-init-do/okies-backend/pkg/awsv4"
+)
+
+// KMS is a KeyProvider backed by an AWS KMS symmetric key: data keys come
+// from GenerateDataKey and are unwrapped with Decrypt, so master key
+// material never leaves KMS.
+//
+// Enabling automatic rotation on the KMS key needs nothing here; KMS keeps
+// the old backing keys. To move to a different KMS key, point KeyID at it:
+// new values use it, Decrypt still opens the old ones, and Stale finds them.
+type KMS struct {
+	// Key is the key ID, ARN or alias ("alias/okies-pii") data keys are
+	// generated under.
+	Key    string
+	Creds  awsv4.Credentials
+	Client *http.Client
+}
+
+// encryptionContext is bound to every data key; Decrypt fails without it,
+// and it shows up in CloudTrail.
+var encryptionContext = map[string]string{"purpose": "okies-envelope"}
+
+func (k *KMS) KeyID() string { return k.Key }
+
+func (k *KMS) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	var out struct {
+		CiphertextBlob []byte
+		Plaintext      []byte
+	}
+	err := k.call(ctx, "GenerateDataKey", map[string]any{
+		"KeyId":             k.Key,
+		"KeySpec":           "AES_256",
+		"EncryptionContext": encryptionContext,
+	}, &out)
+	return out.Plaintext, out.CiphertextBlob, err
+}
+
+// DecryptDataKey ignores keyID: the ciphertext blob names its KMS key.
+func (k *KMS) DecryptDataKey(ctx context.Context, _ string, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte
+	}
+	err := k.call(ctx, "Decrypt", map[string]any{
+		"CiphertextBlob":    wrapped,
+		"EncryptionContext": encryptionContext,
+	}, &out)
+	return out.Plaintext, err
+}
+
+// call invokes a KMS JSON API action. []byte fields travel as base64, which
+// is how encoding/json marshals them.
+func (k *KMS) call(ctx context.Context, action string, in, out any) error {
+	body, _ := json.Marshal(in)
+	url := "https://kms." + k.Creds.Region + ".amazonaws.com/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	awsv4.Sign(req, "kms", k.Creds, body, time.Now().UTC())
+
+	res, err := k.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("kms %s: status %d %s", action, res.StatusCode, msg)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
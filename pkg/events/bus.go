@@ -0,0 +1,172 @@
+// Package events is an in-process domain-event bus. Handlers publish facts
+// ("gift.created") after they commit; notification, analytics and fraud code
+// subscribe, so side effects don't have to be wired into every handler.
+//
+// Subscribe handlers run once, on the instance that published. Broadcast
+// handlers run on every instance: with Redis, events are fanned out over
+// pub/sub; without it, broadcast is the same as local delivery. Use
+// broadcast for per-instance state such as open client connections.
+//
+// Delivery is asynchronous and best-effort. Anything that must not be lost
+// belongs in a job (pkg/jobs) enqueued in the same transaction instead.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// All subscribes to every event name.
+const All = "*"
+
+const (
+	channel        = "okies:events"
+	handlerTimeout = 30 * time.Second
+)
+
+type Event struct {
+	Name   string          `json:"name"`
+	Data   json.RawMessage `json:"data"`
+	At     time.Time       `json:"at"`
+	Origin string          `json:"origin"` // publishing instance
+}
+
+// Decode unmarshals the event data into v.
+func (e Event) Decode(v any) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+type Handler func(ctx context.Context, e Event)
+
+type Bus struct {
+	rdb    *redis.Client
+	origin string
+
+	mu        sync.RWMutex
+	local     map[string][]Handler
+	broadcast map[string][]Handler
+
+	inflight sync.WaitGroup
+}
+
+// New returns a bus; rdb may be nil for a single instance.
+func New(rdb *redis.Client) *Bus {
+	host, _ := os.Hostname()
+	return &Bus{
+		rdb:       rdb,
+		origin:    fmt.Sprintf("%s:%d", host, os.Getpid()),
+		local:     map[string][]Handler{},
+		broadcast: map[string][]Handler{},
+	}
+}
+
+// Subscribe runs h for events named name (or All) published by this instance.
+func (b *Bus) Subscribe(name string, h Handler) {
+	b.mu.Lock()
+	b.local[name] = append(b.local[name], h)
+	b.mu.Unlock()
+}
+
+// SubscribeBroadcast runs h on this instance for events named name (or All)
+// published by any instance.
+func (b *Bus) SubscribeBroadcast(name string, h Handler) {
+	b.mu.Lock()
+	b.broadcast[name] = append(b.broadcast[name], h)
+	b.mu.Unlock()
+}
+
+// Publish delivers data, marshalled to JSON, under name. It never blocks on
+// subscribers and never fails the caller.
+func (b *Bus) Publish(ctx context.Context, name string, data any) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Error().Err(err).Str("event", name).Msg("marshal event failed")
+		return
+	}
+	e := Event{Name: name, Data: raw, At: time.Now().UTC(), Origin: b.origin}
+	b.dispatch(ctx, b.local, e)
+
+	if b.rdb == nil {
+		b.dispatch(ctx, b.broadcast, e)
+		return
+	}
+	msg, _ := json.Marshal(e)
+	if err := b.rdb.Publish(ctx, channel, msg).Err(); err != nil {
+		log.Error().Err(err).Str("event", name).Msg("fan out event failed")
+		// at least this instance's subscribers still hear about it
+		b.dispatch(ctx, b.broadcast, e)
+	}
+}
+
+// Run receives fanned-out events from Redis until ctx is cancelled. Without
+// Redis it returns immediately.
+func (b *Bus) Run(ctx context.Context) {
+	if b.rdb == nil {
+		return
+	}
+	sub := b.rdb.Subscribe(ctx, channel)
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-ch:
+			if !ok {
+				return
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(m.Payload), &e); err != nil {
+				log.Error().Err(err).Msg("bad event on bus channel")
+				continue
+			}
+			b.dispatch(ctx, b.broadcast, e)
+		}
+	}
+}
+
+func (b *Bus) dispatch(ctx context.Context, subs map[string][]Handler, e Event) {
+	b.mu.RLock()
+	hs := append(append([]Handler{}, subs[e.Name]...), subs[All]...)
+	b.mu.RUnlock()
+
+	// subscribers outlive the request that published
+	ctx = context.WithoutCancel(ctx)
+	for _, h := range hs {
+		b.inflight.Add(1)
+		go func(h Handler) {
+			defer b.inflight.Done()
+			defer func() {
+				if rec := recover(); rec != nil {
+					log.Error().Interface("panic", rec).Str("event", e.Name).Msg("event subscriber panicked")
+				}
+			}()
+			hctx, cancel := context.WithTimeout(ctx, handlerTimeout)
+			defer cancel()
+			h(hctx, e)
+		}(h)
+	}
+}
+
+// Drain waits for subscriber handlers already dispatched to return, or for
+// ctx to end. Call it on shutdown after the last Publish.
+func (b *Bus) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		b.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,511 @@
+// Package flwmock is a stand-in for the Flutterwave API, for local
+// development and CI. It serves the endpoints the API calls or may call
+// (transfers, balances, bank list, account resolve) and later delivers the
+// transfer webhook, signed with the configured hash, like the real service.
+//
+// Outcomes are decided per transfer. The account number picks a scripted
+// behaviour so tests need no setup:
+//
+//	9999xxxxxx  rejected with a 400 (invalid account)
+//	8888xxxxxx  a 500, as during a provider outage
+//	7777xxxxxx  accepted, then a FAILED webhook
+//	6666xxxxxx  accepted and left pending until completed by hand
+//
+// Any other account gets Options.Outcome. The control endpoints under
+// /_mock change the defaults at runtime, list transfers and complete
+// pending ones:
+//
+//	GET  /_mock/config
+//	PUT  /_mock/config                         {"outcome":"FAILED","webhookDelayMs":0}
+//	GET  /_mock/transfers
+//	POST /_mock/transfers/{reference}/complete {"status":"SUCCESSFUL"}
+//
+// To use it, run `go run ./apps/flwmock` and start the API with
+// FLW_BASE_URL=http://localhost:8090, any FLW_SEC_KEY, and FLW_WEBHOOK_HASH
+// equal to the mock's -webhook-hash.
+package flwmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Transfer outcomes, as Flutterwave reports them.
+const (
+	Successful = "SUCCESSFUL"
+	Failed     = "FAILED"
+	Pending    = "NEW"
+)
+
+type Options struct {
+	// Outcome for accounts without a scripted behaviour: Successful,
+	// Failed or Pending. Default Successful.
+	Outcome string
+	// ResponseDelay is added before every API response.
+	ResponseDelay time.Duration
+	// WebhookDelay is how long after a transfer its webhook is sent.
+	WebhookDelay time.Duration
+	// WebhookURL receives webhooks for transfers created without a
+	// callback_url.
+	WebhookURL string
+	// WebhookHash is sent as the verif-hash header.
+	WebhookHash string
+	// BalanceKobo is the opening NGN balance; successful transfers
+	// draw it down.
+	BalanceKobo int64
+	// SecretKey, when set, must be the bearer token on API calls.
+	SecretKey string
+}
+
+// Transfer is one transfer the mock has accepted.
+type Transfer struct {
+	ID            int64     `json:"id"`
+	AccountNumber string    `json:"account_number"`
+	BankCode      string    `json:"bank_code"`
+	FullName      string    `json:"full_name"`
+	Amount        float64   `json:"amount"`
+	Currency      string    `json:"currency"`
+	Narration     string    `json:"narration"`
+	Reference     string    `json:"reference"`
+	Status        string    `json:"status"`
+	CompleteMsg   string    `json:"complete_message"`
+	CallbackURL   string    `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+	// WebhookAttempts counts deliveries tried; WebhookStatus is the last
+	// HTTP status the receiver answered with (0 when unreachable).
+	WebhookAttempts int `json:"webhook_attempts"`
+	WebhookStatus   int `json:"webhook_status"`
+}
+
+type Server struct {
+	client *http.Client
+
+	mu        sync.Mutex
+	opts      Options
+	nextID    int64
+	balance   int64
+	transfers map[string]*Transfer
+}
+
+func New(o Options) *Server {
+	if o.Outcome == "" {
+		o.Outcome = Successful
+	}
+	return &Server{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		opts:      o,
+		nextID:    1000,
+		balance:   o.BalanceKobo,
+		transfers: map[string]*Transfer{},
+	}
+}
+
+// Handler returns the mock's routes.
+func (s *Server) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Group(func(api chi.Router) {
+		api.Use(s.delay, s.auth)
+		api.Post("/v3/transfers", s.createTransfer)
+		api.Get("/v3/transfers/{id}", s.getTransfer)
+		api.Get("/v3/balances/{currency}", s.getBalance)
+		api.Get("/v3/banks/{country}", s.listBanks)
+		api.Post("/v3/accounts/resolve", s.resolveAccount)
+	})
+	r.Get("/_mock/config", s.getConfig)
+	r.Put("/_mock/config", s.setConfig)
+	r.Get("/_mock/transfers", s.listTransfers)
+	r.Post("/_mock/transfers/{reference}/complete", s.completeTransfer)
+	return r
+}
+
+func (s *Server) delay(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		d := s.opts.ResponseDelay
+		s.mu.Unlock()
+		if d > 0 {
+			select {
+			case <-time.After(d):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || (s.opts.SecretKey != "" && token != s.opts.SecretKey) {
+			fail(w, http.StatusUnauthorized, "Invalid authorization key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func ok(w http.ResponseWriter, msg string, data any) {
+	writeJSON(w, http.StatusOK, map[string]any{"status": "success", "message": msg, "data": data})
+}
+
+func fail(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]any{"status": "error", "message": msg, "data": nil})
+}
+
+// POST /v3/transfers
+func (s *Server) createTransfer(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		AccountBank   string  `json:"account_bank"`
+		AccountNumber string  `json:"account_number"`
+		Amount        float64 `json:"amount"`
+		Currency      string  `json:"currency"`
+		Narration     string  `json:"narration"`
+		Reference     string  `json:"reference"`
+		CallbackURL   string  `json:"callback_url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		fail(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if body.AccountBank == "" || body.AccountNumber == "" || body.Amount <= 0 || body.Reference == "" {
+		fail(w, http.StatusBadRequest, "account_bank, account_number, amount and reference are required")
+		return
+	}
+	switch {
+	case strings.HasPrefix(body.AccountNumber, "9999"):
+		fail(w, http.StatusBadRequest, "Sorry, that account number is invalid, please check and try again")
+		return
+	case strings.HasPrefix(body.AccountNumber, "8888"):
+		fail(w, http.StatusInternalServerError, "Transfer could not be initiated")
+		return
+	}
+
+	s.mu.Lock()
+	if t, dup := s.transfers[body.Reference]; dup {
+		// the reference is the idempotency key: a retry gets the original
+		snapshot := *t
+		s.mu.Unlock()
+		ok(w, "Transfer Queued Successfully", snapshot)
+		return
+	}
+	outcome := s.opts.Outcome
+	switch {
+	case strings.HasPrefix(body.AccountNumber, "7777"):
+		outcome = Failed
+	case strings.HasPrefix(body.AccountNumber, "6666"):
+		outcome = Pending
+	}
+	kobo := int64(math.Round(body.Amount * 100))
+	if outcome == Successful && kobo > s.balance {
+		s.mu.Unlock()
+		fail(w, http.StatusBadRequest, "Insufficient balance")
+		return
+	}
+	s.nextID++
+	if body.Currency == "" {
+		body.Currency = "NGN"
+	}
+	t := &Transfer{
+		ID:            s.nextID,
+		AccountNumber: body.AccountNumber,
+		BankCode:      body.AccountBank,
+		FullName:      accountName(body.AccountNumber),
+		Amount:        body.Amount,
+		Currency:      body.Currency,
+		Narration:     body.Narration,
+		Reference:     body.Reference,
+		Status:        Pending,
+		CallbackURL:   body.CallbackURL,
+		CreatedAt:     time.Now().UTC(),
+	}
+	s.transfers[t.Reference] = t
+	delay := s.opts.WebhookDelay
+	snapshot := *t
+	s.mu.Unlock()
+
+	log.Info().Str("reference", t.Reference).Str("outcome", outcome).Msg("flwmock: transfer queued")
+	if outcome != Pending {
+		time.AfterFunc(delay, func() { s.complete(t.Reference, outcome) })
+	}
+	ok(w, "Transfer Queued Successfully", snapshot)
+}
+
+// GET /v3/transfers/{id}
+func (s *Server) getTransfer(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.transfers {
+		if t.ID == id {
+			ok(w, "Transfer fetched", t)
+			return
+		}
+	}
+	fail(w, http.StatusNotFound, "No transfer found")
+}
+
+// GET /v3/balances/{currency}
+func (s *Server) getBalance(w http.ResponseWriter, r *http.Request) {
+	currency := strings.ToUpper(chi.URLParam(r, "currency"))
+	var bal int64
+	s.mu.Lock()
+	if currency == "NGN" {
+		bal = s.balance
+	}
+	s.mu.Unlock()
+	major := float64(bal) / 100
+	ok(w, "Wallet balance fetched", map[string]any{
+		"currency":          currency,
+		"available_balance": major,
+		"ledger_balance":    major,
+	})
+}
+
+var banks = []map[string]any{
+	{"id": 1, "code": "044", "name": "Access Bank"},
+	{"id": 2, "code": "023", "name": "Citibank Nigeria"},
+	{"id": 3, "code": "050", "name": "Ecobank Nigeria"},
+	{"id": 4, "code": "070", "name": "Fidelity Bank"},
+	{"id": 5, "code": "011", "name": "First Bank of Nigeria"},
+	{"id": 6, "code": "214", "name": "First City Monument Bank"},
+	{"id": 7, "code": "058", "name": "Guaranty Trust Bank"},
+	{"id": 8, "code": "030", "name": "Heritage Bank"},
+	{"id": 9, "code": "082", "name": "Keystone Bank"},
+	{"id": 10, "code": "090267", "name": "Kuda Microfinance Bank"},
+	{"id": 11, "code": "100004", "name": "OPay"},
+	{"id": 12, "code": "100033", "name": "PalmPay"},
+	{"id": 13, "code": "076", "name": "Polaris Bank"},
+	{"id": 14, "code": "221", "name": "Stanbic IBTC Bank"},
+	{"id": 15, "code": "232", "name": "Sterling Bank"},
+	{"id": 16, "code": "032", "name": "Union Bank of Nigeria"},
+	{"id": 17, "code": "033", "name": "United Bank For Africa"},
+	{"id": 18, "code": "215", "name": "Unity Bank"},
+	{"id": 19, "code": "035", "name": "Wema Bank"},
+	{"id": 20, "code": "057", "name": "Zenith Bank"},
+}
+
+// GET /v3/banks/{country}
+func (s *Server) listBanks(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(chi.URLParam(r, "country"), "NG") {
+		ok(w, "Banks fetched successfully", []any{})
+		return
+	}
+	ok(w, "Banks fetched successfully", banks)
+}
+
+// POST /v3/accounts/resolve
+func (s *Server) resolveAccount(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		AccountNumber string `json:"account_number"`
+		AccountBank   string `json:"account_bank"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.AccountNumber == "" || body.AccountBank == "" {
+		fail(w, http.StatusBadRequest, "account_number and account_bank are required")
+		return
+	}
+	if len(body.AccountNumber) != 10 || strings.HasPrefix(body.AccountNumber, "9999") {
+		fail(w, http.StatusBadRequest, "Sorry, that account number is invalid, please check and try again")
+		return
+	}
+	ok(w, "Account details fetched", map[string]any{
+		"account_number": body.AccountNumber,
+		"account_name":   accountName(body.AccountNumber),
+	})
+}
+
+// accountName makes up a stable holder name for an account number.
+func accountName(number string) string {
+	first := []string{"ADA", "BAYO", "CHIDI", "DAYO", "EMEKA", "FUNKE", "GOZIE", "HALIMA", "IFEOMA", "JIDE"}
+	last := []string{"OBI", "ADEYEMI", "NWOSU", "BELLO", "EZE", "OKAFOR", "MUSA", "IBRAHIM", "OLADIPO", "UMEH"}
+	sum := 0
+	for _, c := range number {
+		sum = sum*31 + int(c)
+	}
+	if sum < 0 {
+		sum = -sum
+	}
+	return first[sum%len(first)] + " " + last[(sum/len(first))%len(last)]
+}
+
+// complete settles a transfer and delivers its webhook.
+func (s *Server) complete(reference, status string) bool {
+	s.mu.Lock()
+	t, found := s.transfers[reference]
+	if !found || t.Status != Pending {
+		s.mu.Unlock()
+		return false
+	}
+	t.Status = status
+	if status == Successful {
+		t.CompleteMsg = "Transaction was successful"
+		s.balance -= int64(math.Round(t.Amount * 100))
+	} else {
+		t.CompleteMsg = "DISBURSE FAILED: Beneficiary account is not valid"
+	}
+	url := t.CallbackURL
+	if url == "" {
+		url = s.opts.WebhookURL
+	}
+	hash := s.opts.WebhookHash
+	payload, _ := json.Marshal(map[string]any{
+		"event":     "transfer.completed",
+		"timestamp": time.Now().UnixMilli(),
+		"data": map[string]any{
+			"id":               t.ID,
+			"account_number":   t.AccountNumber,
+			"bank_name":        bankName(t.BankCode),
+			"bank_code":        t.BankCode,
+			"fullname":         t.FullName,
+			"created_at":       t.CreatedAt,
+			"currency":         t.Currency,
+			"debit_currency":   t.Currency,
+			"amount":           t.Amount,
+			"fee":              10.75,
+			"status":           t.Status,
+			"reference":        t.Reference,
+			"narration":        t.Narration,
+			"complete_message": t.CompleteMsg,
+		},
+	})
+	s.mu.Unlock()
+
+	go s.deliver(reference, url, hash, payload)
+	return true
+}
+
+func bankName(code string) string {
+	for _, b := range banks {
+		if b["code"] == code {
+			return b["name"].(string)
+		}
+	}
+	return "Unknown Bank"
+}
+
+// deliver posts a webhook, retrying a few times like Flutterwave does when
+// the receiver doesn't answer 200.
+func (s *Server) deliver(reference, url, hash string, payload []byte) {
+	if url == "" {
+		log.Warn().Str("reference", reference).Msg("flwmock: no webhook URL; webhook not sent")
+		return
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		status := 0
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("verif-hash", hash)
+			var res *http.Response
+			if res, err = s.client.Do(req); err == nil {
+				status = res.StatusCode
+				res.Body.Close()
+			}
+		}
+		s.mu.Lock()
+		if t, found := s.transfers[reference]; found {
+			t.WebhookAttempts, t.WebhookStatus = attempt, status
+		}
+		s.mu.Unlock()
+		if status == http.StatusOK {
+			log.Info().Str("reference", reference).Msg("flwmock: webhook delivered")
+			return
+		}
+		log.Warn().Err(err).Int("status", status).Int("attempt", attempt).Str("reference", reference).Msg("flwmock: webhook delivery failed")
+		time.Sleep(time.Duration(attempt) * 5 * time.Second)
+	}
+}
+
+// ---------- Control ----------
+
+type controlConfig struct {
+	Outcome         string `json:"outcome"`
+	ResponseDelayMS int64  `json:"responseDelayMs"`
+	WebhookDelayMS  int64  `json:"webhookDelayMs"`
+	WebhookURL      string `json:"webhookUrl"`
+	BalanceKobo     int64  `json:"balanceKobo"`
+}
+
+func (s *Server) currentConfig() controlConfig {
+	return controlConfig{
+		Outcome:         s.opts.Outcome,
+		ResponseDelayMS: s.opts.ResponseDelay.Milliseconds(),
+		WebhookDelayMS:  s.opts.WebhookDelay.Milliseconds(),
+		WebhookURL:      s.opts.WebhookURL,
+		BalanceKobo:     s.balance,
+	}
+}
+
+// GET /_mock/config
+func (s *Server) getConfig(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, s.currentConfig())
+}
+
+// PUT /_mock/config; omitted fields keep their value
+func (s *Server) setConfig(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.currentConfig()
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		fail(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	switch c.Outcome {
+	case Successful, Failed, Pending:
+	default:
+		fail(w, http.StatusBadRequest, "outcome must be SUCCESSFUL, FAILED or NEW")
+		return
+	}
+	s.opts.Outcome = c.Outcome
+	s.opts.ResponseDelay = time.Duration(c.ResponseDelayMS) * time.Millisecond
+	s.opts.WebhookDelay = time.Duration(c.WebhookDelayMS) * time.Millisecond
+	s.opts.WebhookURL = c.WebhookURL
+	s.balance = c.BalanceKobo
+	writeJSON(w, http.StatusOK, s.currentConfig())
+}
+
+// GET /_mock/transfers, newest first
+func (s *Server) listTransfers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	out := make([]Transfer, 0, len(s.transfers))
+	for _, t := range s.transfers {
+		out = append(out, *t)
+	}
+	s.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	writeJSON(w, http.StatusOK, out)
+}
+
+// POST /_mock/transfers/{reference}/complete  {"status":"SUCCESSFUL"|"FAILED"}
+func (s *Server) completeTransfer(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.Status != Successful && body.Status != Failed) {
+		fail(w, http.StatusBadRequest, "status must be SUCCESSFUL or FAILED")
+		return
+	}
+	if !s.complete(chi.URLParam(r, "reference"), body.Status) {
+		fail(w, http.StatusNotFound, "No pending transfer with that reference")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"status": "success"})
+}
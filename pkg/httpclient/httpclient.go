@@ -0,0 +1,234 @@
+// Package httpclient builds the *http.Client every external integration
+// uses: bounded timeouts, a connection pool per integration, retries with
+// jitter for requests that are safe to repeat, and a log line per attempt
+// with credentials redacted.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+type Options struct {
+	// Timeout bounds the whole call, retries included. Default 10s.
+	Timeout time.Duration
+	// Retries is how many times an idempotent request is repeated after a
+	// network error or a 429/502/503/504. Zero disables retries.
+	Retries int
+	// MaxConnsPerHost caps concurrent connections to one host. Default 32.
+	MaxConnsPerHost int
+	// Faults, when set, wraps the network transport below retries and
+	// logging, so injected failures are retried and logged like real ones;
+	// see pkg/chaos.
+	Faults func(http.RoundTripper) http.RoundTripper
+	// PublicOnly refuses connections to loopback, private and link-local
+	// addresses. Set it when the URL comes from a third party, so it can't
+	// be pointed at internal services. It is checked on the resolved
+	// address, so DNS tricks don't get around it.
+	PublicOnly bool
+}
+
+const (
+	retryBase = 200 * time.Millisecond
+	retryCap  = 2 * time.Second
+	// a Retry-After longer than this is not worth waiting for inline; the
+	// caller's own retry (usually a job) takes over
+	maxRetryAfter = 5 * time.Second
+)
+
+// New returns a client for the integration called name. Each client has its
+// own transport, so one slow provider cannot exhaust another's connections.
+func New(name string, o Options) *http.Client {
+	if o.Timeout == 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.MaxConnsPerHost == 0 {
+		o.MaxConnsPerHost = 32
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}
+	if o.PublicOnly {
+		dialer.Control = refusePrivate
+		t.Proxy = nil
+	}
+	t.DialContext = dialer.DialContext
+	t.TLSHandshakeTimeout = 5 * time.Second
+	t.ResponseHeaderTimeout = o.Timeout
+	t.MaxConnsPerHost = o.MaxConnsPerHost
+	t.MaxIdleConnsPerHost = o.MaxConnsPerHost
+	t.IdleConnTimeout = 90 * time.Second
+	var next http.RoundTripper = t
+	if o.Faults != nil {
+		next = o.Faults(next)
+	}
+
+	return &http.Client{
+		Timeout: o.Timeout,
+		Transport: &transport{
+			name:    name,
+			retries: o.Retries,
+			next:    otelhttp.NewTransport(next),
+		},
+	}
+}
+
+// ErrPrivateAddress is returned when a PublicOnly client is asked to
+// connect to a non-public address.
+var ErrPrivateAddress = errors.New("httpclient: refusing to connect to a non-public address")
+
+func refusePrivate(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+type transport struct {
+	name    string
+	retries int
+	next    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retry := t.retries > 0 && idempotent(req)
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		res, err := t.next.RoundTrip(req)
+		t.log(req, res, err, attempt, time.Since(start))
+
+		if !retry || attempt > t.retries || !retryable(req.Context(), res, err) {
+			return res, err
+		}
+		wait := backoff(attempt)
+		if res != nil {
+			if ra, ok := retryAfter(res); ok {
+				if ra > maxRetryAfter {
+					return res, err
+				}
+				wait = ra
+			}
+		}
+		if req.Body != nil && req.GetBody != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return res, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		if res != nil {
+			io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+			res.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// idempotent reports whether req can be sent twice without doing the work
+// twice: safe methods, PUT and DELETE, or anything carrying an
+// Idempotency-Key header.
+func idempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false // body can't be replayed
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func retryable(ctx context.Context, res *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff is full jitter: a random wait up to an exponentially growing cap.
+func backoff(attempt int) time.Duration {
+	d := retryBase << (attempt - 1)
+	if d > retryCap || d <= 0 {
+		d = retryCap
+	}
+	return rand.N(d) + time.Millisecond
+}
+
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+// log writes one line per attempt. Request bodies are never logged (they
+// carry message content and account numbers); the start of an error
+// response body is, redacted, since that is usually what explains it.
+func (t *transport) log(req *http.Request, res *http.Response, err error, attempt int, d time.Duration) {
+	ev := log.Debug()
+	if err != nil || res.StatusCode >= 400 {
+		ev = log.Warn()
+	}
+	if !ev.Enabled() {
+		return
+	}
+	ev = ev.Str("integration", t.name).
+		Str("method", req.Method).
+		Str("url", RedactURL(req.URL)).
+		Interface("request_headers", RedactHeaders(req.Header)).
+		Int("attempt", attempt).
+		Dur("duration", d)
+	if err != nil {
+		ev.Err(err).Msg("outbound request failed")
+		return
+	}
+	ev = ev.Int("status", res.StatusCode)
+	if res.StatusCode >= 400 {
+		head, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), res.Body), res.Body}
+		ev = ev.Str("response_body", RedactBody(head))
+	}
+	ev.Msg("outbound request")
+}
@@ -0,0 +1,52 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/sudo-init-do/okies-backend/pkg/redact"
+)
+
+const redacted = redact.Mask
+
+// isSecret reports whether a header, query or JSON field name is a
+// credential; see pkg/redact.
+func isSecret(name string) bool { return redact.IsSecret(name) }
+
+// RedactHeaders returns a copy of h with credential values replaced.
+func RedactHeaders(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, v := range h {
+		if isSecret(k) {
+			out[k] = []string{redacted}
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// RedactURL returns u as a string with user info and credential query
+// parameters replaced.
+func RedactURL(u *url.URL) string {
+	c := *u
+	if c.User != nil {
+		c.User = url.User(redacted)
+	}
+	if c.RawQuery != "" {
+		q := c.Query()
+		for k := range q {
+			if isSecret(k) {
+				q.Set(k, redacted)
+			}
+		}
+		c.RawQuery = q.Encode()
+	}
+	return c.String()
+}
+
+// RedactBody masks credential and personal-data fields in a JSON body, and
+// scrubs the rest; the body may be truncated.
+func RedactBody(b []byte) string {
+	return string(redact.Line(b))
+}
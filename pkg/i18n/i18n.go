@@ -0,0 +1,117 @@
+// Package i18n holds translations of user-facing text: API error messages
+// and notification templates, in Nigerian Pidgin, Yoruba, Hausa and Igbo.
+//
+// English stays with the code that owns it (pkg/apierror's catalogue,
+// pkg/push's templates) and is the fallback for anything not translated
+// here. Catalogues cover what end users see; admin-only error codes are
+// English in every language.
+//
+// The language of an API response is negotiated from Accept-Language, then
+// the user's saved preference, and echoed in the Content-Language header,
+// which pkg/apierror reads when writing an error.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	English = "en"
+	Pidgin  = "pcm"
+	Yoruba  = "yo"
+	Hausa   = "ha"
+	Igbo    = "ig"
+)
+
+// Languages lists the supported language tags.
+var Languages = []string{English, Pidgin, Yoruba, Hausa, Igbo}
+
+// Header is the response header naming the language a response is in.
+const Header = "Content-Language"
+
+// Template is a notification's title and body as text/template sources.
+type Template struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type catalogue struct {
+	Errors        map[string]string   `json:"errors"`
+	Notifications map[string]Template `json:"notifications"`
+}
+
+//go:embed locales/*.json
+var files embed.FS
+
+var catalogues = map[string]catalogue{}
+
+func init() {
+	for _, lang := range Languages[1:] {
+		raw, err := files.ReadFile("locales/" + lang + ".json")
+		if err != nil {
+			panic("i18n: missing catalogue for " + lang)
+		}
+		var c catalogue
+		if err := json.Unmarshal(raw, &c); err != nil {
+			panic("i18n: bad catalogue for " + lang + ": " + err.Error())
+		}
+		catalogues[lang] = c
+	}
+}
+
+// Supported reports whether lang is one of Languages.
+func Supported(lang string) bool {
+	for _, l := range Languages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate picks the best supported language from an Accept-Language
+// header, matching on the primary subtag (en-NG is en). It returns "" when
+// nothing acceptable is supported.
+func Negotiate(header string) string {
+	type choice struct {
+		lang string
+		q    float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if q > 0 && Supported(primary) {
+			choices = append(choices, choice{primary, q})
+		}
+	}
+	if len(choices) == 0 {
+		return ""
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	return choices[0].lang
+}
+
+// ErrorMessage returns the translation of the error message for code.
+func ErrorMessage(lang, code string) (string, bool) {
+	m, ok := catalogues[lang].Errors[code]
+	return m, ok
+}
+
+// Notifications returns the translated notification templates for lang,
+// keyed by notification kind.
+func Notifications(lang string) map[string]Template {
+	return catalogues[lang].Notifications
+}
@@ -0,0 +1,21 @@
+package i18n
+
+import "fmt"
+
+// How amounts are shown to a user: "₦1500.00" or "NGN 1500.00".
+const (
+	CurrencySymbol = "symbol"
+	CurrencyCode   = "code"
+)
+
+// CurrencyDisplays lists the supported currency display styles.
+var CurrencyDisplays = []string{CurrencySymbol, CurrencyCode}
+
+// Money renders kobo as naira with two decimals in the given display style,
+// the symbol for anything unrecognised.
+func Money(kobo int64, display string) string {
+	if display == CurrencyCode {
+		return fmt.Sprintf("NGN %d.%02d", kobo/100, kobo%100)
+	}
+	return fmt.Sprintf("₦%d.%02d", kobo/100, kobo%100)
+}
@@ -0,0 +1,144 @@
+package idtoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testKid      = "key-1"
+	testIssuer   = "https://accounts.google.com"
+	testAudience = "okies-android"
+)
+
+func newKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// jwksServer publishes pub as the provider's only key.
+func jwksServer(t *testing.T, pub *rsa.PublicKey) *httptest.Server {
+	t.Helper()
+	b64 := base64.RawURLEncoding.EncodeToString
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "EC", "kid": "ignored"},
+			{"kty": "RSA", "kid": testKid, "n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())},
+		}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testProvider(srv *httptest.Server) *Provider {
+	return &Provider{
+		Name:      "test",
+		Issuers:   []string{testIssuer},
+		KeysURL:   srv.URL,
+		Audiences: []string{testAudience},
+		Client:    srv.Client(),
+	}
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            testIssuer,
+		"aud":            testAudience,
+		"sub":            "1234567890",
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, claims)
+	tok.Header["kid"] = kid
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	key, other := newKey(t), newKey(t)
+	p := testProvider(jwksServer(t, &key.PublicKey))
+	pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	with := func(k string, v any) jwt.MapClaims {
+		c := validClaims()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  Claims
+		err   error
+	}{
+		{"valid", sign(t, jwt.SigningMethodRS256, key, testKid, validClaims()),
+			Claims{Subject: "1234567890", Email: "ada@example.com", EmailVerified: true}, nil},
+		{"apple's string email_verified", sign(t, jwt.SigningMethodRS256, key, testKid, with("email_verified", "true")),
+			Claims{Subject: "1234567890", Email: "ada@example.com", EmailVerified: true}, nil},
+		{"one of several audiences", sign(t, jwt.SigningMethodRS256, key, testKid, with("aud", []string{"someone-else", testAudience})),
+			Claims{Subject: "1234567890", Email: "ada@example.com", EmailVerified: true}, nil},
+		{"other audience", sign(t, jwt.SigningMethodRS256, key, testKid, with("aud", "someone-else")), Claims{}, ErrInvalid},
+		{"no audience", sign(t, jwt.SigningMethodRS256, key, testKid, with("aud", nil)), Claims{}, ErrInvalid},
+		{"other issuer", sign(t, jwt.SigningMethodRS256, key, testKid, with("iss", "https://evil.example")), Claims{}, ErrInvalid},
+		{"expired", sign(t, jwt.SigningMethodRS256, key, testKid, with("exp", time.Now().Add(-2*time.Minute).Unix())), Claims{}, ErrInvalid},
+		{"no expiry", sign(t, jwt.SigningMethodRS256, key, testKid, with("exp", nil)), Claims{}, ErrInvalid},
+		{"no subject", sign(t, jwt.SigningMethodRS256, key, testKid, with("sub", nil)), Claims{}, ErrInvalid},
+		{"signed by another key", sign(t, jwt.SigningMethodRS256, other, testKid, validClaims()), Claims{}, ErrInvalid},
+		// the public key used as an HMAC secret must not verify
+		{"alg confusion", sign(t, jwt.SigningMethodHS256, pubDER, testKid, validClaims()), Claims{}, ErrInvalid},
+		{"alg none", sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, testKid, validClaims()), Claims{}, ErrInvalid},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, key, "key-2", validClaims()), Claims{}, ErrInvalid},
+		{"garbage", "not.a.token", Claims{}, ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Verify(context.Background(), tt.token)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Verify = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyKeysUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	key := newKey(t)
+	_, err := testProvider(srv).Verify(context.Background(), sign(t, jwt.SigningMethodRS256, key, testKid, validClaims()))
+	if err == nil || errors.Is(err, ErrInvalid) {
+		t.Fatalf("Verify error = %v, want a key fetch error", err)
+	}
+}
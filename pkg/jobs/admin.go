@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Stat is the number of jobs of one kind in one status.
+type Stat struct {
+	Kind   string `json:"kind"`
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+	// Oldest is the earliest run_at among the jobs, for spotting a stalled
+	// queue.
+	Oldest time.Time `json:"oldest"`
+}
+
+// Stats counts jobs by kind and status.
+func Stats(ctx context.Context, db *pgxpool.Pool) ([]Stat, error) {
+	rows, err := db.Query(ctx, `
+		SELECT kind, status, COUNT(*), MIN(run_at)
+		FROM jobs GROUP BY kind, status ORDER BY kind, status
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Stat{}
+	for rows.Next() {
+		var s Stat
+		if err := rows.Scan(&s.Kind, &s.Status, &s.Count, &s.Oldest); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// Retry puts a dead job back on the queue with a fresh attempt budget.
+// It reports false when id is not a dead job.
+func Retry(ctx context.Context, db Execer, id string) (bool, error) {
+	tag, err := db.Exec(ctx, `
+		UPDATE jobs SET status='pending', attempts=0, run_at=now(), finished_at=NULL
+		WHERE id=$1 AND status='dead'
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
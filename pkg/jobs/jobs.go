@@ -0,0 +1,125 @@
+// Package jobs is a small Postgres-backed job queue. Jobs are rows in the
+// jobs table; workers claim them with FOR UPDATE SKIP LOCKED, so any number
+// of worker processes can share one queue without coordination.
+//
+// Enqueue takes any Execer, so a job can be enqueued inside the transaction
+// that makes it necessary and is only visible once that transaction commits.
+//
+// A failed job is retried with backoff until it has used max_attempts, then
+// it is dead-lettered (status 'dead') for an operator to inspect and retry.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const DefaultMaxAttempts = 10
+
+// Execer is satisfied by *pgxpool.Pool, *pgx.Conn and pgx.Tx.
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Options tune a single Enqueue. The zero value runs the job as soon as a
+// worker is free, with DefaultMaxAttempts.
+type Options struct {
+	RunAt       time.Time
+	MaxAttempts int
+	// UniqueKey makes Enqueue a no-op while any job with the same key exists,
+	// whatever its status.
+	UniqueKey string
+}
+
+// Enqueue adds a job of kind with payload marshalled to JSON.
+func Enqueue(ctx context.Context, db Execer, kind string, payload any, opts Options) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("jobs: marshal %s payload: %w", kind, err)
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	var runAt *time.Time
+	if !opts.RunAt.IsZero() {
+		runAt = &opts.RunAt
+	}
+	_, err = db.Exec(ctx, `
+		INSERT INTO jobs (kind, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2::jsonb, $3, COALESCE($4, now()), NULLIF($5, ''))
+		ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING
+	`, kind, string(raw), opts.MaxAttempts, runAt, opts.UniqueKey)
+	return err
+}
+
+// Job is a claimed job as seen by a handler.
+type Job struct {
+	ID          string
+	Kind        string
+	Payload     json.RawMessage
+	Attempt     int // 1 on the first run
+	MaxAttempts int
+}
+
+type kindKey struct{}
+
+// KindFromContext returns the kind of the job whose handler ctx was passed
+// to, or "" outside a job.
+func KindFromContext(ctx context.Context) string {
+	kind, _ := ctx.Value(kindKey{}).(string)
+	return kind
+}
+
+// Decode unmarshals the payload into v.
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// HandlerFunc processes one job. Returning an error schedules a retry;
+// wrap it with Permanent to dead-letter the job straight away.
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+type deferredError struct {
+	err   error
+	after time.Duration
+}
+
+func (e deferredError) Error() string { return e.err.Error() }
+func (e deferredError) Unwrap() error { return e.err }
+
+// RetryAfter reschedules the job after d without using up an attempt, for
+// when the handler knows it cannot make progress yet (a dependency is
+// known to be down).
+func RetryAfter(d time.Duration, err error) error {
+	return deferredError{err: err, after: d}
+}
+
+// backoff is the delay before retrying after the given attempt: 10s, 40s,
+// 90s, ... capped at an hour.
+func backoff(attempt int) time.Duration {
+	d := time.Duration(attempt*attempt) * 10 * time.Second
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
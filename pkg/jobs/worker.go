@@ -0,0 +1,259 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Worker claims and runs jobs for the kinds registered on it.
+type Worker struct {
+	db       *pgxpool.Pool
+	id       string
+	handlers map[string]HandlerFunc
+
+	Concurrency  int
+	PollInterval time.Duration
+	// Lease is how long a job may run before it is presumed lost (the
+	// worker crashed) and handed to another worker.
+	Lease time.Duration
+	// KeepSucceeded is how long finished jobs are kept before pruning.
+	KeepSucceeded time.Duration
+	// DrainTimeout is how long Run waits, once ctx is cancelled, for running
+	// jobs to finish. Jobs still running after that are cancelled and put
+	// back in the queue without using up an attempt.
+	DrainTimeout time.Duration
+	// OnDead, if set, is called after a job is dead-lettered.
+	OnDead func(ctx context.Context, job *Job, err error)
+}
+
+func NewWorker(db *pgxpool.Pool, concurrency int) *Worker {
+	host, _ := os.Hostname()
+	return &Worker{
+		db:            db,
+		id:            fmt.Sprintf("%s:%d", host, os.Getpid()),
+		handlers:      map[string]HandlerFunc{},
+		Concurrency:   concurrency,
+		PollInterval:  time.Second,
+		Lease:         10 * time.Minute,
+		KeepSucceeded: 7 * 24 * time.Hour,
+		DrainTimeout:  30 * time.Second,
+	}
+}
+
+// Handle registers fn for kind. It must be called before Run.
+func (w *Worker) Handle(kind string, fn HandlerFunc) {
+	w.handlers[kind] = fn
+}
+
+// Run works the queue until ctx is cancelled, then stops claiming and waits
+// up to DrainTimeout for running jobs to finish.
+func (w *Worker) Run(ctx context.Context) {
+	kinds := make([]string, 0, len(w.handlers))
+	for k := range w.handlers {
+		kinds = append(kinds, k)
+	}
+	log.Info().Str("worker", w.id).Strs("kinds", kinds).Int("concurrency", w.Concurrency).Msg("job worker started")
+
+	// hard is cancelled when draining runs out of time
+	hard, abort := context.WithCancel(context.WithoutCancel(ctx))
+	defer abort()
+	go func() {
+		select {
+		case <-hard.Done():
+			return
+		case <-ctx.Done():
+		}
+		log.Info().Str("worker", w.id).Dur("timeout", w.DrainTimeout).Msg("job worker draining")
+		t := time.NewTimer(w.DrainTimeout)
+		defer t.Stop()
+		select {
+		case <-hard.Done():
+		case <-t.C:
+			log.Warn().Str("worker", w.id).Msg("drain timed out; interrupting running jobs")
+			abort()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx, hard, kinds)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.maintain(ctx)
+	}()
+	wg.Wait()
+	log.Info().Str("worker", w.id).Msg("job worker stopped")
+}
+
+func (w *Worker) loop(ctx, hard context.Context, kinds []string) {
+	for ctx.Err() == nil {
+		job, err := w.claim(ctx, kinds)
+		if err != nil || job == nil {
+			if err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msg("claim job failed")
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.PollInterval):
+			}
+			continue
+		}
+		// let the job finish (and be recorded) even while shutting down
+		w.process(context.WithoutCancel(ctx), hard, job)
+	}
+}
+
+func (w *Worker) claim(ctx context.Context, kinds []string) (*Job, error) {
+	var j Job
+	err := w.db.QueryRow(ctx, `
+		UPDATE jobs SET status='running', attempts=attempts+1, locked_at=now(), locked_by=$1
+		WHERE id = (
+		  SELECT id FROM jobs
+		  WHERE status='pending' AND run_at <= now() AND kind = ANY($2)
+		  ORDER BY run_at
+		  LIMIT 1
+		  FOR UPDATE SKIP LOCKED)
+		RETURNING id, kind, payload, attempts, max_attempts
+	`, w.id, kinds).Scan(&j.ID, &j.Kind, &j.Payload, &j.Attempt, &j.MaxAttempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// process runs j and records the outcome. Cancelling hard interrupts the
+// handler; the job is then released rather than failed.
+func (w *Worker) process(ctx, hard context.Context, j *Job) {
+	ctx, span := otel.Tracer("okies/jobs").Start(ctx, "job "+j.Kind, trace.WithAttributes(
+		attribute.String("job.id", j.ID),
+		attribute.String("job.kind", j.Kind),
+		attribute.Int("job.attempt", j.Attempt),
+	))
+	defer span.End()
+
+	l := log.With().Str("job_id", j.ID).Str("kind", j.Kind).Int("attempt", j.Attempt).Logger()
+	start := time.Now()
+	// give up before the lease expires and another worker takes the job
+	rctx, cancel := context.WithTimeout(ctx, w.Lease-time.Minute)
+	stop := context.AfterFunc(hard, cancel)
+	err := w.run(rctx, j)
+	stop()
+	cancel()
+
+	var deferred deferredError
+	switch {
+	case err != nil && hard.Err() != nil:
+		if _, e := w.db.Exec(ctx, `
+			UPDATE jobs SET status='pending', attempts=attempts-1, run_at=now(), locked_at=NULL, locked_by=NULL, last_error=$2
+			WHERE id=$1`, j.ID, "interrupted by shutdown: "+err.Error()); e != nil {
+			l.Error().Err(e).Msg("release job failed")
+		}
+		l.Warn().Err(err).Msg("job interrupted by shutdown; released")
+	case err == nil:
+		_, err = w.db.Exec(ctx, `
+			UPDATE jobs SET status='succeeded', finished_at=now(), locked_at=NULL, locked_by=NULL, last_error=NULL
+			WHERE id=$1`, j.ID)
+		if err != nil {
+			l.Error().Err(err).Msg("record job success failed")
+		}
+		l.Debug().Dur("duration", time.Since(start)).Msg("job succeeded")
+		return
+	case errors.As(err, &deferred):
+		retryAt := time.Now().Add(deferred.after)
+		if _, e := w.db.Exec(ctx, `
+			UPDATE jobs SET status='pending', attempts=attempts-1, run_at=$2, locked_at=NULL, locked_by=NULL, last_error=$3
+			WHERE id=$1`, j.ID, retryAt, err.Error()); e != nil {
+			l.Error().Err(e).Msg("defer job failed")
+		}
+		l.Info().Err(err).Time("retry_at", retryAt).Msg("job deferred")
+	case isPermanent(err) || j.Attempt >= j.MaxAttempts:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if _, e := w.db.Exec(ctx, `
+			UPDATE jobs SET status='dead', finished_at=now(), locked_at=NULL, locked_by=NULL, last_error=$2
+			WHERE id=$1`, j.ID, err.Error()); e != nil {
+			l.Error().Err(e).Msg("dead-letter job failed")
+		}
+		l.Error().Err(err).Msg("job dead-lettered")
+		if w.OnDead != nil {
+			w.OnDead(ctx, j, err)
+		}
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		retryAt := time.Now().Add(backoff(j.Attempt))
+		if _, e := w.db.Exec(ctx, `
+			UPDATE jobs SET status='pending', run_at=$2, locked_at=NULL, locked_by=NULL, last_error=$3
+			WHERE id=$1`, j.ID, retryAt, err.Error()); e != nil {
+			l.Error().Err(e).Msg("reschedule job failed")
+		}
+		l.Warn().Err(err).Time("retry_at", retryAt).Msg("job failed; will retry")
+	}
+}
+
+// run calls the handler, turning a panic into a retryable error.
+func (w *Worker) run(ctx context.Context, j *Job) (err error) {
+	fn, ok := w.handlers[j.Kind]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for %q", j.Kind))
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return fn(context.WithValue(ctx, kindKey{}, j.Kind), j)
+}
+
+// maintain periodically requeues jobs whose worker died mid-run and prunes
+// old successes.
+func (w *Worker) maintain(ctx context.Context) {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		tag, err := w.db.Exec(ctx, `
+			UPDATE jobs SET
+			  status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+			  finished_at = CASE WHEN attempts >= max_attempts THEN now() END,
+			  last_error = 'lease expired on ' || locked_by,
+			  locked_at = NULL, locked_by = NULL
+			WHERE status='running' AND locked_at < now() - make_interval(secs => $1)
+		`, w.Lease.Seconds())
+		if err != nil {
+			log.Error().Err(err).Msg("reclaim expired jobs failed")
+		} else if n := tag.RowsAffected(); n > 0 {
+			log.Warn().Int64("jobs", n).Msg("reclaimed jobs with expired leases")
+		}
+		if _, err := w.db.Exec(ctx, `
+			DELETE FROM jobs WHERE status='succeeded' AND finished_at < now() - make_interval(secs => $1)
+		`, w.KeepSucceeded.Seconds()); err != nil {
+			log.Error().Err(err).Msg("prune succeeded jobs failed")
+		}
+	}
+}
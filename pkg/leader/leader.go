@@ -0,0 +1,144 @@
+// Package leader picks one process among the replicas to run work that must
+// not run twice, such as periodic sweeps. Leadership is a Postgres session
+// advisory lock held on a dedicated pool connection: it is released when the
+// leader stops, or by the server when the leader's connection dies, and
+// another replica takes over on its next attempt.
+//
+// A leader that loses its connection only notices on its next check, so for
+// up to CheckInterval two processes may both believe they lead. Work run
+// under leadership should stay idempotent; election only keeps replicas from
+// routinely doing it side by side.
+package leader
+
+import (
+	"context"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+type Elector struct {
+	Name string
+	// RetryInterval is how often a follower tries to take the lock.
+	RetryInterval time.Duration
+	// CheckInterval is how often the leader checks its connection still
+	// holds the lock.
+	CheckInterval time.Duration
+	// OnChange, if set, is called when this process gains or loses
+	// leadership.
+	OnChange func(leading bool)
+
+	pool    *pgxpool.Pool
+	key     int64
+	leading atomic.Bool
+}
+
+// New returns an elector for name. Processes using the same name compete
+// for the same leadership.
+func New(pool *pgxpool.Pool, name string) *Elector {
+	h := fnv.New64a()
+	h.Write([]byte("leader:" + name))
+	return &Elector{
+		Name:          name,
+		RetryInterval: 15 * time.Second,
+		CheckInterval: 5 * time.Second,
+		pool:          pool,
+		key:           int64(h.Sum64()),
+	}
+}
+
+// Leading reports whether this process currently holds leadership.
+func (e *Elector) Leading() bool { return e.leading.Load() }
+
+// Run campaigns until ctx is cancelled. Each time this process wins it calls
+// lead with a context that is cancelled when leadership is lost or ctx ends,
+// and waits for lead to return before releasing the lock.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	for {
+		conn, err := e.acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Ctx(ctx).Warn().Err(err).Str("election", e.Name).Msg("leader election attempt failed")
+		}
+		if conn != nil {
+			e.hold(ctx, conn, lead)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.RetryInterval):
+		}
+	}
+}
+
+// acquire returns a connection holding the lock, or nil when another
+// process has it.
+func (e *Elector) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	conn, err := e.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var won bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, e.key).Scan(&won); err != nil || !won {
+		conn.Release()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// hold runs lead while conn keeps the lock, then unlocks and releases it.
+func (e *Elector) hold(ctx context.Context, conn *pgxpool.Conn, lead func(ctx context.Context)) {
+	lctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	e.setLeading(ctx, true)
+	go func() {
+		defer close(done)
+		lead(lctx)
+	}()
+
+	t := time.NewTicker(e.CheckInterval)
+	defer t.Stop()
+	lost := false
+watch:
+	for {
+		select {
+		case <-done:
+			break watch
+		case <-ctx.Done():
+			break watch
+		case <-t.C:
+			if err := conn.Ping(lctx); err != nil && ctx.Err() == nil {
+				log.Ctx(ctx).Error().Err(err).Str("election", e.Name).Msg("leader lost its lock connection")
+				lost = true
+				break watch
+			}
+		}
+	}
+	cancel()
+	<-done
+	e.setLeading(ctx, false)
+
+	if lost {
+		// the server dropped the session, and the lock with it
+		conn.Conn().Close(context.Background())
+		conn.Release()
+		return
+	}
+	uctx, ucancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ucancel()
+	if _, err := conn.Exec(uctx, `SELECT pg_advisory_unlock($1)`, e.key); err != nil {
+		// closing the session releases the lock too
+		conn.Conn().Close(uctx)
+	}
+	conn.Release()
+}
+
+func (e *Elector) setLeading(ctx context.Context, leading bool) {
+	e.leading.Store(leading)
+	log.Ctx(ctx).Info().Str("election", e.Name).Bool("leading", leading).Msg("leadership changed")
+	if e.OnChange != nil {
+		e.OnChange(leading)
+	}
+}
@@ -0,0 +1,37 @@
+// Package mailer sends transactional email through SMTP, SendGrid or Amazon
+// SES. Messages are rendered from embedded HTML templates so copy and layout
+// live in one place.
+package mailer
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrRejected means the provider refused the message itself (bad address,
+// suppressed recipient). Retrying will not help.
+var ErrRejected = errors.New("mailer: message rejected")
+
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Driver delivers one message from the given sender address.
+type Driver interface {
+	Send(ctx context.Context, from string, m Message) error
+}
+
+// Mailer pairs a driver with the From address.
+type Mailer struct {
+	From   string
+	Driver Driver
+}
+
+func New(from string, d Driver) *Mailer { return &Mailer{From: from, Driver: d} }
+
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	return m.Driver.Send(ctx, m.From, msg)
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SendGrid sends through the v3 Mail Send API.
+type SendGrid struct {
+	APIKey string
+	Client *http.Client
+}
+
+func (s *SendGrid) Send(ctx context.Context, from string, m Message) error {
+	body, _ := json.Marshal(map[string]any{
+		"personalizations": []map[string]any{{"to": []map[string]string{{"email": m.To}}}},
+		"from":             map[string]string{"email": from},
+		"subject":          m.Subject,
+		"content": []map[string]string{
+			{"type": "text/plain", "value": m.Text},
+			{"type": "text/html", "value": m.HTML},
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.sendgrid.com/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	if res.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%w: sendgrid: %s", ErrRejected, msg)
+	}
+	return fmt.Errorf("mailer: sendgrid: status %d %s", res.StatusCode, msg)
+}
@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sudo-init-do/okies-backend/pkg/awsv4"
+)
+
+// SES sends through the Amazon SES v2 API, signing requests with AWS
+// Signature Version 4.
+type SES struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Client          *http.Client
+}
+
+func (s *SES) Send(ctx context.Context, from string, m Message) error {
+	body, _ := json.Marshal(map[string]any{
+		"FromEmailAddress": from,
+		"Destination":      map[string]any{"ToAddresses": []string{m.To}},
+		"Content": map[string]any{"Simple": map[string]any{
+			"Subject": map[string]string{"Data": m.Subject, "Charset": "UTF-8"},
+			"Body": map[string]any{
+				"Text": map[string]string{"Data": m.Text, "Charset": "UTF-8"},
+				"Html": map[string]string{"Data": m.HTML, "Charset": "UTF-8"},
+			},
+		}},
+	})
+	host := "email." + s.Region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	awsv4.Sign(req, "ses", awsv4.Credentials{Region: s.Region, AccessKeyID: s.AccessKeyID, SecretAccessKey: s.SecretAccessKey}, body, time.Now().UTC())
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	if res.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%w: ses: %s", ErrRejected, msg)
+	}
+	return fmt.Errorf("mailer: ses: status %d %s", res.StatusCode, msg)
+}
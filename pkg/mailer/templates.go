@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/sudo-init-do/okies-backend/pkg/i18n"
+)
+
+//go:embed templates/*.html
+var files embed.FS
+
+// Categories group templates for user preferences. Security and account
+// mail is always sent.
+const (
+	CategorySecurity     = "security"
+	CategoryAccount      = "account"
+	CategoryTransactions = "transactions"
+	CategoryStatements   = "statements"
+)
+
+var categories = map[string]string{
+	"welcome":            CategoryAccount,
+	"password_reset":     CategorySecurity,
+	"security_code":      CategorySecurity,
+	"account_status":     CategorySecurity,
+	"receipt":            CategoryTransactions,
+	"withdrawal_settled": CategoryTransactions,
+	"statement_ready":    CategoryStatements,
+}
+
+// Category returns the preference category of a template, or "" if the
+// template does not exist.
+func Category(name string) string { return categories[name] }
+
+// Optional reports whether users may opt out of a category.
+func Optional(category string) bool {
+	return category == CategoryTransactions || category == CategoryStatements
+}
+
+func funcs(currency string) map[string]any {
+	return map[string]any{
+		// naira renders kobo as naira with two decimals, in the
+		// recipient's currency display
+		"naira": func(kobo any) string {
+			var k int64
+			switch v := kobo.(type) {
+			case int64:
+				k = v
+			case int:
+				k = int64(v)
+			case float64: // from JSON
+				k = int64(v)
+			}
+			return i18n.Money(k, currency)
+		},
+		"date":     func(v any) string { return formatTime(v, "2 Jan 2006") },
+		"datetime": func(v any) string { return formatTime(v, "2 Jan 2006, 3:04 PM") },
+	}
+}
+
+// formatTime formats v in its own offset, which callers set to the
+// recipient's time zone.
+func formatTime(v any, layout string) string {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(layout)
+	case string: // from JSON
+		if p, err := time.Parse(time.RFC3339, t); err == nil {
+			return p.Format(layout)
+		}
+		return t
+	}
+	return ""
+}
+
+// Each template file is parsed twice: as HTML for the "content" block in
+// the layout, and as plain text for the unescaped "subject" and "text".
+type tmpl struct {
+	html *template.Template
+	text *texttemplate.Template
+}
+
+// templates are keyed by currency display, then name. html/template can't
+// rebind functions once executed, so each display gets its own parse.
+var templates = map[string]map[string]tmpl{}
+
+func init() {
+	for _, currency := range i18n.CurrencyDisplays {
+		fn := funcs(currency)
+		templates[currency] = map[string]tmpl{}
+		for name := range categories {
+			templates[currency][name] = tmpl{
+				html: template.Must(template.New("layout.html").Funcs(fn).
+					ParseFS(files, "templates/layout.html", "templates/"+name+".html")),
+				text: texttemplate.Must(texttemplate.New(name).Funcs(fn).
+					ParseFS(files, "templates/"+name+".html")),
+			}
+		}
+	}
+}
+
+// Render builds the message for the named template with amounts in the
+// currency display (see i18n.Money). Each template defines "subject",
+// "content" (HTML, wrapped in the layout) and "text".
+func Render(name, to, currency string, data map[string]any) (Message, error) {
+	set, ok := templates[currency]
+	if !ok {
+		set = templates[i18n.CurrencySymbol]
+	}
+	t, ok := set[name]
+	if !ok {
+		return Message{}, fmt.Errorf("mailer: unknown template %q", name)
+	}
+	var subject, html, text bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.html.ExecuteTemplate(&html, "layout.html", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
@@ -0,0 +1,176 @@
+// Package moderation screens the names people choose for themselves:
+// usernames and display names. A built-in denylist refuses profanity and
+// names that pass for Okies staff outright; names that only look doubtful,
+// or that an optional external moderation API flags, are let through for a
+// person to review.
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+type Action string
+
+const (
+	Allow  Action = "allow"
+	Review Action = "review" // accept, but queue for a moderator
+	Block  Action = "block"  // refuse
+)
+
+// Verdict is the outcome for one name. Reason says which rule decided it.
+type Verdict struct {
+	Action Action
+	Reason string
+}
+
+// Reasons.
+const (
+	ReasonProfanity     = "profanity"
+	ReasonImpersonation = "impersonation"
+	ReasonSuspected     = "profanity_suspected" // a denylisted word inside another
+	ReasonAPI           = "api"
+)
+
+// profanity are refused as whole words and reviewed inside longer ones,
+// where they may be innocent ("Scunthorpe").
+var profanity = []string{
+	"arse", "asshole", "bastard", "bitch", "bollocks", "cunt", "dick", "fuck",
+	"motherfucker", "nigga", "nigger", "prick", "pussy", "shit", "slut", "twat",
+	"wanker", "whore",
+	// Nigerian
+	"ashawo", "mumu", "olodo", "oloshi", "ode", "werey",
+}
+
+// wholeWordOnly are profanity that are also parts of common names
+// (Dickson, Mumuni), so they are never looked for inside other words.
+var wholeWordOnly = map[string]bool{"arse": true, "dick": true, "mumu": true, "ode": true, "prick": true}
+
+// impersonation can't appear anywhere, ignoring spaces and punctuation, so
+// "Okies Support" and "okies.care" are both refused. Keep in step with the
+// username rules in apps/api/usernames.go.
+var impersonation = []string{
+	"okies", "admin", "support", "official", "verified", "customercare",
+	"customerservice", "helpdesk", "moderator",
+}
+
+// leet undoes common letter substitutions before matching.
+var leet = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b",
+	"@", "a", "$", "s", "!", "i", "|", "l",
+)
+
+// words returns name lowercased with substitutions undone, split into
+// words on anything that isn't a letter.
+func words(name string) []string {
+	s := leet.Replace(strings.ToLower(name))
+	return strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+}
+
+// Denylist checks name against the built-in lists only.
+func Denylist(name string) Verdict {
+	ws := words(name)
+	joined := strings.Join(ws, "")
+	for _, w := range ws {
+		for _, p := range profanity {
+			if w == p {
+				return Verdict{Block, ReasonProfanity}
+			}
+		}
+	}
+	for _, p := range impersonation {
+		if strings.Contains(joined, p) {
+			return Verdict{Block, ReasonImpersonation}
+		}
+	}
+	for _, p := range profanity {
+		// short words turn up inside too many real names to be worth a look
+		if len(p) >= 4 && !wholeWordOnly[p] && strings.Contains(joined, p) {
+			return Verdict{Review, ReasonSuspected}
+		}
+	}
+	return Verdict{Allow, ""}
+}
+
+// Checker applies the denylist, then the external API when there is one.
+type Checker struct {
+	api *API
+}
+
+// New returns a Checker; api may be nil.
+func New(api *API) *Checker {
+	return &Checker{api: api}
+}
+
+// Check screens name. When the API fails the denylist verdict stands and
+// the error is returned alongside it for logging; names are never refused
+// because the API is down. A nil Checker uses the denylist alone.
+func (c *Checker) Check(ctx context.Context, name string) (Verdict, error) {
+	v := Denylist(name)
+	if v.Action != Allow || c == nil || c.api == nil {
+		return v, nil
+	}
+	res, err := c.api.Classify(ctx, name)
+	if err != nil {
+		return v, err
+	}
+	if res.Flagged {
+		reason := ReasonAPI
+		if len(res.Categories) > 0 {
+			reason += ":" + strings.Join(res.Categories, ",")
+		}
+		return Verdict{Review, reason}, nil
+	}
+	return v, nil
+}
+
+// API is an external text moderation service. It is sent
+//
+//	POST {URL}  Authorization: Bearer {Key}
+//	{"text":"..."}
+//
+// and answers {"flagged":true,"categories":["harassment"]}.
+type API struct {
+	URL    string
+	Key    string
+	Client *http.Client
+}
+
+// Result is the API's answer.
+type Result struct {
+	Flagged    bool     `json:"flagged"`
+	Categories []string `json:"categories"`
+}
+
+func (a *API) Classify(ctx context.Context, text string) (Result, error) {
+	payload, _ := json.Marshal(map[string]string{"text": text})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(payload))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if a.Key != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Key)
+	}
+	res, err := a.Client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("moderation: %w", err)
+	}
+	defer res.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode/100 != 2 {
+		return Result{}, fmt.Errorf("moderation: status %d %s", res.StatusCode, raw)
+	}
+	var out Result
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return Result{}, fmt.Errorf("moderation: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,128 @@
+// Package objectstore keeps uploaded files (avatars) in an S3 bucket. Every
+// request, the server's own included, goes through a pre-signed URL, so
+// clients can upload directly without the API relaying the bytes.
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sudo-init-do/okies-backend/pkg/awsv4"
+)
+
+var (
+	ErrNotFound = errors.New("objectstore: object not found")
+	ErrTooLarge = errors.New("objectstore: object too large")
+)
+
+// S3 is a bucket in Amazon S3 or an S3-compatible store.
+type S3 struct {
+	Bucket string
+	// Endpoint, when set, addresses the bucket path-style under it (for
+	// MinIO and the like); otherwise the bucket's AWS virtual host is used.
+	Endpoint string
+	// PublicURL is where stored objects are read from by clients, usually a
+	// CDN in front of the bucket; URL falls back to the bucket itself.
+	PublicURL   string
+	Credentials awsv4.Credentials
+	Client      *http.Client
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	var u *url.URL
+	if s.Endpoint != "" {
+		u, _ = url.Parse(strings.TrimRight(s.Endpoint, "/") + "/" + s.Bucket)
+	} else {
+		u = &url.URL{Scheme: "https", Host: s.Bucket + ".s3." + s.Credentials.Region + ".amazonaws.com"}
+	}
+	u.Path += "/" + key
+	return u
+}
+
+// URL is where clients read key.
+func (s *S3) URL(key string) string {
+	if s.PublicURL != "" {
+		return strings.TrimRight(s.PublicURL, "/") + "/" + key
+	}
+	return s.objectURL(key).String()
+}
+
+// PresignPut returns a URL a client can PUT key to until expires, sending
+// contentType as its Content-Type.
+func (s *S3) PresignPut(key, contentType string, expires time.Duration) string {
+	h := http.Header{"Content-Type": {contentType}}
+	return awsv4.Presign(http.MethodPut, s.objectURL(key), "s3", s.Credentials, h, expires, time.Now())
+}
+
+func (s *S3) do(ctx context.Context, method, key string, h http.Header, body []byte) (*http.Response, error) {
+	signed := awsv4.Presign(method, s.objectURL(key), "s3", s.Credentials, h, time.Minute, time.Now())
+	req, err := http.NewRequestWithContext(ctx, method, signed, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode/100 != 2 {
+		raw, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+		res.Body.Close()
+		return nil, fmt.Errorf("objectstore: %s %s: status %d %s", method, key, res.StatusCode, raw)
+	}
+	return res, nil
+}
+
+// Get reads key, failing with ErrTooLarge past max bytes.
+func (s *S3) Get(ctx context.Context, key string, max int64) ([]byte, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.ContentLength > max {
+		return nil, ErrTooLarge
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > max {
+		return nil, ErrTooLarge
+	}
+	return b, nil
+}
+
+// Put stores body at key.
+func (s *S3) Put(ctx context.Context, key, contentType string, body []byte) error {
+	res, err := s.do(ctx, http.MethodPut, key, http.Header{"Content-Type": {contentType}}, body)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Delete removes key; a missing key is not an error.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
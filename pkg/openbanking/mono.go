@@ -0,0 +1,205 @@
+package openbanking
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Mono talks to the Mono API. Accounts are linked with Mono Connect, whose
+// widget hands the app a code for Link; mandates are approved on the page
+// at Mandate.AuthorizeURL. Webhooks carry WebhookSecret in the
+// mono-webhook-secret header.
+type Mono struct {
+	BaseURL       string // e.g. https://api.withmono.com
+	SecretKey     string
+	WebhookSecret string
+	Client        *http.Client
+}
+
+func (m *Mono) Name() string { return "mono" }
+
+// call sends body (if any) as JSON and decodes the response's data field
+// into out (if any).
+func (m *Mono) call(ctx context.Context, method, path string, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		payload, _ := json.Marshal(body)
+		rd = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.BaseURL+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("mono-sec-key", m.SecretKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := m.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode/100 != 2 {
+		switch res.StatusCode {
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity:
+			return fmt.Errorf("%w: mono: %s", ErrRejected, raw)
+		}
+		return fmt.Errorf("openbanking: mono: status %d %s", res.StatusCode, raw)
+	}
+	if out == nil {
+		return nil
+	}
+	var env struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return err
+	}
+	return json.Unmarshal(env.Data, out)
+}
+
+func (m *Mono) Link(ctx context.Context, code string) (Account, error) {
+	var auth struct {
+		ID string `json:"id"`
+	}
+	if err := m.call(ctx, http.MethodPost, "/v2/accounts/auth", map[string]string{"code": code}, &auth); err != nil {
+		return Account{}, err
+	}
+	var out struct {
+		Account struct {
+			Name          string `json:"name"`
+			AccountNumber string `json:"account_number"`
+			Currency      string `json:"currency"`
+			Balance       int64  `json:"balance"`
+			Institution   struct {
+				Name     string `json:"name"`
+				BankCode string `json:"bank_code"`
+			} `json:"institution"`
+		} `json:"account"`
+	}
+	if err := m.call(ctx, http.MethodGet, "/v2/accounts/"+url.PathEscape(auth.ID), nil, &out); err != nil {
+		return Account{}, err
+	}
+	a := out.Account
+	return Account{
+		ID:            auth.ID,
+		Institution:   a.Institution.Name,
+		BankCode:      a.Institution.BankCode,
+		AccountName:   a.Name,
+		AccountNumber: a.AccountNumber,
+		Currency:      a.Currency,
+		Balance:       a.Balance,
+	}, nil
+}
+
+func (m *Mono) Balance(ctx context.Context, accountID string) (int64, error) {
+	var out struct {
+		Balance int64 `json:"balance"`
+	}
+	err := m.call(ctx, http.MethodGet, "/v2/accounts/"+url.PathEscape(accountID)+"/balance", nil, &out)
+	return out.Balance, err
+}
+
+func (m *Mono) Unlink(ctx context.Context, accountID string) error {
+	return m.call(ctx, http.MethodPost, "/v2/accounts/"+url.PathEscape(accountID)+"/unlink", nil, nil)
+}
+
+func (m *Mono) CreateMandate(ctx context.Context, r MandateRequest) (Mandate, error) {
+	body := map[string]any{
+		"amount":       r.MaxAmount,
+		"type":         "recurring-debit",
+		"method":       "mandate",
+		"mandate_type": "emandate",
+		"debit_type":   "variable",
+		"account":      r.AccountID,
+		"description":  r.Description,
+		"reference":    r.Reference,
+		"customer":     map[string]string{"name": r.CustomerName, "email": r.CustomerEmail},
+		"start_date":   r.Start.Format("2006-01-02"),
+		"end_date":     r.End.Format("2006-01-02"),
+	}
+	if r.RedirectURL != "" {
+		body["redirect_url"] = r.RedirectURL
+	}
+	var out struct {
+		ID      string `json:"id"`
+		MonoURL string `json:"mono_url"`
+	}
+	if err := m.call(ctx, http.MethodPost, "/v2/payments/initiate", body, &out); err != nil {
+		return Mandate{}, err
+	}
+	return Mandate{ID: out.ID, AuthorizeURL: out.MonoURL}, nil
+}
+
+func (m *Mono) CancelMandate(ctx context.Context, mandateID string) error {
+	return m.call(ctx, http.MethodPatch, "/v3/payments/mandates/"+url.PathEscape(mandateID)+"/cancel", nil, nil)
+}
+
+func (m *Mono) Debit(ctx context.Context, mandateID string, amount int64, reference, narration string) (string, error) {
+	var out struct {
+		Status string `json:"status"`
+	}
+	err := m.call(ctx, http.MethodPost, "/v3/payments/mandates/"+url.PathEscape(mandateID)+"/debit",
+		map[string]any{"amount": amount, "reference": reference, "narration": narration}, &out)
+	if err != nil {
+		return "", err
+	}
+	return monoDebitStatus(out.Status), nil
+}
+
+func monoDebitStatus(s string) string {
+	switch strings.ToLower(s) {
+	case "successful", "success":
+		return DebitSucceeded
+	case "failed":
+		return DebitFailed
+	}
+	return DebitProcessing
+}
+
+func (m *Mono) ParseWebhook(body []byte, header http.Header) (Event, error) {
+	if m.WebhookSecret == "" || !hmac.Equal([]byte(header.Get("mono-webhook-secret")), []byte(m.WebhookSecret)) {
+		return Event{}, ErrBadSignature
+	}
+	var w struct {
+		Event string `json:"event"`
+		Data  struct {
+			ID              string `json:"id"`
+			Mandate         string `json:"mandate"`
+			Reference       string `json:"reference"`
+			ReferenceNumber string `json:"reference_number"`
+			Message         string `json:"message"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &w); err != nil {
+		return Event{}, err
+	}
+	d := w.Data
+	e := Event{MandateID: d.ID, Reference: d.Reference}
+	switch w.Event {
+	case "events.mandates.approved", "events.mandates.ready":
+		e.Type = EventMandateActive
+	case "events.mandates.cancelled":
+		e.Type = EventMandateCancelled
+	case "events.mandates.rejected":
+		e.Type, e.Error = EventMandateFailed, d.Message
+	case "events.mandates.debit.successful", "events.mandates.debit.failed":
+		e.Type, e.MandateID = EventDebitSucceeded, d.Mandate
+		if e.Reference == "" {
+			e.Reference = d.ReferenceNumber
+		}
+		if w.Event == "events.mandates.debit.failed" {
+			e.Type, e.Error = EventDebitFailed, d.Message
+		}
+	}
+	return e, nil
+}
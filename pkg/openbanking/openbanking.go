@@ -0,0 +1,102 @@
+// Package openbanking links users' bank accounts through an open-banking
+// provider (Mono) to read their balance and pull money from them by direct
+// debit under a mandate the user approves at their bank.
+package openbanking
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrRejected means the provider refused the request itself (expired link
+// code, mandate not active, insufficient funds). Retrying will not help.
+var ErrRejected = errors.New("openbanking: request rejected")
+
+// ErrBadSignature means a webhook failed verification.
+var ErrBadSignature = errors.New("openbanking: bad webhook signature")
+
+// Mandate states. A mandate is pending until the user approves it at their
+// bank; only active mandates can be debited.
+const (
+	MandatePending   = "pending"
+	MandateActive    = "active"
+	MandateCancelled = "cancelled"
+	MandateFailed    = "failed"
+)
+
+// Debit states. Processing debits are settled by a webhook.
+const (
+	DebitProcessing = "processing"
+	DebitSucceeded  = "succeeded"
+	DebitFailed     = "failed"
+)
+
+// Webhook event types, normalised across providers.
+const (
+	EventMandateActive    = "mandate.active"
+	EventMandateCancelled = "mandate.cancelled"
+	EventMandateFailed    = "mandate.failed"
+	EventDebitSucceeded   = "debit.succeeded"
+	EventDebitFailed      = "debit.failed"
+)
+
+// Account is a linked bank account. Balance is in kobo.
+type Account struct {
+	ID            string // the provider's account id
+	Institution   string
+	BankCode      string
+	AccountName   string
+	AccountNumber string
+	Currency      string
+	Balance       int64
+}
+
+// MandateRequest asks the user to authorise debits of up to MaxAmount kobo
+// each from an account until End.
+type MandateRequest struct {
+	AccountID     string
+	Reference     string // ours; echoed back in webhooks
+	MaxAmount     int64
+	Description   string
+	CustomerName  string
+	CustomerEmail string
+	RedirectURL   string // where the user returns after authorising; optional
+	Start, End    time.Time
+}
+
+// Mandate is what the provider returns for a new mandate. The user opens
+// AuthorizeURL to approve it; ID may be empty until they do.
+type Mandate struct {
+	ID           string
+	AuthorizeURL string
+}
+
+// Event is a parsed webhook. Reference is ours: the mandate's for mandate
+// events, the debit's for debit events.
+type Event struct {
+	Type      string
+	MandateID string
+	Reference string
+	Error     string
+}
+
+// Provider is an open-banking API.
+type Provider interface {
+	Name() string
+	// Link exchanges the code the provider's widget returns for the account
+	// the user connected.
+	Link(ctx context.Context, code string) (Account, error)
+	// Balance returns the account's available balance in kobo.
+	Balance(ctx context.Context, accountID string) (int64, error)
+	Unlink(ctx context.Context, accountID string) error
+	CreateMandate(ctx context.Context, m MandateRequest) (Mandate, error)
+	CancelMandate(ctx context.Context, mandateID string) error
+	// Debit pulls amount kobo under an active mandate and returns the debit
+	// status. reference is the provider's idempotency key.
+	Debit(ctx context.Context, mandateID string, amount int64, reference, narration string) (string, error)
+	// ParseWebhook verifies and parses a webhook. Events the package does
+	// not model come back with an empty Type.
+	ParseWebhook(body []byte, header http.Header) (Event, error)
+}
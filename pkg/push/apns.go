@@ -0,0 +1,102 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// APNs sends through Apple's HTTP/2 provider API with token-based (.p8 key)
+// authentication.
+type APNs struct {
+	host   string
+	keyID  string
+	teamID string
+	topic  string // the app's bundle ID
+	key    *ecdsa.PrivateKey
+	client *http.Client
+
+	mu     sync.Mutex
+	bearer string
+	issued time.Time
+}
+
+// NewAPNs parses a .p8 signing key. production selects the live gateway
+// instead of the sandbox.
+func NewAPNs(p8 []byte, keyID, teamID, topic string, production bool, client *http.Client) (*APNs, error) {
+	key, err := jwt.ParseECPrivateKeyFromPEM(p8)
+	if err != nil {
+		return nil, fmt.Errorf("apns: key: %w", err)
+	}
+	host := "https://api.sandbox.push.apple.com"
+	if production {
+		host = "https://api.push.apple.com"
+	}
+	return &APNs{host: host, keyID: keyID, teamID: teamID, topic: topic, key: key, client: client}, nil
+}
+
+// token returns the provider JWT. Apple rejects tokens older than an hour
+// and throttles ones refreshed more often than every 20 minutes.
+func (a *APNs) token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.bearer != "" && time.Since(a.issued) < 40*time.Minute {
+		return a.bearer, nil
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": a.teamID, "iat": time.Now().Unix()})
+	t.Header["kid"] = a.keyID
+	s, err := t.SignedString(a.key)
+	if err != nil {
+		return "", err
+	}
+	a.bearer, a.issued = s, time.Now()
+	return s, nil
+}
+
+func (a *APNs) Send(ctx context.Context, token string, m Message) error {
+	bearer, err := a.token()
+	if err != nil {
+		return err
+	}
+	payload := map[string]any{"aps": map[string]any{
+		"alert": map[string]string{"title": m.Title, "body": m.Body},
+		"sound": "default",
+	}}
+	for k, v := range m.Data {
+		if k != "aps" {
+			payload[k] = v
+		}
+	}
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.host+"/3/device/"+token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("authorization", "bearer "+bearer)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	var out struct {
+		Reason string `json:"reason"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&out)
+	switch out.Reason {
+	case "BadDeviceToken", "Unregistered", "DeviceTokenNotForTopic":
+		return ErrInvalidToken
+	}
+	return fmt.Errorf("apns: send: status %d %s", res.StatusCode, out.Reason)
+}
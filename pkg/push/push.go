@@ -0,0 +1,164 @@
+// Package push sends mobile push notifications through Firebase Cloud
+// Messaging (Android) and APNs (iOS). Messages are built from named
+// templates so copy lives in one place; they also render the in-app
+// notification feed.
+package push
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+	"github.com/sudo-init-do/okies-backend/pkg/i18n"
+)
+
+// ErrInvalidToken means the provider no longer recognises the device token
+// (app uninstalled, token rotated). Callers should forget the token.
+var ErrInvalidToken = errors.New("push: invalid device token")
+
+type Message struct {
+	Title string
+	Body  string
+	Data  map[string]string // delivered to the app alongside the alert
+}
+
+// Sender delivers a message to one device token.
+type Sender interface {
+	Send(ctx context.Context, token string, m Message) error
+}
+
+// Senders routes by platform ("android", "ios"). A platform without a
+// configured sender is skipped.
+type Senders map[string]Sender
+
+// ErrNoSender is returned for a platform with no configured sender.
+var ErrNoSender = errors.New("push: no sender for platform")
+
+func (s Senders) Send(ctx context.Context, platform, token string, m Message) error {
+	snd, ok := s[platform]
+	if !ok || snd == nil {
+		return ErrNoSender
+	}
+	return snd.Send(ctx, token, m)
+}
+
+type tmpl struct{ title, body *template.Template }
+
+// templates are keyed by language, then notification kind. Bodies see the
+// event data. English is defined here; translations come from pkg/i18n.
+var templates = map[string]map[string]tmpl{}
+
+func define(lang, kind, title, body string) {
+	if templates[lang] == nil {
+		templates[lang] = map[string]tmpl{}
+	}
+	fn := funcs(lang, i18n.CurrencySymbol)
+	templates[lang][kind] = tmpl{
+		title: template.Must(template.New(kind + ".title").Funcs(fn).Parse(title)),
+		body:  template.Must(template.New(kind + ".body").Funcs(fn).Parse(body)),
+	}
+}
+
+func funcs(lang, currency string) template.FuncMap {
+	return template.FuncMap{
+		// naira renders kobo as naira with two decimals, in the
+		// recipient's currency display
+		"naira": func(kobo any) string {
+			var k int64
+			switch v := kobo.(type) {
+			case int64:
+				k = v
+			case int:
+				k = int64(v)
+			case float64: // from JSON
+				k = int64(v)
+			}
+			return i18n.Money(k, currency)
+		},
+		// error renders the message for an API error code
+		"error": func(code any) string {
+			return apierror.LocalizedMessage(lang, fmt.Sprint(code), http.StatusBadRequest)
+		},
+	}
+}
+
+func init() {
+	en := i18n.English
+	define(en, "gift_received", "You received a gift", `You received {{naira .amount}}.`)
+	define(en, "withdrawal_approved", "Withdrawal approved", `Your withdrawal of {{naira .amount}} is on its way to your bank.`)
+	define(en, "withdrawal_settled", "Withdrawal {{if eq .status \"succeeded\"}}completed{{else}}failed{{end}}",
+		`{{if eq .status "succeeded"}}{{naira .amount}} has been paid to your bank.{{else}}Your withdrawal of {{naira .amount}} failed.{{if .refunded}} The money is back in your wallet.{{end}}{{end}}`)
+	define(en, "deposit_settled", "Wallet funded", `{{naira .amount}} has been added to your wallet.`)
+
+	// in-app only
+	define(en, "scheduled_gift_failed", "Scheduled gift not sent", `Your scheduled gift of {{naira .amount}} was not sent. {{error .code}}`)
+	define(en, "statement_ready", "Your statement is ready", `Your account statement for {{.from}} – {{.to}} is ready to view.`)
+	define(en, "support_reply", "Support replied to your request", `{{.subject}}`)
+	define(en, "support_resolved", "Your support request was resolved", `{{.resolution}}`)
+	define(en, "account_status",
+		`{{if eq .status "active"}}Your account has been reinstated{{else if eq .status "suspended"}}Your account has been suspended{{else}}Your account has been closed{{end}}`,
+		`{{if eq .status "active"}}Your account has been reinstated{{else if eq .status "suspended"}}Your account has been suspended{{else}}Your account has been closed{{end}}{{if .reason}}: {{.reason}}{{else}}.{{end}}`)
+	define(en, "name_changed",
+		`{{if eq .field "username"}}Your username was changed{{else}}Your display name was changed{{end}}`,
+		`It didn't meet our rules for names, so our team changed it. You can choose a new one in your profile.`)
+
+	for _, lang := range i18n.Languages[1:] {
+		for kind, t := range i18n.Notifications(lang) {
+			if _, ok := templates[en][kind]; !ok {
+				panic(fmt.Sprintf("push: %s translation of unknown template %q", lang, kind))
+			}
+			define(lang, kind, t.Title, t.Body)
+		}
+	}
+}
+
+// withCurrency is t showing amounts in another currency display.
+func (t tmpl) withCurrency(lang, currency string) (tmpl, error) {
+	title, err := t.title.Clone()
+	if err != nil {
+		return t, err
+	}
+	body, err := t.body.Clone()
+	if err != nil {
+		return t, err
+	}
+	fn := funcs(lang, currency)
+	return tmpl{title: title.Funcs(fn), body: body.Funcs(fn)}, nil
+}
+
+// Render builds the message for kind in lang, falling back to English for
+// kinds without a translation, with amounts in the currency display (see
+// i18n.Money). Every data value is also passed through to the app as a
+// string.
+func Render(kind, lang, currency string, data map[string]any) (Message, error) {
+	t, ok := templates[lang][kind]
+	if !ok {
+		lang = i18n.English
+		t, ok = templates[lang][kind]
+	}
+	if !ok {
+		return Message{}, fmt.Errorf("push: unknown template %q", kind)
+	}
+	if currency != i18n.CurrencySymbol && currency != "" {
+		var err error
+		if t, err = t.withCurrency(lang, currency); err != nil {
+			return Message{}, err
+		}
+	}
+	var title, body bytes.Buffer
+	if err := t.title.Execute(&title, data); err != nil {
+		return Message{}, err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	m := Message{Title: title.String(), Body: body.String(), Data: map[string]string{"kind": kind}}
+	for k, v := range data {
+		m.Data[k] = fmt.Sprint(v)
+	}
+	return m, nil
+}
@@ -0,0 +1,75 @@
+// Package ratelimit is a sliding-window rate limiter in Redis. Each key is a
+// sorted set of request timestamps; a Lua script trims entries older than
+// the window, counts what is left and records the new request in one atomic
+// step, so there is no burst at window edges and a busy key's TTL never
+// outlives its last request by more than a window.
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KEYS[1] key; ARGV[1] window ms, ARGV[2] limit, ARGV[3] unique member.
+// Returns {allowed, remaining, retry_after_ms}. Time comes from Redis so
+// API instances with skewed clocks share one window.
+var slidingWindow = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count >= limit then
+  local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+  local retry = window
+  if oldest[2] then
+    retry = tonumber(oldest[2]) + window - now
+  end
+  return {0, 0, retry}
+end
+redis.call('ZADD', KEYS[1], now, ARGV[3])
+redis.call('PEXPIRE', KEYS[1], window)
+return {1, limit - count - 1, 0}
+`)
+
+type Limiter struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// New returns a limiter whose keys are namespaced under prefix.
+func New(rdb *redis.Client, prefix string) *Limiter {
+	return &Limiter{rdb: rdb, prefix: prefix}
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // when denied, until the oldest request leaves the window
+}
+
+// Allow records a request against key if fewer than limit were made in the
+// last window. Denied requests are not recorded, so a client that keeps
+// retrying gets through as soon as the window has room.
+func (l *Limiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	vals, err := slidingWindow.Run(ctx, l.rdb, []string{l.prefix + key},
+		window.Milliseconds(), limit, hex.EncodeToString(b[:])).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    vals[0] == 1,
+		Limit:      limit,
+		Remaining:  int(vals[1]),
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,184 @@
+// Package redact masks credentials and personal data before they reach logs
+// or stored provider payloads.
+//
+// Fields are recognised by name, case-insensitively and ignoring - and _:
+// credentials are replaced outright; emails, account and phone numbers and
+// personal names keep just enough to tell values apart. Free text (log
+// messages, errors) is scrubbed by pattern instead: email addresses, 10-11
+// digit numbers (NUBAN, BVN, local phone), international phone numbers,
+// bearer tokens and JWTs.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Mask replaces credential values.
+const Mask = "[REDACTED]"
+
+type class int
+
+const (
+	none class = iota
+	secret
+	email
+	number
+	name
+)
+
+var fields = map[string]class{
+	"authorization":     secret,
+	"apikey":            secret,
+	"xapikey":           secret,
+	"secret":            secret,
+	"secretkey":         secret,
+	"clientsecret":      secret,
+	"token":             secret,
+	"accesstoken":       secret,
+	"refreshtoken":      secret,
+	"password":          secret,
+	"signature":         secret,
+	"verifhash":         secret,
+	"xamzsecuritytoken": secret,
+	"cookie":            secret,
+	"setcookie":         secret,
+	"pin":               secret,
+	"otp":               secret,
+	"cvv":               secret,
+	"cardnumber":        secret,
+	"pan":               secret,
+
+	"email":         email,
+	"emailaddress":  email,
+	"customeremail": email,
+
+	"accountnumber": number,
+	"accountno":     number,
+	"nuban":         number,
+	"bvn":           number,
+	"phone":         number,
+	"phonenumber":   number,
+	"msisdn":        number,
+
+	"accountname":     name,
+	"fullname":        name,
+	"customername":    name,
+	"beneficiaryname": name,
+	"firstname":       name,
+	"lastname":        name,
+}
+
+var normalize = strings.NewReplacer("-", "", "_", "")
+
+func classify(field string) class {
+	return fields[normalize.Replace(strings.ToLower(field))]
+}
+
+// IsSecret reports whether field names a credential.
+func IsSecret(field string) bool { return classify(field) == secret }
+
+// Sensitive reports whether field is masked by Field.
+func Sensitive(field string) bool { return classify(field) != none }
+
+// Field masks v if field names a credential or personal data; other values
+// are scrubbed as free text.
+func Field(field, v string) string {
+	switch classify(field) {
+	case secret:
+		return Mask
+	case email:
+		return maskEmail(v)
+	case number:
+		return maskNumber(v)
+	case name:
+		return maskName(v)
+	}
+	return String(v)
+}
+
+func maskEmail(v string) string {
+	local, domain, ok := strings.Cut(v, "@")
+	if !ok || local == "" {
+		return Mask
+	}
+	return local[:1] + "***@" + domain
+}
+
+// maskNumber keeps the last four digits, as bank apps do.
+func maskNumber(v string) string {
+	if len(v) <= 4 {
+		return Mask
+	}
+	return strings.Repeat("*", len(v)-4) + v[len(v)-4:]
+}
+
+func maskName(v string) string {
+	if v == "" {
+		return v
+	}
+	parts := strings.Fields(v)
+	for i, p := range parts {
+		r := []rune(p)
+		parts[i] = string(r[:1]) + "***"
+	}
+	return strings.Join(parts, " ")
+}
+
+var (
+	reEmail  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	reDigits = regexp.MustCompile(`\b\d{10,11}\b|\+\d{11,14}\b`)
+	reBearer = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`)
+	reJWT    = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// String scrubs personal data and tokens out of free text.
+func String(s string) string {
+	s = reBearer.ReplaceAllString(s, "Bearer "+Mask)
+	s = reJWT.ReplaceAllString(s, Mask)
+	s = reEmail.ReplaceAllStringFunc(s, maskEmail)
+	return reDigits.ReplaceAllStringFunc(s, maskNumber)
+}
+
+// JSON returns a copy of a JSON document with sensitive fields masked at any
+// depth and other strings scrubbed. Key order is not preserved. Input that
+// isn't JSON is scrubbed as free text.
+func JSON(b []byte) []byte {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return []byte(String(string(b)))
+	}
+	out, err := json.Marshal(walk("", v))
+	if err != nil {
+		return []byte(String(string(b)))
+	}
+	return out
+}
+
+func walk(field string, v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, c := range t {
+			t[k] = walk(k, c)
+		}
+		return t
+	case []any:
+		for i, c := range t {
+			t[i] = walk(field, c)
+		}
+		return t
+	case string:
+		return Field(field, t)
+	case json.Number:
+		// account and phone numbers sometimes arrive unquoted
+		if c := classify(field); c != none {
+			return Field(field, t.String())
+		}
+		return t
+	}
+	return v
+}
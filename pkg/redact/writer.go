@@ -0,0 +1,67 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+)
+
+// Writer redacts zerolog's JSON lines on their way to w:
+//
+//	log.Logger = log.Output(redact.NewWriter(os.Stderr))
+//
+// Sensitive fields are masked by name and every other string value is
+// scrubbed as free text, so an email that ends up in an error message is
+// caught as well as one logged under "email".
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer { return &Writer{w: w} }
+
+func (rw *Writer) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write(Line(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// a JSON string, with the colon that makes it a key, or a number
+var reToken = regexp.MustCompile(`"(?:[^"\\]|\\.)*"(\s*:)?|-?\d+(?:\.\d+)?(?:[eE][+-]?\d+)?`)
+
+// Line redacts one JSON log line, keeping its key order and layout. Values
+// take the class of the nearest key before them, so the elements of an
+// array are masked like the array's field.
+func Line(p []byte) []byte {
+	var key string
+	return reToken.ReplaceAllFunc(p, func(tok []byte) []byte {
+		if tok[0] != '"' {
+			if !Sensitive(key) {
+				return tok
+			}
+			return quote(Field(key, string(tok)))
+		}
+		if tok[len(tok)-1] == ':' {
+			lit := bytes.TrimRight(tok[:len(tok)-1], " \t\r\n")
+			_ = json.Unmarshal(lit, &key)
+			return tok
+		}
+		var s string
+		if json.Unmarshal(tok, &s) != nil {
+			return tok
+		}
+		if r := Field(key, s); r != s {
+			return quote(r)
+		}
+		return tok
+	})
+}
+
+func quote(s string) []byte {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return bytes.TrimRight(b.Bytes(), "\n")
+}
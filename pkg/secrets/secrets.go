@@ -0,0 +1,106 @@
+// Package secrets serves credentials that can be rotated while the process
+// runs. Each is read from a file named after it in a directory, the way
+// Kubernetes secret volumes and Vault Agent templates deliver them, and
+// falls back to the value the process started with (usually from the
+// environment) when the file is absent. Watch re-reads the directory and
+// reports which secrets changed; values are never logged.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type Store struct {
+	dir      string
+	defaults map[string]string
+
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// New returns a store for the secrets named in defaults, read from dir.
+// With dir empty the defaults are all there is and nothing changes.
+func New(dir string, defaults map[string]string) (*Store, error) {
+	s := &Store{dir: dir, defaults: defaults, values: map[string]string{}}
+	for name, v := range defaults {
+		s.values[name] = v
+	}
+	_, err := s.Reload()
+	return s, err
+}
+
+// Get returns the current value of name.
+func (s *Store) Get(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[name]
+}
+
+// Reload re-reads the directory and returns the names whose value changed,
+// sorted. A file that can't be read keeps its secret's previous value.
+func (s *Store) Reload() ([]string, error) {
+	if s.dir == "" {
+		return nil, nil
+	}
+	var errs []error
+	next := map[string]string{}
+	for name, def := range s.defaults {
+		b, err := os.ReadFile(filepath.Join(s.dir, name))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			next[name] = def
+		case err != nil:
+			errs = append(errs, err)
+			next[name] = s.Get(name)
+		default:
+			next[name] = strings.TrimSpace(string(b))
+		}
+	}
+
+	s.mu.Lock()
+	var changed []string
+	for name, v := range next {
+		if s.values[name] != v {
+			changed = append(changed, name)
+		}
+	}
+	s.values = next
+	s.mu.Unlock()
+	sort.Strings(changed)
+	return changed, errors.Join(errs...)
+}
+
+// Watch reloads every interval until ctx is cancelled, calling onChange
+// with the names that changed.
+func (s *Store) Watch(ctx context.Context, interval time.Duration, onChange func(changed []string)) {
+	if s.dir == "" {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		changed, err := s.Reload()
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("dir", s.dir).Msg("reading secrets failed")
+		}
+		if len(changed) > 0 {
+			log.Ctx(ctx).Info().Strs("secrets", changed).Msg("secrets changed")
+			onChange(changed)
+		}
+	}
+}
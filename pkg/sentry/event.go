@@ -0,0 +1,71 @@
+package sentry
+
+import "time"
+
+// Event is the subset of Sentry's event payload this package sends.
+type Event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Exception   *Exceptions       `json:"exception,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]any    `json:"extra,omitempty"`
+	User        *User             `json:"user,omitempty"`
+	Request     *Request          `json:"request,omitempty"`
+	Breadcrumbs *Breadcrumbs      `json:"breadcrumbs,omitempty"`
+	// Fingerprint groups events into issues; Sentry's default groups by
+	// stack trace or message.
+	Fingerprint []string `json:"fingerprint,omitempty"`
+	Environment string   `json:"environment,omitempty"`
+	Release     string   `json:"release,omitempty"`
+	ServerName  string   `json:"server_name,omitempty"`
+}
+
+type Exceptions struct {
+	Values []Exception `json:"values"`
+}
+
+type Exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *Stacktrace `json:"stacktrace,omitempty"`
+}
+
+type Stacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+type Frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	AbsPath  string `json:"abs_path,omitempty"`
+	Lineno   int    `json:"lineno,omitempty"`
+	InApp    bool   `json:"in_app"`
+}
+
+type User struct {
+	ID string `json:"id"`
+}
+
+// Request describes the HTTP request an event happened in. URL should be
+// the route pattern, not the raw path, to keep ids and tokens out.
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type Breadcrumbs struct {
+	Values []Breadcrumb `json:"values"`
+}
+
+// Breadcrumb is something that happened before the event, such as an
+// earlier log line in the same request.
+type Breadcrumb struct {
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level,omitempty"`
+	Category  string    `json:"category,omitempty"`
+	Message   string    `json:"message"`
+}
@@ -0,0 +1,215 @@
+// Package sentry reports errors to Sentry, or a compatible tracker such as
+// GlitchTip, through its envelope endpoint.
+//
+// Events are queued and sent by one background goroutine, so capturing
+// never blocks the caller; when the queue is full, or the tracker has asked
+// us to back off with a 429, events are dropped. A nil *Client is valid and
+// discards everything, so callers need no "is it configured" checks.
+package sentry
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LevelWarning = "warning"
+	LevelError   = "error"
+	LevelFatal   = "fatal"
+)
+
+// Options configure a Client.
+type Options struct {
+	DSN         string
+	Environment string
+	Release     string
+	ServerName  string
+	// SampleRate is the share of events sent, 0-1. Fatal events (panics)
+	// are always sent.
+	SampleRate float64
+	// InAppPrefix marks stack frames from functions under this package path
+	// as the application's own, e.g. "github.com/acme/api".
+	InAppPrefix string
+	Client      *http.Client
+}
+
+type Client struct {
+	opts     Options
+	endpoint string
+	auth     string
+	queue    chan *Event
+	pending  sync.WaitGroup
+	// unix seconds until which the tracker asked us to stop sending
+	backoff atomic.Int64
+}
+
+const queueSize = 256
+
+// New parses o.DSN and starts the sender. It returns a nil Client when the
+// DSN is empty.
+func New(o Options) (*Client, error) {
+	if o.DSN == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(o.DSN)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, errors.New("sentry: DSN must look like https://<key>@<host>/<project>")
+	}
+	i := strings.LastIndex(u.Path, "/")
+	project := u.Path[i+1:]
+	if project == "" {
+		return nil, errors.New("sentry: DSN has no project id")
+	}
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	c := &Client{
+		opts:     o,
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, u.Path[:i], project),
+		auth:     "Sentry sentry_version=7, sentry_client=okies-go/1.0, sentry_key=" + u.User.Username(),
+		queue:    make(chan *Event, queueSize),
+	}
+	go c.run()
+	return c, nil
+}
+
+// Capture queues e, subject to sampling. It fills in the event id, time
+// and the client's environment, release and server name.
+func (c *Client) Capture(e *Event) {
+	if c == nil {
+		return
+	}
+	if e.Level != LevelFatal && rand.Float64() >= c.opts.SampleRate {
+		return
+	}
+	if time.Now().Unix() < c.backoff.Load() {
+		return
+	}
+	var id [16]byte
+	_, _ = crand.Read(id[:])
+	e.EventID = hex.EncodeToString(id[:])
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	if e.Level == "" {
+		e.Level = LevelError
+	}
+	e.Platform = "go"
+	e.Environment = c.opts.Environment
+	e.Release = c.opts.Release
+	e.ServerName = c.opts.ServerName
+
+	c.pending.Add(1)
+	select {
+	case c.queue <- e:
+	default:
+		c.pending.Done() // full; drop rather than block the caller
+	}
+}
+
+// Flush waits until queued events are sent or ctx is done.
+func (c *Client) Flush(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		c.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func (c *Client) run() {
+	for e := range c.queue {
+		c.send(e)
+		c.pending.Done()
+	}
+}
+
+func (c *Client) send(e *Event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	var body bytes.Buffer
+	header, _ := json.Marshal(map[string]any{"event_id": e.EventID, "sent_at": time.Now().UTC()})
+	item, _ := json.Marshal(map[string]any{"type": "event", "length": len(payload)})
+	body.Write(header)
+	body.WriteByte('\n')
+	body.Write(item)
+	body.WriteByte('\n')
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, &body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", c.auth)
+	res, err := c.opts.Client.Do(req)
+	if err != nil {
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusTooManyRequests {
+		wait := 60
+		if s, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && s > 0 {
+			wait = s
+		}
+		c.backoff.Store(time.Now().Add(time.Duration(wait) * time.Second).Unix())
+	}
+}
+
+// Stack returns the calling goroutine's stack, skipping skip frames above
+// the caller of Stack, oldest frame first as Sentry expects.
+func (c *Client) Stack(skip int) *Stacktrace {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var out []Frame
+	for {
+		f, more := frames.Next()
+		module, function := splitFunction(f.Function)
+		inApp := c != nil && c.opts.InAppPrefix != "" && strings.HasPrefix(module, c.opts.InAppPrefix)
+		out = append(out, Frame{Function: function, Module: module, AbsPath: f.File, Lineno: f.Line, InApp: inApp})
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return &Stacktrace{Frames: out}
+}
+
+// splitFunction splits "github.com/a/b/pkg.(*T).M" into package path and
+// function name.
+func splitFunction(name string) (string, string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
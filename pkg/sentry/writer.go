@@ -0,0 +1,72 @@
+package sentry
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// LogWriter returns a writer for zerolog's JSON output that captures every
+// line at error level or above as an event:
+//
+//	log.Logger = log.Output(io.MultiWriter(os.Stderr, tracker.LogWriter("request_id")))
+//
+// The message becomes the issue (lines are grouped by message, not by the
+// varying error text); "error" becomes the exception value, "user_id" the
+// user and other short string fields tags. Lines carrying any of the skip
+// fields are left alone, for callers that report those errors themselves.
+// It never fails, so it can't break the log pipeline.
+func (c *Client) LogWriter(skip ...string) io.Writer {
+	return logWriter{c: c, skip: skip}
+}
+
+type logWriter struct {
+	c    *Client
+	skip []string
+}
+
+var capturedLevels = map[string]string{"error": LevelError, "fatal": LevelFatal, "panic": LevelFatal}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	if w.c == nil {
+		return len(p), nil
+	}
+	var fields map[string]any
+	if json.Unmarshal(p, &fields) != nil {
+		return len(p), nil
+	}
+	level, _ := fields["level"].(string)
+	sl, ok := capturedLevels[level]
+	if !ok {
+		return len(p), nil
+	}
+	for _, k := range w.skip {
+		if _, ok := fields[k]; ok {
+			return len(p), nil
+		}
+	}
+
+	msg, _ := fields["message"].(string)
+	e := &Event{Level: sl, Logger: "zerolog", Message: msg, Tags: map[string]string{}, Extra: map[string]any{}}
+	if msg != "" {
+		e.Fingerprint = []string{msg}
+	}
+	if err, ok := fields["error"].(string); ok {
+		e.Exception = &Exceptions{Values: []Exception{{Type: msg, Value: err}}}
+	}
+	if uid, ok := fields["user_id"].(string); ok {
+		e.User = &User{ID: uid}
+	}
+	for k, v := range fields {
+		switch k {
+		case "level", "message", "error", "time", "user_id":
+			continue
+		}
+		if s, ok := v.(string); ok && len(s) <= 200 {
+			e.Tags[k] = s
+		} else {
+			e.Extra[k] = v
+		}
+	}
+	w.c.Capture(e)
+	return len(p), nil
+}
@@ -0,0 +1,40 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// AccountMap is the value of a KindAccountMap setting, stored as JSON:
+//
+//	{"wallets":"2100","kinds":{"topup":"1010","referral_reward":"6100"},"taxRate":"Tax Exempt"}
+//
+// Wallets is the ledger account customer wallet balances post to. Kinds
+// names, per transaction kind, the account the system wallet's side of
+// those transactions posts to. Accounts are names or codes, whichever the
+// accounting system imports by. TaxRate fills Xero's tax rate column.
+type AccountMap struct {
+	Wallets string            `json:"wallets"`
+	Kinds   map[string]string `json:"kinds"`
+	TaxRate string            `json:"taxRate,omitempty"`
+}
+
+// ParseAccountMap decodes and checks an account map value.
+func ParseAccountMap(v string) (AccountMap, error) {
+	var m AccountMap
+	if err := json.Unmarshal([]byte(v), &m); err != nil || m.Wallets == "" {
+		return m, ErrInvalidValue
+	}
+	for _, acct := range m.Kinds {
+		if acct == "" {
+			return m, ErrInvalidValue
+		}
+	}
+	return m, nil
+}
+
+func (s *Store) AccountMap(ctx context.Context, key string) AccountMap {
+	v, _ := s.raw(ctx, key)
+	m, _ := ParseAccountMap(v)
+	return m
+}
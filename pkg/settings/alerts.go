@@ -0,0 +1,58 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// AlertRoutes is the value of a KindAlertRoutes setting, stored as JSON:
+//
+//	{"default":["webhook"],"routes":{"fraud_rule_hit":["slack"],"payout_failed":["slack","telegram"]}}
+//
+// Routes names, per alert, the channels it is sent to; alerts not listed go
+// to Default. An empty list silences an alert (it is still logged).
+type AlertRoutes struct {
+	Default []string            `json:"default"`
+	Routes  map[string][]string `json:"routes,omitempty"`
+}
+
+var alertChannels = map[string]bool{"webhook": true, "slack": true, "telegram": true}
+
+// ParseAlertRoutes decodes and checks an alert routing value.
+func ParseAlertRoutes(v string) (AlertRoutes, error) {
+	var r AlertRoutes
+	if err := json.Unmarshal([]byte(v), &r); err != nil {
+		return r, ErrInvalidValue
+	}
+	valid := func(chans []string) bool {
+		for _, c := range chans {
+			if !alertChannels[c] {
+				return false
+			}
+		}
+		return true
+	}
+	if !valid(r.Default) {
+		return r, ErrInvalidValue
+	}
+	for _, chans := range r.Routes {
+		if !valid(chans) {
+			return r, ErrInvalidValue
+		}
+	}
+	return r, nil
+}
+
+// For returns the channels the named alert goes to.
+func (r AlertRoutes) For(alert string) []string {
+	if chans, ok := r.Routes[alert]; ok {
+		return chans
+	}
+	return r.Default
+}
+
+func (s *Store) AlertRoutes(ctx context.Context, key string) AlertRoutes {
+	v, _ := s.raw(ctx, key)
+	r, _ := ParseAlertRoutes(v)
+	return r
+}
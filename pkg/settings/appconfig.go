@@ -0,0 +1,122 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AppConfig is the value of a KindAppConfig setting, stored as JSON:
+//
+//	{"platforms":{"ios":{"minVersion":"2.3.0","latestVersion":"2.5.1","storeUrl":"https://apps.apple.com/app/id0"},
+//	              "android":{"minVersion":"2.3.0","features":{"vouchers":false}}},
+//	 "features":{"vouchers":true},
+//	 "fees":{"withdrawal":{"flat":5000,"percent":0.5,"cap":100000}},
+//	 "copy":{"home.banner":"Send gifts in seconds"}}
+//
+// It is what the mobile apps read at start-up. Features and copy are shared
+// by every platform unless a platform overrides them; fee amounts are kobo.
+type AppConfig struct {
+	Platforms map[string]AppPlatform `json:"platforms"`
+	Features  map[string]bool        `json:"features,omitempty"`
+	Fees      map[string]Fee         `json:"fees,omitempty"`
+	Copy      map[string]string      `json:"copy,omitempty"`
+}
+
+// AppPlatform is one platform's release information and overrides.
+type AppPlatform struct {
+	MinVersion    string            `json:"minVersion"`
+	LatestVersion string            `json:"latestVersion,omitempty"`
+	StoreURL      string            `json:"storeUrl,omitempty"`
+	Features      map[string]bool   `json:"features,omitempty"`
+	Copy          map[string]string `json:"copy,omitempty"`
+}
+
+// Fee is flat plus percent of the amount, at most Cap when Cap is set.
+type Fee struct {
+	Flat    int64   `json:"flat"`
+	Percent float64 `json:"percent"`
+	Cap     int64   `json:"cap,omitempty"`
+}
+
+// Platforms apps can be configured for.
+var appPlatforms = map[string]bool{"ios": true, "android": true}
+
+var appVersionRe = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+
+// ParseAppConfig decodes and checks an app configuration value.
+func ParseAppConfig(v string) (AppConfig, error) {
+	var c AppConfig
+	if err := json.Unmarshal([]byte(v), &c); err != nil {
+		return c, ErrInvalidValue
+	}
+	for name, p := range c.Platforms {
+		if !appPlatforms[name] || !appVersionRe.MatchString(p.MinVersion) {
+			return c, ErrInvalidValue
+		}
+		if p.LatestVersion != "" && (!appVersionRe.MatchString(p.LatestVersion) || CompareVersions(p.LatestVersion, p.MinVersion) < 0) {
+			return c, ErrInvalidValue
+		}
+	}
+	for _, f := range c.Fees {
+		if f.Flat < 0 || f.Percent < 0 || f.Percent > 100 || f.Cap < 0 {
+			return c, ErrInvalidValue
+		}
+	}
+	return c, nil
+}
+
+// Platform returns name's settings with the shared features and copy merged
+// under its overrides. ok is false for a platform that isn't configured.
+func (c AppConfig) Platform(name string) (p AppPlatform, ok bool) {
+	p, ok = c.Platforms[name]
+	if !ok {
+		return p, false
+	}
+	features := make(map[string]bool, len(c.Features)+len(p.Features))
+	for k, v := range c.Features {
+		features[k] = v
+	}
+	for k, v := range p.Features {
+		features[k] = v
+	}
+	copyStrings := make(map[string]string, len(c.Copy)+len(p.Copy))
+	for k, v := range c.Copy {
+		copyStrings[k] = v
+	}
+	for k, v := range p.Copy {
+		copyStrings[k] = v
+	}
+	p.Features, p.Copy = features, copyStrings
+	return p, true
+}
+
+// CompareVersions compares dotted numeric versions ("2.10.1" > "2.9"),
+// treating missing parts as 0. It returns -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+func (s *Store) AppConfig(ctx context.Context, key string) AppConfig {
+	v, _ := s.raw(ctx, key)
+	c, _ := ParseAppConfig(v)
+	return c
+}
@@ -0,0 +1,62 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// RateLimit is the value of a KindRateLimit setting, stored as JSON:
+//
+//	{"limit":20,"window":"1m","key":"ip","failClosed":true,"tiers":{"admin":100}}
+//
+// Key is "ip" or "user" (authenticated callers by user id, others by IP).
+// Tiers override Limit for callers of a role, or "anonymous" for callers
+// without a token; the window is shared.
+type RateLimit struct {
+	Limit      int            `json:"limit"`
+	Window     string         `json:"window"`
+	Key        string         `json:"key"`
+	FailClosed bool           `json:"failClosed,omitempty"`
+	Tiers      map[string]int `json:"tiers,omitempty"`
+}
+
+// ParseRateLimit decodes and checks a rate limit value.
+func ParseRateLimit(v string) (RateLimit, error) {
+	var rl RateLimit
+	if err := json.Unmarshal([]byte(v), &rl); err != nil {
+		return rl, ErrInvalidValue
+	}
+	if d, err := time.ParseDuration(rl.Window); err != nil || d < time.Second {
+		return rl, ErrInvalidValue
+	}
+	if rl.Limit < 1 || (rl.Key != "ip" && rl.Key != "user") {
+		return rl, ErrInvalidValue
+	}
+	for _, n := range rl.Tiers {
+		if n < 1 {
+			return rl, ErrInvalidValue
+		}
+	}
+	return rl, nil
+}
+
+// WindowDuration returns Window parsed; values are validated on write.
+func (rl RateLimit) WindowDuration() time.Duration {
+	d, _ := time.ParseDuration(rl.Window)
+	return d
+}
+
+// LimitFor returns the limit for a caller of tier.
+func (rl RateLimit) LimitFor(tier string) int {
+	if n, ok := rl.Tiers[tier]; ok {
+		return n
+	}
+	return rl.Limit
+}
+
+func (s *Store) RateLimit(ctx context.Context, key string) RateLimit {
+	v, _ := s.raw(ctx, key)
+	rl, _ := ParseRateLimit(v)
+	return rl
+}
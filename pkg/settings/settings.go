@@ -0,0 +1,423 @@
+// Package settings holds runtime-tunable configuration (limits, fees,
+// toggles) backed by the settings table.
+//
+// Lookup order for a key is: settings row, then the legacy env var named in
+// its Def, then the Def default. Values are cached in memory for a short TTL;
+// when Redis is available, writes publish an invalidation so every instance
+// reloads immediately.
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+type Kind string
+
+const (
+	KindInt   Kind = "int"
+	KindFloat Kind = "float"
+	KindBool  Kind = "bool"
+	// KindRateLimit values are JSON; see RateLimit.
+	KindRateLimit Kind = "rate_limit"
+	// KindAccountMap values are JSON; see AccountMap.
+	KindAccountMap Kind = "account_map"
+	// KindAlertRoutes values are JSON; see AlertRoutes.
+	KindAlertRoutes Kind = "alert_routes"
+	// KindAppConfig values are JSON; see AppConfig.
+	KindAppConfig Kind = "app_config"
+)
+
+// Def describes a known setting. Only defined keys can be read or written.
+type Def struct {
+	Key         string   `json:"key"`
+	Kind        Kind     `json:"kind"`
+	Default     string   `json:"default"`
+	Env         string   `json:"env,omitempty"`
+	Description string   `json:"description"`
+	Min         *float64 `json:"min,omitempty"`
+}
+
+func nonNegative() *float64 { z := 0.0; return &z }
+func positive() *float64    { o := 1.0; return &o }
+
+const (
+	AccessTokenTTLMinutes   = "auth.access_token_ttl_minutes"
+	RefreshTokenTTLDays     = "auth.refresh_token_ttl_days"
+	ImpersonationTTLMinutes = "auth.impersonation_ttl_minutes"
+	ReferralRewardsEnabled  = "referrals.rewards_enabled"
+	ReferralRewardKobo      = "referrals.reward_kobo"
+	ReferralMinDepositKobo  = "referrals.min_deposit_kobo"
+	VoucherMaxDays          = "vouchers.max_days"
+	BulkTopupMaxRows        = "topups.bulk_max_rows"
+	UserImportMaxRows       = "users.import_max_rows"
+	FloatMinCoverage        = "float.min_coverage"
+	FloatReserveKobo        = "float.reserve_kobo"
+	PayoutDualControlKobo   = "payouts.dual_control_threshold_kobo"
+	StepUpThresholdKobo     = "payouts.step_up_threshold_kobo"
+	CTRSingleThresholdKobo  = "regulatory.ctr_single_threshold_kobo"
+	CTRDailyThresholdKobo   = "regulatory.ctr_daily_threshold_kobo"
+	AdminActionsPerMinute   = "admin.actions_per_minute"
+	AdminOffHoursStart      = "admin.off_hours_start"
+	AdminOffHoursEnd        = "admin.off_hours_end"
+	RetentionEnabled        = "retention.enabled"
+	RetentionWebhookDays    = "retention.webhook_payload_days"
+	RetentionRefreshDays    = "retention.revoked_refresh_token_days"
+	RetentionProviderDays   = "retention.provider_response_days"
+	RetentionSMSDays        = "retention.sms_body_days"
+	RetentionPartnerHooks   = "retention.partner_webhook_delivery_days"
+	RetentionSecurityEvents = "retention.security_event_days"
+	AccountingAccountMap    = "accounting.account_map"
+	AlertRouting            = "alerts.routing"
+	MobileAppConfig         = "app.config"
+	UsernameCooldownDays    = "users.username_cooldown_days"
+	UsernameHoldDays        = "users.username_hold_days"
+	BeneficiaryTrustDays    = "beneficiaries.trusted_after_days"
+	DeletionGraceDays       = "users.deletion_grace_days"
+
+	RateLimitSignup        = "ratelimit.auth_signup"
+	RateLimitLogin         = "ratelimit.auth_login"
+	RateLimitRefresh       = "ratelimit.auth_refresh"
+	RateLimitStatements    = "ratelimit.statements"
+	RateLimitGifts         = "ratelimit.gifts"
+	RateLimitVoucherRedeem = "ratelimit.voucher_redeem"
+	RateLimitOAuthToken    = "ratelimit.oauth_token"
+	RateLimitUsernameCheck = "ratelimit.username_check"
+	RateLimitPhoneVerify   = "ratelimit.phone_verify"
+	RateLimitOTPLogin      = "ratelimit.otp_login"
+	RateLimitResolve       = "ratelimit.resolve"
+	RateLimitPasswordReset = "ratelimit.password_reset"
+	RateLimitStepUp        = "ratelimit.step_up"
+	// RateLimitPasswordResetEmail is counted per email address rather than
+	// per caller; its key is ignored.
+	RateLimitPasswordResetEmail = "ratelimit.password_reset_email"
+)
+
+var defs = []Def{
+	{Key: AccessTokenTTLMinutes, Kind: KindInt, Default: "15", Env: "ACCESS_TOKEN_TTL_MIN", Description: "Access token lifetime in minutes.", Min: positive()},
+	{Key: RefreshTokenTTLDays, Kind: KindInt, Default: "30", Env: "REFRESH_TOKEN_TTL_DAYS", Description: "Refresh token lifetime in days.", Min: positive()},
+	{Key: ImpersonationTTLMinutes, Kind: KindInt, Default: "15", Env: "IMPERSONATION_TTL_MIN", Description: "Read-only impersonation token lifetime in minutes.", Min: positive()},
+	{Key: ReferralRewardsEnabled, Kind: KindBool, Default: "true", Description: "Pay referral rewards on a referred user's first qualifying deposit."},
+	{Key: ReferralRewardKobo, Kind: KindInt, Default: "50000", Env: "REFERRAL_REWARD_KOBO", Description: "Reward paid to each side of a qualifying referral, in kobo.", Min: nonNegative()},
+	{Key: ReferralMinDepositKobo, Kind: KindInt, Default: "100000", Description: "Smallest deposit that qualifies a referral, in kobo.", Min: nonNegative()},
+	{Key: VoucherMaxDays, Kind: KindInt, Default: "365", Description: "Longest voucher validity a user may request, in days.", Min: positive()},
+	{Key: BulkTopupMaxRows, Kind: KindInt, Default: "5000", Env: "BULK_TOPUP_MAX_ROWS", Description: "Maximum rows accepted by a bulk top-up upload.", Min: positive()},
+	{Key: UserImportMaxRows, Kind: KindInt, Default: "20000", Description: "Maximum rows accepted by a user import upload; the CLI has no limit.", Min: positive()},
+	{Key: FloatMinCoverage, Kind: KindFloat, Default: "1.0", Env: "FLOAT_MIN_COVERAGE", Description: "Alert when float / liabilities drops below this ratio.", Min: nonNegative()},
+	{Key: PayoutDualControlKobo, Kind: KindInt, Default: "50000000", Env: "PAYOUT_DUAL_CONTROL_KOBO", Description: "Withdrawals above this amount need two distinct admin approvals, in kobo. 0 disables.", Min: nonNegative()},
+	{Key: StepUpThresholdKobo, Kind: KindInt, Default: "5000000", Description: "Withdrawals of this amount or more need the user to re-authenticate first, unless they go to a trusted beneficiary, in kobo. 0 disables.", Min: nonNegative()},
+	{Key: CTRSingleThresholdKobo, Kind: KindInt, Default: "500000000", Description: "Report single transactions at or above this amount, in kobo.", Min: positive()},
+	{Key: CTRDailyThresholdKobo, Kind: KindInt, Default: "500000000", Description: "Report a user's daily inflow or outflow at or above this amount, in kobo.", Min: positive()},
+	{Key: AdminActionsPerMinute, Kind: KindInt, Default: "30", Description: "Per-admin limit on each sensitive action per minute; exceeding it is blocked and alerted.", Min: positive()},
+	{Key: AdminOffHoursStart, Kind: KindInt, Default: "22", Description: "Hour (0-23, Lagos time) from which sensitive admin actions raise an off-hours alert.", Min: nonNegative()},
+	{Key: AdminOffHoursEnd, Kind: KindInt, Default: "6", Description: "Hour (0-23, Lagos time) at which off-hours alerting stops. Equal to start disables it.", Min: nonNegative()},
+	{Key: RetentionEnabled, Kind: KindBool, Default: "true", Description: "Let the scheduled retention job purge data; when false it only records dry runs."},
+	{Key: RetentionWebhookDays, Kind: KindInt, Default: "180", Description: "Drop stored webhook payload bodies older than this, in days.", Min: positive()},
+	{Key: RetentionRefreshDays, Kind: KindInt, Default: "90", Description: "Delete refresh tokens revoked or expired longer ago than this, in days.", Min: positive()},
+	{Key: RetentionProviderDays, Kind: KindInt, Default: "365", Description: "Drop raw provider responses on payouts older than this, in days.", Min: positive()},
+	{Key: RetentionSMSDays, Kind: KindInt, Default: "90", Description: "Drop stored SMS bodies older than this, in days.", Min: positive()},
+	{Key: RetentionPartnerHooks, Kind: KindInt, Default: "30", Description: "Delete finished partner webhook deliveries older than this, in days.", Min: positive()},
+	{Key: RetentionSecurityEvents, Kind: KindInt, Default: "365", Description: "Delete account security events (sign-ins and the like) older than this, in days.", Min: positive()},
+	{Key: AccountingAccountMap, Kind: KindAccountMap, Default: `{"wallets":"Customer Wallets","kinds":{"topup":"Flutterwave Settlement","withdrawal":"Payouts Clearing","withdrawal_reserve":"Payouts Clearing","withdrawal_refund":"Payouts Clearing","referral_reward":"Referral Rewards","voucher_issue":"Voucher Liabilities","voucher_redeem":"Voucher Liabilities","voucher_sweep":"Voucher Liabilities","adjustment":"Ledger Adjustments","opening_balance":"Opening Balance Equity","direct_debit":"Open Banking Settlement"},"taxRate":"Tax Exempt"}`, Description: "Ledger accounts the accounting export posts to; see AccountMap."},
+	{Key: AlertRouting, Kind: KindAlertRoutes, Default: `{"default":["webhook","slack","telegram"]}`, Description: "Channels each alert is sent to; see AlertRoutes. Unconfigured channels are skipped."},
+	{Key: MobileAppConfig, Kind: KindAppConfig, Default: `{"platforms":{"ios":{"minVersion":"1.0.0"},"android":{"minVersion":"1.0.0"}}}`, Description: "What GET /v1/app-config serves: minimum versions, feature flags, fees and copy per platform; see AppConfig."},
+	{Key: UsernameCooldownDays, Kind: KindInt, Default: "30", Description: "Days a user must wait between username changes. 0 disables.", Min: nonNegative()},
+	{Key: UsernameHoldDays, Kind: KindInt, Default: "90", Description: "Days a released username keeps pointing at its previous owner before anyone else can claim it.", Min: nonNegative()},
+	{Key: BeneficiaryTrustDays, Kind: KindInt, Default: "30", Description: "Days a saved beneficiary must have been on file, and paid at least once, before it counts as trusted.", Min: nonNegative()},
+	{Key: DeletionGraceDays, Kind: KindInt, Default: "30", Description: "Days between a user deleting their account and its erasure, during which reactivating it cancels the deletion.", Min: nonNegative()},
+	{Key: FloatReserveKobo, Kind: KindInt, Default: "0", Env: "FLOAT_RESERVE_KOBO", Description: "Cash held outside the payment provider, counted towards float, in kobo.", Min: nonNegative()},
+	{Key: RateLimitSignup, Kind: KindRateLimit, Default: `{"limit":10,"window":"1m","key":"ip"}`, Description: "Sign-up attempts per client IP."},
+	{Key: RateLimitLogin, Kind: KindRateLimit, Default: `{"limit":20,"window":"1m","key":"ip","failClosed":true}`, Description: "Login attempts per client IP."},
+	{Key: RateLimitRefresh, Kind: KindRateLimit, Default: `{"limit":30,"window":"1m","key":"ip"}`, Description: "Token refreshes per client IP."},
+	{Key: RateLimitStatements, Kind: KindRateLimit, Default: `{"limit":10,"window":"1h","key":"user"}`, Description: "Statement requests per user."},
+	{Key: RateLimitGifts, Kind: KindRateLimit, Default: `{"limit":60,"window":"1m","key":"user"}`, Description: "Gifts sent per user."},
+	{Key: RateLimitVoucherRedeem, Kind: KindRateLimit, Default: `{"limit":10,"window":"1m","key":"user","failClosed":true}`, Description: "Voucher redemption attempts per user."},
+	{Key: RateLimitOAuthToken, Kind: KindRateLimit, Default: `{"limit":30,"window":"1m","key":"ip","failClosed":true}`, Description: "OAuth token requests per client IP."},
+	{Key: RateLimitUsernameCheck, Kind: KindRateLimit, Default: `{"limit":30,"window":"1m","key":"ip"}`, Description: "Username availability checks per client IP."},
+	{Key: RateLimitPhoneVerify, Kind: KindRateLimit, Default: `{"limit":10,"window":"1h","key":"user"}`, Description: "Phone number changes and code confirmations per user."},
+	{Key: RateLimitOTPLogin, Kind: KindRateLimit, Default: `{"limit":10,"window":"10m","key":"ip","failClosed":true}`, Description: "Login and account reactivation code requests and confirmations per client IP."},
+	{Key: RateLimitResolve, Kind: KindRateLimit, Default: `{"limit":30,"window":"1m","key":"user"}`, Description: "Profile link (handle) lookups per user."},
+	{Key: RateLimitPasswordReset, Kind: KindRateLimit, Default: `{"limit":10,"window":"15m","key":"ip","failClosed":true}`, Description: "Password reset requests and confirmations per client IP."},
+	{Key: RateLimitPasswordResetEmail, Kind: KindRateLimit, Default: `{"limit":3,"window":"1h","key":"ip"}`, Description: "Password reset emails per email address."},
+	{Key: RateLimitStepUp, Kind: KindRateLimit, Default: `{"limit":10,"window":"10m","key":"user","failClosed":true}`, Description: "Step-up code requests and re-authentication attempts per user."},
+}
+
+var defsByKey = func() map[string]Def {
+	m := make(map[string]Def, len(defs))
+	for _, d := range defs {
+		m[d.Key] = d
+	}
+	return m
+}()
+
+// Defs returns every known setting definition.
+func Defs() []Def {
+	return append([]Def(nil), defs...)
+}
+
+// Lookup returns the definition for key.
+func Lookup(key string) (Def, bool) {
+	d, ok := defsByKey[key]
+	return d, ok
+}
+
+var (
+	ErrUnknownKey   = errors.New("unknown setting")
+	ErrInvalidValue = errors.New("invalid setting value")
+)
+
+// Validate checks that value parses as d's kind and respects its bounds.
+func (d Def) Validate(value string) error {
+	switch d.Kind {
+	case KindInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || (d.Min != nil && float64(n) < *d.Min) {
+			return ErrInvalidValue
+		}
+	case KindFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || (d.Min != nil && f < *d.Min) {
+			return ErrInvalidValue
+		}
+	case KindBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return ErrInvalidValue
+		}
+	case KindRateLimit:
+		if _, err := ParseRateLimit(value); err != nil {
+			return err
+		}
+	case KindAccountMap:
+		if _, err := ParseAccountMap(value); err != nil {
+			return err
+		}
+	case KindAlertRoutes:
+		if _, err := ParseAlertRoutes(value); err != nil {
+			return err
+		}
+	case KindAppConfig:
+		if _, err := ParseAppConfig(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const invalidateChannel = "settings:invalidate"
+
+type Store struct {
+	db  *pgxpool.Pool
+	rdb *redis.Client // optional
+	ttl time.Duration
+
+	mu       sync.RWMutex
+	vals     map[string]string
+	loadedAt time.Time
+}
+
+func New(db *pgxpool.Pool, rdb *redis.Client) *Store {
+	return &Store{db: db, rdb: rdb, ttl: 30 * time.Second}
+}
+
+// Watch listens for invalidations published by other instances until ctx is
+// done. It is a no-op without Redis; the TTL bounds staleness instead.
+func (s *Store) Watch(ctx context.Context) {
+	if s.rdb == nil {
+		return
+	}
+	sub := s.rdb.Subscribe(ctx, invalidateChannel)
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+			s.mu.Lock()
+			s.loadedAt = time.Time{}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Store) load(ctx context.Context) (map[string]string, error) {
+	s.mu.RLock()
+	vals, fresh := s.vals, time.Since(s.loadedAt) < s.ttl
+	s.mu.RUnlock()
+	if fresh {
+		return vals, nil
+	}
+
+	rows, err := s.db.Query(ctx, `SELECT key, value FROM settings`)
+	if err != nil {
+		return vals, err
+	}
+	defer rows.Close()
+	next := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return vals, err
+		}
+		next[k] = v
+	}
+	if err := rows.Err(); err != nil {
+		return vals, err
+	}
+
+	s.mu.Lock()
+	s.vals, s.loadedAt = next, time.Now()
+	s.mu.Unlock()
+	return next, nil
+}
+
+// raw resolves key to its effective string value and where it came from.
+// A failed reload falls back to the last cached values.
+func (s *Store) raw(ctx context.Context, key string) (string, string) {
+	d, ok := defsByKey[key]
+	if !ok {
+		panic("settings: undefined key " + key)
+	}
+	vals, err := s.load(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("settings reload failed; using cached values")
+	}
+	if v, ok := vals[key]; ok && d.Validate(v) == nil {
+		return v, "db"
+	}
+	if d.Env != "" {
+		if v := os.Getenv(d.Env); v != "" && d.Validate(v) == nil {
+			return v, "env"
+		}
+	}
+	return d.Default, "default"
+}
+
+func (s *Store) Int64(ctx context.Context, key string) int64 {
+	v, _ := s.raw(ctx, key)
+	n, _ := strconv.ParseInt(v, 10, 64)
+	return n
+}
+
+func (s *Store) Int(ctx context.Context, key string) int {
+	return int(s.Int64(ctx, key))
+}
+
+func (s *Store) Float64(ctx context.Context, key string) float64 {
+	v, _ := s.raw(ctx, key)
+	f, _ := strconv.ParseFloat(v, 64)
+	return f
+}
+
+func (s *Store) Bool(ctx context.Context, key string) bool {
+	v, _ := s.raw(ctx, key)
+	b, _ := strconv.ParseBool(v)
+	return b
+}
+
+// Minutes / Days read integer settings as durations.
+func (s *Store) Minutes(ctx context.Context, key string) time.Duration {
+	return time.Duration(s.Int64(ctx, key)) * time.Minute
+}
+
+func (s *Store) Days(ctx context.Context, key string) time.Duration {
+	return time.Duration(s.Int64(ctx, key)) * 24 * time.Hour
+}
+
+// Value is a setting as shown to admins.
+type Value struct {
+	Def
+	Value     string     `json:"value"`
+	Source    string     `json:"source"` // db | env | default
+	UpdatedBy *string    `json:"updatedBy,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// All returns every defined setting with its effective value.
+func (s *Store) All(ctx context.Context) ([]Value, error) {
+	meta := map[string]Value{}
+	rows, err := s.db.Query(ctx, `SELECT key, updated_by::text, updated_at FROM settings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k string
+		var v Value
+		if err := rows.Scan(&k, &v.UpdatedBy, &v.UpdatedAt); err != nil {
+			return nil, err
+		}
+		meta[k] = v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]Value, 0, len(defs))
+	for _, d := range defs {
+		v := meta[d.Key]
+		v.Def = d
+		v.Value, v.Source = s.raw(ctx, d.Key)
+		if v.Source != "db" {
+			v.UpdatedBy, v.UpdatedAt = nil, nil
+		}
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// Set stores value for key and returns the previous effective value.
+func (s *Store) Set(ctx context.Context, key, value, actorID string) (string, error) {
+	d, ok := defsByKey[key]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	if err := d.Validate(value); err != nil {
+		return "", fmt.Errorf("%w: %s", err, key)
+	}
+	prev, _ := s.raw(ctx, key)
+	if _, err := s.db.Exec(ctx, `
+		INSERT INTO settings (key, value, updated_by, updated_at)
+		VALUES ($1,$2,$3,now())
+		ON CONFLICT (key) DO UPDATE SET value=EXCLUDED.value, updated_by=EXCLUDED.updated_by, updated_at=now()
+	`, key, value, actorID); err != nil {
+		return "", err
+	}
+	s.invalidate(ctx)
+	return prev, nil
+}
+
+// Reset deletes the stored value so the env/default applies again.
+func (s *Store) Reset(ctx context.Context, key string) (string, error) {
+	if _, ok := defsByKey[key]; !ok {
+		return "", ErrUnknownKey
+	}
+	prev, _ := s.raw(ctx, key)
+	if _, err := s.db.Exec(ctx, `DELETE FROM settings WHERE key=$1`, key); err != nil {
+		return "", err
+	}
+	s.invalidate(ctx)
+	return prev, nil
+}
+
+func (s *Store) invalidate(ctx context.Context) {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+	if s.rdb != nil {
+		if err := s.rdb.Publish(ctx, invalidateChannel, "1").Err(); err != nil {
+			log.Warn().Err(err).Msg("publish settings invalidation failed")
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package signing
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	oldKey = Key{ID: "k1", Secret: []byte("old secret")}
+	newKey = Key{ID: "k2", Secret: []byte("new secret")}
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"event":"gift.created"}`)
+	rotating := Sign(now, body, oldKey, newKey)
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		keys    []Key
+		now     time.Time
+		wantKid string
+		wantErr error
+	}{
+		{"round trip", Sign(now, body, oldKey), body, []Key{oldKey}, now, "k1", nil},
+		{"old key during rotation", rotating, body, []Key{oldKey}, now, "k1", nil},
+		{"new key during rotation", rotating, body, []Key{newKey}, now, "k2", nil},
+		{"within tolerance", Sign(now, body, oldKey), body, []Key{oldKey}, now.Add(DefaultTolerance), "k1", nil},
+		{"wrong key", Sign(now, body, oldKey), body, []Key{{ID: "k1", Secret: []byte("other")}}, now, "", ErrNoMatch},
+		{"kid names another key", Sign(now, body, oldKey), body, []Key{{ID: "k9", Secret: oldKey.Secret}}, now, "", ErrNoMatch},
+		{"altered body", Sign(now, body, oldKey), []byte(`{"event":"gift.refunded"}`), []Key{oldKey}, now, "", ErrNoMatch},
+		{"no keys", Sign(now, body, oldKey), body, nil, now, "", ErrNoMatch},
+		{"expired", Sign(now, body, oldKey), body, []Key{oldKey}, now.Add(DefaultTolerance + time.Second), "", ErrExpired},
+		{"from the future", Sign(now, body, oldKey), body, []Key{oldKey}, now.Add(-DefaultTolerance - time.Second), "", ErrExpired},
+		{"empty header", "", body, []Key{oldKey}, now, "", ErrMalformed},
+		{"no signature", "t=1700000000", body, []Key{oldKey}, now, "", ErrMalformed},
+		{"bad timestamp", "t=soon,kid=k1,v1=00", body, []Key{oldKey}, now, "", ErrMalformed},
+		{"bad hex", "t=1700000000,kid=k1,v1=zz", body, []Key{oldKey}, now, "", ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kid, err := Verify(tt.header, tt.body, tt.keys, DefaultTolerance, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.wantErr)
+			}
+			if kid != tt.wantKid {
+				t.Errorf("Verify kid = %q, want %q", kid, tt.wantKid)
+			}
+		})
+	}
+}
+
+func TestVerifyWithoutKid(t *testing.T) {
+	// verifiers predating kid match v1 against every key they hold
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte("{}")
+	header := Sign(now, body, oldKey)
+	_, v1, _ := strings.Cut(header, ",v1=")
+	kid, err := Verify("t=1700000000,v1="+v1, body, []Key{newKey, oldKey}, DefaultTolerance, now)
+	if err != nil || kid != "k1" {
+		t.Fatalf("Verify = %q, %v; want k1, nil", kid, err)
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	body := []byte(`{"amount":100}`)
+	req, _ := http.NewRequest(http.MethodPost, "https://partner.example/hook", bytes.NewReader(body))
+	SignRequest(req, body, oldKey)
+
+	got, err := VerifyRequest(req, []Key{oldKey}, DefaultTolerance, 1<<20)
+	if err != nil {
+		t.Fatalf("VerifyRequest: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("VerifyRequest body = %q, want %q", got, body)
+	}
+	again, _ := io.ReadAll(req.Body)
+	if !bytes.Equal(again, body) {
+		t.Errorf("body read after verifying = %q, want %q", again, body)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string // IDs
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"k1:abc", []string{"k1"}, false},
+		{" k1:abc , k2:d:e ,", []string{"k1", "k2"}, false},
+		{"k1", nil, true},
+		{":abc", nil, true},
+		{"k1:", nil, true},
+		{"k=1:abc", nil, true},
+	}
+	for _, tt := range tests {
+		keys, err := ParseKeys(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseKeys(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		var ids []string
+		for _, k := range keys {
+			ids = append(ids, k.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("ParseKeys(%q) IDs = %v, want %v", tt.in, ids, tt.want)
+		}
+	}
+	if keys, _ := ParseKeys("k2:d:e"); string(keys[0].Secret) != "d:e" {
+		t.Errorf("secret = %q, want everything after the first colon", keys[0].Secret)
+	}
+}
@@ -0,0 +1,107 @@
+// Package sms sends text messages through Termii or Twilio and normalises
+// their delivery reports. Message copy lives in named templates.
+package sms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+)
+
+// ErrRejected means the provider refused the message itself (invalid
+// number, blocked destination). Retrying will not help.
+var ErrRejected = errors.New("sms: message rejected")
+
+// ErrBadSignature means a delivery report failed verification.
+var ErrBadSignature = errors.New("sms: bad callback signature")
+
+// Delivery states, in the order a message moves through them. Failed and
+// Undelivered are terminal alongside Delivered.
+const (
+	StatusQueued      = "queued"
+	StatusSent        = "sent"
+	StatusDelivered   = "delivered"
+	StatusUndelivered = "undelivered"
+	StatusFailed      = "failed"
+)
+
+// Result is what a provider reports when it accepts a message.
+type Result struct {
+	ProviderID string
+	Cost       string // decimal, empty if not known yet
+	Currency   string
+}
+
+// Update is a parsed delivery report.
+type Update struct {
+	ProviderID string
+	Status     string
+	Error      string
+	Cost       string
+	Currency   string
+}
+
+// Driver sends one message to an E.164 number.
+type Driver interface {
+	Name() string
+	Send(ctx context.Context, to, body string) (Result, error)
+}
+
+// Pricer is implemented by drivers that only know the price of a message
+// some time after it was sent.
+type Pricer interface {
+	Price(ctx context.Context, providerID string) (cost, currency string, err error)
+}
+
+// ErrPriceUnknown is returned by Price while the provider has not priced
+// the message yet.
+var ErrPriceUnknown = errors.New("sms: price not available yet")
+
+var templates = map[string]*template.Template{}
+
+func define(name, body string) {
+	templates[name] = template.Must(template.New(name).Funcs(funcs).Parse(body))
+}
+
+var funcs = template.FuncMap{
+	// naira renders kobo as naira with two decimals
+	"naira": func(kobo any) string {
+		var k int64
+		switch v := kobo.(type) {
+		case int64:
+			k = v
+		case int:
+			k = int64(v)
+		case float64: // from JSON
+			k = int64(v)
+		}
+		return fmt.Sprintf("NGN%d.%02d", k/100, k%100)
+	},
+}
+
+func init() {
+	define("otp", `Your Okies code is {{.code}}. It expires in {{.minutes}} minutes. Never share it with anyone.`)
+	define("withdrawal_confirmation", `Okies: use code {{.code}} to confirm your withdrawal of {{naira .amount}}. If this wasn't you, change your password now.`)
+	define("transaction_alert", `Okies {{if eq .direction "credit"}}Credit{{else}}Debit{{end}}: {{naira .amount}}{{with .description}} - {{.}}{{end}}. Bal: {{naira .balance}}. Ref: {{.reference}}`)
+}
+
+// Sensitive reports whether a template carries a secret, so its rendered
+// text must not be stored.
+func Sensitive(name string) bool {
+	return name == "otp" || name == "withdrawal_confirmation"
+}
+
+// Render builds the text for the named template.
+func Render(name string, data map[string]any) (string, error) {
+	t, ok := templates[name]
+	if !ok {
+		return "", fmt.Errorf("sms: unknown template %q", name)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
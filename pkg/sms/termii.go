@@ -0,0 +1,103 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Termii sends through the Termii messaging API. Delivery reports arrive on
+// the webhook configured in the Termii dashboard.
+type Termii struct {
+	BaseURL  string // e.g. https://api.ng.termii.com
+	APIKey   string
+	SenderID string
+	Channel  string // "dnd" reaches numbers on the do-not-disturb list
+	Client   *http.Client
+}
+
+func (t *Termii) Name() string { return "termii" }
+
+func (t *Termii) Send(ctx context.Context, to, body string) (Result, error) {
+	payload, _ := json.Marshal(map[string]string{
+		"api_key": t.APIKey,
+		"to":      strings.TrimPrefix(to, "+"),
+		"from":    t.SenderID,
+		"sms":     body,
+		"type":    "plain",
+		"channel": t.Channel,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.BaseURL+"/api/sms/send", bytes.NewReader(payload))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := t.Client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer res.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode/100 != 2 {
+		if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnprocessableEntity {
+			return Result{}, fmt.Errorf("%w: termii: %s", ErrRejected, raw)
+		}
+		return Result{}, fmt.Errorf("sms: termii: status %d %s", res.StatusCode, raw)
+	}
+	var out struct {
+		MessageID string `json:"message_id"`
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return Result{}, err
+	}
+	if out.MessageID == "" {
+		return Result{}, fmt.Errorf("%w: termii: %s", ErrRejected, out.Message)
+	}
+	return Result{ProviderID: out.MessageID}, nil
+}
+
+// ParseCallback verifies and parses a Termii delivery report. When secret is
+// set the X-Termii-Signature header must be HMAC-SHA512(secret, body).
+func (t *Termii) ParseCallback(body []byte, signature, secret string) (Update, error) {
+	if secret != "" {
+		mac := hmac.New(sha512.New, []byte(secret))
+		mac.Write(body)
+		if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(strings.ToLower(signature))) {
+			return Update{}, ErrBadSignature
+		}
+	}
+	var r struct {
+		MessageID string `json:"message_id"`
+		Status    string `json:"status"`
+		Cost      any    `json:"cost"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return Update{}, err
+	}
+	u := Update{ProviderID: r.MessageID, Currency: "NGN"}
+	if r.Cost != nil {
+		u.Cost = fmt.Sprint(r.Cost)
+	}
+	switch strings.ToLower(r.Status) {
+	case "delivered", "delivrd":
+		u.Status = StatusDelivered
+	case "message sent", "sent", "accepted":
+		u.Status = StatusSent
+	case "rejected", "expired", "dnd active on phone number", "message failed":
+		u.Status = StatusFailed
+		u.Error = r.Status
+	default:
+		u.Status = StatusUndelivered
+		u.Error = r.Status
+	}
+	return u, nil
+}
@@ -0,0 +1,136 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Twilio sends through the Programmable Messaging API. StatusCallback, when
+// set, receives delivery reports for every message.
+type Twilio struct {
+	AccountSID     string
+	AuthToken      string
+	From           string // number or messaging service SID (MG...)
+	StatusCallback string
+	Client         *http.Client
+}
+
+func (t *Twilio) Name() string { return "twilio" }
+
+func (t *Twilio) api(path string) string {
+	return "https://api.twilio.com/2010-04-01/Accounts/" + t.AccountSID + path
+}
+
+func (t *Twilio) Send(ctx context.Context, to, body string) (Result, error) {
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(t.From, "MG") {
+		form.Set("MessagingServiceSid", t.From)
+	} else {
+		form.Set("From", t.From)
+	}
+	if t.StatusCallback != "" {
+		form.Set("StatusCallback", t.StatusCallback)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.api("/Messages.json"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return Result{}, err
+	}
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var out struct {
+		SID       string  `json:"sid"`
+		Price     *string `json:"price"`
+		PriceUnit string  `json:"price_unit"`
+	}
+	if err := t.do(req, &out); err != nil {
+		return Result{}, err
+	}
+	r := Result{ProviderID: out.SID, Currency: out.PriceUnit}
+	if out.Price != nil {
+		r.Cost = strings.TrimPrefix(*out.Price, "-") // Twilio reports charges as negative
+	}
+	return r, nil
+}
+
+// Price fetches the charge for a sent message.
+func (t *Twilio) Price(ctx context.Context, sid string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.api("/Messages/"+url.PathEscape(sid)+".json"), nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	var out struct {
+		Price     *string `json:"price"`
+		PriceUnit string  `json:"price_unit"`
+	}
+	if err := t.do(req, &out); err != nil {
+		return "", "", err
+	}
+	if out.Price == nil {
+		return "", "", ErrPriceUnknown
+	}
+	return strings.TrimPrefix(*out.Price, "-"), out.PriceUnit, nil
+}
+
+func (t *Twilio) do(req *http.Request, out any) error {
+	res, err := t.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode/100 != 2 {
+		// 400s carry Twilio error codes for bad numbers, opted-out recipients etc.
+		if res.StatusCode == http.StatusBadRequest {
+			return fmt.Errorf("%w: twilio: %s", ErrRejected, raw)
+		}
+		return fmt.Errorf("sms: twilio: status %d %s", res.StatusCode, raw)
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// ParseCallback verifies X-Twilio-Signature for a status callback posted to
+// fullURL and parses it. form must be the parsed POST body.
+func (t *Twilio) ParseCallback(fullURL string, form url.Values, signature string) (Update, error) {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(fullURL)
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteString(form.Get(k))
+	}
+	mac := hmac.New(sha1.New, []byte(t.AuthToken))
+	mac.Write([]byte(b.String()))
+	if !hmac.Equal([]byte(base64.StdEncoding.EncodeToString(mac.Sum(nil))), []byte(signature)) {
+		return Update{}, ErrBadSignature
+	}
+
+	u := Update{ProviderID: form.Get("MessageSid")}
+	switch form.Get("MessageStatus") {
+	case "delivered":
+		u.Status = StatusDelivered
+	case "undelivered":
+		u.Status = StatusUndelivered
+	case "failed":
+		u.Status = StatusFailed
+	default: // accepted, queued, sending, sent
+		u.Status = StatusSent
+	}
+	if code := form.Get("ErrorCode"); code != "" {
+		u.Error = "twilio error " + code
+	}
+	return u, nil
+}
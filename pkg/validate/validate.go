@@ -0,0 +1,176 @@
+// Package validate checks request structs declared with `validate` tags
+// (github.com/go-playground/validator) and turns failures into an
+// apierror.Validation with one detail per field, named by its JSON key.
+//
+// Domain validators on top of the built-ins:
+//
+//	bankcode  3-digit CBN or 6-digit NIP institution code
+//	nuban     10-digit Nigerian account number
+//	bvn       11-digit Bank Verification Number
+//	kobo      positive amount in kobo, at most MaxKobo
+//	username  3-30 letters, digits or underscores, starting with a letter
+//	phone     phone number Phone can normalize
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/sudo-init-do/okies-backend/pkg/apierror"
+)
+
+// MaxKobo bounds any single amount (₦10bn) so typos and overflow attempts
+// fail validation rather than reaching the ledger.
+const MaxKobo int64 = 1_000_000_000_000
+
+var (
+	reBankCode = regexp.MustCompile(`^(\d{3}|\d{6})$`)
+	reNUBAN    = regexp.MustCompile(`^\d{10}$`)
+	reBVN      = regexp.MustCompile(`^\d{11}$`)
+	reUsername = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{2,29}$`)
+	reE164     = regexp.MustCompile(`^\+[1-9]\d{7,14}$`)
+	rePhoneSep = regexp.MustCompile(`[\s().-]`)
+)
+
+var v = func() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	str := func(re *regexp.Regexp) validator.Func {
+		return func(fl validator.FieldLevel) bool { return re.MatchString(fl.Field().String()) }
+	}
+	must(v.RegisterValidation("bankcode", str(reBankCode)))
+	must(v.RegisterValidation("nuban", str(reNUBAN)))
+	must(v.RegisterValidation("bvn", str(reBVN)))
+	must(v.RegisterValidation("username", str(reUsername)))
+	must(v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		_, ok := Phone(fl.Field().String())
+		return ok
+	}))
+	must(v.RegisterValidation("kobo", func(fl validator.FieldLevel) bool {
+		switch fl.Field().Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			n := fl.Field().Int()
+			return n > 0 && n <= MaxKobo
+		}
+		return false
+	}))
+	return v
+}()
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Username reports whether s is a well-formed username; see the username tag.
+func Username(s string) bool { return reUsername.MatchString(s) }
+
+// Phone normalizes a phone number to E.164. Nigerian numbers may be given
+// in local form (0803 123 4567) or without the plus (2348031234567); others
+// need their +country code. Spaces, dashes, dots and brackets are ignored.
+func Phone(s string) (string, bool) {
+	s = rePhoneSep.ReplaceAllString(s, "")
+	switch {
+	case len(s) == 11 && strings.HasPrefix(s, "0"):
+		s = "+234" + s[1:]
+	case len(s) == 13 && strings.HasPrefix(s, "234"):
+		s = "+" + s
+	}
+	if !reE164.MatchString(s) || (strings.HasPrefix(s, "+234") && len(s) != 14) {
+		return "", false
+	}
+	return s, true
+}
+
+// Struct validates s. It returns nil or an *apierror.Error (422
+// validation_failed) listing every invalid field.
+func Struct(s any) error {
+	err := v.Struct(s)
+	if err == nil {
+		return nil
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+	details := make([]apierror.FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		details = append(details, apierror.FieldError{
+			Field:   fieldPath(fe),
+			Code:    fe.Tag(),
+			Message: message(fe),
+		})
+	}
+	return apierror.Validation(details...)
+}
+
+// fieldPath drops the top-level struct name: "signupReq.email" -> "email".
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if _, rest, ok := strings.Cut(ns, "."); ok {
+		return rest
+	}
+	return fe.Field()
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_with":
+		return "is required"
+	case "required_without", "required_without_all":
+		return "is required when the related fields are missing"
+	case "email":
+		return "must be a valid email address"
+	case "uuid", "uuid4":
+		return "must be a UUID"
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	case "min":
+		if fe.Kind() == reflect.String {
+			return "must be at least " + fe.Param() + " characters"
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return "must be at most " + fe.Param() + " characters"
+		}
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be " + fe.Param() + " or more"
+	case "excluded_with":
+		return "cannot be combined with a related field"
+	case "datetime":
+		return "must match the format " + fe.Param()
+	case "numeric":
+		return "must contain digits only"
+	case "bankcode":
+		return "must be a 3 or 6 digit bank code"
+	case "nuban":
+		return "must be a 10 digit account number"
+	case "bvn":
+		return "must be an 11 digit BVN"
+	case "kobo":
+		return "must be a positive amount in kobo"
+	case "username":
+		return "must be 3-30 letters, digits or underscores, starting with a letter"
+	case "phone":
+		return "must be a phone number, with its country code outside Nigeria"
+	}
+	return "is invalid"
+}